@@ -1,21 +1,29 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/user/votex-template/backend/internal/api"
 	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/keys"
+	"github.com/user/votex-template/backend/internal/metrics"
 	"github.com/user/votex-template/backend/internal/middleware"
 	"github.com/user/votex-template/backend/internal/service"
 	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/mail"
 	"github.com/user/votex-template/backend/pkg/router"
 )
 
@@ -38,36 +46,128 @@ func main() {
 	defer db.Close()
 
 	// Run migrations
-	if err := runMigrations(cfg, isSQLite); err != nil {
+	version, err := runMigrations(cfg, isSQLite)
+	if err != nil {
 		slog.Error("Failed to run migrations", "error", err)
 		os.Exit(1)
 	}
+	metrics.MigrationVersion.Set(float64(version))
 
 	// Initialize store
 	storeInstance := store.New(db, isSQLite)
+	if cfg.MetricsEnabled {
+		metrics.RegisterDB(db.DB)
+		metrics.RegisterEmailQueue(storeInstance)
+	}
+
+	// Load token signing keys; database keys are rotated in the background
+	keyring, err := keys.New(context.Background(), cfg, storeInstance)
+	if err != nil {
+		slog.Error("Failed to load token signing keys", "error", err)
+		os.Exit(1)
+	}
+	go keyring.Run(context.Background())
+
+	// Load the breached password corpus, if any, before accepting passwords
+	breaches, err := service.LoadBreachedPasswords(cfg)
+	if err != nil {
+		slog.Error("Failed to load breached passwords", "error", err)
+		os.Exit(1)
+	}
+	if breaches != nil {
+		slog.Info("Loaded breached passwords", "hashes", breaches.Len())
+	}
+
+	// Sign outgoing email when a DKIM key is configured
+	dkim, err := service.LoadDKIM(cfg)
+	if err != nil {
+		slog.Error("Failed to load DKIM key", "error", err)
+		os.Exit(1)
+	}
+	if dkim != nil {
+		name, record, err := dkim.TXTRecord()
+		if err != nil {
+			slog.Error("Failed to build DKIM key record", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Signing email with DKIM; publish the key as a TXT record", "name", name, "record", record)
+	}
+
+	// Outgoing email is queued and delivered by background workers, which
+	// are stopped after the server on shutdown
+	transport := service.NewMailer(cfg, dkim)
+	emailQueue := service.NewEmailQueue(storeInstance, cfg, transport)
+	var mailer mail.Mailer = emailQueue
+	if cfg.EmailQueueWorkers == 0 {
+		mailer = transport
+	}
+	queueCtx, stopQueue := context.WithCancel(context.Background())
+	queueDone := make(chan struct{})
+	go func() {
+		emailQueue.Run(queueCtx)
+		close(queueDone)
+	}()
 
 	// Initialize services
-	authService := service.NewAuthService(storeInstance, cfg)
+	emailService := service.NewEmailService(cfg, mailer)
+	authService := service.NewAuthService(storeInstance, cfg, keyring, breaches, emailService)
+	if err := authService.BootstrapAdmins(context.Background()); err != nil {
+		slog.Error("Failed to bootstrap admin accounts", "error", err)
+		os.Exit(1)
+	}
+
+	// The identity provider for sibling services is only served when configured
+	var oauthHandler *api.OAuthHandler
+	if cfg.IDPIssuer != "" {
+		oauthService := service.NewOAuthService(storeInstance, cfg, authService, keyring)
+		oauthHandler = api.NewOAuthHandler(oauthService)
+	}
 
 	// Initialize handlers
 	authHandler := api.NewAuthHandler(authService)
 	userHandler := api.NewUserHandler(authService)
+	keysHandler := api.NewKeysHandler(keyring)
+	emailQueueHandler := api.NewEmailQueueHandler(emailQueue)
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(cfg)
-	rateLimiter := middleware.NewRateLimiter(cfg)
+	authMiddleware := middleware.NewAuthMiddleware(cfg, storeInstance, keyring)
+	rateLimiter, err := middleware.NewRateLimiter(cfg)
+	if err != nil {
+		slog.Error("Failed to set up rate limiting", "error", err)
+		os.Exit(1)
+	}
+	defer rateLimiter.Close()
+	pingCtx, cancelPing := context.WithTimeout(context.Background(), 2*time.Second)
+	if err := rateLimiter.Ping(pingCtx); err != nil {
+		slog.Warn("Redis is unreachable, rate limiting in memory until it is", "error", err)
+	}
+	cancelPing()
 
 	// Initialize router with middleware
-	r := router.New()
+	r := router.New(middleware.ClientIP(cfg))
 
 	// Apply global middleware
+	if cfg.MetricsEnabled {
+		r.Use(middleware.Metrics)
+	}
 	r.Use(middleware.SecurityHeaders)
 	r.Use(middleware.CORS(cfg))
 	r.Use(rateLimiter.RateLimit)
+	r.Use(middleware.Locale)
 
 	// Health check endpoint
 	r.Get("/health", http.HandlerFunc(api.HandleHealthCheck))
 
+	// Metrics, on their own listener when METRICS_ADDR is set
+	var metricsServer *http.Server
+	if cfg.MetricsEnabled && cfg.MetricsAddr == "" {
+		r.Handle("/metrics", metrics.Handler())
+	} else if cfg.MetricsEnabled {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: cfg.MetricsAddr, Handler: metricsMux}
+	}
+
 	// API documentation
 	r.Get("/api/docs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
@@ -107,29 +207,121 @@ func main() {
 
 	// Auth endpoints
 	r.Route("/api/auth", func(r chi.Router) {
-		r.Post("/register", http.HandlerFunc(authHandler.Register))
-		r.Post("/login", http.HandlerFunc(authHandler.Login))
-		r.Post("/password-reset", http.HandlerFunc(authHandler.RequestPasswordReset))
-		r.Post("/password-reset/{token}", http.HandlerFunc(authHandler.ResetPassword))
+		// Endpoints that check credentials, store a login ceremony or send
+		// email get the strict policy
+		r.Group(func(r chi.Router) {
+			r.Use(rateLimiter.Limit(middleware.PolicyAuth))
+			r.Post("/register", http.HandlerFunc(authHandler.Register))
+			r.Post("/login", http.HandlerFunc(authHandler.Login))
+			r.Post("/login/mfa", http.HandlerFunc(authHandler.VerifyMFA))
+			r.Post("/login/passkey/begin", http.HandlerFunc(authHandler.BeginPasskeyLogin))
+			r.Post("/login/passkey/finish", http.HandlerFunc(authHandler.FinishPasskeyLogin))
+			r.Post("/oidc/{provider}/start", http.HandlerFunc(authHandler.StartOIDCLogin))
+			r.Post("/oidc/{provider}/callback", http.HandlerFunc(authHandler.CompleteOIDCLogin))
+			r.Post("/magic-link", http.HandlerFunc(authHandler.RequestMagicLink))
+			r.Post("/magic-link/{token}", http.HandlerFunc(authHandler.LoginWithMagicLink))
+			r.Post("/password-reset", http.HandlerFunc(authHandler.RequestPasswordReset))
+			r.Post("/password-reset/{token}", http.HandlerFunc(authHandler.ResetPassword))
+			r.Post("/verify-email/resend", http.HandlerFunc(authHandler.ResendVerificationEmail))
+			r.Post("/unlock/{token}", http.HandlerFunc(authHandler.UnlockAccount))
+		})
+
+		// Token refreshes are routine for signed-in clients but still check a
+		// credential, so they get a policy of their own
+		r.With(rateLimiter.Limit(middleware.PolicyToken)).Post("/refresh", http.HandlerFunc(authHandler.Refresh))
 
-		// Protected auth endpoints
+		r.Get("/oidc/providers", http.HandlerFunc(authHandler.ListOIDCProviders))
+		r.Post("/verify-email/{token}", http.HandlerFunc(authHandler.VerifyEmail))
+		r.Post("/email-change/confirm/{token}", http.HandlerFunc(authHandler.ConfirmEmailChange))
+		r.Post("/email-change/revert/{token}", http.HandlerFunc(authHandler.RevertEmailChange))
+
+		// API keys may read the profile
+		r.With(authMiddleware.Authenticate, rateLimiter.Limit(middleware.PolicyUser)).Get("/profile", http.HandlerFunc(authHandler.Profile))
+
+		// Protected auth endpoints; account settings need a signed-in session
 		r.Group(func(r chi.Router) {
-			r.Use(authMiddleware.Authenticate)
-			r.Get("/profile", http.HandlerFunc(authHandler.Profile))
+			r.Use(authMiddleware.Authenticate, rateLimiter.Limit(middleware.PolicyUser), middleware.RequireSession)
+			r.Post("/logout", http.HandlerFunc(authHandler.Logout))
 			r.Put("/profile", http.HandlerFunc(authHandler.UpdateProfile))
 			r.Delete("/account", http.HandlerFunc(authHandler.DeleteAccount))
+			r.Post("/mfa/enroll", http.HandlerFunc(authHandler.EnrollMFA))
+			r.Post("/mfa/confirm", http.HandlerFunc(authHandler.ConfirmMFA))
+			r.Post("/mfa/disable", http.HandlerFunc(authHandler.DisableMFA))
+			r.Post("/mfa/recovery-codes", http.HandlerFunc(authHandler.RegenerateRecoveryCodes))
+			r.Get("/profile/passkeys", http.HandlerFunc(authHandler.ListPasskeys))
+			r.Post("/profile/passkeys/begin", http.HandlerFunc(authHandler.BeginPasskeyRegistration))
+			r.Post("/profile/passkeys/finish", http.HandlerFunc(authHandler.FinishPasskeyRegistration))
+			r.Delete("/profile/passkeys/{id}", http.HandlerFunc(authHandler.DeletePasskey))
+			r.Get("/profile/identities", http.HandlerFunc(authHandler.ListIdentities))
+			r.With(authMiddleware.RequireVerifiedEmail).Post("/profile/identities/{provider}/start", http.HandlerFunc(authHandler.StartOIDCLink))
+			r.Post("/profile/identities/{provider}/callback", http.HandlerFunc(authHandler.CompleteOIDCLink))
+			r.Delete("/profile/identities/{id}", http.HandlerFunc(authHandler.DeleteIdentity))
+			r.Get("/profile/api-keys", http.HandlerFunc(authHandler.ListAPIKeys))
+			r.With(authMiddleware.RequireVerifiedEmail).Post("/profile/api-keys", http.HandlerFunc(authHandler.CreateAPIKey))
+			r.Delete("/profile/api-keys/{id}", http.HandlerFunc(authHandler.RevokeAPIKey))
+			if oauthHandler != nil {
+				r.Get("/profile/consents", http.HandlerFunc(oauthHandler.ListConsents))
+				r.Delete("/profile/consents/{client_id}", http.HandlerFunc(oauthHandler.RevokeConsent))
+			}
 		})
 	})
 
 	// User management endpoints
 	r.Route("/api/users", func(r chi.Router) {
-		r.Use(authMiddleware.Authenticate)
-		r.Get("/", http.HandlerFunc(userHandler.ListUsers))
+		r.Use(authMiddleware.Authenticate, rateLimiter.Limit(middleware.PolicyUser))
+		r.With(middleware.RequirePermission(middleware.PermissionUsersRead)).Get("/", http.HandlerFunc(userHandler.ListUsers))
 		r.Get("/{id}", http.HandlerFunc(userHandler.GetUser))
 		r.Put("/{id}", http.HandlerFunc(userHandler.UpdateUser))
 		r.Delete("/{id}", http.HandlerFunc(userHandler.DeleteUser))
+		r.With(middleware.RequirePermission(middleware.PermissionUsersWrite)).Post("/{id}/unlock", http.HandlerFunc(userHandler.UnlockUser))
+
+		// Role management endpoints
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequirePermission(middleware.PermissionRolesWrite))
+			r.Post("/{id}/roles", http.HandlerFunc(userHandler.AssignRole))
+			r.Delete("/{id}/roles/{role}", http.HandlerFunc(userHandler.RemoveRole))
+		})
+	})
+
+	// Email queue endpoints
+	r.Route("/api/admin/emails", func(r chi.Router) {
+		r.Use(authMiddleware.Authenticate, rateLimiter.Limit(middleware.PolicyUser))
+		r.With(middleware.RequirePermission(middleware.PermissionEmailsRead)).Get("/", http.HandlerFunc(emailQueueHandler.ListEmails))
+		r.With(middleware.RequirePermission(middleware.PermissionEmailsWrite)).Post("/{id}/requeue", http.HandlerFunc(emailQueueHandler.RequeueEmail))
 	})
 
+	// Public keys for verifying access and ID tokens
+	r.Get("/.well-known/jwks.json", http.HandlerFunc(keysHandler.JWKS))
+
+	// Identity provider endpoints
+	if oauthHandler != nil {
+		r.Get("/.well-known/openid-configuration", http.HandlerFunc(oauthHandler.Discovery))
+		r.With(rateLimiter.Limit(middleware.PolicyToken)).Post("/oauth/token", http.HandlerFunc(oauthHandler.Token))
+		r.Get("/oauth/userinfo", http.HandlerFunc(oauthHandler.UserInfo))
+		r.Post("/oauth/userinfo", http.HandlerFunc(oauthHandler.UserInfo))
+
+		r.Route("/api/oauth", func(r chi.Router) {
+			r.Use(authMiddleware.Authenticate, rateLimiter.Limit(middleware.PolicyUser))
+			r.With(middleware.RequireSession, authMiddleware.RequireVerifiedEmail).Get("/authorize", http.HandlerFunc(oauthHandler.GetAuthorization))
+			r.With(middleware.RequireSession, authMiddleware.RequireVerifiedEmail).Post("/authorize", http.HandlerFunc(oauthHandler.Authorize))
+
+			// Client registration endpoints
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(middleware.PermissionClientsWrite))
+				r.Get("/clients", http.HandlerFunc(oauthHandler.ListClients))
+				r.Post("/clients", http.HandlerFunc(oauthHandler.RegisterClient))
+				r.Delete("/clients/{id}", http.HandlerFunc(oauthHandler.DeleteClient))
+			})
+		})
+	}
+
+	// Email previews for working on the templates
+	if cfg.IsDevelopment() {
+		emailPreviewHandler := api.NewEmailPreviewHandler(emailService)
+		r.Get("/api/dev/emails", http.HandlerFunc(emailPreviewHandler.ListEmailTemplates))
+		r.Get("/api/dev/emails/{name}", http.HandlerFunc(emailPreviewHandler.PreviewEmail))
+	}
+
 	// Start server
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%s", cfg.Port),
@@ -141,15 +333,48 @@ func main() {
 		"environment", cfg.Environment,
 		"database", cfg.DBType,
 		"rate_limit", fmt.Sprintf("%d req/min", cfg.RateLimitRequests),
+		"rate_limit_store", cfg.RateLimitStore,
 	)
 
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		slog.Error("Could not start server", "error", err)
-		os.Exit(1)
+	// Serve until interrupted, then let requests in flight finish before
+	// the email queue drains
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Could not start server", "error", err)
+			os.Exit(1)
+		}
+	}()
+	if metricsServer != nil {
+		slog.Info("Serving metrics", "addr", cfg.MetricsAddr)
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("Could not start metrics server", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+	<-ctx.Done()
+
+	slog.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shut down server", "error", err)
+	}
+	stopQueue()
+	<-queueDone
+	if metricsServer != nil {
+		metricsServer.Shutdown(shutdownCtx)
 	}
 }
 
-func runMigrations(cfg *config.Config, isSQLite bool) error {
+// shutdownTimeout is how long requests in flight get to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
+// runMigrations migrates the database and returns the schema version
+func runMigrations(cfg *config.Config, isSQLite bool) (uint, error) {
 	var sourceURL, databaseURL string
 
 	if isSQLite {
@@ -162,14 +387,47 @@ func runMigrations(cfg *config.Config, isSQLite bool) error {
 
 	m, err := migrate.New(sourceURL, databaseURL)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer m.Close()
 
+	if isSQLite {
+		if err := resetFailedSQLiteMigration(m); err != nil {
+			return 0, err
+		}
+	}
+
 	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return 0, err
+	}
+
+	version, _, err := m.Version()
+	if err != nil {
+		return 0, err
+	}
+	slog.Info("Database migrations applied successfully", "version", version)
+	return version, nil
+}
+
+// resetFailedSQLiteMigration steps a SQLite database left dirty by a failed
+// migration back to the version before it so that it is retried. Each SQLite
+// migration runs in a transaction, so a failed one has applied nothing. This
+// lets databases that stopped at the original version 2, which SQLite always
+// rejected, pick up the corrected one.
+func resetFailedSQLiteMigration(m *migrate.Migrate) error {
+	version, dirty, err := m.Version()
+	if err == migrate.ErrNilVersion {
+		return nil
+	}
+	if err != nil || !dirty {
 		return err
 	}
 
-	slog.Info("Database migrations applied successfully")
-	return nil
+	// Migration versions are numbered without gaps
+	previous := int(version) - 1
+	if previous == 0 {
+		previous = database.NilVersion
+	}
+	slog.Warn("Retrying failed database migration", "version", version)
+	return m.Force(previous)
 }
@@ -26,6 +26,7 @@ type ErrorResponse struct {
 type ValidationError struct {
 	Field   string `json:"field"`
 	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
 }
 
 // ValidationErrorResponse represents validation error response
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/middleware"
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"max=20,dive,required,max=64"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,min=1"`
+}
+
+// ListAPIKeys returns the current user's API keys without their secrets
+func (h *AuthHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	keys, err := h.Service.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list API keys: "+err.Error())
+		return
+	}
+
+	WriteSuccess(w, keys)
+}
+
+// CreateAPIKey mints an API key. The key is only ever returned here.
+func (h *AuthHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	key, err := h.Service.CreateAPIKey(r.Context(), userID, req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidScope:
+			WriteError(w, http.StatusBadRequest, "Scopes must be permissions your account holds")
+		case service.ErrAPIKeyExpiryTooLong:
+			WriteError(w, http.StatusBadRequest, "Expiry exceeds the maximum allowed for API keys")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to create API key: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, key)
+}
+
+// RevokeAPIKey deletes one of the current user's API keys
+func (h *AuthHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.Service.RevokeAPIKey(r.Context(), userID, chi.URLParam(r, "id")); err != nil {
+		switch err {
+		case service.ErrAPIKeyNotFound:
+			WriteError(w, http.StatusNotFound, "API key not found")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to revoke API key: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "API key revoked",
+	})
+}
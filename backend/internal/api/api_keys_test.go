@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+func TestAuthHandler_CreateAPIKey(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		err            error
+		expectedStatus int
+	}{
+		{
+			name:           "valid request",
+			body:           `{"name":"CI","scopes":["users:read"],"expires_in_days":30}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing name",
+			body:           `{"scopes":["users:read"]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "negative expiry",
+			body:           `{"name":"CI","expires_in_days":-1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "scope not held",
+			body:           `{"name":"CI","scopes":["roles:write"]}`,
+			err:            service.ErrInvalidScope,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "expiry too long",
+			body:           `{"name":"CI","expires_in_days":1000}`,
+			err:            service.ErrAPIKeyExpiryTooLong,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotName string
+			handler := NewAuthHandler(&MockAuthService{
+				createAPIKeyFunc: func(userID, name string, scopes []string, expiresInDays int) (*service.CreatedAPIKey, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					gotName = name
+					return &service.CreatedAPIKey{APIKey: service.APIKey{ID: "key-1", Name: name}, Key: "vtx_secret"}, nil
+				},
+			})
+
+			req := httptest.NewRequest("POST", "/api/auth/profile/api-keys", bytes.NewBufferString(tt.body))
+			req = withAuth(req, "1", nil, nil)
+			w := httptest.NewRecorder()
+			handler.CreateAPIKey(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d (%s)", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK {
+				if gotName != "CI" {
+					t.Errorf("expected the key name to be passed through, got %q", gotName)
+				}
+				if !bytes.Contains(w.Body.Bytes(), []byte(`"key":"vtx_secret"`)) {
+					t.Errorf("expected the new key in the response, got %s", w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestAuthHandler_RevokeAPIKey(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		keyID          string
+		expectedStatus int
+	}{
+		{name: "own key", userID: "1", keyID: "key-1", expectedStatus: http.StatusOK},
+		{name: "unknown key", userID: "1", keyID: "key-2", expectedStatus: http.StatusNotFound},
+		{name: "unauthenticated", keyID: "key-1", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{
+				revokeAPIKeyFunc: func(userID, keyID string) error {
+					if keyID != "key-1" {
+						return service.ErrAPIKeyNotFound
+					}
+					return nil
+				},
+			})
+
+			req := httptest.NewRequest("DELETE", "/api/auth/profile/api-keys/"+tt.keyID, nil)
+			if tt.userID != "" {
+				req = withAuth(req, tt.userID, nil, map[string]string{"id": tt.keyID})
+			}
+			w := httptest.NewRecorder()
+			handler.RevokeAPIKey(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
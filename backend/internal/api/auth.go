@@ -2,10 +2,15 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
+	"github.com/user/votex-template/backend/internal/metrics"
 	"github.com/user/votex-template/backend/internal/middleware"
 	"github.com/user/votex-template/backend/internal/service"
 )
@@ -25,27 +30,48 @@ func NewAuthHandler(s service.AuthServiceInterface) *AuthHandler {
 type AuthRequest struct {
 	Username string `json:"username" validate:"required,min=3,max=32"`
 	Email    string `json:"email" validate:"omitempty,email"`
-	Password string `json:"password" validate:"required,min=8,max=72"`
+	Password string `json:"password" validate:"required,min=8,max=1024"`
 }
 
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  struct {
-		ID        string  `json:"id"`
-		Username  string  `json:"username"`
-		Email     *string `json:"email,omitempty"`
-		Age       *int    `json:"age,omitempty"`
-		CreatedAt *string `json:"created_at,omitempty"`
-		UpdatedAt *string `json:"updated_at,omitempty"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    string `json:"expires_at"`
+	User         struct {
+		ID            string  `json:"id"`
+		Username      string  `json:"username"`
+		Email         *string `json:"email,omitempty"`
+		EmailVerified bool    `json:"email_verified"`
+		Age           *int    `json:"age,omitempty"`
+		CreatedAt     *string `json:"created_at,omitempty"`
+		UpdatedAt     *string `json:"updated_at,omitempty"`
 	} `json:"user"`
 }
 
+// MFAChallengeResponse is returned by Login instead of AuthResponse when the
+// account has two-factor authentication enabled
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    string `json:"expires_at"`
+}
+
 type PasswordResetRequest struct {
 	Email string `json:"email" validate:"required,email"`
 }
 
 type PasswordResetConfirmRequest struct {
-	Password string `json:"password" validate:"required,min=8,max=72"`
+	Password string `json:"password" validate:"required,min=8,max=1024"`
 }
 
 type UserUpdateRequest struct {
@@ -54,6 +80,20 @@ type UserUpdateRequest struct {
 	Age      *int    `json:"age" validate:"omitempty,min=0,max=150"`
 }
 
+func newAuthResponse(tokens *service.AuthTokens, user *service.User) AuthResponse {
+	response := AuthResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt.Format(time.RFC3339),
+	}
+	response.User.ID = user.ID
+	response.User.Username = user.Username
+	response.User.Email = user.Email
+	response.User.EmailVerified = user.EmailVerifiedAt != nil
+	response.User.Age = user.Age
+	return response
+}
+
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req AuthRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -66,37 +106,37 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, user, err := h.Service.Register(req.Username, req.Email, req.Password)
+	tokens, user, err := h.Service.Register(r.Context(), req.Username, req.Email, req.Password)
 	if err != nil {
+		if writeWeakPassword(w, err) {
+			return
+		}
+
 		switch err {
 		case service.ErrUserExists:
 			WriteError(w, http.StatusConflict, "Username already exists")
 		case service.ErrEmailExists:
 			WriteError(w, http.StatusConflict, "Email already exists")
+		case service.ErrEmailRequired:
+			WriteError(w, http.StatusBadRequest, "An email address is required")
+		case service.ErrPasswordTooLong:
+			WriteError(w, http.StatusBadRequest, "Password is too long")
 		default:
 			WriteError(w, http.StatusInternalServerError, "Failed to register user: "+err.Error())
 		}
 		return
 	}
 
-	response := AuthResponse{
-		Token: token,
-		User: struct {
-			ID        string  `json:"id"`
-			Username  string  `json:"username"`
-			Email     *string `json:"email,omitempty"`
-			Age       *int    `json:"age,omitempty"`
-			CreatedAt *string `json:"created_at,omitempty"`
-			UpdatedAt *string `json:"updated_at,omitempty"`
-		}{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Age:      user.Age,
-		},
+	// The account cannot sign in until its email has been verified
+	if tokens == nil {
+		WriteSuccess(w, EmailVerificationPendingResponse{
+			EmailVerificationRequired: true,
+			Email:                     req.Email,
+		})
+		return
 	}
 
-	WriteSuccess(w, response)
+	WriteSuccess(w, newAuthResponse(tokens, user))
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -111,35 +151,145 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, user, err := h.Service.Login(req.Username, req.Password)
+	tokens, user, err := h.Service.Login(r.Context(), req.Username, req.Password, middleware.RemoteIP(r))
+	recordLogin("password", err)
 	if err != nil {
+		if writeMFAChallenge(w, err) || writeLoginLocked(w, err) {
+			return
+		}
+
 		switch err {
 		case service.ErrInvalidCredentials:
 			WriteError(w, http.StatusUnauthorized, "Invalid credentials")
+		case service.ErrEmailNotVerified:
+			writeEmailNotVerified(w)
 		default:
 			WriteError(w, http.StatusInternalServerError, "Login failed: "+err.Error())
 		}
 		return
 	}
 
-	response := AuthResponse{
-		Token: token,
-		User: struct {
-			ID        string  `json:"id"`
-			Username  string  `json:"username"`
-			Email     *string `json:"email,omitempty"`
-			Age       *int    `json:"age,omitempty"`
-			CreatedAt *string `json:"created_at,omitempty"`
-			UpdatedAt *string `json:"updated_at,omitempty"`
-		}{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Age:      user.Age,
-		},
+	WriteSuccess(w, newAuthResponse(tokens, user))
+}
+
+// writeMFAChallenge answers a login that still needs a second factor with
+// the intermediate token, reporting whether err was such a challenge
+func writeMFAChallenge(w http.ResponseWriter, err error) bool {
+	var mfaErr *service.MFARequiredError
+	if !errors.As(err, &mfaErr) {
+		return false
 	}
+	WriteSuccess(w, MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaErr.Token,
+		ExpiresAt:   mfaErr.ExpiresAt.Format(time.RFC3339),
+	})
+	return true
+}
 
-	WriteSuccess(w, response)
+// recordLogin counts a sign-in attempt by how it ended
+func recordLogin(method string, err error) {
+	var mfaErr *service.MFARequiredError
+	var lockedErr *service.LoginLockedError
+	result := "failure"
+	switch {
+	case err == nil:
+		result = "success"
+	case errors.As(err, &mfaErr):
+		result = "mfa_required"
+	case errors.As(err, &lockedErr):
+		result = "locked"
+	}
+	metrics.Logins.WithLabelValues(method, result).Inc()
+}
+
+// writeLoginLocked answers a login refused by the lockout with the time to
+// wait in Retry-After, reporting whether err was such a refusal
+func writeLoginLocked(w http.ResponseWriter, err error) bool {
+	var lockedErr *service.LoginLockedError
+	if !errors.As(err, &lockedErr) {
+		return false
+	}
+	retryAfter := int(math.Ceil(time.Until(lockedErr.Until).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	WriteJSON(w, http.StatusTooManyRequests, ErrorResponse{
+		Success: false,
+		Error:   "Too many failed login attempts. Try again later.",
+		Code:    "login_locked",
+	})
+	return true
+}
+
+// writeWeakPassword answers with the password policy rules a new password
+// breaks, reporting whether err was such a refusal
+func writeWeakPassword(w http.ResponseWriter, err error) bool {
+	var policyErr *service.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	details := make([]ValidationError, 0, len(policyErr.Violations))
+	for _, violation := range policyErr.Violations {
+		details = append(details, ValidationError{
+			Field:   "Password",
+			Message: violation.Message,
+			Code:    violation.Rule,
+		})
+	}
+	WriteJSON(w, http.StatusBadRequest, ValidationErrorResponse{
+		Success: false,
+		Error:   "Password does not meet the password policy",
+		Details: details,
+	})
+	return true
+}
+
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	tokens, err := h.Service.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidRefreshToken:
+			WriteError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		case service.ErrRefreshTokenReused:
+			WriteError(w, http.StatusUnauthorized, "Refresh token has already been used; session revoked")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to refresh token: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, TokenResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := middleware.GetSessionID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.Service.Logout(r.Context(), sessionID); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to log out: "+err.Error())
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "Logged out successfully",
+	})
 }
 
 func (h *AuthHandler) Profile(w http.ResponseWriter, r *http.Request) {
@@ -149,24 +299,26 @@ func (h *AuthHandler) Profile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.Service.GetUserByID(userID)
+	user, err := h.Service.GetUserByID(r.Context(), userID)
 	if err != nil {
 		WriteError(w, http.StatusNotFound, "User not found")
 		return
 	}
 
 	response := struct {
-		ID        string  `json:"id"`
-		Username  string  `json:"username"`
-		Email     *string `json:"email,omitempty"`
-		Age       *int    `json:"age,omitempty"`
-		CreatedAt *string `json:"created_at,omitempty"`
-		UpdatedAt *string `json:"updated_at,omitempty"`
+		ID            string  `json:"id"`
+		Username      string  `json:"username"`
+		Email         *string `json:"email,omitempty"`
+		EmailVerified bool    `json:"email_verified"`
+		Age           *int    `json:"age,omitempty"`
+		CreatedAt     *string `json:"created_at,omitempty"`
+		UpdatedAt     *string `json:"updated_at,omitempty"`
 	}{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Age:      user.Age,
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Age:           user.Age,
 	}
 
 	WriteSuccess(w, response)
@@ -184,7 +336,7 @@ func (h *AuthHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err := h.Service.RequestPasswordReset(req.Email)
+	err := h.Service.RequestPasswordReset(r.Context(), req.Email)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Failed to send password reset email: "+err.Error())
 		return
@@ -213,8 +365,12 @@ func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.Service.ResetPassword(token, req.Password)
+	err := h.Service.ResetPassword(r.Context(), token, req.Password)
 	if err != nil {
+		if writeWeakPassword(w, err) {
+			return
+		}
+
 		switch err {
 		case service.ErrTokenNotFound:
 			WriteError(w, http.StatusNotFound, "Invalid or expired token")
@@ -222,6 +378,8 @@ func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 			WriteError(w, http.StatusBadRequest, "Token has expired")
 		case service.ErrTokenUsed:
 			WriteError(w, http.StatusBadRequest, "Token has already been used")
+		case service.ErrPasswordTooLong:
+			WriteError(w, http.StatusBadRequest, "Password is too long")
 		default:
 			WriteError(w, http.StatusInternalServerError, "Failed to reset password: "+err.Error())
 		}
@@ -262,24 +420,36 @@ func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		updates["age"] = *req.Age
 	}
 
-	user, err := h.Service.UpdateUser(userID, updates)
+	user, err := h.Service.UpdateUser(r.Context(), userID, updates)
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, "Failed to update profile: "+err.Error())
+		switch err {
+		case service.ErrEmailExists:
+			WriteError(w, http.StatusConflict, "Email already exists")
+		case service.ErrEmailRequired:
+			WriteError(w, http.StatusBadRequest, "Email cannot be removed")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to update profile: "+err.Error())
+		}
 		return
 	}
 
+	// A new email is only pending until confirmed from that address
 	response := struct {
-		ID        string  `json:"id"`
-		Username  string  `json:"username"`
-		Email     *string `json:"email,omitempty"`
-		Age       *int    `json:"age,omitempty"`
-		CreatedAt *string `json:"created_at,omitempty"`
-		UpdatedAt *string `json:"updated_at,omitempty"`
+		ID            string  `json:"id"`
+		Username      string  `json:"username"`
+		Email         *string `json:"email,omitempty"`
+		EmailVerified bool    `json:"email_verified"`
+		PendingEmail  *string `json:"pending_email,omitempty"`
+		Age           *int    `json:"age,omitempty"`
+		CreatedAt     *string `json:"created_at,omitempty"`
+		UpdatedAt     *string `json:"updated_at,omitempty"`
 	}{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Age:      user.Age,
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		PendingEmail:  user.PendingEmail,
+		Age:           user.Age,
 	}
 
 	WriteSuccess(w, response)
@@ -292,7 +462,7 @@ func (h *AuthHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.Service.DeleteUser(userID)
+	err := h.Service.DeleteUser(r.Context(), userID)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Failed to delete account: "+err.Error())
 		return
@@ -4,47 +4,319 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/user/votex-template/backend/internal/service"
 	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/webauthn"
 )
 
 // MockAuthService is a mock implementation for testing
 type MockAuthService struct {
-	registerFunc func(username, password string) (string, *service.User, error)
-	loginFunc    func(username, password string) (string, *service.User, error)
+	registerFunc func(username, email, password string) (*service.AuthTokens, *service.User, error)
+	loginFunc    func(username, password string) (*service.AuthTokens, *service.User, error)
+	refreshFunc  func(refreshToken string) (*service.AuthTokens, error)
+	logoutFunc   func(sessionID string) error
 	getUserFunc  func(userID string) (*service.User, error)
+	updateFunc   func(userID string, updates map[string]interface{}) (*service.User, error)
+	deleteFunc   func(userID string) error
+	assignFunc   func(userID, role string) error
+	listFunc     func(opts store.UserListOptions) (*service.UserList, error)
+
+	verifyMFAFunc  func(mfaToken, code string) (*service.AuthTokens, *service.User, error)
+	confirmMFAFunc func(userID, code string) ([]string, error)
+
+	beginPasskeyLoginFunc  func(username string) (*service.PasskeyLogin, error)
+	finishPasskeyLoginFunc func(sessionID string, resp *webauthn.AssertionResponse) (*service.AuthTokens, *service.User, error)
+	deletePasskeyFunc      func(userID, passkeyID string) error
+
+	completeOIDCLoginFunc func(provider, state, code string) (*service.AuthTokens, *service.User, error)
+	completeOIDCLinkFunc  func(userID, provider, state, code string) (*service.Identity, error)
+	deleteIdentityFunc    func(userID, identityID string) error
+
+	createAPIKeyFunc func(userID, name string, scopes []string, expiresInDays int) (*service.CreatedAPIKey, error)
+	revokeAPIKeyFunc func(userID, keyID string) error
+
+	verifyEmailFunc        func(token string) error
+	confirmEmailChangeFunc func(token string) error
+	revertEmailChangeFunc  func(token string) error
+	unlockAccountFunc      func(token string) error
+	unlockUserFunc         func(userID, actorID string) error
+	resetPasswordFunc      func(token, newPassword string) error
+	requestMagicLinkFunc   func(email string) (string, error)
+	magicLinkLoginFunc     func(token, binding string) (*service.AuthTokens, *service.User, error)
 }
 
-func (m *MockAuthService) Register(username, password string) (string, *service.User, error) {
+func (m *MockAuthService) Register(ctx context.Context, username, email, password string) (*service.AuthTokens, *service.User, error) {
 	if m.registerFunc != nil {
-		return m.registerFunc(username, password)
+		return m.registerFunc(username, email, password)
 	}
-	return "", nil, nil
+	return nil, nil, nil
 }
 
-func (m *MockAuthService) Login(username, password string) (string, *service.User, error) {
+func (m *MockAuthService) Login(ctx context.Context, username, password, ip string) (*service.AuthTokens, *service.User, error) {
 	if m.loginFunc != nil {
 		return m.loginFunc(username, password)
 	}
-	return "", nil, nil
+	return nil, nil, nil
+}
+
+func (m *MockAuthService) Refresh(ctx context.Context, refreshToken string) (*service.AuthTokens, error) {
+	if m.refreshFunc != nil {
+		return m.refreshFunc(refreshToken)
+	}
+	return nil, nil
+}
+
+func (m *MockAuthService) Logout(ctx context.Context, sessionID string) error {
+	if m.logoutFunc != nil {
+		return m.logoutFunc(sessionID)
+	}
+	return nil
+}
+
+func (m *MockAuthService) VerifyMFA(ctx context.Context, mfaToken, code, ip string) (*service.AuthTokens, *service.User, error) {
+	if m.verifyMFAFunc != nil {
+		return m.verifyMFAFunc(mfaToken, code)
+	}
+	return nil, nil, nil
+}
+
+func (m *MockAuthService) EnrollMFA(ctx context.Context, userID string) (*service.MFAEnrollment, error) {
+	return &service.MFAEnrollment{}, nil
+}
+
+func (m *MockAuthService) ConfirmMFA(ctx context.Context, userID, code string) ([]string, error) {
+	if m.confirmMFAFunc != nil {
+		return m.confirmMFAFunc(userID, code)
+	}
+	return nil, nil
+}
+
+func (m *MockAuthService) DisableMFA(ctx context.Context, userID, code, ip string) error {
+	return nil
+}
+
+func (m *MockAuthService) RegenerateRecoveryCodes(ctx context.Context, userID, code, ip string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *MockAuthService) BeginPasskeyRegistration(ctx context.Context, userID string) (*service.PasskeyRegistration, error) {
+	return &service.PasskeyRegistration{}, nil
+}
+
+func (m *MockAuthService) FinishPasskeyRegistration(ctx context.Context, userID, sessionID, name string, resp *webauthn.RegistrationResponse) (*service.Passkey, error) {
+	return &service.Passkey{ID: "pk-1", Name: name}, nil
+}
+
+func (m *MockAuthService) BeginPasskeyLogin(ctx context.Context, username string) (*service.PasskeyLogin, error) {
+	if m.beginPasskeyLoginFunc != nil {
+		return m.beginPasskeyLoginFunc(username)
+	}
+	return &service.PasskeyLogin{}, nil
+}
+
+func (m *MockAuthService) FinishPasskeyLogin(ctx context.Context, sessionID string, resp *webauthn.AssertionResponse) (*service.AuthTokens, *service.User, error) {
+	if m.finishPasskeyLoginFunc != nil {
+		return m.finishPasskeyLoginFunc(sessionID, resp)
+	}
+	return nil, nil, nil
+}
+
+func (m *MockAuthService) ListPasskeys(ctx context.Context, userID string) ([]service.Passkey, error) {
+	return []service.Passkey{}, nil
+}
+
+func (m *MockAuthService) DeletePasskey(ctx context.Context, userID, passkeyID string) error {
+	if m.deletePasskeyFunc != nil {
+		return m.deletePasskeyFunc(userID, passkeyID)
+	}
+	return nil
+}
+
+func (m *MockAuthService) ListOIDCProviders(ctx context.Context) []string {
+	return []string{"fake"}
+}
+
+func (m *MockAuthService) StartOIDCLogin(ctx context.Context, provider string) (*service.OIDCAuthorization, error) {
+	if provider != "fake" {
+		return nil, service.ErrUnknownOIDCProvider
+	}
+	return &service.OIDCAuthorization{URL: "https://idp.example/authorize?state=abc", State: "abc"}, nil
+}
+
+func (m *MockAuthService) CompleteOIDCLogin(ctx context.Context, provider, state, code string) (*service.AuthTokens, *service.User, error) {
+	if m.completeOIDCLoginFunc != nil {
+		return m.completeOIDCLoginFunc(provider, state, code)
+	}
+	return nil, nil, nil
+}
+
+func (m *MockAuthService) StartOIDCLink(ctx context.Context, userID, provider string) (*service.OIDCAuthorization, error) {
+	return m.StartOIDCLogin(ctx, provider)
+}
+
+func (m *MockAuthService) CompleteOIDCLink(ctx context.Context, userID, provider, state, code string) (*service.Identity, error) {
+	if m.completeOIDCLinkFunc != nil {
+		return m.completeOIDCLinkFunc(userID, provider, state, code)
+	}
+	return &service.Identity{ID: "id-1", Provider: provider}, nil
 }
 
-func (m *MockAuthService) GetUserByID(userID string) (*service.User, error) {
+func (m *MockAuthService) ListIdentities(ctx context.Context, userID string) ([]service.Identity, error) {
+	return []service.Identity{}, nil
+}
+
+func (m *MockAuthService) DeleteIdentity(ctx context.Context, userID, identityID string) error {
+	if m.deleteIdentityFunc != nil {
+		return m.deleteIdentityFunc(userID, identityID)
+	}
+	return nil
+}
+
+func (m *MockAuthService) CreateAPIKey(ctx context.Context, userID, name string, scopes []string, expiresInDays int) (*service.CreatedAPIKey, error) {
+	if m.createAPIKeyFunc != nil {
+		return m.createAPIKeyFunc(userID, name, scopes, expiresInDays)
+	}
+	return &service.CreatedAPIKey{}, nil
+}
+
+func (m *MockAuthService) ListAPIKeys(ctx context.Context, userID string) ([]service.APIKey, error) {
+	return []service.APIKey{}, nil
+}
+
+func (m *MockAuthService) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	if m.revokeAPIKeyFunc != nil {
+		return m.revokeAPIKeyFunc(userID, keyID)
+	}
+	return nil
+}
+
+func (m *MockAuthService) GetUserByID(ctx context.Context, userID string) (*service.User, error) {
 	if m.getUserFunc != nil {
 		return m.getUserFunc(userID)
 	}
 	return nil, nil
 }
 
+func (m *MockAuthService) ListUsers(ctx context.Context, opts store.UserListOptions) (*service.UserList, error) {
+	if m.listFunc != nil {
+		return m.listFunc(opts)
+	}
+	return &service.UserList{}, nil
+}
+
+func (m *MockAuthService) AssignRole(ctx context.Context, userID, role string) error {
+	if m.assignFunc != nil {
+		return m.assignFunc(userID, role)
+	}
+	return nil
+}
+
+func (m *MockAuthService) RemoveRole(ctx context.Context, userID, role string) error {
+	return nil
+}
+
+func (m *MockAuthService) BootstrapAdmins(ctx context.Context) error {
+	return nil
+}
+
+func (m *MockAuthService) VerifyEmail(ctx context.Context, token string) error {
+	if m.verifyEmailFunc != nil {
+		return m.verifyEmailFunc(token)
+	}
+	return nil
+}
+
+func (m *MockAuthService) ResendVerificationEmail(ctx context.Context, email string) error {
+	return nil
+}
+
+func (m *MockAuthService) ConfirmEmailChange(ctx context.Context, token string) error {
+	if m.confirmEmailChangeFunc != nil {
+		return m.confirmEmailChangeFunc(token)
+	}
+	return nil
+}
+
+func (m *MockAuthService) RevertEmailChange(ctx context.Context, token string) error {
+	if m.revertEmailChangeFunc != nil {
+		return m.revertEmailChangeFunc(token)
+	}
+	return nil
+}
+
+func (m *MockAuthService) UnlockAccount(ctx context.Context, token string) error {
+	if m.unlockAccountFunc != nil {
+		return m.unlockAccountFunc(token)
+	}
+	return nil
+}
+
+func (m *MockAuthService) UnlockUser(ctx context.Context, userID, actorID string) error {
+	if m.unlockUserFunc != nil {
+		return m.unlockUserFunc(userID, actorID)
+	}
+	return nil
+}
+
+func (m *MockAuthService) RequestMagicLink(ctx context.Context, email string) (string, error) {
+	if m.requestMagicLinkFunc != nil {
+		return m.requestMagicLinkFunc(email)
+	}
+	return "", nil
+}
+
+func (m *MockAuthService) LoginWithMagicLink(ctx context.Context, token, binding string) (*service.AuthTokens, *service.User, error) {
+	if m.magicLinkLoginFunc != nil {
+		return m.magicLinkLoginFunc(token, binding)
+	}
+	return nil, nil, service.ErrInvalidMagicLink
+}
+
+func (m *MockAuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	return nil
+}
+
+func (m *MockAuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if m.resetPasswordFunc != nil {
+		return m.resetPasswordFunc(token, newPassword)
+	}
+	return nil
+}
+
+func (m *MockAuthService) UpdateUser(ctx context.Context, userID string, updates map[string]interface{}) (*service.User, error) {
+	if m.updateFunc != nil {
+		return m.updateFunc(userID, updates)
+	}
+	return nil, nil
+}
+
+func (m *MockAuthService) DeleteUser(ctx context.Context, userID string) error {
+	if m.deleteFunc != nil {
+		return m.deleteFunc(userID)
+	}
+	return nil
+}
+
+func testTokens() *service.AuthTokens {
+	return &service.AuthTokens{
+		AccessToken:  "jwt-token",
+		RefreshToken: "session.refresh-secret",
+		ExpiresAt:    time.Now().Add(15 * time.Minute),
+	}
+}
+
 func TestAuthHandler_Register(t *testing.T) {
 	tests := []struct {
 		name           string
 		requestBody    AuthRequest
-		mockRegister   func(username, password string) (string, *service.User, error)
+		mockRegister   func(username, email, password string) (*service.AuthTokens, *service.User, error)
 		expectedStatus int
 		expectedError  bool
 	}{
@@ -54,8 +326,8 @@ func TestAuthHandler_Register(t *testing.T) {
 				Username: "testuser",
 				Password: "password123",
 			},
-			mockRegister: func(username, password string) (string, *service.User, error) {
-				return "jwt-token", &service.User{ID: "123", Username: username}, nil
+			mockRegister: func(username, email, password string) (*service.AuthTokens, *service.User, error) {
+				return testTokens(), &service.User{ID: "123", Username: username}, nil
 			},
 			expectedStatus: http.StatusOK,
 			expectedError:  false,
@@ -78,18 +350,63 @@ func TestAuthHandler_Register(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  true,
 		},
+		{
+			name: "password past bcrypt's 72 bytes",
+			requestBody: AuthRequest{
+				Username: "testuser",
+				Password: strings.Repeat("p", 100),
+			},
+			mockRegister: func(username, email, password string) (*service.AuthTokens, *service.User, error) {
+				return testTokens(), &service.User{ID: "123", Username: username}, nil
+			},
+			expectedStatus: http.StatusOK,
+			expectedError:  false,
+		},
+		{
+			name: "password too long for the configured hash",
+			requestBody: AuthRequest{
+				Username: "testuser",
+				Password: strings.Repeat("p", 100),
+			},
+			mockRegister: func(username, email, password string) (*service.AuthTokens, *service.User, error) {
+				return nil, nil, service.ErrPasswordTooLong
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
+		{
+			name: "password too long",
+			requestBody: AuthRequest{
+				Username: "testuser",
+				Password: strings.Repeat("p", 1025),
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
 		{
 			name: "service error",
 			requestBody: AuthRequest{
 				Username: "testuser",
 				Password: "password123",
 			},
-			mockRegister: func(username, password string) (string, *service.User, error) {
-				return "", nil, service.ErrUserExists
+			mockRegister: func(username, email, password string) (*service.AuthTokens, *service.User, error) {
+				return nil, nil, errors.New("database unavailable")
 			},
 			expectedStatus: http.StatusInternalServerError,
 			expectedError:  true,
 		},
+		{
+			name: "username taken",
+			requestBody: AuthRequest{
+				Username: "testuser",
+				Password: "password123",
+			},
+			mockRegister: func(username, email, password string) (*service.AuthTokens, *service.User, error) {
+				return nil, nil, service.ErrUserExists
+			},
+			expectedStatus: http.StatusConflict,
+			expectedError:  true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -129,7 +446,7 @@ func TestAuthHandler_Login(t *testing.T) {
 	tests := []struct {
 		name           string
 		requestBody    AuthRequest
-		mockLogin      func(username, password string) (string, *service.User, error)
+		mockLogin      func(username, password string) (*service.AuthTokens, *service.User, error)
 		expectedStatus int
 		expectedError  bool
 	}{
@@ -139,8 +456,8 @@ func TestAuthHandler_Login(t *testing.T) {
 				Username: "testuser",
 				Password: "password123",
 			},
-			mockLogin: func(username, password string) (string, *service.User, error) {
-				return "jwt-token", &service.User{ID: "123", Username: username}, nil
+			mockLogin: func(username, password string) (*service.AuthTokens, *service.User, error) {
+				return testTokens(), &service.User{ID: "123", Username: username}, nil
 			},
 			expectedStatus: http.StatusOK,
 			expectedError:  false,
@@ -151,8 +468,8 @@ func TestAuthHandler_Login(t *testing.T) {
 				Username: "testuser",
 				Password: "wrongpassword",
 			},
-			mockLogin: func(username, password string) (string, *service.User, error) {
-				return "", nil, service.ErrInvalidCredentials
+			mockLogin: func(username, password string) (*service.AuthTokens, *service.User, error) {
+				return nil, nil, service.ErrInvalidCredentials
 			},
 			expectedStatus: http.StatusUnauthorized,
 			expectedError:  true,
@@ -181,6 +498,92 @@ func TestAuthHandler_Login(t *testing.T) {
 	}
 }
 
+func TestAuthHandler_Refresh(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    RefreshRequest
+		mockRefresh    func(refreshToken string) (*service.AuthTokens, error)
+		expectedStatus int
+	}{
+		{
+			name:        "valid refresh",
+			requestBody: RefreshRequest{RefreshToken: "session.secret"},
+			mockRefresh: func(refreshToken string) (*service.AuthTokens, error) {
+				return testTokens(), nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing refresh token",
+			requestBody:    RefreshRequest{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "invalid refresh token",
+			requestBody: RefreshRequest{RefreshToken: "bogus"},
+			mockRefresh: func(refreshToken string) (*service.AuthTokens, error) {
+				return nil, service.ErrInvalidRefreshToken
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:        "reused refresh token",
+			requestBody: RefreshRequest{RefreshToken: "session.old-secret"},
+			mockRefresh: func(refreshToken string) (*service.AuthTokens, error) {
+				return nil, service.ErrRefreshTokenReused
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockAuthService{
+				refreshFunc: tt.mockRefresh,
+			}
+
+			handler := NewAuthHandler(mockService)
+
+			body, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/api/auth/refresh", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			handler.Refresh(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	var loggedOut string
+	mockService := &MockAuthService{
+		logoutFunc: func(sessionID string) error {
+			loggedOut = sessionID
+			return nil
+		},
+	}
+
+	handler := NewAuthHandler(mockService)
+
+	req := httptest.NewRequest("POST", "/api/auth/logout", nil)
+	ctx := context.WithValue(req.Context(), "session_id", "session123")
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	handler.Logout(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if loggedOut != "session123" {
+		t.Errorf("expected session session123 to be revoked, got %q", loggedOut)
+	}
+}
+
 func TestAuthHandler_Profile(t *testing.T) {
 	tests := []struct {
 		name           string
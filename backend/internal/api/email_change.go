@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+// ConfirmEmailChange applies a pending email change from the link sent to
+// the new address
+func (h *AuthHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		WriteError(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	err := h.Service.ConfirmEmailChange(r.Context(), token)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidEmailChangeToken:
+			WriteError(w, http.StatusBadRequest, "Invalid or expired email change link")
+		case service.ErrEmailExists:
+			WriteError(w, http.StatusConflict, "Email already exists")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to change email: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "Email address changed",
+	})
+}
+
+// RevertEmailChange undoes an email change from the link sent to the old
+// address and signs the account out everywhere
+func (h *AuthHandler) RevertEmailChange(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		WriteError(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	err := h.Service.RevertEmailChange(r.Context(), token)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidEmailChangeToken:
+			WriteError(w, http.StatusBadRequest, "Invalid or expired email change link")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to revert email change: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "Email change reverted and all sessions signed out",
+	})
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+func TestAuthHandler_ConfirmEmailChange(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "valid link", expectedStatus: http.StatusOK},
+		{name: "invalid link", err: service.ErrInvalidEmailChangeToken, expectedStatus: http.StatusBadRequest},
+		{name: "address taken", err: service.ErrEmailExists, expectedStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotToken string
+			handler := NewAuthHandler(&MockAuthService{
+				confirmEmailChangeFunc: func(token string) error {
+					gotToken = token
+					return tt.err
+				},
+			})
+
+			r := chi.NewRouter()
+			r.Post("/api/auth/email-change/confirm/{token}", handler.ConfirmEmailChange)
+			req := httptest.NewRequest("POST", "/api/auth/email-change/confirm/abc123", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if gotToken != "abc123" {
+				t.Errorf("expected the token from the path, got %q", gotToken)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_RevertEmailChange(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "valid link", expectedStatus: http.StatusOK},
+		{name: "invalid link", err: service.ErrInvalidEmailChangeToken, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{
+				revertEmailChangeFunc: func(token string) error { return tt.err },
+			})
+
+			r := chi.NewRouter()
+			r.Post("/api/auth/email-change/revert/{token}", handler.RevertEmailChange)
+			req := httptest.NewRequest("POST", "/api/auth/email-change/revert/abc123", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_UpdateProfilePendingEmail(t *testing.T) {
+	email := "alice@example.com"
+
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "change pending", expectedStatus: http.StatusOK},
+		{name: "address taken", err: service.ErrEmailExists, expectedStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{
+				updateFunc: func(userID string, updates map[string]interface{}) (*service.User, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					pending := updates["email"].(string)
+					return &service.User{ID: userID, Username: "alice", Email: &email, PendingEmail: &pending}, nil
+				},
+			})
+
+			req := httptest.NewRequest("PUT", "/api/auth/profile", bytes.NewBufferString(`{"email":"new@example.com"}`))
+			req = withAuth(req, "1", nil, nil)
+			w := httptest.NewRecorder()
+			handler.UpdateProfile(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.err != nil {
+				return
+			}
+
+			var response struct {
+				Data struct {
+					Email        string `json:"email"`
+					PendingEmail string `json:"pending_email"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.Data.Email != email || response.Data.PendingEmail != "new@example.com" {
+				t.Errorf("expected the old email with the new one pending, got %+v", response.Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/pkg/mail"
+)
+
+// EmailPreviewer renders emails without sending them
+type EmailPreviewer interface {
+	EmailTemplates() (names, locales []string)
+	PreviewEmail(ctx context.Context, name, locale string) (*mail.Message, error)
+}
+
+// EmailPreviewHandler shows what the emails look like while working on
+// their templates. It is only routed in development.
+type EmailPreviewHandler struct {
+	Emails EmailPreviewer
+}
+
+func NewEmailPreviewHandler(emails EmailPreviewer) *EmailPreviewHandler {
+	return &EmailPreviewHandler{Emails: emails}
+}
+
+type EmailTemplatesResponse struct {
+	Templates []string `json:"templates"`
+	Locales   []string `json:"locales"`
+}
+
+// ListEmailTemplates lists the emails and the locales they can be
+// previewed in
+func (h *EmailPreviewHandler) ListEmailTemplates(w http.ResponseWriter, r *http.Request) {
+	names, locales := h.Emails.EmailTemplates()
+	WriteSuccess(w, EmailTemplatesResponse{Templates: names, Locales: locales})
+}
+
+// PreviewEmail renders an email with made-up values. The format query
+// parameter picks the HTML part (the default), the text part or the whole
+// message as eml; locale picks the translation, falling back to the
+// Accept-Language header.
+func (h *EmailPreviewHandler) PreviewEmail(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" && format != "text" && format != "eml" {
+		WriteError(w, http.StatusBadRequest, "format must be html, text or eml")
+		return
+	}
+
+	msg, err := h.Emails.PreviewEmail(r.Context(), chi.URLParam(r, "name"), r.URL.Query().Get("locale"))
+	if err != nil {
+		if errors.Is(err, mail.ErrUnknownTemplate) {
+			WriteError(w, http.StatusNotFound, "Email template not found")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to render email: "+err.Error())
+		return
+	}
+
+	var contentType, body string
+	switch format {
+	case "html":
+		if msg.HTML == "" {
+			WriteError(w, http.StatusNotFound, "Email has no HTML version")
+			return
+		}
+		contentType, body = "text/html; charset=utf-8", msg.HTML
+	case "text":
+		contentType, body = "text/plain; charset=utf-8", msg.Text
+	case "eml":
+		data, err := msg.Bytes()
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to render email: "+err.Error())
+			return
+		}
+		contentType, body = "message/rfc822", string(data)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if language := msg.Headers["Content-Language"]; language != "" {
+		w.Header().Set("Content-Language", language)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(body))
+}
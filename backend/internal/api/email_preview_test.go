@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/pkg/mail"
+)
+
+type fakeEmailPreviewer struct{}
+
+func (fakeEmailPreviewer) EmailTemplates() (names, locales []string) {
+	return []string{"welcome"}, []string{"en", "de"}
+}
+
+func (fakeEmailPreviewer) PreviewEmail(ctx context.Context, name, locale string) (*mail.Message, error) {
+	if name != "welcome" {
+		return nil, fmt.Errorf("%w: %s", mail.ErrUnknownTemplate, name)
+	}
+	if locale == "" {
+		locale = "en"
+	}
+	return &mail.Message{
+		From:    "noreply@example.com",
+		To:      []string{"jane.doe@example.com"},
+		Subject: "Welcome",
+		Text:    "Hello " + locale,
+		HTML:    "<p>Hello " + locale + "</p>",
+		Headers: map[string]string{"Content-Language": locale},
+	}, nil
+}
+
+func TestEmailPreviewHandler_PreviewEmail(t *testing.T) {
+	handler := NewEmailPreviewHandler(fakeEmailPreviewer{})
+	r := chi.NewRouter()
+	r.Get("/api/dev/emails", handler.ListEmailTemplates)
+	r.Get("/api/dev/emails/{name}", handler.PreviewEmail)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		contentType    string
+		body           string
+	}{
+		{name: "list", url: "/api/dev/emails", expectedStatus: http.StatusOK, contentType: "application/json", body: `"locales":["en","de"]`},
+		{name: "html", url: "/api/dev/emails/welcome", expectedStatus: http.StatusOK, contentType: "text/html; charset=utf-8", body: "<p>Hello en</p>"},
+		{name: "text in a locale", url: "/api/dev/emails/welcome?format=text&locale=de", expectedStatus: http.StatusOK, contentType: "text/plain; charset=utf-8", body: "Hello de"},
+		{name: "eml", url: "/api/dev/emails/welcome?format=eml", expectedStatus: http.StatusOK, contentType: "message/rfc822", body: "Subject: Welcome\r\n"},
+		{name: "unknown format", url: "/api/dev/emails/welcome?format=pdf", expectedStatus: http.StatusBadRequest},
+		{name: "unknown email", url: "/api/dev/emails/missing", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.contentType != "" && w.Header().Get("Content-Type") != tt.contentType {
+				t.Errorf("expected content type %q, got %q", tt.contentType, w.Header().Get("Content-Type"))
+			}
+			if !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("expected %q in the body, got %q", tt.body, w.Body.String())
+			}
+		})
+	}
+}
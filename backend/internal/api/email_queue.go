@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/service"
+	"github.com/user/votex-template/backend/internal/store"
+)
+
+// EmailOutbox lists and requeues queued email
+type EmailOutbox interface {
+	ListEmails(ctx context.Context, status string, limit, offset int) (*store.OutboxEmailList, error)
+	Requeue(ctx context.Context, id string) error
+}
+
+// EmailQueueHandler lets admins see what email is waiting to be sent and
+// retry email that could not be delivered
+type EmailQueueHandler struct {
+	Queue EmailOutbox
+}
+
+func NewEmailQueueHandler(queue EmailOutbox) *EmailQueueHandler {
+	return &EmailQueueHandler{Queue: queue}
+}
+
+// QueuedEmailResponse describes a queued email. The body is left out since
+// it holds the links sent to the recipient.
+type QueuedEmailResponse struct {
+	ID            string    `json:"id"`
+	Recipient     string    `json:"recipient"`
+	Subject       string    `json:"subject"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	LastError     *string   `json:"last_error,omitempty"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type QueuedEmailListResponse struct {
+	Emails []QueuedEmailResponse `json:"emails"`
+	Total  int                   `json:"total"`
+	Page   int                   `json:"page"`
+	Limit  int                   `json:"limit"`
+}
+
+// ListEmails handles GET /api/admin/emails - list queued email, optionally
+// filtered by status
+func (h *EmailQueueHandler) ListEmails(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	status := query.Get("status")
+	if status != "" && status != store.OutboxPending && status != store.OutboxDead {
+		WriteError(w, http.StatusBadRequest, "status must be pending or dead")
+		return
+	}
+
+	page := 1
+	limit := 10
+	if pageStr := query.Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	result, err := h.Queue.ListEmails(r.Context(), status, limit, (page-1)*limit)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list emails: "+err.Error())
+		return
+	}
+
+	emails := make([]QueuedEmailResponse, 0, len(result.Emails))
+	for _, email := range result.Emails {
+		emails = append(emails, QueuedEmailResponse{
+			ID:            email.ID,
+			Recipient:     email.Recipient,
+			Subject:       email.Subject,
+			Status:        email.Status,
+			Attempts:      email.Attempts,
+			LastError:     email.LastError,
+			NextAttemptAt: email.NextAttemptAt,
+			CreatedAt:     email.CreatedAt,
+			UpdatedAt:     email.UpdatedAt,
+		})
+	}
+
+	WriteSuccess(w, QueuedEmailListResponse{
+		Emails: emails,
+		Total:  result.Total,
+		Page:   page,
+		Limit:  limit,
+	})
+}
+
+// RequeueEmail handles POST /api/admin/emails/{id}/requeue - retry a dead
+// email
+func (h *EmailQueueHandler) RequeueEmail(w http.ResponseWriter, r *http.Request) {
+	err := h.Queue.Requeue(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		switch err {
+		case service.ErrQueuedEmailNotFound:
+			WriteError(w, http.StatusNotFound, "Dead email not found")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to requeue email: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "Email requeued successfully",
+	})
+}
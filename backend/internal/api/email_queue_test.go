@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/service"
+	"github.com/user/votex-template/backend/internal/store"
+)
+
+// fakeEmailOutbox holds one dead email
+type fakeEmailOutbox struct {
+	status, requeued string
+	limit, offset    int
+}
+
+func (f *fakeEmailOutbox) ListEmails(ctx context.Context, status string, limit, offset int) (*store.OutboxEmailList, error) {
+	f.status, f.limit, f.offset = status, limit, offset
+	lastError := "550 no such user"
+	return &store.OutboxEmailList{
+		Emails: []store.OutboxEmail{{
+			ID:        "email-1",
+			Recipient: "alice@example.com",
+			Subject:   "Welcome",
+			Message:   `{"Text":"secret link"}`,
+			Status:    store.OutboxDead,
+			Attempts:  8,
+			LastError: &lastError,
+		}},
+		Total: 1,
+	}, nil
+}
+
+func (f *fakeEmailOutbox) Requeue(ctx context.Context, id string) error {
+	if id != "email-1" {
+		return service.ErrQueuedEmailNotFound
+	}
+	f.requeued = id
+	return nil
+}
+
+func TestEmailQueueHandler(t *testing.T) {
+	outbox := &fakeEmailOutbox{}
+	handler := NewEmailQueueHandler(outbox)
+	r := chi.NewRouter()
+	r.Get("/api/admin/emails", handler.ListEmails)
+	r.Post("/api/admin/emails/{id}/requeue", handler.RequeueEmail)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		expectedStatus int
+		body           string
+	}{
+		{name: "list dead emails", method: http.MethodGet, url: "/api/admin/emails?status=dead&page=2&limit=5", expectedStatus: http.StatusOK, body: `"last_error":"550 no such user"`},
+		{name: "unknown status", method: http.MethodGet, url: "/api/admin/emails?status=sent", expectedStatus: http.StatusBadRequest},
+		{name: "requeue", method: http.MethodPost, url: "/api/admin/emails/email-1/requeue", expectedStatus: http.StatusOK},
+		{name: "requeue unknown email", method: http.MethodPost, url: "/api/admin/emails/missing/requeue", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("expected body to contain %q, got %s", tt.body, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), "secret link") {
+				t.Errorf("expected the message body to be left out, got %s", w.Body.String())
+			}
+		})
+	}
+
+	if outbox.status != store.OutboxDead || outbox.limit != 5 || outbox.offset != 5 {
+		t.Errorf("unexpected list arguments: %+v", outbox)
+	}
+	if outbox.requeued != "email-1" {
+		t.Errorf("expected email-1 to be requeued, got %q", outbox.requeued)
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// EmailVerificationPendingResponse is returned by Register instead of
+// AuthResponse when users must verify their email before signing in
+type EmailVerificationPendingResponse struct {
+	EmailVerificationRequired bool   `json:"email_verification_required"`
+	Email                     string `json:"email"`
+}
+
+// VerifyEmail confirms the address a verification link was sent to
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		WriteError(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	err := h.Service.VerifyEmail(r.Context(), token)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidVerificationToken:
+			WriteError(w, http.StatusBadRequest, "Invalid or expired verification link")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to verify email: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "Email address verified",
+	})
+}
+
+// ResendVerificationEmail sends a new verification link. The response does
+// not reveal whether the address belongs to an account.
+func (h *AuthHandler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	if err := h.Service.ResendVerificationEmail(r.Context(), req.Email); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to send verification email: "+err.Error())
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "If the email needs verifying, a new link has been sent",
+	})
+}
+
+// writeEmailNotVerified answers a sign-in blocked by an unverified address.
+// The code lets clients offer to resend the link.
+func writeEmailNotVerified(w http.ResponseWriter) {
+	WriteJSON(w, http.StatusForbidden, ErrorResponse{
+		Success: false,
+		Error:   "Verify your email address before signing in",
+		Code:    "email_not_verified",
+	})
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+func TestAuthHandler_VerifyEmail(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "valid link", expectedStatus: http.StatusOK},
+		{name: "invalid link", err: service.ErrInvalidVerificationToken, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotToken string
+			handler := NewAuthHandler(&MockAuthService{
+				verifyEmailFunc: func(token string) error {
+					gotToken = token
+					return tt.err
+				},
+			})
+
+			r := chi.NewRouter()
+			r.Post("/api/auth/verify-email/{token}", handler.VerifyEmail)
+			req := httptest.NewRequest("POST", "/api/auth/verify-email/abc123", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if gotToken != "abc123" {
+				t.Errorf("expected the token from the path, got %q", gotToken)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_ResendVerificationEmail(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "valid email", body: `{"email":"alice@example.com"}`, expectedStatus: http.StatusOK},
+		{name: "invalid email", body: `{"email":"alice"}`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{})
+			req := httptest.NewRequest("POST", "/api/auth/verify-email/resend", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			handler.ResendVerificationEmail(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_LoginEmailNotVerified(t *testing.T) {
+	handler := NewAuthHandler(&MockAuthService{
+		loginFunc: func(username, password string) (*service.AuthTokens, *service.User, error) {
+			return nil, nil, service.ErrEmailNotVerified
+		},
+	})
+
+	body := `{"username":"alice","password":"password123"}`
+	req := httptest.NewRequest("POST", "/api/auth/login", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	handler.Login(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+	var response ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Code != "email_not_verified" {
+		t.Errorf("expected code email_not_verified, got %q", response.Code)
+	}
+}
+
+func TestAuthHandler_RegisterPendingVerification(t *testing.T) {
+	handler := NewAuthHandler(&MockAuthService{
+		registerFunc: func(username, email, password string) (*service.AuthTokens, *service.User, error) {
+			return nil, &service.User{ID: "1", Username: username, Email: &email}, nil
+		},
+	})
+
+	body := `{"username":"alice","email":"alice@example.com","password":"password123"}`
+	req := httptest.NewRequest("POST", "/api/auth/register", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	handler.Register(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var response struct {
+		Data EmailVerificationPendingResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !response.Data.EmailVerificationRequired || response.Data.Email != "alice@example.com" {
+		t.Errorf("unexpected response: %+v", response.Data)
+	}
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/user/votex-template/backend/internal/keys"
+)
+
+// KeysHandler publishes the public half of the token signing keys so other
+// services can verify Votex access and ID tokens offline
+type KeysHandler struct {
+	Keys *keys.Keyring
+}
+
+func NewKeysHandler(k *keys.Keyring) *KeysHandler {
+	return &KeysHandler{Keys: k}
+}
+
+// JWKS serves /.well-known/jwks.json. A rotated in key is published for
+// keys.PublishDelay before it signs, so the response must not be cached for
+// longer than that.
+func (h *KeysHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	WriteJSON(w, http.StatusOK, h.Keys.JWKS())
+}
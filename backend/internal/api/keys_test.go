@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/user/votex-template/backend/internal/keys"
+	"github.com/user/votex-template/backend/pkg/jwk"
+)
+
+func TestKeysHandler_JWKS(t *testing.T) {
+	current, err := keys.GenerateKey(keys.EdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, err := keys.GenerateKey(keys.ES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewKeysHandler(keys.NewStatic(current, previous))
+
+	w := httptest.NewRecorder()
+	handler.JWKS(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+
+	if cache := w.Header().Get("Cache-Control"); cache != "public, max-age=300" {
+		t.Errorf("expected a five minute cache, got %q", cache)
+	}
+
+	var set jwk.Set
+	if err := json.NewDecoder(w.Body).Decode(&set); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(set.Keys) != 2 {
+		t.Fatalf("expected both keys to be published, got %d", len(set.Keys))
+	}
+	if set.Keys[0].KeyID != current.ID || set.Keys[0].Algorithm != "EdDSA" {
+		t.Errorf("expected the signing key first, got %s %s", set.Keys[0].KeyID, set.Keys[0].Algorithm)
+	}
+	if set.Keys[1].KeyID != previous.ID || set.Keys[1].Algorithm != "ES256" {
+		t.Errorf("expected the verification key second, got %s %s", set.Keys[1].KeyID, set.Keys[1].Algorithm)
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/middleware"
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+// UnlockAccount lifts a login lockout from the link emailed to the account
+// owner
+func (h *AuthHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		WriteError(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	err := h.Service.UnlockAccount(r.Context(), token)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidUnlockToken:
+			WriteError(w, http.StatusBadRequest, "Invalid or expired unlock link")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to unlock account: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "Account unlocked",
+	})
+}
+
+// UnlockUser handles POST /api/users/{id}/unlock - lift a login lockout
+func (h *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	if userID == "" {
+		WriteError(w, http.StatusBadRequest, "User ID is required")
+		return
+	}
+
+	actorID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	err := h.Service.UnlockUser(r.Context(), userID, actorID)
+	if err != nil {
+		switch err {
+		case service.ErrUserNotFound:
+			WriteError(w, http.StatusNotFound, "User not found")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to unlock user: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "User unlocked successfully",
+	})
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/user/votex-template/backend/internal/metrics"
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+func TestAuthHandler_LoginLocked(t *testing.T) {
+	handler := NewAuthHandler(&MockAuthService{
+		loginFunc: func(username, password string) (*service.AuthTokens, *service.User, error) {
+			return nil, nil, &service.LoginLockedError{Until: time.Now().Add(90 * time.Second)}
+		},
+	})
+
+	locked := metrics.Logins.WithLabelValues("password", "locked")
+	before := testutil.ToFloat64(locked)
+
+	body, _ := json.Marshal(AuthRequest{Username: "alice", Password: "password123"})
+	req := httptest.NewRequest("POST", "/api/auth/login", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	handler.Login(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if got := testutil.ToFloat64(locked) - before; got != 1 {
+		t.Errorf("expected the locked login to be counted once, got %v", got)
+	}
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 89 || retryAfter > 90 {
+		t.Errorf("expected Retry-After of about 90 seconds, got %q", w.Header().Get("Retry-After"))
+	}
+
+	var response ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Code != "login_locked" {
+		t.Errorf("expected code login_locked, got %q", response.Code)
+	}
+}
+
+func TestAuthHandler_UnlockAccount(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "valid link", expectedStatus: http.StatusOK},
+		{name: "invalid link", err: service.ErrInvalidUnlockToken, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotToken string
+			handler := NewAuthHandler(&MockAuthService{
+				unlockAccountFunc: func(token string) error {
+					gotToken = token
+					return tt.err
+				},
+			})
+
+			r := chi.NewRouter()
+			r.Post("/api/auth/unlock/{token}", handler.UnlockAccount)
+			req := httptest.NewRequest("POST", "/api/auth/unlock/abc123", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if gotToken != "abc123" {
+				t.Errorf("expected the token from the path, got %q", gotToken)
+			}
+		})
+	}
+}
+
+func TestUserHandler_UnlockUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "unlocks the user", expectedStatus: http.StatusOK},
+		{name: "unknown user", err: service.ErrUserNotFound, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUser, gotActor string
+			handler := NewUserHandler(&MockAuthService{
+				unlockUserFunc: func(userID, actorID string) error {
+					gotUser, gotActor = userID, actorID
+					return tt.err
+				},
+			})
+
+			req := httptest.NewRequest("POST", "/api/users/2/unlock", nil)
+			req = withAuth(req, "1", []string{"users:write"}, map[string]string{"id": "2"})
+			w := httptest.NewRecorder()
+			handler.UnlockUser(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if gotUser != "2" || gotActor != "1" {
+				t.Errorf("expected user 2 unlocked by 1, got %q by %q", gotUser, gotActor)
+			}
+		})
+	}
+}
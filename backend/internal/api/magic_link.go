@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// MagicLinkSentResponse confirms a sign-in link was requested. Binding is
+// only set when links are bound to the requesting browser; the client keeps
+// it and sends it back in MagicLinkLoginRequest.
+type MagicLinkSentResponse struct {
+	Message string `json:"message"`
+	Binding string `json:"binding,omitempty"`
+}
+
+type MagicLinkLoginRequest struct {
+	Binding string `json:"binding"`
+}
+
+// RequestMagicLink emails a sign-in link. The response does not reveal
+// whether the address belongs to an account.
+func (h *AuthHandler) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req MagicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	binding, err := h.Service.RequestMagicLink(r.Context(), req.Email)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to send sign-in link: "+err.Error())
+		return
+	}
+
+	WriteSuccess(w, MagicLinkSentResponse{
+		Message: "If the email belongs to an account, a sign-in link has been sent",
+		Binding: binding,
+	})
+}
+
+// LoginWithMagicLink signs in with the token from an emailed link. The body
+// is optional and only needed for links bound to a browser.
+func (h *AuthHandler) LoginWithMagicLink(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		WriteError(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	var req MagicLinkLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tokens, user, err := h.Service.LoginWithMagicLink(r.Context(), token, req.Binding)
+	recordLogin("magic_link", err)
+	if err != nil {
+		if writeMFAChallenge(w, err) {
+			return
+		}
+
+		switch err {
+		case service.ErrInvalidMagicLink:
+			WriteError(w, http.StatusBadRequest, "Invalid or expired sign-in link")
+		case service.ErrMagicLinkWrongBrowser:
+			WriteJSON(w, http.StatusForbidden, ErrorResponse{
+				Success: false,
+				Error:   "Open the sign-in link in the browser you requested it from",
+				Code:    "magic_link_wrong_browser",
+			})
+		case service.ErrEmailNotVerified:
+			writeEmailNotVerified(w)
+		default:
+			WriteError(w, http.StatusInternalServerError, "Sign-in failed: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, newAuthResponse(tokens, user))
+}
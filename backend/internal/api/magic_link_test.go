@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+func TestAuthHandler_RequestMagicLink(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "valid email", body: `{"email":"alice@example.com"}`, expectedStatus: http.StatusOK},
+		{name: "invalid email", body: `{"email":"alice"}`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{
+				requestMagicLinkFunc: func(email string) (string, error) {
+					return "binding-secret", nil
+				},
+			})
+
+			req := httptest.NewRequest("POST", "/api/auth/magic-link", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			handler.RequestMagicLink(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data MagicLinkSentResponse `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.Data.Binding != "binding-secret" {
+				t.Errorf("expected the binding in the response, got %q", response.Data.Binding)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_LoginWithMagicLink(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "valid link", expectedStatus: http.StatusOK},
+		{name: "bound link", body: `{"binding":"binding-secret"}`, expectedStatus: http.StatusOK},
+		{name: "invalid link", err: service.ErrInvalidMagicLink, expectedStatus: http.StatusBadRequest},
+		{name: "wrong browser", err: service.ErrMagicLinkWrongBrowser, expectedStatus: http.StatusForbidden, expectedCode: "magic_link_wrong_browser"},
+		{name: "malformed body", body: `{`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotToken, gotBinding string
+			handler := NewAuthHandler(&MockAuthService{
+				magicLinkLoginFunc: func(token, binding string) (*service.AuthTokens, *service.User, error) {
+					gotToken, gotBinding = token, binding
+					if tt.err != nil {
+						return nil, nil, tt.err
+					}
+					return &service.AuthTokens{AccessToken: "access", RefreshToken: "refresh"}, &service.User{ID: "1", Username: "alice"}, nil
+				},
+			})
+
+			r := chi.NewRouter()
+			r.Post("/api/auth/magic-link/{token}", handler.LoginWithMagicLink)
+			req := httptest.NewRequest("POST", "/api/auth/magic-link/abc123", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedCode != "" {
+				var response ErrorResponse
+				if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if response.Code != tt.expectedCode {
+					t.Errorf("expected code %q, got %q", tt.expectedCode, response.Code)
+				}
+			}
+			if tt.expectedStatus == http.StatusOK {
+				if gotToken != "abc123" {
+					t.Errorf("expected the token from the path, got %q", gotToken)
+				}
+				if strings.Contains(tt.body, "binding") && gotBinding != "binding-secret" {
+					t.Errorf("expected the binding from the body, got %q", gotBinding)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/user/votex-template/backend/internal/middleware"
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,max=32"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type MFAEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// VerifyMFA completes a two-factor login with the token returned by Login
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	tokens, user, err := h.Service.VerifyMFA(r.Context(), req.MFAToken, req.Code, middleware.RemoteIP(r))
+	recordLogin("mfa", err)
+	if err != nil {
+		if writeLoginLocked(w, err) {
+			return
+		}
+		switch err {
+		case service.ErrInvalidMFAToken:
+			WriteError(w, http.StatusUnauthorized, "Invalid or expired two-factor token")
+		case service.ErrInvalidMFACode:
+			WriteError(w, http.StatusUnauthorized, "Invalid two-factor code")
+		case service.ErrMFANotEnabled:
+			WriteError(w, http.StatusUnauthorized, "Two-factor authentication is not enabled")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Two-factor verification failed: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, newAuthResponse(tokens, user))
+}
+
+// EnrollMFA starts two-factor enrolment for the current user
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	enrollment, err := h.Service.EnrollMFA(r.Context(), userID)
+	if err != nil {
+		switch err {
+		case service.ErrUserNotFound:
+			WriteError(w, http.StatusNotFound, "User not found")
+		case service.ErrMFAAlreadyEnabled:
+			WriteError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to start two-factor enrolment: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, MFAEnrollResponse{
+		Secret:     enrollment.Secret,
+		OTPAuthURI: enrollment.URI,
+	})
+}
+
+// ConfirmMFA enables two-factor authentication and returns recovery codes
+func (h *AuthHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.Service.ConfirmMFA(r.Context(), userID, req.Code)
+	if err != nil {
+		writeMFAError(w, err, "Failed to enable two-factor authentication")
+		return
+	}
+
+	WriteSuccess(w, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableMFA turns two-factor authentication off for the current user
+func (h *AuthHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.DisableMFA(r.Context(), userID, req.Code, middleware.RemoteIP(r)); err != nil {
+		writeMFAError(w, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.Service.RegenerateRecoveryCodes(r.Context(), userID, req.Code, middleware.RemoteIP(r))
+	if err != nil {
+		writeMFAError(w, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	WriteSuccess(w, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// decodeMFACode reads the authenticated user and the code from the request,
+// writing an error response and returning false when either is missing
+func (h *AuthHandler) decodeMFACode(w http.ResponseWriter, r *http.Request) (string, MFACodeRequest, bool) {
+	var req MFACodeRequest
+
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return "", req, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return "", req, false
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return "", req, false
+	}
+
+	return userID, req, true
+}
+
+func writeMFAError(w http.ResponseWriter, err error, message string) {
+	if writeLoginLocked(w, err) {
+		return
+	}
+	switch err {
+	case service.ErrInvalidMFACode:
+		WriteError(w, http.StatusBadRequest, "Invalid two-factor code")
+	case service.ErrMFANotEnabled:
+		WriteError(w, http.StatusBadRequest, "Two-factor authentication is not enabled")
+	case service.ErrMFAAlreadyEnabled:
+		WriteError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+	case service.ErrUserNotFound:
+		WriteError(w, http.StatusNotFound, "User not found")
+	default:
+		WriteError(w, http.StatusInternalServerError, message+": "+err.Error())
+	}
+}
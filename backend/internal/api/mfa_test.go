@@ -0,0 +1,142 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+func TestAuthHandler_LoginMFAChallenge(t *testing.T) {
+	mockService := &MockAuthService{
+		loginFunc: func(username, password string) (*service.AuthTokens, *service.User, error) {
+			return nil, nil, &service.MFARequiredError{Token: "mfa-token", ExpiresAt: time.Now().Add(5 * time.Minute)}
+		},
+	}
+	handler := NewAuthHandler(mockService)
+
+	body, _ := json.Marshal(AuthRequest{Username: "testuser", Password: "password123"})
+	req := httptest.NewRequest("POST", "/api/auth/login", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	handler.Login(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var response struct {
+		Data MFAChallengeResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !response.Data.MFARequired || response.Data.MFAToken != "mfa-token" {
+		t.Errorf("expected mfa challenge, got %+v", response.Data)
+	}
+}
+
+func TestAuthHandler_VerifyMFA(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    MFAVerifyRequest
+		mockVerify     func(mfaToken, code string) (*service.AuthTokens, *service.User, error)
+		expectedStatus int
+	}{
+		{
+			name:        "valid code",
+			requestBody: MFAVerifyRequest{MFAToken: "mfa-token", Code: "123456"},
+			mockVerify: func(mfaToken, code string) (*service.AuthTokens, *service.User, error) {
+				return testTokens(), &service.User{ID: "1", Username: "testuser"}, nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing code",
+			requestBody:    MFAVerifyRequest{MFAToken: "mfa-token"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "invalid code",
+			requestBody: MFAVerifyRequest{MFAToken: "mfa-token", Code: "000000"},
+			mockVerify: func(mfaToken, code string) (*service.AuthTokens, *service.User, error) {
+				return nil, nil, service.ErrInvalidMFACode
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:        "expired token",
+			requestBody: MFAVerifyRequest{MFAToken: "stale", Code: "123456"},
+			mockVerify: func(mfaToken, code string) (*service.AuthTokens, *service.User, error) {
+				return nil, nil, service.ErrInvalidMFAToken
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{verifyMFAFunc: tt.mockVerify})
+
+			body, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/api/auth/login/mfa", bytes.NewBuffer(body))
+			w := httptest.NewRecorder()
+			handler.VerifyMFA(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_ConfirmMFA(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		mockConfirm    func(userID, code string) ([]string, error)
+		expectedStatus int
+	}{
+		{
+			name:   "returns recovery codes",
+			userID: "1",
+			mockConfirm: func(userID, code string) ([]string, error) {
+				return []string{"abcde-fghij"}, nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "wrong code",
+			userID: "1",
+			mockConfirm: func(userID, code string) ([]string, error) {
+				return nil, service.ErrInvalidMFACode
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unauthenticated",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{confirmMFAFunc: tt.mockConfirm})
+
+			body, _ := json.Marshal(MFACodeRequest{Code: "123456"})
+			req := httptest.NewRequest("POST", "/api/auth/mfa/confirm", bytes.NewBuffer(body))
+			if tt.userID != "" {
+				req = withAuth(req, tt.userID, nil, nil)
+			}
+			w := httptest.NewRecorder()
+			handler.ConfirmMFA(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
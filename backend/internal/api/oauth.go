@@ -0,0 +1,370 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/user/votex-template/backend/internal/middleware"
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+// OAuthHandler serves the identity provider used by sibling services. The
+// discovery, token and userinfo endpoints speak plain OAuth 2.0 JSON;
+// the consent and client management endpoints use the usual API envelope.
+type OAuthHandler struct {
+	Service   service.OAuthServiceInterface
+	Validator *validator.Validate
+}
+
+func NewOAuthHandler(s service.OAuthServiceInterface) *OAuthHandler {
+	return &OAuthHandler{
+		Service:   s,
+		Validator: validator.New(),
+	}
+}
+
+// AuthorizeRequest carries the authorization request parameters the client
+// sent to the consent page, plus the user's decision when approving
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type" validate:"max=32"`
+	ClientID            string `json:"client_id" validate:"required,max=64"`
+	RedirectURI         string `json:"redirect_uri" validate:"required,max=2048"`
+	Scope               string `json:"scope" validate:"max=512"`
+	State               string `json:"state" validate:"max=512"`
+	Nonce               string `json:"nonce" validate:"max=512"`
+	CodeChallenge       string `json:"code_challenge" validate:"max=128"`
+	CodeChallengeMethod string `json:"code_challenge_method" validate:"max=16"`
+	Prompt              string `json:"prompt" validate:"max=64"`
+	Approved            bool   `json:"approved"`
+}
+
+// AuthorizeResponse tells the consent page where to send the browser next
+type AuthorizeResponse struct {
+	RedirectURL string `json:"redirect_url"`
+}
+
+// AuthorizeErrorResponse is returned when an authorization request is
+// rejected in a way the client must be told about by redirecting to it
+type AuthorizeErrorResponse struct {
+	Success     bool   `json:"success"`
+	Error       string `json:"error"`
+	Code        string `json:"code"`
+	RedirectURL string `json:"redirect_url"`
+}
+
+type RegisterClientRequest struct {
+	Name         string   `json:"name" validate:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required,min=1,max=10,dive,required,max=2048"`
+	Public       bool     `json:"public"`
+}
+
+// OAuthErrorResponse is an OAuth 2.0 error body (RFC 6749 section 5.2)
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Discovery serves /.well-known/openid-configuration
+func (h *OAuthHandler) Discovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	WriteJSON(w, http.StatusOK, h.Service.Discovery())
+}
+
+// Token exchanges an authorization code for tokens. Confidential clients
+// authenticate with HTTP Basic or with client_secret in the form.
+func (h *OAuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "malformed form body"}, false)
+		return
+	}
+
+	req := &service.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+	}
+
+	// RFC 6749 section 2.3.1 form-encodes the credentials before Basic encoding
+	username, password, basic := r.BasicAuth()
+	if basic {
+		if req.ClientSecret != "" {
+			writeOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "use only one client authentication method"}, true)
+			return
+		}
+		clientID, errID := url.QueryUnescape(username)
+		secret, errSecret := url.QueryUnescape(password)
+		if errID != nil || errSecret != nil || (req.ClientID != "" && req.ClientID != clientID) {
+			writeOAuthError(w, &service.OAuthError{Code: "invalid_client", Description: "client authentication failed"}, true)
+			return
+		}
+		req.ClientID, req.ClientSecret = clientID, secret
+	}
+
+	tokens, err := h.Service.Token(r.Context(), req)
+	if err != nil {
+		writeOAuthError(w, err, basic)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, tokens)
+}
+
+// UserInfo returns the claims about the user the bearer access token grants
+func (h *OAuthHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		WriteJSON(w, http.StatusUnauthorized, OAuthErrorResponse{Error: "invalid_token", ErrorDescription: "missing bearer token"})
+		return
+	}
+
+	claims, err := h.Service.UserInfo(r.Context(), accessToken)
+	if err != nil {
+		if err == service.ErrInvalidAccessToken {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			WriteJSON(w, http.StatusUnauthorized, OAuthErrorResponse{Error: "invalid_token", ErrorDescription: err.Error()})
+			return
+		}
+		WriteJSON(w, http.StatusInternalServerError, OAuthErrorResponse{Error: "server_error"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	WriteJSON(w, http.StatusOK, claims)
+}
+
+// GetAuthorization validates an authorization request for the consent page
+// and tells it whether the user still has to approve the client
+func (h *OAuthHandler) GetAuthorization(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	query := r.URL.Query()
+	req := AuthorizeRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		Nonce:               query.Get("nonce"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+		Prompt:              query.Get("prompt"),
+	}
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	prompt, err := h.Service.Authorize(r.Context(), userID, req.authorizationRequest())
+	if err != nil {
+		writeAuthorizeError(w, err)
+		return
+	}
+
+	WriteSuccess(w, prompt)
+}
+
+// Authorize records whether the user approved the client and returns the
+// URL that hands the code, or the refusal, back to the client
+func (h *OAuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req AuthorizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	redirectURL, err := h.Service.Approve(r.Context(), userID, req.authorizationRequest(), req.Approved)
+	if err != nil {
+		writeAuthorizeError(w, err)
+		return
+	}
+
+	WriteSuccess(w, AuthorizeResponse{RedirectURL: redirectURL})
+}
+
+// ListConsents returns the clients the current user has approved
+func (h *OAuthHandler) ListConsents(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	consents, err := h.Service.ListConsents(r.Context(), userID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list connected apps: "+err.Error())
+		return
+	}
+
+	WriteSuccess(w, consents)
+}
+
+// RevokeConsent withdraws the current user's consent for a client
+func (h *OAuthHandler) RevokeConsent(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.Service.RevokeConsent(r.Context(), userID, chi.URLParam(r, "client_id")); err != nil {
+		switch err {
+		case service.ErrConsentNotFound:
+			WriteError(w, http.StatusNotFound, "Connected app not found")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to disconnect app: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "App disconnected",
+	})
+}
+
+// ListClients returns the registered clients (admin only)
+func (h *OAuthHandler) ListClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.Service.ListClients(r.Context())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list clients: "+err.Error())
+		return
+	}
+
+	WriteSuccess(w, clients)
+}
+
+// RegisterClient registers a client (admin only). The secret of a
+// confidential client is only included in this response.
+func (h *OAuthHandler) RegisterClient(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req RegisterClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	client, err := h.Service.RegisterClient(r.Context(), userID, req.Name, req.RedirectURIs, req.Public)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidRedirectURI:
+			WriteError(w, http.StatusBadRequest, "Redirect URIs must be absolute https URLs without a fragment, or http on a loopback address")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to register client: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, client)
+}
+
+// DeleteClient removes a client and the consents granted to it (admin only)
+func (h *OAuthHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	if err := h.Service.DeleteClient(r.Context(), chi.URLParam(r, "id")); err != nil {
+		switch err {
+		case service.ErrClientNotFound:
+			WriteError(w, http.StatusNotFound, "Client not found")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to delete client: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "Client deleted",
+	})
+}
+
+func (req AuthorizeRequest) authorizationRequest() *service.AuthorizationRequest {
+	return &service.AuthorizationRequest{
+		ResponseType:        req.ResponseType,
+		ClientID:            req.ClientID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		State:               req.State,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Prompt:              req.Prompt,
+	}
+}
+
+// writeAuthorizeError reports a rejected authorization request to the
+// consent page, with the URL to redirect to when the client must be told
+func writeAuthorizeError(w http.ResponseWriter, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		switch err {
+		case service.ErrUserNotFound:
+			WriteError(w, http.StatusNotFound, "User not found")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Authorization failed: "+err.Error())
+		}
+		return
+	}
+
+	if oauthErr.RedirectURL != "" {
+		WriteJSON(w, http.StatusBadRequest, AuthorizeErrorResponse{
+			Success:     false,
+			Error:       oauthErr.Description,
+			Code:        oauthErr.Code,
+			RedirectURL: oauthErr.RedirectURL,
+		})
+		return
+	}
+	WriteJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Error: oauthErr.Description, Code: oauthErr.Code})
+}
+
+// writeOAuthError writes a token endpoint error. Failed client
+// authentication is a 401, with a challenge when Basic auth was used.
+func writeOAuthError(w http.ResponseWriter, err error, basic bool) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		WriteJSON(w, http.StatusInternalServerError, OAuthErrorResponse{Error: "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == "invalid_client" {
+		status = http.StatusUnauthorized
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="votex"`)
+		}
+	}
+	WriteJSON(w, status, OAuthErrorResponse{Error: oauthErr.Code, ErrorDescription: oauthErr.Description})
+}
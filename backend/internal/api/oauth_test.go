@@ -0,0 +1,378 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/user/votex-template/backend/internal/service"
+	"github.com/user/votex-template/backend/pkg/oidc"
+)
+
+// MockOAuthService is a mock implementation for testing
+type MockOAuthService struct {
+	registerClientFunc func(createdBy, name string, redirectURIs []string, public bool) (*service.OAuthClient, error)
+	authorizeFunc      func(userID string, req *service.AuthorizationRequest) (*service.AuthorizationPrompt, error)
+	approveFunc        func(userID string, req *service.AuthorizationRequest, approved bool) (string, error)
+	tokenFunc          func(req *service.TokenRequest) (*service.OAuthTokens, error)
+	userInfoFunc       func(accessToken string) (map[string]interface{}, error)
+	revokeConsentFunc  func(userID, clientID string) error
+}
+
+func (m *MockOAuthService) Discovery() *oidc.Metadata {
+	return &oidc.Metadata{Issuer: "https://votex.example.com"}
+}
+
+func (m *MockOAuthService) RegisterClient(ctx context.Context, createdBy, name string, redirectURIs []string, public bool) (*service.OAuthClient, error) {
+	if m.registerClientFunc != nil {
+		return m.registerClientFunc(createdBy, name, redirectURIs, public)
+	}
+	return &service.OAuthClient{ID: "client-1", Name: name, RedirectURIs: redirectURIs, Public: public}, nil
+}
+
+func (m *MockOAuthService) ListClients(ctx context.Context) ([]service.OAuthClient, error) {
+	return []service.OAuthClient{}, nil
+}
+
+func (m *MockOAuthService) DeleteClient(ctx context.Context, id string) error {
+	return nil
+}
+
+func (m *MockOAuthService) Authorize(ctx context.Context, userID string, req *service.AuthorizationRequest) (*service.AuthorizationPrompt, error) {
+	if m.authorizeFunc != nil {
+		return m.authorizeFunc(userID, req)
+	}
+	return &service.AuthorizationPrompt{ClientID: req.ClientID}, nil
+}
+
+func (m *MockOAuthService) Approve(ctx context.Context, userID string, req *service.AuthorizationRequest, approved bool) (string, error) {
+	if m.approveFunc != nil {
+		return m.approveFunc(userID, req, approved)
+	}
+	return req.RedirectURI, nil
+}
+
+func (m *MockOAuthService) Token(ctx context.Context, req *service.TokenRequest) (*service.OAuthTokens, error) {
+	if m.tokenFunc != nil {
+		return m.tokenFunc(req)
+	}
+	return &service.OAuthTokens{}, nil
+}
+
+func (m *MockOAuthService) UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	if m.userInfoFunc != nil {
+		return m.userInfoFunc(accessToken)
+	}
+	return map[string]interface{}{}, nil
+}
+
+func (m *MockOAuthService) ListConsents(ctx context.Context, userID string) ([]service.Consent, error) {
+	return []service.Consent{}, nil
+}
+
+func (m *MockOAuthService) RevokeConsent(ctx context.Context, userID, clientID string) error {
+	if m.revokeConsentFunc != nil {
+		return m.revokeConsentFunc(userID, clientID)
+	}
+	return nil
+}
+
+func TestOAuthHandler_Discovery(t *testing.T) {
+	handler := NewOAuthHandler(&MockOAuthService{})
+
+	w := httptest.NewRecorder()
+	handler.Discovery(w, httptest.NewRequest("GET", "/.well-known/openid-configuration", nil))
+
+	var metadata oidc.Metadata
+	if err := json.NewDecoder(w.Body).Decode(&metadata); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if metadata.Issuer != "https://votex.example.com" {
+		t.Errorf("expected the bare discovery document, got %+v", metadata)
+	}
+}
+
+func TestOAuthHandler_Token(t *testing.T) {
+	tests := []struct {
+		name           string
+		form           url.Values
+		basicUser      string
+		basicPassword  string
+		err            error
+		expectedStatus int
+		expectedError  string
+		expectClientID string
+		expectSecret   string
+	}{
+		{
+			name:           "client_secret_post",
+			form:           url.Values{"grant_type": {"authorization_code"}, "code": {"abc"}, "client_id": {"client-1"}, "client_secret": {"s3cret"}},
+			expectedStatus: http.StatusOK,
+			expectClientID: "client-1",
+			expectSecret:   "s3cret",
+		},
+		{
+			name:           "client_secret_basic is form decoded",
+			form:           url.Values{"grant_type": {"authorization_code"}, "code": {"abc"}},
+			basicUser:      "client-1",
+			basicPassword:  "s3cret%2B%2F",
+			expectedStatus: http.StatusOK,
+			expectClientID: "client-1",
+			expectSecret:   "s3cret+/",
+		},
+		{
+			name:           "two authentication methods",
+			form:           url.Values{"grant_type": {"authorization_code"}, "client_secret": {"s3cret"}},
+			basicUser:      "client-1",
+			basicPassword:  "s3cret",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name:           "bad client credentials",
+			form:           url.Values{"grant_type": {"authorization_code"}},
+			basicUser:      "client-1",
+			basicPassword:  "wrong",
+			err:            &service.OAuthError{Code: "invalid_client", Description: "client authentication failed"},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid_client",
+			expectClientID: "client-1",
+			expectSecret:   "wrong",
+		},
+		{
+			name:           "reused code",
+			form:           url.Values{"grant_type": {"authorization_code"}, "client_id": {"cli"}},
+			err:            &service.OAuthError{Code: "invalid_grant", Description: "invalid or expired authorization code"},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_grant",
+			expectClientID: "cli",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewOAuthHandler(&MockOAuthService{
+				tokenFunc: func(req *service.TokenRequest) (*service.OAuthTokens, error) {
+					if req.ClientID != tt.expectClientID || req.ClientSecret != tt.expectSecret {
+						t.Errorf("unexpected client credentials %q %q", req.ClientID, req.ClientSecret)
+					}
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &service.OAuthTokens{AccessToken: "at", TokenType: "Bearer", IDToken: "id"}, nil
+				},
+			})
+
+			req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.basicUser != "" {
+				req.SetBasicAuth(tt.basicUser, tt.basicPassword)
+			}
+			w := httptest.NewRecorder()
+			handler.Token(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Header().Get("Cache-Control") != "no-store" {
+				t.Error("expected token responses not to be cached")
+			}
+
+			var body map[string]interface{}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if tt.expectedError != "" {
+				if body["error"] != tt.expectedError {
+					t.Errorf("expected error %q, got %v", tt.expectedError, body)
+				}
+				if tt.expectedStatus == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+					t.Error("expected a Basic challenge")
+				}
+				return
+			}
+			if body["access_token"] != "at" || body["id_token"] != "id" {
+				t.Errorf("unexpected token response: %v", body)
+			}
+		})
+	}
+}
+
+func TestOAuthHandler_UserInfo(t *testing.T) {
+	handler := NewOAuthHandler(&MockOAuthService{
+		userInfoFunc: func(accessToken string) (map[string]interface{}, error) {
+			if accessToken != "good" {
+				return nil, service.ErrInvalidAccessToken
+			}
+			return map[string]interface{}{"sub": "user-1"}, nil
+		},
+	})
+
+	for token, expectedStatus := range map[string]int{"": http.StatusUnauthorized, "bad": http.StatusUnauthorized, "good": http.StatusOK} {
+		req := httptest.NewRequest("GET", "/oauth/userinfo", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.UserInfo(w, req)
+
+		if w.Code != expectedStatus {
+			t.Errorf("token %q: expected status %d, got %d", token, expectedStatus, w.Code)
+		}
+		if expectedStatus == http.StatusUnauthorized && !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Bearer") {
+			t.Errorf("token %q: expected a Bearer challenge", token)
+		}
+	}
+}
+
+func TestOAuthHandler_GetAuthorization(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectRedirect bool
+	}{
+		{name: "prompt", expectedStatus: http.StatusOK},
+		{name: "unknown client", err: &service.OAuthError{Code: "invalid_request", Description: "unknown client_id"}, expectedStatus: http.StatusBadRequest},
+		{
+			name:           "missing PKCE",
+			err:            &service.OAuthError{Code: "invalid_request", Description: "PKCE required", RedirectURL: "https://wiki.example.com/callback?error=invalid_request"},
+			expectedStatus: http.StatusBadRequest,
+			expectRedirect: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewOAuthHandler(&MockOAuthService{
+				authorizeFunc: func(userID string, req *service.AuthorizationRequest) (*service.AuthorizationPrompt, error) {
+					if userID != "1" || req.ClientID != "client-1" || req.CodeChallenge != "abc" {
+						t.Errorf("unexpected request %q %+v", userID, req)
+					}
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &service.AuthorizationPrompt{ClientID: "client-1", ClientName: "Wiki", ConsentRequired: true}, nil
+				},
+			})
+
+			target := "/api/oauth/authorize?response_type=code&client_id=client-1&redirect_uri=https%3A%2F%2Fwiki.example.com%2Fcallback&code_challenge=abc"
+			req := withAuth(httptest.NewRequest("GET", target, nil), "1", nil, nil)
+			w := httptest.NewRecorder()
+			handler.GetAuthorization(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var body struct {
+				Code        string `json:"code"`
+				RedirectURL string `json:"redirect_url"`
+			}
+			json.NewDecoder(w.Body).Decode(&body)
+			if tt.err != nil && body.Code != "invalid_request" {
+				t.Errorf("expected the OAuth error code, got %+v", body)
+			}
+			if (body.RedirectURL != "") != tt.expectRedirect {
+				t.Errorf("unexpected redirect %q", body.RedirectURL)
+			}
+		})
+	}
+}
+
+func TestOAuthHandler_Authorize(t *testing.T) {
+	var gotApproved bool
+	handler := NewOAuthHandler(&MockOAuthService{
+		approveFunc: func(userID string, req *service.AuthorizationRequest, approved bool) (string, error) {
+			gotApproved = approved
+			return req.RedirectURI + "?code=xyz", nil
+		},
+	})
+
+	body := `{"client_id":"client-1","redirect_uri":"https://wiki.example.com/callback","approved":true}`
+	req := withAuth(httptest.NewRequest("POST", "/api/oauth/authorize", bytes.NewBufferString(body)), "1", nil, nil)
+	w := httptest.NewRecorder()
+	handler.Authorize(w, req)
+
+	if w.Code != http.StatusOK || !gotApproved {
+		t.Fatalf("expected the approval to be passed on, got status %d", w.Code)
+	}
+	var response struct {
+		Data AuthorizeResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Data.RedirectURL != "https://wiki.example.com/callback?code=xyz" {
+		t.Errorf("unexpected redirect %q", response.Data.RedirectURL)
+	}
+
+	req = withAuth(httptest.NewRequest("POST", "/api/oauth/authorize", bytes.NewBufferString(`{"client_id":"client-1"}`)), "1", nil, nil)
+	w = httptest.NewRecorder()
+	handler.Authorize(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a missing redirect_uri to fail validation, got %d", w.Code)
+	}
+}
+
+func TestOAuthHandler_RegisterClient(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "confidential client", body: `{"name":"Wiki","redirect_uris":["https://wiki.example.com/callback"]}`, expectedStatus: http.StatusOK},
+		{name: "no redirect uris", body: `{"name":"Wiki","redirect_uris":[]}`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid redirect uri", body: `{"name":"Wiki","redirect_uris":["http://wiki.example.com/"]}`, err: service.ErrInvalidRedirectURI, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewOAuthHandler(&MockOAuthService{
+				registerClientFunc: func(createdBy, name string, redirectURIs []string, public bool) (*service.OAuthClient, error) {
+					if createdBy != "1" {
+						t.Errorf("expected the client to be attributed to user 1, got %q", createdBy)
+					}
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &service.OAuthClient{ID: "client-1", Name: name, Secret: "s3cret"}, nil
+				},
+			})
+
+			req := withAuth(httptest.NewRequest("POST", "/api/oauth/clients", bytes.NewBufferString(tt.body)), "1", nil, nil)
+			w := httptest.NewRecorder()
+			handler.RegisterClient(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestOAuthHandler_RevokeConsent(t *testing.T) {
+	handler := NewOAuthHandler(&MockOAuthService{
+		revokeConsentFunc: func(userID, clientID string) error {
+			if clientID != "client-1" {
+				return service.ErrConsentNotFound
+			}
+			return nil
+		},
+	})
+
+	for clientID, expectedStatus := range map[string]int{"client-1": http.StatusOK, "other": http.StatusNotFound} {
+		req := withAuth(httptest.NewRequest("DELETE", "/api/auth/profile/consents/"+clientID, nil), "1", nil, map[string]string{"client_id": clientID})
+		w := httptest.NewRecorder()
+		handler.RevokeConsent(w, req)
+		if w.Code != expectedStatus {
+			t.Errorf("%s: expected status %d, got %d", clientID, expectedStatus, w.Code)
+		}
+	}
+}
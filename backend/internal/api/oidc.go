@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/middleware"
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+// OIDCCallbackRequest carries the query parameters the provider redirected
+// back to the frontend with
+type OIDCCallbackRequest struct {
+	State string `json:"state" validate:"required,max=128"`
+	Code  string `json:"code" validate:"required,max=2048"`
+}
+
+// OIDCAuthorizationResponse tells the frontend where to send the browser.
+// State should be kept, for example in sessionStorage, and compared with the
+// state the provider redirects back with before calling the callback.
+type OIDCAuthorizationResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
+
+// ListOIDCProviders returns the names of the providers offered on the login page
+func (h *AuthHandler) ListOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	WriteSuccess(w, h.Service.ListOIDCProviders(r.Context()))
+}
+
+// StartOIDCLogin begins signing in with an external provider
+func (h *AuthHandler) StartOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	auth, err := h.Service.StartOIDCLogin(r.Context(), chi.URLParam(r, "provider"))
+	if err != nil {
+		writeOIDCError(w, err, "Failed to start sign-in")
+		return
+	}
+
+	WriteSuccess(w, OIDCAuthorizationResponse{AuthorizationURL: auth.URL, State: auth.State})
+}
+
+// CompleteOIDCLogin signs the user in with the code the provider returned
+func (h *AuthHandler) CompleteOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	var req OIDCCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	tokens, user, err := h.Service.CompleteOIDCLogin(r.Context(), chi.URLParam(r, "provider"), req.State, req.Code)
+	recordLogin("oidc", err)
+	if err != nil {
+		if writeMFAChallenge(w, err) {
+			return
+		}
+		writeOIDCError(w, err, "Sign-in failed")
+		return
+	}
+
+	WriteSuccess(w, newAuthResponse(tokens, user))
+}
+
+// ListIdentities returns the external accounts linked to the current user
+func (h *AuthHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	identities, err := h.Service.ListIdentities(r.Context(), userID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list linked accounts: "+err.Error())
+		return
+	}
+
+	WriteSuccess(w, identities)
+}
+
+// StartOIDCLink begins linking an external account to the current user
+func (h *AuthHandler) StartOIDCLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	auth, err := h.Service.StartOIDCLink(r.Context(), userID, chi.URLParam(r, "provider"))
+	if err != nil {
+		writeOIDCError(w, err, "Failed to start linking")
+		return
+	}
+
+	WriteSuccess(w, OIDCAuthorizationResponse{AuthorizationURL: auth.URL, State: auth.State})
+}
+
+// CompleteOIDCLink links the external account the user signed in to
+func (h *AuthHandler) CompleteOIDCLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req OIDCCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	identity, err := h.Service.CompleteOIDCLink(r.Context(), userID, chi.URLParam(r, "provider"), req.State, req.Code)
+	if err != nil {
+		writeOIDCError(w, err, "Failed to link account")
+		return
+	}
+
+	WriteSuccess(w, identity)
+}
+
+// DeleteIdentity unlinks one of the current user's external accounts
+func (h *AuthHandler) DeleteIdentity(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.Service.DeleteIdentity(r.Context(), userID, chi.URLParam(r, "id")); err != nil {
+		switch err {
+		case service.ErrIdentityNotFound:
+			WriteError(w, http.StatusNotFound, "Linked account not found")
+		case service.ErrLastLoginMethod:
+			WriteError(w, http.StatusConflict, "Set a password or add a passkey before unlinking your last account")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to unlink account: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "Account unlinked",
+	})
+}
+
+// writeOIDCError maps the errors shared by the sign-in and linking flows
+func writeOIDCError(w http.ResponseWriter, err error, fallback string) {
+	switch err {
+	case service.ErrUnknownOIDCProvider:
+		WriteError(w, http.StatusNotFound, "Unknown identity provider")
+	case service.ErrUserNotFound:
+		WriteError(w, http.StatusNotFound, "User not found")
+	case service.ErrInvalidOIDCState:
+		WriteError(w, http.StatusBadRequest, "Invalid or expired sign-in request")
+	case service.ErrOIDCAuthFailed:
+		WriteError(w, http.StatusUnauthorized, "Sign-in with the identity provider failed")
+	case service.ErrEmailExists:
+		WriteError(w, http.StatusConflict, "An account with this email already exists; sign in and link the provider from your profile")
+	case service.ErrIdentityLinked:
+		WriteError(w, http.StatusConflict, "This account is already linked")
+	case service.ErrEmailNotVerified:
+		writeEmailNotVerified(w)
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback+": "+err.Error())
+	}
+}
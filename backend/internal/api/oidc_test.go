@@ -0,0 +1,184 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/service"
+)
+
+// withProvider sets the {provider} URL parameter on an unauthenticated request
+func withProvider(req *http.Request, provider string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("provider", provider)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestAuthHandler_StartOIDCLogin(t *testing.T) {
+	tests := []struct {
+		name           string
+		provider       string
+		expectedStatus int
+	}{
+		{name: "configured provider", provider: "fake", expectedStatus: http.StatusOK},
+		{name: "unknown provider", provider: "other", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{})
+
+			req := withProvider(httptest.NewRequest("POST", "/api/auth/oidc/"+tt.provider+"/start", nil), tt.provider)
+			w := httptest.NewRecorder()
+			handler.StartOIDCLogin(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data OIDCAuthorizationResponse `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.Data.AuthorizationURL == "" || response.Data.State != "abc" {
+				t.Errorf("unexpected authorization: %+v", response.Data)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_CompleteOIDCLogin(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		err            error
+		expectedStatus int
+		expectMFA      bool
+	}{
+		{name: "signs in", body: `{"state":"abc","code":"xyz"}`, expectedStatus: http.StatusOK},
+		{name: "missing code", body: `{"state":"abc"}`, expectedStatus: http.StatusBadRequest},
+		{name: "replayed state", body: `{"state":"abc","code":"xyz"}`, err: service.ErrInvalidOIDCState, expectedStatus: http.StatusBadRequest},
+		{name: "provider rejected the code", body: `{"state":"abc","code":"xyz"}`, err: service.ErrOIDCAuthFailed, expectedStatus: http.StatusUnauthorized},
+		{name: "unverified email of an existing account", body: `{"state":"abc","code":"xyz"}`, err: service.ErrEmailExists, expectedStatus: http.StatusConflict},
+		{
+			name:           "two-factor challenge",
+			body:           `{"state":"abc","code":"xyz"}`,
+			err:            &service.MFARequiredError{Token: "mfa-token", ExpiresAt: time.Now().Add(5 * time.Minute)},
+			expectedStatus: http.StatusOK,
+			expectMFA:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{
+				completeOIDCLoginFunc: func(provider, state, code string) (*service.AuthTokens, *service.User, error) {
+					if provider != "fake" || state != "abc" || code != "xyz" {
+						t.Errorf("unexpected arguments %q %q %q", provider, state, code)
+					}
+					if tt.err != nil {
+						return nil, nil, tt.err
+					}
+					return testTokens(), &service.User{ID: "1", Username: "alice"}, nil
+				},
+			})
+
+			req := withProvider(httptest.NewRequest("POST", "/api/auth/oidc/fake/callback", bytes.NewBufferString(tt.body)), "fake")
+			w := httptest.NewRecorder()
+			handler.CompleteOIDCLogin(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data struct {
+					Token       string `json:"token"`
+					MFARequired bool   `json:"mfa_required"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.Data.MFARequired != tt.expectMFA || (response.Data.Token == "") != tt.expectMFA {
+				t.Errorf("unexpected response: %+v", response.Data)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_CompleteOIDCLink(t *testing.T) {
+	var gotUser string
+	handler := NewAuthHandler(&MockAuthService{
+		completeOIDCLinkFunc: func(userID, provider, state, code string) (*service.Identity, error) {
+			gotUser = userID
+			if state == "taken" {
+				return nil, service.ErrIdentityLinked
+			}
+			return &service.Identity{ID: "id-1", Provider: provider}, nil
+		},
+	})
+
+	req := withAuth(httptest.NewRequest("POST", "/api/auth/profile/identities/fake/callback", bytes.NewBufferString(`{"state":"abc","code":"xyz"}`)),
+		"1", nil, map[string]string{"provider": "fake"})
+	w := httptest.NewRecorder()
+	handler.CompleteOIDCLink(w, req)
+	if w.Code != http.StatusOK || gotUser != "1" {
+		t.Errorf("expected the identity to be linked to user 1, got status %d for %q", w.Code, gotUser)
+	}
+
+	req = withAuth(httptest.NewRequest("POST", "/api/auth/profile/identities/fake/callback", bytes.NewBufferString(`{"state":"taken","code":"xyz"}`)),
+		"1", nil, map[string]string{"provider": "fake"})
+	w = httptest.NewRecorder()
+	handler.CompleteOIDCLink(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestAuthHandler_DeleteIdentity(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "unlinks", expectedStatus: http.StatusOK},
+		{name: "not found", err: service.ErrIdentityNotFound, expectedStatus: http.StatusNotFound},
+		{name: "last way to sign in", err: service.ErrLastLoginMethod, expectedStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{
+				deleteIdentityFunc: func(userID, identityID string) error {
+					if userID != "1" || identityID != "id-1" {
+						t.Errorf("unexpected arguments %q %q", userID, identityID)
+					}
+					return tt.err
+				},
+			})
+
+			req := withAuth(httptest.NewRequest("DELETE", "/api/auth/profile/identities/id-1", nil), "1", nil, map[string]string{"id": "id-1"})
+			w := httptest.NewRecorder()
+			handler.DeleteIdentity(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
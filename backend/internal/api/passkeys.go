@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/middleware"
+	"github.com/user/votex-template/backend/internal/service"
+	"github.com/user/votex-template/backend/pkg/webauthn"
+)
+
+type PasskeyLoginBeginRequest struct {
+	Username string `json:"username" validate:"omitempty,max=50"`
+}
+
+type PasskeyRegistrationFinishRequest struct {
+	SessionID  string                         `json:"session_id" validate:"required"`
+	Name       string                         `json:"name" validate:"max=64"`
+	Credential *webauthn.RegistrationResponse `json:"credential" validate:"required"`
+}
+
+type PasskeyLoginFinishRequest struct {
+	SessionID  string                      `json:"session_id" validate:"required"`
+	Credential *webauthn.AssertionResponse `json:"credential" validate:"required"`
+}
+
+// PasskeyCeremonyResponse is shaped like the argument to
+// navigator.credentials.create or get, with binary fields base64url encoded.
+// SessionID must be sent back with the authenticator's response.
+type PasskeyCeremonyResponse struct {
+	SessionID string      `json:"session_id"`
+	PublicKey interface{} `json:"publicKey"`
+}
+
+// BeginPasskeyRegistration starts adding a passkey to the current user
+func (h *AuthHandler) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	registration, err := h.Service.BeginPasskeyRegistration(r.Context(), userID)
+	if err != nil {
+		switch err {
+		case service.ErrUserNotFound:
+			WriteError(w, http.StatusNotFound, "User not found")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to start passkey registration: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, PasskeyCeremonyResponse{
+		SessionID: registration.SessionID,
+		PublicKey: registration.Options,
+	})
+}
+
+// FinishPasskeyRegistration stores the passkey created by the authenticator
+func (h *AuthHandler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req PasskeyRegistrationFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	passkey, err := h.Service.FinishPasskeyRegistration(r.Context(), userID, req.SessionID, req.Name, req.Credential)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidPasskeyCeremony:
+			WriteError(w, http.StatusBadRequest, "Invalid or expired passkey registration")
+		case service.ErrInvalidPasskey:
+			WriteError(w, http.StatusBadRequest, "Passkey verification failed")
+		case service.ErrPasskeyExists:
+			WriteError(w, http.StatusConflict, "Passkey already registered")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to register passkey: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, passkey)
+}
+
+// ListPasskeys returns the current user's passkeys
+func (h *AuthHandler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	passkeys, err := h.Service.ListPasskeys(r.Context(), userID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list passkeys: "+err.Error())
+		return
+	}
+
+	WriteSuccess(w, passkeys)
+}
+
+// DeletePasskey removes one of the current user's passkeys
+func (h *AuthHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.Service.DeletePasskey(r.Context(), userID, chi.URLParam(r, "id")); err != nil {
+		switch err {
+		case service.ErrPasskeyNotFound:
+			WriteError(w, http.StatusNotFound, "Passkey not found")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to delete passkey: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "Passkey deleted",
+	})
+}
+
+// BeginPasskeyLogin starts a passwordless login. The username is optional;
+// without it the browser offers any discoverable passkey for this site.
+func (h *AuthHandler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyLoginBeginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	login, err := h.Service.BeginPasskeyLogin(r.Context(), req.Username)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to start passkey login: "+err.Error())
+		return
+	}
+
+	WriteSuccess(w, PasskeyCeremonyResponse{
+		SessionID: login.SessionID,
+		PublicKey: login.Options,
+	})
+}
+
+// FinishPasskeyLogin verifies the authenticator's assertion and signs the user in
+func (h *AuthHandler) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyLoginFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	tokens, user, err := h.Service.FinishPasskeyLogin(r.Context(), req.SessionID, req.Credential)
+	recordLogin("passkey", err)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidPasskeyCeremony:
+			WriteError(w, http.StatusUnauthorized, "Invalid or expired passkey login")
+		case service.ErrInvalidPasskey:
+			WriteError(w, http.StatusUnauthorized, "Passkey verification failed")
+		case service.ErrEmailNotVerified:
+			writeEmailNotVerified(w)
+		default:
+			WriteError(w, http.StatusInternalServerError, "Passkey login failed: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, newAuthResponse(tokens, user))
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/user/votex-template/backend/internal/service"
+	"github.com/user/votex-template/backend/pkg/webauthn"
+)
+
+func TestAuthHandler_BeginPasskeyLogin(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedUser   string
+		expectedStatus int
+	}{
+		{name: "discoverable login without a body", body: "", expectedStatus: http.StatusOK},
+		{name: "named account", body: `{"username":"testuser"}`, expectedUser: "testuser", expectedStatus: http.StatusOK},
+		{name: "malformed body", body: `{`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUser string
+			handler := NewAuthHandler(&MockAuthService{
+				beginPasskeyLoginFunc: func(username string) (*service.PasskeyLogin, error) {
+					gotUser = username
+					return &service.PasskeyLogin{SessionID: "session", Options: webauthn.RequestOptions{RPID: "localhost"}}, nil
+				},
+			})
+
+			req := httptest.NewRequest("POST", "/api/auth/login/passkey/begin", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			handler.BeginPasskeyLogin(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if gotUser != tt.expectedUser {
+				t.Errorf("expected username %q, got %q", tt.expectedUser, gotUser)
+			}
+
+			var response struct {
+				Data struct {
+					SessionID string                  `json:"session_id"`
+					PublicKey webauthn.RequestOptions `json:"publicKey"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.Data.SessionID != "session" || response.Data.PublicKey.RPID != "localhost" {
+				t.Errorf("unexpected ceremony: %+v", response.Data)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_FinishPasskeyLogin(t *testing.T) {
+	credential := &webauthn.AssertionResponse{ID: "Y3JlZA", RawID: []byte("cred"), Type: "public-key"}
+
+	tests := []struct {
+		name           string
+		requestBody    PasskeyLoginFinishRequest
+		mockFinish     func(sessionID string, resp *webauthn.AssertionResponse) (*service.AuthTokens, *service.User, error)
+		expectedStatus int
+	}{
+		{
+			name:        "valid assertion",
+			requestBody: PasskeyLoginFinishRequest{SessionID: "session", Credential: credential},
+			mockFinish: func(sessionID string, resp *webauthn.AssertionResponse) (*service.AuthTokens, *service.User, error) {
+				return testTokens(), &service.User{ID: "1", Username: "testuser"}, nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing credential",
+			requestBody:    PasskeyLoginFinishRequest{SessionID: "session"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "expired ceremony",
+			requestBody: PasskeyLoginFinishRequest{SessionID: "stale", Credential: credential},
+			mockFinish: func(sessionID string, resp *webauthn.AssertionResponse) (*service.AuthTokens, *service.User, error) {
+				return nil, nil, service.ErrInvalidPasskeyCeremony
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:        "verification failed",
+			requestBody: PasskeyLoginFinishRequest{SessionID: "session", Credential: credential},
+			mockFinish: func(sessionID string, resp *webauthn.AssertionResponse) (*service.AuthTokens, *service.User, error) {
+				return nil, nil, service.ErrInvalidPasskey
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{finishPasskeyLoginFunc: tt.mockFinish})
+
+			body, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/api/auth/login/passkey/finish", bytes.NewBuffer(body))
+			w := httptest.NewRecorder()
+			handler.FinishPasskeyLogin(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_DeletePasskey(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		passkeyID      string
+		expectedStatus int
+	}{
+		{name: "own passkey", userID: "1", passkeyID: "pk-1", expectedStatus: http.StatusOK},
+		{name: "unknown passkey", userID: "1", passkeyID: "pk-2", expectedStatus: http.StatusNotFound},
+		{name: "unauthenticated", passkeyID: "pk-1", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{
+				deletePasskeyFunc: func(userID, passkeyID string) error {
+					if passkeyID != "pk-1" {
+						return service.ErrPasskeyNotFound
+					}
+					return nil
+				},
+			})
+
+			req := httptest.NewRequest("DELETE", "/api/auth/profile/passkeys/"+tt.passkeyID, nil)
+			if tt.userID != "" {
+				req = withAuth(req, tt.userID, nil, map[string]string{"id": tt.passkeyID})
+			}
+			w := httptest.NewRecorder()
+			handler.DeletePasskey(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/service"
+	"github.com/user/votex-template/backend/pkg/password"
+)
+
+var weakPasswordErr = &service.PasswordPolicyError{Violations: []password.Violation{
+	{Rule: password.RuleStrength, Message: "Password is too easy to guess"},
+	{Rule: password.RuleBreached, Message: "Password has appeared in a data breach and cannot be used"},
+}}
+
+func assertWeakPasswordResponse(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	var response ValidationErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Success || len(response.Details) != 2 {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+	for i, detail := range response.Details {
+		violation := weakPasswordErr.Violations[i]
+		if detail.Field != "Password" || detail.Code != violation.Rule || detail.Message != violation.Message {
+			t.Errorf("unexpected detail %d: %+v", i, detail)
+		}
+	}
+}
+
+func TestAuthHandler_RegisterWeakPassword(t *testing.T) {
+	handler := NewAuthHandler(&MockAuthService{
+		registerFunc: func(username, email, password string) (*service.AuthTokens, *service.User, error) {
+			return nil, nil, weakPasswordErr
+		},
+	})
+
+	body, _ := json.Marshal(AuthRequest{Username: "alice", Password: "password123"})
+	req := httptest.NewRequest("POST", "/api/auth/register", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	handler.Register(w, req)
+
+	assertWeakPasswordResponse(t, w)
+}
+
+func TestAuthHandler_ResetPasswordWeakPassword(t *testing.T) {
+	handler := NewAuthHandler(&MockAuthService{
+		resetPasswordFunc: func(token, newPassword string) error {
+			return weakPasswordErr
+		},
+	})
+	r := chi.NewRouter()
+	r.Post("/api/auth/password-reset/{token}", handler.ResetPassword)
+
+	body, _ := json.Marshal(PasswordResetConfirmRequest{Password: "password123"})
+	req := httptest.NewRequest("POST", "/api/auth/password-reset/reset-token", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assertWeakPasswordResponse(t, w)
+}
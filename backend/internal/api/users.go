@@ -4,11 +4,14 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 	"github.com/user/votex-template/backend/internal/middleware"
 	"github.com/user/votex-template/backend/internal/service"
+	"github.com/user/votex-template/backend/internal/store"
 )
 
 type UserHandler struct {
@@ -24,19 +27,21 @@ func NewUserHandler(s service.AuthServiceInterface) *UserHandler {
 }
 
 type UserListResponse struct {
-	Users []UserResponse `json:"users"`
-	Total int            `json:"total"`
-	Page  int            `json:"page"`
-	Limit int            `json:"limit"`
+	Users      []UserResponse `json:"users"`
+	Total      int            `json:"total"`
+	Page       int            `json:"page"`
+	Limit      int            `json:"limit"`
+	NextCursor string         `json:"next_cursor,omitempty"`
 }
 
 type UserResponse struct {
-	ID        string  `json:"id"`
-	Username  string  `json:"username"`
-	Email     *string `json:"email,omitempty"`
-	Age       *int    `json:"age,omitempty"`
-	CreatedAt *string `json:"created_at,omitempty"`
-	UpdatedAt *string `json:"updated_at,omitempty"`
+	ID           string  `json:"id"`
+	Username     string  `json:"username"`
+	Email        *string `json:"email,omitempty"`
+	PendingEmail *string `json:"pending_email,omitempty"`
+	Age          *int    `json:"age,omitempty"`
+	CreatedAt    *string `json:"created_at,omitempty"`
+	UpdatedAt    *string `json:"updated_at,omitempty"`
 }
 
 type UserUpdateAdminRequest struct {
@@ -45,48 +50,90 @@ type UserUpdateAdminRequest struct {
 	Age      *int    `json:"age" validate:"omitempty,min=0,max=150"`
 }
 
-// ListUsers handles GET /api/users - list all users with pagination
+type RoleAssignmentRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+// ListUsers handles GET /api/users - list users with search, filtering, sorting and pagination
 func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
-	// Get pagination parameters
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-	search := r.URL.Query().Get("search")
+	query := r.URL.Query()
 
+	// Get pagination parameters
 	page := 1
 	limit := 10
 
-	if pageStr != "" {
+	if pageStr := query.Get("page"); pageStr != "" {
 		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
 			page = p
 		}
 	}
 
-	if limitStr != "" {
+	if limitStr := query.Get("limit"); limitStr != "" {
 		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
 			limit = l
 		}
 	}
 
-	// For now, we'll implement a simple list without search
-	// In a real implementation, you'd add search functionality to the store
-	_ = search
+	opts := store.UserListOptions{
+		Search: strings.TrimSpace(query.Get("search")),
+		SortBy: query.Get("sort"),
+		Limit:  limit,
+		Offset: (page - 1) * limit,
+		Cursor: query.Get("cursor"),
+	}
+
+	var details []ValidationError
 
-	// Get users from service (this would need to be implemented in the service layer)
-	// For now, we'll return a placeholder response
-	users := []UserResponse{
-		{
-			ID:       "1",
-			Username: "admin",
-			Email:    nil,
-			Age:      nil,
-		},
+	switch opts.SortBy {
+	case "", "created_at", "username", "email", "age":
+	default:
+		details = append(details, ValidationError{Field: "sort", Message: "sort must be one of created_at, username, email, age"})
+	}
+
+	switch strings.ToLower(query.Get("order")) {
+	case "", "asc":
+	case "desc":
+		opts.SortDesc = true
+	default:
+		details = append(details, ValidationError{Field: "order", Message: "order must be asc or desc"})
+	}
+
+	opts.CreatedAfter = parseTimeParam(query.Get("created_after"), "created_after", &details)
+	opts.CreatedBefore = parseTimeParam(query.Get("created_before"), "created_before", &details)
+	opts.MinAge = parseIntParam(query.Get("min_age"), "min_age", &details)
+	opts.MaxAge = parseIntParam(query.Get("max_age"), "max_age", &details)
+
+	if len(details) > 0 {
+		WriteJSON(w, http.StatusBadRequest, ValidationErrorResponse{
+			Success: false,
+			Error:   "Validation failed",
+			Details: details,
+		})
+		return
+	}
+
+	result, err := h.Service.ListUsers(r.Context(), opts)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidCursor:
+			WriteError(w, http.StatusBadRequest, "Invalid or stale cursor")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to list users: "+err.Error())
+		}
+		return
+	}
+
+	users := make([]UserResponse, 0, len(result.Users))
+	for i := range result.Users {
+		users = append(users, toUserResponse(&result.Users[i]))
 	}
 
 	response := UserListResponse{
-		Users: users,
-		Total: len(users),
-		Page:  page,
-		Limit: limit,
+		Users:      users,
+		Total:      result.Total,
+		Page:       page,
+		Limit:      limit,
+		NextCursor: result.NextCursor,
 	}
 
 	WriteSuccess(w, response)
@@ -100,21 +147,20 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is requesting their own profile or is admin
+	// Check if user is requesting their own profile or is an admin
 	requestingUserID, ok := middleware.GetUserID(r)
 	if !ok {
 		WriteError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
-	// For now, only allow users to view their own profile
-	// In a real implementation, you'd check for admin role
-	if requestingUserID != userID {
+	// Users may always act on themselves; anyone else needs the users:read permission
+	if requestingUserID != userID && !middleware.HasPermission(r, middleware.PermissionUsersRead) {
 		WriteError(w, http.StatusForbidden, "Access denied")
 		return
 	}
 
-	user, err := h.Service.GetUserByID(userID)
+	user, err := h.Service.GetUserByID(r.Context(), userID)
 	if err != nil {
 		switch err {
 		case service.ErrUserNotFound:
@@ -125,14 +171,7 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := UserResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Age:      user.Age,
-	}
-
-	WriteSuccess(w, response)
+	WriteSuccess(w, toUserResponse(user))
 }
 
 // UpdateUser handles PUT /api/users/{id} - update a user
@@ -143,16 +182,16 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is updating their own profile or is admin
+	// Check if user is updating their own profile or is an admin
 	requestingUserID, ok := middleware.GetUserID(r)
 	if !ok {
 		WriteError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
-	// For now, only allow users to update their own profile
-	// In a real implementation, you'd check for admin role
-	if requestingUserID != userID {
+	// Users may always act on themselves from a session; anyone else, and API
+	// keys even for their owner, need the users:write permission
+	if !mayModifyUser(r, requestingUserID, userID, middleware.PermissionUsersWrite) {
 		WriteError(w, http.StatusForbidden, "Access denied")
 		return
 	}
@@ -180,7 +219,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		updates["age"] = *req.Age
 	}
 
-	user, err := h.Service.UpdateUser(userID, updates)
+	user, err := h.Service.UpdateUser(r.Context(), userID, updates)
 	if err != nil {
 		switch err {
 		case service.ErrUserNotFound:
@@ -189,20 +228,15 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 			WriteError(w, http.StatusConflict, "Username already exists")
 		case service.ErrEmailExists:
 			WriteError(w, http.StatusConflict, "Email already exists")
+		case service.ErrEmailRequired:
+			WriteError(w, http.StatusBadRequest, "Email cannot be removed")
 		default:
 			WriteError(w, http.StatusInternalServerError, "Failed to update user: "+err.Error())
 		}
 		return
 	}
 
-	response := UserResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Age:      user.Age,
-	}
-
-	WriteSuccess(w, response)
+	WriteSuccess(w, toUserResponse(user))
 }
 
 // DeleteUser handles DELETE /api/users/{id} - delete a user
@@ -213,21 +247,21 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is deleting their own account or is admin
+	// Check if user is deleting their own account or is an admin
 	requestingUserID, ok := middleware.GetUserID(r)
 	if !ok {
 		WriteError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
-	// For now, only allow users to delete their own account
-	// In a real implementation, you'd check for admin role
-	if requestingUserID != userID {
+	// Users may always act on themselves from a session; anyone else, and API
+	// keys even for their owner, need the users:delete permission
+	if !mayModifyUser(r, requestingUserID, userID, middleware.PermissionUsersDelete) {
 		WriteError(w, http.StatusForbidden, "Access denied")
 		return
 	}
 
-	err := h.Service.DeleteUser(userID)
+	err := h.Service.DeleteUser(r.Context(), userID)
 	if err != nil {
 		switch err {
 		case service.ErrUserNotFound:
@@ -242,3 +276,122 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		"message": "User deleted successfully",
 	})
 }
+
+// mayModifyUser reports whether the requester may change or delete the
+// target user. A leaked API key must not be able to change its owner's email
+// or delete their account, so it needs the permission like anyone else.
+func mayModifyUser(r *http.Request, requestingUserID, userID, permission string) bool {
+	if _, isAPIKey := middleware.GetAPIKeyID(r); requestingUserID == userID && !isAPIKey {
+		return true
+	}
+	return middleware.HasPermission(r, permission)
+}
+
+// AssignRole handles POST /api/users/{id}/roles - grant a role to a user
+func (h *UserHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	if userID == "" {
+		WriteError(w, http.StatusBadRequest, "User ID is required")
+		return
+	}
+
+	var req RoleAssignmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		WriteValidationError(w, err)
+		return
+	}
+
+	err := h.Service.AssignRole(r.Context(), userID, req.Role)
+	if err != nil {
+		switch err {
+		case service.ErrUserNotFound:
+			WriteError(w, http.StatusNotFound, "User not found")
+		case service.ErrRoleNotFound:
+			WriteError(w, http.StatusBadRequest, "Unknown role")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to assign role: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "Role assigned successfully",
+	})
+}
+
+// RemoveRole handles DELETE /api/users/{id}/roles/{role} - revoke a role from a user
+func (h *UserHandler) RemoveRole(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	role := chi.URLParam(r, "role")
+	if userID == "" || role == "" {
+		WriteError(w, http.StatusBadRequest, "User ID and role are required")
+		return
+	}
+
+	err := h.Service.RemoveRole(r.Context(), userID, role)
+	if err != nil {
+		switch err {
+		case service.ErrUserNotFound:
+			WriteError(w, http.StatusNotFound, "User not found")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to remove role: "+err.Error())
+		}
+		return
+	}
+
+	WriteSuccess(w, map[string]string{
+		"message": "Role removed successfully",
+	})
+}
+
+// toUserResponse converts a service user into its API representation
+func toUserResponse(user *service.User) UserResponse {
+	response := UserResponse{
+		ID:           user.ID,
+		Username:     user.Username,
+		Email:        user.Email,
+		PendingEmail: user.PendingEmail,
+		Age:          user.Age,
+	}
+	if user.CreatedAt != nil {
+		createdAt := user.CreatedAt.Format(time.RFC3339)
+		response.CreatedAt = &createdAt
+	}
+	if user.UpdatedAt != nil {
+		updatedAt := user.UpdatedAt.Format(time.RFC3339)
+		response.UpdatedAt = &updatedAt
+	}
+	return response
+}
+
+// parseTimeParam parses an optional RFC 3339 timestamp or YYYY-MM-DD date query parameter
+func parseTimeParam(value, field string, details *[]ValidationError) *time.Time {
+	if value == "" {
+		return nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t
+		}
+	}
+	*details = append(*details, ValidationError{Field: field, Message: field + " must be an RFC 3339 timestamp or YYYY-MM-DD date"})
+	return nil
+}
+
+// parseIntParam parses an optional non-negative integer query parameter
+func parseIntParam(value, field string, details *[]ValidationError) *int {
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		*details = append(*details, ValidationError{Field: field, Message: field + " must be a non-negative integer"})
+		return nil
+	}
+	return &n
+}
@@ -0,0 +1,335 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/votex-template/backend/internal/middleware"
+	"github.com/user/votex-template/backend/internal/service"
+	"github.com/user/votex-template/backend/internal/store"
+)
+
+// withAuth simulates the Authenticate middleware and chi URL params
+func withAuth(req *http.Request, userID string, permissions []string, params map[string]string) *http.Request {
+	ctx := context.WithValue(req.Context(), "user_id", userID)
+	ctx = context.WithValue(ctx, "permissions", permissions)
+
+	rctx := chi.NewRouteContext()
+	for key, value := range params {
+		rctx.URLParams.Add(key, value)
+	}
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+
+	return req.WithContext(ctx)
+}
+
+func TestUserHandler_GetUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestingUser string
+		permissions    []string
+		targetUser     string
+		expectedStatus int
+	}{
+		{
+			name:           "own profile",
+			requestingUser: "1",
+			targetUser:     "1",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "other user without permission",
+			requestingUser: "1",
+			targetUser:     "2",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "other user as admin",
+			requestingUser: "1",
+			permissions:    []string{middleware.PermissionUsersRead},
+			targetUser:     "2",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "write permission does not grant read",
+			requestingUser: "1",
+			permissions:    []string{middleware.PermissionUsersWrite},
+			targetUser:     "2",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockAuthService{
+				getUserFunc: func(userID string) (*service.User, error) {
+					return &service.User{ID: userID, Username: "user" + userID}, nil
+				},
+			}
+
+			handler := NewUserHandler(mockService)
+
+			req := httptest.NewRequest("GET", "/api/users/"+tt.targetUser, nil)
+			req = withAuth(req, tt.requestingUser, tt.permissions, map[string]string{"id": tt.targetUser})
+
+			w := httptest.NewRecorder()
+			handler.GetUser(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestUserHandler_UpdateUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		permissions    []string
+		expectedStatus int
+	}{
+		{
+			name:           "other user without permission",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "other user as admin",
+			permissions:    []string{middleware.PermissionUsersWrite},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockAuthService{
+				updateFunc: func(userID string, updates map[string]interface{}) (*service.User, error) {
+					return &service.User{ID: userID, Username: updates["username"].(string)}, nil
+				},
+			}
+
+			handler := NewUserHandler(mockService)
+
+			body, _ := json.Marshal(map[string]string{"username": "renamed"})
+			req := httptest.NewRequest("PUT", "/api/users/2", bytes.NewBuffer(body))
+			req = withAuth(req, "1", tt.permissions, map[string]string{"id": "2"})
+
+			w := httptest.NewRecorder()
+			handler.UpdateUser(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestUserHandler_DeleteUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		permissions    []string
+		expectedStatus int
+	}{
+		{
+			name:           "other user without permission",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "other user as admin",
+			permissions:    []string{middleware.PermissionUsersDelete},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewUserHandler(&MockAuthService{})
+
+			req := httptest.NewRequest("DELETE", "/api/users/2", nil)
+			req = withAuth(req, "1", tt.permissions, map[string]string{"id": "2"})
+
+			w := httptest.NewRecorder()
+			handler.DeleteUser(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestUserHandler_APIKeyActingOnOwner(t *testing.T) {
+	tests := []struct {
+		name           string
+		permissions    []string
+		expectedStatus int
+	}{
+		{name: "without scope", expectedStatus: http.StatusForbidden},
+		{name: "with scope", permissions: []string{middleware.PermissionUsersWrite, middleware.PermissionUsersDelete}, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewUserHandler(&MockAuthService{
+				updateFunc: func(userID string, updates map[string]interface{}) (*service.User, error) {
+					return &service.User{ID: userID}, nil
+				},
+			})
+			withAPIKey := func(req *http.Request) *http.Request {
+				req = withAuth(req, "1", tt.permissions, map[string]string{"id": "1"})
+				return req.WithContext(context.WithValue(req.Context(), "api_key_id", "key-1"))
+			}
+
+			body, _ := json.Marshal(map[string]string{"email": "attacker@example.com"})
+			w := httptest.NewRecorder()
+			handler.UpdateUser(w, withAPIKey(httptest.NewRequest("PUT", "/api/users/1", bytes.NewBuffer(body))))
+			if w.Code != tt.expectedStatus {
+				t.Errorf("update: expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			w = httptest.NewRecorder()
+			handler.DeleteUser(w, withAPIKey(httptest.NewRequest("DELETE", "/api/users/1", nil)))
+			if w.Code != tt.expectedStatus {
+				t.Errorf("delete: expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestUserHandler_AssignRole(t *testing.T) {
+	tests := []struct {
+		name           string
+		role           string
+		mockAssign     func(userID, role string) error
+		expectedStatus int
+	}{
+		{
+			name:           "role assigned",
+			role:           "admin",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "unknown role",
+			role: "superuser",
+			mockAssign: func(userID, role string) error {
+				return service.ErrRoleNotFound
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing role",
+			role:           "",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewUserHandler(&MockAuthService{assignFunc: tt.mockAssign})
+
+			body, _ := json.Marshal(RoleAssignmentRequest{Role: tt.role})
+			req := httptest.NewRequest("POST", "/api/users/2/roles", bytes.NewBuffer(body))
+			req = withAuth(req, "1", []string{middleware.PermissionRolesWrite}, map[string]string{"id": "2"})
+
+			w := httptest.NewRecorder()
+			handler.AssignRole(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestUserHandler_ListUsers(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		mockList       func(opts store.UserListOptions) (*service.UserList, error)
+		expectedStatus int
+		checkOpts      func(t *testing.T, opts store.UserListOptions)
+	}{
+		{
+			name:           "defaults",
+			query:          "",
+			expectedStatus: http.StatusOK,
+			checkOpts: func(t *testing.T, opts store.UserListOptions) {
+				if opts.Limit != 10 || opts.Offset != 0 || opts.SortBy != "" {
+					t.Errorf("unexpected default options: %+v", opts)
+				}
+			},
+		},
+		{
+			name:           "filters and sorting",
+			query:          "?search=ali&sort=age&order=desc&min_age=18&max_age=65&created_after=2024-01-01&page=3&limit=20",
+			expectedStatus: http.StatusOK,
+			checkOpts: func(t *testing.T, opts store.UserListOptions) {
+				if opts.Search != "ali" || opts.SortBy != "age" || !opts.SortDesc {
+					t.Errorf("unexpected search/sort options: %+v", opts)
+				}
+				if *opts.MinAge != 18 || *opts.MaxAge != 65 || opts.CreatedAfter == nil {
+					t.Errorf("unexpected filter options: %+v", opts)
+				}
+				if opts.Limit != 20 || opts.Offset != 40 {
+					t.Errorf("expected limit 20 offset 40, got %d %d", opts.Limit, opts.Offset)
+				}
+			},
+		},
+		{
+			name:           "invalid parameters",
+			query:          "?sort=password_hash&order=sideways&min_age=old&created_before=yesterday",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "stale cursor",
+			query: "?cursor=abc",
+			mockList: func(opts store.UserListOptions) (*service.UserList, error) {
+				return nil, service.ErrInvalidCursor
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received store.UserListOptions
+			mockService := &MockAuthService{
+				listFunc: func(opts store.UserListOptions) (*service.UserList, error) {
+					received = opts
+					if tt.mockList != nil {
+						return tt.mockList(opts)
+					}
+					return &service.UserList{Users: []service.User{{ID: "1", Username: "alice"}}, Total: 1}, nil
+				},
+			}
+
+			handler := NewUserHandler(mockService)
+
+			req := httptest.NewRequest("GET", "/api/users"+tt.query, nil)
+			req = withAuth(req, "1", []string{middleware.PermissionUsersRead}, nil)
+
+			w := httptest.NewRecorder()
+			handler.ListUsers(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus == http.StatusBadRequest && tt.mockList == nil {
+				var response ValidationErrorResponse
+				json.Unmarshal(w.Body.Bytes(), &response)
+				if len(response.Details) != 4 {
+					t.Errorf("expected 4 validation details, got %+v", response.Details)
+				}
+			}
+
+			if tt.checkOpts != nil {
+				tt.checkOpts(t, received)
+			}
+		})
+	}
+}
@@ -3,13 +3,17 @@ package config
 import (
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 
 	"github.com/spf13/viper"
+	"github.com/user/votex-template/backend/pkg/clientip"
 )
 
 type Environment string
 type DatabaseType string
+type EmailVerification string
+type RateLimitStore string
 
 const (
 	Development Environment = "development"
@@ -22,6 +26,18 @@ const (
 	SQLite     DatabaseType = "sqlite"
 )
 
+// What an unverified email address keeps a user from doing
+const (
+	VerifyEmailOptional  EmailVerification = "optional"  // nothing
+	VerifyEmailSensitive EmailVerification = "sensitive" // sensitive actions such as creating API keys
+	VerifyEmailLogin     EmailVerification = "login"     // signing in at all
+)
+
+const (
+	RateLimitStoreMemory RateLimitStore = "memory"
+	RateLimitStoreRedis  RateLimitStore = "redis"
+)
+
 type Config struct {
 	Environment Environment  `mapstructure:"ENVIRONMENT"`
 	Port        string       `mapstructure:"PORT"`
@@ -29,25 +45,165 @@ type Config struct {
 	DBType      DatabaseType `mapstructure:"DB_TYPE"`
 	SQLitePath  string       `mapstructure:"SQLITE_PATH"`
 	RedisURL    string       `mapstructure:"REDIS_URL"`
-	JWTSecret   string       `mapstructure:"JWT_SECRET"`
 	LogLevel    string       `mapstructure:"LOG_LEVEL"`
 	CORSOrigins []string     `mapstructure:"CORS_ORIGINS"`
 
-	// Email configuration
-	SMTPHost     string `mapstructure:"SMTP_HOST"`
-	SMTPPort     int    `mapstructure:"SMTP_PORT"`
-	SMTPUsername string `mapstructure:"SMTP_USERNAME"`
-	SMTPPassword string `mapstructure:"SMTP_PASSWORD"`
-	SMTPFrom     string `mapstructure:"SMTP_FROM"`
-	SMTPTLS      bool   `mapstructure:"SMTP_TLS"`
+	// Reverse proxies trusted to report the client address in
+	// CLIENT_IP_HEADER. Without them the peer address is the client.
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES"`  // CIDR prefixes or addresses
+	ClientIPHeader string   `mapstructure:"CLIENT_IP_HEADER"` // x-forwarded-for or forwarded
+
+	// Prometheus metrics on /metrics, off by default. Served on PORT or, with
+	// METRICS_ADDR, on a separate listener that can be kept private
+	MetricsEnabled bool   `mapstructure:"METRICS_ENABLED"`
+	MetricsAddr    string `mapstructure:"METRICS_ADDR"` // such as :9090
+
+	// Existing accounts granted the admin role at startup
+	AdminUsers []string `mapstructure:"ADMIN_USERS"`
+
+	// Token lifetimes
+	AccessTokenExpiry  int `mapstructure:"ACCESS_TOKEN_EXPIRY"`  // in minutes
+	RefreshTokenExpiry int `mapstructure:"REFRESH_TOKEN_EXPIRY"` // in hours
+
+	// Token signing keys. Without JWT_KEY_FILES keys are generated and
+	// rotated in the database.
+	JWTAlgorithm      string   `mapstructure:"JWT_ALGORITHM"`        // EdDSA, RS256 or ES256
+	JWTKeyFiles       []string `mapstructure:"JWT_KEY_FILES"`        // PEM private keys; the first one signs
+	JWTKeyRotation    int      `mapstructure:"JWT_KEY_ROTATION"`     // in hours, 0 disables rotation
+	JWTKeyGracePeriod int      `mapstructure:"JWT_KEY_GRACE_PERIOD"` // in minutes
+
+	// API keys for scripts and CI jobs
+	APIKeyMaxExpiry int `mapstructure:"API_KEY_MAX_EXPIRY"` // in days, 0 allows keys that never expire
+
+	// Password hashing. Hashes made with other settings are upgraded when
+	// their owner next signs in.
+	PasswordHash      string `mapstructure:"PASSWORD_HASH"`      // argon2id or bcrypt
+	Argon2Memory      int    `mapstructure:"ARGON2_MEMORY"`      // in KiB
+	Argon2Iterations  int    `mapstructure:"ARGON2_ITERATIONS"`  // passes over memory
+	Argon2Parallelism int    `mapstructure:"ARGON2_PARALLELISM"` // lanes
+	BcryptCost        int    `mapstructure:"BCRYPT_COST"`        // log2 of the rounds
+
+	// Password policy for new passwords
+	PasswordMinLength      int    `mapstructure:"PASSWORD_MIN_LENGTH"`       // in characters, at least 8
+	PasswordMinClasses     int    `mapstructure:"PASSWORD_MIN_CLASSES"`      // of lowercase, uppercase, digits and symbols, 0 disables
+	PasswordMinStrength    int    `mapstructure:"PASSWORD_MIN_STRENGTH"`     // score from 0 (any) to 4
+	PasswordRejectUserInfo bool   `mapstructure:"PASSWORD_REJECT_USER_INFO"` // refuse passwords containing the username or email
+	PasswordHistory        int    `mapstructure:"PASSWORD_HISTORY"`          // recent passwords that cannot be reused, 0 disables
+	PasswordBreachFile     string `mapstructure:"PASSWORD_BREACH_FILE"`      // SHA-1 hashes of breached passwords, empty disables
+
+	// Two-factor authentication
+	MFAIssuer      string `mapstructure:"MFA_ISSUER"`       // issuer shown in authenticator apps
+	MFATokenExpiry int    `mapstructure:"MFA_TOKEN_EXPIRY"` // in minutes
+	MFAMaxAttempts int    `mapstructure:"MFA_MAX_ATTEMPTS"` // codes tried per challenge token
+
+	// Passkeys (WebAuthn)
+	WebAuthnRPID    string   `mapstructure:"WEBAUTHN_RP_ID"`   // domain passkeys are scoped to
+	WebAuthnRPName  string   `mapstructure:"WEBAUTHN_RP_NAME"` // name shown by the authenticator
+	WebAuthnOrigins []string `mapstructure:"WEBAUTHN_ORIGINS"`
+	WebAuthnTimeout int      `mapstructure:"WEBAUTHN_TIMEOUT"` // in minutes
+
+	// Social login (OpenID Connect). Each name in OIDC_PROVIDERS is
+	// configured through its own OIDC_<NAME>_* variables.
+	OIDCProviderNames []string       `mapstructure:"OIDC_PROVIDERS"`
+	OIDCProviders     []OIDCProvider `mapstructure:"-"`
+
+	// Built-in identity provider for sibling services; disabled while
+	// IDP_ISSUER is empty
+	IDPIssuer       string `mapstructure:"IDP_ISSUER"`        // public URL of this backend
+	IDPAuthorizeURL string `mapstructure:"IDP_AUTHORIZE_URL"` // frontend page that asks for consent
+
+	// Email configuration. EMAIL_TRANSPORT picks how mail leaves; SMTP_FROM
+	// is the sender for every transport.
+	EmailTransport  string `mapstructure:"EMAIL_TRANSPORT"` // log, file, smtp or http
+	EmailTimeout    int    `mapstructure:"EMAIL_TIMEOUT"`   // in seconds
+	SMTPHost        string `mapstructure:"SMTP_HOST"`
+	SMTPPort        int    `mapstructure:"SMTP_PORT"`
+	SMTPUsername    string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword    string `mapstructure:"SMTP_PASSWORD"`
+	SMTPFrom        string `mapstructure:"SMTP_FROM"`
+	SMTPSecurity    string `mapstructure:"SMTP_SECURITY"`     // starttls, tls or none
+	EmailFileDir    string `mapstructure:"EMAIL_FILE_DIR"`    // for the file transport
+	EmailFileFormat string `mapstructure:"EMAIL_FILE_FORMAT"` // eml or maildir
+	EmailAPIURL     string `mapstructure:"EMAIL_API_URL"`     // for the http transport
+	EmailAPIKey     string `mapstructure:"EMAIL_API_KEY"`
+
+	// DKIM signing, enabled by DKIM_KEY_FILE. DKIM_DOMAIN defaults to the
+	// domain of SMTP_FROM and DKIM_HEADERS to the usual set.
+	DKIMKeyFile  string   `mapstructure:"DKIM_KEY_FILE"` // PEM RSA or Ed25519 private key
+	DKIMDomain   string   `mapstructure:"DKIM_DOMAIN"`
+	DKIMSelector string   `mapstructure:"DKIM_SELECTOR"`
+	DKIMHeaders  []string `mapstructure:"DKIM_HEADERS"` // header fields to sign
+
+	// Outgoing email is queued in the database and delivered by
+	// EMAIL_QUEUE_WORKERS workers, retrying with exponential backoff until
+	// EMAIL_MAX_ATTEMPTS fail. Without workers emails are sent directly.
+	EmailQueueWorkers      int `mapstructure:"EMAIL_QUEUE_WORKERS"`
+	EmailQueuePollInterval int `mapstructure:"EMAIL_QUEUE_POLL_INTERVAL"` // in seconds
+	EmailQueueDrainTimeout int `mapstructure:"EMAIL_QUEUE_DRAIN_TIMEOUT"` // in seconds
+	EmailMaxAttempts       int `mapstructure:"EMAIL_MAX_ATTEMPTS"`
+	EmailRetryBaseDelay    int `mapstructure:"EMAIL_RETRY_BASE_DELAY"` // in seconds
+	EmailRetryMaxDelay     int `mapstructure:"EMAIL_RETRY_MAX_DELAY"`  // in seconds
+
+	// Email verification
+	EmailVerification               EmailVerification `mapstructure:"EMAIL_VERIFICATION"`                 // optional, sensitive or login
+	EmailVerificationTokenExpiry    int               `mapstructure:"EMAIL_VERIFICATION_TOKEN_EXPIRY"`    // in hours
+	EmailVerificationResendInterval int               `mapstructure:"EMAIL_VERIFICATION_RESEND_INTERVAL"` // in minutes
+
+	// Email changes are confirmed from the new address and can be reverted
+	// from the old one
+	EmailChangeTokenExpiry  int `mapstructure:"EMAIL_CHANGE_TOKEN_EXPIRY"`  // in hours
+	EmailChangeRevertExpiry int `mapstructure:"EMAIL_CHANGE_REVERT_EXPIRY"` // in hours
+
+	// Magic links sign users in from an emailed link. Bound links only work
+	// for the client that asked for them.
+	MagicLinkTokenExpiry int  `mapstructure:"MAGIC_LINK_TOKEN_EXPIRY"` // in minutes
+	MagicLinkBindBrowser bool `mapstructure:"MAGIC_LINK_BIND_BROWSER"`
 
 	// Password reset configuration
 	PasswordResetTokenExpiry int    `mapstructure:"PASSWORD_RESET_TOKEN_EXPIRY"` // in hours
 	AppURL                   string `mapstructure:"APP_URL"`
 
-	// Rate limiting
-	RateLimitRequests int `mapstructure:"RATE_LIMIT_REQUESTS"` // requests per minute
-	RateLimitBurst    int `mapstructure:"RATE_LIMIT_BURST"`    // burst size
+	// Rate limiting. Each policy allows its requests per minute on average
+	// and bursts of up to its burst size per client. Reads count against the
+	// read policy and other requests against the default one; sign-in and
+	// account recovery also count against the auth policy, token refreshes
+	// against the token policy, and authenticated requests against the user
+	// policy per user or API key.
+	RateLimitRequests      int `mapstructure:"RATE_LIMIT_REQUESTS"` // requests per minute
+	RateLimitBurst         int `mapstructure:"RATE_LIMIT_BURST"`    // burst size
+	RateLimitReadRequests  int `mapstructure:"RATE_LIMIT_READ_REQUESTS"`
+	RateLimitReadBurst     int `mapstructure:"RATE_LIMIT_READ_BURST"`
+	RateLimitAuthRequests  int `mapstructure:"RATE_LIMIT_AUTH_REQUESTS"`
+	RateLimitAuthBurst     int `mapstructure:"RATE_LIMIT_AUTH_BURST"`
+	RateLimitTokenRequests int `mapstructure:"RATE_LIMIT_TOKEN_REQUESTS"`
+	RateLimitTokenBurst    int `mapstructure:"RATE_LIMIT_TOKEN_BURST"`
+	RateLimitUserRequests  int `mapstructure:"RATE_LIMIT_USER_REQUESTS"`
+	RateLimitUserBurst     int `mapstructure:"RATE_LIMIT_USER_BURST"`
+	RateLimitMaxKeys       int `mapstructure:"RATE_LIMIT_MAX_KEYS"` // clients tracked in memory
+
+	// Rate limit counters are kept in memory, or in Redis at REDIS_URL so
+	// that every replica shares them. While Redis is unreachable requests
+	// are limited in memory, trying Redis again every fallback retry.
+	RateLimitStore         RateLimitStore `mapstructure:"RATE_LIMIT_STORE"`
+	RateLimitFallbackRetry int            `mapstructure:"RATE_LIMIT_FALLBACK_RETRY"` // in seconds
+
+	// Login lockout: after the threshold of failed logins an account or client
+	// IP is locked, for twice as long with every further failure
+	LockoutThreshold   int `mapstructure:"LOCKOUT_THRESHOLD"`    // failed logins per account
+	LockoutIPThreshold int `mapstructure:"LOCKOUT_IP_THRESHOLD"` // failed logins per client IP
+	LockoutDuration    int `mapstructure:"LOCKOUT_DURATION"`     // first lockout, in minutes
+	LockoutMaxDuration int `mapstructure:"LOCKOUT_MAX_DURATION"` // in minutes
+	LockoutWindow      int `mapstructure:"LOCKOUT_WINDOW"`       // quiet period before failures are forgotten, in minutes
+}
+
+// OIDCProvider is an external identity provider users can sign in with
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients
+	RedirectURL  string
+	Scopes       []string
 }
 
 func Load() *Config {
@@ -74,8 +230,14 @@ func Load() *Config {
 		panic(err)
 	}
 
+	if err := applySMTPTLS(&cfg); err != nil {
+		slog.Error("invalid configuration", "error", err)
+		panic(err)
+	}
+
 	// Set defaults
 	setDefaults(&cfg)
+	loadOIDCProviders(&cfg)
 
 	// Validate configuration
 	if err := validateConfig(&cfg); err != nil {
@@ -86,6 +248,25 @@ func Load() *Config {
 	return &cfg
 }
 
+// applySMTPTLS honours SMTP_TLS, which SMTP_SECURITY replaced: true meant
+// implicit TLS and false a plain connection. It is read through viper so an
+// environment variable counts even though app.env no longer lists the key.
+func applySMTPTLS(cfg *Config) error {
+	if !viper.IsSet("SMTP_TLS") {
+		return nil
+	}
+	security := "none"
+	if viper.GetBool("SMTP_TLS") {
+		security = "tls"
+	}
+	if cfg.SMTPSecurity != "" && cfg.SMTPSecurity != security {
+		return fmt.Errorf("SMTP_TLS is deprecated and conflicts with SMTP_SECURITY=%s; remove SMTP_TLS", cfg.SMTPSecurity)
+	}
+	slog.Warn("SMTP_TLS is deprecated, use SMTP_SECURITY", "smtp_security", security)
+	cfg.SMTPSecurity = security
+	return nil
+}
+
 func setDefaults(cfg *Config) {
 	if cfg.Environment == "" {
 		cfg.Environment = Development
@@ -105,8 +286,9 @@ func setDefaults(cfg *Config) {
 	if cfg.RedisURL == "" {
 		cfg.RedisURL = "redis://localhost:6379"
 	}
-	if cfg.JWTSecret == "" {
-		cfg.JWTSecret = "a-very-secret-key-change-in-production"
+	cfg.ClientIPHeader = strings.ToLower(cfg.ClientIPHeader)
+	if cfg.ClientIPHeader == "" {
+		cfg.ClientIPHeader = "x-forwarded-for"
 	}
 	if cfg.LogLevel == "" {
 		cfg.LogLevel = "info"
@@ -115,18 +297,153 @@ func setDefaults(cfg *Config) {
 		cfg.CORSOrigins = []string{"http://localhost:5173", "http://localhost:3000"}
 	}
 
-	// Email defaults
-	if cfg.SMTPHost == "" {
-		cfg.SMTPHost = "localhost"
+	// Token lifetime defaults
+	if cfg.AccessTokenExpiry == 0 {
+		cfg.AccessTokenExpiry = 15 // 15 minutes
+	}
+	if cfg.RefreshTokenExpiry == 0 {
+		cfg.RefreshTokenExpiry = 720 // 30 days
+	}
+
+	// Signing key defaults
+	if cfg.JWTAlgorithm == "" {
+		cfg.JWTAlgorithm = "EdDSA"
+	}
+	if !viper.IsSet("JWT_KEY_ROTATION") {
+		cfg.JWTKeyRotation = 720 // 30 days
+	}
+	if cfg.JWTKeyGracePeriod == 0 {
+		cfg.JWTKeyGracePeriod = 60 // 1 hour
+	}
+
+	// API key defaults
+	if !viper.IsSet("API_KEY_MAX_EXPIRY") {
+		cfg.APIKeyMaxExpiry = 365 // 1 year
+	}
+
+	// Password hashing defaults, following the OWASP recommendations
+	if cfg.PasswordHash == "" {
+		cfg.PasswordHash = "argon2id"
+	}
+	if cfg.Argon2Memory == 0 {
+		cfg.Argon2Memory = 19456 // 19 MiB
+	}
+	if cfg.Argon2Iterations == 0 {
+		cfg.Argon2Iterations = 2
+	}
+	if cfg.Argon2Parallelism == 0 {
+		cfg.Argon2Parallelism = 1
+	}
+	if cfg.BcryptCost == 0 {
+		cfg.BcryptCost = 10
+	}
+
+	// Password policy defaults
+	if cfg.PasswordMinLength == 0 {
+		cfg.PasswordMinLength = 8
+	}
+	if !viper.IsSet("PASSWORD_MIN_STRENGTH") {
+		cfg.PasswordMinStrength = 2
+	}
+	if !viper.IsSet("PASSWORD_REJECT_USER_INFO") {
+		cfg.PasswordRejectUserInfo = true
+	}
+	if !viper.IsSet("PASSWORD_HISTORY") {
+		cfg.PasswordHistory = 5
+	}
+
+	// Two-factor defaults
+	if cfg.MFAIssuer == "" {
+		cfg.MFAIssuer = "Votex"
+	}
+	if cfg.MFATokenExpiry == 0 {
+		cfg.MFATokenExpiry = 5 // 5 minutes
+	}
+	if cfg.MFAMaxAttempts == 0 {
+		cfg.MFAMaxAttempts = 3
+	}
+
+	// Email defaults; without an SMTP server emails are only logged
+	if cfg.EmailTransport == "" {
+		cfg.EmailTransport = "log"
+		if cfg.SMTPHost != "" {
+			cfg.EmailTransport = "smtp"
+		}
+	}
+	if cfg.EmailTimeout == 0 {
+		cfg.EmailTimeout = 30 // 30 seconds
+	}
+	if cfg.SMTPSecurity == "" {
+		cfg.SMTPSecurity = "starttls"
 	}
 	if cfg.SMTPPort == 0 {
-		cfg.SMTPPort = 587
+		switch cfg.SMTPSecurity {
+		case "tls":
+			cfg.SMTPPort = 465
+		case "none":
+			cfg.SMTPPort = 25
+		default:
+			cfg.SMTPPort = 587
+		}
 	}
 	if cfg.SMTPFrom == "" {
 		cfg.SMTPFrom = "noreply@vortex.com"
 	}
-	if !cfg.SMTPTLS {
-		cfg.SMTPTLS = true // Default to TLS for security
+	if cfg.EmailFileDir == "" {
+		cfg.EmailFileDir = "./data/mail"
+	}
+	if cfg.EmailFileFormat == "" {
+		cfg.EmailFileFormat = "eml"
+	}
+
+	if cfg.DKIMDomain == "" && cfg.DKIMKeyFile != "" {
+		if at := strings.LastIndexByte(cfg.SMTPFrom, '@'); at >= 0 {
+			cfg.DKIMDomain = strings.TrimSuffix(cfg.SMTPFrom[at+1:], ">")
+		}
+	}
+
+	// Email queue defaults
+	if !viper.IsSet("EMAIL_QUEUE_WORKERS") {
+		cfg.EmailQueueWorkers = 2
+	}
+	if cfg.EmailQueuePollInterval == 0 {
+		cfg.EmailQueuePollInterval = 5 // 5 seconds
+	}
+	if !viper.IsSet("EMAIL_QUEUE_DRAIN_TIMEOUT") {
+		cfg.EmailQueueDrainTimeout = 10 // 10 seconds
+	}
+	if cfg.EmailMaxAttempts == 0 {
+		cfg.EmailMaxAttempts = 8
+	}
+	if cfg.EmailRetryBaseDelay == 0 {
+		cfg.EmailRetryBaseDelay = 30 // 30 seconds
+	}
+	if cfg.EmailRetryMaxDelay == 0 {
+		cfg.EmailRetryMaxDelay = 3600 // 1 hour
+	}
+
+	// Email verification defaults
+	if cfg.EmailVerification == "" {
+		cfg.EmailVerification = VerifyEmailOptional
+	}
+	if cfg.EmailVerificationTokenExpiry == 0 {
+		cfg.EmailVerificationTokenExpiry = 48 // 2 days
+	}
+	if cfg.EmailVerificationResendInterval == 0 {
+		cfg.EmailVerificationResendInterval = 5 // 5 minutes
+	}
+
+	// Email change defaults
+	if cfg.EmailChangeTokenExpiry == 0 {
+		cfg.EmailChangeTokenExpiry = 24 // 24 hours
+	}
+	if cfg.EmailChangeRevertExpiry == 0 {
+		cfg.EmailChangeRevertExpiry = 168 // 7 days
+	}
+
+	// Magic link defaults
+	if cfg.MagicLinkTokenExpiry == 0 {
+		cfg.MagicLinkTokenExpiry = 15 // 15 minutes
 	}
 
 	// Password reset defaults
@@ -137,6 +454,26 @@ func setDefaults(cfg *Config) {
 		cfg.AppURL = "http://localhost:5173"
 	}
 
+	// Passkey defaults
+	if cfg.WebAuthnRPID == "" {
+		cfg.WebAuthnRPID = "localhost"
+	}
+	if cfg.WebAuthnRPName == "" {
+		cfg.WebAuthnRPName = "Votex"
+	}
+	if len(cfg.WebAuthnOrigins) == 0 {
+		cfg.WebAuthnOrigins = []string{cfg.AppURL}
+	}
+	if cfg.WebAuthnTimeout == 0 {
+		cfg.WebAuthnTimeout = 5 // 5 minutes
+	}
+
+	// Identity provider defaults
+	cfg.IDPIssuer = strings.TrimSuffix(cfg.IDPIssuer, "/")
+	if cfg.IDPAuthorizeURL == "" {
+		cfg.IDPAuthorizeURL = strings.TrimSuffix(cfg.AppURL, "/") + "/oauth/authorize"
+	}
+
 	// Rate limiting defaults
 	if cfg.RateLimitRequests == 0 {
 		cfg.RateLimitRequests = 100 // 100 requests per minute
@@ -144,13 +481,86 @@ func setDefaults(cfg *Config) {
 	if cfg.RateLimitBurst == 0 {
 		cfg.RateLimitBurst = 20 // burst of 20 requests
 	}
+	if cfg.RateLimitReadRequests == 0 {
+		cfg.RateLimitReadRequests = 300
+	}
+	if cfg.RateLimitReadBurst == 0 {
+		cfg.RateLimitReadBurst = 60
+	}
+	if cfg.RateLimitAuthRequests == 0 {
+		cfg.RateLimitAuthRequests = 10
+	}
+	if cfg.RateLimitAuthBurst == 0 {
+		cfg.RateLimitAuthBurst = 5
+	}
+	if cfg.RateLimitTokenRequests == 0 {
+		cfg.RateLimitTokenRequests = 30
+	}
+	if cfg.RateLimitTokenBurst == 0 {
+		cfg.RateLimitTokenBurst = 10
+	}
+	if cfg.RateLimitUserRequests == 0 {
+		cfg.RateLimitUserRequests = 600
+	}
+	if cfg.RateLimitUserBurst == 0 {
+		cfg.RateLimitUserBurst = 100
+	}
+	if cfg.RateLimitMaxKeys == 0 {
+		cfg.RateLimitMaxKeys = 100000
+	}
+	if cfg.RateLimitStore == "" {
+		cfg.RateLimitStore = RateLimitStoreMemory
+	}
+	if cfg.RateLimitFallbackRetry == 0 {
+		cfg.RateLimitFallbackRetry = 30
+	}
+
+	// Login lockout defaults
+	if cfg.LockoutThreshold == 0 {
+		cfg.LockoutThreshold = 5
+	}
+	if cfg.LockoutIPThreshold == 0 {
+		cfg.LockoutIPThreshold = 20
+	}
+	if cfg.LockoutDuration == 0 {
+		cfg.LockoutDuration = 5 // 5 minutes
+	}
+	if cfg.LockoutMaxDuration == 0 {
+		cfg.LockoutMaxDuration = 1440 // 24 hours
+	}
+	if cfg.LockoutWindow == 0 {
+		cfg.LockoutWindow = 60 // 1 hour
+	}
 }
 
-func validateConfig(cfg *Config) error {
-	if cfg.JWTSecret == "a-very-secret-key-change-in-production" && cfg.Environment == Production {
-		return fmt.Errorf("JWT_SECRET must be set in production environment")
+// loadOIDCProviders reads OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET,
+// _REDIRECT_URL and _SCOPES for every provider named in OIDC_PROVIDERS. The
+// redirect URL defaults to the frontend callback route for the provider.
+func loadOIDCProviders(cfg *Config) {
+	cfg.OIDCProviders = nil
+	for _, name := range cfg.OIDCProviderNames {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		provider := OIDCProvider{
+			Name:         name,
+			Issuer:       viper.GetString(prefix + "ISSUER"),
+			ClientID:     viper.GetString(prefix + "CLIENT_ID"),
+			ClientSecret: viper.GetString(prefix + "CLIENT_SECRET"),
+			RedirectURL:  viper.GetString(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(strings.ReplaceAll(viper.GetString(prefix+"SCOPES"), ",", " ")),
+		}
+		if provider.RedirectURL == "" {
+			provider.RedirectURL = strings.TrimSuffix(cfg.AppURL, "/") + "/auth/callback/" + name
+		}
+		cfg.OIDCProviders = append(cfg.OIDCProviders, provider)
 	}
+}
 
+func validateConfig(cfg *Config) error {
 	if cfg.DBURL == "" && cfg.DBType == PostgreSQL {
 		return fmt.Errorf("DB_URL is required for PostgreSQL")
 	}
@@ -159,9 +569,174 @@ func validateConfig(cfg *Config) error {
 		return fmt.Errorf("SQLITE_PATH is required for SQLite")
 	}
 
+	if _, err := clientip.ParsePrefixes(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	switch cfg.ClientIPHeader {
+	case "x-forwarded-for", "forwarded":
+	default:
+		return fmt.Errorf("CLIENT_IP_HEADER must be x-forwarded-for or forwarded")
+	}
+
+	for _, provider := range cfg.OIDCProviders {
+		if provider.Issuer == "" || provider.ClientID == "" {
+			return fmt.Errorf("OIDC provider %q needs an issuer and a client id", provider.Name)
+		}
+	}
+
+	switch cfg.JWTAlgorithm {
+	case "EdDSA", "RS256", "ES256":
+	default:
+		return fmt.Errorf("JWT_ALGORITHM must be EdDSA, RS256 or ES256")
+	}
+
+	if cfg.JWTKeyGracePeriod < cfg.AccessTokenExpiry {
+		return fmt.Errorf("JWT_KEY_GRACE_PERIOD must be at least ACCESS_TOKEN_EXPIRY")
+	}
+
+	if cfg.APIKeyMaxExpiry < 0 {
+		return fmt.Errorf("API_KEY_MAX_EXPIRY must not be negative")
+	}
+
+	switch cfg.PasswordHash {
+	case "argon2id", "bcrypt":
+	default:
+		return fmt.Errorf("PASSWORD_HASH must be argon2id or bcrypt")
+	}
+	if cfg.Argon2Memory < 8*cfg.Argon2Parallelism || cfg.Argon2Iterations < 1 || cfg.Argon2Parallelism < 1 || cfg.Argon2Parallelism > 255 {
+		return fmt.Errorf("ARGON2_MEMORY, ARGON2_ITERATIONS and ARGON2_PARALLELISM are out of range")
+	}
+	if cfg.BcryptCost < 4 || cfg.BcryptCost > 31 {
+		return fmt.Errorf("BCRYPT_COST must be between 4 and 31")
+	}
+
+	if cfg.PasswordMinLength < 8 || cfg.PasswordMinLength > 1024 {
+		return fmt.Errorf("PASSWORD_MIN_LENGTH must be between 8 and 1024")
+	}
+	if cfg.PasswordMinClasses < 0 || cfg.PasswordMinClasses > 4 {
+		return fmt.Errorf("PASSWORD_MIN_CLASSES must be between 0 and 4")
+	}
+	if cfg.PasswordMinStrength < 0 || cfg.PasswordMinStrength > 4 {
+		return fmt.Errorf("PASSWORD_MIN_STRENGTH must be between 0 and 4")
+	}
+	if cfg.PasswordHistory < 0 {
+		return fmt.Errorf("PASSWORD_HISTORY must not be negative")
+	}
+
+	switch cfg.EmailTransport {
+	case "log", "file":
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return fmt.Errorf("SMTP_HOST is required for the smtp email transport")
+		}
+	case "http":
+		if cfg.EmailAPIURL == "" {
+			return fmt.Errorf("EMAIL_API_URL is required for the http email transport")
+		}
+	default:
+		return fmt.Errorf("EMAIL_TRANSPORT must be log, file, smtp or http")
+	}
+	switch cfg.SMTPSecurity {
+	case "starttls", "tls", "none":
+	default:
+		return fmt.Errorf("SMTP_SECURITY must be starttls, tls or none")
+	}
+	switch cfg.EmailFileFormat {
+	case "eml", "maildir":
+	default:
+		return fmt.Errorf("EMAIL_FILE_FORMAT must be eml or maildir")
+	}
+	if cfg.EmailTimeout < 1 {
+		return fmt.Errorf("EMAIL_TIMEOUT must be positive")
+	}
+	if cfg.DKIMKeyFile != "" {
+		if cfg.DKIMSelector == "" || cfg.DKIMDomain == "" {
+			return fmt.Errorf("DKIM_SELECTOR and DKIM_DOMAIN are required with DKIM_KEY_FILE")
+		}
+		if cfg.EmailTransport == "http" {
+			return fmt.Errorf("DKIM_KEY_FILE cannot be used with the http email transport; the provider signs")
+		}
+		if len(cfg.DKIMHeaders) > 0 && !slices.ContainsFunc(cfg.DKIMHeaders, func(h string) bool { return strings.EqualFold(h, "From") }) {
+			return fmt.Errorf("DKIM_HEADERS must include From")
+		}
+	}
+	if cfg.EmailQueueWorkers < 0 {
+		return fmt.Errorf("EMAIL_QUEUE_WORKERS must not be negative")
+	}
+	if cfg.EmailQueuePollInterval < 1 {
+		return fmt.Errorf("EMAIL_QUEUE_POLL_INTERVAL must be positive")
+	}
+	if cfg.EmailQueueDrainTimeout < 0 {
+		return fmt.Errorf("EMAIL_QUEUE_DRAIN_TIMEOUT must not be negative")
+	}
+	if cfg.EmailMaxAttempts < 1 {
+		return fmt.Errorf("EMAIL_MAX_ATTEMPTS must be positive")
+	}
+	if cfg.EmailRetryBaseDelay < 1 || cfg.EmailRetryMaxDelay < cfg.EmailRetryBaseDelay {
+		return fmt.Errorf("EMAIL_RETRY_BASE_DELAY must be positive and no longer than EMAIL_RETRY_MAX_DELAY")
+	}
+
+	switch cfg.EmailVerification {
+	case VerifyEmailOptional, VerifyEmailSensitive, VerifyEmailLogin:
+	default:
+		return fmt.Errorf("EMAIL_VERIFICATION must be optional, sensitive or login")
+	}
+
+	if cfg.EmailChangeRevertExpiry < cfg.EmailChangeTokenExpiry {
+		return fmt.Errorf("EMAIL_CHANGE_REVERT_EXPIRY must be at least EMAIL_CHANGE_TOKEN_EXPIRY")
+	}
+
+	if cfg.MagicLinkTokenExpiry < 1 {
+		return fmt.Errorf("MAGIC_LINK_TOKEN_EXPIRY must be positive")
+	}
+
+	switch cfg.RateLimitStore {
+	case RateLimitStoreMemory, RateLimitStoreRedis:
+	default:
+		return fmt.Errorf("RATE_LIMIT_STORE must be memory or redis")
+	}
+	for name, value := range map[string]int{
+		"RATE_LIMIT_REQUESTS":       cfg.RateLimitRequests,
+		"RATE_LIMIT_BURST":          cfg.RateLimitBurst,
+		"RATE_LIMIT_READ_REQUESTS":  cfg.RateLimitReadRequests,
+		"RATE_LIMIT_READ_BURST":     cfg.RateLimitReadBurst,
+		"RATE_LIMIT_AUTH_REQUESTS":  cfg.RateLimitAuthRequests,
+		"RATE_LIMIT_AUTH_BURST":     cfg.RateLimitAuthBurst,
+		"RATE_LIMIT_TOKEN_REQUESTS": cfg.RateLimitTokenRequests,
+		"RATE_LIMIT_TOKEN_BURST":    cfg.RateLimitTokenBurst,
+		"RATE_LIMIT_USER_REQUESTS":  cfg.RateLimitUserRequests,
+		"RATE_LIMIT_USER_BURST":     cfg.RateLimitUserBurst,
+		"RATE_LIMIT_MAX_KEYS":       cfg.RateLimitMaxKeys,
+		"RATE_LIMIT_FALLBACK_RETRY": cfg.RateLimitFallbackRetry,
+	} {
+		if value < 1 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+
+	if cfg.MFAMaxAttempts < 1 {
+		return fmt.Errorf("MFA_MAX_ATTEMPTS must be positive")
+	}
+
+	if cfg.LockoutThreshold < 1 || cfg.LockoutIPThreshold < 1 {
+		return fmt.Errorf("LOCKOUT_THRESHOLD and LOCKOUT_IP_THRESHOLD must be positive")
+	}
+	if cfg.LockoutDuration < 1 || cfg.LockoutMaxDuration < cfg.LockoutDuration {
+		return fmt.Errorf("LOCKOUT_DURATION must be positive and at most LOCKOUT_MAX_DURATION")
+	}
+	if cfg.LockoutWindow < 1 {
+		return fmt.Errorf("LOCKOUT_WINDOW must be positive")
+	}
+
 	return nil
 }
 
+// EmailVerificationEnforced reports whether an unverified email address
+// blocks anything
+func (c *Config) EmailVerificationEnforced() bool {
+	return c.EmailVerification == VerifyEmailSensitive || c.EmailVerification == VerifyEmailLogin
+}
+
 func (c *Config) IsDevelopment() bool {
 	return c.Environment == Development
 }
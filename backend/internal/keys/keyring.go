@@ -0,0 +1,368 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/jwk"
+)
+
+const (
+	// PublishDelay is how long a rotated in key is only published before it
+	// starts signing, so verifiers holding a cached JWKS fetch it first. The
+	// JWKS endpoint must not be cached for longer.
+	PublishDelay = 5 * time.Minute
+
+	// refreshInterval is how often Run reloads keys and checks for rotation
+	refreshInterval = time.Minute
+	// reloadBackoff limits how often an unknown kid triggers a reload
+	reloadBackoff = 10 * time.Second
+)
+
+var (
+	ErrNoSigningKey = errors.New("no signing key available")
+	ErrUnknownKey   = errors.New("token signed with an unknown key")
+)
+
+// Keyring signs tokens with its current key and verifies them with any key
+// that has not expired. Keys come either from PEM files, which are rotated by
+// replacing the files, or from the signing_key table, where the keyring
+// generates and rotates keys itself.
+type Keyring struct {
+	mu       sync.RWMutex
+	keys     []*Key // newest first
+	loadedAt time.Time
+
+	store       store.StoreInterface // nil when keys come from files
+	algorithm   string
+	rotateEvery time.Duration // zero disables scheduled rotation
+	grace       time.Duration // how long a rotated out key keeps verifying
+	now         func() time.Time
+}
+
+// New builds the keyring described by the configuration
+func New(ctx context.Context, cfg *config.Config, s store.StoreInterface) (*Keyring, error) {
+	if len(cfg.JWTKeyFiles) > 0 {
+		return LoadFiles(cfg.JWTKeyFiles)
+	}
+	return NewStoreKeyring(ctx, s, cfg.JWTAlgorithm,
+		time.Duration(cfg.JWTKeyRotation)*time.Hour,
+		time.Duration(cfg.JWTKeyGracePeriod)*time.Minute)
+}
+
+// NewStatic returns a keyring that signs with the first key and verifies
+// with all of them
+func NewStatic(keys ...*Key) *Keyring {
+	return &Keyring{keys: keys, now: time.Now}
+}
+
+// LoadFiles reads PEM private keys. The first file holds the signing key;
+// the others only verify, which lets a replaced key keep verifying tokens
+// until they expire.
+func LoadFiles(paths []string) (*Keyring, error) {
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+		key, err := ParsePEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoSigningKey
+	}
+	return NewStatic(keys...), nil
+}
+
+// NewStoreKeyring loads keys from the store, generating the first key with
+// the given algorithm when there is none
+func NewStoreKeyring(ctx context.Context, s store.StoreInterface, algorithm string, rotateEvery, grace time.Duration) (*Keyring, error) {
+	r := &Keyring{
+		store:       s,
+		algorithm:   algorithm,
+		rotateEvery: rotateEvery,
+		grace:       grace,
+		now:         time.Now,
+	}
+	if err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Sign returns a compact JWS of the claims with kid and typ headers
+func (r *Keyring) Sign(claims jwt.Claims, typ string) (string, error) {
+	key, err := r.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	token.Header["typ"] = typ
+	return token.SignedString(key.Private)
+}
+
+// Keyfunc resolves the verification key for a token by its kid header. It is
+// meant for jwt.Parse together with Algorithms.
+func (r *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key := r.lookup(kid)
+	if key == nil && r.reloadable() {
+		// Another instance may have rotated in a key we have not loaded yet
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.reload(ctx); err != nil {
+			slog.Warn("Failed to reload signing keys", "error", err)
+		}
+		key = r.lookup(kid)
+	}
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+	if key.Method.Alg() != token.Method.Alg() {
+		return nil, fmt.Errorf("key %q is for %s, not %s", kid, key.Method.Alg(), token.Method.Alg())
+	}
+	return key.Private.Public(), nil
+}
+
+// Algorithms returns the algorithms of the keys that still verify
+func (r *Keyring) Algorithms() []string {
+	var algorithms []string
+	for _, key := range r.activeKeys() {
+		alg := key.Method.Alg()
+		if !containsString(algorithms, alg) {
+			algorithms = append(algorithms, alg)
+		}
+	}
+	return algorithms
+}
+
+// JWKS returns the public keys that still verify, including a rotated in
+// key that has not started signing yet
+func (r *Keyring) JWKS() *jwk.Set {
+	active := r.activeKeys()
+	set := &jwk.Set{Keys: make([]jwk.Key, 0, len(active))}
+	for _, key := range active {
+		set.Keys = append(set.Keys, key.Public())
+	}
+	return set
+}
+
+// Refresh reloads keys from the store, rotates when the current key is due
+// and deletes expired keys. It does nothing for file based keyrings.
+func (r *Keyring) Refresh(ctx context.Context) error {
+	if r.store == nil {
+		return nil
+	}
+
+	if err := r.reload(ctx); err != nil {
+		return err
+	}
+	if r.rotationDue() {
+		if err := r.rotate(ctx, false); err != nil {
+			return err
+		}
+	}
+	if err := r.store.DeleteExpiredSigningKeys(ctx); err != nil {
+		slog.Warn("Failed to delete expired signing keys", "error", err)
+	}
+	return nil
+}
+
+// Rotate generates a new key and retires the current one. The new key
+// starts signing after PublishDelay; the old one verifies for the grace
+// period after that.
+func (r *Keyring) Rotate(ctx context.Context) error {
+	if r.store == nil {
+		return errors.New("file based signing keys are rotated by replacing the key files")
+	}
+	return r.rotate(ctx, true)
+}
+
+// Run refreshes the keyring every minute until ctx is cancelled
+func (r *Keyring) Run(ctx context.Context) {
+	if r.store == nil {
+		return
+	}
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Refresh(ctx); err != nil {
+				slog.Error("Failed to refresh signing keys", "error", err)
+			}
+		}
+	}
+}
+
+// signingKey returns the newest key that has been published for at least
+// PublishDelay. Right after the first key is created no key is that old, so
+// the newest key signs.
+func (r *Keyring) signingKey() (*Key, error) {
+	now := r.now()
+	var newest *Key
+	for _, key := range r.activeKeys() {
+		if newest == nil {
+			newest = key
+		}
+		if r.store == nil || !now.Before(key.CreatedAt.Add(PublishDelay)) {
+			return key, nil
+		}
+	}
+	if newest == nil {
+		return nil, ErrNoSigningKey
+	}
+	return newest, nil
+}
+
+func (r *Keyring) lookup(kid string) *Key {
+	for _, key := range r.activeKeys() {
+		if key.ID == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+func (r *Keyring) activeKeys() []*Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.now()
+	active := make([]*Key, 0, len(r.keys))
+	for _, key := range r.keys {
+		if !key.expired(now) {
+			active = append(active, key)
+		}
+	}
+	return active
+}
+
+func (r *Keyring) reloadable() bool {
+	if r.store == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.now().Sub(r.loadedAt) >= reloadBackoff
+}
+
+// rotationDue reports whether there is no key in service or the newest one
+// is older than the rotation interval
+func (r *Keyring) rotationDue() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return rotationDue(r.keys, r.now(), r.rotateEvery)
+}
+
+func rotationDue(keys []*Key, now time.Time, rotateEvery time.Duration) bool {
+	for _, key := range keys {
+		if key.ExpiresAt == nil {
+			return rotateEvery > 0 && !now.Before(key.CreatedAt.Add(rotateEvery))
+		}
+	}
+	return true
+}
+
+func (r *Keyring) reload(ctx context.Context) error {
+	rows, err := r.store.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*Key, 0, len(rows))
+	for _, row := range rows {
+		key, err := ParsePEM([]byte(row.PrivateKey))
+		if err != nil {
+			slog.Error("Skipping unreadable signing key", "kid", row.ID, "error", err)
+			continue
+		}
+		key.ID = row.ID
+		key.CreatedAt = row.CreatedAt
+		key.ExpiresAt = row.ExpiresAt
+		keys = append(keys, key)
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.loadedAt = r.now()
+	r.mu.Unlock()
+	return nil
+}
+
+// rotate adds a key inside a transaction. Unless forced it first checks the
+// rotation is still due, so instances sharing the table rotate only once.
+func (r *Keyring) rotate(ctx context.Context, force bool) error {
+	key, err := GenerateKey(r.algorithm)
+	if err != nil {
+		return err
+	}
+	now := r.now()
+	key.CreatedAt = now
+	private, err := key.MarshalPEM()
+	if err != nil {
+		return err
+	}
+
+	rotated := false
+	err = r.store.WithTx(ctx, func(tx store.StoreInterface) error {
+		if !force {
+			rows, err := tx.ListSigningKeys(ctx)
+			if err != nil {
+				return err
+			}
+			current := make([]*Key, 0, len(rows))
+			for _, row := range rows {
+				current = append(current, &Key{CreatedAt: row.CreatedAt, ExpiresAt: row.ExpiresAt})
+			}
+			if !rotationDue(current, now, r.rotateEvery) {
+				return nil
+			}
+		}
+
+		if err := tx.CreateSigningKey(ctx, &store.SigningKey{
+			ID:         key.ID,
+			Algorithm:  key.Method.Alg(),
+			PrivateKey: private,
+			CreatedAt:  now,
+		}); err != nil {
+			return err
+		}
+		rotated = true
+		return tx.RetireSigningKeys(ctx, key.ID, now.Add(PublishDelay+r.grace))
+	})
+	if err != nil {
+		return err
+	}
+
+	if rotated {
+		slog.Info("Rotated token signing key", "kid", key.ID, "algorithm", key.Method.Alg())
+	}
+	return r.reload(ctx)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
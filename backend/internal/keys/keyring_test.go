@@ -0,0 +1,139 @@
+package keys
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/votex-template/backend/internal/store"
+)
+
+// setupStore opens an in-memory SQLite database with every SQLite migration applied
+func setupStore(t *testing.T) *store.Store {
+	t.Helper()
+
+	db, err := sqlx.Connect("sqlite", ":memory:")
+	require.NoError(t, err)
+	// Each connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob("../../migrations/sqlite/*.up.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		require.NoError(t, err)
+		_, err = db.Exec(string(migration))
+		require.NoError(t, err, file)
+	}
+
+	return store.New(db, true)
+}
+
+// fakeClock is a settable replacement for time.Now
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func signedKid(t *testing.T, r *Keyring) string {
+	t.Helper()
+	signed, err := r.Sign(jwt.MapClaims{"sub": "1"}, "JWT")
+	require.NoError(t, err)
+	token, _, err := jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+	require.NoError(t, err)
+	return token.Header["kid"].(string)
+}
+
+func verifies(r *Keyring, signer *Keyring) bool {
+	signed, err := signer.Sign(jwt.MapClaims{"sub": "1"}, "JWT")
+	if err != nil {
+		return false
+	}
+	_, err = jwt.Parse(signed, r.Keyfunc, jwt.WithValidMethods(r.Algorithms()))
+	return err == nil
+}
+
+func TestStoreKeyring_Rotation(t *testing.T) {
+	ctx := context.Background()
+	s := setupStore(t)
+	clock := &fakeClock{now: time.Now().UTC().Truncate(time.Second)}
+
+	keyring := &Keyring{store: s, algorithm: ES256, rotateEvery: 24 * time.Hour, grace: time.Hour, now: clock.Now}
+	require.NoError(t, keyring.Refresh(ctx))
+
+	// The first key is created on startup and signs right away
+	first := signedKid(t, keyring)
+	assert.Len(t, keyring.JWKS().Keys, 1)
+	assert.Equal(t, []string{"ES256"}, keyring.Algorithms())
+
+	// Nothing happens before the rotation interval
+	clock.Advance(23 * time.Hour)
+	require.NoError(t, keyring.Refresh(ctx))
+	assert.Len(t, keyring.JWKS().Keys, 1)
+
+	// After it a new key is published but the old one keeps signing until
+	// verifiers had time to fetch the JWKS
+	clock.Advance(2 * time.Hour)
+	require.NoError(t, keyring.Refresh(ctx))
+	jwks := keyring.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	second := jwks.Keys[0].KeyID
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, first, signedKid(t, keyring))
+
+	clock.Advance(PublishDelay)
+	assert.Equal(t, second, signedKid(t, keyring))
+
+	// A second instance sharing the table loads the new key instead of
+	// rotating again
+	other := &Keyring{store: s, algorithm: ES256, rotateEvery: 24 * time.Hour, grace: time.Hour, now: clock.Now}
+	require.NoError(t, other.Refresh(ctx))
+	assert.Len(t, other.JWKS().Keys, 2)
+	assert.True(t, verifies(other, keyring))
+
+	// The old key stops verifying once the grace period is over
+	clock.Advance(time.Hour)
+	require.NoError(t, keyring.Refresh(ctx))
+	jwks = keyring.JWKS()
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, second, jwks.Keys[0].KeyID)
+}
+
+func TestStoreKeyring_UnknownKidReloads(t *testing.T) {
+	ctx := context.Background()
+	s := setupStore(t)
+	clock := &fakeClock{now: time.Now().UTC().Truncate(time.Second)}
+
+	a := &Keyring{store: s, algorithm: EdDSA, grace: time.Hour, now: clock.Now}
+	require.NoError(t, a.Refresh(ctx))
+	b := &Keyring{store: s, algorithm: EdDSA, grace: time.Hour, now: clock.Now}
+	require.NoError(t, b.Refresh(ctx))
+
+	// b rotates; a only learns about the new key when it sees it in a token
+	clock.Advance(time.Hour)
+	require.NoError(t, b.Rotate(ctx))
+	clock.Advance(PublishDelay)
+	assert.True(t, verifies(a, b))
+
+	// Rotation is disabled, so refreshing does not add keys
+	require.NoError(t, a.Refresh(ctx))
+	assert.Len(t, a.JWKS().Keys, 2)
+}
+
+func TestStaticKeyring_CannotRotate(t *testing.T) {
+	key, _ := GenerateKey(EdDSA)
+	keyring := NewStatic(key)
+	assert.NoError(t, keyring.Refresh(context.Background()))
+	assert.Error(t, keyring.Rotate(context.Background()))
+	assert.Equal(t, key.ID, signedKid(t, keyring))
+}
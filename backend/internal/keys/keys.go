@@ -0,0 +1,136 @@
+// Package keys holds the asymmetric keys access and ID tokens are signed
+// with. A Keyring signs with one key and verifies with every key that has
+// not expired, so keys can be rotated without invalidating issued tokens.
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/user/votex-template/backend/pkg/jwk"
+)
+
+// Algorithms keys can be generated for
+const (
+	EdDSA = "EdDSA"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+var ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+
+// Key is a private signing key. ID is the RFC 7638 thumbprint of its public
+// key and is sent as the kid header. ExpiresAt is set once the key has been
+// rotated out.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	Private   crypto.Signer
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+}
+
+// NewKey picks the JWS algorithm for a private key
+func NewKey(private crypto.Signer) (*Key, error) {
+	var method jwt.SigningMethod
+	switch key := private.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("rsa signing keys must be at least 2048 bits")
+		}
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, errors.New("ecdsa signing keys must use the P-256 curve")
+		}
+		method = jwt.SigningMethodES256
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%w: key type %T", ErrUnsupportedAlgorithm, private)
+	}
+
+	id, err := jwk.Key{Key: private.Public()}.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	return &Key{ID: id, Method: method, Private: private, CreatedAt: time.Now()}, nil
+}
+
+// GenerateKey creates a key for one of EdDSA, RS256 or ES256
+func GenerateKey(algorithm string) (*Key, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case RS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case ES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(private)
+}
+
+// ParsePEM reads a PKCS #8, PKCS #1 or SEC 1 private key
+func ParsePEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var private any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: key type %T", ErrUnsupportedAlgorithm, private)
+	}
+	return NewKey(signer)
+}
+
+// MarshalPEM encodes the private key as PKCS #8
+func (k *Key) MarshalPEM() (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// Public returns the key as published in the JWKS
+func (k *Key) Public() jwk.Key {
+	return jwk.Key{KeyID: k.ID, Algorithm: k.Method.Alg(), Use: "sig", Key: k.Private.Public()}
+}
+
+func (k *Key) expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
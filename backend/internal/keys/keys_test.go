@@ -0,0 +1,117 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKey(t *testing.T) {
+	for _, algorithm := range []string{EdDSA, RS256, ES256} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := GenerateKey(algorithm)
+			require.NoError(t, err)
+			assert.Equal(t, algorithm, key.Method.Alg())
+
+			encoded, err := key.MarshalPEM()
+			require.NoError(t, err)
+			parsed, err := ParsePEM([]byte(encoded))
+			require.NoError(t, err)
+			assert.Equal(t, key.ID, parsed.ID, "the kid is derived from the key")
+			assert.Equal(t, algorithm, parsed.Method.Alg())
+		})
+	}
+
+	_, err := GenerateKey("HS256")
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+}
+
+func TestParsePEM(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(ecKey)
+	key, err := ParsePEM(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.Equal(t, ES256, key.Method.Alg())
+
+	weak, _ := rsa.GenerateKey(rand.Reader, 1024)
+	_, err = ParsePEM(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weak)}))
+	assert.Error(t, err, "short RSA keys are rejected")
+
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	der, _ = x509.MarshalPKCS8PrivateKey(p384)
+	_, err = ParsePEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	assert.Error(t, err, "only P-256 is supported")
+
+	_, err = ParsePEM([]byte("not a key"))
+	assert.Error(t, err)
+}
+
+func TestLoadFiles(t *testing.T) {
+	current, _ := GenerateKey(EdDSA)
+	previous, _ := GenerateKey(ES256)
+	dir := t.TempDir()
+	var paths []string
+	for i, key := range []*Key{current, previous} {
+		encoded, err := key.MarshalPEM()
+		require.NoError(t, err)
+		path := filepath.Join(dir, []string{"current.pem", "previous.pem"}[i])
+		require.NoError(t, os.WriteFile(path, []byte(encoded), 0o600))
+		paths = append(paths, path)
+	}
+
+	keyring, err := LoadFiles(paths)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"EdDSA", "ES256"}, keyring.Algorithms())
+
+	// The first file signs, the second one still verifies
+	signed, err := keyring.Sign(jwt.MapClaims{"sub": "1"}, "JWT")
+	require.NoError(t, err)
+	token, err := jwt.Parse(signed, keyring.Keyfunc, jwt.WithValidMethods(keyring.Algorithms()))
+	require.NoError(t, err)
+	assert.Equal(t, current.ID, token.Header["kid"])
+
+	old := NewStatic(previous)
+	signed, err = old.Sign(jwt.MapClaims{"sub": "1"}, "JWT")
+	require.NoError(t, err)
+	_, err = jwt.Parse(signed, keyring.Keyfunc, jwt.WithValidMethods(keyring.Algorithms()))
+	assert.NoError(t, err)
+
+	_, err = LoadFiles([]string{filepath.Join(dir, "missing.pem")})
+	assert.Error(t, err)
+}
+
+func TestKeyfunc_Rejections(t *testing.T) {
+	key, _ := GenerateKey(EdDSA)
+	keyring := NewStatic(key)
+
+	other, _ := GenerateKey(EdDSA)
+	signed, _ := NewStatic(other).Sign(jwt.MapClaims{"sub": "1"}, "JWT")
+	_, err := jwt.Parse(signed, keyring.Keyfunc, jwt.WithValidMethods(keyring.Algorithms()))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	// An HMAC token naming a known kid must not be verified with that key
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1"})
+	hmac.Header["kid"] = key.ID
+	signed, _ = hmac.SignedString([]byte("secret"))
+	_, err = jwt.Parse(signed, keyring.Keyfunc, jwt.WithValidMethods(keyring.Algorithms()))
+	assert.Error(t, err)
+
+	// Expired keys no longer verify
+	expired := time.Now().Add(-time.Minute)
+	key.ExpiresAt = &expired
+	signed, _ = NewStatic(&Key{ID: key.ID, Method: key.Method, Private: key.Private}).Sign(jwt.MapClaims{"sub": "1"}, "JWT")
+	_, err = jwt.Parse(signed, keyring.Keyfunc, jwt.WithValidMethods([]string{"EdDSA"}))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	assert.Empty(t, keyring.JWKS().Keys)
+}
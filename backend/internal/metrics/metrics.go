@@ -0,0 +1,124 @@
+// Package metrics holds the Prometheus metrics served on /metrics
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "votex"
+
+// Registry holds every metric, along with the Go runtime and process ones
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// HTTPRequests counts requests by method, chi route pattern and status
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by method, route pattern and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes request latency by method and route pattern
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method and route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// RateLimitRejections counts requests refused by each rate limit policy
+	RateLimitRejections = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rate_limit",
+		Name:      "rejections_total",
+		Help:      "Requests refused by a rate limit policy.",
+	}, []string{"policy"})
+
+	// Logins counts sign-in attempts by method and result: success,
+	// failure, mfa_required or locked
+	Logins = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Sign-in attempts by method and result.",
+	}, []string{"method", "result"})
+
+	// MigrationVersion is the database schema version after migrating
+	MigrationVersion = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "migration_version",
+		Help:      "Database schema migration version.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDB exports the connection pool statistics of db
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// OutboxCounter counts the emails in the outbox by state
+type OutboxCounter interface {
+	CountOutboxEmails(ctx context.Context) (map[string]int, error)
+}
+
+// RegisterEmailQueue exports the number of queued emails by state, counted
+// whenever the metrics are scraped
+func RegisterEmailQueue(outbox OutboxCounter) {
+	Registry.MustRegister(&emailQueueCollector{
+		outbox: outbox,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "email_queue", "emails"),
+			"Emails in the outbox by state.",
+			[]string{"status"}, nil,
+		),
+	})
+}
+
+// countTimeout bounds the outbox query of a scrape
+const countTimeout = 5 * time.Second
+
+type emailQueueCollector struct {
+	outbox OutboxCounter
+	desc   *prometheus.Desc
+}
+
+func (c *emailQueueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *emailQueueCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), countTimeout)
+	defer cancel()
+
+	counts, err := c.outbox.CountOutboxEmails(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), status)
+	}
+}
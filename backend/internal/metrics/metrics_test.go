@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeOutbox reports fixed counts
+type fakeOutbox struct {
+	counts map[string]int
+	err    error
+}
+
+func (f *fakeOutbox) CountOutboxEmails(ctx context.Context) (map[string]int, error) {
+	return f.counts, f.err
+}
+
+func TestEmailQueueCollector(t *testing.T) {
+	outbox := &fakeOutbox{counts: map[string]int{"pending": 3, "dead": 1}}
+	collector := &emailQueueCollector{
+		outbox: outbox,
+		desc:   prometheus.NewDesc("votex_email_queue_emails", "Emails in the outbox by state.", []string{"status"}, nil),
+	}
+
+	expected := `
+# HELP votex_email_queue_emails Emails in the outbox by state.
+# TYPE votex_email_queue_emails gauge
+votex_email_queue_emails{status="dead"} 1
+votex_email_queue_emails{status="pending"} 3
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	// A failed count fails the scrape instead of reporting an empty queue
+	outbox.err = errors.New("database is locked")
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	if _, err := registry.Gather(); err == nil {
+		t.Error("expected the scrape to fail")
+	}
+}
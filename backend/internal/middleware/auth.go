@@ -2,96 +2,233 @@ package middleware
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/keys"
+	"github.com/user/votex-template/backend/internal/store"
 )
 
 type Claims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
+	UserID      string   `json:"user_id"`
+	Username    string   `json:"username"`
+	SessionID   string   `json:"sid"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
 	jwt.RegisteredClaims
 }
 
 type AuthMiddleware struct {
-	jwtSecret string
+	keys  *keys.Keyring
+	store store.StoreInterface
+	cfg   *config.Config
 }
 
-func NewAuthMiddleware(cfg *config.Config) *AuthMiddleware {
+func NewAuthMiddleware(cfg *config.Config, s store.StoreInterface, keyring *keys.Keyring) *AuthMiddleware {
 	return &AuthMiddleware{
-		jwtSecret: cfg.JWTSecret,
+		keys:  keyring,
+		store: s,
+		cfg:   cfg,
 	}
 }
 
-// Authenticate middleware validates JWT tokens and adds user info to request context
+// apiKeyTouchInterval limits how often an API key's last use is written back
+const apiKeyTouchInterval = time.Minute
+
+// Authentication failures, written as the 401 response body
+var (
+	errNoCredentials     = errors.New("Authorization header required")
+	errMalformedHeader   = errors.New("Invalid authorization header format")
+	errInvalidToken      = errors.New("Invalid token")
+	errSessionRevoked    = errors.New("Session has been revoked")
+	errInvalidAPIKey     = errors.New("Invalid API key")
+	errAPIKeyUnavailable = errors.New("Could not verify API key")
+)
+
+// Authenticate middleware validates JWT tokens or API keys and adds user info to request context
 func (am *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
-			return
-		}
-
-		// Extract token from "Bearer <token>"
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+		ctx, err := am.authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-		tokenString := tokenParts[1]
-		claims, err := am.validateToken(tokenString)
+// OptionalAuth middleware validates credentials if present but doesn't require them
+func (am *AuthMiddleware) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := am.authenticate(r)
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			next.ServeHTTP(w, r)
 			return
 		}
-
-		// Add user info to request context
-		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
-		ctx = context.WithValue(ctx, "username", claims.Username)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// OptionalAuth middleware validates JWT tokens if present but doesn't require them
-func (am *AuthMiddleware) OptionalAuth(next http.Handler) http.Handler {
+// RequireSession rejects requests authenticated with an API key. It guards
+// account security settings, which a leaked key must not be able to change.
+// It must run after Authenticate.
+func RequireSession(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			next.ServeHTTP(w, r)
+		if _, ok := GetAPIKeyID(r); ok {
+			http.Error(w, "This endpoint requires a signed-in session", http.StatusForbidden)
 			return
 		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+// RequireVerifiedEmail rejects users who have not verified their email
+// address when EMAIL_VERIFICATION is sensitive or login. It guards actions
+// that hand out access, such as creating API keys. It must run after
+// Authenticate.
+func (am *AuthMiddleware) RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !am.cfg.EmailVerificationEnforced() {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		tokenString := tokenParts[1]
-		claims, err := am.validateToken(tokenString)
+		userID, ok := GetUserID(r)
+		if !ok {
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		user, err := am.store.GetUserByID(r.Context(), userID)
 		if err != nil {
-			next.ServeHTTP(w, r)
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
 			return
 		}
-
-		// Add user info to request context
-		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
-		ctx = context.WithValue(ctx, "username", claims.Username)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		if user.EmailVerifiedAt == nil {
+			http.Error(w, "Verify your email address first", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
 	})
 }
 
-func (am *AuthMiddleware) validateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// authenticate checks the request's credential, either an access token in
+// the Authorization header or an API key sent as a bearer token or in
+// X-API-Key, and returns a context carrying the user's identity
+func (am *AuthMiddleware) authenticate(r *http.Request) (context.Context, error) {
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		return am.authenticateAPIKey(r, apiKey)
+	}
+
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, errNoCredentials
+	}
+
+	// Extract token from "Bearer <token>"
+	tokenParts := strings.Split(authHeader, " ")
+	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		return nil, errMalformedHeader
+	}
+
+	tokenString := tokenParts[1]
+	if strings.HasPrefix(tokenString, store.APIKeyTokenPrefix) {
+		return am.authenticateAPIKey(r, tokenString)
+	}
+
+	claims, err := am.validateToken(tokenString)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	if !am.sessionActive(r.Context(), claims) {
+		return nil, errSessionRevoked
+	}
+
+	// Add user info to request context
+	ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
+	ctx = context.WithValue(ctx, "username", claims.Username)
+	ctx = context.WithValue(ctx, "session_id", claims.SessionID)
+	ctx = context.WithValue(ctx, "roles", claims.Roles)
+	ctx = context.WithValue(ctx, "permissions", claims.Permissions)
+	return ctx, nil
+}
+
+// authenticateAPIKey resolves an API key to its owner. The key grants the
+// scopes it was created with, minus any permission the owner has lost since.
+// Roles are not carried over, so checks must go through permissions.
+func (am *AuthMiddleware) authenticateAPIKey(r *http.Request, token string) (context.Context, error) {
+	ctx := r.Context()
+	sum := sha256.Sum256([]byte(token))
+	key, err := am.store.GetAPIKeyByHash(ctx, hex.EncodeToString(sum[:]))
+	if err != nil {
+		if errors.Is(err, store.ErrAPIKeyNotFound) {
+			return nil, errInvalidAPIKey
 		}
-		return []byte(am.jwtSecret), nil
-	})
+		slog.Error("Failed to look up API key", "error", err)
+		return nil, errAPIKeyUnavailable
+	}
+
+	now := time.Now()
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return nil, errInvalidAPIKey
+	}
+
+	user, err := am.store.GetUserByID(ctx, key.UserID)
+	if err != nil {
+		return nil, errInvalidAPIKey
+	}
+	held, err := am.store.GetUserPermissions(ctx, key.UserID)
+	if err != nil {
+		slog.Error("Failed to load API key permissions", "key_id", key.ID, "error", err)
+		return nil, errAPIKeyUnavailable
+	}
+	permissions := []string{}
+	for _, scope := range strings.Fields(key.Scopes) {
+		if slices.Contains(held, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+
+	ip := RemoteIP(r)
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval || key.LastUsedIP == nil || *key.LastUsedIP != ip {
+		if err := am.store.TouchAPIKey(ctx, key.ID, ip); err != nil {
+			slog.Warn("Failed to record API key use", "key_id", key.ID, "error", err)
+		}
+	}
+
+	ctx = context.WithValue(ctx, "user_id", user.ID)
+	ctx = context.WithValue(ctx, "username", user.Username)
+	ctx = context.WithValue(ctx, "api_key_id", key.ID)
+	ctx = context.WithValue(ctx, "permissions", permissions)
+	return ctx, nil
+}
+
+// RemoteIP returns the client address resolved by ClientIP, or else the
+// address the request came from, without the port
+func RemoteIP(r *http.Request) string {
+	if ip, ok := r.Context().Value("client_ip").(string); ok {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (am *AuthMiddleware) validateToken(tokenString string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, am.keys.Keyfunc,
+		jwt.WithValidMethods(am.keys.Algorithms()))
 
 	if err != nil {
 		return nil, err
@@ -104,6 +241,22 @@ func (am *AuthMiddleware) validateToken(tokenString string) (*Claims, error) {
 	return nil, fmt.Errorf("invalid token")
 }
 
+// sessionActive reports whether the session a token was issued for still exists.
+// Logging out or detecting refresh token reuse deletes the session, which
+// invalidates every access token minted for it.
+func (am *AuthMiddleware) sessionActive(ctx context.Context, claims *Claims) bool {
+	if claims.SessionID == "" {
+		return false
+	}
+
+	session, err := am.store.GetSession(ctx, claims.SessionID)
+	if err != nil {
+		return false
+	}
+
+	return session.UserID == claims.UserID && time.Now().Before(session.ExpiresAt)
+}
+
 // GetUserID extracts user ID from request context
 func GetUserID(r *http.Request) (string, bool) {
 	userID, ok := r.Context().Value("user_id").(string)
@@ -115,3 +268,16 @@ func GetUsername(r *http.Request) (string, bool) {
 	username, ok := r.Context().Value("username").(string)
 	return username, ok
 }
+
+// GetSessionID extracts the session ID from request context
+func GetSessionID(r *http.Request) (string, bool) {
+	sessionID, ok := r.Context().Value("session_id").(string)
+	return sessionID, ok
+}
+
+// GetAPIKeyID extracts the id of the API key the request was authenticated
+// with. It is not set for requests carrying an access token.
+func GetAPIKeyID(r *http.Request) (string, bool) {
+	keyID, ok := r.Context().Value("api_key_id").(string)
+	return keyID, ok
+}
@@ -0,0 +1,250 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/keys"
+	"github.com/user/votex-template/backend/internal/store"
+)
+
+const testAPIKey = "vtx_0123456789abcdef"
+
+// apiKeyStore holds a single API key for testAPIKey
+type apiKeyStore struct {
+	store.MockStore
+	key         store.APIKey
+	permissions []string
+	touched     []string
+}
+
+func (s *apiKeyStore) GetAPIKeyByHash(ctx context.Context, tokenHash string) (*store.APIKey, error) {
+	sum := sha256.Sum256([]byte(testAPIKey))
+	if tokenHash != hex.EncodeToString(sum[:]) {
+		return nil, store.ErrAPIKeyNotFound
+	}
+	key := s.key
+	return &key, nil
+}
+
+func (s *apiKeyStore) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	return s.permissions, nil
+}
+
+func (s *apiKeyStore) TouchAPIKey(ctx context.Context, id, ip string) error {
+	s.touched = append(s.touched, ip)
+	return nil
+}
+
+func newTestAuthMiddleware(t *testing.T, s store.StoreInterface) *AuthMiddleware {
+	t.Helper()
+	key, err := keys.GenerateKey(keys.EdDSA)
+	if err != nil {
+		t.Fatalf("failed to generate signing key: %v", err)
+	}
+	return NewAuthMiddleware(&config.Config{}, s, keys.NewStatic(key))
+}
+
+func TestAuthenticate_APIKey(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	recent := time.Now().Add(-10 * time.Second)
+	localhost := "192.0.2.1"
+
+	tests := []struct {
+		name            string
+		header          string
+		value           string
+		expiresAt       *time.Time
+		lastUsedAt      *time.Time
+		lastUsedIP      *string
+		expectedStatus  int
+		expectedTouches int
+	}{
+		{
+			name:            "X-API-Key header",
+			header:          "X-API-Key",
+			value:           testAPIKey,
+			expectedStatus:  http.StatusOK,
+			expectedTouches: 1,
+		},
+		{
+			name:            "bearer token",
+			header:          "Authorization",
+			value:           "Bearer " + testAPIKey,
+			expectedStatus:  http.StatusOK,
+			expectedTouches: 1,
+		},
+		{
+			name:           "unknown key",
+			header:         "X-API-Key",
+			value:          "vtx_unknown",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "expired key",
+			header:         "X-API-Key",
+			value:          testAPIKey,
+			expiresAt:      &past,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "recent use from the same address is not written again",
+			header:         "X-API-Key",
+			value:          testAPIKey,
+			lastUsedAt:     &recent,
+			lastUsedIP:     &localhost,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &apiKeyStore{
+				key: store.APIKey{
+					ID:         "key-1",
+					UserID:     "1",
+					Scopes:     "users:read clients:write",
+					ExpiresAt:  tt.expiresAt,
+					LastUsedAt: tt.lastUsedAt,
+					LastUsedIP: tt.lastUsedIP,
+				},
+				// clients:write was revoked after the key was created
+				permissions: []string{PermissionUsersRead, PermissionUsersWrite},
+			}
+			am := newTestAuthMiddleware(t, s)
+
+			var gotPermissions []string
+			var gotKeyID string
+			handler := am.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPermissions = GetPermissions(r)
+				gotKeyID, _ = GetAPIKeyID(r)
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("GET", "/api/auth/profile", nil)
+			req.RemoteAddr = localhost + ":41234"
+			req.Header.Set(tt.header, tt.value)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d (%s)", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if len(s.touched) != tt.expectedTouches {
+				t.Errorf("expected %d last-use updates, got %v", tt.expectedTouches, s.touched)
+			}
+			if tt.expectedTouches > 0 && s.touched[0] != localhost {
+				t.Errorf("expected the client address to be recorded, got %q", s.touched[0])
+			}
+			if w.Code == http.StatusOK {
+				if gotKeyID != "key-1" {
+					t.Errorf("expected the key id in context, got %q", gotKeyID)
+				}
+				if !slices.Equal(gotPermissions, []string{PermissionUsersRead}) {
+					t.Errorf("expected only scopes the user still holds, got %v", gotPermissions)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthenticate_RejectsHMACTokens(t *testing.T) {
+	am := newTestAuthMiddleware(t, &store.MockStore{})
+
+	// A token signed with the old shared secret must not be accepted
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "1",
+		"sid":     "session-1",
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	})
+	signed, _ := token.SignedString([]byte("a-very-secret-key-change-in-production"))
+
+	handler := am.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest("GET", "/api/auth/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+signed)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	handler := RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("POST", "/api/auth/mfa/enroll", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "session_id", "session-1"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected sessions to pass, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/auth/mfa/enroll", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "api_key_id", "key-1"))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected API keys to be rejected with %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+// verificationStore returns a user whose email is verified when verified is set
+type verificationStore struct {
+	store.MockStore
+	verified bool
+}
+
+func (s *verificationStore) GetUserByID(ctx context.Context, id string) (*store.User, error) {
+	user := &store.User{ID: id, Username: "alice"}
+	if s.verified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	return user, nil
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name           string
+		mode           config.EmailVerification
+		verified       bool
+		expectedStatus int
+	}{
+		{name: "not enforced", mode: config.VerifyEmailOptional, expectedStatus: http.StatusOK},
+		{name: "unverified", mode: config.VerifyEmailSensitive, expectedStatus: http.StatusForbidden},
+		{name: "verified", mode: config.VerifyEmailSensitive, verified: true, expectedStatus: http.StatusOK},
+		{name: "login mode also guards sensitive actions", mode: config.VerifyEmailLogin, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			am := newTestAuthMiddleware(t, &verificationStore{verified: tt.verified})
+			am.cfg.EmailVerification = tt.mode
+			handler := am.RequireVerifiedEmail(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("POST", "/api/auth/profile/api-keys", nil)
+			req = req.WithContext(context.WithValue(req.Context(), "user_id", "user-1"))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/pkg/clientip"
+)
+
+// ClientIP resolves the client address once, trusting the proxy header
+// only from TRUSTED_PROXIES, and puts it in the request context for
+// RemoteIP. Requests through a proxy also get it as RemoteAddr, so that the
+// request log shows the client.
+func ClientIP(cfg *config.Config) func(http.Handler) http.Handler {
+	// The prefixes were checked when the configuration was loaded
+	trusted, _ := clientip.ParsePrefixes(cfg.TrustedProxies)
+	resolver := &clientip.Resolver{Trusted: trusted, Header: clientip.XForwardedFor}
+	if cfg.ClientIPHeader == "forwarded" {
+		resolver.Header = clientip.Forwarded
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr := resolver.Resolve(r)
+			if !addr.IsValid() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ip := addr.String()
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err != nil || host != ip {
+				r.RemoteAddr = ip
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "client_ip", ip)))
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/user/votex-template/backend/internal/config"
+)
+
+func TestClientIP(t *testing.T) {
+	cfg := &config.Config{TrustedProxies: []string{"10.0.0.0/8"}, ClientIPHeader: "x-forwarded-for"}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		expectedIP   string
+		expectedAddr string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:5000", forwardedFor: "198.51.100.1", expectedIP: "203.0.113.7", expectedAddr: "203.0.113.7:5000"},
+		{name: "through a trusted proxy", remoteAddr: "10.0.0.1:5000", forwardedFor: "1.1.1.1, 198.51.100.1", expectedIP: "198.51.100.1", expectedAddr: "198.51.100.1"},
+		{name: "not an IP address", remoteAddr: "@", expectedIP: "@", expectedAddr: "@"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ip, remoteAddr string
+			handler := ClientIP(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ip, remoteAddr = RemoteIP(r), r.RemoteAddr
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if ip != tt.expectedIP {
+				t.Errorf("expected client IP %s, got %s", tt.expectedIP, ip)
+			}
+			if remoteAddr != tt.expectedAddr {
+				t.Errorf("expected RemoteAddr %s, got %s", tt.expectedAddr, remoteAddr)
+			}
+		})
+	}
+}
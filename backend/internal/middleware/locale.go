@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/user/votex-template/backend/pkg/mail"
+)
+
+// Locale keeps the languages of the Accept-Language header in the request
+// context, so emails sent on behalf of the request are translated
+func Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get("Accept-Language"); header != "" {
+			r = r.WithContext(mail.WithLocales(r.Context(), mail.ParseAcceptLanguage(header)...))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
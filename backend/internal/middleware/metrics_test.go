@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/user/votex-template/backend/internal/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Metrics)
+	r.Route("/api/users", func(r chi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			if chi.URLParam(r, "id") == "missing" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+	})
+
+	requests := func(route, status string) float64 {
+		return testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, route, status))
+	}
+	ok, notFound, unmatched := requests("/api/users/{id}", "200"), requests("/api/users/{id}", "404"), requests("unmatched", "404")
+
+	for _, path := range []string{"/api/users/1", "/api/users/2", "/api/users/missing", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Requests are counted by route pattern rather than path
+	if got := requests("/api/users/{id}", "200") - ok; got != 2 {
+		t.Errorf("expected 2 successful requests, got %v", got)
+	}
+	if got := requests("/api/users/{id}", "404") - notFound; got != 1 {
+		t.Errorf("expected 1 not found request, got %v", got)
+	}
+	if got := requests("unmatched", "404") - unmatched; got != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", got)
+	}
+	if n := testutil.CollectAndCount(metrics.HTTPRequestDuration); n < 2 {
+		t.Errorf("expected latency for both routes, got %d series", n)
+	}
+}
+
+func TestMetrics_NonstandardMethod(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Metrics)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	before := testutil.CollectAndCount(metrics.HTTPRequests)
+	for _, method := range []string{"BREW", "PROPFIND", "X-RANDOM-1"} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, "/nowhere", nil))
+	}
+
+	// Arbitrary method tokens share a single "OTHER" series
+	if got := testutil.CollectAndCount(metrics.HTTPRequests) - before; got > 1 {
+		t.Errorf("expected at most one new series, got %d", got)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("BREW", "/nowhere", nil))
+	if got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("OTHER", "unmatched", strconv.Itoa(rec.Code))); got != 4 {
+		t.Errorf("expected 4 requests counted as OTHER, got %v", got)
+	}
+}
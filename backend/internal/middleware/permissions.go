@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Permissions granted through roles. They are seeded by the roles migration.
+const (
+	PermissionUsersRead   = "users:read"
+	PermissionUsersWrite  = "users:write"
+	PermissionUsersDelete = "users:delete"
+	PermissionRolesWrite  = "roles:write"
+
+	// Seeded by the OAuth provider migration
+	PermissionClientsWrite = "clients:write"
+
+	// Seeded by the email outbox migration
+	PermissionEmailsRead  = "emails:read"
+	PermissionEmailsWrite = "emails:write"
+)
+
+// RequirePermission only lets requests through when the authenticated user's
+// token carries the given permission. It must run after Authenticate.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := GetUserID(r); !ok {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			if !HasPermission(r, permission) {
+				http.Error(w, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetRoles extracts the user's roles from request context
+func GetRoles(r *http.Request) []string {
+	roles, _ := r.Context().Value("roles").([]string)
+	return roles
+}
+
+// GetPermissions extracts the user's permissions from request context
+func GetPermissions(r *http.Request) []string {
+	permissions, _ := r.Context().Value("permissions").([]string)
+	return permissions
+}
+
+// HasPermission reports whether the authenticated user holds a permission
+func HasPermission(r *http.Request, permission string) bool {
+	return slices.Contains(GetPermissions(r), permission)
+}
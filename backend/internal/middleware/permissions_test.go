@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		permissions    []string
+		expectedStatus int
+	}{
+		{
+			name:           "unauthenticated",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing permission",
+			userID:         "1",
+			permissions:    []string{PermissionUsersRead},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "has permission",
+			userID:         "1",
+			permissions:    []string{PermissionUsersRead, PermissionUsersWrite},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequirePermission(PermissionUsersWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("PUT", "/api/users/2", nil)
+			if tt.userID != "" {
+				ctx := context.WithValue(req.Context(), "user_id", tt.userID)
+				ctx = context.WithValue(ctx, "permissions", tt.permissions)
+				req = req.WithContext(ctx)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
@@ -1,119 +1,169 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/metrics"
+	"github.com/user/votex-template/backend/pkg/ratelimit"
 )
 
+// Rate limit policies. Every request counts against the read or default
+// policy; routes add the auth, token or user policy on top.
+const (
+	PolicyDefault = "default"
+	PolicyRead    = "read"
+	PolicyAuth    = "auth"
+	PolicyToken   = "token"
+	PolicyUser    = "user"
+)
+
+// redisTimeout bounds each call to Redis, which is not retried, so that an
+// unreachable Redis falls back to memory without holding up the request
+// for long
+const redisTimeout = 500 * time.Millisecond
+
+// RateLimiter limits requests per client by named policy
 type RateLimiter struct {
-	requests map[string][]time.Time
-	mutex    sync.RWMutex
-	config   *config.Config
+	limiter  ratelimit.Limiter
+	policies map[string]ratelimit.Limit
+	redis    *redis.Client
 }
 
-func NewRateLimiter(cfg *config.Config) *RateLimiter {
+// NewRateLimiter keeps buckets in memory, or with RATE_LIMIT_STORE=redis
+// in Redis so that replicas share them, limiting in memory while Redis is
+// unreachable
+func NewRateLimiter(cfg *config.Config) (*RateLimiter, error) {
 	rl := &RateLimiter{
-		requests: make(map[string][]time.Time),
-		config:   cfg,
+		limiter: ratelimit.NewMemory(cfg.RateLimitMaxKeys),
+		policies: map[string]ratelimit.Limit{
+			PolicyDefault: ratelimit.PerMinute(cfg.RateLimitRequests, cfg.RateLimitBurst),
+			PolicyRead:    ratelimit.PerMinute(cfg.RateLimitReadRequests, cfg.RateLimitReadBurst),
+			PolicyAuth:    ratelimit.PerMinute(cfg.RateLimitAuthRequests, cfg.RateLimitAuthBurst),
+			PolicyToken:   ratelimit.PerMinute(cfg.RateLimitTokenRequests, cfg.RateLimitTokenBurst),
+			PolicyUser:    ratelimit.PerMinute(cfg.RateLimitUserRequests, cfg.RateLimitUserBurst),
+		},
+	}
+	if cfg.RateLimitStore != config.RateLimitStoreRedis {
+		return rl, nil
 	}
 
-	// Start cleanup goroutine
-	go rl.cleanup()
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	opts.DialTimeout = redisTimeout
+	opts.ReadTimeout = redisTimeout
+	opts.WriteTimeout = redisTimeout
+	opts.MaxRetries = -1
+	opts.DialerRetries = 1
+	rl.redis = redis.NewClient(opts)
+	rl.limiter = &ratelimit.Fallback{
+		Primary:    ratelimit.NewRedis(rl.redis, "ratelimit:"),
+		Secondary:  rl.limiter,
+		RetryAfter: time.Duration(cfg.RateLimitFallbackRetry) * time.Second,
+	}
+	return rl, nil
+}
 
-	return rl
+// Ping checks that the rate limit store is reachable
+func (rl *RateLimiter) Ping(ctx context.Context) error {
+	if rl.redis == nil {
+		return nil
+	}
+	return rl.redis.Ping(ctx).Err()
 }
 
-func (rl *RateLimiter) cleanup() {
-	ticker := time.NewTicker(time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		rl.mutex.Lock()
-		now := time.Now()
-		window := time.Duration(rl.config.RateLimitRequests) * time.Minute
-
-		for ip, requests := range rl.requests {
-			var validRequests []time.Time
-			for _, reqTime := range requests {
-				if now.Sub(reqTime) < window {
-					validRequests = append(validRequests, reqTime)
-				}
-			}
-			if len(validRequests) == 0 {
-				delete(rl.requests, ip)
-			} else {
-				rl.requests[ip] = validRequests
-			}
-		}
-		rl.mutex.Unlock()
+// Close releases the connection to Redis
+func (rl *RateLimiter) Close() error {
+	if rl.redis == nil {
+		return nil
 	}
+	return rl.redis.Close()
 }
 
+// RateLimit limits every request, reads by the read policy and anything
+// else by the default policy
 func (rl *RateLimiter) RateLimit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get client IP
-		ip := getClientIP(r)
-
-		rl.mutex.Lock()
-		now := time.Now()
-		window := time.Duration(rl.config.RateLimitRequests) * time.Minute
-
-		// Get existing requests for this IP
-		requests, exists := rl.requests[ip]
-		if !exists {
-			requests = []time.Time{}
+		policy := PolicyDefault
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			policy = PolicyRead
 		}
-
-		// Remove old requests outside the window
-		var validRequests []time.Time
-		for _, reqTime := range requests {
-			if now.Sub(reqTime) < window {
-				validRequests = append(validRequests, reqTime)
-			}
-		}
-
-		// Check if rate limit exceeded
-		if len(validRequests) >= rl.config.RateLimitBurst {
-			rl.mutex.Unlock()
-			w.Header().Set("Content-Type", "application/json")
-			w.Header().Set("X-RateLimit-Limit", string(rune(rl.config.RateLimitBurst)))
-			w.Header().Set("X-RateLimit-Remaining", "0")
-			w.Header().Set("X-RateLimit-Reset", time.Now().Add(window).Format(time.RFC3339))
-			w.WriteHeader(http.StatusTooManyRequests)
-			w.Write([]byte(`{"error": "Rate limit exceeded. Please try again later."}`))
-			return
+		if rl.allow(w, r, policy) {
+			next.ServeHTTP(w, r)
 		}
+	})
+}
 
-		// Add current request
-		validRequests = append(validRequests, now)
-		rl.requests[ip] = validRequests
+// Limit limits requests by the named policy. Behind Authenticate clients
+// are counted per API key or user rather than per IP address.
+func (rl *RateLimiter) Limit(policy string) func(http.Handler) http.Handler {
+	if _, ok := rl.policies[policy]; !ok {
+		panic("unknown rate limit policy " + policy)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rl.allow(w, r, policy) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
 
-		// Set rate limit headers
-		w.Header().Set("X-RateLimit-Limit", string(rune(rl.config.RateLimitBurst)))
-		w.Header().Set("X-RateLimit-Remaining", string(rune(rl.config.RateLimitBurst-len(validRequests))))
-		w.Header().Set("X-RateLimit-Reset", time.Now().Add(window).Format(time.RFC3339))
+// allow counts the request against policy and describes the policy in the
+// RateLimit-Policy and RateLimit headers of
+// draft-ietf-httpapi-ratelimit-headers. A refused request is answered with
+// 429 and Retry-After.
+func (rl *RateLimiter) allow(w http.ResponseWriter, r *http.Request, policy string) bool {
+	limit := rl.policies[policy]
+	result, err := rl.limiter.Allow(r.Context(), policy+":"+rateLimitKey(r), limit)
+	if err != nil {
+		// Fail open rather than take the API down with the limiter
+		slog.Warn("Failed to check rate limit", "policy", policy, "error", err)
+		return true
+	}
 
-		rl.mutex.Unlock()
+	// Several policies can apply to one request, each adds its own item
+	w.Header().Add("RateLimit-Policy", fmt.Sprintf("%q;q=%d;w=%d", policy, result.Limit, seconds(limit.Window())))
+	w.Header().Add("RateLimit", fmt.Sprintf("%q;r=%d;t=%d", policy, result.Remaining, seconds(result.ResetAfter)))
+	if result.Allowed {
+		return true
+	}
 
-		next.ServeHTTP(w, r)
+	metrics.RateLimitRejections.WithLabelValues(policy).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": false,
+		"error":   "Rate limit exceeded. Please try again later.",
+		"code":    "rate_limited",
 	})
+	return false
 }
 
-func getClientIP(r *http.Request) string {
-	// Check for forwarded headers (for proxy/load balancer scenarios)
-	if ip := r.Header.Get("X-Forwarded-For"); ip != "" {
-		return ip
-	}
-	if ip := r.Header.Get("X-Real-IP"); ip != "" {
-		return ip
+// rateLimitKey identifies the client: the API key or user the request is
+// authenticated as, or else its IP address
+func rateLimitKey(r *http.Request) string {
+	if keyID, ok := GetAPIKeyID(r); ok {
+		return "key:" + keyID
 	}
-	if ip := r.Header.Get("CF-Connecting-IP"); ip != "" {
-		return ip
+	if userID, ok := GetUserID(r); ok {
+		return "user:" + userID
 	}
+	return "ip:" + RemoteIP(r)
+}
 
-	// Fallback to remote address
-	return r.RemoteAddr
+// seconds rounds d up to whole seconds
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
 }
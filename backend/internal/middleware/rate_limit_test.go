@@ -0,0 +1,233 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/pkg/ratelimit"
+)
+
+func rateLimitConfig() *config.Config {
+	return &config.Config{
+		RateLimitRequests:      60,
+		RateLimitBurst:         3,
+		RateLimitReadRequests:  60,
+		RateLimitReadBurst:     5,
+		RateLimitAuthRequests:  6,
+		RateLimitAuthBurst:     2,
+		RateLimitTokenRequests: 60,
+		RateLimitTokenBurst:    3,
+		RateLimitUserRequests:  60,
+		RateLimitUserBurst:     2,
+		RateLimitMaxKeys:       1000,
+	}
+}
+
+func newRateLimiter(t *testing.T, cfg *config.Config) *RateLimiter {
+	t.Helper()
+	rl, err := NewRateLimiter(cfg)
+	if err != nil {
+		t.Fatalf("failed to create rate limiter: %v", err)
+	}
+	t.Cleanup(func() { rl.Close() })
+	return rl
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(t, rateLimitConfig())
+	handler := rl.RateLimit(rl.Limit(PolicyAuth)(okHandler))
+
+	login := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := login("192.0.2.1:1234")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	policies := w.Header().Values("RateLimit-Policy")
+	if len(policies) != 2 || policies[0] != `"default";q=3;w=3` || policies[1] != `"auth";q=2;w=20` {
+		t.Errorf("unexpected RateLimit-Policy headers %q", policies)
+	}
+	limits := w.Header().Values("RateLimit")
+	if len(limits) != 2 || limits[0] != `"default";r=2;t=1` || limits[1] != `"auth";r=1;t=10` {
+		t.Errorf("unexpected RateLimit headers %q", limits)
+	}
+
+	login("192.0.2.1:1234")
+	w = login("192.0.2.1:1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the strict policy to refuse the third login, got %d", w.Code)
+	}
+	if retry, _ := strconv.Atoi(w.Header().Get("Retry-After")); retry < 1 || retry > 10 {
+		t.Errorf("expected Retry-After within 10 seconds, got %q", w.Header().Get("Retry-After"))
+	}
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected a JSON error, got %q", w.Header().Get("Content-Type"))
+	}
+
+	// Another client is not affected
+	if w := login("192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("expected another IP to be allowed, got %d", w.Code)
+	}
+}
+
+func TestRateLimiter_Tokens(t *testing.T) {
+	rl := newRateLimiter(t, rateLimitConfig())
+	login := rl.Limit(PolicyAuth)(okHandler)
+	refresh := rl.Limit(PolicyToken)(okHandler)
+
+	request := func(handler http.Handler, path string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Refreshing does not use up the client's logins, nor the other way round
+	for range 2 {
+		request(login, "/api/auth/login")
+	}
+	if code := request(login, "/api/auth/login"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the auth policy to refuse the third login, got %d", code)
+	}
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if code := request(refresh, "/api/auth/refresh"); code != expected {
+			t.Errorf("refresh %d: expected status %d, got %d", i+1, expected, code)
+		}
+	}
+}
+
+func TestRateLimiter_Reads(t *testing.T) {
+	rl := newRateLimiter(t, rateLimitConfig())
+	handler := rl.RateLimit(okHandler)
+
+	allowed := 0
+	for range 10 {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/1", nil))
+		if w.Code == http.StatusOK {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("expected the read burst of 5 requests, got %d", allowed)
+	}
+
+	// Writes have a bucket of their own
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/users/1", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected a write to be allowed, got %d", w.Code)
+	}
+}
+
+func TestRateLimiter_Keys(t *testing.T) {
+	rl := newRateLimiter(t, rateLimitConfig())
+	handler := rl.Limit(PolicyUser)(okHandler)
+
+	request := func(key, value string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/profile", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if key != "" {
+			ctx := context.WithValue(req.Context(), "user_id", "user-1")
+			if key == "api_key_id" {
+				ctx = context.WithValue(ctx, key, value)
+			}
+			req = req.WithContext(ctx)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The user, each of their API keys and the anonymous IP are counted apart
+	for _, client := range [][2]string{{"user_id", "user-1"}, {"api_key_id", "key-1"}, {"api_key_id", "key-2"}, {"", ""}} {
+		for i := range 3 {
+			code := request(client[0], client[1])
+			if (code == http.StatusOK) != (i < 2) {
+				t.Errorf("%s %q request %d: unexpected status %d", client[0], client[1], i+1, code)
+			}
+		}
+	}
+}
+
+// failingLimiter cannot reach its store
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestRateLimiter_FailsOpen(t *testing.T) {
+	rl := newRateLimiter(t, rateLimitConfig())
+	rl.limiter = failingLimiter{}
+
+	w := httptest.NewRecorder()
+	rl.RateLimit(okHandler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the request through, got %d", w.Code)
+	}
+}
+
+func TestRateLimiter_UnknownPolicy(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected an unknown policy to panic")
+		}
+	}()
+	newRateLimiter(t, rateLimitConfig()).Limit("bogus")
+}
+
+func TestRateLimiter_Redis(t *testing.T) {
+	server := miniredis.RunT(t)
+	cfg := rateLimitConfig()
+	cfg.RateLimitStore = config.RateLimitStoreRedis
+	cfg.RedisURL = "redis://" + server.Addr()
+	cfg.RateLimitFallbackRetry = 30
+
+	// Two replicas share one bucket per client
+	replicas := []http.Handler{
+		newRateLimiter(t, cfg).Limit(PolicyAuth)(okHandler),
+		newRateLimiter(t, cfg).Limit(PolicyAuth)(okHandler),
+	}
+	login := func(replica int) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		replicas[replica].ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		if code := login(i % 2); code != expected {
+			t.Errorf("request %d: expected status %d, got %d", i+1, expected, code)
+		}
+	}
+	if !server.Exists("ratelimit:auth:ip:192.0.2.1") {
+		t.Errorf("expected the bucket in Redis, got keys %q", server.Keys())
+	}
+
+	// Without Redis each replica limits on its own
+	server.Close()
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if code := login(0); code != expected {
+			t.Errorf("request %d without Redis: expected status %d, got %d", i+1, expected, code)
+		}
+	}
+}
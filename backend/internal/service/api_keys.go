@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/user/votex-template/backend/internal/store"
+)
+
+// apiKeyPrefixLength is how much of a key is kept in clear so users can tell
+// their keys apart
+const apiKeyPrefixLength = 12
+
+// APIKey is a key as listed on the profile. The key itself is only returned
+// once, by CreateAPIKey.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP *string    `json:"last_used_ip,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+}
+
+// CreatedAPIKey is a new key together with its secret
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// CreateAPIKey mints a key for scripts and CI jobs. Scopes must be a subset
+// of the user's permissions; the key acts as the user with only those
+// permissions. Without expiresInDays the key lives for the configured
+// maximum, or forever when there is none.
+func (s *AuthService) CreateAPIKey(ctx context.Context, userID, name string, scopes []string, expiresInDays int) (*CreatedAPIKey, error) {
+	maxDays := s.Cfg.APIKeyMaxExpiry
+	if expiresInDays == 0 {
+		expiresInDays = maxDays
+	}
+	if maxDays > 0 && expiresInDays > maxDays {
+		return nil, ErrAPIKeyExpiryTooLong
+	}
+
+	permissions, err := s.Store.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	granted := []string{}
+	for _, scope := range scopes {
+		if !slices.Contains(permissions, scope) {
+			return nil, ErrInvalidScope
+		}
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	token := store.APIKeyTokenPrefix + generateSecureToken()
+	key := &store.APIKey{
+		ID:        generateID(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    token[:apiKeyPrefixLength],
+		TokenHash: hashToken(token),
+		Scopes:    strings.Join(granted, " "),
+	}
+	if expiresInDays > 0 {
+		expiresAt := time.Now().Add(time.Duration(expiresInDays) * 24 * time.Hour)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := s.Store.CreateAPIKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	key.CreatedAt = &now
+	return &CreatedAPIKey{APIKey: apiKeyFromStore(key), Key: token}, nil
+}
+
+func (s *AuthService) ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	keys, err := s.Store.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys := make([]APIKey, 0, len(keys))
+	for i := range keys {
+		apiKeys = append(apiKeys, apiKeyFromStore(&keys[i]))
+	}
+	return apiKeys, nil
+}
+
+func (s *AuthService) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	err := s.Store.DeleteAPIKey(ctx, keyID, userID)
+	if errors.Is(err, store.ErrAPIKeyNotFound) {
+		return ErrAPIKeyNotFound
+	}
+	return err
+}
+
+func apiKeyFromStore(key *store.APIKey) APIKey {
+	return APIKey{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     strings.Fields(key.Scopes),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		LastUsedIP: key.LastUsedIP,
+		CreatedAt:  key.CreatedAt,
+	}
+}
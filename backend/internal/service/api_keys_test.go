@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/votex-template/backend/internal/store"
+)
+
+func TestAuthService_CreateAPIKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		scopes        []string
+		expiresInDays int
+		maxExpiry     int
+		expectedError error
+		expectedDays  int
+	}{
+		{
+			name:         "defaults to the maximum expiry",
+			scopes:       []string{"users:read", "users:read"},
+			maxExpiry:    90,
+			expectedDays: 90,
+		},
+		{
+			name:          "shorter expiry",
+			expiresInDays: 7,
+			maxExpiry:     90,
+			expectedDays:  7,
+		},
+		{
+			name:          "expiry above the maximum",
+			expiresInDays: 91,
+			maxExpiry:     90,
+			expectedError: ErrAPIKeyExpiryTooLong,
+		},
+		{
+			name: "no maximum allows keys that never expire",
+		},
+		{
+			name:          "scope the user does not hold",
+			scopes:        []string{"roles:write"},
+			maxExpiry:     90,
+			expectedError: ErrInvalidScope,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := new(MockStore)
+			cfg := testConfig()
+			cfg.APIKeyMaxExpiry = tt.maxExpiry
+			service := &AuthService{Store: mockStore, Cfg: cfg, Keys: testKeyring()}
+
+			mockStore.On("GetUserPermissions", mock.Anything, "1").Return([]string{"users:read"}, nil)
+			var stored *store.APIKey
+			mockStore.On("CreateAPIKey", mock.Anything, mock.AnythingOfType("*store.APIKey")).
+				Run(func(args mock.Arguments) { stored = args.Get(1).(*store.APIKey) }).
+				Return(nil)
+
+			created, err := service.CreateAPIKey(context.Background(), "1", "CI", tt.scopes, tt.expiresInDays)
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+				mockStore.AssertNotCalled(t, "CreateAPIKey", mock.Anything, mock.Anything)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(created.Key, store.APIKeyTokenPrefix))
+			assert.Equal(t, created.Key[:apiKeyPrefixLength], created.Prefix)
+			assert.Equal(t, hashToken(created.Key), stored.TokenHash, "only the digest is stored")
+			assert.Equal(t, "1", stored.UserID)
+			assert.Equal(t, strings.Join(created.Scopes, " "), stored.Scopes)
+			if len(tt.scopes) > 0 {
+				assert.Equal(t, []string{"users:read"}, created.Scopes)
+			}
+
+			if tt.expectedDays == 0 {
+				assert.Nil(t, stored.ExpiresAt)
+			} else {
+				expected := time.Now().Add(time.Duration(tt.expectedDays) * 24 * time.Hour)
+				assert.WithinDuration(t, expected, *stored.ExpiresAt, time.Minute)
+			}
+		})
+	}
+}
+
+func TestAuthService_ListAPIKeys(t *testing.T) {
+	mockStore := new(MockStore)
+	service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+
+	ip := "203.0.113.7"
+	mockStore.On("ListAPIKeys", mock.Anything, "1").Return([]store.APIKey{
+		{ID: "key-1", UserID: "1", Name: "CI", Prefix: "vtx_01234567", TokenHash: "digest", Scopes: "users:read users:write", LastUsedIP: &ip},
+	}, nil)
+
+	keys, err := service.ListAPIKeys(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, []string{"users:read", "users:write"}, keys[0].Scopes)
+	assert.Equal(t, &ip, keys[0].LastUsedIP)
+}
+
+func TestAuthService_RevokeAPIKey(t *testing.T) {
+	mockStore := new(MockStore)
+	service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+
+	mockStore.On("DeleteAPIKey", mock.Anything, "key-1", "1").Return(nil)
+	mockStore.On("DeleteAPIKey", mock.Anything, "key-2", "1").Return(store.ErrAPIKeyNotFound)
+
+	assert.NoError(t, service.RevokeAPIKey(context.Background(), "1", "key-1"))
+	assert.Equal(t, ErrAPIKeyNotFound, service.RevokeAPIKey(context.Background(), "1", "key-2"))
+}
@@ -1,81 +1,228 @@
 package service
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/keys"
 	"github.com/user/votex-template/backend/internal/store"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/user/votex-template/backend/pkg/oidc"
+	"github.com/user/votex-template/backend/pkg/password"
+	"github.com/user/votex-template/backend/pkg/webauthn"
 )
 
 // Error definitions
 var (
-	ErrUserExists         = errors.New("username already exists")
-	ErrEmailExists        = errors.New("email already exists")
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrUserNotFound       = errors.New("user not found")
-	ErrTokenNotFound      = errors.New("password reset token not found")
-	ErrTokenExpired       = errors.New("password reset token expired")
-	ErrTokenUsed          = errors.New("password reset token already used")
+	ErrUserExists          = errors.New("username already exists")
+	ErrEmailExists         = errors.New("email already exists")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrTokenNotFound       = errors.New("password reset token not found")
+	ErrTokenExpired        = errors.New("password reset token expired")
+	ErrTokenUsed           = errors.New("password reset token already used")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrRoleNotFound        = errors.New("role not found")
+	ErrInvalidCursor       = errors.New("invalid pagination cursor")
+	ErrMFARequired         = errors.New("two-factor authentication required")
+	ErrInvalidMFAToken     = errors.New("invalid or expired two-factor token")
+	ErrInvalidMFACode      = errors.New("invalid two-factor code")
+	ErrMFANotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+
+	ErrInvalidPasskeyCeremony = errors.New("invalid or expired passkey ceremony")
+	ErrInvalidPasskey         = errors.New("passkey verification failed")
+	ErrPasskeyExists          = errors.New("passkey already registered")
+	ErrPasskeyNotFound        = errors.New("passkey not found")
+
+	ErrUnknownOIDCProvider = errors.New("unknown identity provider")
+	ErrInvalidOIDCState    = errors.New("invalid or expired sign-in request")
+	ErrOIDCAuthFailed      = errors.New("sign-in with the identity provider failed")
+	ErrIdentityLinked      = errors.New("external account is already linked")
+	ErrIdentityNotFound    = errors.New("linked identity not found")
+	ErrLastLoginMethod     = errors.New("cannot remove the last way to sign in")
+
+	ErrClientNotFound     = errors.New("oauth client not found")
+	ErrConsentNotFound    = errors.New("oauth consent not found")
+	ErrInvalidRedirectURI = errors.New("invalid redirect uri")
+	ErrInvalidAccessToken = errors.New("invalid access token")
+
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrInvalidScope        = errors.New("scope not granted to this account")
+	ErrAPIKeyExpiryTooLong = errors.New("api key expiry exceeds the allowed maximum")
+
+	ErrEmailRequired            = errors.New("an email address is required")
+	ErrEmailNotVerified         = errors.New("email address not verified")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification link")
+	ErrInvalidEmailChangeToken  = errors.New("invalid or expired email change link")
+
+	ErrInvalidMagicLink      = errors.New("invalid or expired sign-in link")
+	ErrMagicLinkWrongBrowser = errors.New("sign-in link was requested from another browser")
+
+	ErrLoginLocked        = errors.New("too many failed login attempts")
+	ErrInvalidUnlockToken = errors.New("invalid or expired unlock link")
+
+	ErrPasswordTooLong = errors.New("password is too long for the configured hash")
+	ErrWeakPassword    = errors.New("password does not meet the password policy")
+
+	ErrQueuedEmailNotFound = errors.New("queued email not found")
 )
 
 type User struct {
-	ID        string     `json:"id"`
-	Username  string     `json:"username"`
-	Email     *string    `json:"email,omitempty"`
-	Age       *int       `json:"age,omitempty"`
-	CreatedAt *time.Time `json:"created_at,omitempty"`
-	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	ID              string     `json:"id"`
+	Username        string     `json:"username"`
+	Email           *string    `json:"email,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	PendingEmail    *string    `json:"pending_email,omitempty"`
+	Age             *int       `json:"age,omitempty"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+}
+
+// userFromStore converts a stored account to the User handed to callers,
+// leaving out the password hash.
+func userFromStore(dbUser *store.User) *User {
+	return &User{
+		ID:              dbUser.ID,
+		Username:        dbUser.Username,
+		Email:           dbUser.Email,
+		EmailVerifiedAt: dbUser.EmailVerifiedAt,
+		Age:             dbUser.Age,
+		CreatedAt:       dbUser.CreatedAt,
+		UpdatedAt:       dbUser.UpdatedAt,
+	}
+}
+
+// UserList is one page of users returned by ListUsers
+type UserList struct {
+	Users      []User
+	Total      int
+	NextCursor string
+}
+
+// AuthTokens is the credential pair handed out on login, registration and refresh.
+// The access token is a short-lived JWT bound to a session; the refresh token is
+// an opaque, single-use secret that is rotated on every refresh.
+type AuthTokens struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
 }
 
 // AuthServiceInterface defines the interface for authentication operations
 type AuthServiceInterface interface {
-	Register(username, email, password string) (string, *User, error)
-	Login(username, password string) (string, *User, error)
-	GetUserByID(userID string) (*User, error)
-	RequestPasswordReset(email string) error
-	ResetPassword(token, newPassword string) error
-	UpdateUser(userID string, updates map[string]interface{}) (*User, error)
-	DeleteUser(userID string) error
+	Register(ctx context.Context, username, email, password string) (*AuthTokens, *User, error)
+	Login(ctx context.Context, username, password, ip string) (*AuthTokens, *User, error)
+	Refresh(ctx context.Context, refreshToken string) (*AuthTokens, error)
+	Logout(ctx context.Context, sessionID string) error
+	VerifyMFA(ctx context.Context, mfaToken, code, ip string) (*AuthTokens, *User, error)
+	EnrollMFA(ctx context.Context, userID string) (*MFAEnrollment, error)
+	ConfirmMFA(ctx context.Context, userID, code string) ([]string, error)
+	DisableMFA(ctx context.Context, userID, code, ip string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID, code, ip string) ([]string, error)
+	BeginPasskeyRegistration(ctx context.Context, userID string) (*PasskeyRegistration, error)
+	FinishPasskeyRegistration(ctx context.Context, userID, sessionID, name string, resp *webauthn.RegistrationResponse) (*Passkey, error)
+	BeginPasskeyLogin(ctx context.Context, username string) (*PasskeyLogin, error)
+	FinishPasskeyLogin(ctx context.Context, sessionID string, resp *webauthn.AssertionResponse) (*AuthTokens, *User, error)
+	ListPasskeys(ctx context.Context, userID string) ([]Passkey, error)
+	DeletePasskey(ctx context.Context, userID, passkeyID string) error
+	ListOIDCProviders(ctx context.Context) []string
+	StartOIDCLogin(ctx context.Context, provider string) (*OIDCAuthorization, error)
+	CompleteOIDCLogin(ctx context.Context, provider, state, code string) (*AuthTokens, *User, error)
+	StartOIDCLink(ctx context.Context, userID, provider string) (*OIDCAuthorization, error)
+	CompleteOIDCLink(ctx context.Context, userID, provider, state, code string) (*Identity, error)
+	ListIdentities(ctx context.Context, userID string) ([]Identity, error)
+	DeleteIdentity(ctx context.Context, userID, identityID string) error
+	CreateAPIKey(ctx context.Context, userID, name string, scopes []string, expiresInDays int) (*CreatedAPIKey, error)
+	ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, keyID string) error
+	GetUserByID(ctx context.Context, userID string) (*User, error)
+	ListUsers(ctx context.Context, opts store.UserListOptions) (*UserList, error)
+	AssignRole(ctx context.Context, userID, role string) error
+	RemoveRole(ctx context.Context, userID, role string) error
+	BootstrapAdmins(ctx context.Context) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerificationEmail(ctx context.Context, email string) error
+	ConfirmEmailChange(ctx context.Context, token string) error
+	RevertEmailChange(ctx context.Context, token string) error
+	RequestMagicLink(ctx context.Context, email string) (string, error)
+	LoginWithMagicLink(ctx context.Context, token, binding string) (*AuthTokens, *User, error)
+	UnlockAccount(ctx context.Context, token string) error
+	UnlockUser(ctx context.Context, userID, actorID string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	UpdateUser(ctx context.Context, userID string, updates map[string]interface{}) (*User, error)
+	DeleteUser(ctx context.Context, userID string) error
 }
 
 type AuthService struct {
 	Store        store.StoreInterface
 	Cfg          *config.Config
 	EmailService *EmailService
+	OIDCClients  map[string]*oidc.Client // keyed by provider name
+	Keys         *keys.Keyring
+	Events       SecurityEventSink // nil logs events
+
+	// PasswordHasher hashes and verifies passwords; nil uses NewPasswordHasher
+	PasswordHasher password.Hasher
+
+	// BreachedPasswords are refused as new passwords; nil skips the check
+	BreachedPasswords *password.BreachCorpus
 }
 
-func NewAuthService(s store.StoreInterface, cfg *config.Config) AuthServiceInterface {
+func NewAuthService(s store.StoreInterface, cfg *config.Config, keyring *keys.Keyring, breaches *password.BreachCorpus, emails *EmailService) AuthServiceInterface {
 	return &AuthService{
 		Store:        s,
 		Cfg:          cfg,
-		EmailService: NewEmailService(cfg),
+		Keys:         keyring,
+		EmailService: emails,
+		OIDCClients:  newOIDCClients(cfg.OIDCProviders),
+
+		PasswordHasher:    NewPasswordHasher(cfg),
+		BreachedPasswords: breaches,
 	}
 }
 
-func (s *AuthService) Register(username, email, password string) (string, *User, error) {
+// Register creates an account and signs it in. When EMAIL_VERIFICATION is
+// login no session is started and the tokens are nil until the address has
+// been verified.
+func (s *AuthService) Register(ctx context.Context, username, email, password string) (*AuthTokens, *User, error) {
+	if email == "" && s.Cfg.EmailVerificationEnforced() {
+		return nil, nil, ErrEmailRequired
+	}
+
 	// Check if user already exists by username
-	existingUser, err := s.Store.GetUserByUsername(username)
+	existingUser, err := s.Store.GetUserByUsername(ctx, username)
 	if err == nil && existingUser != nil {
-		return "", nil, ErrUserExists
+		return nil, nil, ErrUserExists
 	}
 
 	// Check if user already exists by email
 	if email != "" {
-		existingUser, err = s.Store.GetUserByEmail(email)
+		existingUser, err = s.Store.GetUserByEmail(ctx, email)
 		if err == nil && existingUser != nil {
-			return "", nil, ErrEmailExists
+			return nil, nil, ErrEmailExists
 		}
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err := s.checkNewPassword(ctx, "", "", password, username, email); err != nil {
+		return nil, nil, err
+	}
+
+	hashedPassword, err := s.hashPassword(password)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
 	// Create user in database
@@ -85,100 +232,246 @@ func (s *AuthService) Register(username, email, password string) (string, *User,
 		Email:    &email,
 	}
 
-	err = s.Store.CreateUser(user.ID, username, email, string(hashedPassword))
+	// Create the account and its roles together so a failure never leaves a
+	// user without any role
+	err = s.Store.WithTx(ctx, func(tx store.StoreInterface) error {
+		if err := tx.CreateUser(ctx, user.ID, username, email, hashedPassword); err != nil {
+			return err
+		}
+		return s.assignInitialRoles(ctx, tx, user.ID, username)
+	})
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
-	// Send welcome email
+	// Ask the new user to confirm their address
 	if email != "" {
-		go func() {
-			if err := s.EmailService.SendWelcomeEmail(email, username); err != nil {
-				// Log error but don't fail registration
-				fmt.Printf("Failed to send welcome email: %v\n", err)
-			}
-		}()
+		token, err := s.newEmailVerificationToken(ctx, user.ID, email)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := s.EmailService.SendVerificationEmail(ctx, email, username, token); err != nil {
+			// Log error but don't fail registration; the user can ask for a new link
+			slog.Error("Failed to send verification email", "user_id", user.ID, "error", err)
+		}
 	}
 
-	token, err := s.generateToken(user.ID, username)
+	if s.Cfg.EmailVerification == config.VerifyEmailLogin {
+		return nil, user, nil
+	}
+
+	tokens, err := s.createSession(ctx, user.ID, username)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
-	return token, user, nil
+	return tokens, user, nil
 }
 
-func (s *AuthService) Login(username, password string) (string, *User, error) {
+func (s *AuthService) Login(ctx context.Context, username, password, ip string) (*AuthTokens, *User, error) {
+	// Refuse guesses while the account or client IP is locked out
+	if err := s.checkLoginLockout(ctx, username, ip); err != nil {
+		return nil, nil, err
+	}
+
 	// Get user from database
-	dbUser, err := s.Store.GetUserByUsername(username)
+	dbUser, err := s.Store.GetUserByUsername(ctx, username)
 	if err != nil {
-		return "", nil, ErrInvalidCredentials
+		s.recordLoginFailure(ctx, username, ip, nil)
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	// Verify password, upgrading an outdated hash
+	if !s.checkPassword(ctx, dbUser.ID, password, dbUser.PasswordHash) {
+		s.recordLoginFailure(ctx, username, ip, dbUser)
+		return nil, nil, ErrInvalidCredentials
 	}
+	s.clearLoginFailures(ctx, username)
 
-	// Verify password
-	err = bcrypt.CompareHashAndPassword([]byte(dbUser.PasswordHash), []byte(password))
+	if err := s.requireVerifiedEmail(dbUser); err != nil {
+		return nil, nil, err
+	}
+
+	// Accounts with two-factor enabled get an intermediate token instead of a session
+	if err := s.mfaChallenge(ctx, dbUser.ID); err != nil {
+		return nil, nil, err
+	}
+
+	user := userFromStore(dbUser)
+
+	tokens, err := s.createSession(ctx, user.ID, username)
 	if err != nil {
-		return "", nil, ErrInvalidCredentials
+		return nil, nil, err
 	}
 
-	user := &User{
-		ID:        dbUser.ID,
-		Username:  dbUser.Username,
-		Email:     dbUser.Email,
-		Age:       dbUser.Age,
-		CreatedAt: dbUser.CreatedAt,
-		UpdatedAt: dbUser.UpdatedAt,
+	return tokens, user, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. Refresh tokens are
+// single use: presenting any that was rotated away revokes the whole
+// session, logging out both the legitimate holder and whoever replayed it.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*AuthTokens, error) {
+	sessionID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.Store.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
 	}
 
-	token, err := s.generateToken(user.ID, username)
+	if time.Now().After(session.ExpiresAt) {
+		_ = s.Store.DeleteSession(ctx, session.ID)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Only a secret this session issued before counts as reuse. The session ID
+	// is no secret, so anything else is a guess that must not log the user out.
+	presentedHash := hashToken(secret)
+	if subtle.ConstantTimeCompare([]byte(presentedHash), []byte(session.RefreshTokenHash)) != 1 {
+		rotated, err := s.Store.IsRotatedRefreshToken(ctx, session.ID, presentedHash)
+		if err != nil {
+			return nil, err
+		}
+		if rotated {
+			s.revokeSession(ctx, session, "refresh token reuse detected")
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	dbUser, err := s.Store.GetUserByID(ctx, session.UserID)
 	if err != nil {
-		return "", nil, err
+		return nil, ErrInvalidRefreshToken
 	}
 
-	return token, user, nil
+	newSecret := generateSecureToken()
+	expiresAt := time.Now().Add(time.Duration(s.Cfg.RefreshTokenExpiry) * time.Hour)
+	err = s.Store.RotateSession(ctx, session.ID, presentedHash, hashToken(newSecret), expiresAt)
+	if err != nil {
+		if errors.Is(err, store.ErrSessionNotFound) {
+			// Another request rotated this token first
+			s.revokeSession(ctx, session, "concurrent refresh token use")
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, session.ID, dbUser.ID, dbUser.Username, session.ID+"."+newSecret)
+}
+
+// Logout revokes the session behind an access token. Outstanding access tokens
+// for the session stop being accepted and its refresh token can no longer be used.
+func (s *AuthService) Logout(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	return s.Store.DeleteSession(ctx, sessionID)
 }
 
-func (s *AuthService) GetUserByID(userID string) (*User, error) {
-	dbUser, err := s.Store.GetUserByID(userID)
+func (s *AuthService) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	dbUser, err := s.Store.GetUserByID(ctx, userID)
 	if err != nil {
 		return nil, ErrUserNotFound
 	}
 
-	return &User{
-		ID:        dbUser.ID,
-		Username:  dbUser.Username,
-		Email:     dbUser.Email,
-		Age:       dbUser.Age,
-		CreatedAt: dbUser.CreatedAt,
-		UpdatedAt: dbUser.UpdatedAt,
-	}, nil
+	return userFromStore(dbUser), nil
+}
+
+func (s *AuthService) ListUsers(ctx context.Context, opts store.UserListOptions) (*UserList, error) {
+	result, err := s.Store.ListUsers(ctx, opts)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			return nil, ErrInvalidCursor
+		}
+		return nil, err
+	}
+
+	list := &UserList{
+		Users:      make([]User, 0, len(result.Users)),
+		Total:      result.Total,
+		NextCursor: result.NextCursor,
+	}
+	for _, dbUser := range result.Users {
+		list.Users = append(list.Users, *userFromStore(&dbUser))
+	}
+	return list, nil
+}
+
+func (s *AuthService) AssignRole(ctx context.Context, userID, role string) error {
+	return s.Store.WithTx(ctx, func(tx store.StoreInterface) error {
+		if _, err := tx.GetUserByID(ctx, userID); err != nil {
+			return ErrUserNotFound
+		}
+
+		err := tx.AssignRole(ctx, userID, role)
+		if errors.Is(err, store.ErrRoleNotFound) {
+			return ErrRoleNotFound
+		}
+		return err
+	})
 }
 
-func (s *AuthService) RequestPasswordReset(email string) error {
+func (s *AuthService) RemoveRole(ctx context.Context, userID, role string) error {
+	return s.Store.WithTx(ctx, func(tx store.StoreInterface) error {
+		if _, err := tx.GetUserByID(ctx, userID); err != nil {
+			return ErrUserNotFound
+		}
+
+		return tx.RemoveRole(ctx, userID, role)
+	})
+}
+
+// BootstrapAdmins grants the admin role to every existing account listed in
+// the ADMIN_USERS configuration. Accounts that do not exist yet are skipped
+// rather than promoted when they register, as anyone could claim a listed
+// username first, including through a provider's preferred_username.
+func (s *AuthService) BootstrapAdmins(ctx context.Context) error {
+	for _, username := range s.Cfg.AdminUsers {
+		dbUser, err := s.Store.GetUserByUsername(ctx, username)
+		if err != nil {
+			continue
+		}
+		if err := s.Store.AssignRole(ctx, dbUser.ID, store.RoleAdmin); err != nil {
+			return fmt.Errorf("failed to grant admin role to %s: %w", username, err)
+		}
+		slog.Info("Granted admin role from configuration", "username", username)
+	}
+	return nil
+}
+
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email string) error {
 	// Get user by email
-	user, err := s.Store.GetUserByEmail(email)
+	user, err := s.Store.GetUserByEmail(ctx, email)
 	if err != nil {
 		// Don't reveal if email exists or not for security
 		return nil
 	}
 
+	// Once verification is enforced only a proven address can take over an
+	// account
+	if user.EmailVerifiedAt == nil && s.Cfg.EmailVerificationEnforced() {
+		return nil
+	}
+
 	// Generate reset token
 	token := generateSecureToken()
 	expiresAt := time.Now().Add(time.Duration(s.Cfg.PasswordResetTokenExpiry) * time.Hour)
 
 	// Store reset token
-	err = s.Store.CreatePasswordResetToken(generateID(), user.ID, token, expiresAt)
+	err = s.Store.CreatePasswordResetToken(ctx, generateID(), user.ID, token, expiresAt)
 	if err != nil {
 		return err
 	}
 
 	// Send password reset email
-	return s.EmailService.SendPasswordResetEmail(email, token)
+	return s.EmailService.SendPasswordResetEmail(ctx, email, token)
 }
 
-func (s *AuthService) ResetPassword(token, newPassword string) error {
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
 	// Get reset token
-	resetToken, err := s.Store.GetPasswordResetToken(token)
+	resetToken, err := s.Store.GetPasswordResetToken(ctx, token)
 	if err != nil {
 		return ErrTokenNotFound
 	}
@@ -193,68 +486,191 @@ func (s *AuthService) ResetPassword(token, newPassword string) error {
 		return ErrTokenUsed
 	}
 
+	// Only load the account when the policy needs to know about it
+	var oldHash string
+	var userInputs []string
+	if s.Cfg.PasswordHistory > 0 || s.Cfg.PasswordRejectUserInfo {
+		user, err := s.Store.GetUserByID(ctx, resetToken.UserID)
+		if err != nil {
+			return err
+		}
+		oldHash = user.PasswordHash
+		userInputs = append(userInputs, user.Username)
+		if user.Email != nil {
+			userInputs = append(userInputs, *user.Email)
+		}
+	}
+	if err := s.checkNewPassword(ctx, resetToken.UserID, oldHash, newPassword, userInputs...); err != nil {
+		return err
+	}
+
 	// Hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hashedPassword, err := s.hashPassword(newPassword)
 	if err != nil {
 		return err
 	}
 
-	// Update user password
-	updates := map[string]interface{}{
-		"password_hash": string(hashedPassword),
+	return s.Store.WithTx(ctx, func(tx store.StoreInterface) error {
+		// Consume the token first; a concurrent reset with the same token
+		// loses here and rolls back without touching the password
+		if err := tx.MarkPasswordResetTokenUsed(ctx, resetToken.ID); err != nil {
+			if errors.Is(err, store.ErrTokenNotFound) {
+				return ErrTokenUsed
+			}
+			return err
+		}
+
+		// Update user password
+		updates := map[string]interface{}{
+			"password_hash": hashedPassword,
+		}
+		if err := tx.UpdateUser(ctx, resetToken.UserID, updates); err != nil {
+			return err
+		}
+		if err := s.rememberPassword(ctx, tx, resetToken.UserID, oldHash); err != nil {
+			return err
+		}
+
+		// Sign out every existing session now that the old password is gone
+		return tx.DeleteUserSessions(ctx, resetToken.UserID)
+	})
+}
+
+// UpdateUser applies profile changes. A new email address is not written
+// directly: it is returned as PendingEmail until confirmed from that address.
+func (s *AuthService) UpdateUser(ctx context.Context, userID string, updates map[string]interface{}) (*User, error) {
+	fields := make(map[string]interface{}, len(updates))
+	for column, value := range updates {
+		fields[column] = value
+	}
+
+	newEmail, changeEmail := fields["email"].(string)
+	delete(fields, "email")
+	if changeEmail {
+		if newEmail == "" {
+			return nil, ErrEmailRequired
+		}
+		if err := s.requestEmailChange(ctx, userID, newEmail); err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.Store.WithTx(ctx, func(tx store.StoreInterface) error {
+		// Check if user exists
+		if _, err := tx.GetUserByID(ctx, userID); err != nil {
+			return ErrUserNotFound
+		}
+
+		// Update user
+		return tx.UpdateUser(ctx, userID, fields)
+	})
+	if err != nil {
+		return nil, err
 	}
-	err = s.Store.UpdateUser(resetToken.UserID, updates)
+
+	// Get updated user
+	user, err := s.GetUserByID(ctx, userID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if changeEmail && (user.Email == nil || *user.Email != newEmail) {
+		user.PendingEmail = &newEmail
+	}
+	return user, nil
+}
+
+func (s *AuthService) DeleteUser(ctx context.Context, userID string) error {
+	return s.Store.WithTx(ctx, func(tx store.StoreInterface) error {
+		// Check if user exists
+		if _, err := tx.GetUserByID(ctx, userID); err != nil {
+			return ErrUserNotFound
+		}
+
+		return tx.DeleteUser(ctx, userID)
+	})
+}
+
+// createSession starts a new refresh token family for the user and returns
+// the first token pair issued for it.
+func (s *AuthService) createSession(ctx context.Context, userID, username string) (*AuthTokens, error) {
+	sessionID := generateID()
+	secret := generateSecureToken()
+	expiresAt := time.Now().Add(time.Duration(s.Cfg.RefreshTokenExpiry) * time.Hour)
+
+	if err := s.Store.CreateSession(ctx, sessionID, userID, hashToken(secret), expiresAt); err != nil {
+		return nil, err
 	}
 
-	// Mark token as used
-	return s.Store.MarkPasswordResetTokenUsed(resetToken.ID)
+	return s.issueTokens(ctx, sessionID, userID, username, sessionID+"."+secret)
 }
 
-func (s *AuthService) UpdateUser(userID string, updates map[string]interface{}) (*User, error) {
-	// Check if user exists
-	_, err := s.Store.GetUserByID(userID)
+func (s *AuthService) issueTokens(ctx context.Context, sessionID, userID, username, refreshToken string) (*AuthTokens, error) {
+	expiresAt := time.Now().Add(time.Duration(s.Cfg.AccessTokenExpiry) * time.Minute)
+
+	roles, err := s.Store.GetUserRoles(ctx, userID)
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, err
+	}
+	permissions, err := s.Store.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Update user
-	err = s.Store.UpdateUser(userID, updates)
+	accessToken, err := s.generateToken(sessionID, userID, username, roles, permissions, expiresAt)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get updated user
-	return s.GetUserByID(userID)
+	return &AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
 }
 
-func (s *AuthService) DeleteUser(userID string) error {
-	// Check if user exists
-	_, err := s.Store.GetUserByID(userID)
+// assignInitialRoles gives a new account the default role, and the admin role
+// when it is the first account on the instance
+func (s *AuthService) assignInitialRoles(ctx context.Context, tx store.StoreInterface, userID, username string) error {
+	if err := tx.AssignRole(ctx, userID, store.RoleUser); err != nil {
+		return err
+	}
+
+	first, err := tx.ClaimAdminBootstrap(ctx, userID)
 	if err != nil {
-		return ErrUserNotFound
+		return err
+	}
+	if first {
+		slog.Info("Granting admin role to the first account", "username", username)
+		return tx.AssignRole(ctx, userID, store.RoleAdmin)
 	}
+	return nil
+}
 
-	return s.Store.DeleteUser(userID)
+// revokeSession deletes a session after its refresh token was misused
+func (s *AuthService) revokeSession(ctx context.Context, session *store.Session, reason string) {
+	slog.Warn("Revoking session", "session_id", session.ID, "user_id", session.UserID, "reason", reason)
+	if err := s.Store.DeleteSession(ctx, session.ID); err != nil {
+		slog.Error("Failed to revoke session", "session_id", session.ID, "error", err)
+	}
 }
 
-func (s *AuthService) generateToken(userID, username string) (string, error) {
+func (s *AuthService) generateToken(sessionID, userID, username string, roles, permissions []string, expiresAt time.Time) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id":  userID,
-		"username": username,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
-		"iat":      time.Now().Unix(),
+		"user_id":     userID,
+		"username":    username,
+		"sid":         sessionID,
+		"roles":       roles,
+		"permissions": permissions,
+		"exp":         expiresAt.Unix(),
+		"iat":         time.Now().Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.Cfg.JWTSecret))
+	return s.Keys.Sign(claims, "JWT")
 }
 
-// generateID creates a simple ID for demo purposes
-// In production, use a proper UUID library
+// generateID creates a random UUID for new records
 func generateID() string {
-	return time.Now().Format("20060102150405")
+	return uuid.NewString()
 }
 
 // generateSecureToken creates a secure random token
@@ -263,3 +679,9 @@ func generateSecureToken() string {
 	rand.Read(bytes)
 	return hex.EncodeToString(bytes)
 }
+
+// hashToken returns the SHA-256 hex digest stored in place of a secret token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,13 +1,18 @@
 package service
 
 import (
+	"context"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/keys"
 	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/mail"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // MockStore is a mock implementation of StoreInterface
@@ -15,96 +20,715 @@ type MockStore struct {
 	mock.Mock
 }
 
-func (m *MockStore) CreateUser(id, username, email, passwordHash string) error {
-	args := m.Called(id, username, email, passwordHash)
+func (m *MockStore) CreateUser(ctx context.Context, id, username, email, passwordHash string) error {
+	args := m.Called(ctx, id, username, email, passwordHash)
 	return args.Error(0)
 }
 
-func (m *MockStore) GetUserByUsername(username string) (*store.User, error) {
-	args := m.Called(username)
+func (m *MockStore) GetUserByUsername(ctx context.Context, username string) (*store.User, error) {
+	args := m.Called(ctx, username)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*store.User), args.Error(1)
 }
 
-func (m *MockStore) GetUserByEmail(email string) (*store.User, error) {
-	args := m.Called(email)
+func (m *MockStore) GetUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	args := m.Called(ctx, email)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*store.User), args.Error(1)
 }
 
-func (m *MockStore) GetUserByID(id string) (*store.User, error) {
-	args := m.Called(id)
+func (m *MockStore) GetUserByID(ctx context.Context, id string) (*store.User, error) {
+	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*store.User), args.Error(1)
 }
 
-func (m *MockStore) UpdateUser(id string, updates map[string]interface{}) error {
-	args := m.Called(id, updates)
+func (m *MockStore) ListUsers(ctx context.Context, opts store.UserListOptions) (*store.UserList, error) {
+	args := m.Called(ctx, opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.UserList), args.Error(1)
+}
+
+func (m *MockStore) UpdateUser(ctx context.Context, id string, updates map[string]interface{}) error {
+	args := m.Called(ctx, id, updates)
 	return args.Error(0)
 }
 
-func (m *MockStore) DeleteUser(id string) error {
-	args := m.Called(id)
+func (m *MockStore) DeleteUser(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
-func (m *MockStore) CreatePasswordResetToken(id, userID, token string, expiresAt time.Time) error {
-	args := m.Called(id, userID, token, expiresAt)
+func (m *MockStore) CreatePasswordResetToken(ctx context.Context, id, userID, token string, expiresAt time.Time) error {
+	args := m.Called(ctx, id, userID, token, expiresAt)
 	return args.Error(0)
 }
 
-func (m *MockStore) GetPasswordResetToken(token string) (*store.PasswordResetToken, error) {
-	args := m.Called(token)
+func (m *MockStore) GetPasswordResetToken(ctx context.Context, token string) (*store.PasswordResetToken, error) {
+	args := m.Called(ctx, token)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*store.PasswordResetToken), args.Error(1)
 }
 
-func (m *MockStore) MarkPasswordResetTokenUsed(token string) error {
-	args := m.Called(token)
+func (m *MockStore) MarkPasswordResetTokenUsed(ctx context.Context, token string) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockStore) CleanupExpiredPasswordResetTokens(ctx context.Context) error {
+	args := m.Called(ctx)
 	return args.Error(0)
 }
 
-func (m *MockStore) UpdateUserPassword(userID, passwordHash string) error {
-	args := m.Called(userID, passwordHash)
+func (m *MockStore) CreateSession(ctx context.Context, id, userID, refreshTokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, id, userID, refreshTokenHash, expiresAt)
 	return args.Error(0)
 }
 
-func (m *MockStore) CleanupExpiredTokens() error {
-	args := m.Called()
+func (m *MockStore) GetSession(ctx context.Context, id string) (*store.Session, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.Session), args.Error(1)
+}
+
+func (m *MockStore) RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, id, oldHash, newHash, expiresAt)
 	return args.Error(0)
 }
 
-func (m *MockStore) CleanupExpiredPasswordResetTokens() error {
-	args := m.Called()
+func (m *MockStore) IsRotatedRefreshToken(ctx context.Context, sessionID, tokenHash string) (bool, error) {
+	args := m.Called(ctx, sessionID, tokenHash)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) DeleteSession(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
-func (m *MockStore) CreateSession(id, userID string, expiresAt string) error {
-	args := m.Called(id, userID, expiresAt)
+func (m *MockStore) DeleteUserSessions(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
 	return args.Error(0)
 }
 
-func (m *MockStore) GetSession(id string) (*store.Session, error) {
-	args := m.Called(id)
+func (m *MockStore) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	args := m.Called(ctx, userID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*store.Session), args.Error(1)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStore) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStore) AssignRole(ctx context.Context, userID, role string) error {
+	args := m.Called(ctx, userID, role)
+	return args.Error(0)
+}
+
+func (m *MockStore) RemoveRole(ctx context.Context, userID, role string) error {
+	args := m.Called(ctx, userID, role)
+	return args.Error(0)
+}
+
+func (m *MockStore) ClaimAdminBootstrap(ctx context.Context, userID string) (bool, error) {
+	args := m.Called(ctx, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) GetUserMFA(ctx context.Context, userID string) (*store.UserMFA, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.UserMFA), args.Error(1)
+}
+
+func (m *MockStore) SaveMFASecret(ctx context.Context, userID, secret string) error {
+	args := m.Called(ctx, userID, secret)
+	return args.Error(0)
+}
+
+func (m *MockStore) EnableMFA(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockStore) UseMFAStep(ctx context.Context, userID string, step int64) error {
+	args := m.Called(ctx, userID, step)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteUserMFA(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockStore) CreateRecoveryCode(ctx context.Context, id, userID, codeHash string) error {
+	args := m.Called(ctx, id, userID, codeHash)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteRecoveryCodes(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockStore) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	args := m.Called(ctx, userID, codeHash)
+	return args.Error(0)
+}
+
+func (m *MockStore) CreateMFAChallenge(ctx context.Context, challenge *store.MFAChallenge) error {
+	args := m.Called(ctx, challenge)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetMFAChallenge(ctx context.Context, tokenHash string) (*store.MFAChallenge, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.MFAChallenge), args.Error(1)
+}
+
+func (m *MockStore) UseMFAChallengeAttempt(ctx context.Context, id string, maxAttempts int) error {
+	args := m.Called(ctx, id, maxAttempts)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteMFAChallenge(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockStore) CleanupExpiredMFAChallenges(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockStore) CreateWebAuthnCredential(ctx context.Context, cred *store.WebAuthnCredential) error {
+	args := m.Called(ctx, cred)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetWebAuthnCredential(ctx context.Context, credentialID string) (*store.WebAuthnCredential, error) {
+	args := m.Called(ctx, credentialID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.WebAuthnCredential), args.Error(1)
+}
+
+func (m *MockStore) ListWebAuthnCredentials(ctx context.Context, userID string) ([]store.WebAuthnCredential, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.WebAuthnCredential), args.Error(1)
+}
+
+func (m *MockStore) UpdateWebAuthnSignCount(ctx context.Context, id string, oldCount, newCount int64) error {
+	args := m.Called(ctx, id, oldCount, newCount)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteWebAuthnCredential(ctx context.Context, id, userID string) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
+}
+
+func (m *MockStore) CreateWebAuthnChallenge(ctx context.Context, id, userID, ceremony, challenge string, expiresAt time.Time) error {
+	args := m.Called(ctx, id, userID, ceremony, challenge, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockStore) TakeWebAuthnChallenge(ctx context.Context, id string) (*store.WebAuthnChallenge, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.WebAuthnChallenge), args.Error(1)
+}
+
+func (m *MockStore) CleanupExpiredWebAuthnChallenges(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockStore) CreateUserIdentity(ctx context.Context, identity *store.UserIdentity) error {
+	args := m.Called(ctx, identity)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetUserIdentity(ctx context.Context, provider, subject string) (*store.UserIdentity, error) {
+	args := m.Called(ctx, provider, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.UserIdentity), args.Error(1)
+}
+
+func (m *MockStore) ListUserIdentities(ctx context.Context, userID string) ([]store.UserIdentity, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.UserIdentity), args.Error(1)
+}
+
+func (m *MockStore) RecordUserIdentityLogin(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteUserIdentity(ctx context.Context, id, userID string) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
+}
+
+func (m *MockStore) CreateOIDCAuthRequest(ctx context.Context, req *store.OIDCAuthRequest) error {
+	args := m.Called(ctx, req)
+	return args.Error(0)
+}
+
+func (m *MockStore) TakeOIDCAuthRequest(ctx context.Context, id string) (*store.OIDCAuthRequest, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.OIDCAuthRequest), args.Error(1)
+}
+
+func (m *MockStore) CleanupExpiredOIDCAuthRequests(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockStore) CreateOAuthClient(ctx context.Context, client *store.OAuthClient) error {
+	args := m.Called(ctx, client)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetOAuthClient(ctx context.Context, id string) (*store.OAuthClient, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.OAuthClient), args.Error(1)
+}
+
+func (m *MockStore) ListOAuthClients(ctx context.Context) ([]store.OAuthClient, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.OAuthClient), args.Error(1)
+}
+
+func (m *MockStore) DeleteOAuthClient(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetOAuthConsent(ctx context.Context, userID, clientID string) (*store.OAuthConsent, error) {
+	args := m.Called(ctx, userID, clientID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.OAuthConsent), args.Error(1)
+}
+
+func (m *MockStore) ListOAuthConsents(ctx context.Context, userID string) ([]store.OAuthConsent, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.OAuthConsent), args.Error(1)
+}
+
+func (m *MockStore) SaveOAuthConsent(ctx context.Context, userID, clientID, scopes string) error {
+	args := m.Called(ctx, userID, clientID, scopes)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteOAuthConsent(ctx context.Context, userID, clientID string) error {
+	args := m.Called(ctx, userID, clientID)
+	return args.Error(0)
+}
+
+func (m *MockStore) CreateOAuthCode(ctx context.Context, code *store.OAuthCode) error {
+	args := m.Called(ctx, code)
+	return args.Error(0)
+}
+
+func (m *MockStore) TakeOAuthCode(ctx context.Context, id string) (*store.OAuthCode, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.OAuthCode), args.Error(1)
+}
+
+func (m *MockStore) CleanupExpiredOAuthCodes(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockStore) CreateSigningKey(ctx context.Context, key *store.SigningKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockStore) ListSigningKeys(ctx context.Context) ([]store.SigningKey, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.SigningKey), args.Error(1)
+}
+
+func (m *MockStore) RetireSigningKeys(ctx context.Context, exceptID string, expiresAt time.Time) error {
+	args := m.Called(ctx, exceptID, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteExpiredSigningKeys(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockStore) CreateAPIKey(ctx context.Context, key *store.APIKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetAPIKeyByHash(ctx context.Context, tokenHash string) (*store.APIKey, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.APIKey), args.Error(1)
+}
+
+func (m *MockStore) ListAPIKeys(ctx context.Context, userID string) ([]store.APIKey, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.APIKey), args.Error(1)
+}
+
+func (m *MockStore) TouchAPIKey(ctx context.Context, id, ip string) error {
+	args := m.Called(ctx, id, ip)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteAPIKey(ctx context.Context, id, userID string) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteUserAPIKeys(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockStore) CreateEmailVerificationToken(ctx context.Context, token *store.EmailVerificationToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetEmailVerificationToken(ctx context.Context, tokenHash string) (*store.EmailVerificationToken, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.EmailVerificationToken), args.Error(1)
+}
+
+func (m *MockStore) LatestEmailVerificationToken(ctx context.Context, userID string) (*store.EmailVerificationToken, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.EmailVerificationToken), args.Error(1)
+}
+
+func (m *MockStore) MarkEmailVerificationTokenUsed(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockStore) MarkEmailVerified(ctx context.Context, userID, email string) error {
+	args := m.Called(ctx, userID, email)
+	return args.Error(0)
+}
+
+func (m *MockStore) CleanupExpiredEmailVerificationTokens(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockStore) CreateEmailChange(ctx context.Context, change *store.EmailChange) error {
+	args := m.Called(ctx, change)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetEmailChangeByConfirmHash(ctx context.Context, tokenHash string) (*store.EmailChange, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.EmailChange), args.Error(1)
+}
+
+func (m *MockStore) GetEmailChangeByRevertHash(ctx context.Context, tokenHash string) (*store.EmailChange, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.EmailChange), args.Error(1)
+}
+
+func (m *MockStore) CancelPendingEmailChanges(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockStore) ConfirmEmailChange(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
 }
 
-func (m *MockStore) DeleteSession(id string) error {
-	args := m.Called(id)
+func (m *MockStore) RevertEmailChange(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
+func (m *MockStore) ChangeUserEmail(ctx context.Context, userID, email string) error {
+	args := m.Called(ctx, userID, email)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteExpiredEmailChanges(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeletePasswordResetTokens(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetLoginThrottle(ctx context.Context, scope, subject string) (*store.LoginThrottle, error) {
+	args := m.Called(ctx, scope, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.LoginThrottle), args.Error(1)
+}
+
+func (m *MockStore) GetLoginThrottleByUnlockHash(ctx context.Context, tokenHash string) (*store.LoginThrottle, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.LoginThrottle), args.Error(1)
+}
+
+func (m *MockStore) RecordLoginFailure(ctx context.Context, scope, subject string) (*store.LoginThrottle, error) {
+	args := m.Called(ctx, scope, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.LoginThrottle), args.Error(1)
+}
+
+func (m *MockStore) LockLogin(ctx context.Context, scope, subject string, until time.Time, unlockTokenHash *string) error {
+	args := m.Called(ctx, scope, subject, until, unlockTokenHash)
+	return args.Error(0)
+}
+
+func (m *MockStore) ClearLoginFailures(ctx context.Context, scope, subject string) error {
+	args := m.Called(ctx, scope, subject)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteStaleLoginThrottles(ctx context.Context, before time.Time) error {
+	args := m.Called(ctx, before)
+	return args.Error(0)
+}
+
+func (m *MockStore) AddPasswordHistory(ctx context.Context, userID, passwordHash string) error {
+	args := m.Called(ctx, userID, passwordHash)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetPasswordHistory(ctx context.Context, userID string, limit int) ([]string, error) {
+	args := m.Called(ctx, userID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStore) PrunePasswordHistory(ctx context.Context, userID string, keep int) error {
+	args := m.Called(ctx, userID, keep)
+	return args.Error(0)
+}
+
+func (m *MockStore) CreateMagicLinkToken(ctx context.Context, token *store.MagicLinkToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetMagicLinkToken(ctx context.Context, tokenHash string) (*store.MagicLinkToken, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.MagicLinkToken), args.Error(1)
+}
+
+func (m *MockStore) MarkMagicLinkTokenUsed(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockStore) CleanupExpiredMagicLinkTokens(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockStore) EnqueueEmail(ctx context.Context, email *store.OutboxEmail) error {
+	args := m.Called(ctx, email)
+	return args.Error(0)
+}
+
+func (m *MockStore) ClaimOutboxEmail(ctx context.Context, leaseUntil time.Time) (*store.OutboxEmail, error) {
+	args := m.Called(ctx, leaseUntil)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.OutboxEmail), args.Error(1)
+}
+
+func (m *MockStore) DeleteOutboxEmail(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockStore) RetryOutboxEmail(ctx context.Context, id string, next time.Time, lastError string) error {
+	args := m.Called(ctx, id, next, lastError)
+	return args.Error(0)
+}
+
+func (m *MockStore) KillOutboxEmail(ctx context.Context, id, lastError string) error {
+	args := m.Called(ctx, id, lastError)
+	return args.Error(0)
+}
+
+func (m *MockStore) ListOutboxEmails(ctx context.Context, status string, limit, offset int) (*store.OutboxEmailList, error) {
+	args := m.Called(ctx, status, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.OutboxEmailList), args.Error(1)
+}
+
+func (m *MockStore) CountOutboxEmails(ctx context.Context) (map[string]int, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
+func (m *MockStore) RequeueOutboxEmail(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockStore) WithTx(ctx context.Context, fn func(store.StoreInterface) error) error {
+	// Run the unit of work against the mock itself so expectations still apply
+	return fn(m)
+}
+
+// expectLoginThrottle sets up the lockout bookkeeping around a password login
+// for an account that has no failed logins counted against it
+func expectLoginThrottle(mockStore *MockStore) {
+	mockStore.On("GetLoginThrottle", mock.Anything, mock.Anything, mock.Anything).Return(nil, store.ErrLoginThrottleNotFound).Maybe()
+	mockStore.On("ClearLoginFailures", mock.Anything, store.LoginScopeAccount, mock.Anything).Return(nil).Maybe()
+	mockStore.On("DeleteStaleLoginThrottles", mock.Anything, mock.Anything).Return(nil).Maybe()
+	mockStore.On("RecordLoginFailure", mock.Anything, mock.Anything, mock.Anything).
+		Return(&store.LoginThrottle{Failures: 1}, nil).Maybe()
+}
+
+// expectTokenIssue sets up the role lookups performed whenever an access token is minted
+func expectTokenIssue(mockStore *MockStore, userID string) {
+	mockStore.On("GetUserRoles", mock.Anything, userID).Return([]string{"user"}, nil)
+	mockStore.On("GetUserPermissions", mock.Anything, userID).Return([]string{}, nil)
+}
+
+func testConfig() *config.Config {
+	return &config.Config{
+		AccessTokenExpiry:        15,
+		RefreshTokenExpiry:       720,
+		PasswordResetTokenExpiry: 24,
+		AppURL:                   "http://localhost:5173",
+
+		SMTPFrom:     "noreply@example.com",
+		EmailTimeout: 30,
+
+		EmailVerification:               config.VerifyEmailOptional,
+		EmailVerificationTokenExpiry:    48,
+		EmailVerificationResendInterval: 5,
+
+		MagicLinkTokenExpiry: 15,
+
+		LockoutThreshold:   5,
+		LockoutIPThreshold: 20,
+		LockoutDuration:    5,
+		LockoutMaxDuration: 1440,
+		LockoutWindow:      60,
+
+		// Hashes from mustHash are current, so logins do not rehash
+		PasswordHash:      "bcrypt",
+		BcryptCost:        bcrypt.MinCost,
+		Argon2Memory:      1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	}
+}
+
+// testKeyring returns a keyring with a fresh Ed25519 signing key
+func testKeyring() *keys.Keyring {
+	key, err := keys.GenerateKey(keys.EdDSA)
+	if err != nil {
+		panic(err)
+	}
+	return keys.NewStatic(key)
+}
+
 func TestAuthService_Register(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -120,9 +744,36 @@ func TestAuthService_Register(t *testing.T) {
 			email:    "test@example.com",
 			password: "password123",
 			setupMock: func(mockStore *MockStore) {
-				mockStore.On("GetUserByUsername", "testuser").Return(nil, assert.AnError)
-				mockStore.On("GetUserByEmail", "test@example.com").Return(nil, assert.AnError)
-				mockStore.On("CreateUser", mock.AnythingOfType("string"), "testuser", "test@example.com", mock.AnythingOfType("string")).Return(nil)
+				mockStore.On("GetUserByUsername", mock.Anything, "testuser").Return(nil, assert.AnError)
+				mockStore.On("GetUserByEmail", mock.Anything, "test@example.com").Return(nil, assert.AnError)
+				mockStore.On("CreateUser", mock.Anything, mock.AnythingOfType("string"), "testuser", "test@example.com", mock.AnythingOfType("string")).Return(nil)
+				mockStore.On("AssignRole", mock.Anything, mock.AnythingOfType("string"), "user").Return(nil)
+				mockStore.On("ClaimAdminBootstrap", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+				mockStore.On("CleanupExpiredEmailVerificationTokens", mock.Anything).Return(nil)
+				mockStore.On("CreateEmailVerificationToken", mock.Anything, mock.AnythingOfType("*store.EmailVerificationToken")).Return(nil)
+				mockStore.On("CreateSession", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
+				mockStore.On("GetUserRoles", mock.Anything, mock.AnythingOfType("string")).Return([]string{"user"}, nil)
+				mockStore.On("GetUserPermissions", mock.Anything, mock.AnythingOfType("string")).Return([]string{}, nil)
+			},
+			expectedError: nil,
+		},
+		{
+			name:     "first user becomes admin",
+			username: "founder",
+			email:    "founder@example.com",
+			password: "password123",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetUserByUsername", mock.Anything, "founder").Return(nil, assert.AnError)
+				mockStore.On("GetUserByEmail", mock.Anything, "founder@example.com").Return(nil, assert.AnError)
+				mockStore.On("CreateUser", mock.Anything, mock.AnythingOfType("string"), "founder", "founder@example.com", mock.AnythingOfType("string")).Return(nil)
+				mockStore.On("AssignRole", mock.Anything, mock.AnythingOfType("string"), "user").Return(nil)
+				mockStore.On("ClaimAdminBootstrap", mock.Anything, mock.AnythingOfType("string")).Return(true, nil)
+				mockStore.On("AssignRole", mock.Anything, mock.AnythingOfType("string"), "admin").Return(nil)
+				mockStore.On("CleanupExpiredEmailVerificationTokens", mock.Anything).Return(nil)
+				mockStore.On("CreateEmailVerificationToken", mock.Anything, mock.AnythingOfType("*store.EmailVerificationToken")).Return(nil)
+				mockStore.On("CreateSession", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
+				mockStore.On("GetUserRoles", mock.Anything, mock.AnythingOfType("string")).Return([]string{"admin", "user"}, nil)
+				mockStore.On("GetUserPermissions", mock.Anything, mock.AnythingOfType("string")).Return([]string{"users:read"}, nil)
 			},
 			expectedError: nil,
 		},
@@ -133,7 +784,7 @@ func TestAuthService_Register(t *testing.T) {
 			password: "password123",
 			setupMock: func(mockStore *MockStore) {
 				existingUser := &store.User{ID: "1", Username: "existinguser"}
-				mockStore.On("GetUserByUsername", "existinguser").Return(existingUser, nil)
+				mockStore.On("GetUserByUsername", mock.Anything, "existinguser").Return(existingUser, nil)
 			},
 			expectedError: ErrUserExists,
 		},
@@ -143,9 +794,9 @@ func TestAuthService_Register(t *testing.T) {
 			email:    "existing@example.com",
 			password: "password123",
 			setupMock: func(mockStore *MockStore) {
-				mockStore.On("GetUserByUsername", "newuser").Return(nil, assert.AnError)
+				mockStore.On("GetUserByUsername", mock.Anything, "newuser").Return(nil, assert.AnError)
 				existingUser := &store.User{ID: "1", Email: stringPtr("existing@example.com")}
-				mockStore.On("GetUserByEmail", "existing@example.com").Return(existingUser, nil)
+				mockStore.On("GetUserByEmail", mock.Anything, "existing@example.com").Return(existingUser, nil)
 			},
 			expectedError: ErrEmailExists,
 		},
@@ -156,26 +807,25 @@ func TestAuthService_Register(t *testing.T) {
 			mockStore := &MockStore{}
 			tt.setupMock(mockStore)
 
-			cfg := &config.Config{
-				PasswordResetTokenExpiry: 24,
-				AppURL:                   "http://localhost:5173",
-			}
+			cfg := testConfig()
 
 			service := &AuthService{
 				Store:        mockStore,
 				Cfg:          cfg,
-				EmailService: NewEmailService(cfg),
+				EmailService: NewEmailService(cfg, &mail.Memory{}),
+				Keys:         testKeyring(),
 			}
 
-			token, user, err := service.Register(tt.username, tt.email, tt.password)
+			tokens, user, err := service.Register(context.Background(), tt.username, tt.email, tt.password)
 
 			if tt.expectedError != nil {
 				assert.Equal(t, tt.expectedError, err)
-				assert.Empty(t, token)
+				assert.Nil(t, tokens)
 				assert.Nil(t, user)
 			} else {
 				assert.NoError(t, err)
-				assert.NotEmpty(t, token)
+				assert.NotEmpty(t, tokens.AccessToken)
+				assert.NotEmpty(t, tokens.RefreshToken)
 				assert.NotNil(t, user)
 				assert.Equal(t, tt.username, user.Username)
 				assert.Equal(t, tt.email, *user.Email)
@@ -199,23 +849,40 @@ func TestAuthService_Login(t *testing.T) {
 			username: "testuser",
 			password: "password123",
 			setupMock: func(mockStore *MockStore) {
-				hashedPassword := "$2a$10$abcdefghijklmnopqrstuvwxyz1234567890abcdefghijklmnopqrstuvwxyz1234567890"
+				hashedPassword := mustHash(t, "password123")
 				user := &store.User{
 					ID:           "1",
 					Username:     "testuser",
 					PasswordHash: hashedPassword,
 					Email:        stringPtr("test@example.com"),
 				}
-				mockStore.On("GetUserByUsername", "testuser").Return(user, nil)
+				mockStore.On("GetUserByUsername", mock.Anything, "testuser").Return(user, nil)
+				mockStore.On("GetUserMFA", mock.Anything, "1").Return(nil, store.ErrMFANotFound)
+				mockStore.On("CreateSession", mock.Anything, mock.AnythingOfType("string"), "1", mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
+				expectTokenIssue(mockStore, "1")
 			},
 			expectedError: nil,
 		},
+		{
+			name:     "wrong password",
+			username: "testuser",
+			password: "wrongpassword",
+			setupMock: func(mockStore *MockStore) {
+				user := &store.User{
+					ID:           "1",
+					Username:     "testuser",
+					PasswordHash: mustHash(t, "password123"),
+				}
+				mockStore.On("GetUserByUsername", mock.Anything, "testuser").Return(user, nil)
+			},
+			expectedError: ErrInvalidCredentials,
+		},
 		{
 			name:     "user not found",
 			username: "nonexistent",
 			password: "password123",
 			setupMock: func(mockStore *MockStore) {
-				mockStore.On("GetUserByUsername", "nonexistent").Return(nil, assert.AnError)
+				mockStore.On("GetUserByUsername", mock.Anything, "nonexistent").Return(nil, assert.AnError)
 			},
 			expectedError: ErrInvalidCredentials,
 		},
@@ -225,27 +892,26 @@ func TestAuthService_Login(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			mockStore := &MockStore{}
 			tt.setupMock(mockStore)
+			expectLoginThrottle(mockStore)
 
-			cfg := &config.Config{
-				PasswordResetTokenExpiry: 24,
-				AppURL:                   "http://localhost:5173",
-			}
+			cfg := testConfig()
 
 			service := &AuthService{
 				Store:        mockStore,
 				Cfg:          cfg,
-				EmailService: NewEmailService(cfg),
+				EmailService: NewEmailService(cfg, &mail.Memory{}),
+				Keys:         testKeyring(),
 			}
 
-			token, user, err := service.Login(tt.username, tt.password)
+			tokens, user, err := service.Login(context.Background(), tt.username, tt.password, "192.0.2.1")
 
 			if tt.expectedError != nil {
 				assert.Equal(t, tt.expectedError, err)
-				assert.Empty(t, token)
+				assert.Nil(t, tokens)
 				assert.Nil(t, user)
 			} else {
 				assert.NoError(t, err)
-				assert.NotEmpty(t, token)
+				assert.NotEmpty(t, tokens.AccessToken)
 				assert.NotNil(t, user)
 				assert.Equal(t, tt.username, user.Username)
 			}
@@ -271,8 +937,8 @@ func TestAuthService_RequestPasswordReset(t *testing.T) {
 					Username: "testuser",
 					Email:    stringPtr("test@example.com"),
 				}
-				mockStore.On("GetUserByEmail", "test@example.com").Return(user, nil)
-				mockStore.On("CreatePasswordResetToken", mock.AnythingOfType("string"), "1", mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
+				mockStore.On("GetUserByEmail", mock.Anything, "test@example.com").Return(user, nil)
+				mockStore.On("CreatePasswordResetToken", mock.Anything, mock.AnythingOfType("string"), "1", mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
 			},
 			expectedError: nil,
 		},
@@ -280,7 +946,7 @@ func TestAuthService_RequestPasswordReset(t *testing.T) {
 			name:  "email not found (should not reveal existence)",
 			email: "nonexistent@example.com",
 			setupMock: func(mockStore *MockStore) {
-				mockStore.On("GetUserByEmail", "nonexistent@example.com").Return(nil, assert.AnError)
+				mockStore.On("GetUserByEmail", mock.Anything, "nonexistent@example.com").Return(nil, assert.AnError)
 			},
 			expectedError: nil, // Should not return error for security
 		},
@@ -291,18 +957,16 @@ func TestAuthService_RequestPasswordReset(t *testing.T) {
 			mockStore := &MockStore{}
 			tt.setupMock(mockStore)
 
-			cfg := &config.Config{
-				PasswordResetTokenExpiry: 24,
-				AppURL:                   "http://localhost:5173",
-			}
+			cfg := testConfig()
 
 			service := &AuthService{
 				Store:        mockStore,
 				Cfg:          cfg,
-				EmailService: NewEmailService(cfg),
+				EmailService: NewEmailService(cfg, &mail.Memory{}),
+				Keys:         testKeyring(),
 			}
 
-			err := service.RequestPasswordReset(tt.email)
+			err := service.RequestPasswordReset(context.Background(), tt.email)
 
 			assert.Equal(t, tt.expectedError, err)
 			mockStore.AssertExpectations(t)
@@ -330,9 +994,10 @@ func TestAuthService_ResetPassword(t *testing.T) {
 					ExpiresAt: time.Now().Add(time.Hour),
 					Used:      false,
 				}
-				mockStore.On("GetPasswordResetToken", "valid-token").Return(resetToken, nil)
-				mockStore.On("MarkPasswordResetTokenUsed", "valid-token").Return(nil)
-				mockStore.On("UpdateUserPassword", "1", mock.AnythingOfType("string")).Return(nil)
+				mockStore.On("GetPasswordResetToken", mock.Anything, "valid-token").Return(resetToken, nil)
+				mockStore.On("UpdateUser", mock.Anything, "1", mock.AnythingOfType("map[string]interface {}")).Return(nil)
+				mockStore.On("MarkPasswordResetTokenUsed", mock.Anything, "1").Return(nil)
+				mockStore.On("DeleteUserSessions", mock.Anything, "1").Return(nil)
 			},
 			expectedError: nil,
 		},
@@ -341,7 +1006,7 @@ func TestAuthService_ResetPassword(t *testing.T) {
 			token:       "invalid-token",
 			newPassword: "newpassword123",
 			setupMock: func(mockStore *MockStore) {
-				mockStore.On("GetPasswordResetToken", "invalid-token").Return(nil, assert.AnError)
+				mockStore.On("GetPasswordResetToken", mock.Anything, "invalid-token").Return(nil, assert.AnError)
 			},
 			expectedError: ErrTokenNotFound,
 		},
@@ -357,7 +1022,7 @@ func TestAuthService_ResetPassword(t *testing.T) {
 					ExpiresAt: time.Now().Add(-time.Hour), // Expired
 					Used:      false,
 				}
-				mockStore.On("GetPasswordResetToken", "expired-token").Return(resetToken, nil)
+				mockStore.On("GetPasswordResetToken", mock.Anything, "expired-token").Return(resetToken, nil)
 			},
 			expectedError: ErrTokenExpired,
 		},
@@ -373,7 +1038,25 @@ func TestAuthService_ResetPassword(t *testing.T) {
 					ExpiresAt: time.Now().Add(time.Hour),
 					Used:      true, // Already used
 				}
-				mockStore.On("GetPasswordResetToken", "used-token").Return(resetToken, nil)
+				mockStore.On("GetPasswordResetToken", mock.Anything, "used-token").Return(resetToken, nil)
+			},
+			expectedError: ErrTokenUsed,
+		},
+		{
+			name:        "token consumed by concurrent reset",
+			token:       "racing-token",
+			newPassword: "newpassword123",
+			setupMock: func(mockStore *MockStore) {
+				resetToken := &store.PasswordResetToken{
+					ID:        "1",
+					UserID:    "1",
+					Token:     "racing-token",
+					ExpiresAt: time.Now().Add(time.Hour),
+					Used:      false,
+				}
+				mockStore.On("GetPasswordResetToken", mock.Anything, "racing-token").Return(resetToken, nil)
+				// The password must not change once the token is gone
+				mockStore.On("MarkPasswordResetTokenUsed", mock.Anything, "1").Return(store.ErrTokenNotFound)
 			},
 			expectedError: ErrTokenUsed,
 		},
@@ -384,18 +1067,16 @@ func TestAuthService_ResetPassword(t *testing.T) {
 			mockStore := &MockStore{}
 			tt.setupMock(mockStore)
 
-			cfg := &config.Config{
-				PasswordResetTokenExpiry: 24,
-				AppURL:                   "http://localhost:5173",
-			}
+			cfg := testConfig()
 
 			service := &AuthService{
 				Store:        mockStore,
 				Cfg:          cfg,
-				EmailService: NewEmailService(cfg),
+				EmailService: NewEmailService(cfg, &mail.Memory{}),
+				Keys:         testKeyring(),
 			}
 
-			err := service.ResetPassword(tt.token, tt.newPassword)
+			err := service.ResetPassword(context.Background(), tt.token, tt.newPassword)
 
 			assert.Equal(t, tt.expectedError, err)
 			mockStore.AssertExpectations(t)
@@ -422,12 +1103,17 @@ func TestAuthService_UpdateUser(t *testing.T) {
 				updatedUser := &store.User{
 					ID:       "1",
 					Username: "newusername",
-					Email:    stringPtr("newemail@example.com"),
+					Email:    stringPtr("oldemail@example.com"),
 				}
-				mockStore.On("UpdateUser", "1", map[string]interface{}{
+				mockStore.On("GetUserByID", mock.Anything, "1").Return(updatedUser, nil)
+				// The email goes through a confirmed change instead of the update
+				mockStore.On("GetUserByEmail", mock.Anything, "newemail@example.com").Return(nil, store.ErrUserNotFound)
+				mockStore.On("DeleteExpiredEmailChanges", mock.Anything).Return(nil)
+				mockStore.On("CancelPendingEmailChanges", mock.Anything, "1").Return(nil)
+				mockStore.On("CreateEmailChange", mock.Anything, mock.AnythingOfType("*store.EmailChange")).Return(nil)
+				mockStore.On("UpdateUser", mock.Anything, "1", map[string]interface{}{
 					"username": "newusername",
-					"email":    "newemail@example.com",
-				}).Return(updatedUser, nil)
+				}).Return(nil)
 			},
 			expectedError: nil,
 		},
@@ -438,11 +1124,9 @@ func TestAuthService_UpdateUser(t *testing.T) {
 				"username": "newusername",
 			},
 			setupMock: func(mockStore *MockStore) {
-				mockStore.On("UpdateUser", "999", map[string]interface{}{
-					"username": "newusername",
-				}).Return(nil, assert.AnError)
+				mockStore.On("GetUserByID", mock.Anything, "999").Return(nil, store.ErrUserNotFound)
 			},
-			expectedError: assert.AnError,
+			expectedError: ErrUserNotFound,
 		},
 	}
 
@@ -451,18 +1135,16 @@ func TestAuthService_UpdateUser(t *testing.T) {
 			mockStore := &MockStore{}
 			tt.setupMock(mockStore)
 
-			cfg := &config.Config{
-				PasswordResetTokenExpiry: 24,
-				AppURL:                   "http://localhost:5173",
-			}
+			cfg := testConfig()
 
 			service := &AuthService{
 				Store:        mockStore,
 				Cfg:          cfg,
-				EmailService: NewEmailService(cfg),
+				EmailService: NewEmailService(cfg, &mail.Memory{}),
+				Keys:         testKeyring(),
 			}
 
-			user, err := service.UpdateUser(tt.userID, tt.updates)
+			user, err := service.UpdateUser(context.Background(), tt.userID, tt.updates)
 
 			if tt.expectedError != nil {
 				assert.Equal(t, tt.expectedError, err)
@@ -488,7 +1170,8 @@ func TestAuthService_DeleteUser(t *testing.T) {
 			name:   "successful user deletion",
 			userID: "1",
 			setupMock: func(mockStore *MockStore) {
-				mockStore.On("DeleteUser", "1").Return(nil)
+				mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1"}, nil)
+				mockStore.On("DeleteUser", mock.Anything, "1").Return(nil)
 			},
 			expectedError: nil,
 		},
@@ -496,9 +1179,9 @@ func TestAuthService_DeleteUser(t *testing.T) {
 			name:   "user not found",
 			userID: "999",
 			setupMock: func(mockStore *MockStore) {
-				mockStore.On("DeleteUser", "999").Return(assert.AnError)
+				mockStore.On("GetUserByID", mock.Anything, "999").Return(nil, store.ErrUserNotFound)
 			},
-			expectedError: assert.AnError,
+			expectedError: ErrUserNotFound,
 		},
 	}
 
@@ -507,18 +1190,197 @@ func TestAuthService_DeleteUser(t *testing.T) {
 			mockStore := &MockStore{}
 			tt.setupMock(mockStore)
 
-			cfg := &config.Config{
-				PasswordResetTokenExpiry: 24,
-				AppURL:                   "http://localhost:5173",
+			cfg := testConfig()
+
+			service := &AuthService{
+				Store:        mockStore,
+				Cfg:          cfg,
+				EmailService: NewEmailService(cfg, &mail.Memory{}),
+				Keys:         testKeyring(),
 			}
 
+			err := service.DeleteUser(context.Background(), tt.userID)
+
+			assert.Equal(t, tt.expectedError, err)
+			mockStore.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthService_Refresh(t *testing.T) {
+	const secret = "current-secret"
+	activeSession := func() *store.Session {
+		return &store.Session{
+			ID:               "session1",
+			UserID:           "1",
+			RefreshTokenHash: hashToken(secret),
+			ExpiresAt:        time.Now().Add(time.Hour),
+		}
+	}
+
+	tests := []struct {
+		name          string
+		refreshToken  string
+		setupMock     func(*MockStore)
+		expectedError error
+	}{
+		{
+			name:         "successful rotation",
+			refreshToken: "session1." + secret,
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetSession", mock.Anything, "session1").Return(activeSession(), nil)
+				mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "testuser"}, nil)
+				mockStore.On("RotateSession", mock.Anything, "session1", hashToken(secret), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
+				expectTokenIssue(mockStore, "1")
+			},
+			expectedError: nil,
+		},
+		{
+			name:          "malformed token",
+			refreshToken:  "no-separator",
+			setupMock:     func(mockStore *MockStore) {},
+			expectedError: ErrInvalidRefreshToken,
+		},
+		{
+			name:         "unknown session",
+			refreshToken: "missing." + secret,
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetSession", mock.Anything, "missing").Return(nil, store.ErrSessionNotFound)
+			},
+			expectedError: ErrInvalidRefreshToken,
+		},
+		{
+			name:         "expired session",
+			refreshToken: "session1." + secret,
+			setupMock: func(mockStore *MockStore) {
+				session := activeSession()
+				session.ExpiresAt = time.Now().Add(-time.Hour)
+				mockStore.On("GetSession", mock.Anything, "session1").Return(session, nil)
+				mockStore.On("DeleteSession", mock.Anything, "session1").Return(nil)
+			},
+			expectedError: ErrInvalidRefreshToken,
+		},
+		{
+			name:         "reused token revokes family",
+			refreshToken: "session1.rotated-away-secret",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetSession", mock.Anything, "session1").Return(activeSession(), nil)
+				mockStore.On("IsRotatedRefreshToken", mock.Anything, "session1", hashToken("rotated-away-secret")).Return(true, nil)
+				mockStore.On("DeleteSession", mock.Anything, "session1").Return(nil)
+			},
+			expectedError: ErrRefreshTokenReused,
+		},
+		{
+			// A DeleteSession call would fail the test as unexpected
+			name:         "unknown secret leaves the session alone",
+			refreshToken: "session1.garbage",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetSession", mock.Anything, "session1").Return(activeSession(), nil)
+				mockStore.On("IsRotatedRefreshToken", mock.Anything, "session1", hashToken("garbage")).Return(false, nil)
+			},
+			expectedError: ErrInvalidRefreshToken,
+		},
+		{
+			name:         "lost rotation race revokes family",
+			refreshToken: "session1." + secret,
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetSession", mock.Anything, "session1").Return(activeSession(), nil)
+				mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "testuser"}, nil)
+				mockStore.On("RotateSession", mock.Anything, "session1", hashToken(secret), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(store.ErrSessionNotFound)
+				mockStore.On("DeleteSession", mock.Anything, "session1").Return(nil)
+			},
+			expectedError: ErrRefreshTokenReused,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &MockStore{}
+			tt.setupMock(mockStore)
+
+			cfg := testConfig()
+
 			service := &AuthService{
 				Store:        mockStore,
 				Cfg:          cfg,
-				EmailService: NewEmailService(cfg),
+				EmailService: NewEmailService(cfg, &mail.Memory{}),
+				Keys:         testKeyring(),
+			}
+
+			tokens, err := service.Refresh(context.Background(), tt.refreshToken)
+
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+				assert.Nil(t, tokens)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, tokens.AccessToken)
+				assert.NotEqual(t, tt.refreshToken, tokens.RefreshToken)
+				assert.True(t, strings.HasPrefix(tokens.RefreshToken, "session1."))
 			}
 
-			err := service.DeleteUser(tt.userID)
+			mockStore.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthService_Logout(t *testing.T) {
+	mockStore := &MockStore{}
+	mockStore.On("DeleteSession", mock.Anything, "session1").Return(nil)
+
+	service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+
+	assert.NoError(t, service.Logout(context.Background(), "session1"))
+	mockStore.AssertExpectations(t)
+}
+
+func TestAuthService_AssignRole(t *testing.T) {
+	tests := []struct {
+		name          string
+		userID        string
+		role          string
+		setupMock     func(*MockStore)
+		expectedError error
+	}{
+		{
+			name:   "role assigned",
+			userID: "1",
+			role:   "admin",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1"}, nil)
+				mockStore.On("AssignRole", mock.Anything, "1", "admin").Return(nil)
+			},
+			expectedError: nil,
+		},
+		{
+			name:   "unknown role",
+			userID: "1",
+			role:   "superuser",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1"}, nil)
+				mockStore.On("AssignRole", mock.Anything, "1", "superuser").Return(store.ErrRoleNotFound)
+			},
+			expectedError: ErrRoleNotFound,
+		},
+		{
+			name:   "user not found",
+			userID: "999",
+			role:   "admin",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetUserByID", mock.Anything, "999").Return(nil, store.ErrUserNotFound)
+			},
+			expectedError: ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &MockStore{}
+			tt.setupMock(mockStore)
+
+			service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+
+			err := service.AssignRole(context.Background(), tt.userID, tt.role)
 
 			assert.Equal(t, tt.expectedError, err)
 			mockStore.AssertExpectations(t)
@@ -526,6 +1388,54 @@ func TestAuthService_DeleteUser(t *testing.T) {
 	}
 }
 
+func TestAuthService_ListUsers(t *testing.T) {
+	opts := store.UserListOptions{Search: "ali", Limit: 10}
+
+	mockStore := &MockStore{}
+	mockStore.On("ListUsers", mock.Anything, opts).Return(&store.UserList{
+		Users:      []store.User{{ID: "1", Username: "alice", PasswordHash: "secret-hash"}},
+		Total:      3,
+		NextCursor: "next",
+	}, nil)
+
+	service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+
+	list, err := service.ListUsers(context.Background(), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, list.Total)
+	assert.Equal(t, "next", list.NextCursor)
+	assert.Equal(t, []User{{ID: "1", Username: "alice"}}, list.Users)
+
+	mockStore.On("ListUsers", mock.Anything, store.UserListOptions{Cursor: "stale"}).Return(nil, store.ErrInvalidCursor)
+	_, err = service.ListUsers(context.Background(), store.UserListOptions{Cursor: "stale"})
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestAuthService_BootstrapAdmins(t *testing.T) {
+	mockStore := &MockStore{}
+	mockStore.On("GetUserByUsername", mock.Anything, "alice").Return(&store.User{ID: "1", Username: "alice"}, nil)
+	mockStore.On("GetUserByUsername", mock.Anything, "ghost").Return(nil, store.ErrUserNotFound)
+	mockStore.On("AssignRole", mock.Anything, "1", "admin").Return(nil)
+
+	cfg := testConfig()
+	cfg.AdminUsers = []string{"alice", "ghost"}
+	service := &AuthService{Store: mockStore, Cfg: cfg, Keys: testKeyring()}
+
+	assert.NoError(t, service.BootstrapAdmins(context.Background()))
+	mockStore.AssertExpectations(t)
+}
+
+func mustHash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	return string(hash)
+}
+
 // Helper function to create string pointers
 func stringPtr(s string) *string {
 	return &s
@@ -1,129 +1,257 @@
 package service
 
 import (
-	"crypto/tls"
+	"context"
+	"embed"
 	"fmt"
-	"net/smtp"
+	"io/fs"
+	"os"
+	"time"
 
 	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/pkg/mail"
 )
 
+// templates/email holds an email per file in English, with translations
+// in subdirectories named after their locale; see mail.Templates
+//
+//go:embed templates/email
+var emailTemplateFiles embed.FS
+
+const (
+	emailAppName       = "Vortex"
+	defaultEmailLocale = "en"
+)
+
+var emailTemplates = mustParseEmailTemplates()
+
+func mustParseEmailTemplates() *mail.Templates {
+	dir, err := fs.Sub(emailTemplateFiles, "templates/email")
+	if err != nil {
+		panic(err)
+	}
+	templates, err := mail.ParseTemplates(dir, defaultEmailLocale)
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+// emailData is what an email template renders; every email also gets
+// AppName and AppURL
+type emailData map[string]any
+
+// EmailService renders and sends the emails the service needs. Emails are
+// rendered in the locales carried by ctx, see mail.WithLocales, and given
+// up when ctx is done or EMAIL_TIMEOUT passes. The mailer is normally an
+// EmailQueue, so sending only stores the email and delivery happens in the
+// background.
 type EmailService struct {
-	config *config.Config
+	config    *config.Config
+	mailer    mail.Mailer
+	templates *mail.Templates
 }
 
-func NewEmailService(cfg *config.Config) *EmailService {
+func NewEmailService(cfg *config.Config, mailer mail.Mailer) *EmailService {
 	return &EmailService{
-		config: cfg,
+		config:    cfg,
+		mailer:    mailer,
+		templates: emailTemplates,
 	}
 }
 
-func (s *EmailService) SendPasswordResetEmail(email, token string) error {
-	subject := "Password Reset Request"
-	body := fmt.Sprintf(`
-		Hello,
-		
-		You have requested a password reset for your account.
-		
-		Click the following link to reset your password:
-		%s/auth/reset-password?token=%s
-		
-		This link will expire in %d hours.
-		
-		If you did not request this reset, please ignore this email.
-		
-		Best regards,
-		The Vortex Team
-	`, s.config.AppURL, token, s.config.PasswordResetTokenExpiry)
-
-	return s.sendEmail(email, subject, body)
-}
-
-func (s *EmailService) SendWelcomeEmail(email, username string) error {
-	subject := "Welcome to Vortex!"
-	body := fmt.Sprintf(`
-		Hello %s,
-		
-		Welcome to Vortex! Your account has been successfully created.
-		
-		You can now log in to your account and start using our services.
-		
-		If you have any questions, please don't hesitate to contact us.
-		
-		Best regards,
-		The Vortex Team
-	`, username)
-
-	return s.sendEmail(email, subject, body)
-}
-
-func (s *EmailService) sendEmail(to, subject, body string) error {
-	// If SMTP is not configured, just log the email (for development)
-	if s.config.SMTPHost == "" {
-		fmt.Printf("Email would be sent to %s:\nSubject: %s\nBody: %s\n", to, subject, body)
-		return nil
+// LoadDKIM reads the configured DKIM signing key, or returns nil when
+// signing is not configured
+func LoadDKIM(cfg *config.Config) (*mail.DKIM, error) {
+	if cfg.DKIMKeyFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(cfg.DKIMKeyFile)
+	if err != nil {
+		return nil, err
 	}
+	key, err := mail.ParseDKIMKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.DKIMKeyFile, err)
+	}
+	return &mail.DKIM{
+		Domain:   cfg.DKIMDomain,
+		Selector: cfg.DKIMSelector,
+		Key:      key,
+		Headers:  cfg.DKIMHeaders,
+	}, nil
+}
 
-	// Create message
-	message := fmt.Sprintf("From: %s\r\n", s.config.SMTPFrom)
-	message += fmt.Sprintf("To: %s\r\n", to)
-	message += fmt.Sprintf("Subject: %s\r\n", subject)
-	message += "\r\n"
-	message += body
+// NewMailer returns the transport EMAIL_TRANSPORT selects, signing with
+// dkim when it is not nil
+func NewMailer(cfg *config.Config, dkim *mail.DKIM) mail.Mailer {
+	transport := newTransport(cfg)
+	if dkim != nil {
+		return &mail.Signed{Mailer: transport, DKIM: dkim}
+	}
+	return transport
+}
 
-	// Setup authentication
-	auth := smtp.PlainAuth("", s.config.SMTPUsername, s.config.SMTPPassword, s.config.SMTPHost)
+func newTransport(cfg *config.Config) mail.Mailer {
+	switch cfg.EmailTransport {
+	case "smtp":
+		return &mail.SMTP{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			Security: mail.Security(cfg.SMTPSecurity),
+		}
+	case "file":
+		return &mail.File{Dir: cfg.EmailFileDir, Maildir: cfg.EmailFileFormat == "maildir"}
+	case "http":
+		return &mail.HTTP{URL: cfg.EmailAPIURL, APIKey: cfg.EmailAPIKey}
+	}
+	return &mail.Log{}
+}
 
-	// Connect to server
-	addr := fmt.Sprintf("%s:%d", s.config.SMTPHost, s.config.SMTPPort)
+func (s *EmailService) SendPasswordResetEmail(ctx context.Context, email, token string) error {
+	return s.send(ctx, email, "password_reset", emailData{
+		"Link":        s.link("/auth/reset-password", token),
+		"ExpiryHours": s.config.PasswordResetTokenExpiry,
+	})
+}
 
-	var err error
-	if s.config.SMTPTLS {
-		// TLS connection
-		tlsConfig := &tls.Config{
-			ServerName: s.config.SMTPHost,
-		}
-		conn, err := tls.Dial("tcp", addr, tlsConfig)
-		if err != nil {
-			return fmt.Errorf("failed to connect to SMTP server: %w", err)
-		}
-		defer conn.Close()
+func (s *EmailService) SendVerificationEmail(ctx context.Context, email, username, token string) error {
+	return s.send(ctx, email, "verify_email", emailData{
+		"Username":    username,
+		"Link":        s.link("/auth/verify-email", token),
+		"ExpiryHours": s.config.EmailVerificationTokenExpiry,
+	})
+}
 
-		client, err := smtp.NewClient(conn, s.config.SMTPHost)
-		if err != nil {
-			return fmt.Errorf("failed to create SMTP client: %w", err)
-		}
-		defer client.Close()
+func (s *EmailService) SendEmailChangeConfirmation(ctx context.Context, email, username, token string) error {
+	return s.send(ctx, email, "email_change_confirm", emailData{
+		"Username":    username,
+		"Link":        s.link("/auth/confirm-email-change", token),
+		"ExpiryHours": s.config.EmailChangeTokenExpiry,
+	})
+}
 
-		if err = client.Auth(auth); err != nil {
-			return fmt.Errorf("failed to authenticate: %w", err)
-		}
+func (s *EmailService) SendEmailChangeNotice(ctx context.Context, email, username, newEmail, token string) error {
+	return s.send(ctx, email, "email_change_notice", emailData{
+		"Username":    username,
+		"NewEmail":    newEmail,
+		"Link":        s.link("/auth/revert-email-change", token),
+		"ExpiryHours": s.config.EmailChangeRevertExpiry,
+	})
+}
 
-		if err = client.Mail(s.config.SMTPFrom); err != nil {
-			return fmt.Errorf("failed to set sender: %w", err)
-		}
+func (s *EmailService) SendMagicLinkEmail(ctx context.Context, email, username, token string) error {
+	return s.send(ctx, email, "magic_link", emailData{
+		"Username":      username,
+		"Link":          s.link("/auth/magic-link", token),
+		"ExpiryMinutes": s.config.MagicLinkTokenExpiry,
+	})
+}
 
-		if err = client.Rcpt(to); err != nil {
-			return fmt.Errorf("failed to set recipient: %w", err)
-		}
+func (s *EmailService) SendAccountLockedEmail(ctx context.Context, email, username, token string, until time.Time) error {
+	return s.send(ctx, email, "account_locked", emailData{
+		"Username": username,
+		"Link":     s.link("/auth/unlock", token),
+		"Until":    until.UTC(),
+	})
+}
 
-		writer, err := client.Data()
-		if err != nil {
-			return fmt.Errorf("failed to get data writer: %w", err)
-		}
-		defer writer.Close()
+func (s *EmailService) SendWelcomeEmail(ctx context.Context, email, username string) error {
+	return s.send(ctx, email, "welcome", emailData{
+		"Username": username,
+		"Link":     s.config.AppURL + "/auth/login",
+	})
+}
 
-		_, err = writer.Write([]byte(message))
-		if err != nil {
-			return fmt.Errorf("failed to write message: %w", err)
-		}
-	} else {
-		// Non-TLS connection
-		err = smtp.SendMail(addr, auth, s.config.SMTPFrom, []string{to}, []byte(message))
-		if err != nil {
-			return fmt.Errorf("failed to send email: %w", err)
-		}
+// link returns the frontend page at path with token in its query
+func (s *EmailService) link(path, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", s.config.AppURL, path, token)
+}
+
+// render renders the email called name for to without sending it
+func (s *EmailService) render(ctx context.Context, to, name string, data emailData) (*mail.Message, error) {
+	data["AppName"] = emailAppName
+	data["AppURL"] = s.config.AppURL
+
+	msg, err := s.templates.Render(name, mail.LocalesFromContext(ctx), data)
+	if err != nil {
+		return nil, err
+	}
+	msg.From = s.config.SMTPFrom
+	msg.To = []string{to}
+	// Keep out-of-office replies away from the sender, see RFC 3834
+	msg.Headers["Auto-Submitted"] = "auto-generated"
+	return msg, nil
+}
+
+func (s *EmailService) send(ctx context.Context, to, name string, data emailData) error {
+	msg, err := s.render(ctx, to, name, data)
+	if err != nil {
+		return fmt.Errorf("failed to render %s email: %w", name, err)
 	}
 
-	return nil
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.config.EmailTimeout)*time.Second)
+	defer cancel()
+	return s.mailer.Send(ctx, msg)
+}
+
+// emailPreviews send each email with made-up values, so previews go through
+// the same code as real emails
+var emailPreviews = map[string]func(ctx context.Context, s *EmailService) error{
+	"password_reset": func(ctx context.Context, s *EmailService) error {
+		return s.SendPasswordResetEmail(ctx, previewAddress, previewToken)
+	},
+	"verify_email": func(ctx context.Context, s *EmailService) error {
+		return s.SendVerificationEmail(ctx, previewAddress, previewUsername, previewToken)
+	},
+	"email_change_confirm": func(ctx context.Context, s *EmailService) error {
+		return s.SendEmailChangeConfirmation(ctx, "new-"+previewAddress, previewUsername, previewToken)
+	},
+	"email_change_notice": func(ctx context.Context, s *EmailService) error {
+		return s.SendEmailChangeNotice(ctx, previewAddress, previewUsername, "new-"+previewAddress, previewToken)
+	},
+	"magic_link": func(ctx context.Context, s *EmailService) error {
+		return s.SendMagicLinkEmail(ctx, previewAddress, previewUsername, previewToken)
+	},
+	"account_locked": func(ctx context.Context, s *EmailService) error {
+		return s.SendAccountLockedEmail(ctx, previewAddress, previewUsername, previewToken, time.Now().Add(15*time.Minute))
+	},
+	"welcome": func(ctx context.Context, s *EmailService) error {
+		return s.SendWelcomeEmail(ctx, previewAddress, previewUsername)
+	},
+}
+
+const (
+	previewAddress  = "jane.doe@example.com"
+	previewUsername = "jane_doe"
+	previewToken    = "preview-token"
+)
+
+// EmailTemplates returns the emails that can be previewed and the locales
+// they are translated to
+func (s *EmailService) EmailTemplates() (names, locales []string) {
+	return s.templates.Names(), s.templates.Locales()
+}
+
+// PreviewEmail renders the email called name in locale with made-up values
+// instead of sending it. An empty locale uses the locales carried by ctx.
+func (s *EmailService) PreviewEmail(ctx context.Context, name, locale string) (*mail.Message, error) {
+	preview, ok := emailPreviews[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", mail.ErrUnknownTemplate, name)
+	}
+	if locale != "" {
+		ctx = mail.WithLocales(ctx, locale)
+	}
+
+	capture := &mail.Memory{}
+	previewer := *s
+	previewer.mailer = capture
+	if err := preview(ctx, &previewer); err != nil {
+		return nil, err
+	}
+	sent := capture.Messages()[0]
+	return &sent, nil
 }
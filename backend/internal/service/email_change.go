@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/user/votex-template/backend/internal/store"
+)
+
+// requestEmailChange records a pending move to newEmail. The address is only
+// swapped once the link sent to newEmail is followed, and the old address is
+// sent a link that undoes the change, so a stolen session cannot quietly take
+// over password resets. A new request replaces any earlier pending one.
+func (s *AuthService) requestEmailChange(ctx context.Context, userID, newEmail string) error {
+	dbUser, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if dbUser.Email != nil && *dbUser.Email == newEmail {
+		return nil
+	}
+	if existing, err := s.Store.GetUserByEmail(ctx, newEmail); err == nil && existing.ID != userID {
+		return ErrEmailExists
+	}
+
+	if err := s.Store.DeleteExpiredEmailChanges(ctx); err != nil {
+		slog.Warn("Failed to clean up expired email changes", "error", err)
+	}
+
+	now := time.Now()
+	confirmToken := generateSecureToken()
+	change := &store.EmailChange{
+		ID:               generateID(),
+		UserID:           userID,
+		OldEmail:         dbUser.Email,
+		NewEmail:         newEmail,
+		ConfirmTokenHash: hashToken(confirmToken),
+		ExpiresAt:        now.Add(time.Duration(s.Cfg.EmailChangeTokenExpiry) * time.Hour),
+		RevertExpiresAt:  now.Add(time.Duration(s.Cfg.EmailChangeRevertExpiry) * time.Hour),
+	}
+	var revertToken string
+	if dbUser.Email != nil && *dbUser.Email != "" {
+		revertToken = generateSecureToken()
+		revertHash := hashToken(revertToken)
+		change.RevertTokenHash = &revertHash
+	}
+
+	err = s.Store.WithTx(ctx, func(tx store.StoreInterface) error {
+		if err := tx.CancelPendingEmailChanges(ctx, userID); err != nil {
+			return err
+		}
+		return tx.CreateEmailChange(ctx, change)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.EmailService.SendEmailChangeConfirmation(ctx, newEmail, dbUser.Username, confirmToken); err != nil {
+		return err
+	}
+	if revertToken != "" {
+		if err := s.EmailService.SendEmailChangeNotice(ctx, *dbUser.Email, dbUser.Username, newEmail, revertToken); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Requested email change", "user_id", userID)
+	return nil
+}
+
+// ConfirmEmailChange applies the change a confirmation link was sent for. The
+// new address is stored as verified, since the link proves it is reachable.
+func (s *AuthService) ConfirmEmailChange(ctx context.Context, token string) error {
+	change, err := s.Store.GetEmailChangeByConfirmHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, store.ErrEmailChangeNotFound) {
+			return ErrInvalidEmailChangeToken
+		}
+		return err
+	}
+	if change.ConfirmedAt != nil || change.RevertedAt != nil || time.Now().After(change.ExpiresAt) {
+		return ErrInvalidEmailChangeToken
+	}
+
+	// The address may have been taken while the change was pending
+	if existing, err := s.Store.GetUserByEmail(ctx, change.NewEmail); err == nil && existing.ID != change.UserID {
+		return ErrEmailExists
+	}
+
+	err = s.Store.WithTx(ctx, func(tx store.StoreInterface) error {
+		if err := tx.ConfirmEmailChange(ctx, change.ID); err != nil {
+			return err
+		}
+		return tx.ChangeUserEmail(ctx, change.UserID, change.NewEmail)
+	})
+	if errors.Is(err, store.ErrEmailChangeNotFound) {
+		return ErrInvalidEmailChangeToken
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Confirmed email change", "user_id", change.UserID)
+	return nil
+}
+
+// RevertEmailChange undoes a change from the link sent to the old address.
+// A pending change is cancelled and a confirmed one rolled back; either way
+// the account is treated as compromised, so every session, API key and
+// outstanding password reset is revoked. Passkeys and linked identities are
+// kept: they may be the owner's only way in, as accounts created through a
+// provider have no password, so the owner reviews and removes them.
+func (s *AuthService) RevertEmailChange(ctx context.Context, token string) error {
+	change, err := s.Store.GetEmailChangeByRevertHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, store.ErrEmailChangeNotFound) {
+			return ErrInvalidEmailChangeToken
+		}
+		return err
+	}
+	if change.RevertedAt != nil || change.OldEmail == nil || time.Now().After(change.RevertExpiresAt) {
+		return ErrInvalidEmailChangeToken
+	}
+
+	err = s.Store.WithTx(ctx, func(tx store.StoreInterface) error {
+		if err := tx.RevertEmailChange(ctx, change.ID); err != nil {
+			return err
+		}
+		if err := tx.CancelPendingEmailChanges(ctx, change.UserID); err != nil {
+			return err
+		}
+		if change.ConfirmedAt != nil {
+			if err := tx.ChangeUserEmail(ctx, change.UserID, *change.OldEmail); err != nil {
+				return err
+			}
+		}
+		if err := tx.DeletePasswordResetTokens(ctx, change.UserID); err != nil {
+			return err
+		}
+		// Keys created from a stolen session act as the owner without one
+		if err := tx.DeleteUserAPIKeys(ctx, change.UserID); err != nil {
+			return err
+		}
+		return tx.DeleteUserSessions(ctx, change.UserID)
+	})
+	if errors.Is(err, store.ErrEmailChangeNotFound) {
+		return ErrInvalidEmailChangeToken
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.Warn("Reverted email change", "user_id", change.UserID, "was_confirmed", change.ConfirmedAt != nil)
+	return nil
+}
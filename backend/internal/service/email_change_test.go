@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/mail"
+)
+
+func TestAuthService_UpdateUser_EmailChange(t *testing.T) {
+	email := "alice@example.com"
+	newEmail := "new@example.com"
+	verifiedAt := time.Now()
+
+	t.Run("leaves the address in place until confirmed", func(t *testing.T) {
+		mockStore := new(MockStore)
+		cfg := testConfig()
+		cfg.EmailChangeTokenExpiry = 24
+		cfg.EmailChangeRevertExpiry = 168
+		service := &AuthService{Store: mockStore, Cfg: cfg, EmailService: NewEmailService(cfg, &mail.Memory{}), Keys: testKeyring()}
+
+		var stored *store.EmailChange
+		mockStore.On("GetUserByID", mock.Anything, "1").
+			Return(&store.User{ID: "1", Username: "alice", Email: &email, EmailVerifiedAt: &verifiedAt}, nil)
+		mockStore.On("GetUserByEmail", mock.Anything, newEmail).Return(nil, store.ErrUserNotFound)
+		mockStore.On("DeleteExpiredEmailChanges", mock.Anything).Return(nil)
+		mockStore.On("CancelPendingEmailChanges", mock.Anything, "1").Return(nil)
+		mockStore.On("CreateEmailChange", mock.Anything, mock.AnythingOfType("*store.EmailChange")).
+			Run(func(args mock.Arguments) { stored = args.Get(1).(*store.EmailChange) }).
+			Return(nil)
+		mockStore.On("UpdateUser", mock.Anything, "1", map[string]interface{}{}).Return(nil)
+
+		updates := map[string]interface{}{"email": newEmail}
+		user, err := service.UpdateUser(context.Background(), "1", updates)
+		assert.NoError(t, err)
+		assert.Equal(t, email, *user.Email)
+		assert.NotNil(t, user.EmailVerifiedAt)
+		assert.Equal(t, newEmail, *user.PendingEmail)
+		assert.Contains(t, updates, "email", "the caller's updates are left untouched")
+
+		assert.Equal(t, email, *stored.OldEmail)
+		assert.Equal(t, newEmail, stored.NewEmail)
+		assert.Len(t, stored.ConfirmTokenHash, 64, "only the digest is stored")
+		assert.NotNil(t, stored.RevertTokenHash)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), stored.ExpiresAt, time.Minute)
+		assert.WithinDuration(t, time.Now().Add(168*time.Hour), stored.RevertExpiresAt, time.Minute)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("a user without an address gets no revert link", func(t *testing.T) {
+		mockStore := new(MockStore)
+		cfg := testConfig()
+		service := &AuthService{Store: mockStore, Cfg: cfg, EmailService: NewEmailService(cfg, &mail.Memory{}), Keys: testKeyring()}
+
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "alice"}, nil)
+		mockStore.On("GetUserByEmail", mock.Anything, newEmail).Return(nil, store.ErrUserNotFound)
+		mockStore.On("DeleteExpiredEmailChanges", mock.Anything).Return(nil)
+		mockStore.On("CancelPendingEmailChanges", mock.Anything, "1").Return(nil)
+		mockStore.On("CreateEmailChange", mock.Anything, mock.MatchedBy(func(change *store.EmailChange) bool {
+			return change.OldEmail == nil && change.RevertTokenHash == nil
+		})).Return(nil)
+		mockStore.On("UpdateUser", mock.Anything, "1", map[string]interface{}{}).Return(nil)
+
+		user, err := service.UpdateUser(context.Background(), "1", map[string]interface{}{"email": newEmail})
+		assert.NoError(t, err)
+		assert.Nil(t, user.Email)
+		assert.Equal(t, newEmail, *user.PendingEmail)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("the same address is a no-op", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "alice", Email: &email}, nil)
+		mockStore.On("UpdateUser", mock.Anything, "1", map[string]interface{}{}).Return(nil)
+
+		user, err := service.UpdateUser(context.Background(), "1", map[string]interface{}{"email": email})
+		assert.NoError(t, err)
+		assert.Nil(t, user.PendingEmail)
+		mockStore.AssertNotCalled(t, "CreateEmailChange", mock.Anything, mock.Anything)
+	})
+
+	t.Run("an address in use is rejected", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "alice", Email: &email}, nil)
+		mockStore.On("GetUserByEmail", mock.Anything, newEmail).Return(&store.User{ID: "2", Username: "bob", Email: &newEmail}, nil)
+
+		_, err := service.UpdateUser(context.Background(), "1", map[string]interface{}{"email": newEmail, "age": 30})
+		assert.Equal(t, ErrEmailExists, err)
+		mockStore.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("an empty address is rejected", func(t *testing.T) {
+		service := &AuthService{Store: new(MockStore), Cfg: testConfig(), Keys: testKeyring()}
+
+		_, err := service.UpdateUser(context.Background(), "1", map[string]interface{}{"email": ""})
+		assert.Equal(t, ErrEmailRequired, err)
+	})
+}
+
+func TestAuthService_ConfirmEmailChange(t *testing.T) {
+	const token = "confirm-token"
+	oldEmail := "alice@example.com"
+	pending := func() *store.EmailChange {
+		return &store.EmailChange{
+			ID:               "change-1",
+			UserID:           "1",
+			OldEmail:         &oldEmail,
+			NewEmail:         "new@example.com",
+			ConfirmTokenHash: hashToken(token),
+			ExpiresAt:        time.Now().Add(time.Hour),
+			RevertExpiresAt:  time.Now().Add(24 * time.Hour),
+		}
+	}
+	confirmedAt := time.Now()
+
+	tests := []struct {
+		name          string
+		setupMock     func(*MockStore)
+		expectedError error
+	}{
+		{
+			name: "moves the user to the new address",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetEmailChangeByConfirmHash", mock.Anything, hashToken(token)).Return(pending(), nil)
+				mockStore.On("GetUserByEmail", mock.Anything, "new@example.com").Return(nil, store.ErrUserNotFound)
+				mockStore.On("ConfirmEmailChange", mock.Anything, "change-1").Return(nil)
+				mockStore.On("ChangeUserEmail", mock.Anything, "1", "new@example.com").Return(nil)
+			},
+		},
+		{
+			name: "unknown token",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetEmailChangeByConfirmHash", mock.Anything, hashToken(token)).Return(nil, store.ErrEmailChangeNotFound)
+			},
+			expectedError: ErrInvalidEmailChangeToken,
+		},
+		{
+			name: "expired token",
+			setupMock: func(mockStore *MockStore) {
+				expired := pending()
+				expired.ExpiresAt = time.Now().Add(-time.Minute)
+				mockStore.On("GetEmailChangeByConfirmHash", mock.Anything, hashToken(token)).Return(expired, nil)
+			},
+			expectedError: ErrInvalidEmailChangeToken,
+		},
+		{
+			name: "already confirmed",
+			setupMock: func(mockStore *MockStore) {
+				confirmed := pending()
+				confirmed.ConfirmedAt = &confirmedAt
+				mockStore.On("GetEmailChangeByConfirmHash", mock.Anything, hashToken(token)).Return(confirmed, nil)
+			},
+			expectedError: ErrInvalidEmailChangeToken,
+		},
+		{
+			name: "address taken while pending",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetEmailChangeByConfirmHash", mock.Anything, hashToken(token)).Return(pending(), nil)
+				mockStore.On("GetUserByEmail", mock.Anything, "new@example.com").Return(&store.User{ID: "2"}, nil)
+			},
+			expectedError: ErrEmailExists,
+		},
+		{
+			name: "reverted while pending",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetEmailChangeByConfirmHash", mock.Anything, hashToken(token)).Return(pending(), nil)
+				mockStore.On("GetUserByEmail", mock.Anything, "new@example.com").Return(nil, store.ErrUserNotFound)
+				mockStore.On("ConfirmEmailChange", mock.Anything, "change-1").Return(store.ErrEmailChangeNotFound)
+			},
+			expectedError: ErrInvalidEmailChangeToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := new(MockStore)
+			tt.setupMock(mockStore)
+			service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+
+			err := service.ConfirmEmailChange(context.Background(), token)
+			assert.Equal(t, tt.expectedError, err)
+			mockStore.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthService_RevertEmailChange(t *testing.T) {
+	const token = "revert-token"
+	oldEmail := "alice@example.com"
+	change := func() *store.EmailChange {
+		revertHash := hashToken(token)
+		return &store.EmailChange{
+			ID:              "change-1",
+			UserID:          "1",
+			OldEmail:        &oldEmail,
+			NewEmail:        "new@example.com",
+			RevertTokenHash: &revertHash,
+			ExpiresAt:       time.Now().Add(time.Hour),
+			RevertExpiresAt: time.Now().Add(24 * time.Hour),
+		}
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		setupMock     func(*MockStore)
+		expectedError error
+	}{
+		{
+			name: "cancels a pending change and revokes sessions and api keys",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetEmailChangeByRevertHash", mock.Anything, hashToken(token)).Return(change(), nil)
+				mockStore.On("RevertEmailChange", mock.Anything, "change-1").Return(nil)
+				mockStore.On("CancelPendingEmailChanges", mock.Anything, "1").Return(nil)
+				mockStore.On("DeletePasswordResetTokens", mock.Anything, "1").Return(nil)
+				mockStore.On("DeleteUserAPIKeys", mock.Anything, "1").Return(nil)
+				mockStore.On("DeleteUserSessions", mock.Anything, "1").Return(nil)
+			},
+		},
+		{
+			name: "restores the old address after confirmation",
+			setupMock: func(mockStore *MockStore) {
+				confirmed := change()
+				confirmed.ConfirmedAt = &now
+				mockStore.On("GetEmailChangeByRevertHash", mock.Anything, hashToken(token)).Return(confirmed, nil)
+				mockStore.On("RevertEmailChange", mock.Anything, "change-1").Return(nil)
+				mockStore.On("CancelPendingEmailChanges", mock.Anything, "1").Return(nil)
+				mockStore.On("ChangeUserEmail", mock.Anything, "1", oldEmail).Return(nil)
+				mockStore.On("DeletePasswordResetTokens", mock.Anything, "1").Return(nil)
+				mockStore.On("DeleteUserAPIKeys", mock.Anything, "1").Return(nil)
+				mockStore.On("DeleteUserSessions", mock.Anything, "1").Return(nil)
+			},
+		},
+		{
+			name: "unknown token",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetEmailChangeByRevertHash", mock.Anything, hashToken(token)).Return(nil, store.ErrEmailChangeNotFound)
+			},
+			expectedError: ErrInvalidEmailChangeToken,
+		},
+		{
+			name: "already reverted",
+			setupMock: func(mockStore *MockStore) {
+				reverted := change()
+				reverted.RevertedAt = &now
+				mockStore.On("GetEmailChangeByRevertHash", mock.Anything, hashToken(token)).Return(reverted, nil)
+			},
+			expectedError: ErrInvalidEmailChangeToken,
+		},
+		{
+			name: "revert window closed",
+			setupMock: func(mockStore *MockStore) {
+				expired := change()
+				expired.RevertExpiresAt = time.Now().Add(-time.Minute)
+				mockStore.On("GetEmailChangeByRevertHash", mock.Anything, hashToken(token)).Return(expired, nil)
+			},
+			expectedError: ErrInvalidEmailChangeToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := new(MockStore)
+			tt.setupMock(mockStore)
+			service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+
+			err := service.RevertEmailChange(context.Background(), token)
+			assert.Equal(t, tt.expectedError, err)
+			mockStore.AssertExpectations(t)
+		})
+	}
+}
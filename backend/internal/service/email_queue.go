@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/mail"
+)
+
+// emailLeaseMargin is how long a claimed email stays held past
+// EMAIL_TIMEOUT before another worker may take it over
+const emailLeaseMargin = time.Minute
+
+// EmailQueue is a mail.Mailer that stores messages in the database outbox
+// instead of sending them, so a slow or failing transport never fails the
+// request that sent the email. Run delivers them through the transport,
+// retrying failures with exponential backoff until EMAIL_MAX_ATTEMPTS have
+// failed or the transport rejects the message for good, which leaves it
+// dead until Requeue is called.
+type EmailQueue struct {
+	store  store.StoreInterface
+	config *config.Config
+	mailer mail.Mailer
+	wake   chan struct{}
+}
+
+func NewEmailQueue(s store.StoreInterface, cfg *config.Config, mailer mail.Mailer) *EmailQueue {
+	return &EmailQueue{
+		store:  s,
+		config: cfg,
+		mailer: mailer,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Send queues msg for delivery. The message is rendered first so it is
+// known to be valid and keeps its Date and Message-ID across attempts.
+func (q *EmailQueue) Send(ctx context.Context, msg *mail.Message) error {
+	if _, err := msg.Bytes(); err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	email := &store.OutboxEmail{
+		ID:            generateID(),
+		Recipient:     strings.Join(msg.To, ", "),
+		Subject:       msg.Subject,
+		Message:       string(encoded),
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	if err := q.store.EnqueueEmail(ctx, email); err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+
+	// Let an idle worker pick it up without waiting for the next poll
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers queued email with EMAIL_QUEUE_WORKERS workers until ctx is
+// done. Sends in progress are finished rather than cut off, then the
+// workers keep sending due emails for up to EMAIL_QUEUE_DRAIN_TIMEOUT
+// before Run returns; anything left is sent after the next start.
+func (q *EmailQueue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range q.config.EmailQueueWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *EmailQueue) work(ctx context.Context) {
+	poll := time.Duration(q.config.EmailQueuePollInterval) * time.Second
+	for {
+		for ctx.Err() == nil && q.deliverNext(context.WithoutCancel(ctx)) {
+		}
+
+		select {
+		case <-ctx.Done():
+			q.drain(context.WithoutCancel(ctx))
+			return
+		case <-q.wake:
+		case <-time.After(poll):
+		}
+	}
+}
+
+func (q *EmailQueue) drain(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(q.config.EmailQueueDrainTimeout)*time.Second)
+	defer cancel()
+	for ctx.Err() == nil && q.deliverNext(ctx) {
+	}
+}
+
+// deliverNext sends the email that has been due longest and reports
+// whether there was one
+func (q *EmailQueue) deliverNext(ctx context.Context) bool {
+	timeout := time.Duration(q.config.EmailTimeout) * time.Second
+	email, err := q.store.ClaimOutboxEmail(ctx, time.Now().Add(timeout+emailLeaseMargin))
+	if err != nil {
+		if !errors.Is(err, store.ErrOutboxEmpty) {
+			slog.Error("Failed to claim queued email", "error", err)
+		}
+		return false
+	}
+
+	var msg mail.Message
+	if err := json.Unmarshal([]byte(email.Message), &msg); err != nil {
+		q.kill(ctx, email, fmt.Errorf("failed to decode queued email: %w", err))
+		return true
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, timeout)
+	err = q.mailer.Send(sendCtx, &msg)
+	cancel()
+
+	switch {
+	case err == nil:
+		if err := q.store.DeleteOutboxEmail(ctx, email.ID); err != nil {
+			slog.Error("Failed to remove delivered email from the queue", "email_id", email.ID, "error", err)
+		}
+	case mail.IsPermanent(err) || email.Attempts >= q.config.EmailMaxAttempts:
+		q.kill(ctx, email, err)
+	default:
+		next := time.Now().Add(q.retryDelay(email.Attempts))
+		slog.Warn("Failed to send email, will retry", "email_id", email.ID, "attempts", email.Attempts, "next_attempt_at", next, "error", err)
+		if err := q.store.RetryOutboxEmail(ctx, email.ID, next, err.Error()); err != nil {
+			slog.Error("Failed to schedule email retry", "email_id", email.ID, "error", err)
+		}
+	}
+	return true
+}
+
+func (q *EmailQueue) kill(ctx context.Context, email *store.OutboxEmail, cause error) {
+	slog.Error("Giving up on email", "email_id", email.ID, "attempts", email.Attempts, "error", cause)
+	if err := q.store.KillOutboxEmail(ctx, email.ID, cause.Error()); err != nil {
+		slog.Error("Failed to mark email as dead", "email_id", email.ID, "error", err)
+	}
+}
+
+// retryDelay doubles EMAIL_RETRY_BASE_DELAY for every failed attempt, up to
+// EMAIL_RETRY_MAX_DELAY, and picks a random point in its upper half so
+// emails that failed together are not all retried together
+func (q *EmailQueue) retryDelay(attempts int) time.Duration {
+	delay := time.Duration(q.config.EmailRetryBaseDelay) * time.Second
+	limit := time.Duration(q.config.EmailRetryMaxDelay) * time.Second
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	delay = min(delay, limit)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// ListEmails returns a page of queued emails, optionally only those in one
+// state
+func (q *EmailQueue) ListEmails(ctx context.Context, status string, limit, offset int) (*store.OutboxEmailList, error) {
+	return q.store.ListOutboxEmails(ctx, status, limit, offset)
+}
+
+// Requeue sends a dead email again with a fresh set of attempts
+func (q *EmailQueue) Requeue(ctx context.Context, id string) error {
+	if err := q.store.RequeueOutboxEmail(ctx, id); err != nil {
+		if errors.Is(err, store.ErrOutboxEmailNotFound) {
+			return ErrQueuedEmailNotFound
+		}
+		return err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/mail"
+)
+
+// queueConfig is testConfig with a single queue worker
+func queueConfig() *config.Config {
+	cfg := testConfig()
+	cfg.EmailQueueWorkers = 1
+	cfg.EmailQueuePollInterval = 1
+	cfg.EmailQueueDrainTimeout = 5
+	cfg.EmailMaxAttempts = 3
+	cfg.EmailRetryBaseDelay = 30
+	cfg.EmailRetryMaxDelay = 3600
+	return cfg
+}
+
+// failingMailer fails every send with err
+type failingMailer struct{ err error }
+
+func (m failingMailer) Send(ctx context.Context, msg *mail.Message) error { return m.err }
+
+// queuedEmail returns msg as ClaimOutboxEmail would after attempts tries
+func queuedEmail(t *testing.T, msg *mail.Message, attempts int) *store.OutboxEmail {
+	t.Helper()
+	encoded, err := json.Marshal(msg)
+	assert.NoError(t, err)
+	return &store.OutboxEmail{ID: "email-1", Message: string(encoded), Status: store.OutboxPending, Attempts: attempts}
+}
+
+func TestEmailQueue_Send(t *testing.T) {
+	mockStore := new(MockStore)
+	queue := NewEmailQueue(mockStore, queueConfig(), &mail.Memory{})
+
+	var queued *store.OutboxEmail
+	mockStore.On("EnqueueEmail", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { queued = args.Get(1).(*store.OutboxEmail) }).
+		Return(nil)
+
+	msg := &mail.Message{From: "noreply@example.com", To: []string{"alice@example.com"}, Subject: "Welcome", Text: "Hello"}
+	assert.NoError(t, queue.Send(context.Background(), msg))
+
+	if assert.NotNil(t, queued) {
+		assert.Equal(t, "alice@example.com", queued.Recipient)
+		assert.Equal(t, "Welcome", queued.Subject)
+
+		// The message keeps the id it was given when it was queued
+		var decoded mail.Message
+		assert.NoError(t, json.Unmarshal([]byte(queued.Message), &decoded))
+		assert.NotEmpty(t, decoded.MessageID)
+		assert.Equal(t, msg.MessageID, decoded.MessageID)
+		assert.Equal(t, "Hello", decoded.Text)
+	}
+
+	t.Run("an invalid message is refused", func(t *testing.T) {
+		mockStore := new(MockStore)
+		queue := NewEmailQueue(mockStore, queueConfig(), &mail.Memory{})
+
+		err := queue.Send(context.Background(), &mail.Message{To: []string{"alice@example.com"}})
+		assert.ErrorIs(t, err, mail.ErrNoSender)
+		mockStore.AssertNotCalled(t, "EnqueueEmail", mock.Anything, mock.Anything)
+	})
+}
+
+func TestEmailQueue_Deliver(t *testing.T) {
+	msg := &mail.Message{From: "noreply@example.com", To: []string{"alice@example.com"}, Subject: "Welcome", Text: "Hello"}
+
+	t.Run("a delivered email is removed", func(t *testing.T) {
+		mockStore := new(MockStore)
+		transport := &mail.Memory{}
+		queue := NewEmailQueue(mockStore, queueConfig(), transport)
+
+		mockStore.On("ClaimOutboxEmail", mock.Anything, mock.Anything).Return(queuedEmail(t, msg, 1), nil)
+		mockStore.On("DeleteOutboxEmail", mock.Anything, "email-1").Return(nil)
+
+		assert.True(t, queue.deliverNext(context.Background()))
+		assert.Len(t, transport.Messages(), 1)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("a failed send is retried later", func(t *testing.T) {
+		mockStore := new(MockStore)
+		queue := NewEmailQueue(mockStore, queueConfig(), failingMailer{err: assert.AnError})
+
+		mockStore.On("ClaimOutboxEmail", mock.Anything, mock.Anything).Return(queuedEmail(t, msg, 2), nil)
+		mockStore.On("RetryOutboxEmail", mock.Anything, "email-1", mock.MatchedBy(func(next time.Time) bool {
+			// The second failure waits between 30 and 60 seconds
+			wait := time.Until(next)
+			return wait >= 29*time.Second && wait <= 60*time.Second
+		}), assert.AnError.Error()).Return(nil)
+
+		assert.True(t, queue.deliverNext(context.Background()))
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("the last attempt leaves the email dead", func(t *testing.T) {
+		mockStore := new(MockStore)
+		queue := NewEmailQueue(mockStore, queueConfig(), failingMailer{err: assert.AnError})
+
+		mockStore.On("ClaimOutboxEmail", mock.Anything, mock.Anything).Return(queuedEmail(t, msg, 3), nil)
+		mockStore.On("KillOutboxEmail", mock.Anything, "email-1", assert.AnError.Error()).Return(nil)
+
+		assert.True(t, queue.deliverNext(context.Background()))
+		mockStore.AssertNotCalled(t, "RetryOutboxEmail", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("a permanent rejection is not retried", func(t *testing.T) {
+		mockStore := new(MockStore)
+		queue := NewEmailQueue(mockStore, queueConfig(), failingMailer{err: &mail.ProviderError{StatusCode: http.StatusUnprocessableEntity}})
+
+		mockStore.On("ClaimOutboxEmail", mock.Anything, mock.Anything).Return(queuedEmail(t, msg, 1), nil)
+		mockStore.On("KillOutboxEmail", mock.Anything, "email-1", mock.Anything).Return(nil)
+
+		assert.True(t, queue.deliverNext(context.Background()))
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("nothing due", func(t *testing.T) {
+		mockStore := new(MockStore)
+		queue := NewEmailQueue(mockStore, queueConfig(), &mail.Memory{})
+
+		mockStore.On("ClaimOutboxEmail", mock.Anything, mock.Anything).Return(nil, store.ErrOutboxEmpty)
+
+		assert.False(t, queue.deliverNext(context.Background()))
+	})
+}
+
+func TestEmailQueue_RetryDelay(t *testing.T) {
+	queue := NewEmailQueue(new(MockStore), queueConfig(), &mail.Memory{})
+
+	tests := []struct {
+		attempts int
+		limit    time.Duration
+	}{
+		{attempts: 1, limit: 30 * time.Second},
+		{attempts: 2, limit: time.Minute},
+		{attempts: 4, limit: 4 * time.Minute},
+		{attempts: 20, limit: time.Hour},
+	}
+
+	for _, tt := range tests {
+		for range 20 {
+			delay := queue.retryDelay(tt.attempts)
+			assert.GreaterOrEqual(t, delay, tt.limit/2, "attempt %d", tt.attempts)
+			assert.LessOrEqual(t, delay, tt.limit, "attempt %d", tt.attempts)
+		}
+	}
+}
+
+func TestEmailQueue_RunDrainsOnShutdown(t *testing.T) {
+	mockStore := new(MockStore)
+	transport := &mail.Memory{}
+	queue := NewEmailQueue(mockStore, queueConfig(), transport)
+
+	msg := &mail.Message{From: "noreply@example.com", To: []string{"alice@example.com"}, Subject: "Welcome", Text: "Hello"}
+	mockStore.On("ClaimOutboxEmail", mock.Anything, mock.Anything).Return(queuedEmail(t, msg, 1), nil).Once()
+	mockStore.On("ClaimOutboxEmail", mock.Anything, mock.Anything).Return(nil, store.ErrOutboxEmpty)
+	mockStore.On("DeleteOutboxEmail", mock.Anything, "email-1").Return(nil)
+
+	// Stopped before the workers start, the queue still sends what is due
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	queue.Run(ctx)
+
+	assert.Len(t, transport.Messages(), 1)
+	mockStore.AssertExpectations(t)
+}
+
+func TestEmailQueue_Requeue(t *testing.T) {
+	mockStore := new(MockStore)
+	queue := NewEmailQueue(mockStore, queueConfig(), &mail.Memory{})
+
+	mockStore.On("RequeueOutboxEmail", mock.Anything, "email-1").Return(nil)
+	mockStore.On("RequeueOutboxEmail", mock.Anything, "missing").Return(store.ErrOutboxEmailNotFound)
+
+	assert.NoError(t, queue.Requeue(context.Background(), "email-1"))
+	assert.Equal(t, ErrQueuedEmailNotFound, queue.Requeue(context.Background(), "missing"))
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/votex-template/backend/pkg/mail"
+)
+
+func TestNewMailer(t *testing.T) {
+	tests := []struct {
+		transport string
+		expected  mail.Mailer
+	}{
+		{transport: "log", expected: &mail.Log{}},
+		{transport: "file", expected: &mail.File{Dir: "./data/mail"}},
+		{transport: "smtp", expected: &mail.SMTP{Host: "smtp.example.com", Port: 587, Security: mail.StartTLS}},
+		{transport: "http", expected: &mail.HTTP{URL: "https://api.example.com/emails", APIKey: "key"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.transport, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.EmailTransport = tt.transport
+			cfg.EmailFileDir = "./data/mail"
+			cfg.EmailFileFormat = "eml"
+			cfg.SMTPHost = "smtp.example.com"
+			cfg.SMTPPort = 587
+			cfg.SMTPSecurity = "starttls"
+			cfg.EmailAPIURL = "https://api.example.com/emails"
+			cfg.EmailAPIKey = "key"
+
+			assert.Equal(t, tt.expected, NewMailer(cfg, nil))
+		})
+	}
+}
+
+func TestLoadDKIM(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "dkim.pem")
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	cfg := testConfig()
+	dkim, err := LoadDKIM(cfg)
+	assert.NoError(t, err)
+	assert.Nil(t, dkim, "signing is off without a key file")
+
+	cfg.DKIMKeyFile = keyFile
+	cfg.DKIMDomain = "example.com"
+	cfg.DKIMSelector = "mail2026"
+	dkim, err = LoadDKIM(cfg)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dkim) {
+		assert.Equal(t, "example.com", dkim.Domain)
+		assert.Equal(t, "mail2026", dkim.Selector)
+		assert.Equal(t, key, dkim.Key)
+		assert.Equal(t, &mail.Signed{Mailer: &mail.Log{}, DKIM: dkim}, NewMailer(cfg, dkim))
+	}
+
+	cfg.DKIMKeyFile = filepath.Join(t.TempDir(), "missing.pem")
+	_, err = LoadDKIM(cfg)
+	assert.Error(t, err)
+}
+
+func TestEmailService_SendPasswordResetEmail(t *testing.T) {
+	mailer := &mail.Memory{}
+	service := NewEmailService(testConfig(), mailer)
+
+	err := service.SendPasswordResetEmail(context.Background(), "alice@example.com", "reset-token")
+	assert.NoError(t, err)
+
+	messages := mailer.Messages()
+	if assert.Len(t, messages, 1) {
+		msg := messages[0]
+		link := "http://localhost:5173/auth/reset-password?token=reset-token"
+		assert.Equal(t, "noreply@example.com", msg.From)
+		assert.Equal(t, []string{"alice@example.com"}, msg.To)
+		assert.Equal(t, "Password Reset Request", msg.Subject)
+		assert.True(t, strings.HasPrefix(msg.Text, "Hello,\n\nYou have requested"), "text %q", msg.Text)
+		assert.Contains(t, msg.Text, link)
+		assert.Contains(t, msg.Text, "The Vortex Team")
+		assert.Contains(t, msg.HTML, `href="`+link+`"`)
+		assert.Equal(t, "en", msg.Headers["Content-Language"])
+		assert.Equal(t, "auto-generated", msg.Headers["Auto-Submitted"])
+	}
+}
+
+func TestEmailService_Locales(t *testing.T) {
+	tests := []struct {
+		name     string
+		locales  []string
+		language string
+		subject  string
+	}{
+		{name: "default", language: "en", subject: "Your sign-in link"},
+		{name: "translated", locales: []string{"de"}, language: "de", subject: "Ihr Anmeldelink"},
+		{name: "regional variant", locales: []string{"de-AT", "en"}, language: "de", subject: "Ihr Anmeldelink"},
+		{name: "preferred default", locales: []string{"en-GB", "de"}, language: "en", subject: "Your sign-in link"},
+		{name: "untranslated", locales: []string{"fr"}, language: "en", subject: "Your sign-in link"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mailer := &mail.Memory{}
+			service := NewEmailService(testConfig(), mailer)
+
+			ctx := mail.WithLocales(context.Background(), tt.locales...)
+			err := service.SendMagicLinkEmail(ctx, "alice@example.com", "alice", "magic-token")
+			assert.NoError(t, err)
+
+			msg := mailer.Messages()[0]
+			assert.Equal(t, tt.subject, msg.Subject)
+			assert.Equal(t, tt.language, msg.Headers["Content-Language"])
+			assert.Contains(t, msg.Text, "http://localhost:5173/auth/magic-link?token=magic-token")
+		})
+	}
+}
+
+func TestEmailService_EscapesHTML(t *testing.T) {
+	mailer := &mail.Memory{}
+	service := NewEmailService(testConfig(), mailer)
+
+	err := service.SendVerificationEmail(context.Background(), "alice@example.com", "<b>alice</b>", "token")
+	assert.NoError(t, err)
+
+	msg := mailer.Messages()[0]
+	assert.Contains(t, msg.Text, "Hello <b>alice</b>,")
+	assert.Contains(t, msg.HTML, "Hello &lt;b&gt;alice&lt;/b&gt;,")
+}
+
+func TestEmailService_PreviewEmail(t *testing.T) {
+	service := NewEmailService(testConfig(), nil)
+	names, locales := service.EmailTemplates()
+	assert.Equal(t, []string{"en", "de"}, locales)
+
+	// Every template needs a preview, and every translation has to render
+	for _, name := range names {
+		for _, locale := range locales {
+			msg, err := service.PreviewEmail(context.Background(), name, locale)
+			if assert.NoError(t, err, "%s in %s", name, locale) {
+				assert.Equal(t, locale, msg.Headers["Content-Language"], name)
+				assert.NotEmpty(t, msg.Subject, name)
+				assert.NotEmpty(t, msg.HTML, name)
+				_, err := msg.Bytes()
+				assert.NoError(t, err, name)
+			}
+		}
+	}
+	assert.Len(t, emailPreviews, len(names))
+
+	_, err := service.PreviewEmail(context.Background(), "missing", "")
+	assert.ErrorIs(t, err, mail.ErrUnknownTemplate)
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/mail"
+)
+
+func TestAuthService_VerifyEmail(t *testing.T) {
+	const token = "verification-token"
+	valid := func() *store.EmailVerificationToken {
+		return &store.EmailVerificationToken{
+			ID:        "token-1",
+			UserID:    "1",
+			TokenHash: hashToken(token),
+			Email:     "alice@example.com",
+			ExpiresAt: time.Now().Add(time.Hour),
+			CreatedAt: time.Now(),
+		}
+	}
+
+	tests := []struct {
+		name          string
+		setupMock     func(*MockStore)
+		expectedError error
+	}{
+		{
+			name: "verifies the address the link was sent to",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetEmailVerificationToken", mock.Anything, hashToken(token)).Return(valid(), nil)
+				mockStore.On("MarkEmailVerificationTokenUsed", mock.Anything, "token-1").Return(nil)
+				mockStore.On("MarkEmailVerified", mock.Anything, "1", "alice@example.com").Return(nil)
+			},
+		},
+		{
+			name: "unknown token",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetEmailVerificationToken", mock.Anything, hashToken(token)).Return(nil, store.ErrVerificationTokenNotFound)
+			},
+			expectedError: ErrInvalidVerificationToken,
+		},
+		{
+			name: "expired token",
+			setupMock: func(mockStore *MockStore) {
+				expired := valid()
+				expired.ExpiresAt = time.Now().Add(-time.Minute)
+				mockStore.On("GetEmailVerificationToken", mock.Anything, hashToken(token)).Return(expired, nil)
+			},
+			expectedError: ErrInvalidVerificationToken,
+		},
+		{
+			name: "used token",
+			setupMock: func(mockStore *MockStore) {
+				used := valid()
+				used.Used = true
+				mockStore.On("GetEmailVerificationToken", mock.Anything, hashToken(token)).Return(used, nil)
+			},
+			expectedError: ErrInvalidVerificationToken,
+		},
+		{
+			name: "email changed since the link was sent",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetEmailVerificationToken", mock.Anything, hashToken(token)).Return(valid(), nil)
+				mockStore.On("MarkEmailVerificationTokenUsed", mock.Anything, "token-1").Return(nil)
+				mockStore.On("MarkEmailVerified", mock.Anything, "1", "alice@example.com").Return(store.ErrUserNotFound)
+			},
+			expectedError: ErrInvalidVerificationToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := new(MockStore)
+			tt.setupMock(mockStore)
+			service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+
+			err := service.VerifyEmail(context.Background(), token)
+			assert.Equal(t, tt.expectedError, err)
+			mockStore.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthService_ResendVerificationEmail(t *testing.T) {
+	email := "alice@example.com"
+	verifiedAt := time.Now()
+
+	tests := []struct {
+		name      string
+		setupMock func(*MockStore)
+		expectNew bool
+	}{
+		{
+			name: "sends a new link",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetUserByEmail", mock.Anything, email).Return(&store.User{ID: "1", Username: "alice", Email: &email}, nil)
+				mockStore.On("LatestEmailVerificationToken", mock.Anything, "1").
+					Return(&store.EmailVerificationToken{CreatedAt: time.Now().Add(-10 * time.Minute)}, nil)
+			},
+			expectNew: true,
+		},
+		{
+			name: "throttled within the resend interval",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetUserByEmail", mock.Anything, email).Return(&store.User{ID: "1", Username: "alice", Email: &email}, nil)
+				mockStore.On("LatestEmailVerificationToken", mock.Anything, "1").
+					Return(&store.EmailVerificationToken{CreatedAt: time.Now().Add(-time.Minute)}, nil)
+			},
+		},
+		{
+			name: "already verified",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetUserByEmail", mock.Anything, email).
+					Return(&store.User{ID: "1", Username: "alice", Email: &email, EmailVerifiedAt: &verifiedAt}, nil)
+			},
+		},
+		{
+			name: "unknown address",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetUserByEmail", mock.Anything, email).Return(nil, store.ErrUserNotFound)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := new(MockStore)
+			tt.setupMock(mockStore)
+			cfg := testConfig()
+			service := &AuthService{Store: mockStore, Cfg: cfg, EmailService: NewEmailService(cfg, &mail.Memory{}), Keys: testKeyring()}
+
+			var stored *store.EmailVerificationToken
+			mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "alice", Email: &email}, nil)
+			mockStore.On("CleanupExpiredEmailVerificationTokens", mock.Anything).Return(nil)
+			mockStore.On("CreateEmailVerificationToken", mock.Anything, mock.AnythingOfType("*store.EmailVerificationToken")).
+				Run(func(args mock.Arguments) { stored = args.Get(1).(*store.EmailVerificationToken) }).
+				Return(nil)
+
+			// Every outcome looks the same to the caller
+			err := service.ResendVerificationEmail(context.Background(), email)
+			assert.NoError(t, err)
+
+			if tt.expectNew {
+				assert.Equal(t, "1", stored.UserID)
+				assert.Equal(t, email, stored.Email)
+				assert.Len(t, stored.TokenHash, 64, "only the digest is stored")
+				assert.WithinDuration(t, time.Now().Add(48*time.Hour), stored.ExpiresAt, time.Minute)
+			} else {
+				mockStore.AssertNotCalled(t, "CreateEmailVerificationToken", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestAuthService_EmailVerificationEnforcement(t *testing.T) {
+	email := "alice@example.com"
+
+	t.Run("login mode registers without a session", func(t *testing.T) {
+		mockStore := new(MockStore)
+		cfg := testConfig()
+		cfg.EmailVerification = config.VerifyEmailLogin
+		service := &AuthService{Store: mockStore, Cfg: cfg, EmailService: NewEmailService(cfg, &mail.Memory{}), Keys: testKeyring()}
+
+		mockStore.On("GetUserByUsername", mock.Anything, "alice").Return(nil, store.ErrUserNotFound)
+		mockStore.On("GetUserByEmail", mock.Anything, email).Return(nil, store.ErrUserNotFound)
+		mockStore.On("CreateUser", mock.Anything, mock.AnythingOfType("string"), "alice", email, mock.AnythingOfType("string")).Return(nil)
+		mockStore.On("AssignRole", mock.Anything, mock.AnythingOfType("string"), "user").Return(nil)
+		mockStore.On("ClaimAdminBootstrap", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+		mockStore.On("CleanupExpiredEmailVerificationTokens", mock.Anything).Return(nil)
+		mockStore.On("CreateEmailVerificationToken", mock.Anything, mock.AnythingOfType("*store.EmailVerificationToken")).Return(nil)
+
+		tokens, user, err := service.Register(context.Background(), "alice", email, "password123")
+		assert.NoError(t, err)
+		assert.Nil(t, tokens)
+		assert.Equal(t, "alice", user.Username)
+		mockStore.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("enforced verification requires an email to register", func(t *testing.T) {
+		mockStore := new(MockStore)
+		cfg := testConfig()
+		cfg.EmailVerification = config.VerifyEmailSensitive
+		service := &AuthService{Store: mockStore, Cfg: cfg, Keys: testKeyring()}
+
+		_, _, err := service.Register(context.Background(), "alice", "", "password123")
+		assert.Equal(t, ErrEmailRequired, err)
+	})
+
+	t.Run("login mode rejects unverified users", func(t *testing.T) {
+		mockStore := new(MockStore)
+		cfg := testConfig()
+		cfg.EmailVerification = config.VerifyEmailLogin
+		service := &AuthService{Store: mockStore, Cfg: cfg, Keys: testKeyring()}
+
+		mockStore.On("GetUserByUsername", mock.Anything, "alice").
+			Return(&store.User{ID: "1", Username: "alice", Email: &email, PasswordHash: mustHash(t, "password123")}, nil)
+		expectLoginThrottle(mockStore)
+
+		tokens, _, err := service.Login(context.Background(), "alice", "password123", "192.0.2.1")
+		assert.Equal(t, ErrEmailNotVerified, err)
+		assert.Nil(t, tokens)
+	})
+
+	t.Run("password reset skips unverified addresses when enforced", func(t *testing.T) {
+		mockStore := new(MockStore)
+		cfg := testConfig()
+		cfg.EmailVerification = config.VerifyEmailSensitive
+		service := &AuthService{Store: mockStore, Cfg: cfg, Keys: testKeyring()}
+
+		mockStore.On("GetUserByEmail", mock.Anything, email).Return(&store.User{ID: "1", Username: "alice", Email: &email}, nil)
+
+		assert.NoError(t, service.RequestPasswordReset(context.Background(), email))
+		mockStore.AssertNotCalled(t, "CreatePasswordResetToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
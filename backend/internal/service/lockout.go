@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/user/votex-template/backend/internal/store"
+)
+
+// LoginLockedError is returned by Login while the account or the client IP
+// is locked out after repeated failed logins. Which of the two is locked is
+// not revealed. It matches ErrLoginLocked with errors.Is.
+type LoginLockedError struct {
+	Until time.Time
+}
+
+func (e *LoginLockedError) Error() string {
+	return ErrLoginLocked.Error()
+}
+
+func (e *LoginLockedError) Is(target error) bool {
+	return target == ErrLoginLocked
+}
+
+// UnlockAccount lifts a lockout from the link emailed to the account owner
+func (s *AuthService) UnlockAccount(ctx context.Context, token string) error {
+	throttle, err := s.Store.GetLoginThrottleByUnlockHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, store.ErrLoginThrottleNotFound) {
+			return ErrInvalidUnlockToken
+		}
+		return err
+	}
+	if err := s.Store.ClearLoginFailures(ctx, throttle.Scope, throttle.Subject); err != nil {
+		return err
+	}
+
+	s.emitSecurityEvent(ctx, SecurityEvent{
+		Type:     SecurityEventLoginUnlocked,
+		Username: throttle.Subject,
+		Details:  map[string]any{"method": "email"},
+	})
+	return nil
+}
+
+// UnlockUser lifts a lockout on behalf of an administrator
+func (s *AuthService) UnlockUser(ctx context.Context, userID, actorID string) error {
+	dbUser, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if err := s.Store.ClearLoginFailures(ctx, store.LoginScopeAccount, dbUser.Username); err != nil {
+		return err
+	}
+
+	s.emitSecurityEvent(ctx, SecurityEvent{
+		Type:     SecurityEventLoginUnlocked,
+		UserID:   dbUser.ID,
+		Username: dbUser.Username,
+		Details:  map[string]any{"method": "admin", "actor_id": actorID},
+	})
+	return nil
+}
+
+// checkLoginLockout refuses a login attempt while the account or the client
+// IP it comes from is locked
+func (s *AuthService) checkLoginLockout(ctx context.Context, username, ip string) error {
+	var until time.Time
+	for scope, subject := range loginThrottleSubjects(username, ip) {
+		throttle, err := s.Store.GetLoginThrottle(ctx, scope, subject)
+		if errors.Is(err, store.ErrLoginThrottleNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if throttle.LockedUntil != nil && throttle.LockedUntil.After(until) {
+			until = *throttle.LockedUntil
+		}
+	}
+	if time.Now().Before(until) {
+		return &LoginLockedError{Until: until}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login against the username tried and
+// the client IP, locking either once it passes its threshold. Unknown
+// usernames are counted too, so lockouts do not reveal which accounts exist.
+// dbUser is nil when the username is unknown.
+func (s *AuthService) recordLoginFailure(ctx context.Context, username, ip string, dbUser *store.User) {
+	window := time.Duration(s.Cfg.LockoutWindow) * time.Minute
+	if err := s.Store.DeleteStaleLoginThrottles(ctx, time.Now().Add(-window)); err != nil {
+		slog.Warn("Failed to clean up stale login throttles", "error", err)
+	}
+
+	s.countLoginFailure(ctx, store.LoginScopeAccount, username, s.Cfg.LockoutThreshold, ip, dbUser)
+	if ip != "" {
+		s.countLoginFailure(ctx, store.LoginScopeIP, ip, s.Cfg.LockoutIPThreshold, ip, nil)
+	}
+}
+
+func (s *AuthService) countLoginFailure(ctx context.Context, scope, subject string, threshold int, ip string, dbUser *store.User) {
+	throttle, err := s.Store.RecordLoginFailure(ctx, scope, subject)
+	if err != nil {
+		slog.Warn("Failed to record login failure", "scope", scope, "error", err)
+		return
+	}
+	if throttle.Failures < threshold {
+		return
+	}
+
+	until := time.Now().Add(s.lockoutDuration(throttle.Failures - threshold))
+
+	// The owner gets one unlock link per run of lockouts
+	var unlockToken string
+	var unlockHash *string
+	if dbUser != nil && dbUser.Email != nil && *dbUser.Email != "" && throttle.UnlockTokenHash == nil {
+		unlockToken = generateSecureToken()
+		hash := hashToken(unlockToken)
+		unlockHash = &hash
+	}
+	if err := s.Store.LockLogin(ctx, scope, subject, until, unlockHash); err != nil {
+		slog.Warn("Failed to lock login", "scope", scope, "error", err)
+		return
+	}
+
+	event := SecurityEvent{
+		Type: SecurityEventLoginLocked,
+		IP:   ip,
+		Details: map[string]any{
+			"scope":        scope,
+			"failures":     throttle.Failures,
+			"locked_until": until,
+		},
+	}
+	if scope == store.LoginScopeAccount {
+		event.Username = subject
+		if dbUser != nil {
+			event.UserID = dbUser.ID
+		}
+	}
+	s.emitSecurityEvent(ctx, event)
+
+	if unlockToken != "" {
+		if err := s.EmailService.SendAccountLockedEmail(ctx, *dbUser.Email, dbUser.Username, unlockToken, until); err != nil {
+			slog.Error("Failed to send account locked email", "user_id", dbUser.ID, "error", err)
+		}
+	}
+}
+
+// clearLoginFailures forgets the failed logins for an account once its
+// password has been given. The client IP keeps its count, so signing in to
+// one account does not buy more guesses against others.
+func (s *AuthService) clearLoginFailures(ctx context.Context, username string) {
+	if err := s.Store.ClearLoginFailures(ctx, store.LoginScopeAccount, username); err != nil {
+		slog.Warn("Failed to clear login failures", "error", err)
+	}
+}
+
+// lockoutDuration doubles LOCKOUT_DURATION for every failure past the
+// threshold, up to LOCKOUT_MAX_DURATION
+func (s *AuthService) lockoutDuration(excess int) time.Duration {
+	duration := time.Duration(s.Cfg.LockoutDuration) * time.Minute
+	limit := time.Duration(s.Cfg.LockoutMaxDuration) * time.Minute
+	for i := 0; i < excess && duration < limit; i++ {
+		duration *= 2
+	}
+	return min(duration, limit)
+}
+
+// loginThrottleSubjects maps each throttle scope to the subject a login
+// attempt counts against
+func loginThrottleSubjects(username, ip string) map[string]string {
+	subjects := map[string]string{store.LoginScopeAccount: username}
+	if ip != "" {
+		subjects[store.LoginScopeIP] = ip
+	}
+	return subjects
+}
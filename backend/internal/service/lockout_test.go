@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/mail"
+)
+
+// recordedEvents is a SecurityEventSink that keeps what it is sent
+type recordedEvents struct {
+	mu     sync.Mutex
+	events []SecurityEvent
+}
+
+func (r *recordedEvents) Emit(ctx context.Context, event SecurityEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func newLockoutService(mockStore *MockStore) (*AuthService, *recordedEvents) {
+	cfg := testConfig()
+	events := &recordedEvents{}
+	return &AuthService{Store: mockStore, Cfg: cfg, EmailService: NewEmailService(cfg, &mail.Memory{}), Keys: testKeyring(), Events: events}, events
+}
+
+func TestAuthService_LoginLockout(t *testing.T) {
+	const ip = "192.0.2.1"
+	email := "alice@example.com"
+	alice := func(t *testing.T) *store.User {
+		return &store.User{ID: "1", Username: "alice", Email: &email, PasswordHash: mustHash(t, "password123")}
+	}
+
+	t.Run("a locked account is refused before the password is checked", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service, _ := newLockoutService(mockStore)
+
+		until := time.Now().Add(10 * time.Minute)
+		mockStore.On("GetLoginThrottle", mock.Anything, store.LoginScopeAccount, "alice").
+			Return(&store.LoginThrottle{Failures: 5, LockedUntil: &until}, nil)
+		mockStore.On("GetLoginThrottle", mock.Anything, store.LoginScopeIP, ip).Return(nil, store.ErrLoginThrottleNotFound)
+
+		tokens, _, err := service.Login(context.Background(), "alice", "password123", ip)
+		assert.Nil(t, tokens)
+		assert.True(t, errors.Is(err, ErrLoginLocked))
+		var locked *LoginLockedError
+		if assert.True(t, errors.As(err, &locked)) {
+			assert.True(t, until.Equal(locked.Until))
+		}
+		mockStore.AssertNotCalled(t, "GetUserByUsername", mock.Anything, mock.Anything)
+	})
+
+	t.Run("a locked client IP is refused for every account", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service, _ := newLockoutService(mockStore)
+
+		until := time.Now().Add(time.Minute)
+		mockStore.On("GetLoginThrottle", mock.Anything, store.LoginScopeAccount, "bob").Return(nil, store.ErrLoginThrottleNotFound)
+		mockStore.On("GetLoginThrottle", mock.Anything, store.LoginScopeIP, ip).
+			Return(&store.LoginThrottle{Failures: 20, LockedUntil: &until}, nil)
+
+		_, _, err := service.Login(context.Background(), "bob", "password123", ip)
+		assert.True(t, errors.Is(err, ErrLoginLocked))
+	})
+
+	t.Run("an expired lockout lets the login through", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service, _ := newLockoutService(mockStore)
+
+		until := time.Now().Add(-time.Minute)
+		mockStore.On("GetLoginThrottle", mock.Anything, store.LoginScopeAccount, "alice").
+			Return(&store.LoginThrottle{Failures: 5, LockedUntil: &until}, nil)
+		mockStore.On("GetUserByUsername", mock.Anything, "alice").Return(alice(t), nil)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(nil, store.ErrMFANotFound)
+		mockStore.On("CreateSession", mock.Anything, mock.Anything, "1", mock.Anything, mock.Anything).Return(nil)
+		expectTokenIssue(mockStore, "1")
+		expectLoginThrottle(mockStore)
+
+		tokens, _, err := service.Login(context.Background(), "alice", "password123", ip)
+		assert.NoError(t, err)
+		assert.NotNil(t, tokens)
+		mockStore.AssertCalled(t, "ClearLoginFailures", mock.Anything, store.LoginScopeAccount, "alice")
+		mockStore.AssertNotCalled(t, "ClearLoginFailures", mock.Anything, store.LoginScopeIP, mock.Anything)
+	})
+
+	t.Run("reaching the threshold locks the account and emails an unlock link", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service, events := newLockoutService(mockStore)
+
+		mockStore.On("GetUserByUsername", mock.Anything, "alice").Return(alice(t), nil)
+		mockStore.On("RecordLoginFailure", mock.Anything, store.LoginScopeAccount, "alice").
+			Return(&store.LoginThrottle{Scope: store.LoginScopeAccount, Subject: "alice", Failures: 5}, nil)
+		mockStore.On("RecordLoginFailure", mock.Anything, store.LoginScopeIP, ip).
+			Return(&store.LoginThrottle{Scope: store.LoginScopeIP, Subject: ip, Failures: 5}, nil)
+		var lockedUntil time.Time
+		mockStore.On("LockLogin", mock.Anything, store.LoginScopeAccount, "alice", mock.AnythingOfType("time.Time"),
+			mock.MatchedBy(func(hash *string) bool { return hash != nil && len(*hash) == 64 })).
+			Run(func(args mock.Arguments) { lockedUntil = args.Get(3).(time.Time) }).
+			Return(nil)
+		expectLoginThrottle(mockStore)
+
+		_, _, err := service.Login(context.Background(), "alice", "wrongpassword", ip)
+		assert.Equal(t, ErrInvalidCredentials, err)
+		assert.WithinDuration(t, time.Now().Add(5*time.Minute), lockedUntil, time.Minute)
+		mockStore.AssertNotCalled(t, "LockLogin", mock.Anything, store.LoginScopeIP, mock.Anything, mock.Anything, mock.Anything)
+
+		if assert.Len(t, events.events, 1) {
+			event := events.events[0]
+			assert.Equal(t, SecurityEventLoginLocked, event.Type)
+			assert.Equal(t, "1", event.UserID)
+			assert.Equal(t, "alice", event.Username)
+			assert.Equal(t, ip, event.IP)
+			assert.Equal(t, store.LoginScopeAccount, event.Details["scope"])
+			assert.Equal(t, 5, event.Details["failures"])
+		}
+	})
+
+	t.Run("an outstanding unlock link is not replaced", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service, _ := newLockoutService(mockStore)
+
+		existing := "existing-hash"
+		mockStore.On("GetUserByUsername", mock.Anything, "alice").Return(alice(t), nil)
+		mockStore.On("RecordLoginFailure", mock.Anything, store.LoginScopeAccount, "alice").
+			Return(&store.LoginThrottle{Failures: 6, UnlockTokenHash: &existing}, nil)
+		mockStore.On("LockLogin", mock.Anything, store.LoginScopeAccount, "alice", mock.AnythingOfType("time.Time"), (*string)(nil)).Return(nil)
+		expectLoginThrottle(mockStore)
+
+		_, _, err := service.Login(context.Background(), "alice", "wrongpassword", ip)
+		assert.Equal(t, ErrInvalidCredentials, err)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("unknown usernames lock like real ones", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service, events := newLockoutService(mockStore)
+
+		mockStore.On("GetUserByUsername", mock.Anything, "mallory").Return(nil, store.ErrUserNotFound)
+		mockStore.On("RecordLoginFailure", mock.Anything, store.LoginScopeAccount, "mallory").
+			Return(&store.LoginThrottle{Failures: 5}, nil)
+		mockStore.On("LockLogin", mock.Anything, store.LoginScopeAccount, "mallory", mock.AnythingOfType("time.Time"), (*string)(nil)).Return(nil)
+		expectLoginThrottle(mockStore)
+
+		_, _, err := service.Login(context.Background(), "mallory", "password123", ip)
+		assert.Equal(t, ErrInvalidCredentials, err)
+		if assert.Len(t, events.events, 1) {
+			assert.Empty(t, events.events[0].UserID)
+			assert.Equal(t, "mallory", events.events[0].Username)
+		}
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("the client IP locks at its own threshold", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service, events := newLockoutService(mockStore)
+
+		mockStore.On("GetUserByUsername", mock.Anything, "bob").Return(nil, store.ErrUserNotFound)
+		mockStore.On("RecordLoginFailure", mock.Anything, store.LoginScopeIP, ip).Return(&store.LoginThrottle{Failures: 20}, nil)
+		mockStore.On("LockLogin", mock.Anything, store.LoginScopeIP, ip, mock.AnythingOfType("time.Time"), (*string)(nil)).Return(nil)
+		expectLoginThrottle(mockStore)
+
+		_, _, err := service.Login(context.Background(), "bob", "password123", ip)
+		assert.Equal(t, ErrInvalidCredentials, err)
+		if assert.Len(t, events.events, 1) {
+			assert.Equal(t, store.LoginScopeIP, events.events[0].Details["scope"])
+			assert.Empty(t, events.events[0].Username)
+		}
+		mockStore.AssertExpectations(t)
+	})
+}
+
+func TestAuthService_LockoutDuration(t *testing.T) {
+	service := &AuthService{Cfg: testConfig()}
+
+	tests := []struct {
+		excess   int
+		expected time.Duration
+	}{
+		{0, 5 * time.Minute},
+		{1, 10 * time.Minute},
+		{3, 40 * time.Minute},
+		{8, 1280 * time.Minute},
+		{9, 24 * time.Hour},
+		{1000, 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, service.lockoutDuration(tt.excess), "excess %d", tt.excess)
+	}
+}
+
+func TestAuthService_UnlockAccount(t *testing.T) {
+	const token = "unlock-token"
+
+	t.Run("clears the lockout", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service, events := newLockoutService(mockStore)
+
+		mockStore.On("GetLoginThrottleByUnlockHash", mock.Anything, hashToken(token)).
+			Return(&store.LoginThrottle{Scope: store.LoginScopeAccount, Subject: "alice"}, nil)
+		mockStore.On("ClearLoginFailures", mock.Anything, store.LoginScopeAccount, "alice").Return(nil)
+
+		assert.NoError(t, service.UnlockAccount(context.Background(), token))
+		if assert.Len(t, events.events, 1) {
+			assert.Equal(t, SecurityEventLoginUnlocked, events.events[0].Type)
+			assert.Equal(t, "email", events.events[0].Details["method"])
+		}
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("unknown link", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service, _ := newLockoutService(mockStore)
+
+		mockStore.On("GetLoginThrottleByUnlockHash", mock.Anything, hashToken(token)).Return(nil, store.ErrLoginThrottleNotFound)
+
+		assert.Equal(t, ErrInvalidUnlockToken, service.UnlockAccount(context.Background(), token))
+	})
+}
+
+func TestAuthService_UnlockUser(t *testing.T) {
+	t.Run("clears the lockout for the user's username", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service, events := newLockoutService(mockStore)
+
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "alice"}, nil)
+		mockStore.On("ClearLoginFailures", mock.Anything, store.LoginScopeAccount, "alice").Return(nil)
+
+		assert.NoError(t, service.UnlockUser(context.Background(), "1", "admin-1"))
+		if assert.Len(t, events.events, 1) {
+			assert.Equal(t, "1", events.events[0].UserID)
+			assert.Equal(t, "admin", events.events[0].Details["method"])
+			assert.Equal(t, "admin-1", events.events[0].Details["actor_id"])
+		}
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service, _ := newLockoutService(mockStore)
+
+		mockStore.On("GetUserByID", mock.Anything, "999").Return(nil, store.ErrUserNotFound)
+
+		assert.Equal(t, ErrUserNotFound, service.UnlockUser(context.Background(), "999", "admin-1"))
+	})
+}
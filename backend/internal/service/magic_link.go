@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/user/votex-template/backend/internal/store"
+)
+
+// RequestMagicLink emails a single-use sign-in link. Like
+// RequestPasswordReset it succeeds whether or not the address belongs to an
+// account. When MAGIC_LINK_BIND_BROWSER is set it returns a binding secret
+// the client has to present together with the link; the secret is returned
+// for unknown addresses too so the response gives nothing away.
+func (s *AuthService) RequestMagicLink(ctx context.Context, email string) (string, error) {
+	var binding string
+	if s.Cfg.MagicLinkBindBrowser {
+		binding = generateSecureToken()
+	}
+
+	user, err := s.Store.GetUserByEmail(ctx, email)
+	if err != nil || user.Email == nil {
+		return binding, nil
+	}
+
+	// Once verification is enforced only a proven address can sign in
+	if user.EmailVerifiedAt == nil && s.Cfg.EmailVerificationEnforced() {
+		return binding, nil
+	}
+
+	if err := s.Store.CleanupExpiredMagicLinkTokens(ctx); err != nil {
+		slog.Warn("Failed to clean up expired magic links", "error", err)
+	}
+
+	token := generateSecureToken()
+	link := &store.MagicLinkToken{
+		ID:        generateID(),
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		Email:     *user.Email,
+		ExpiresAt: time.Now().Add(time.Duration(s.Cfg.MagicLinkTokenExpiry) * time.Minute),
+		CreatedAt: time.Now(),
+	}
+	if binding != "" {
+		bindingHash := hashToken(binding)
+		link.BindingHash = &bindingHash
+	}
+	if err := s.Store.CreateMagicLinkToken(ctx, link); err != nil {
+		return "", err
+	}
+
+	// The email is only queued, so the response time does not reveal
+	// whether the address belongs to an account, and a failure is not
+	// reported for the same reason
+	if err := s.EmailService.SendMagicLinkEmail(ctx, link.Email, user.Username, token); err != nil {
+		slog.Error("Failed to send magic link email", "user_id", user.ID, "error", err)
+	}
+	return binding, nil
+}
+
+// LoginWithMagicLink signs in with the token from an emailed link. A bound
+// link also needs the binding secret returned when it was requested; a
+// wrong one leaves the link usable from the right browser. Accounts with
+// two-factor enabled get an MFARequiredError as with a password.
+func (s *AuthService) LoginWithMagicLink(ctx context.Context, token, binding string) (*AuthTokens, *User, error) {
+	link, err := s.Store.GetMagicLinkToken(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, store.ErrMagicLinkNotFound) {
+			return nil, nil, ErrInvalidMagicLink
+		}
+		return nil, nil, err
+	}
+	if link.Used || time.Now().After(link.ExpiresAt) {
+		return nil, nil, ErrInvalidMagicLink
+	}
+	if link.BindingHash != nil && subtle.ConstantTimeCompare([]byte(hashToken(binding)), []byte(*link.BindingHash)) != 1 {
+		slog.Info("Rejected magic link from another browser", "user_id", link.UserID)
+		return nil, nil, ErrMagicLinkWrongBrowser
+	}
+
+	if err := s.Store.MarkMagicLinkTokenUsed(ctx, link.ID); err != nil {
+		if errors.Is(err, store.ErrMagicLinkNotFound) {
+			return nil, nil, ErrInvalidMagicLink
+		}
+		return nil, nil, err
+	}
+
+	// The link only proves access to the address it was sent to
+	dbUser, err := s.Store.GetUserByID(ctx, link.UserID)
+	if err != nil || dbUser.Email == nil || *dbUser.Email != link.Email {
+		return nil, nil, ErrInvalidMagicLink
+	}
+
+	if err := s.requireVerifiedEmail(dbUser); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.mfaChallenge(ctx, dbUser.ID); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.createSession(ctx, dbUser.ID, dbUser.Username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, userFromStore(dbUser), nil
+}
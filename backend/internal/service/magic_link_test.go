@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/mail"
+)
+
+func TestAuthService_RequestMagicLink(t *testing.T) {
+	email := "alice@example.com"
+	alice := &store.User{ID: "1", Username: "alice", Email: &email}
+
+	t.Run("sends a link to a known address", func(t *testing.T) {
+		mockStore := new(MockStore)
+		cfg := testConfig()
+		service := &AuthService{Store: mockStore, Cfg: cfg, EmailService: NewEmailService(cfg, &mail.Memory{}), Keys: testKeyring()}
+
+		var created *store.MagicLinkToken
+		mockStore.On("GetUserByEmail", mock.Anything, email).Return(alice, nil)
+		mockStore.On("CleanupExpiredMagicLinkTokens", mock.Anything).Return(nil)
+		mockStore.On("CreateMagicLinkToken", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) { created = args.Get(1).(*store.MagicLinkToken) }).
+			Return(nil)
+
+		binding, err := service.RequestMagicLink(context.Background(), email)
+		assert.NoError(t, err)
+		assert.Empty(t, binding)
+		assert.Equal(t, "1", created.UserID)
+		assert.Equal(t, email, created.Email)
+		assert.Nil(t, created.BindingHash)
+		assert.WithinDuration(t, time.Now().Add(15*time.Minute), created.ExpiresAt, time.Minute)
+	})
+
+	t.Run("binds the link to the requesting browser", func(t *testing.T) {
+		mockStore := new(MockStore)
+		cfg := testConfig()
+		cfg.MagicLinkBindBrowser = true
+		service := &AuthService{Store: mockStore, Cfg: cfg, EmailService: NewEmailService(cfg, &mail.Memory{}), Keys: testKeyring()}
+
+		var created *store.MagicLinkToken
+		mockStore.On("GetUserByEmail", mock.Anything, email).Return(alice, nil)
+		mockStore.On("CleanupExpiredMagicLinkTokens", mock.Anything).Return(nil)
+		mockStore.On("CreateMagicLinkToken", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) { created = args.Get(1).(*store.MagicLinkToken) }).
+			Return(nil)
+
+		binding, err := service.RequestMagicLink(context.Background(), email)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, binding)
+		if assert.NotNil(t, created.BindingHash) {
+			assert.Equal(t, hashToken(binding), *created.BindingHash)
+		}
+	})
+
+	t.Run("an unknown address looks the same", func(t *testing.T) {
+		mockStore := new(MockStore)
+		cfg := testConfig()
+		cfg.MagicLinkBindBrowser = true
+		service := &AuthService{Store: mockStore, Cfg: cfg, Keys: testKeyring()}
+
+		mockStore.On("GetUserByEmail", mock.Anything, "nobody@example.com").Return(nil, store.ErrUserNotFound)
+
+		binding, err := service.RequestMagicLink(context.Background(), "nobody@example.com")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, binding)
+		mockStore.AssertNotCalled(t, "CreateMagicLinkToken", mock.Anything, mock.Anything)
+	})
+
+	t.Run("an unverified address gets no link while verification is enforced", func(t *testing.T) {
+		mockStore := new(MockStore)
+		cfg := testConfig()
+		cfg.EmailVerification = config.VerifyEmailSensitive
+		service := &AuthService{Store: mockStore, Cfg: cfg, Keys: testKeyring()}
+
+		mockStore.On("GetUserByEmail", mock.Anything, email).Return(alice, nil)
+
+		_, err := service.RequestMagicLink(context.Background(), email)
+		assert.NoError(t, err)
+		mockStore.AssertNotCalled(t, "CreateMagicLinkToken", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthService_LoginWithMagicLink(t *testing.T) {
+	const token = "magic-token"
+	const binding = "binding-secret"
+	email := "alice@example.com"
+
+	valid := func() *store.MagicLinkToken {
+		return &store.MagicLinkToken{
+			ID:        "link-1",
+			UserID:    "1",
+			TokenHash: hashToken(token),
+			Email:     email,
+			ExpiresAt: time.Now().Add(15 * time.Minute),
+			CreatedAt: time.Now(),
+		}
+	}
+	bound := func() *store.MagicLinkToken {
+		link := valid()
+		bindingHash := hashToken(binding)
+		link.BindingHash = &bindingHash
+		return link
+	}
+	signIn := func(mockStore *MockStore, userEmail string) {
+		mockStore.On("MarkMagicLinkTokenUsed", mock.Anything, "link-1").Return(nil)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "alice", Email: &userEmail}, nil)
+	}
+
+	tests := []struct {
+		name          string
+		binding       string
+		setupMock     func(*MockStore)
+		expectedError error
+	}{
+		{
+			name: "signs in",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetMagicLinkToken", mock.Anything, hashToken(token)).Return(valid(), nil)
+				signIn(mockStore, email)
+				mockStore.On("GetUserMFA", mock.Anything, "1").Return(nil, store.ErrMFANotFound)
+				mockStore.On("CreateSession", mock.Anything, mock.Anything, "1", mock.Anything, mock.Anything).Return(nil)
+				expectTokenIssue(mockStore, "1")
+			},
+		},
+		{
+			name:    "bound link from the same browser",
+			binding: binding,
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetMagicLinkToken", mock.Anything, hashToken(token)).Return(bound(), nil)
+				signIn(mockStore, email)
+				mockStore.On("GetUserMFA", mock.Anything, "1").Return(nil, store.ErrMFANotFound)
+				mockStore.On("CreateSession", mock.Anything, mock.Anything, "1", mock.Anything, mock.Anything).Return(nil)
+				expectTokenIssue(mockStore, "1")
+			},
+		},
+		{
+			name:    "bound link from another browser",
+			binding: "other-secret",
+			setupMock: func(mockStore *MockStore) {
+				// The link is not used up so the right browser can still open it
+				mockStore.On("GetMagicLinkToken", mock.Anything, hashToken(token)).Return(bound(), nil)
+			},
+			expectedError: ErrMagicLinkWrongBrowser,
+		},
+		{
+			name: "bound link without a binding",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetMagicLinkToken", mock.Anything, hashToken(token)).Return(bound(), nil)
+			},
+			expectedError: ErrMagicLinkWrongBrowser,
+		},
+		{
+			name: "unknown link",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetMagicLinkToken", mock.Anything, hashToken(token)).Return(nil, store.ErrMagicLinkNotFound)
+			},
+			expectedError: ErrInvalidMagicLink,
+		},
+		{
+			name: "expired link",
+			setupMock: func(mockStore *MockStore) {
+				expired := valid()
+				expired.ExpiresAt = time.Now().Add(-time.Second)
+				mockStore.On("GetMagicLinkToken", mock.Anything, hashToken(token)).Return(expired, nil)
+			},
+			expectedError: ErrInvalidMagicLink,
+		},
+		{
+			name: "link used by a concurrent request",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetMagicLinkToken", mock.Anything, hashToken(token)).Return(valid(), nil)
+				mockStore.On("MarkMagicLinkTokenUsed", mock.Anything, "link-1").Return(store.ErrMagicLinkNotFound)
+			},
+			expectedError: ErrInvalidMagicLink,
+		},
+		{
+			name: "email changed since the link was sent",
+			setupMock: func(mockStore *MockStore) {
+				mockStore.On("GetMagicLinkToken", mock.Anything, hashToken(token)).Return(valid(), nil)
+				signIn(mockStore, "new@example.com")
+			},
+			expectedError: ErrInvalidMagicLink,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := new(MockStore)
+			tt.setupMock(mockStore)
+			service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+
+			tokens, user, err := service.LoginWithMagicLink(context.Background(), token, tt.binding)
+			assert.Equal(t, tt.expectedError, err)
+			if tt.expectedError == nil {
+				assert.NotNil(t, tokens)
+				assert.Equal(t, "alice", user.Username)
+			}
+			mockStore.AssertExpectations(t)
+		})
+	}
+
+	t.Run("two-factor accounts get a challenge", func(t *testing.T) {
+		mockStore := new(MockStore)
+		mockStore.On("GetMagicLinkToken", mock.Anything, hashToken(token)).Return(valid(), nil)
+		signIn(mockStore, email)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(enabledMFA("1"), nil)
+		expectMFAChallenge(mockStore)
+		service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+
+		_, _, err := service.LoginWithMagicLink(context.Background(), token, "")
+		var mfaErr *MFARequiredError
+		assert.True(t, errors.As(err, &mfaErr), "expected an MFA challenge, got %v", err)
+		mockStore.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/totp"
+)
+
+const (
+	// recoveryCodeCount is how many recovery codes are issued at a time
+	recoveryCodeCount = 10
+	// mfaSkew is how many 30 second steps of clock drift are tolerated
+	mfaSkew = 1
+)
+
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// MFAEnrollment carries the secret for a pending TOTP enrolment. URI is the
+// otpauth:// link clients render as a QR code.
+type MFAEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// MFARequiredError is returned by Login when the password was correct but the
+// account has two-factor authentication enabled. Token is exchanged together
+// with a code through VerifyMFA. It matches ErrMFARequired with errors.Is.
+type MFARequiredError struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+func (e *MFARequiredError) Error() string {
+	return ErrMFARequired.Error()
+}
+
+func (e *MFARequiredError) Is(target error) bool {
+	return target == ErrMFARequired
+}
+
+// VerifyMFA completes a login started with a password by checking a TOTP or
+// recovery code against the intermediate token returned by Login. A token
+// takes MFA_MAX_ATTEMPTS codes, and wrong codes count toward the account
+// lockout, so fresh logins do not buy more guesses.
+func (s *AuthService) VerifyMFA(ctx context.Context, mfaToken, code, ip string) (*AuthTokens, *User, error) {
+	challenge, err := s.Store.GetMFAChallenge(ctx, hashToken(mfaToken))
+	if err != nil {
+		if errors.Is(err, store.ErrMFAChallengeNotFound) {
+			return nil, nil, ErrInvalidMFAToken
+		}
+		return nil, nil, err
+	}
+	if time.Now().After(challenge.ExpiresAt) {
+		return nil, nil, ErrInvalidMFAToken
+	}
+
+	dbUser, err := s.Store.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidMFAToken
+	}
+
+	if err := s.checkLoginLockout(ctx, dbUser.Username, ip); err != nil {
+		return nil, nil, err
+	}
+	if err := s.Store.UseMFAChallengeAttempt(ctx, challenge.ID, s.Cfg.MFAMaxAttempts); err != nil {
+		if errors.Is(err, store.ErrMFAChallengeNotFound) {
+			return nil, nil, ErrInvalidMFAToken
+		}
+		return nil, nil, err
+	}
+
+	mfa, err := s.enabledMFA(ctx, dbUser.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.verifyMFACode(ctx, s.Store, mfa, code, true); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.recordLoginFailure(ctx, dbUser.Username, ip, dbUser)
+		}
+		return nil, nil, err
+	}
+	s.clearLoginFailures(ctx, dbUser.Username)
+
+	// Each challenge completes one login
+	if err := s.Store.DeleteMFAChallenge(ctx, challenge.ID); err != nil {
+		if errors.Is(err, store.ErrMFAChallengeNotFound) {
+			return nil, nil, ErrInvalidMFAToken
+		}
+		return nil, nil, err
+	}
+
+	tokens, err := s.createSession(ctx, dbUser.ID, dbUser.Username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, userFromStore(dbUser), nil
+}
+
+// EnrollMFA generates a new TOTP secret for the user. Two-factor stays
+// disabled until ConfirmMFA is called with a code from the new secret.
+func (s *AuthService) EnrollMFA(ctx context.Context, userID string) (*MFAEnrollment, error) {
+	dbUser, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	existing, err := s.Store.GetUserMFA(ctx, userID)
+	if err != nil && !errors.Is(err, store.ErrMFANotFound) {
+		return nil, err
+	}
+	if existing != nil && existing.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Store.SaveMFASecret(ctx, userID, secret); err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.Cfg.MFAIssuer, dbUser.Username, secret),
+	}, nil
+}
+
+// ConfirmMFA enables two-factor authentication once the user proves their
+// authenticator produces valid codes, and returns a fresh set of recovery codes.
+func (s *AuthService) ConfirmMFA(ctx context.Context, userID, code string) ([]string, error) {
+	mfa, err := s.Store.GetUserMFA(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrMFANotFound) {
+			return nil, ErrMFANotEnabled
+		}
+		return nil, err
+	}
+	if mfa.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	var codes []string
+	err = s.Store.WithTx(ctx, func(tx store.StoreInterface) error {
+		if err := s.verifyMFACode(ctx, tx, mfa, code, false); err != nil {
+			return err
+		}
+		if err := tx.EnableMFA(ctx, userID); err != nil {
+			return err
+		}
+		codes, err = s.replaceRecoveryCodes(ctx, tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableMFA turns two-factor authentication off after checking a current
+// TOTP or recovery code, and discards the secret and recovery codes.
+func (s *AuthService) DisableMFA(ctx context.Context, userID, code, ip string) error {
+	return s.changeMFA(ctx, userID, code, ip, func(tx store.StoreInterface) error {
+		return tx.DeleteUserMFA(ctx, userID)
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code, used or not, after
+// checking a current TOTP or recovery code.
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID, code, ip string) ([]string, error) {
+	var codes []string
+	err := s.changeMFA(ctx, userID, code, ip, func(tx store.StoreInterface) error {
+		var err error
+		codes, err = s.replaceRecoveryCodes(ctx, tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// changeMFA applies change to a confirmed enrolment once code checks out.
+// Wrong codes count toward the account lockout as they do at login, so a
+// stolen session cannot keep guessing until it can turn two-factor off.
+func (s *AuthService) changeMFA(ctx context.Context, userID, code, ip string, change func(tx store.StoreInterface) error) error {
+	dbUser, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if err := s.checkLoginLockout(ctx, dbUser.Username, ip); err != nil {
+		return err
+	}
+
+	mfa, err := s.enabledMFA(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.Store.WithTx(ctx, func(tx store.StoreInterface) error {
+		if err := s.verifyMFACode(ctx, tx, mfa, code, true); err != nil {
+			return err
+		}
+		return change(tx)
+	})
+	switch {
+	case errors.Is(err, ErrInvalidMFACode):
+		// Recorded outside the transaction so the count survives its rollback
+		s.recordLoginFailure(ctx, dbUser.Username, ip, dbUser)
+	case err == nil:
+		s.clearLoginFailures(ctx, dbUser.Username)
+	}
+	return err
+}
+
+// enabledMFA returns the user's confirmed enrolment or ErrMFANotEnabled
+func (s *AuthService) enabledMFA(ctx context.Context, userID string) (*store.UserMFA, error) {
+	mfa, err := s.Store.GetUserMFA(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrMFANotFound) {
+			return nil, ErrMFANotEnabled
+		}
+		return nil, err
+	}
+	if mfa.EnabledAt == nil {
+		return nil, ErrMFANotEnabled
+	}
+	return mfa, nil
+}
+
+// mfaChallenge returns an MFARequiredError when the user has two-factor
+// enabled, nil when they do not, or the lookup error.
+func (s *AuthService) mfaChallenge(ctx context.Context, userID string) error {
+	if _, err := s.enabledMFA(ctx, userID); err != nil {
+		if errors.Is(err, ErrMFANotEnabled) {
+			return nil
+		}
+		return err
+	}
+
+	if err := s.Store.CleanupExpiredMFAChallenges(ctx); err != nil {
+		slog.Warn("Failed to clean up expired two-factor challenges", "error", err)
+	}
+
+	// The token is opaque and only its digest is stored, so it cannot be
+	// forged and is never mistaken for an access token
+	token := generateSecureToken()
+	challenge := &store.MFAChallenge{
+		ID:        generateID(),
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(time.Duration(s.Cfg.MFATokenExpiry) * time.Minute),
+		CreatedAt: time.Now(),
+	}
+	if err := s.Store.CreateMFAChallenge(ctx, challenge); err != nil {
+		return err
+	}
+	return &MFARequiredError{Token: token, ExpiresAt: challenge.ExpiresAt}
+}
+
+// verifyMFACode accepts a six digit TOTP code, or a recovery code when
+// allowRecovery is set. Each TOTP step and each recovery code works once.
+func (s *AuthService) verifyMFACode(ctx context.Context, st store.StoreInterface, mfa *store.UserMFA, code string, allowRecovery bool) error {
+	code = normalizeMFACode(code)
+
+	if len(code) == totp.Digits && isDigits(code) {
+		step, ok := totp.Validate(mfa.Secret, code, time.Now(), mfaSkew)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		if err := st.UseMFAStep(ctx, mfa.UserID, step); err != nil {
+			if errors.Is(err, store.ErrMFAStepUsed) {
+				return ErrInvalidMFACode
+			}
+			return err
+		}
+		return nil
+	}
+
+	if !allowRecovery || code == "" {
+		return ErrInvalidMFACode
+	}
+	if err := st.UseRecoveryCode(ctx, mfa.UserID, hashToken(code)); err != nil {
+		if errors.Is(err, store.ErrRecoveryCodeNotFound) {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+	return nil
+}
+
+// replaceRecoveryCodes discards the user's recovery codes and stores hashes
+// of a new set, returning the plaintext codes to show once
+func (s *AuthService) replaceRecoveryCodes(ctx context.Context, tx store.StoreInterface, userID string) ([]string, error) {
+	if err := tx.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.CreateRecoveryCode(ctx, generateID(), userID, hashToken(normalizeMFACode(code))); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a random code formatted as xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	raw := make([]byte, 7)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := recoveryCodeEncoding.EncodeToString(raw)[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeMFACode strips the separators users tend to type along with a code
+func normalizeMFACode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,385 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/mail"
+	"github.com/user/votex-template/backend/pkg/totp"
+)
+
+const testMFASecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+func enabledMFA(userID string) *store.UserMFA {
+	enabledAt := time.Now().Add(-time.Hour)
+	return &store.UserMFA{UserID: userID, Secret: testMFASecret, EnabledAt: &enabledAt}
+}
+
+func currentCode(t *testing.T) string {
+	t.Helper()
+	code, err := totp.Code(testMFASecret, time.Now())
+	if err != nil {
+		t.Fatalf("failed to generate code: %v", err)
+	}
+	return code
+}
+
+func newMFAService(mockStore *MockStore) *AuthService {
+	cfg := testConfig()
+	cfg.MFAIssuer = "Votex"
+	cfg.MFATokenExpiry = 5
+	cfg.MFAMaxAttempts = 3
+	return &AuthService{Store: mockStore, Cfg: cfg, EmailService: NewEmailService(cfg, &mail.Memory{}), Keys: testKeyring()}
+}
+
+// expectMFAChallenge lets a login store a two-factor challenge
+func expectMFAChallenge(mockStore *MockStore) {
+	mockStore.On("CleanupExpiredMFAChallenges", mock.Anything).Return(nil)
+	mockStore.On("CreateMFAChallenge", mock.Anything, mock.AnythingOfType("*store.MFAChallenge")).Return(nil)
+}
+
+// loginForChallenge runs a password login against an MFA-enabled account and
+// returns the intermediate token
+func loginForChallenge(t *testing.T, service *AuthService, mockStore *MockStore) string {
+	t.Helper()
+	user := &store.User{ID: "1", Username: "testuser", PasswordHash: mustHash(t, "password123")}
+	mockStore.On("GetUserByUsername", mock.Anything, "testuser").Return(user, nil)
+	mockStore.On("GetUserByID", mock.Anything, "1").Return(user, nil)
+	mockStore.On("GetUserMFA", mock.Anything, "1").Return(enabledMFA("1"), nil)
+	expectLoginThrottle(mockStore)
+	expectMFAChallenge(mockStore)
+
+	tokens, _, err := service.Login(context.Background(), "testuser", "password123", "192.0.2.1")
+	assert.Nil(t, tokens)
+
+	var mfaErr *MFARequiredError
+	if !errors.As(err, &mfaErr) {
+		t.Fatalf("expected MFARequiredError, got %v", err)
+	}
+	assert.ErrorIs(t, err, ErrMFARequired)
+
+	challenge := &store.MFAChallenge{ID: "challenge-1", UserID: "1", TokenHash: hashToken(mfaErr.Token), ExpiresAt: mfaErr.ExpiresAt}
+	mockStore.On("GetMFAChallenge", mock.Anything, hashToken(mfaErr.Token)).Return(challenge, nil)
+	mockStore.On("UseMFAChallengeAttempt", mock.Anything, "challenge-1", 3).Return(nil)
+	return mfaErr.Token
+}
+
+func TestAuthService_LoginWithMFA(t *testing.T) {
+	t.Run("totp code completes login", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		token := loginForChallenge(t, service, mockStore)
+
+		mockStore.On("UseMFAStep", mock.Anything, "1", mock.AnythingOfType("int64")).Return(nil)
+		mockStore.On("DeleteMFAChallenge", mock.Anything, "challenge-1").Return(nil)
+		mockStore.On("CreateSession", mock.Anything, mock.AnythingOfType("string"), "1", mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
+		expectTokenIssue(mockStore, "1")
+
+		tokens, user, err := service.VerifyMFA(context.Background(), token, currentCode(t), "192.0.2.1")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.Equal(t, "1", user.ID)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("replayed totp code is rejected", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		token := loginForChallenge(t, service, mockStore)
+
+		mockStore.On("UseMFAStep", mock.Anything, "1", mock.Anything).Return(store.ErrMFAStepUsed)
+
+		_, _, err := service.VerifyMFA(context.Background(), token, currentCode(t), "192.0.2.1")
+		assert.Equal(t, ErrInvalidMFACode, err)
+		mockStore.AssertNotCalled(t, "CreateSession")
+	})
+
+	t.Run("recovery code completes login", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		token := loginForChallenge(t, service, mockStore)
+
+		mockStore.On("UseRecoveryCode", mock.Anything, "1", hashToken("abcdefghij")).Return(nil)
+		mockStore.On("DeleteMFAChallenge", mock.Anything, "challenge-1").Return(nil)
+		mockStore.On("CreateSession", mock.Anything, mock.AnythingOfType("string"), "1", mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
+		expectTokenIssue(mockStore, "1")
+
+		_, _, err := service.VerifyMFA(context.Background(), token, "ABCDE-FGHIJ", "192.0.2.1")
+		assert.NoError(t, err)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("wrong code is rejected", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		token := loginForChallenge(t, service, mockStore)
+
+		mockStore.On("UseRecoveryCode", mock.Anything, "1", mock.Anything).Return(store.ErrRecoveryCodeNotFound)
+
+		_, _, err := service.VerifyMFA(context.Background(), token, "not-a-code", "192.0.2.1")
+		assert.Equal(t, ErrInvalidMFACode, err)
+
+		// Wrong codes count toward the lockout like wrong passwords
+		mockStore.AssertCalled(t, "RecordLoginFailure", mock.Anything, store.LoginScopeAccount, "testuser")
+		mockStore.AssertCalled(t, "RecordLoginFailure", mock.Anything, store.LoginScopeIP, "192.0.2.1")
+	})
+
+	t.Run("challenge is void after too many codes", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		user := &store.User{ID: "1", Username: "testuser"}
+		challenge := &store.MFAChallenge{ID: "challenge-1", UserID: "1", TokenHash: hashToken("token"), Attempts: 3, ExpiresAt: time.Now().Add(time.Minute)}
+		mockStore.On("GetMFAChallenge", mock.Anything, hashToken("token")).Return(challenge, nil)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(user, nil)
+		expectLoginThrottle(mockStore)
+		mockStore.On("UseMFAChallengeAttempt", mock.Anything, "challenge-1", 3).Return(store.ErrMFAChallengeNotFound)
+
+		_, _, err := service.VerifyMFA(context.Background(), "token", currentCode(t), "192.0.2.1")
+		assert.Equal(t, ErrInvalidMFAToken, err)
+		mockStore.AssertNotCalled(t, "UseMFAStep", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("locked account cannot try codes", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		user := &store.User{ID: "1", Username: "testuser"}
+		challenge := &store.MFAChallenge{ID: "challenge-1", UserID: "1", TokenHash: hashToken("token"), ExpiresAt: time.Now().Add(time.Minute)}
+		lockedUntil := time.Now().Add(time.Hour)
+		mockStore.On("GetMFAChallenge", mock.Anything, hashToken("token")).Return(challenge, nil)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(user, nil)
+		mockStore.On("GetLoginThrottle", mock.Anything, store.LoginScopeAccount, "testuser").Return(&store.LoginThrottle{LockedUntil: &lockedUntil}, nil)
+		mockStore.On("GetLoginThrottle", mock.Anything, store.LoginScopeIP, "192.0.2.1").Return(nil, store.ErrLoginThrottleNotFound)
+
+		_, _, err := service.VerifyMFA(context.Background(), "token", currentCode(t), "192.0.2.1")
+		assert.ErrorIs(t, err, ErrLoginLocked)
+		mockStore.AssertNotCalled(t, "UseMFAChallengeAttempt", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("challenge completes one login", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		token := loginForChallenge(t, service, mockStore)
+
+		// Another request with the same token consumed the challenge first
+		mockStore.On("UseRecoveryCode", mock.Anything, "1", hashToken("abcdefghij")).Return(nil)
+		mockStore.On("DeleteMFAChallenge", mock.Anything, "challenge-1").Return(store.ErrMFAChallengeNotFound)
+
+		_, _, err := service.VerifyMFA(context.Background(), token, "ABCDE-FGHIJ", "192.0.2.1")
+		assert.Equal(t, ErrInvalidMFAToken, err)
+		mockStore.AssertNotCalled(t, "CreateSession")
+	})
+
+	t.Run("expired challenge is rejected", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		challenge := &store.MFAChallenge{ID: "challenge-1", UserID: "1", TokenHash: hashToken("token"), ExpiresAt: time.Now().Add(-time.Second)}
+		mockStore.On("GetMFAChallenge", mock.Anything, hashToken("token")).Return(challenge, nil)
+
+		_, _, err := service.VerifyMFA(context.Background(), "token", currentCode(t), "192.0.2.1")
+		assert.Equal(t, ErrInvalidMFAToken, err)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("access token is not an mfa token", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+
+		accessToken, err := service.generateToken("session", "1", "testuser", nil, nil, time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		mockStore.On("GetMFAChallenge", mock.Anything, hashToken(accessToken)).Return(nil, store.ErrMFAChallengeNotFound)
+
+		_, _, err = service.VerifyMFA(context.Background(), accessToken, "123456", "192.0.2.1")
+		assert.Equal(t, ErrInvalidMFAToken, err)
+	})
+
+	t.Run("lookup failure does not skip the second factor", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		user := &store.User{ID: "1", Username: "testuser", PasswordHash: mustHash(t, "password123")}
+		mockStore.On("GetUserByUsername", mock.Anything, "testuser").Return(user, nil)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(nil, assert.AnError)
+		expectLoginThrottle(mockStore)
+
+		tokens, _, err := service.Login(context.Background(), "testuser", "password123", "192.0.2.1")
+		assert.Nil(t, tokens)
+		assert.ErrorIs(t, err, assert.AnError)
+		mockStore.AssertNotCalled(t, "CreateSession")
+	})
+}
+
+func TestAuthService_EnrollMFA(t *testing.T) {
+	t.Run("starts pending enrolment", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "testuser"}, nil)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(nil, store.ErrMFANotFound)
+		mockStore.On("SaveMFASecret", mock.Anything, "1", mock.AnythingOfType("string")).Return(nil)
+
+		enrollment, err := service.EnrollMFA(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, enrollment.Secret)
+		assert.Contains(t, enrollment.URI, "otpauth://totp/Votex:testuser?")
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("already enabled", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "testuser"}, nil)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(enabledMFA("1"), nil)
+
+		_, err := service.EnrollMFA(context.Background(), "1")
+		assert.Equal(t, ErrMFAAlreadyEnabled, err)
+	})
+}
+
+func TestAuthService_ConfirmMFA(t *testing.T) {
+	t.Run("enables and issues recovery codes", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(&store.UserMFA{UserID: "1", Secret: testMFASecret}, nil)
+		mockStore.On("UseMFAStep", mock.Anything, "1", mock.Anything).Return(nil)
+		mockStore.On("EnableMFA", mock.Anything, "1").Return(nil)
+		mockStore.On("DeleteRecoveryCodes", mock.Anything, "1").Return(nil)
+		mockStore.On("CreateRecoveryCode", mock.Anything, mock.AnythingOfType("string"), "1", mock.AnythingOfType("string")).Return(nil)
+
+		codes, err := service.ConfirmMFA(context.Background(), "1", currentCode(t))
+		assert.NoError(t, err)
+		assert.Len(t, codes, recoveryCodeCount)
+		assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+		mockStore.AssertNumberOfCalls(t, "CreateRecoveryCode", recoveryCodeCount)
+	})
+
+	t.Run("recovery codes cannot confirm enrolment", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(&store.UserMFA{UserID: "1", Secret: testMFASecret}, nil)
+
+		_, err := service.ConfirmMFA(context.Background(), "1", "abcde-fghij")
+		assert.Equal(t, ErrInvalidMFACode, err)
+		mockStore.AssertNotCalled(t, "EnableMFA")
+	})
+
+	t.Run("no pending enrolment", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(nil, store.ErrMFANotFound)
+
+		_, err := service.ConfirmMFA(context.Background(), "1", "123456")
+		assert.Equal(t, ErrMFANotEnabled, err)
+	})
+}
+
+func TestAuthService_DisableMFA(t *testing.T) {
+	user := &store.User{ID: "1", Username: "testuser"}
+
+	t.Run("current code disables two-factor", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(user, nil)
+		expectLoginThrottle(mockStore)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(enabledMFA("1"), nil)
+		mockStore.On("UseMFAStep", mock.Anything, "1", mock.Anything).Return(nil)
+		mockStore.On("DeleteUserMFA", mock.Anything, "1").Return(nil)
+
+		assert.NoError(t, service.DisableMFA(context.Background(), "1", currentCode(t), "192.0.2.1"))
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("wrong code counts toward the lockout", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(user, nil)
+		expectLoginThrottle(mockStore)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(enabledMFA("1"), nil)
+		mockStore.On("UseRecoveryCode", mock.Anything, "1", mock.Anything).Return(store.ErrRecoveryCodeNotFound)
+
+		err := service.DisableMFA(context.Background(), "1", "not-a-code", "192.0.2.1")
+		assert.Equal(t, ErrInvalidMFACode, err)
+		mockStore.AssertCalled(t, "RecordLoginFailure", mock.Anything, store.LoginScopeAccount, "testuser")
+		mockStore.AssertCalled(t, "RecordLoginFailure", mock.Anything, store.LoginScopeIP, "192.0.2.1")
+		mockStore.AssertNotCalled(t, "DeleteUserMFA", mock.Anything, mock.Anything)
+	})
+
+	t.Run("guesses stop at the lockout threshold", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		threshold := service.Cfg.LockoutThreshold
+		lockedUntil := time.Now().Add(time.Hour)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(user, nil)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(enabledMFA("1"), nil)
+		mockStore.On("UseRecoveryCode", mock.Anything, "1", mock.Anything).Return(store.ErrRecoveryCodeNotFound)
+		mockStore.On("DeleteStaleLoginThrottles", mock.Anything, mock.Anything).Return(nil)
+		mockStore.On("GetLoginThrottle", mock.Anything, store.LoginScopeIP, "192.0.2.1").Return(nil, store.ErrLoginThrottleNotFound)
+		mockStore.On("RecordLoginFailure", mock.Anything, store.LoginScopeIP, "192.0.2.1").Return(&store.LoginThrottle{Failures: 1}, nil)
+		mockStore.On("GetLoginThrottle", mock.Anything, store.LoginScopeAccount, "testuser").Return(nil, store.ErrLoginThrottleNotFound).Times(threshold)
+		mockStore.On("GetLoginThrottle", mock.Anything, store.LoginScopeAccount, "testuser").Return(&store.LoginThrottle{LockedUntil: &lockedUntil}, nil)
+		for failures := 1; failures <= threshold; failures++ {
+			mockStore.On("RecordLoginFailure", mock.Anything, store.LoginScopeAccount, "testuser").Return(&store.LoginThrottle{Failures: failures}, nil).Once()
+		}
+		mockStore.On("LockLogin", mock.Anything, store.LoginScopeAccount, "testuser", mock.AnythingOfType("time.Time"), (*string)(nil)).Return(nil).Once()
+
+		for i := 0; i < threshold; i++ {
+			assert.Equal(t, ErrInvalidMFACode, service.DisableMFA(context.Background(), "1", "not-a-code", "192.0.2.1"))
+		}
+
+		// Once locked, even the right code is not checked
+		err := service.DisableMFA(context.Background(), "1", currentCode(t), "192.0.2.1")
+		assert.ErrorIs(t, err, ErrLoginLocked)
+		mockStore.AssertNumberOfCalls(t, "UseRecoveryCode", threshold)
+		mockStore.AssertNotCalled(t, "UseMFAStep", mock.Anything, mock.Anything, mock.Anything)
+		mockStore.AssertNotCalled(t, "DeleteUserMFA", mock.Anything, mock.Anything)
+		mockStore.AssertExpectations(t)
+	})
+}
+
+func TestAuthService_RegenerateRecoveryCodes(t *testing.T) {
+	user := &store.User{ID: "1", Username: "testuser"}
+
+	t.Run("current code replaces the codes", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(user, nil)
+		expectLoginThrottle(mockStore)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(enabledMFA("1"), nil)
+		mockStore.On("UseMFAStep", mock.Anything, "1", mock.Anything).Return(nil)
+		mockStore.On("DeleteRecoveryCodes", mock.Anything, "1").Return(nil)
+		mockStore.On("CreateRecoveryCode", mock.Anything, mock.AnythingOfType("string"), "1", mock.AnythingOfType("string")).Return(nil)
+
+		codes, err := service.RegenerateRecoveryCodes(context.Background(), "1", currentCode(t), "192.0.2.1")
+		assert.NoError(t, err)
+		assert.Len(t, codes, recoveryCodeCount)
+	})
+
+	t.Run("wrong code counts toward the lockout", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(user, nil)
+		expectLoginThrottle(mockStore)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(enabledMFA("1"), nil)
+		mockStore.On("UseRecoveryCode", mock.Anything, "1", mock.Anything).Return(store.ErrRecoveryCodeNotFound)
+
+		_, err := service.RegenerateRecoveryCodes(context.Background(), "1", "not-a-code", "192.0.2.1")
+		assert.Equal(t, ErrInvalidMFACode, err)
+		mockStore.AssertCalled(t, "RecordLoginFailure", mock.Anything, store.LoginScopeAccount, "testuser")
+		mockStore.AssertNotCalled(t, "DeleteRecoveryCodes", mock.Anything, mock.Anything)
+	})
+
+	t.Run("locked account cannot try codes", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newMFAService(mockStore)
+		lockedUntil := time.Now().Add(time.Hour)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(user, nil)
+		mockStore.On("GetLoginThrottle", mock.Anything, store.LoginScopeAccount, "testuser").Return(&store.LoginThrottle{LockedUntil: &lockedUntil}, nil)
+		mockStore.On("GetLoginThrottle", mock.Anything, store.LoginScopeIP, "192.0.2.1").Return(nil, store.ErrLoginThrottleNotFound)
+
+		_, err := service.RegenerateRecoveryCodes(context.Background(), "1", currentCode(t), "192.0.2.1")
+		assert.ErrorIs(t, err, ErrLoginLocked)
+		mockStore.AssertNotCalled(t, "GetUserMFA", mock.Anything, mock.Anything)
+	})
+}
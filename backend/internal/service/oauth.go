@@ -0,0 +1,624 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/keys"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/oidc"
+)
+
+const (
+	// oauthCodeExpiry is how long a client has to redeem an authorization code
+	oauthCodeExpiry = time.Minute
+
+	scopeOpenID  = "openid"
+	scopeProfile = "profile"
+	scopeEmail   = "email"
+
+	// accessTokenType is the typ header of access tokens (RFC 9068), which
+	// keeps ID tokens from being accepted in their place
+	accessTokenType = "at+jwt"
+)
+
+// oauthScopes are the scopes clients may request
+var oauthScopes = []string{scopeOpenID, scopeProfile, scopeEmail}
+
+// OAuthError is an OAuth 2.0 error response (RFC 6749 sections 4.1.2.1 and
+// 5.2). RedirectURL is set when the authorization request was valid enough
+// to report the error back to the client instead of showing it to the user.
+type OAuthError struct {
+	Code        string
+	Description string
+	RedirectURL string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// OAuthClient is an application registered with the identity provider.
+// Secret is only set in the response to registering a confidential client.
+type OAuthClient struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	RedirectURIs []string   `json:"redirect_uris"`
+	Public       bool       `json:"public"`
+	Secret       string     `json:"secret,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+}
+
+// Consent is a client the user has allowed to sign them in
+type Consent struct {
+	ClientID   string     `json:"client_id"`
+	ClientName string     `json:"client_name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// AuthorizationRequest holds the parameters a client sent to the
+// authorization endpoint, relayed by the frontend consent page
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+}
+
+// AuthorizationPrompt is what the consent page shows the user
+type AuthorizationPrompt struct {
+	ClientID        string   `json:"client_id"`
+	ClientName      string   `json:"client_name"`
+	Scopes          []string `json:"scopes"`
+	ConsentRequired bool     `json:"consent_required"`
+}
+
+// TokenRequest holds the parameters posted to the token endpoint
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientID     string
+	ClientSecret string
+	CodeVerifier string
+}
+
+// OAuthTokens is a successful token endpoint response
+type OAuthTokens struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+// OAuthServiceInterface lets Votex act as an OpenID Connect provider for
+// sibling services, using the authorization code flow with PKCE
+type OAuthServiceInterface interface {
+	Discovery() *oidc.Metadata
+	RegisterClient(ctx context.Context, createdBy, name string, redirectURIs []string, public bool) (*OAuthClient, error)
+	ListClients(ctx context.Context) ([]OAuthClient, error)
+	DeleteClient(ctx context.Context, id string) error
+	Authorize(ctx context.Context, userID string, req *AuthorizationRequest) (*AuthorizationPrompt, error)
+	Approve(ctx context.Context, userID string, req *AuthorizationRequest, approved bool) (string, error)
+	Token(ctx context.Context, req *TokenRequest) (*OAuthTokens, error)
+	UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error)
+	ListConsents(ctx context.Context, userID string) ([]Consent, error)
+	RevokeConsent(ctx context.Context, userID, clientID string) error
+}
+
+// OAuthService issues ID and access tokens to registered clients for users
+// signed in to Votex. Users are looked up through Auth, so tokens are only
+// issued for accounts the auth service still recognises. Tokens are signed
+// with the same keys as Votex's own access tokens and published in the same
+// JWKS.
+type OAuthService struct {
+	Store store.StoreInterface
+	Cfg   *config.Config
+	Auth  AuthServiceInterface
+	Keys  *keys.Keyring
+}
+
+func NewOAuthService(s store.StoreInterface, cfg *config.Config, auth AuthServiceInterface, keyring *keys.Keyring) OAuthServiceInterface {
+	return &OAuthService{
+		Store: s,
+		Cfg:   cfg,
+		Auth:  auth,
+		Keys:  keyring,
+	}
+}
+
+// Discovery returns the provider's /.well-known/openid-configuration document
+func (s *OAuthService) Discovery() *oidc.Metadata {
+	return &oidc.Metadata{
+		Issuer:                            s.Cfg.IDPIssuer,
+		AuthorizationEndpoint:             s.Cfg.IDPAuthorizeURL,
+		TokenEndpoint:                     s.Cfg.IDPIssuer + "/oauth/token",
+		UserinfoEndpoint:                  s.Cfg.IDPIssuer + "/oauth/userinfo",
+		JWKSURI:                           s.Cfg.IDPIssuer + "/.well-known/jwks.json",
+		ScopesSupported:                   oauthScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  s.Keys.Algorithms(),
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "nonce", "email", "email_verified", "preferred_username"},
+	}
+}
+
+// RegisterClient adds a client. Confidential clients get a secret, which is
+// only ever returned here; public clients such as SPAs and CLIs rely on PKCE.
+func (s *OAuthService) RegisterClient(ctx context.Context, createdBy, name string, redirectURIs []string, public bool) (*OAuthClient, error) {
+	for _, uri := range redirectURIs {
+		if !validRedirectURI(uri) {
+			return nil, ErrInvalidRedirectURI
+		}
+	}
+
+	dbClient := &store.OAuthClient{
+		ID:           generateID(),
+		Name:         name,
+		RedirectURIs: strings.Join(redirectURIs, " "),
+		CreatedBy:    &createdBy,
+	}
+	var secret string
+	if !public {
+		secret = generateSecureToken()
+		hash := hashToken(secret)
+		dbClient.SecretHash = &hash
+	}
+
+	if err := s.Store.CreateOAuthClient(ctx, dbClient); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Registered OAuth client", "client_id", dbClient.ID, "name", name, "public", public, "created_by", createdBy)
+	client := newOAuthClient(dbClient)
+	client.Secret = secret
+	return client, nil
+}
+
+func (s *OAuthService) ListClients(ctx context.Context) ([]OAuthClient, error) {
+	dbClients, err := s.Store.ListOAuthClients(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	clients := make([]OAuthClient, 0, len(dbClients))
+	for i := range dbClients {
+		clients = append(clients, *newOAuthClient(&dbClients[i]))
+	}
+	return clients, nil
+}
+
+// DeleteClient removes a client along with every consent granted to it.
+// Tokens already issued stay valid until they expire.
+func (s *OAuthService) DeleteClient(ctx context.Context, id string) error {
+	err := s.Store.DeleteOAuthClient(ctx, id)
+	if errors.Is(err, store.ErrClientNotFound) {
+		return ErrClientNotFound
+	}
+	return err
+}
+
+// Authorize validates an authorization request for the signed in user and
+// reports whether they still need to consent to the requested scopes
+func (s *OAuthService) Authorize(ctx context.Context, userID string, req *AuthorizationRequest) (*AuthorizationPrompt, error) {
+	client, scopes, err := s.validateAuthorization(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	consentRequired, err := s.consentRequired(ctx, userID, client.ID, scopes, req.Prompt)
+	if err != nil {
+		return nil, err
+	}
+	if consentRequired && hasPrompt(req.Prompt, "none") {
+		return nil, authorizationError(req, "consent_required", "the user has not granted the requested scopes")
+	}
+
+	return &AuthorizationPrompt{
+		ClientID:        client.ID,
+		ClientName:      client.Name,
+		Scopes:          scopes,
+		ConsentRequired: consentRequired,
+	}, nil
+}
+
+// Approve records the user's decision and returns the URL to send the
+// browser back to the client with, carrying either a code or access_denied
+func (s *OAuthService) Approve(ctx context.Context, userID string, req *AuthorizationRequest, approved bool) (string, error) {
+	client, scopes, err := s.validateAuthorization(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	if !approved {
+		slog.Info("User denied OAuth client", "user_id", userID, "client_id", client.ID)
+		return authorizationError(req, "access_denied", "the user denied the request").RedirectURL, nil
+	}
+
+	if _, err := s.Auth.GetUserByID(ctx, userID); err != nil {
+		return "", err
+	}
+
+	granted := scopes
+	if consent, err := s.Store.GetOAuthConsent(ctx, userID, client.ID); err == nil {
+		granted = mergeScopes(strings.Fields(consent.Scopes), scopes)
+	} else if !errors.Is(err, store.ErrConsentNotFound) {
+		return "", err
+	}
+
+	if err := s.Store.CleanupExpiredOAuthCodes(ctx); err != nil {
+		slog.Warn("Failed to clean up expired authorization codes", "error", err)
+	}
+
+	code := generateSecureToken()
+	err = s.Store.WithTx(ctx, func(tx store.StoreInterface) error {
+		if err := tx.SaveOAuthConsent(ctx, userID, client.ID, strings.Join(granted, " ")); err != nil {
+			return err
+		}
+		return tx.CreateOAuthCode(ctx, &store.OAuthCode{
+			ID:            hashToken(code),
+			ClientID:      client.ID,
+			UserID:        userID,
+			RedirectURI:   req.RedirectURI,
+			Scopes:        strings.Join(scopes, " "),
+			Nonce:         req.Nonce,
+			CodeChallenge: req.CodeChallenge,
+			ExpiresAt:     time.Now().Add(oauthCodeExpiry),
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return redirectWith(req.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {req.State},
+		"iss":   {s.Cfg.IDPIssuer},
+	}), nil
+}
+
+// Token redeems an authorization code for an ID token and an access token
+func (s *OAuthService) Token(ctx context.Context, req *TokenRequest) (*OAuthTokens, error) {
+	if req.GrantType != "authorization_code" {
+		return nil, &OAuthError{Code: "unsupported_grant_type", Description: "only the authorization_code grant is supported"}
+	}
+
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, &OAuthError{Code: "invalid_request", Description: "code and code_verifier are required"}
+	}
+
+	code, err := s.Store.TakeOAuthCode(ctx, hashToken(req.Code))
+	if err != nil {
+		if errors.Is(err, store.ErrAuthorizationCodeNotFound) {
+			return nil, &OAuthError{Code: "invalid_grant", Description: "invalid or expired authorization code"}
+		}
+		return nil, err
+	}
+
+	switch {
+	case code.ClientID != client.ID:
+		slog.Warn("Authorization code presented by another client", "client_id", client.ID, "issued_to", code.ClientID)
+		return nil, &OAuthError{Code: "invalid_grant", Description: "invalid or expired authorization code"}
+	case time.Now().After(code.ExpiresAt):
+		return nil, &OAuthError{Code: "invalid_grant", Description: "invalid or expired authorization code"}
+	case req.RedirectURI != code.RedirectURI:
+		return nil, &OAuthError{Code: "invalid_grant", Description: "redirect_uri does not match the authorization request"}
+	case !validCodeVerifier(req.CodeVerifier) ||
+		subtle.ConstantTimeCompare([]byte(oidc.CodeChallenge(req.CodeVerifier)), []byte(code.CodeChallenge)) != 1:
+		return nil, &OAuthError{Code: "invalid_grant", Description: "code_verifier does not match the code challenge"}
+	}
+
+	user, err := s.Auth.GetUserByID(ctx, code.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, &OAuthError{Code: "invalid_grant", Description: "the user no longer exists"}
+		}
+		return nil, err
+	}
+
+	scopes := strings.Fields(code.Scopes)
+	now := time.Now()
+	expiresIn := time.Duration(s.Cfg.AccessTokenExpiry) * time.Minute
+
+	accessToken, err := s.Keys.Sign(jwt.MapClaims{
+		"iss":       s.Cfg.IDPIssuer,
+		"sub":       user.ID,
+		"aud":       client.ID,
+		"client_id": client.ID,
+		"scope":     code.Scopes,
+		"jti":       generateID(),
+		"iat":       now.Unix(),
+		"exp":       now.Add(expiresIn).Unix(),
+	}, accessTokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	idClaims := userClaims(user, scopes)
+	idClaims["iss"] = s.Cfg.IDPIssuer
+	idClaims["aud"] = client.ID
+	idClaims["azp"] = client.ID
+	idClaims["iat"] = now.Unix()
+	idClaims["exp"] = now.Add(expiresIn).Unix()
+	if code.Nonce != "" {
+		idClaims["nonce"] = code.Nonce
+	}
+	idToken, err := s.Keys.Sign(idClaims, "JWT")
+	if err != nil {
+		return nil, err
+	}
+
+	return &OAuthTokens{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(expiresIn.Seconds()),
+		IDToken:     idToken,
+		Scope:       code.Scopes,
+	}, nil
+}
+
+// UserInfo returns the claims an access token grants access to
+func (s *OAuthService) UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(accessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != accessTokenType {
+			return nil, errors.New("not an access token")
+		}
+		return s.Keys.Keyfunc(token)
+	},
+		jwt.WithValidMethods(s.Keys.Algorithms()),
+		jwt.WithIssuer(s.Cfg.IDPIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidAccessToken
+	}
+
+	userID, _ := claims["sub"].(string)
+	scope, _ := claims["scope"].(string)
+	user, err := s.Auth.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidAccessToken
+		}
+		return nil, err
+	}
+
+	return userClaims(user, strings.Fields(scope)), nil
+}
+
+// ListConsents returns the clients the user has allowed to sign them in
+func (s *OAuthService) ListConsents(ctx context.Context, userID string) ([]Consent, error) {
+	dbConsents, err := s.Store.ListOAuthConsents(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	consents := make([]Consent, 0, len(dbConsents))
+	for _, c := range dbConsents {
+		consents = append(consents, Consent{
+			ClientID:   c.ClientID,
+			ClientName: c.ClientName,
+			Scopes:     strings.Fields(c.Scopes),
+			CreatedAt:  c.CreatedAt,
+			UpdatedAt:  c.UpdatedAt,
+		})
+	}
+	return consents, nil
+}
+
+// RevokeConsent withdraws a client's consent, so the user is asked again
+// the next time the client signs them in
+func (s *OAuthService) RevokeConsent(ctx context.Context, userID, clientID string) error {
+	err := s.Store.DeleteOAuthConsent(ctx, userID, clientID)
+	if errors.Is(err, store.ErrConsentNotFound) {
+		return ErrConsentNotFound
+	}
+	return err
+}
+
+// validateAuthorization checks an authorization request. Until the client
+// and redirect URI are known to match, errors are shown to the user rather
+// than redirected, so the endpoint cannot be used as an open redirector.
+func (s *OAuthService) validateAuthorization(ctx context.Context, req *AuthorizationRequest) (*store.OAuthClient, []string, error) {
+	client, err := s.Store.GetOAuthClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, store.ErrClientNotFound) {
+			return nil, nil, &OAuthError{Code: "invalid_request", Description: "unknown client_id"}
+		}
+		return nil, nil, err
+	}
+	if !slices.Contains(strings.Fields(client.RedirectURIs), req.RedirectURI) {
+		return nil, nil, &OAuthError{Code: "invalid_request", Description: "redirect_uri is not registered for this client"}
+	}
+
+	if req.ResponseType != "code" {
+		return nil, nil, authorizationError(req, "unsupported_response_type", "only the code response type is supported")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return nil, nil, authorizationError(req, "invalid_request", "PKCE with the S256 method is required")
+	}
+
+	// Unknown scopes are ignored, as OpenID Connect Core section 3.1.2.1 asks
+	var scopes []string
+	for _, scope := range strings.Fields(req.Scope) {
+		if slices.Contains(oauthScopes, scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if !slices.Contains(scopes, scopeOpenID) {
+		return nil, nil, authorizationError(req, "invalid_scope", "the openid scope is required")
+	}
+
+	return client, scopes, nil
+}
+
+// consentRequired reports whether the user has yet to grant the scopes
+func (s *OAuthService) consentRequired(ctx context.Context, userID, clientID string, scopes []string, prompt string) (bool, error) {
+	if hasPrompt(prompt, "consent") {
+		return true, nil
+	}
+
+	consent, err := s.Store.GetOAuthConsent(ctx, userID, clientID)
+	if errors.Is(err, store.ErrConsentNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	granted := strings.Fields(consent.Scopes)
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// authenticateClient checks the credentials sent to the token endpoint.
+// Public clients identify themselves without a secret.
+func (s *OAuthService) authenticateClient(ctx context.Context, clientID, secret string) (*store.OAuthClient, error) {
+	client, err := s.Store.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, store.ErrClientNotFound) {
+			return nil, &OAuthError{Code: "invalid_client", Description: "client authentication failed"}
+		}
+		return nil, err
+	}
+
+	if client.SecretHash == nil {
+		if secret != "" {
+			return nil, &OAuthError{Code: "invalid_client", Description: "public clients do not have a secret"}
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(*client.SecretHash)) != 1 {
+		return nil, &OAuthError{Code: "invalid_client", Description: "client authentication failed"}
+	}
+	return client, nil
+}
+
+// userClaims returns the standard claims about a user for the granted scopes
+func userClaims(user *User, scopes []string) jwt.MapClaims {
+	claims := jwt.MapClaims{"sub": user.ID}
+	if slices.Contains(scopes, scopeProfile) {
+		claims["preferred_username"] = user.Username
+		if user.UpdatedAt != nil {
+			claims["updated_at"] = user.UpdatedAt.Unix()
+		}
+	}
+	if slices.Contains(scopes, scopeEmail) && user.Email != nil {
+		claims["email"] = *user.Email
+		claims["email_verified"] = user.EmailVerifiedAt != nil
+	}
+	return claims
+}
+
+func newOAuthClient(c *store.OAuthClient) *OAuthClient {
+	return &OAuthClient{
+		ID:           c.ID,
+		Name:         c.Name,
+		RedirectURIs: strings.Fields(c.RedirectURIs),
+		Public:       c.SecretHash == nil,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+// authorizationError builds an error that is reported to the client through
+// the request's redirect URI
+func authorizationError(req *AuthorizationRequest, code, description string) *OAuthError {
+	params := url.Values{"error": {code}, "error_description": {description}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return &OAuthError{Code: code, Description: description, RedirectURL: redirectWith(req.RedirectURI, params)}
+}
+
+// redirectWith adds query parameters to a registered redirect URI
+func redirectWith(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := u.Query()
+	for key, values := range params {
+		if values[0] != "" {
+			query[key] = values
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// validRedirectURI accepts absolute https URIs without a fragment, and http
+// only for loopback addresses used by native apps and local development
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" || strings.ContainsAny(uri, " \t\n") {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		ip := net.ParseIP(host)
+		return host == "localhost" || (ip != nil && ip.IsLoopback())
+	default:
+		return false
+	}
+}
+
+// validCodeVerifier checks the length and alphabet from RFC 7636 section 4.1
+func validCodeVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, r := range verifier {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("-._~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasPrompt(prompt, value string) bool {
+	return slices.Contains(strings.Fields(prompt), value)
+}
+
+func mergeScopes(granted, requested []string) []string {
+	merged := slices.Clone(granted)
+	for _, scope := range requested {
+		if !slices.Contains(merged, scope) {
+			merged = append(merged, scope)
+		}
+	}
+	return merged
+}
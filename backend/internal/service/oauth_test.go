@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/oidc"
+)
+
+const (
+	testRedirectURI = "https://wiki.example.com/callback"
+	testVerifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// newOAuthService returns a provider with a fresh Ed25519 key, serving its
+// discovery document and JWKS from a test server that acts as the issuer
+func newOAuthService(t *testing.T, mockStore *MockStore) *OAuthService {
+	t.Helper()
+	keyring := testKeyring()
+	svc := &OAuthService{Store: mockStore, Cfg: testConfig(), Keys: keyring}
+	svc.Auth = &AuthService{Store: mockStore, Cfg: svc.Cfg, Keys: keyring}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(svc.Discovery())
+		case "/.well-known/jwks.json":
+			json.NewEncoder(w).Encode(svc.Keys.JWKS())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	svc.Cfg.IDPIssuer = server.URL
+	svc.Cfg.IDPAuthorizeURL = "http://localhost:5173/oauth/authorize"
+	return svc
+}
+
+func testAuthorizationRequest() *AuthorizationRequest {
+	return &AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            "client-1",
+		RedirectURI:         testRedirectURI,
+		Scope:               "openid email profile offline_access",
+		State:               "xyz",
+		Nonce:               "n-0S6_WzA2Mj",
+		CodeChallenge:       oidc.CodeChallenge(testVerifier),
+		CodeChallengeMethod: "S256",
+	}
+}
+
+func confidentialClient() *store.OAuthClient {
+	hash := hashToken("client-secret")
+	return &store.OAuthClient{ID: "client-1", Name: "Wiki", SecretHash: &hash, RedirectURIs: testRedirectURI + " https://wiki.example.com/other"}
+}
+
+func TestOAuthService_CodeFlow(t *testing.T) {
+	ctx := context.Background()
+	mockStore := new(MockStore)
+	svc := newOAuthService(t, mockStore)
+
+	email := "alice@example.com"
+	verifiedAt := time.Now()
+	mockStore.On("GetOAuthClient", mock.Anything, "client-1").Return(confidentialClient(), nil)
+	mockStore.On("GetOAuthConsent", mock.Anything, "user-1", "client-1").Return(nil, store.ErrConsentNotFound)
+	mockStore.On("GetUserByID", mock.Anything, "user-1").Return(&store.User{ID: "user-1", Username: "alice", Email: &email, EmailVerifiedAt: &verifiedAt}, nil)
+	mockStore.On("CleanupExpiredOAuthCodes", mock.Anything).Return(nil)
+	mockStore.On("SaveOAuthConsent", mock.Anything, "user-1", "client-1", "openid email profile").Return(nil)
+
+	var issued *store.OAuthCode
+	mockStore.On("CreateOAuthCode", mock.Anything, mock.MatchedBy(func(code *store.OAuthCode) bool {
+		issued = code
+		return true
+	})).Return(nil)
+
+	prompt, err := svc.Authorize(ctx, "user-1", testAuthorizationRequest())
+	assert.NoError(t, err)
+	assert.True(t, prompt.ConsentRequired)
+	assert.Equal(t, "Wiki", prompt.ClientName)
+	assert.Equal(t, []string{"openid", "email", "profile"}, prompt.Scopes, "unknown scopes are dropped")
+
+	redirect, err := svc.Approve(ctx, "user-1", testAuthorizationRequest(), true)
+	assert.NoError(t, err)
+	u, _ := url.Parse(redirect)
+	code := u.Query().Get("code")
+	assert.Equal(t, "xyz", u.Query().Get("state"))
+	assert.Equal(t, svc.Cfg.IDPIssuer, u.Query().Get("iss"))
+	assert.True(t, strings.HasPrefix(redirect, testRedirectURI+"?"))
+	assert.NotEmpty(t, code)
+	assert.Equal(t, hashToken(code), issued.ID, "only the hash of the code is stored")
+
+	mockStore.On("TakeOAuthCode", mock.Anything, hashToken(code)).Return(issued, nil).Once()
+
+	tokens, err := svc.Token(ctx, &TokenRequest{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		ClientID:     "client-1",
+		ClientSecret: "client-secret",
+		CodeVerifier: testVerifier,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, 15*60, tokens.ExpiresIn)
+
+	// The ID token verifies with the same relying party code used for social login
+	rp := oidc.NewClient(oidc.Config{Issuer: svc.Cfg.IDPIssuer, ClientID: "client-1"}, nil)
+	idToken, err := rp.VerifyIDToken(ctx, tokens.IDToken, "n-0S6_WzA2Mj")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", idToken.Subject)
+	assert.Equal(t, email, idToken.Email)
+	assert.True(t, idToken.EmailVerified)
+	assert.Equal(t, "alice", idToken.PreferredUsername)
+
+	claims, err := svc.UserInfo(ctx, tokens.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims["sub"])
+	assert.Equal(t, email, claims["email"])
+
+	_, err = svc.UserInfo(ctx, tokens.IDToken)
+	assert.Equal(t, ErrInvalidAccessToken, err, "ID tokens are not access tokens")
+}
+
+func TestOAuthService_Authorize(t *testing.T) {
+	tests := []struct {
+		name         string
+		modify       func(*AuthorizationRequest)
+		consent      *store.OAuthConsent
+		expectCode   string
+		expectRedir  bool
+		expectPrompt bool
+	}{
+		{name: "unknown client", modify: func(r *AuthorizationRequest) { r.ClientID = "other" }, expectCode: "invalid_request"},
+		{name: "unregistered redirect uri", modify: func(r *AuthorizationRequest) { r.RedirectURI = "https://evil.example.com/" }, expectCode: "invalid_request"},
+		{name: "implicit flow", modify: func(r *AuthorizationRequest) { r.ResponseType = "token" }, expectCode: "unsupported_response_type", expectRedir: true},
+		{name: "missing PKCE", modify: func(r *AuthorizationRequest) { r.CodeChallenge = "" }, expectCode: "invalid_request", expectRedir: true},
+		{name: "plain PKCE", modify: func(r *AuthorizationRequest) { r.CodeChallengeMethod = "plain" }, expectCode: "invalid_request", expectRedir: true},
+		{name: "missing openid scope", modify: func(r *AuthorizationRequest) { r.Scope = "email" }, expectCode: "invalid_scope", expectRedir: true},
+		{name: "silent without consent", modify: func(r *AuthorizationRequest) { r.Prompt = "none" }, expectCode: "consent_required", expectRedir: true},
+		{name: "silent with consent", modify: func(r *AuthorizationRequest) { r.Prompt = "none" }, consent: &store.OAuthConsent{Scopes: "openid profile email"}},
+		{name: "consent covers the scopes", consent: &store.OAuthConsent{Scopes: "openid profile email"}},
+		{name: "consent misses a scope", consent: &store.OAuthConsent{Scopes: "openid"}, expectPrompt: true},
+		{name: "prompt forces consent", modify: func(r *AuthorizationRequest) { r.Prompt = "login consent" }, consent: &store.OAuthConsent{Scopes: "openid profile email"}, expectPrompt: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := new(MockStore)
+			svc := newOAuthService(t, mockStore)
+			mockStore.On("GetOAuthClient", mock.Anything, "client-1").Return(confidentialClient(), nil)
+			mockStore.On("GetOAuthClient", mock.Anything, "other").Return(nil, store.ErrClientNotFound)
+			if tt.consent != nil {
+				mockStore.On("GetOAuthConsent", mock.Anything, "user-1", "client-1").Return(tt.consent, nil)
+			} else {
+				mockStore.On("GetOAuthConsent", mock.Anything, "user-1", "client-1").Return(nil, store.ErrConsentNotFound)
+			}
+
+			req := testAuthorizationRequest()
+			if tt.modify != nil {
+				tt.modify(req)
+			}
+			prompt, err := svc.Authorize(context.Background(), "user-1", req)
+
+			if tt.expectCode == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectPrompt, prompt.ConsentRequired)
+				return
+			}
+
+			var oauthErr *OAuthError
+			if !errors.As(err, &oauthErr) {
+				t.Fatalf("expected an OAuthError, got %v", err)
+			}
+			assert.Equal(t, tt.expectCode, oauthErr.Code)
+			if !tt.expectRedir {
+				assert.Empty(t, oauthErr.RedirectURL, "errors before the redirect URI is trusted must not redirect")
+				return
+			}
+			u, _ := url.Parse(oauthErr.RedirectURL)
+			assert.Equal(t, tt.expectCode, u.Query().Get("error"))
+			assert.Equal(t, "xyz", u.Query().Get("state"))
+		})
+	}
+}
+
+func TestOAuthService_ApproveDenied(t *testing.T) {
+	mockStore := new(MockStore)
+	svc := newOAuthService(t, mockStore)
+	mockStore.On("GetOAuthClient", mock.Anything, "client-1").Return(confidentialClient(), nil)
+
+	redirect, err := svc.Approve(context.Background(), "user-1", testAuthorizationRequest(), false)
+	assert.NoError(t, err)
+	u, _ := url.Parse(redirect)
+	assert.Equal(t, "access_denied", u.Query().Get("error"))
+	assert.Empty(t, u.Query().Get("code"))
+	mockStore.AssertNotCalled(t, "CreateOAuthCode", mock.Anything, mock.Anything)
+}
+
+func TestOAuthService_TokenRejections(t *testing.T) {
+	publicClient := &store.OAuthClient{ID: "cli", Name: "CLI", RedirectURIs: "http://127.0.0.1:8765/callback"}
+	validCode := func() *store.OAuthCode {
+		return &store.OAuthCode{
+			ID:            hashToken("the-code"),
+			ClientID:      "client-1",
+			UserID:        "user-1",
+			RedirectURI:   testRedirectURI,
+			Scopes:        "openid",
+			CodeChallenge: oidc.CodeChallenge(testVerifier),
+			ExpiresAt:     time.Now().Add(time.Minute),
+		}
+	}
+
+	tests := []struct {
+		name       string
+		modify     func(*TokenRequest)
+		code       func() *store.OAuthCode
+		expectCode string
+	}{
+		{name: "refresh grant", modify: func(r *TokenRequest) { r.GrantType = "refresh_token" }, expectCode: "unsupported_grant_type"},
+		{name: "unknown client", modify: func(r *TokenRequest) { r.ClientID = "other" }, expectCode: "invalid_client"},
+		{name: "wrong secret", modify: func(r *TokenRequest) { r.ClientSecret = "guess" }, expectCode: "invalid_client"},
+		{name: "missing secret", modify: func(r *TokenRequest) { r.ClientSecret = "" }, expectCode: "invalid_client"},
+		{name: "public client sending a secret", modify: func(r *TokenRequest) { r.ClientID = "cli" }, expectCode: "invalid_client"},
+		{name: "missing verifier", modify: func(r *TokenRequest) { r.CodeVerifier = "" }, expectCode: "invalid_request"},
+		{name: "unknown code", code: func() *store.OAuthCode { return nil }, expectCode: "invalid_grant"},
+		{name: "wrong verifier", modify: func(r *TokenRequest) { r.CodeVerifier = strings.Repeat("a", 43) }, expectCode: "invalid_grant"},
+		{name: "redirect uri mismatch", modify: func(r *TokenRequest) { r.RedirectURI = "https://wiki.example.com/other" }, expectCode: "invalid_grant"},
+		{
+			name: "expired code",
+			code: func() *store.OAuthCode {
+				code := validCode()
+				code.ExpiresAt = time.Now().Add(-time.Second)
+				return code
+			},
+			expectCode: "invalid_grant",
+		},
+		{
+			name: "code issued to another client",
+			code: func() *store.OAuthCode {
+				code := validCode()
+				code.ClientID = "cli"
+				return code
+			},
+			expectCode: "invalid_grant",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := new(MockStore)
+			svc := newOAuthService(t, mockStore)
+			mockStore.On("GetOAuthClient", mock.Anything, "client-1").Return(confidentialClient(), nil)
+			mockStore.On("GetOAuthClient", mock.Anything, "cli").Return(publicClient, nil)
+			mockStore.On("GetOAuthClient", mock.Anything, "other").Return(nil, store.ErrClientNotFound)
+
+			code := validCode
+			if tt.code != nil {
+				code = tt.code
+			}
+			if c := code(); c != nil {
+				mockStore.On("TakeOAuthCode", mock.Anything, hashToken("the-code")).Return(c, nil)
+			} else {
+				mockStore.On("TakeOAuthCode", mock.Anything, hashToken("the-code")).Return(nil, store.ErrAuthorizationCodeNotFound)
+			}
+
+			req := &TokenRequest{
+				GrantType:    "authorization_code",
+				Code:         "the-code",
+				RedirectURI:  testRedirectURI,
+				ClientID:     "client-1",
+				ClientSecret: "client-secret",
+				CodeVerifier: testVerifier,
+			}
+			if tt.modify != nil {
+				tt.modify(req)
+			}
+
+			_, err := svc.Token(context.Background(), req)
+			var oauthErr *OAuthError
+			if !errors.As(err, &oauthErr) {
+				t.Fatalf("expected an OAuthError, got %v", err)
+			}
+			assert.Equal(t, tt.expectCode, oauthErr.Code)
+		})
+	}
+}
+
+func TestOAuthService_RegisterClient(t *testing.T) {
+	mockStore := new(MockStore)
+	svc := newOAuthService(t, mockStore)
+
+	var created *store.OAuthClient
+	mockStore.On("CreateOAuthClient", mock.Anything, mock.MatchedBy(func(c *store.OAuthClient) bool {
+		created = c
+		return true
+	})).Return(nil)
+
+	client, err := svc.RegisterClient(context.Background(), "admin-1", "Wiki", []string{testRedirectURI}, false)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, client.Secret)
+	assert.False(t, client.Public)
+	assert.Equal(t, hashToken(client.Secret), *created.SecretHash)
+
+	client, err = svc.RegisterClient(context.Background(), "admin-1", "CLI", []string{"http://127.0.0.1:8765/callback"}, true)
+	assert.NoError(t, err)
+	assert.Empty(t, client.Secret)
+	assert.True(t, client.Public)
+	assert.Nil(t, created.SecretHash)
+
+	for _, uri := range []string{"http://wiki.example.com/callback", "https://wiki.example.com/cb#frag", "/callback", "javascript:alert(1)"} {
+		_, err := svc.RegisterClient(context.Background(), "admin-1", "Bad", []string{uri}, true)
+		assert.Equal(t, ErrInvalidRedirectURI, err, uri)
+	}
+}
@@ -0,0 +1,413 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/oidc"
+)
+
+const (
+	// oidcRequestExpiry is how long the user has to finish signing in at the provider
+	oidcRequestExpiry = 10 * time.Minute
+	// usernameAttempts is how many suffixed usernames are tried for a new
+	// account before giving up
+	usernameAttempts = 5
+)
+
+// OIDCAuthorization is a started sign in with an external provider. The
+// browser is sent to URL; the provider redirects back with a code and State,
+// which the frontend should check matches before completing the login.
+type OIDCAuthorization struct {
+	URL   string
+	State string
+}
+
+// Identity is an external account linked to a user, as listed on the profile
+type Identity struct {
+	ID          string     `json:"id"`
+	Provider    string     `json:"provider"`
+	Email       *string    `json:"email,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// newOIDCClients builds a client for every configured provider. Discovery
+// happens on first use, so an unreachable provider does not block startup.
+func newOIDCClients(providers []config.OIDCProvider) map[string]*oidc.Client {
+	clients := make(map[string]*oidc.Client, len(providers))
+	for _, p := range providers {
+		clients[p.Name] = oidc.NewClient(oidc.Config{
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		}, nil)
+	}
+	return clients
+}
+
+// ListOIDCProviders returns the names of the providers users can sign in
+// with, in configuration order
+func (s *AuthService) ListOIDCProviders(ctx context.Context) []string {
+	names := []string{}
+	for _, p := range s.Cfg.OIDCProviders {
+		if _, ok := s.OIDCClients[p.Name]; ok {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// StartOIDCLogin begins signing in with an external provider
+func (s *AuthService) StartOIDCLogin(ctx context.Context, provider string) (*OIDCAuthorization, error) {
+	return s.startOIDC(ctx, provider, nil)
+}
+
+// CompleteOIDCLogin finishes signing in with an external provider. A known
+// identity logs in its user. An unknown one is linked to the account with
+// the same email when the provider has verified the address, and otherwise
+// gets a new account without a password. Accounts with two-factor enabled
+// still need a code, as with a password login.
+func (s *AuthService) CompleteOIDCLogin(ctx context.Context, provider, state, code string) (*AuthTokens, *User, error) {
+	idToken, err := s.completeOIDC(ctx, provider, state, code, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dbUser *store.User
+	identity, err := s.Store.GetUserIdentity(ctx, provider, idToken.Subject)
+	switch {
+	case err == nil:
+		dbUser, err = s.Store.GetUserByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, nil, ErrOIDCAuthFailed
+		}
+	case errors.Is(err, store.ErrIdentityNotFound):
+		dbUser, identity, err = s.linkOrCreateUser(ctx, provider, idToken)
+		if err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, err
+	}
+
+	if err := s.requireVerifiedEmail(dbUser); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.mfaChallenge(ctx, dbUser.ID); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.Store.RecordUserIdentityLogin(ctx, identity.ID); err != nil {
+		slog.Warn("Failed to record identity login", "identity_id", identity.ID, "error", err)
+	}
+
+	tokens, err := s.createSession(ctx, dbUser.ID, dbUser.Username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, userFromStore(dbUser), nil
+}
+
+// StartOIDCLink begins linking an external account to a signed in user
+func (s *AuthService) StartOIDCLink(ctx context.Context, userID, provider string) (*OIDCAuthorization, error) {
+	if _, err := s.Store.GetUserByID(ctx, userID); err != nil {
+		return nil, ErrUserNotFound
+	}
+	return s.startOIDC(ctx, provider, &userID)
+}
+
+// CompleteOIDCLink links the external account the user signed in to. An
+// account can only ever be linked to one user.
+func (s *AuthService) CompleteOIDCLink(ctx context.Context, userID, provider, state, code string) (*Identity, error) {
+	idToken, err := s.completeOIDC(ctx, provider, state, code, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.Store.GetUserIdentity(ctx, provider, idToken.Subject); err == nil {
+		return nil, ErrIdentityLinked
+	} else if !errors.Is(err, store.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	identity := newUserIdentity(userID, provider, idToken)
+	if err := s.Store.CreateUserIdentity(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Linked external identity", "user_id", userID, "provider", provider)
+	return &Identity{ID: identity.ID, Provider: identity.Provider, Email: identity.Email}, nil
+}
+
+func (s *AuthService) ListIdentities(ctx context.Context, userID string) ([]Identity, error) {
+	dbIdentities, err := s.Store.ListUserIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities := make([]Identity, 0, len(dbIdentities))
+	for _, identity := range dbIdentities {
+		identities = append(identities, Identity{
+			ID:          identity.ID,
+			Provider:    identity.Provider,
+			Email:       identity.Email,
+			CreatedAt:   identity.CreatedAt,
+			LastLoginAt: identity.LastLoginAt,
+		})
+	}
+	return identities, nil
+}
+
+// DeleteIdentity unlinks an external account. The last identity of an
+// account without a password or passkey cannot be removed, since the user
+// would have no way left to sign in.
+func (s *AuthService) DeleteIdentity(ctx context.Context, userID, identityID string) error {
+	identities, err := s.Store.ListUserIdentities(ctx, userID)
+	if err != nil {
+		return err
+	}
+	owned := false
+	for _, identity := range identities {
+		owned = owned || identity.ID == identityID
+	}
+	if !owned {
+		return ErrIdentityNotFound
+	}
+
+	if len(identities) == 1 {
+		dbUser, err := s.Store.GetUserByID(ctx, userID)
+		if err != nil {
+			return ErrUserNotFound
+		}
+		creds, err := s.Store.ListWebAuthnCredentials(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if dbUser.PasswordHash == "" && len(creds) == 0 {
+			return ErrLastLoginMethod
+		}
+	}
+
+	err = s.Store.DeleteUserIdentity(ctx, identityID, userID)
+	if errors.Is(err, store.ErrIdentityNotFound) {
+		return ErrIdentityNotFound
+	}
+	return err
+}
+
+// startOIDC records a pending authorization request and returns where to
+// send the browser. linkUserID is set when a signed in user links an account.
+func (s *AuthService) startOIDC(ctx context.Context, provider string, linkUserID *string) (*OIDCAuthorization, error) {
+	client, ok := s.OIDCClients[provider]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	if err := s.Store.CleanupExpiredOIDCAuthRequests(ctx); err != nil {
+		slog.Warn("Failed to clean up expired authorization requests", "error", err)
+	}
+
+	state, err := oidc.NewState()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := oidc.NewState()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := client.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		slog.Error("OIDC discovery failed", "provider", provider, "error", err)
+		return nil, ErrOIDCAuthFailed
+	}
+
+	err = s.Store.CreateOIDCAuthRequest(ctx, &store.OIDCAuthRequest{
+		ID:           hashToken(state),
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       linkUserID,
+		ExpiresAt:    time.Now().Add(oidcRequestExpiry),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCAuthorization{URL: authURL, State: state}, nil
+}
+
+// completeOIDC consumes the pending request behind state, redeems the code
+// and returns the verified ID token. linkUserID must match the user the
+// request was started for, and is empty for a login.
+func (s *AuthService) completeOIDC(ctx context.Context, provider, state, code, linkUserID string) (*oidc.IDToken, error) {
+	client, ok := s.OIDCClients[provider]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	pending, err := s.Store.TakeOIDCAuthRequest(ctx, hashToken(state))
+	if err != nil {
+		if errors.Is(err, store.ErrAuthRequestNotFound) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+	pendingUserID := ""
+	if pending.UserID != nil {
+		pendingUserID = *pending.UserID
+	}
+	if pending.Provider != provider || pendingUserID != linkUserID || time.Now().After(pending.ExpiresAt) {
+		return nil, ErrInvalidOIDCState
+	}
+
+	tokens, err := client.Exchange(ctx, code, pending.CodeVerifier)
+	if err != nil {
+		slog.Warn("OIDC code exchange failed", "provider", provider, "error", err)
+		return nil, ErrOIDCAuthFailed
+	}
+	idToken, err := client.VerifyIDToken(ctx, tokens.IDToken, pending.Nonce)
+	if err != nil {
+		slog.Warn("Rejected OIDC ID token", "provider", provider, "error", err)
+		return nil, ErrOIDCAuthFailed
+	}
+	return idToken, nil
+}
+
+// linkOrCreateUser resolves the user for an identity seen for the first time
+func (s *AuthService) linkOrCreateUser(ctx context.Context, provider string, idToken *oidc.IDToken) (*store.User, *store.UserIdentity, error) {
+	if idToken.Email != "" {
+		existing, err := s.Store.GetUserByEmail(ctx, idToken.Email)
+		if err == nil {
+			// Only a verified address proves the caller owns the existing
+			// account, and only an account that verified it proves its
+			// password was set by the same owner rather than by someone who
+			// registered the address first
+			if !idToken.EmailVerified || existing.EmailVerifiedAt == nil {
+				return nil, nil, ErrEmailExists
+			}
+			identity := newUserIdentity(existing.ID, provider, idToken)
+			if err := s.Store.CreateUserIdentity(ctx, identity); err != nil {
+				return nil, nil, err
+			}
+			slog.Info("Linked external identity by verified email", "user_id", existing.ID, "provider", provider)
+			return existing, identity, nil
+		}
+	}
+
+	username, err := s.availableUsername(ctx, idToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Unverified addresses are not stored, so they cannot block the real
+	// owner from registering
+	email := ""
+	if idToken.EmailVerified {
+		email = idToken.Email
+	}
+	if email == "" && s.Cfg.EmailVerification == config.VerifyEmailLogin {
+		// The account could never sign in
+		return nil, nil, ErrEmailNotVerified
+	}
+
+	userID := generateID()
+	identity := newUserIdentity(userID, provider, idToken)
+	err = s.Store.WithTx(ctx, func(tx store.StoreInterface) error {
+		// Accounts created through a provider have no password until one is
+		// set through a password reset
+		if err := tx.CreateUser(ctx, userID, username, email, ""); err != nil {
+			return err
+		}
+		if err := tx.CreateUserIdentity(ctx, identity); err != nil {
+			return err
+		}
+		if email != "" {
+			if err := tx.MarkEmailVerified(ctx, userID, email); err != nil {
+				return err
+			}
+		}
+		return s.assignInitialRoles(ctx, tx, userID, username)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dbUser := &store.User{ID: userID, Username: username}
+	if email != "" {
+		now := time.Now()
+		dbUser.Email = &email
+		dbUser.EmailVerifiedAt = &now
+	}
+	slog.Info("Created account from external identity", "user_id", userID, "provider", provider)
+	return dbUser, identity, nil
+}
+
+// availableUsername derives a username from the ID token claims, adding a
+// random suffix when it is already taken
+func (s *AuthService) availableUsername(ctx context.Context, idToken *oidc.IDToken) (string, error) {
+	localPart, _, _ := strings.Cut(idToken.Email, "@")
+	base := ""
+	for _, candidate := range []string{idToken.PreferredUsername, localPart, idToken.Name} {
+		if base = sanitizeUsername(candidate); len(base) >= 3 {
+			break
+		}
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+
+	username := base
+	for range usernameAttempts {
+		if _, err := s.Store.GetUserByUsername(ctx, username); errors.Is(err, store.ErrUserNotFound) {
+			return username, nil
+		}
+		username = base + "-" + generateSecureToken()[:6]
+	}
+	return "", ErrUserExists
+}
+
+// sanitizeUsername keeps the letters, digits, dots, dashes and underscores
+// of name, cut short enough to leave room for a suffix
+func sanitizeUsername(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_') {
+			b.WriteRune(r)
+		}
+	}
+	username := strings.Trim(b.String(), ".-_")
+	if len(username) > 25 {
+		username = username[:25]
+	}
+	return username
+}
+
+func newUserIdentity(userID, provider string, idToken *oidc.IDToken) *store.UserIdentity {
+	identity := &store.UserIdentity{
+		ID:       generateID(),
+		UserID:   userID,
+		Provider: provider,
+		Subject:  idToken.Subject,
+	}
+	if idToken.Email != "" {
+		email := idToken.Email
+		identity.Email = &email
+	}
+	return identity
+}
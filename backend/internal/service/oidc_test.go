@@ -0,0 +1,343 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/mail"
+	"github.com/user/votex-template/backend/pkg/oidc/oidctest"
+)
+
+func newOIDCService(t *testing.T, mockStore *MockStore) (*AuthService, *oidctest.Provider) {
+	t.Helper()
+	provider := oidctest.NewProvider("votex", "secret")
+	t.Cleanup(provider.Close)
+
+	cfg := testConfig()
+	cfg.OIDCProviders = []config.OIDCProvider{{
+		Name:         "fake",
+		Issuer:       provider.Issuer(),
+		ClientID:     "votex",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:5173/auth/callback/fake",
+	}}
+	return &AuthService{
+		Store:        mockStore,
+		Cfg:          cfg,
+		EmailService: NewEmailService(cfg, &mail.Memory{}),
+		OIDCClients:  newOIDCClients(cfg.OIDCProviders),
+		Keys:         testKeyring(),
+	}, provider
+}
+
+// authorizeAtProvider starts a flow, lets the fake provider approve it for
+// claims and sets the store up to hand the pending request back once. It
+// returns the state and code the provider redirected with.
+func authorizeAtProvider(t *testing.T, service *AuthService, mockStore *MockStore, provider *oidctest.Provider, linkUserID string, claims oidctest.Claims) (string, string) {
+	t.Helper()
+	var pending *store.OIDCAuthRequest
+	mockStore.On("CleanupExpiredOIDCAuthRequests", mock.Anything).Return(nil)
+	mockStore.On("CreateOIDCAuthRequest", mock.Anything, mock.AnythingOfType("*store.OIDCAuthRequest")).
+		Run(func(args mock.Arguments) { pending = args.Get(1).(*store.OIDCAuthRequest) }).
+		Return(nil).Once()
+
+	var auth *OIDCAuthorization
+	var err error
+	if linkUserID == "" {
+		auth, err = service.StartOIDCLogin(context.Background(), "fake")
+	} else {
+		auth, err = service.StartOIDCLink(context.Background(), linkUserID, "fake")
+	}
+	if err != nil {
+		t.Fatalf("failed to start sign in: %v", err)
+	}
+	if pending.ID != hashToken(auth.State) || strings.Contains(auth.URL, pending.CodeVerifier) {
+		t.Fatalf("pending request must be keyed by the hashed state and keep the verifier secret")
+	}
+
+	code, state, err := provider.Authorize(auth.URL, claims)
+	if err != nil {
+		t.Fatalf("provider refused the request: %v", err)
+	}
+	mockStore.On("TakeOIDCAuthRequest", mock.Anything, hashToken(state)).Return(pending, nil).Once()
+	return state, code
+}
+
+func expectOIDCSession(mockStore *MockStore, userID string) {
+	mockStore.On("GetUserMFA", mock.Anything, userID).Return(nil, store.ErrMFANotFound)
+	mockStore.On("RecordUserIdentityLogin", mock.Anything, mock.AnythingOfType("string")).Return(nil)
+	mockStore.On("CreateSession", mock.Anything, mock.AnythingOfType("string"), userID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
+	expectTokenIssue(mockStore, userID)
+}
+
+func TestAuthService_CompleteOIDCLogin(t *testing.T) {
+	email := "alice@example.com"
+	verifiedAt := time.Now()
+	alice := &store.User{ID: "1", Username: "alice", Email: &email, EmailVerifiedAt: &verifiedAt, PasswordHash: "hash"}
+	aliceClaims := oidctest.Claims{Subject: "sub-1", Email: email, EmailVerified: true, PreferredUsername: "alice"}
+
+	t.Run("known identity logs in its user", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, provider := newOIDCService(t, mockStore)
+		state, code := authorizeAtProvider(t, service, mockStore, provider, "", aliceClaims)
+
+		mockStore.On("GetUserIdentity", mock.Anything, "fake", "sub-1").Return(&store.UserIdentity{ID: "id-1", UserID: "1"}, nil)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(alice, nil)
+		expectOIDCSession(mockStore, "1")
+
+		tokens, user, err := service.CompleteOIDCLogin(context.Background(), "fake", state, code)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.Equal(t, "alice", user.Username)
+		mockStore.AssertCalled(t, "RecordUserIdentityLogin", mock.Anything, "id-1")
+	})
+
+	t.Run("links to the account with the same verified email", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, provider := newOIDCService(t, mockStore)
+		state, code := authorizeAtProvider(t, service, mockStore, provider, "", aliceClaims)
+
+		mockStore.On("GetUserIdentity", mock.Anything, "fake", "sub-1").Return(nil, store.ErrIdentityNotFound)
+		mockStore.On("GetUserByEmail", mock.Anything, email).Return(alice, nil)
+		mockStore.On("CreateUserIdentity", mock.Anything, mock.MatchedBy(func(identity *store.UserIdentity) bool {
+			return identity.UserID == "1" && identity.Provider == "fake" && identity.Subject == "sub-1"
+		})).Return(nil)
+		expectOIDCSession(mockStore, "1")
+
+		_, user, err := service.CompleteOIDCLogin(context.Background(), "fake", state, code)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", user.ID)
+	})
+
+	t.Run("unverified account is not linked", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, provider := newOIDCService(t, mockStore)
+		state, code := authorizeAtProvider(t, service, mockStore, provider, "", aliceClaims)
+
+		// Someone registered the address with their own password and never
+		// verified it; linking would hand them the owner's sign-ins
+		squatter := *alice
+		squatter.EmailVerifiedAt = nil
+		mockStore.On("GetUserIdentity", mock.Anything, "fake", "sub-1").Return(nil, store.ErrIdentityNotFound)
+		mockStore.On("GetUserByEmail", mock.Anything, email).Return(&squatter, nil)
+
+		_, _, err := service.CompleteOIDCLogin(context.Background(), "fake", state, code)
+		assert.Equal(t, ErrEmailExists, err)
+		mockStore.AssertNotCalled(t, "CreateUserIdentity", mock.Anything, mock.Anything)
+		mockStore.AssertNotCalled(t, "MarkEmailVerified", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("unverified email never takes over an account", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, provider := newOIDCService(t, mockStore)
+		claims := aliceClaims
+		claims.EmailVerified = false
+		state, code := authorizeAtProvider(t, service, mockStore, provider, "", claims)
+
+		mockStore.On("GetUserIdentity", mock.Anything, "fake", "sub-1").Return(nil, store.ErrIdentityNotFound)
+		mockStore.On("GetUserByEmail", mock.Anything, email).Return(alice, nil)
+
+		_, _, err := service.CompleteOIDCLogin(context.Background(), "fake", state, code)
+		assert.Equal(t, ErrEmailExists, err)
+		mockStore.AssertNotCalled(t, "CreateUserIdentity", mock.Anything, mock.Anything)
+	})
+
+	t.Run("creates an account without a password", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, provider := newOIDCService(t, mockStore)
+		state, code := authorizeAtProvider(t, service, mockStore, provider, "", aliceClaims)
+
+		var created string
+		mockStore.On("GetUserIdentity", mock.Anything, "fake", "sub-1").Return(nil, store.ErrIdentityNotFound)
+		mockStore.On("GetUserByEmail", mock.Anything, email).Return(nil, store.ErrUserNotFound)
+		mockStore.On("GetUserByUsername", mock.Anything, "alice").Return(&store.User{ID: "2"}, nil)
+		mockStore.On("GetUserByUsername", mock.Anything, mock.AnythingOfType("string")).Return(nil, store.ErrUserNotFound)
+		mockStore.On("CreateUser", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), email, "").
+			Run(func(args mock.Arguments) { created = args.String(2) }).
+			Return(nil)
+		mockStore.On("CreateUserIdentity", mock.Anything, mock.AnythingOfType("*store.UserIdentity")).Return(nil)
+		mockStore.On("MarkEmailVerified", mock.Anything, mock.AnythingOfType("string"), email).Return(nil)
+		mockStore.On("AssignRole", mock.Anything, mock.AnythingOfType("string"), "user").Return(nil)
+		mockStore.On("ClaimAdminBootstrap", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+		mockStore.On("GetUserMFA", mock.Anything, mock.AnythingOfType("string")).Return(nil, store.ErrMFANotFound)
+		mockStore.On("RecordUserIdentityLogin", mock.Anything, mock.AnythingOfType("string")).Return(nil)
+		mockStore.On("CreateSession", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
+		mockStore.On("GetUserRoles", mock.Anything, mock.AnythingOfType("string")).Return([]string{"user"}, nil)
+		mockStore.On("GetUserPermissions", mock.Anything, mock.AnythingOfType("string")).Return([]string{}, nil)
+
+		tokens, user, err := service.CompleteOIDCLogin(context.Background(), "fake", state, code)
+		assert.NoError(t, err)
+		assert.NotNil(t, tokens)
+		assert.Regexp(t, `^alice-[0-9a-f]{6}$`, user.Username)
+		assert.Equal(t, created, user.Username)
+	})
+
+	t.Run("two-factor accounts still need a code", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, provider := newOIDCService(t, mockStore)
+		state, code := authorizeAtProvider(t, service, mockStore, provider, "", aliceClaims)
+
+		mockStore.On("GetUserIdentity", mock.Anything, "fake", "sub-1").Return(&store.UserIdentity{ID: "id-1", UserID: "1"}, nil)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(alice, nil)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(enabledMFA("1"), nil)
+		expectMFAChallenge(mockStore)
+
+		tokens, _, err := service.CompleteOIDCLogin(context.Background(), "fake", state, code)
+		var mfaErr *MFARequiredError
+		assert.True(t, errors.As(err, &mfaErr))
+		assert.Nil(t, tokens)
+		mockStore.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("state can only be used once", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, provider := newOIDCService(t, mockStore)
+		state, code := authorizeAtProvider(t, service, mockStore, provider, "", aliceClaims)
+		mockStore.On("TakeOIDCAuthRequest", mock.Anything, hashToken(state)).Return(nil, store.ErrAuthRequestNotFound)
+		mockStore.On("GetUserIdentity", mock.Anything, "fake", "sub-1").Return(&store.UserIdentity{ID: "id-1", UserID: "1"}, nil)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(alice, nil)
+		expectOIDCSession(mockStore, "1")
+
+		_, _, err := service.CompleteOIDCLogin(context.Background(), "fake", state, code)
+		assert.NoError(t, err)
+		_, _, err = service.CompleteOIDCLogin(context.Background(), "fake", state, code)
+		assert.Equal(t, ErrInvalidOIDCState, err)
+	})
+
+	t.Run("link request cannot be used to log in", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, provider := newOIDCService(t, mockStore)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(alice, nil)
+		state, code := authorizeAtProvider(t, service, mockStore, provider, "1", aliceClaims)
+
+		_, _, err := service.CompleteOIDCLogin(context.Background(), "fake", state, code)
+		assert.Equal(t, ErrInvalidOIDCState, err)
+	})
+
+	t.Run("rejected code", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, provider := newOIDCService(t, mockStore)
+		state, _ := authorizeAtProvider(t, service, mockStore, provider, "", aliceClaims)
+
+		_, _, err := service.CompleteOIDCLogin(context.Background(), "fake", state, "forged")
+		assert.Equal(t, ErrOIDCAuthFailed, err)
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, _ := newOIDCService(t, mockStore)
+
+		_, err := service.StartOIDCLogin(context.Background(), "other")
+		assert.Equal(t, ErrUnknownOIDCProvider, err)
+		_, _, err = service.CompleteOIDCLogin(context.Background(), "other", "state", "code")
+		assert.Equal(t, ErrUnknownOIDCProvider, err)
+	})
+}
+
+func TestAuthService_CompleteOIDCLink(t *testing.T) {
+	claims := oidctest.Claims{Subject: "sub-1", Email: "alice@work.example", EmailVerified: true}
+
+	t.Run("links a new identity", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, provider := newOIDCService(t, mockStore)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "alice"}, nil)
+		state, code := authorizeAtProvider(t, service, mockStore, provider, "1", claims)
+
+		mockStore.On("GetUserIdentity", mock.Anything, "fake", "sub-1").Return(nil, store.ErrIdentityNotFound)
+		mockStore.On("CreateUserIdentity", mock.Anything, mock.MatchedBy(func(identity *store.UserIdentity) bool {
+			return identity.UserID == "1" && identity.Subject == "sub-1" && *identity.Email == "alice@work.example"
+		})).Return(nil)
+
+		identity, err := service.CompleteOIDCLink(context.Background(), "1", "fake", state, code)
+		assert.NoError(t, err)
+		assert.Equal(t, "fake", identity.Provider)
+	})
+
+	t.Run("identity already linked", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, provider := newOIDCService(t, mockStore)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "alice"}, nil)
+		state, code := authorizeAtProvider(t, service, mockStore, provider, "1", claims)
+
+		mockStore.On("GetUserIdentity", mock.Anything, "fake", "sub-1").Return(&store.UserIdentity{ID: "id-1", UserID: "2"}, nil)
+
+		_, err := service.CompleteOIDCLink(context.Background(), "1", "fake", state, code)
+		assert.Equal(t, ErrIdentityLinked, err)
+	})
+
+	t.Run("request started by another user", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, provider := newOIDCService(t, mockStore)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "alice"}, nil)
+		state, code := authorizeAtProvider(t, service, mockStore, provider, "1", claims)
+
+		_, err := service.CompleteOIDCLink(context.Background(), "2", "fake", state, code)
+		assert.Equal(t, ErrInvalidOIDCState, err)
+	})
+
+	t.Run("expired request", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service, _ := newOIDCService(t, mockStore)
+		userID := "1"
+		mockStore.On("TakeOIDCAuthRequest", mock.Anything, hashToken("state")).Return(&store.OIDCAuthRequest{
+			Provider: "fake", UserID: &userID, ExpiresAt: time.Now().Add(-time.Minute),
+		}, nil)
+
+		_, err := service.CompleteOIDCLink(context.Background(), "1", "fake", "state", "code")
+		assert.Equal(t, ErrInvalidOIDCState, err)
+	})
+}
+
+func TestAuthService_DeleteIdentity(t *testing.T) {
+	identities := []store.UserIdentity{{ID: "id-1", UserID: "1", Provider: "fake"}}
+
+	tests := []struct {
+		name          string
+		identityID    string
+		passwordHash  string
+		passkeys      []store.WebAuthnCredential
+		expectedError error
+	}{
+		{name: "account keeps its password", identityID: "id-1", passwordHash: "hash"},
+		{name: "account keeps a passkey", identityID: "id-1", passkeys: []store.WebAuthnCredential{{ID: "pk-1"}}},
+		{name: "last way to sign in", identityID: "id-1", expectedError: ErrLastLoginMethod},
+		{name: "identity of another user", identityID: "id-2", passwordHash: "hash", expectedError: ErrIdentityNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &MockStore{}
+			service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+			mockStore.On("ListUserIdentities", mock.Anything, "1").Return(identities, nil)
+			mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", PasswordHash: tt.passwordHash}, nil)
+			mockStore.On("ListWebAuthnCredentials", mock.Anything, "1").Return(append([]store.WebAuthnCredential{}, tt.passkeys...), nil)
+			mockStore.On("DeleteUserIdentity", mock.Anything, tt.identityID, "1").Return(nil)
+
+			err := service.DeleteIdentity(context.Background(), "1", tt.identityID)
+			assert.Equal(t, tt.expectedError, err)
+			if tt.expectedError != nil {
+				mockStore.AssertNotCalled(t, "DeleteUserIdentity", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestSanitizeUsername(t *testing.T) {
+	tests := map[string]string{
+		"alice":                          "alice",
+		"Alice Smith":                    "AliceSmith",
+		"..alice_1..":                    "alice_1",
+		"Zoë":                            "Zo",
+		"a-very-long-username-from-idp!": "a-very-long-username-from",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, sanitizeUsername(in), in)
+	}
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/webauthn"
+)
+
+// defaultPasskeyName labels passkeys registered without a name
+const defaultPasskeyName = "Passkey"
+
+// Passkey is a registered WebAuthn credential as listed on the profile
+type Passkey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// PasskeyRegistration is a started registration ceremony. Options go to
+// navigator.credentials.create; the response comes back with SessionID.
+type PasskeyRegistration struct {
+	SessionID string
+	Options   webauthn.CreationOptions
+}
+
+// PasskeyLogin is a started login ceremony. Options go to
+// navigator.credentials.get; the response comes back with SessionID.
+type PasskeyLogin struct {
+	SessionID string
+	Options   webauthn.RequestOptions
+}
+
+// BeginPasskeyRegistration starts registering a new passkey for the user
+func (s *AuthService) BeginPasskeyRegistration(ctx context.Context, userID string) (*PasskeyRegistration, error) {
+	dbUser, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	creds, err := s.Store.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, challenge, err := s.newPasskeyChallenge(ctx, userID, store.CeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+
+	user := webauthn.UserEntity{ID: []byte(dbUser.ID), Name: dbUser.Username, DisplayName: dbUser.Username}
+	return &PasskeyRegistration{
+		SessionID: sessionID,
+		Options:   s.relyingParty().CreationOptions(challenge, user, credentialDescriptors(creds)),
+	}, nil
+}
+
+// FinishPasskeyRegistration verifies the authenticator's response to a
+// registration ceremony and stores the new passkey
+func (s *AuthService) FinishPasskeyRegistration(ctx context.Context, userID, sessionID, name string, resp *webauthn.RegistrationResponse) (*Passkey, error) {
+	pending, challenge, err := s.takePasskeyChallenge(ctx, sessionID, store.CeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if pending.UserID == nil || *pending.UserID != userID {
+		return nil, ErrInvalidPasskeyCeremony
+	}
+
+	cred, err := s.relyingParty().VerifyRegistration(challenge, resp)
+	if err != nil {
+		slog.Info("Rejected passkey registration", "user_id", userID, "error", err)
+		return nil, ErrInvalidPasskey
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(cred.ID)
+	if _, err := s.Store.GetWebAuthnCredential(ctx, credentialID); err == nil {
+		return nil, ErrPasskeyExists
+	} else if !errors.Is(err, store.ErrCredentialNotFound) {
+		return nil, err
+	}
+
+	if name = strings.TrimSpace(name); name == "" {
+		name = defaultPasskeyName
+	}
+	dbCred := &store.WebAuthnCredential{
+		ID:           generateID(),
+		UserID:       userID,
+		CredentialID: credentialID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    int64(cred.SignCount),
+		Transports:   strings.Join(cred.Transports, ","),
+		Name:         name,
+	}
+	if err := s.Store.CreateWebAuthnCredential(ctx, dbCred); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Passkey{ID: dbCred.ID, Name: name, Transports: cred.Transports, CreatedAt: &now}, nil
+}
+
+// BeginPasskeyLogin starts a passwordless login. With a username the
+// browser is limited to that account's passkeys; without one any
+// discoverable passkey for this site may answer.
+func (s *AuthService) BeginPasskeyLogin(ctx context.Context, username string) (*PasskeyLogin, error) {
+	var userID string
+	var allow []webauthn.CredentialDescriptor
+	if username != "" {
+		// Unknown usernames get the same empty allow list as accounts without
+		// passkeys, so the response does not reveal whether the account exists
+		if dbUser, err := s.Store.GetUserByUsername(ctx, username); err == nil {
+			creds, err := s.Store.ListWebAuthnCredentials(ctx, dbUser.ID)
+			if err != nil {
+				return nil, err
+			}
+			userID = dbUser.ID
+			allow = credentialDescriptors(creds)
+		}
+	}
+
+	sessionID, challenge, err := s.newPasskeyChallenge(ctx, userID, store.CeremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasskeyLogin{
+		SessionID: sessionID,
+		Options:   s.relyingParty().RequestOptions(challenge, allow),
+	}, nil
+}
+
+// FinishPasskeyLogin verifies an assertion and opens a session. Passkeys
+// require user verification, so they stand in for both the password and
+// the second factor.
+func (s *AuthService) FinishPasskeyLogin(ctx context.Context, sessionID string, resp *webauthn.AssertionResponse) (*AuthTokens, *User, error) {
+	pending, challenge, err := s.takePasskeyChallenge(ctx, sessionID, store.CeremonyLogin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dbCred, err := s.Store.GetWebAuthnCredential(ctx, base64.RawURLEncoding.EncodeToString(resp.RawID))
+	if err != nil {
+		if errors.Is(err, store.ErrCredentialNotFound) {
+			return nil, nil, ErrInvalidPasskey
+		}
+		return nil, nil, err
+	}
+	if pending.UserID != nil && *pending.UserID != dbCred.UserID {
+		return nil, nil, ErrInvalidPasskey
+	}
+	if len(resp.Response.UserHandle) > 0 && string(resp.Response.UserHandle) != dbCred.UserID {
+		return nil, nil, ErrInvalidPasskey
+	}
+
+	signCount, err := s.relyingParty().VerifyAssertion(challenge, resp, dbCred.PublicKey, uint32(dbCred.SignCount))
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCountRegression) {
+			slog.Warn("Passkey sign count went backwards; the authenticator may be cloned",
+				"user_id", dbCred.UserID, "passkey_id", dbCred.ID)
+		} else {
+			slog.Info("Rejected passkey login", "user_id", dbCred.UserID, "error", err)
+		}
+		return nil, nil, ErrInvalidPasskey
+	}
+
+	if err := s.Store.UpdateWebAuthnSignCount(ctx, dbCred.ID, dbCred.SignCount, int64(signCount)); err != nil {
+		if errors.Is(err, store.ErrSignCountChanged) {
+			return nil, nil, ErrInvalidPasskey
+		}
+		return nil, nil, err
+	}
+
+	dbUser, err := s.Store.GetUserByID(ctx, dbCred.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidPasskey
+	}
+
+	if err := s.requireVerifiedEmail(dbUser); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.createSession(ctx, dbUser.ID, dbUser.Username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, userFromStore(dbUser), nil
+}
+
+func (s *AuthService) ListPasskeys(ctx context.Context, userID string) ([]Passkey, error) {
+	creds, err := s.Store.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys := make([]Passkey, 0, len(creds))
+	for _, cred := range creds {
+		passkeys = append(passkeys, Passkey{
+			ID:         cred.ID,
+			Name:       cred.Name,
+			Transports: splitTransports(cred.Transports),
+			CreatedAt:  cred.CreatedAt,
+			LastUsedAt: cred.LastUsedAt,
+		})
+	}
+	return passkeys, nil
+}
+
+func (s *AuthService) DeletePasskey(ctx context.Context, userID, passkeyID string) error {
+	err := s.Store.DeleteWebAuthnCredential(ctx, passkeyID, userID)
+	if errors.Is(err, store.ErrCredentialNotFound) {
+		return ErrPasskeyNotFound
+	}
+	return err
+}
+
+func (s *AuthService) relyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:      s.Cfg.WebAuthnRPID,
+		Name:    s.Cfg.WebAuthnRPName,
+		Origins: s.Cfg.WebAuthnOrigins,
+		Timeout: time.Duration(s.Cfg.WebAuthnTimeout) * time.Minute,
+	}
+}
+
+// newPasskeyChallenge records a pending ceremony and returns its session id
+// and challenge. Expired ceremonies are cleared out on the way.
+func (s *AuthService) newPasskeyChallenge(ctx context.Context, userID, ceremony string) (string, []byte, error) {
+	if err := s.Store.CleanupExpiredWebAuthnChallenges(ctx); err != nil {
+		slog.Warn("Failed to clean up expired passkey challenges", "error", err)
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", nil, err
+	}
+
+	sessionID := generateID()
+	expiresAt := time.Now().Add(time.Duration(s.Cfg.WebAuthnTimeout) * time.Minute)
+	encoded := base64.RawURLEncoding.EncodeToString(challenge)
+	if err := s.Store.CreateWebAuthnChallenge(ctx, sessionID, userID, ceremony, encoded, expiresAt); err != nil {
+		return "", nil, err
+	}
+	return sessionID, challenge, nil
+}
+
+// takePasskeyChallenge consumes a pending ceremony, so a response can only
+// be submitted once, and returns it with its decoded challenge
+func (s *AuthService) takePasskeyChallenge(ctx context.Context, sessionID, ceremony string) (*store.WebAuthnChallenge, []byte, error) {
+	pending, err := s.Store.TakeWebAuthnChallenge(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, store.ErrChallengeNotFound) {
+			return nil, nil, ErrInvalidPasskeyCeremony
+		}
+		return nil, nil, err
+	}
+	if pending.Ceremony != ceremony || time.Now().After(pending.ExpiresAt) {
+		return nil, nil, ErrInvalidPasskeyCeremony
+	}
+
+	challenge, err := base64.RawURLEncoding.DecodeString(pending.Challenge)
+	if err != nil {
+		return nil, nil, ErrInvalidPasskeyCeremony
+	}
+	return pending, challenge, nil
+}
+
+func credentialDescriptors(creds []store.WebAuthnCredential) []webauthn.CredentialDescriptor {
+	descriptors := make([]webauthn.CredentialDescriptor, 0, len(creds))
+	for _, cred := range creds {
+		id, err := base64.RawURLEncoding.DecodeString(cred.CredentialID)
+		if err != nil {
+			continue
+		}
+		descriptors = append(descriptors, webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			ID:         id,
+			Transports: splitTransports(cred.Transports),
+		})
+	}
+	return descriptors
+}
+
+func splitTransports(transports string) []string {
+	if transports == "" {
+		return nil
+	}
+	return strings.Split(transports, ",")
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/mail"
+	"github.com/user/votex-template/backend/pkg/webauthn"
+	"github.com/user/votex-template/backend/pkg/webauthn/webauthntest"
+)
+
+const testOrigin = "http://localhost:5173"
+
+func newPasskeyService(mockStore *MockStore) *AuthService {
+	cfg := testConfig()
+	cfg.WebAuthnRPID = "localhost"
+	cfg.WebAuthnRPName = "Votex"
+	cfg.WebAuthnOrigins = []string{testOrigin}
+	cfg.WebAuthnTimeout = 5
+	return &AuthService{Store: mockStore, Cfg: cfg, EmailService: NewEmailService(cfg, &mail.Memory{}), Keys: testKeyring()}
+}
+
+// expectNewChallenge accepts the ceremony Begin* records and captures its
+// challenge so the test can hand it back from TakeWebAuthnChallenge
+func expectNewChallenge(mockStore *MockStore, userID, ceremony string) *string {
+	var challenge string
+	mockStore.On("CleanupExpiredWebAuthnChallenges", mock.Anything).Return(nil)
+	mockStore.On("CreateWebAuthnChallenge", mock.Anything, mock.AnythingOfType("string"), userID, ceremony, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+		Run(func(args mock.Arguments) { challenge = args.String(4) }).
+		Return(nil)
+	return &challenge
+}
+
+func expectTakeChallenge(mockStore *MockStore, sessionID, userID, ceremony, challenge string, expiresAt time.Time) {
+	pending := &store.WebAuthnChallenge{ID: sessionID, Ceremony: ceremony, Challenge: challenge, ExpiresAt: expiresAt}
+	if userID != "" {
+		pending.UserID = &userID
+	}
+	mockStore.On("TakeWebAuthnChallenge", mock.Anything, sessionID).Return(pending, nil).Once()
+}
+
+// registeredPasskey enrols a software authenticator directly against the
+// relying party and returns it with the row the store would hold
+func registeredPasskey(t *testing.T, service *AuthService) (*webauthntest.Authenticator, *store.WebAuthnCredential) {
+	t.Helper()
+	authenticator := webauthntest.New()
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatalf("failed to generate challenge: %v", err)
+	}
+
+	rp := service.relyingParty()
+	options := rp.CreationOptions(challenge, webauthn.UserEntity{ID: []byte("1"), Name: "testuser"}, nil)
+	cred, err := rp.VerifyRegistration(challenge, authenticator.Register(testOrigin, options))
+	if err != nil {
+		t.Fatalf("failed to register authenticator: %v", err)
+	}
+
+	return authenticator, &store.WebAuthnCredential{
+		ID:           "pk-1",
+		UserID:       "1",
+		CredentialID: base64.RawURLEncoding.EncodeToString(cred.ID),
+		PublicKey:    cred.PublicKey,
+		SignCount:    int64(cred.SignCount),
+		Name:         "Laptop",
+	}
+}
+
+func TestAuthService_PasskeyRegistration(t *testing.T) {
+	t.Run("registers a software authenticator", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newPasskeyService(mockStore)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(&store.User{ID: "1", Username: "testuser"}, nil)
+		mockStore.On("ListWebAuthnCredentials", mock.Anything, "1").Return([]store.WebAuthnCredential{}, nil)
+		challenge := expectNewChallenge(mockStore, "1", store.CeremonyRegistration)
+
+		registration, err := service.BeginPasskeyRegistration(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.Equal(t, "localhost", registration.Options.RP.ID)
+		assert.Equal(t, []byte("1"), []byte(registration.Options.User.ID))
+
+		authenticator := webauthntest.New()
+		resp := authenticator.Register(testOrigin, registration.Options)
+
+		var stored *store.WebAuthnCredential
+		expectTakeChallenge(mockStore, registration.SessionID, "1", store.CeremonyRegistration, *challenge, time.Now().Add(time.Minute))
+		mockStore.On("GetWebAuthnCredential", mock.Anything, resp.ID).Return(nil, store.ErrCredentialNotFound)
+		mockStore.On("CreateWebAuthnCredential", mock.Anything, mock.AnythingOfType("*store.WebAuthnCredential")).
+			Run(func(args mock.Arguments) { stored = args.Get(1).(*store.WebAuthnCredential) }).
+			Return(nil)
+
+		passkey, err := service.FinishPasskeyRegistration(context.Background(), "1", registration.SessionID, " Laptop ", resp)
+		assert.NoError(t, err)
+		assert.Equal(t, "Laptop", passkey.Name)
+		assert.Equal(t, []string{"internal"}, passkey.Transports)
+		assert.Equal(t, resp.ID, stored.CredentialID)
+		assert.NotEmpty(t, stored.PublicKey)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("ceremony started by another user", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newPasskeyService(mockStore)
+		expectTakeChallenge(mockStore, "session", "2", store.CeremonyRegistration, "abc", time.Now().Add(time.Minute))
+
+		_, err := service.FinishPasskeyRegistration(context.Background(), "1", "session", "", &webauthn.RegistrationResponse{})
+		assert.Equal(t, ErrInvalidPasskeyCeremony, err)
+		mockStore.AssertNotCalled(t, "CreateWebAuthnCredential")
+	})
+
+	t.Run("response to a different challenge", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newPasskeyService(mockStore)
+		challenge, _ := webauthn.NewChallenge()
+		other, _ := webauthn.NewChallenge()
+		expectTakeChallenge(mockStore, "session", "1", store.CeremonyRegistration, base64.RawURLEncoding.EncodeToString(challenge), time.Now().Add(time.Minute))
+
+		options := service.relyingParty().CreationOptions(other, webauthn.UserEntity{ID: []byte("1")}, nil)
+		resp := webauthntest.New().Register(testOrigin, options)
+
+		_, err := service.FinishPasskeyRegistration(context.Background(), "1", "session", "", resp)
+		assert.Equal(t, ErrInvalidPasskey, err)
+		mockStore.AssertNotCalled(t, "CreateWebAuthnCredential")
+	})
+}
+
+func TestAuthService_PasskeyLogin(t *testing.T) {
+	t.Run("signs in with a registered passkey", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newPasskeyService(mockStore)
+		authenticator, cred := registeredPasskey(t, service)
+		user := &store.User{ID: "1", Username: "testuser"}
+
+		mockStore.On("GetUserByUsername", mock.Anything, "testuser").Return(user, nil)
+		mockStore.On("ListWebAuthnCredentials", mock.Anything, "1").Return([]store.WebAuthnCredential{*cred}, nil)
+		challenge := expectNewChallenge(mockStore, "1", store.CeremonyLogin)
+
+		login, err := service.BeginPasskeyLogin(context.Background(), "testuser")
+		assert.NoError(t, err)
+		assert.Len(t, login.Options.AllowCredentials, 1)
+
+		resp := authenticator.Login(testOrigin, login.Options)
+		expectTakeChallenge(mockStore, login.SessionID, "1", store.CeremonyLogin, *challenge, time.Now().Add(time.Minute))
+		mockStore.On("GetWebAuthnCredential", mock.Anything, cred.CredentialID).Return(cred, nil)
+		mockStore.On("UpdateWebAuthnSignCount", mock.Anything, "pk-1", int64(0), int64(1)).Return(nil)
+		mockStore.On("GetUserByID", mock.Anything, "1").Return(user, nil)
+		mockStore.On("CreateSession", mock.Anything, mock.AnythingOfType("string"), "1", mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
+		expectTokenIssue(mockStore, "1")
+
+		tokens, loggedIn, err := service.FinishPasskeyLogin(context.Background(), login.SessionID, resp)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.Equal(t, "1", loggedIn.ID)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("unknown username looks like an account without passkeys", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newPasskeyService(mockStore)
+		mockStore.On("GetUserByUsername", mock.Anything, "nobody").Return(nil, store.ErrUserNotFound)
+		expectNewChallenge(mockStore, "", store.CeremonyLogin)
+
+		login, err := service.BeginPasskeyLogin(context.Background(), "nobody")
+		assert.NoError(t, err)
+		assert.Empty(t, login.Options.AllowCredentials)
+	})
+
+	// finish runs a login ceremony against a pending challenge set up by the caller
+	finish := func(t *testing.T, mockStore *MockStore, service *AuthService, authenticator *webauthntest.Authenticator, pendingUser, ceremony string, expiresAt time.Time) error {
+		challenge, _ := webauthn.NewChallenge()
+		encoded := base64.RawURLEncoding.EncodeToString(challenge)
+		expectTakeChallenge(mockStore, "session", pendingUser, ceremony, encoded, expiresAt)
+
+		resp := authenticator.Login(testOrigin, service.relyingParty().RequestOptions(challenge, nil))
+		_, _, err := service.FinishPasskeyLogin(context.Background(), "session", resp)
+		return err
+	}
+
+	t.Run("challenge already used", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newPasskeyService(mockStore)
+		mockStore.On("TakeWebAuthnChallenge", mock.Anything, "session").Return(nil, store.ErrChallengeNotFound)
+
+		_, _, err := service.FinishPasskeyLogin(context.Background(), "session", &webauthn.AssertionResponse{})
+		assert.Equal(t, ErrInvalidPasskeyCeremony, err)
+	})
+
+	t.Run("expired challenge", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newPasskeyService(mockStore)
+		authenticator, _ := registeredPasskey(t, service)
+
+		err := finish(t, mockStore, service, authenticator, "", store.CeremonyLogin, time.Now().Add(-time.Second))
+		assert.Equal(t, ErrInvalidPasskeyCeremony, err)
+	})
+
+	t.Run("registration challenge cannot log in", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newPasskeyService(mockStore)
+		authenticator, _ := registeredPasskey(t, service)
+
+		err := finish(t, mockStore, service, authenticator, "1", store.CeremonyRegistration, time.Now().Add(time.Minute))
+		assert.Equal(t, ErrInvalidPasskeyCeremony, err)
+	})
+
+	t.Run("passkey belongs to another account", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newPasskeyService(mockStore)
+		authenticator, cred := registeredPasskey(t, service)
+		mockStore.On("GetWebAuthnCredential", mock.Anything, cred.CredentialID).Return(cred, nil)
+
+		err := finish(t, mockStore, service, authenticator, "2", store.CeremonyLogin, time.Now().Add(time.Minute))
+		assert.Equal(t, ErrInvalidPasskey, err)
+		mockStore.AssertNotCalled(t, "CreateSession")
+	})
+
+	t.Run("cloned authenticator", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newPasskeyService(mockStore)
+		authenticator, cred := registeredPasskey(t, service)
+		cred.SignCount = 10
+		mockStore.On("GetWebAuthnCredential", mock.Anything, cred.CredentialID).Return(cred, nil)
+
+		err := finish(t, mockStore, service, authenticator, "", store.CeremonyLogin, time.Now().Add(time.Minute))
+		assert.Equal(t, ErrInvalidPasskey, err)
+		mockStore.AssertNotCalled(t, "UpdateWebAuthnSignCount")
+		mockStore.AssertNotCalled(t, "CreateSession")
+	})
+
+	t.Run("concurrent use of the same assertion", func(t *testing.T) {
+		mockStore := &MockStore{}
+		service := newPasskeyService(mockStore)
+		authenticator, cred := registeredPasskey(t, service)
+		mockStore.On("GetWebAuthnCredential", mock.Anything, cred.CredentialID).Return(cred, nil)
+		mockStore.On("UpdateWebAuthnSignCount", mock.Anything, "pk-1", int64(0), int64(1)).Return(store.ErrSignCountChanged)
+
+		err := finish(t, mockStore, service, authenticator, "", store.CeremonyLogin, time.Now().Add(time.Minute))
+		assert.Equal(t, ErrInvalidPasskey, err)
+		mockStore.AssertNotCalled(t, "CreateSession")
+	})
+}
+
+func TestAuthService_DeletePasskey(t *testing.T) {
+	mockStore := &MockStore{}
+	service := newPasskeyService(mockStore)
+	mockStore.On("DeleteWebAuthnCredential", mock.Anything, "pk-1", "1").Return(nil)
+	mockStore.On("DeleteWebAuthnCredential", mock.Anything, "pk-2", "1").Return(store.ErrCredentialNotFound)
+
+	assert.NoError(t, service.DeletePasskey(context.Background(), "1", "pk-1"))
+	assert.Equal(t, ErrPasskeyNotFound, service.DeletePasskey(context.Background(), "1", "pk-2"))
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/password"
+)
+
+// NewPasswordHasher hashes new passwords with the configured algorithm and
+// still accepts hashes made with the other one
+func NewPasswordHasher(cfg *config.Config) password.Hasher {
+	argon2id := password.Argon2id{
+		Memory:      uint32(cfg.Argon2Memory),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+	}
+	bcrypt := password.Bcrypt{Cost: cfg.BcryptCost}
+
+	if cfg.PasswordHash == "bcrypt" {
+		return password.New(bcrypt, argon2id)
+	}
+	return password.New(argon2id, bcrypt)
+}
+
+// passwords returns the service's hasher, falling back to the configured one
+func (s *AuthService) passwords() password.Hasher {
+	if s.PasswordHasher == nil {
+		return NewPasswordHasher(s.Cfg)
+	}
+	return s.PasswordHasher
+}
+
+// hashPassword hashes a new password for storage
+func (s *AuthService) hashPassword(plain string) (string, error) {
+	hash, err := s.passwords().Hash(plain)
+	if errors.Is(err, password.ErrTooLong) {
+		return "", ErrPasswordTooLong
+	}
+	return hash, err
+}
+
+// checkPassword reports whether plain is the user's password. A hash made
+// with outdated settings is replaced once the password is known; failing to
+// do so does not fail the login.
+func (s *AuthService) checkPassword(ctx context.Context, userID, plain, hash string) bool {
+	hasher := s.passwords()
+	ok, err := hasher.Verify(plain, hash)
+	if err != nil {
+		// Accounts created through passkeys or identity providers have no hash
+		if hash != "" {
+			slog.Warn("Failed to verify password hash", "user_id", userID, "error", err)
+		}
+		return false
+	}
+	if !ok || !hasher.NeedsRehash(hash) {
+		return ok
+	}
+
+	rehashed, err := hasher.Hash(plain)
+	if err == nil {
+		err = s.Store.UpdateUser(ctx, userID, map[string]interface{}{"password_hash": rehashed})
+	}
+	if err != nil {
+		slog.Warn("Failed to upgrade password hash", "user_id", userID, "error", err)
+	} else {
+		slog.Info("Upgraded password hash", "user_id", userID)
+	}
+	return true
+}
+
+// PasswordPolicyError lists the rules a new password breaks. It matches
+// ErrWeakPassword with errors.Is.
+type PasswordPolicyError struct {
+	Violations []password.Violation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return ErrWeakPassword.Error()
+}
+
+func (e *PasswordPolicyError) Is(target error) bool {
+	return target == ErrWeakPassword
+}
+
+// NewPasswordPolicy returns the configured rules for new passwords
+func NewPasswordPolicy(cfg *config.Config, breaches *password.BreachCorpus) password.Policy {
+	return password.Policy{
+		MinLength:      cfg.PasswordMinLength,
+		MinClasses:     cfg.PasswordMinClasses,
+		MinStrength:    cfg.PasswordMinStrength,
+		RejectUserInfo: cfg.PasswordRejectUserInfo,
+		Breaches:       breaches,
+	}
+}
+
+// LoadBreachedPasswords reads the configured breach corpus, or returns nil
+// when none is configured
+func LoadBreachedPasswords(cfg *config.Config) (*password.BreachCorpus, error) {
+	if cfg.PasswordBreachFile == "" {
+		return nil, nil
+	}
+	return password.LoadBreachCorpus(cfg.PasswordBreachFile)
+}
+
+// checkNewPassword returns a PasswordPolicyError when plain breaks the
+// password policy or, for an existing user, repeats their current password
+// (currentHash) or one of the ones before it. userInputs are the username
+// and email the password may not be built from.
+func (s *AuthService) checkNewPassword(ctx context.Context, userID, currentHash, plain string, userInputs ...string) error {
+	violations := NewPasswordPolicy(s.Cfg, s.BreachedPasswords).Check(plain, userInputs...)
+
+	if userID != "" && s.Cfg.PasswordHistory > 0 {
+		recent := []string{}
+		if s.Cfg.PasswordHistory > 1 {
+			history, err := s.Store.GetPasswordHistory(ctx, userID, s.Cfg.PasswordHistory-1)
+			if err != nil {
+				return err
+			}
+			recent = history
+		}
+		if currentHash != "" {
+			recent = append([]string{currentHash}, recent...)
+		}
+
+		for _, hash := range recent {
+			if ok, _ := s.passwords().Verify(plain, hash); ok {
+				violations = append(violations, password.Violation{
+					Rule:    password.RuleReused,
+					Message: "Password must not be one you have used recently",
+				})
+				break
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// rememberPassword adds the hash a user just replaced to their password
+// history, keeping as many as PASSWORD_HISTORY needs besides the current one
+func (s *AuthService) rememberPassword(ctx context.Context, tx store.StoreInterface, userID, oldHash string) error {
+	keep := s.Cfg.PasswordHistory - 1
+	if keep <= 0 {
+		return nil
+	}
+	if oldHash != "" {
+		if err := tx.AddPasswordHistory(ctx, userID, oldHash); err != nil {
+			return err
+		}
+	}
+	return tx.PrunePasswordHistory(ctx, userID, keep)
+}
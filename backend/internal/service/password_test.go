@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/votex-template/backend/internal/config"
+	"github.com/user/votex-template/backend/internal/store"
+	"github.com/user/votex-template/backend/pkg/mail"
+	"github.com/user/votex-template/backend/pkg/password"
+)
+
+// argon2idConfig is testConfig hashing with Argon2id
+func argon2idConfig() *config.Config {
+	cfg := testConfig()
+	cfg.PasswordHash = "argon2id"
+	return cfg
+}
+
+func TestAuthService_LoginRehash(t *testing.T) {
+	login := func(t *testing.T, mockStore *MockStore, passwordHash string) {
+		t.Helper()
+		service := &AuthService{Store: mockStore, Cfg: argon2idConfig(), Keys: testKeyring()}
+
+		user := &store.User{ID: "1", Username: "alice", PasswordHash: passwordHash}
+		mockStore.On("GetUserByUsername", mock.Anything, "alice").Return(user, nil)
+		mockStore.On("GetUserMFA", mock.Anything, "1").Return(nil, store.ErrMFANotFound)
+		mockStore.On("CreateSession", mock.Anything, mock.Anything, "1", mock.Anything, mock.Anything).Return(nil)
+		expectTokenIssue(mockStore, "1")
+		expectLoginThrottle(mockStore)
+
+		tokens, _, err := service.Login(context.Background(), "alice", "password123", "192.0.2.1")
+		assert.NoError(t, err)
+		assert.NotNil(t, tokens)
+	}
+
+	t.Run("a legacy bcrypt hash is upgraded", func(t *testing.T) {
+		mockStore := new(MockStore)
+		mockStore.On("UpdateUser", mock.Anything, "1", mock.MatchedBy(func(updates map[string]interface{}) bool {
+			hash, _ := updates["password_hash"].(string)
+			return strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$")
+		})).Return(nil)
+
+		login(t, mockStore, mustHash(t, "password123"))
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("a hash with outdated parameters is upgraded", func(t *testing.T) {
+		cfg := argon2idConfig()
+		cfg.Argon2Memory = 512
+		hash, err := NewPasswordHasher(cfg).Hash("password123")
+		assert.NoError(t, err)
+
+		mockStore := new(MockStore)
+		mockStore.On("UpdateUser", mock.Anything, "1", mock.Anything).Return(nil)
+
+		login(t, mockStore, hash)
+		mockStore.AssertCalled(t, "UpdateUser", mock.Anything, "1", mock.Anything)
+	})
+
+	t.Run("a current hash is kept", func(t *testing.T) {
+		hash, err := NewPasswordHasher(argon2idConfig()).Hash("password123")
+		assert.NoError(t, err)
+
+		mockStore := new(MockStore)
+		login(t, mockStore, hash)
+		mockStore.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("a failed upgrade does not fail the login", func(t *testing.T) {
+		mockStore := new(MockStore)
+		mockStore.On("UpdateUser", mock.Anything, "1", mock.Anything).Return(assert.AnError)
+
+		login(t, mockStore, mustHash(t, "password123"))
+	})
+}
+
+func TestAuthService_RegisterPasswordLength(t *testing.T) {
+	long := strings.Repeat("p", 100)
+
+	t.Run("argon2id takes passwords past 72 bytes", func(t *testing.T) {
+		mockStore := new(MockStore)
+		cfg := argon2idConfig()
+		service := &AuthService{Store: mockStore, Cfg: cfg, EmailService: NewEmailService(cfg, &mail.Memory{}), Keys: testKeyring()}
+
+		var stored string
+		mockStore.On("GetUserByUsername", mock.Anything, "alice").Return(nil, store.ErrUserNotFound)
+		mockStore.On("CreateUser", mock.Anything, mock.Anything, "alice", "", mock.Anything).
+			Run(func(args mock.Arguments) { stored = args.String(4) }).
+			Return(nil)
+		mockStore.On("AssignRole", mock.Anything, mock.Anything, "user").Return(nil)
+		mockStore.On("ClaimAdminBootstrap", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+		mockStore.On("CreateSession", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		mockStore.On("GetUserRoles", mock.Anything, mock.Anything).Return([]string{"user"}, nil)
+		mockStore.On("GetUserPermissions", mock.Anything, mock.Anything).Return([]string{}, nil)
+
+		_, _, err := service.Register(context.Background(), "alice", "", long)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(stored, "$argon2id$"), "stored %q", stored)
+
+		ok, err := NewPasswordHasher(cfg).Verify(long, stored)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("bcrypt refuses them", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service := &AuthService{Store: mockStore, Cfg: testConfig(), Keys: testKeyring()}
+
+		mockStore.On("GetUserByUsername", mock.Anything, "alice").Return(nil, store.ErrUserNotFound)
+
+		_, _, err := service.Register(context.Background(), "alice", "", long)
+		assert.Equal(t, ErrPasswordTooLong, err)
+		mockStore.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+// policyConfig is testConfig with the default password policy
+func policyConfig() *config.Config {
+	cfg := testConfig()
+	cfg.PasswordMinLength = 8
+	cfg.PasswordMinStrength = 2
+	cfg.PasswordRejectUserInfo = true
+	cfg.PasswordHistory = 3
+	return cfg
+}
+
+// violatedRules returns the rules err reports as broken
+func violatedRules(t *testing.T, err error) []string {
+	t.Helper()
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected a PasswordPolicyError, got %v", err)
+	}
+	assert.ErrorIs(t, err, ErrWeakPassword)
+
+	var rules []string
+	for _, violation := range policyErr.Violations {
+		rules = append(rules, violation.Rule)
+	}
+	return rules
+}
+
+func TestAuthService_RegisterPasswordPolicy(t *testing.T) {
+	sum := sha1.Sum([]byte("kX9#mq2!vLp7"))
+	breaches, err := password.ReadBreachCorpus(strings.NewReader(hex.EncodeToString(sum[:]) + ":42\n"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		password string
+		rules    []string
+	}{
+		{name: "common password", password: "password123", rules: []string{password.RuleStrength}},
+		{name: "contains the username", password: "Alice-7#qPz!", rules: []string{password.RuleUserInfo}},
+		{name: "breached password", password: "kX9#mq2!vLp7", rules: []string{password.RuleBreached}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := new(MockStore)
+			service := &AuthService{Store: mockStore, Cfg: policyConfig(), Keys: testKeyring(), BreachedPasswords: breaches}
+
+			mockStore.On("GetUserByUsername", mock.Anything, "alice").Return(nil, store.ErrUserNotFound)
+			mockStore.On("GetUserByEmail", mock.Anything, "alice@example.com").Return(nil, store.ErrUserNotFound)
+
+			_, _, err := service.Register(context.Background(), "alice", "alice@example.com", tt.password)
+			assert.Equal(t, tt.rules, violatedRules(t, err))
+			mockStore.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestAuthService_ResetPasswordHistory(t *testing.T) {
+	current := mustHash(t, "Current#Pass91")
+	previous := mustHash(t, "Previous#Pass82")
+
+	setup := func(mockStore *MockStore) *AuthService {
+		resetToken := &store.PasswordResetToken{ID: "reset-1", UserID: "1", ExpiresAt: time.Now().Add(time.Hour)}
+		email := "alice@example.com"
+		mockStore.On("GetPasswordResetToken", mock.Anything, "reset-token").Return(resetToken, nil)
+		mockStore.On("GetUserByID", mock.Anything, "1").
+			Return(&store.User{ID: "1", Username: "alice", Email: &email, PasswordHash: current}, nil)
+		mockStore.On("GetPasswordHistory", mock.Anything, "1", 2).Return([]string{previous}, nil)
+		return &AuthService{Store: mockStore, Cfg: policyConfig(), Keys: testKeyring()}
+	}
+
+	for _, reused := range []string{"Current#Pass91", "Previous#Pass82"} {
+		t.Run("reusing "+reused, func(t *testing.T) {
+			mockStore := new(MockStore)
+			service := setup(mockStore)
+
+			err := service.ResetPassword(context.Background(), "reset-token", reused)
+			assert.Equal(t, []string{password.RuleReused}, violatedRules(t, err))
+			mockStore.AssertNotCalled(t, "MarkPasswordResetTokenUsed", mock.Anything, mock.Anything)
+		})
+	}
+
+	t.Run("a new password replaces the current one in the history", func(t *testing.T) {
+		mockStore := new(MockStore)
+		service := setup(mockStore)
+		mockStore.On("MarkPasswordResetTokenUsed", mock.Anything, "reset-1").Return(nil)
+		mockStore.On("UpdateUser", mock.Anything, "1", mock.Anything).Return(nil)
+		mockStore.On("AddPasswordHistory", mock.Anything, "1", current).Return(nil)
+		mockStore.On("PrunePasswordHistory", mock.Anything, "1", 2).Return(nil)
+		mockStore.On("DeleteUserSessions", mock.Anything, "1").Return(nil)
+
+		err := service.ResetPassword(context.Background(), "reset-token", "Fresh#Pass73q")
+		assert.NoError(t, err)
+		mockStore.AssertExpectations(t)
+	})
+}
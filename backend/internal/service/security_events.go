@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Security event types
+const (
+	SecurityEventLoginLocked   = "login.locked"
+	SecurityEventLoginUnlocked = "login.unlocked"
+)
+
+// SecurityEvent is a structured record of something worth alerting on, such
+// as an account being locked after repeated failed logins
+type SecurityEvent struct {
+	Type     string
+	Time     time.Time
+	UserID   string // empty when the event is not tied to a known account
+	Username string
+	IP       string
+	Details  map[string]any
+}
+
+// SecurityEventSink receives security events
+type SecurityEventSink interface {
+	Emit(ctx context.Context, event SecurityEvent)
+}
+
+// LogSecurityEvents writes security events to the default logger at warn
+// level, with a fixed message so log pipelines can route them
+type LogSecurityEvents struct{}
+
+func (LogSecurityEvents) Emit(ctx context.Context, event SecurityEvent) {
+	attrs := []slog.Attr{
+		slog.String("event", event.Type),
+		slog.Time("time", event.Time),
+	}
+	if event.UserID != "" {
+		attrs = append(attrs, slog.String("user_id", event.UserID))
+	}
+	if event.Username != "" {
+		attrs = append(attrs, slog.String("username", event.Username))
+	}
+	if event.IP != "" {
+		attrs = append(attrs, slog.String("ip", event.IP))
+	}
+	for key, value := range event.Details {
+		attrs = append(attrs, slog.Any(key, value))
+	}
+	slog.LogAttrs(ctx, slog.LevelWarn, "Security event", slog.Attr{Key: "security", Value: slog.GroupValue(attrs...)})
+}
+
+// emitSecurityEvent stamps and sends an event, logging it when no sink is
+// configured
+func (s *AuthService) emitSecurityEvent(ctx context.Context, event SecurityEvent) {
+	event.Time = time.Now()
+	if s.Events == nil {
+		LogSecurityEvents{}.Emit(ctx, event)
+		return
+	}
+	s.Events.Emit(ctx, event)
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// APIKeyTokenPrefix starts every API key, which tells them apart from
+// access tokens in an Authorization header and makes leaked keys easy to
+// find with secret scanners
+const APIKeyTokenPrefix = "vtx_"
+
+// APIKey is a long-lived credential for scripts and CI jobs. TokenHash is
+// the SHA-256 hex digest of the key and Scopes a space separated list of the
+// permissions it may use.
+type APIKey struct {
+	ID         string     `db:"id"`
+	UserID     string     `db:"user_id"`
+	Name       string     `db:"name"`
+	Prefix     string     `db:"prefix"`
+	TokenHash  string     `db:"token_hash"`
+	Scopes     string     `db:"scopes"`
+	ExpiresAt  *time.Time `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	LastUsedIP *string    `db:"last_used_ip"`
+	CreatedAt  *time.Time `db:"created_at"`
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, token_hash, scopes, expires_at, last_used_at, last_used_ip, created_at`
+
+func (s *Store) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	var expiresAt interface{}
+	if key.ExpiresAt != nil {
+		expiresAt = s.Dialect.TimeArg(*key.ExpiresAt)
+	}
+	query := `INSERT INTO api_key (id, user_id, name, prefix, token_hash, scopes, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ` + s.Dialect.Now() + `)`
+	_, err := s.exec(ctx, query, key.ID, key.UserID, key.Name, key.Prefix, key.TokenHash, key.Scopes, expiresAt)
+	return err
+}
+
+// GetAPIKeyByHash looks a key up by its digest. Expiry is left to the caller.
+func (s *Store) GetAPIKeyByHash(ctx context.Context, tokenHash string) (*APIKey, error) {
+	var key APIKey
+	query := `SELECT ` + apiKeyColumns + ` FROM api_key WHERE token_hash = ?`
+	if err := s.get(ctx, &key, query, tokenHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *Store) ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	keys := []APIKey{}
+	query := `SELECT ` + apiKeyColumns + ` FROM api_key WHERE user_id = ? ORDER BY created_at, id`
+	if err := s.selectInto(ctx, &keys, query, userID); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// TouchAPIKey records when and from where a key was last used
+func (s *Store) TouchAPIKey(ctx context.Context, id, ip string) error {
+	query := `UPDATE api_key SET last_used_at = ` + s.Dialect.Now() + `, last_used_ip = ? WHERE id = ?`
+	_, err := s.exec(ctx, query, ip, id)
+	return err
+}
+
+// DeleteAPIKey revokes one of the user's keys
+func (s *Store) DeleteAPIKey(ctx context.Context, id, userID string) error {
+	result, err := s.exec(ctx, `DELETE FROM api_key WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// DeleteUserAPIKeys revokes every key the user holds
+func (s *Store) DeleteUserAPIKeys(ctx context.Context, userID string) error {
+	_, err := s.exec(ctx, `DELETE FROM api_key WHERE user_id = ?`, userID)
+	return err
+}
+
+func (m *MockStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) GetAPIKeyByHash(ctx context.Context, tokenHash string) (*APIKey, error) {
+	// Mock implementation - no keys are issued
+	return nil, ErrAPIKeyNotFound
+}
+
+func (m *MockStore) ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	// Mock implementation - no keys are issued
+	return []APIKey{}, nil
+}
+
+func (m *MockStore) TouchAPIKey(ctx context.Context, id, ip string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) DeleteAPIKey(ctx context.Context, id, userID string) error {
+	// Mock implementation - no keys are issued
+	return ErrAPIKeyNotFound
+}
+
+func (m *MockStore) DeleteUserAPIKeys(ctx context.Context, userID string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
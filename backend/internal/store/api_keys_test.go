@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStore_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := s.CreateUser(ctx, "user-2", "bob", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	expiresAt := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	for _, key := range []*APIKey{
+		{ID: "key-1", UserID: "user-1", Name: "CI", Prefix: "vtx_abcd", TokenHash: "hash-1", Scopes: "users:read", ExpiresAt: &expiresAt},
+		{ID: "key-2", UserID: "user-1", Name: "Backup script", Prefix: "vtx_efgh", TokenHash: "hash-2"},
+	} {
+		if err := s.CreateAPIKey(ctx, key); err != nil {
+			t.Fatalf("failed to create api key: %v", err)
+		}
+	}
+
+	got, err := s.GetAPIKeyByHash(ctx, "hash-1")
+	if err != nil {
+		t.Fatalf("failed to get api key: %v", err)
+	}
+	if got.UserID != "user-1" || got.Scopes != "users:read" || got.ExpiresAt == nil || !got.ExpiresAt.Equal(expiresAt) || got.LastUsedAt != nil {
+		t.Errorf("unexpected api key: %+v", got)
+	}
+	if _, err := s.GetAPIKeyByHash(ctx, "unknown"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected ErrAPIKeyNotFound, got %v", err)
+	}
+
+	if err := s.TouchAPIKey(ctx, "key-2", "203.0.113.7"); err != nil {
+		t.Fatalf("failed to touch api key: %v", err)
+	}
+	keys, err := s.ListAPIKeys(ctx, "user-1")
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("expected two keys, got %d (%v)", len(keys), err)
+	}
+	for _, key := range keys {
+		if key.ID == "key-2" && (key.LastUsedAt == nil || key.LastUsedIP == nil || *key.LastUsedIP != "203.0.113.7") {
+			t.Errorf("expected last use to be recorded, got %+v", key)
+		}
+	}
+
+	// Users can only revoke their own keys
+	if err := s.DeleteAPIKey(ctx, "key-1", "user-2"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected ErrAPIKeyNotFound, got %v", err)
+	}
+	if err := s.DeleteAPIKey(ctx, "key-1", "user-1"); err != nil {
+		t.Fatalf("failed to delete api key: %v", err)
+	}
+	if _, err := s.GetAPIKeyByHash(ctx, "hash-1"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected the key to be revoked, got %v", err)
+	}
+
+	// Keys go away with their owner
+	if err := s.DeleteUser(ctx, "user-1"); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	if keys, _ := s.ListAPIKeys(ctx, "user-1"); len(keys) != 0 {
+		t.Errorf("expected keys to be deleted with the user, got %+v", keys)
+	}
+}
+
+func TestStore_DeleteUserAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	for _, user := range [][2]string{{"user-1", "alice"}, {"user-2", "bob"}} {
+		if err := s.CreateUser(ctx, user[0], user[1], "", "hash"); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	for _, key := range []*APIKey{
+		{ID: "key-1", UserID: "user-1", Name: "CI", Prefix: "vtx_abcd", TokenHash: "hash-1"},
+		{ID: "key-2", UserID: "user-1", Name: "Backup script", Prefix: "vtx_efgh", TokenHash: "hash-2"},
+		{ID: "key-3", UserID: "user-2", Name: "CI", Prefix: "vtx_ijkl", TokenHash: "hash-3"},
+	} {
+		if err := s.CreateAPIKey(ctx, key); err != nil {
+			t.Fatalf("failed to create api key: %v", err)
+		}
+	}
+
+	if err := s.DeleteUserAPIKeys(ctx, "user-1"); err != nil {
+		t.Fatalf("failed to delete api keys: %v", err)
+	}
+	if keys, _ := s.ListAPIKeys(ctx, "user-1"); len(keys) != 0 {
+		t.Errorf("expected every key of the user to be revoked, got %+v", keys)
+	}
+	// Other users keep theirs
+	if keys, _ := s.ListAPIKeys(ctx, "user-2"); len(keys) != 1 {
+		t.Errorf("expected the other user's key to remain, got %+v", keys)
+	}
+}
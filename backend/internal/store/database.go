@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
@@ -35,17 +36,23 @@ func connectSQLite(sqlitePath string) (*sqlx.DB, bool, error) {
 		return nil, false, fmt.Errorf("failed to create directory for SQLite database: %w", err)
 	}
 
-	// Connect to SQLite
-	db, err := sqlx.Connect("sqlite", sqlitePath)
+	// Connect to SQLite. Pragmas are set through the DSN so they apply to
+	// every pooled connection, and transactions take the write lock up front
+	// so concurrent WithTx calls wait on busy_timeout instead of deadlocking.
+	db, err := sqlx.Connect("sqlite", sqliteDSN(sqlitePath))
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to connect to SQLite database: %w", err)
 	}
 
-	// Enable foreign keys
-	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
-		return nil, false, fmt.Errorf("failed to enable foreign keys: %w", err)
-	}
-
 	slog.Info("Connected to SQLite database", "path", sqlitePath)
 	return db, true, nil
 }
+
+// sqliteDSN appends the connection options the store relies on to a SQLite path
+func sqliteDSN(sqlitePath string) string {
+	sep := "?"
+	if strings.Contains(sqlitePath, "?") {
+		sep = "&"
+	}
+	return sqlitePath + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect captures the SQL differences between the database backends the
+// store runs on. Queries are written once using ? placeholders and the
+// expressions below, then rebound for the active backend before execution.
+type Dialect interface {
+	// Name identifies the backend, e.g. "postgres" or "sqlite"
+	Name() string
+
+	// Rebind rewrites ? placeholders into the backend's bind variable syntax
+	Rebind(query string) string
+
+	// Now is an SQL expression evaluating to the current timestamp
+	Now() string
+
+	// Upsert is appended to an INSERT to resolve a conflict on conflictColumns.
+	// The listed updateColumns take the incoming values; with none given the
+	// existing row is left untouched.
+	Upsert(conflictColumns []string, updateColumns ...string) string
+
+	// Returning is appended to an INSERT, UPDATE or DELETE to get columns of
+	// the affected rows back. It is empty when the backend has no such clause.
+	Returning(columns ...string) string
+
+	// TimeArg converts a timestamp into a bind value that compares correctly
+	// against values stored by Now
+	TimeArg(t time.Time) interface{}
+}
+
+// Built-in dialects for the backends ConnectDatabase can open
+var (
+	PostgresDialect Dialect = postgresDialect{}
+	SQLiteDialect   Dialect = sqliteDialect{}
+)
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) Rebind(query string) string { return sqlx.Rebind(sqlx.DOLLAR, query) }
+
+func (postgresDialect) Now() string { return "NOW()" }
+
+func (postgresDialect) Upsert(conflictColumns []string, updateColumns ...string) string {
+	return onConflict(conflictColumns, updateColumns)
+}
+
+func (postgresDialect) Returning(columns ...string) string {
+	return " RETURNING " + strings.Join(columns, ", ")
+}
+
+func (postgresDialect) TimeArg(t time.Time) interface{} { return t }
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) Rebind(query string) string { return query }
+
+func (sqliteDialect) Now() string { return "datetime('now')" }
+
+func (sqliteDialect) Upsert(conflictColumns []string, updateColumns ...string) string {
+	return onConflict(conflictColumns, updateColumns)
+}
+
+func (sqliteDialect) Returning(columns ...string) string {
+	return " RETURNING " + strings.Join(columns, ", ")
+}
+
+// TimeArg formats timestamps the way datetime('now') does. SQLite keeps
+// DATETIME columns as text and compares them as strings, so every bound
+// timestamp has to share that layout and be in UTC.
+func (sqliteDialect) TimeArg(t time.Time) interface{} {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// onConflict builds the ON CONFLICT clause shared by PostgreSQL and SQLite
+func onConflict(conflictColumns, updateColumns []string) string {
+	target := ""
+	if len(conflictColumns) > 0 {
+		target = " (" + strings.Join(conflictColumns, ", ") + ")"
+	}
+	if len(updateColumns) == 0 {
+		return " ON CONFLICT" + target + " DO NOTHING"
+	}
+
+	sets := make([]string, len(updateColumns))
+	for i, column := range updateColumns {
+		sets[i] = column + " = excluded." + column
+	}
+	return " ON CONFLICT" + target + " DO UPDATE SET " + strings.Join(sets, ", ")
+}
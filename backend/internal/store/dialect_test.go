@@ -0,0 +1,61 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDialect_Rebind(t *testing.T) {
+	query := `SELECT id FROM "user" WHERE username = ? AND age > ? AND email = ? AND id IN (?, ?, ?, ?, ?, ?, ?)`
+
+	if got := SQLiteDialect.Rebind(query); got != query {
+		t.Errorf("sqlite rebind changed query: %s", got)
+	}
+
+	want := `SELECT id FROM "user" WHERE username = $1 AND age > $2 AND email = $3 AND id IN ($4, $5, $6, $7, $8, $9, $10)`
+	if got := PostgresDialect.Rebind(query); got != want {
+		t.Errorf("postgres rebind:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestDialect_Upsert(t *testing.T) {
+	tests := []struct {
+		name     string
+		conflict []string
+		updates  []string
+		want     string
+	}{
+		{"do nothing", []string{"user_id", "role_name"}, nil, " ON CONFLICT (user_id, role_name) DO NOTHING"},
+		{"any conflict", nil, nil, " ON CONFLICT DO NOTHING"},
+		{"update columns", []string{"id"}, []string{"name", "updated_at"}, " ON CONFLICT (id) DO UPDATE SET name = excluded.name, updated_at = excluded.updated_at"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, d := range []Dialect{PostgresDialect, SQLiteDialect} {
+				if got := d.Upsert(tt.conflict, tt.updates...); got != tt.want {
+					t.Errorf("%s: got %q, want %q", d.Name(), got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDialect_Returning(t *testing.T) {
+	for _, d := range []Dialect{PostgresDialect, SQLiteDialect} {
+		if got := d.Returning("id", "user_id"); got != " RETURNING id, user_id" {
+			t.Errorf("%s: got %q", d.Name(), got)
+		}
+	}
+}
+
+func TestDialect_TimeArg(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 9, 30, 15, 500, time.FixedZone("EST", -5*60*60))
+
+	if got := SQLiteDialect.TimeArg(ts); got != "2024-03-01 14:30:15" {
+		t.Errorf("sqlite: got %v", got)
+	}
+	if got, ok := PostgresDialect.TimeArg(ts).(time.Time); !ok || !got.Equal(ts) {
+		t.Errorf("postgres: got %v", got)
+	}
+}
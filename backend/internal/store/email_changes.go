@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// EmailChange is a request to move a user to NewEmail. It only takes effect
+// once confirmed from the new address, and can be reverted from OldEmail
+// until RevertExpiresAt. Token hashes are SHA-256 hex digests.
+type EmailChange struct {
+	ID               string     `db:"id"`
+	UserID           string     `db:"user_id"`
+	OldEmail         *string    `db:"old_email"`
+	NewEmail         string     `db:"new_email"`
+	ConfirmTokenHash string     `db:"confirm_token_hash"`
+	RevertTokenHash  *string    `db:"revert_token_hash"`
+	ExpiresAt        time.Time  `db:"expires_at"`
+	RevertExpiresAt  time.Time  `db:"revert_expires_at"`
+	ConfirmedAt      *time.Time `db:"confirmed_at"`
+	RevertedAt       *time.Time `db:"reverted_at"`
+	CreatedAt        *time.Time `db:"created_at"`
+}
+
+const emailChangeColumns = `id, user_id, old_email, new_email, confirm_token_hash, revert_token_hash, expires_at, revert_expires_at, confirmed_at, reverted_at, created_at`
+
+func (s *Store) CreateEmailChange(ctx context.Context, change *EmailChange) error {
+	query := `INSERT INTO email_change (id, user_id, old_email, new_email, confirm_token_hash, revert_token_hash, expires_at, revert_expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ` + s.Dialect.Now() + `)`
+	_, err := s.exec(ctx, query, change.ID, change.UserID, change.OldEmail, change.NewEmail, change.ConfirmTokenHash,
+		change.RevertTokenHash, s.Dialect.TimeArg(change.ExpiresAt), s.Dialect.TimeArg(change.RevertExpiresAt))
+	return err
+}
+
+// GetEmailChangeByConfirmHash looks a change up by the digest of the token
+// sent to the new address
+func (s *Store) GetEmailChangeByConfirmHash(ctx context.Context, tokenHash string) (*EmailChange, error) {
+	return s.getEmailChange(ctx, `confirm_token_hash = ?`, tokenHash)
+}
+
+// GetEmailChangeByRevertHash looks a change up by the digest of the token
+// sent to the old address
+func (s *Store) GetEmailChangeByRevertHash(ctx context.Context, tokenHash string) (*EmailChange, error) {
+	return s.getEmailChange(ctx, `revert_token_hash = ?`, tokenHash)
+}
+
+func (s *Store) getEmailChange(ctx context.Context, where string, arg interface{}) (*EmailChange, error) {
+	var change EmailChange
+	query := `SELECT ` + emailChangeColumns + ` FROM email_change WHERE ` + where
+	if err := s.get(ctx, &change, query, arg); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEmailChangeNotFound
+		}
+		return nil, err
+	}
+	return &change, nil
+}
+
+// CancelPendingEmailChanges drops the user's unconfirmed changes, so only
+// the latest request can be confirmed
+func (s *Store) CancelPendingEmailChanges(ctx context.Context, userID string) error {
+	query := `DELETE FROM email_change WHERE user_id = ? AND confirmed_at IS NULL AND reverted_at IS NULL`
+	_, err := s.exec(ctx, query, userID)
+	return err
+}
+
+// ConfirmEmailChange marks a change confirmed. Only a change that has been
+// neither confirmed nor reverted can be, so a link works once.
+func (s *Store) ConfirmEmailChange(ctx context.Context, id string) error {
+	query := `UPDATE email_change SET confirmed_at = ` + s.Dialect.Now() + `
+		WHERE id = ? AND confirmed_at IS NULL AND reverted_at IS NULL`
+	return s.updateEmailChange(ctx, query, id)
+}
+
+// RevertEmailChange marks a change reverted, whether or not it was confirmed
+func (s *Store) RevertEmailChange(ctx context.Context, id string) error {
+	query := `UPDATE email_change SET reverted_at = ` + s.Dialect.Now() + ` WHERE id = ? AND reverted_at IS NULL`
+	return s.updateEmailChange(ctx, query, id)
+}
+
+func (s *Store) updateEmailChange(ctx context.Context, query, id string) error {
+	result, err := s.exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrEmailChangeNotFound
+	}
+	return nil
+}
+
+// ChangeUserEmail moves the user to an address they have just proven they
+// own, so it is stored as verified
+func (s *Store) ChangeUserEmail(ctx context.Context, userID, email string) error {
+	now := s.Dialect.Now()
+	query := `UPDATE "user" SET email = ?, email_verified_at = ` + now + `, updated_at = ` + now + ` WHERE id = ?`
+	result, err := s.exec(ctx, query, email, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredEmailChanges removes changes that can no longer be confirmed
+// or reverted
+func (s *Store) DeleteExpiredEmailChanges(ctx context.Context) error {
+	_, err := s.exec(ctx, `DELETE FROM email_change WHERE revert_expires_at < ?`, s.Dialect.TimeArg(time.Now()))
+	return err
+}
+
+func (m *MockStore) CreateEmailChange(ctx context.Context, change *EmailChange) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) GetEmailChangeByConfirmHash(ctx context.Context, tokenHash string) (*EmailChange, error) {
+	// Mock implementation - no changes are pending
+	return nil, ErrEmailChangeNotFound
+}
+
+func (m *MockStore) GetEmailChangeByRevertHash(ctx context.Context, tokenHash string) (*EmailChange, error) {
+	// Mock implementation - no changes are pending
+	return nil, ErrEmailChangeNotFound
+}
+
+func (m *MockStore) CancelPendingEmailChanges(ctx context.Context, userID string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) ConfirmEmailChange(ctx context.Context, id string) error {
+	// Mock implementation - no changes are pending
+	return ErrEmailChangeNotFound
+}
+
+func (m *MockStore) RevertEmailChange(ctx context.Context, id string) error {
+	// Mock implementation - no changes are pending
+	return ErrEmailChangeNotFound
+}
+
+func (m *MockStore) ChangeUserEmail(ctx context.Context, userID, email string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) DeleteExpiredEmailChanges(ctx context.Context) error {
+	// Mock implementation - always succeeds
+	return nil
+}
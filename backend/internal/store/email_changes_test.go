@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStore_EmailChanges(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "alice@example.com", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	oldEmail := "alice@example.com"
+	revertHash := "revert-1"
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, change := range []*EmailChange{
+		{ID: "change-1", UserID: "user-1", OldEmail: &oldEmail, NewEmail: "first@example.com", ConfirmTokenHash: "confirm-1",
+			RevertTokenHash: &revertHash, ExpiresAt: now.Add(time.Hour), RevertExpiresAt: now.Add(24 * time.Hour)},
+		{ID: "change-2", UserID: "user-1", NewEmail: "second@example.com", ConfirmTokenHash: "confirm-2",
+			ExpiresAt: now.Add(-2 * time.Hour), RevertExpiresAt: now.Add(-time.Hour)},
+	} {
+		if err := s.CreateEmailChange(ctx, change); err != nil {
+			t.Fatalf("failed to create email change: %v", err)
+		}
+	}
+
+	got, err := s.GetEmailChangeByConfirmHash(ctx, "confirm-1")
+	if err != nil {
+		t.Fatalf("failed to get email change: %v", err)
+	}
+	if got.NewEmail != "first@example.com" || got.OldEmail == nil || *got.OldEmail != oldEmail || !got.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("unexpected email change: %+v", got)
+	}
+	if got, err := s.GetEmailChangeByRevertHash(ctx, revertHash); err != nil || got.ID != "change-1" {
+		t.Errorf("expected change-1 by its revert token, got %+v (%v)", got, err)
+	}
+	if _, err := s.GetEmailChangeByConfirmHash(ctx, "unknown"); !errors.Is(err, ErrEmailChangeNotFound) {
+		t.Errorf("expected ErrEmailChangeNotFound, got %v", err)
+	}
+
+	// A change confirms once and can then still be reverted, once
+	if err := s.ConfirmEmailChange(ctx, "change-1"); err != nil {
+		t.Fatalf("failed to confirm email change: %v", err)
+	}
+	if err := s.ConfirmEmailChange(ctx, "change-1"); !errors.Is(err, ErrEmailChangeNotFound) {
+		t.Errorf("expected ErrEmailChangeNotFound, got %v", err)
+	}
+	if err := s.RevertEmailChange(ctx, "change-1"); err != nil {
+		t.Fatalf("failed to revert email change: %v", err)
+	}
+	if err := s.RevertEmailChange(ctx, "change-1"); !errors.Is(err, ErrEmailChangeNotFound) {
+		t.Errorf("expected ErrEmailChangeNotFound, got %v", err)
+	}
+
+	if err := s.ChangeUserEmail(ctx, "user-1", "first@example.com"); err != nil {
+		t.Fatalf("failed to change email: %v", err)
+	}
+	user, err := s.GetUserByID(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if user.Email == nil || *user.Email != "first@example.com" || user.EmailVerifiedAt == nil {
+		t.Errorf("expected a verified new address, got %+v", user)
+	}
+	if err := s.ChangeUserEmail(ctx, "missing", "first@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+
+	// Cancelling keeps changes that were already confirmed or reverted
+	if err := s.CancelPendingEmailChanges(ctx, "user-1"); err != nil {
+		t.Fatalf("failed to cancel pending changes: %v", err)
+	}
+	if _, err := s.GetEmailChangeByConfirmHash(ctx, "confirm-2"); !errors.Is(err, ErrEmailChangeNotFound) {
+		t.Errorf("expected the pending change to be cancelled, got %v", err)
+	}
+	if _, err := s.GetEmailChangeByConfirmHash(ctx, "confirm-1"); err != nil {
+		t.Errorf("expected the reverted change to be kept, got %v", err)
+	}
+
+	if err := s.DeleteExpiredEmailChanges(ctx); err != nil {
+		t.Fatalf("failed to delete expired changes: %v", err)
+	}
+	if _, err := s.GetEmailChangeByConfirmHash(ctx, "confirm-1"); err != nil {
+		t.Errorf("expected the revertible change to be kept, got %v", err)
+	}
+}
+
+func TestStore_DeletePasswordResetTokens(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := s.CreatePasswordResetToken(ctx, "reset-1", "user-1", "token-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to create reset token: %v", err)
+	}
+
+	if err := s.DeletePasswordResetTokens(ctx, "user-1"); err != nil {
+		t.Fatalf("failed to delete reset tokens: %v", err)
+	}
+	if _, err := s.GetPasswordResetToken(ctx, "token-1"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("expected ErrTokenNotFound, got %v", err)
+	}
+}
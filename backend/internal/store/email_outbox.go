@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Outbox states. Delivered emails are deleted rather than kept.
+const (
+	OutboxPending = "pending"
+	OutboxDead    = "dead"
+)
+
+// OutboxEmail is an email waiting to be sent. Message is the encoded
+// message; Recipient and Subject repeat it for listing.
+type OutboxEmail struct {
+	ID            string    `db:"id"`
+	Recipient     string    `db:"recipient"`
+	Subject       string    `db:"subject"`
+	Message       string    `db:"message"`
+	Status        string    `db:"status"`
+	Attempts      int       `db:"attempts"`
+	LastError     *string   `db:"last_error"`
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	CreatedAt     time.Time `db:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at"`
+}
+
+// OutboxEmailList is one page of outbox emails plus the total number of
+// matching rows
+type OutboxEmailList struct {
+	Emails []OutboxEmail
+	Total  int
+}
+
+const outboxEmailColumns = `id, recipient, subject, message, status, attempts, last_error, next_attempt_at, created_at, updated_at`
+
+// claimCandidates is how many due emails ClaimOutboxEmail tries before
+// giving up to other workers
+const claimCandidates = 5
+
+func (s *Store) EnqueueEmail(ctx context.Context, email *OutboxEmail) error {
+	query := `INSERT INTO email_outbox (id, recipient, subject, message, status, attempts, next_attempt_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, email.ID, email.Recipient, email.Subject, email.Message, OutboxPending, 0,
+		s.Dialect.TimeArg(email.NextAttemptAt), s.Dialect.TimeArg(email.CreatedAt), s.Dialect.TimeArg(email.CreatedAt))
+	return err
+}
+
+// ClaimOutboxEmail takes the pending email that has been due longest,
+// counting the attempt and holding it until leaseUntil. An email whose
+// lease runs out before it is retried, deleted or killed is claimed again,
+// so emails held by a worker that died are not lost. ErrOutboxEmpty means
+// nothing is due.
+func (s *Store) ClaimOutboxEmail(ctx context.Context, leaseUntil time.Time) (*OutboxEmail, error) {
+	now := s.Dialect.TimeArg(time.Now())
+	candidates := []OutboxEmail{}
+	query := `SELECT ` + outboxEmailColumns + ` FROM email_outbox
+		WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`
+	if err := s.selectInto(ctx, &candidates, query, OutboxPending, now, claimCandidates); err != nil {
+		return nil, err
+	}
+
+	for i := range candidates {
+		email := &candidates[i]
+		// Another worker may have claimed the email since it was selected
+		result, err := s.exec(ctx, `UPDATE email_outbox SET attempts = attempts + 1, next_attempt_at = ?, updated_at = `+s.Dialect.Now()+`
+			WHERE id = ? AND status = ? AND next_attempt_at <= ?`,
+			s.Dialect.TimeArg(leaseUntil), email.ID, OutboxPending, now)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if rows == 1 {
+			email.Attempts++
+			email.NextAttemptAt = leaseUntil
+			return email, nil
+		}
+	}
+	return nil, ErrOutboxEmpty
+}
+
+// DeleteOutboxEmail removes an email once it has been delivered
+func (s *Store) DeleteOutboxEmail(ctx context.Context, id string) error {
+	_, err := s.exec(ctx, `DELETE FROM email_outbox WHERE id = ?`, id)
+	return err
+}
+
+// RetryOutboxEmail records a failed attempt and schedules the next one
+func (s *Store) RetryOutboxEmail(ctx context.Context, id string, next time.Time, lastError string) error {
+	_, err := s.exec(ctx, `UPDATE email_outbox SET next_attempt_at = ?, last_error = ?, updated_at = `+s.Dialect.Now()+` WHERE id = ?`,
+		s.Dialect.TimeArg(next), lastError, id)
+	return err
+}
+
+// KillOutboxEmail gives up on an email, keeping it as dead until it is
+// requeued
+func (s *Store) KillOutboxEmail(ctx context.Context, id, lastError string) error {
+	_, err := s.exec(ctx, `UPDATE email_outbox SET status = ?, last_error = ?, updated_at = `+s.Dialect.Now()+` WHERE id = ?`,
+		OutboxDead, lastError, id)
+	return err
+}
+
+// ListOutboxEmails pages through the emails in a state, or all of them
+// when status is empty, oldest first
+func (s *Store) ListOutboxEmails(ctx context.Context, status string, limit, offset int) (*OutboxEmailList, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+
+	where := ""
+	var args []interface{}
+	if status != "" {
+		where = " WHERE status = ?"
+		args = append(args, status)
+	}
+
+	var total int
+	if err := s.get(ctx, &total, `SELECT COUNT(*) FROM email_outbox`+where, args...); err != nil {
+		return nil, err
+	}
+
+	emails := []OutboxEmail{}
+	query := `SELECT ` + outboxEmailColumns + ` FROM email_outbox` + where + ` ORDER BY created_at, id LIMIT ? OFFSET ?`
+	if err := s.selectInto(ctx, &emails, query, append(args, limit, offset)...); err != nil {
+		return nil, err
+	}
+	return &OutboxEmailList{Emails: emails, Total: total}, nil
+}
+
+// CountOutboxEmails returns the number of emails in each state
+func (s *Store) CountOutboxEmails(ctx context.Context) (map[string]int, error) {
+	var rows []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}
+	if err := s.selectInto(ctx, &rows, `SELECT status, COUNT(*) AS count FROM email_outbox GROUP BY status`); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{OutboxPending: 0, OutboxDead: 0}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// RequeueOutboxEmail sends a dead email again with a fresh set of attempts.
+// Only dead emails can be requeued.
+func (s *Store) RequeueOutboxEmail(ctx context.Context, id string) error {
+	result, err := s.exec(ctx, `UPDATE email_outbox SET status = ?, attempts = ?, next_attempt_at = ?, updated_at = `+s.Dialect.Now()+`
+		WHERE id = ? AND status = ?`,
+		OutboxPending, 0, s.Dialect.TimeArg(time.Now()), id, OutboxDead)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrOutboxEmailNotFound
+	}
+	return nil
+}
+
+func (m *MockStore) EnqueueEmail(ctx context.Context, email *OutboxEmail) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) ClaimOutboxEmail(ctx context.Context, leaseUntil time.Time) (*OutboxEmail, error) {
+	// Mock implementation - nothing is queued
+	return nil, ErrOutboxEmpty
+}
+
+func (m *MockStore) DeleteOutboxEmail(ctx context.Context, id string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) RetryOutboxEmail(ctx context.Context, id string, next time.Time, lastError string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) KillOutboxEmail(ctx context.Context, id, lastError string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) ListOutboxEmails(ctx context.Context, status string, limit, offset int) (*OutboxEmailList, error) {
+	// Mock implementation - nothing is queued
+	return &OutboxEmailList{Emails: []OutboxEmail{}}, nil
+}
+
+func (m *MockStore) CountOutboxEmails(ctx context.Context) (map[string]int, error) {
+	// Mock implementation - nothing is queued
+	return map[string]int{OutboxPending: 0, OutboxDead: 0}, nil
+}
+
+func (m *MockStore) RequeueOutboxEmail(ctx context.Context, id string) error {
+	// Mock implementation - nothing is queued
+	return ErrOutboxEmailNotFound
+}
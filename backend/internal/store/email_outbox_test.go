@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStore_EmailOutbox(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, email := range []*OutboxEmail{
+		{ID: "email-1", Recipient: "alice@example.com", Subject: "Welcome", Message: `{"Subject":"Welcome"}`, NextAttemptAt: now.Add(-time.Minute), CreatedAt: now.Add(-time.Minute)},
+		{ID: "email-2", Recipient: "bob@example.com", Subject: "Reset", Message: `{"Subject":"Reset"}`, NextAttemptAt: now.Add(-2 * time.Minute), CreatedAt: now},
+		{ID: "email-3", Recipient: "carol@example.com", Subject: "Later", Message: `{"Subject":"Later"}`, NextAttemptAt: now.Add(time.Hour), CreatedAt: now},
+	} {
+		if err := s.EnqueueEmail(ctx, email); err != nil {
+			t.Fatalf("failed to enqueue email: %v", err)
+		}
+	}
+
+	// The email due longest is claimed first and held until the lease ends
+	lease := now.Add(90 * time.Second)
+	claimed, err := s.ClaimOutboxEmail(ctx, lease)
+	if err != nil {
+		t.Fatalf("failed to claim email: %v", err)
+	}
+	if claimed.ID != "email-2" || claimed.Attempts != 1 || claimed.Status != OutboxPending || claimed.Message != `{"Subject":"Reset"}` {
+		t.Errorf("unexpected claimed email: %+v", claimed)
+	}
+
+	next, err := s.ClaimOutboxEmail(ctx, lease)
+	if err != nil {
+		t.Fatalf("failed to claim email: %v", err)
+	}
+	if next.ID != "email-1" {
+		t.Errorf("expected email-1 to be claimed next, got %s", next.ID)
+	}
+
+	// Neither a held nor a future email is due
+	if _, err := s.ClaimOutboxEmail(ctx, lease); !errors.Is(err, ErrOutboxEmpty) {
+		t.Errorf("expected ErrOutboxEmpty, got %v", err)
+	}
+
+	if err := s.DeleteOutboxEmail(ctx, "email-1"); err != nil {
+		t.Fatalf("failed to delete email: %v", err)
+	}
+
+	// A retry that is due again is claimed with its attempt counted
+	if err := s.RetryOutboxEmail(ctx, "email-2", now.Add(-time.Second), "connection refused"); err != nil {
+		t.Fatalf("failed to retry email: %v", err)
+	}
+	retried, err := s.ClaimOutboxEmail(ctx, lease)
+	if err != nil {
+		t.Fatalf("failed to claim retried email: %v", err)
+	}
+	if retried.ID != "email-2" || retried.Attempts != 2 || retried.LastError == nil || *retried.LastError != "connection refused" {
+		t.Errorf("unexpected retried email: %+v", retried)
+	}
+
+	if err := s.KillOutboxEmail(ctx, "email-2", "550 no such user"); err != nil {
+		t.Fatalf("failed to kill email: %v", err)
+	}
+
+	dead, err := s.ListOutboxEmails(ctx, OutboxDead, 10, 0)
+	if err != nil {
+		t.Fatalf("failed to list dead emails: %v", err)
+	}
+	if dead.Total != 1 || len(dead.Emails) != 1 || dead.Emails[0].ID != "email-2" || *dead.Emails[0].LastError != "550 no such user" {
+		t.Errorf("unexpected dead emails: %+v", dead)
+	}
+
+	counts, err := s.CountOutboxEmails(ctx)
+	if err != nil {
+		t.Fatalf("failed to count emails: %v", err)
+	}
+	if counts[OutboxPending] != 1 || counts[OutboxDead] != 1 {
+		t.Errorf("unexpected counts: %v", counts)
+	}
+
+	all, err := s.ListOutboxEmails(ctx, "", 1, 1)
+	if err != nil {
+		t.Fatalf("failed to list emails: %v", err)
+	}
+	if all.Total != 2 || len(all.Emails) != 1 {
+		t.Errorf("expected one of two emails, got %+v", all)
+	}
+
+	// Only dead emails can be requeued, and they start over
+	if err := s.RequeueOutboxEmail(ctx, "email-3"); !errors.Is(err, ErrOutboxEmailNotFound) {
+		t.Errorf("expected ErrOutboxEmailNotFound for a pending email, got %v", err)
+	}
+	if err := s.RequeueOutboxEmail(ctx, "email-2"); err != nil {
+		t.Fatalf("failed to requeue email: %v", err)
+	}
+	requeued, err := s.ClaimOutboxEmail(ctx, lease)
+	if err != nil {
+		t.Fatalf("failed to claim requeued email: %v", err)
+	}
+	if requeued.ID != "email-2" || requeued.Attempts != 1 {
+		t.Errorf("unexpected requeued email: %+v", requeued)
+	}
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// EmailVerificationToken is a link sent to prove ownership of Email.
+// TokenHash is the SHA-256 hex digest of the token in the link.
+type EmailVerificationToken struct {
+	ID        string    `db:"id"`
+	UserID    string    `db:"user_id"`
+	TokenHash string    `db:"token_hash"`
+	Email     string    `db:"email"`
+	ExpiresAt time.Time `db:"expires_at"`
+	Used      bool      `db:"used"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+const emailVerificationTokenColumns = `id, user_id, token_hash, email, expires_at, used, created_at`
+
+func (s *Store) CreateEmailVerificationToken(ctx context.Context, token *EmailVerificationToken) error {
+	query := `INSERT INTO email_verification_token (id, user_id, token_hash, email, expires_at, used, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, token.ID, token.UserID, token.TokenHash, token.Email,
+		s.Dialect.TimeArg(token.ExpiresAt), false, s.Dialect.TimeArg(token.CreatedAt))
+	return err
+}
+
+// GetEmailVerificationToken looks a token up by its digest. Expiry and use
+// are left to the caller.
+func (s *Store) GetEmailVerificationToken(ctx context.Context, tokenHash string) (*EmailVerificationToken, error) {
+	var token EmailVerificationToken
+	query := `SELECT ` + emailVerificationTokenColumns + ` FROM email_verification_token WHERE token_hash = ?`
+	if err := s.get(ctx, &token, query, tokenHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrVerificationTokenNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// LatestEmailVerificationToken returns the token most recently sent to the
+// user, which is used to throttle resends
+func (s *Store) LatestEmailVerificationToken(ctx context.Context, userID string) (*EmailVerificationToken, error) {
+	var token EmailVerificationToken
+	query := `SELECT ` + emailVerificationTokenColumns + ` FROM email_verification_token
+		WHERE user_id = ? ORDER BY created_at DESC, id LIMIT 1`
+	if err := s.get(ctx, &token, query, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrVerificationTokenNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *Store) MarkEmailVerificationTokenUsed(ctx context.Context, id string) error {
+	// Only an unused token can be consumed, so a link opened twice at the
+	// same time verifies once
+	result, err := s.exec(ctx, `UPDATE email_verification_token SET used = ? WHERE id = ? AND used = ?`, true, id, false)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrVerificationTokenNotFound
+	}
+	return nil
+}
+
+// MarkEmailVerified records that the user owns email. It fails with
+// ErrUserNotFound when the user's address is no longer email, so a link sent
+// to an old address cannot verify a new one.
+func (s *Store) MarkEmailVerified(ctx context.Context, userID, email string) error {
+	query := `UPDATE "user" SET email_verified_at = ` + s.Dialect.Now() + `, updated_at = ` + s.Dialect.Now() + `
+		WHERE id = ? AND email = ?`
+	result, err := s.exec(ctx, query, userID, email)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *Store) CleanupExpiredEmailVerificationTokens(ctx context.Context) error {
+	_, err := s.exec(ctx, `DELETE FROM email_verification_token WHERE expires_at < ?`, s.Dialect.TimeArg(time.Now()))
+	return err
+}
+
+func (m *MockStore) CreateEmailVerificationToken(ctx context.Context, token *EmailVerificationToken) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) GetEmailVerificationToken(ctx context.Context, tokenHash string) (*EmailVerificationToken, error) {
+	// Mock implementation - no tokens are issued
+	return nil, ErrVerificationTokenNotFound
+}
+
+func (m *MockStore) LatestEmailVerificationToken(ctx context.Context, userID string) (*EmailVerificationToken, error) {
+	// Mock implementation - no tokens are issued
+	return nil, ErrVerificationTokenNotFound
+}
+
+func (m *MockStore) MarkEmailVerificationTokenUsed(ctx context.Context, id string) error {
+	// Mock implementation - no tokens are issued
+	return ErrVerificationTokenNotFound
+}
+
+func (m *MockStore) MarkEmailVerified(ctx context.Context, userID, email string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) CleanupExpiredEmailVerificationTokens(ctx context.Context) error {
+	// Mock implementation - always succeeds
+	return nil
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStore_EmailVerification(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "alice@example.com", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, token := range []*EmailVerificationToken{
+		{ID: "token-1", UserID: "user-1", TokenHash: "hash-1", Email: "alice@example.com", ExpiresAt: now.Add(time.Hour), CreatedAt: now.Add(-time.Hour)},
+		{ID: "token-2", UserID: "user-1", TokenHash: "hash-2", Email: "alice@example.com", ExpiresAt: now.Add(time.Hour), CreatedAt: now},
+		{ID: "token-3", UserID: "user-1", TokenHash: "hash-3", Email: "alice@example.com", ExpiresAt: now.Add(-time.Minute), CreatedAt: now.Add(-2 * time.Hour)},
+	} {
+		if err := s.CreateEmailVerificationToken(ctx, token); err != nil {
+			t.Fatalf("failed to create verification token: %v", err)
+		}
+	}
+
+	got, err := s.GetEmailVerificationToken(ctx, "hash-1")
+	if err != nil {
+		t.Fatalf("failed to get verification token: %v", err)
+	}
+	if got.UserID != "user-1" || got.Email != "alice@example.com" || got.Used || !got.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("unexpected verification token: %+v", got)
+	}
+	if _, err := s.GetEmailVerificationToken(ctx, "unknown"); !errors.Is(err, ErrVerificationTokenNotFound) {
+		t.Errorf("expected ErrVerificationTokenNotFound, got %v", err)
+	}
+
+	latest, err := s.LatestEmailVerificationToken(ctx, "user-1")
+	if err != nil || latest.ID != "token-2" {
+		t.Errorf("expected token-2 to be the latest, got %+v (%v)", latest, err)
+	}
+	if _, err := s.LatestEmailVerificationToken(ctx, "user-2"); !errors.Is(err, ErrVerificationTokenNotFound) {
+		t.Errorf("expected ErrVerificationTokenNotFound, got %v", err)
+	}
+
+	// A token can only be used once
+	if err := s.MarkEmailVerificationTokenUsed(ctx, "token-1"); err != nil {
+		t.Fatalf("failed to use verification token: %v", err)
+	}
+	if err := s.MarkEmailVerificationTokenUsed(ctx, "token-1"); !errors.Is(err, ErrVerificationTokenNotFound) {
+		t.Errorf("expected ErrVerificationTokenNotFound, got %v", err)
+	}
+
+	// Verification only applies while the address is unchanged
+	if err := s.MarkEmailVerified(ctx, "user-1", "old@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+	if err := s.MarkEmailVerified(ctx, "user-1", "alice@example.com"); err != nil {
+		t.Fatalf("failed to mark email verified: %v", err)
+	}
+	user, err := s.GetUserByID(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Error("expected email to be verified")
+	}
+
+	if err := s.UpdateUser(ctx, "user-1", map[string]interface{}{"email_verified_at": nil}); err != nil {
+		t.Fatalf("failed to clear verification: %v", err)
+	}
+	if user, _ := s.GetUserByID(ctx, "user-1"); user.EmailVerifiedAt != nil {
+		t.Error("expected verification to be cleared")
+	}
+
+	if err := s.CleanupExpiredEmailVerificationTokens(ctx); err != nil {
+		t.Fatalf("failed to clean up verification tokens: %v", err)
+	}
+	if _, err := s.GetEmailVerificationToken(ctx, "hash-3"); !errors.Is(err, ErrVerificationTokenNotFound) {
+		t.Errorf("expected expired token to be deleted, got %v", err)
+	}
+	if _, err := s.GetEmailVerificationToken(ctx, "hash-2"); err != nil {
+		t.Errorf("expected unexpired token to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider. Subject is the provider's stable id for that account; Email is
+// the address it reported when the identity was linked.
+type UserIdentity struct {
+	ID          string     `db:"id"`
+	UserID      string     `db:"user_id"`
+	Provider    string     `db:"provider"`
+	Subject     string     `db:"subject"`
+	Email       *string    `db:"email"`
+	CreatedAt   *time.Time `db:"created_at"`
+	LastLoginAt *time.Time `db:"last_login_at"`
+}
+
+// OIDCAuthRequest is a pending authorization request. ID is the hash of the
+// state parameter sent to the provider. UserID is set when a signed in user
+// is linking an identity rather than logging in.
+type OIDCAuthRequest struct {
+	ID           string     `db:"id"`
+	Provider     string     `db:"provider"`
+	Nonce        string     `db:"nonce"`
+	CodeVerifier string     `db:"code_verifier"`
+	UserID       *string    `db:"user_id"`
+	ExpiresAt    time.Time  `db:"expires_at"`
+	CreatedAt    *time.Time `db:"created_at"`
+}
+
+const userIdentityColumns = `id, user_id, provider, subject, email, created_at, last_login_at`
+
+func (s *Store) CreateUserIdentity(ctx context.Context, identity *UserIdentity) error {
+	query := `INSERT INTO user_identity (id, user_id, provider, subject, email, created_at)
+		VALUES (?, ?, ?, ?, ?, ` + s.Dialect.Now() + `)`
+	_, err := s.exec(ctx, query, identity.ID, identity.UserID, identity.Provider, identity.Subject, identity.Email)
+	return err
+}
+
+func (s *Store) GetUserIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error) {
+	var identity UserIdentity
+	query := `SELECT ` + userIdentityColumns + ` FROM user_identity WHERE provider = ? AND subject = ?`
+	if err := s.get(ctx, &identity, query, provider, subject); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrIdentityNotFound
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (s *Store) ListUserIdentities(ctx context.Context, userID string) ([]UserIdentity, error) {
+	identities := []UserIdentity{}
+	query := `SELECT ` + userIdentityColumns + ` FROM user_identity WHERE user_id = ? ORDER BY created_at, id`
+	if err := s.selectInto(ctx, &identities, query, userID); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (s *Store) RecordUserIdentityLogin(ctx context.Context, id string) error {
+	_, err := s.exec(ctx, `UPDATE user_identity SET last_login_at = `+s.Dialect.Now()+` WHERE id = ?`, id)
+	return err
+}
+
+// DeleteUserIdentity unlinks one of the user's identities by its row id
+func (s *Store) DeleteUserIdentity(ctx context.Context, id, userID string) error {
+	result, err := s.exec(ctx, `DELETE FROM user_identity WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
+
+// CreateOIDCAuthRequest stores a pending authorization request. A nil
+// UserID is stored as NULL.
+func (s *Store) CreateOIDCAuthRequest(ctx context.Context, req *OIDCAuthRequest) error {
+	query := `INSERT INTO oidc_auth_request (id, provider, nonce, code_verifier, user_id, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ` + s.Dialect.Now() + `)`
+	_, err := s.exec(ctx, query, req.ID, req.Provider, req.Nonce, req.CodeVerifier, req.UserID, s.Dialect.TimeArg(req.ExpiresAt))
+	return err
+}
+
+// TakeOIDCAuthRequest deletes a pending authorization request and returns
+// it, so each state can be redeemed at most once. Expiry is left to the
+// caller.
+func (s *Store) TakeOIDCAuthRequest(ctx context.Context, id string) (*OIDCAuthRequest, error) {
+	var req OIDCAuthRequest
+	query := `DELETE FROM oidc_auth_request WHERE id = ?` +
+		s.Dialect.Returning("id", "provider", "nonce", "code_verifier", "user_id", "expires_at", "created_at")
+	if err := s.get(ctx, &req, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAuthRequestNotFound
+		}
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (s *Store) CleanupExpiredOIDCAuthRequests(ctx context.Context) error {
+	_, err := s.exec(ctx, `DELETE FROM oidc_auth_request WHERE expires_at < ?`, s.Dialect.TimeArg(time.Now()))
+	return err
+}
+
+func (m *MockStore) CreateUserIdentity(ctx context.Context, identity *UserIdentity) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) GetUserIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error) {
+	// Mock implementation - no identities are linked
+	return nil, ErrIdentityNotFound
+}
+
+func (m *MockStore) ListUserIdentities(ctx context.Context, userID string) ([]UserIdentity, error) {
+	// Mock implementation - no identities are linked
+	return []UserIdentity{}, nil
+}
+
+func (m *MockStore) RecordUserIdentityLogin(ctx context.Context, id string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) DeleteUserIdentity(ctx context.Context, id, userID string) error {
+	// Mock implementation - no identities are linked
+	return ErrIdentityNotFound
+}
+
+func (m *MockStore) CreateOIDCAuthRequest(ctx context.Context, req *OIDCAuthRequest) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) TakeOIDCAuthRequest(ctx context.Context, id string) (*OIDCAuthRequest, error) {
+	// Mock implementation - no requests are pending
+	return nil, ErrAuthRequestNotFound
+}
+
+func (m *MockStore) CleanupExpiredOIDCAuthRequests(ctx context.Context) error {
+	// Mock implementation - always succeeds
+	return nil
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStore_UserIdentities(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "alice@example.com", ""); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := s.CreateUser(ctx, "user-2", "bob", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	email := "alice@example.com"
+	for _, identity := range []*UserIdentity{
+		{ID: "id-1", UserID: "user-1", Provider: "google", Subject: "g-1", Email: &email},
+		{ID: "id-2", UserID: "user-1", Provider: "github", Subject: "gh-1"},
+	} {
+		if err := s.CreateUserIdentity(ctx, identity); err != nil {
+			t.Fatalf("failed to create identity: %v", err)
+		}
+	}
+
+	if err := s.CreateUserIdentity(ctx, &UserIdentity{ID: "id-3", UserID: "user-2", Provider: "google", Subject: "g-1"}); err == nil {
+		t.Error("expected a provider subject to be linked only once")
+	}
+
+	got, err := s.GetUserIdentity(ctx, "google", "g-1")
+	if err != nil {
+		t.Fatalf("failed to get identity: %v", err)
+	}
+	if got.UserID != "user-1" || got.Email == nil || *got.Email != email || got.LastLoginAt != nil {
+		t.Errorf("unexpected identity: %+v", got)
+	}
+	if _, err := s.GetUserIdentity(ctx, "github", "g-1"); !errors.Is(err, ErrIdentityNotFound) {
+		t.Errorf("expected ErrIdentityNotFound, got %v", err)
+	}
+
+	if err := s.RecordUserIdentityLogin(ctx, "id-1"); err != nil {
+		t.Fatalf("failed to record login: %v", err)
+	}
+	got, _ = s.GetUserIdentity(ctx, "google", "g-1")
+	if got.LastLoginAt == nil {
+		t.Error("expected last login to be recorded")
+	}
+
+	identities, err := s.ListUserIdentities(ctx, "user-1")
+	if err != nil || len(identities) != 2 {
+		t.Fatalf("expected two identities, got %d (%v)", len(identities), err)
+	}
+
+	if err := s.DeleteUserIdentity(ctx, "id-2", "user-2"); !errors.Is(err, ErrIdentityNotFound) {
+		t.Errorf("expected only the owner to unlink, got %v", err)
+	}
+	if err := s.DeleteUserIdentity(ctx, "id-2", "user-1"); err != nil {
+		t.Fatalf("failed to delete identity: %v", err)
+	}
+	if _, err := s.GetUserIdentity(ctx, "github", "gh-1"); !errors.Is(err, ErrIdentityNotFound) {
+		t.Errorf("expected ErrIdentityNotFound, got %v", err)
+	}
+}
+
+func TestStore_OIDCAuthRequests(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	userID := "user-1"
+	expiresAt := time.Now().Add(10 * time.Minute)
+	for _, req := range []*OIDCAuthRequest{
+		{ID: "r-1", Provider: "google", Nonce: "n1", CodeVerifier: "v1", ExpiresAt: expiresAt},
+		{ID: "r-2", Provider: "google", Nonce: "n2", CodeVerifier: "v2", UserID: &userID, ExpiresAt: expiresAt},
+		{ID: "r-3", Provider: "google", Nonce: "n3", CodeVerifier: "v3", ExpiresAt: time.Now().Add(-time.Minute)},
+	} {
+		if err := s.CreateOIDCAuthRequest(ctx, req); err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+	}
+
+	req, err := s.TakeOIDCAuthRequest(ctx, "r-1")
+	if err != nil {
+		t.Fatalf("failed to take request: %v", err)
+	}
+	if req.Provider != "google" || req.Nonce != "n1" || req.CodeVerifier != "v1" || req.UserID != nil {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	if req.ExpiresAt.Sub(expiresAt).Abs() > time.Second {
+		t.Errorf("expires_at = %v, want %v", req.ExpiresAt, expiresAt)
+	}
+	if _, err := s.TakeOIDCAuthRequest(ctx, "r-1"); !errors.Is(err, ErrAuthRequestNotFound) {
+		t.Errorf("expected a request to be taken only once, got %v", err)
+	}
+
+	if err := s.CleanupExpiredOIDCAuthRequests(ctx); err != nil {
+		t.Fatalf("failed to clean up: %v", err)
+	}
+	if _, err := s.TakeOIDCAuthRequest(ctx, "r-3"); !errors.Is(err, ErrAuthRequestNotFound) {
+		t.Errorf("expected expired request to be removed, got %v", err)
+	}
+	req, err = s.TakeOIDCAuthRequest(ctx, "r-2")
+	if err != nil {
+		t.Fatalf("expected live request to survive cleanup: %v", err)
+	}
+	if req.UserID == nil || *req.UserID != "user-1" {
+		t.Errorf("expected a link request for user-1, got %+v", req.UserID)
+	}
+}
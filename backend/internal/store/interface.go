@@ -1,25 +1,153 @@
 package store
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // StoreInterface defines the interface for data access operations
 type StoreInterface interface {
+	// WithTx runs fn as a single unit of work. Store calls made through the
+	// StoreInterface handed to fn share one transaction.
+	WithTx(ctx context.Context, fn func(StoreInterface) error) error
+
 	// User operations
-	CreateUser(id, username, email, passwordHash string) error
-	GetUserByID(id string) (*User, error)
-	GetUserByUsername(username string) (*User, error)
-	GetUserByEmail(email string) (*User, error)
-	UpdateUser(id string, updates map[string]interface{}) error
-	DeleteUser(id string) error
+	CreateUser(ctx context.Context, id, username, email, passwordHash string) error
+	GetUserByID(ctx context.Context, id string) (*User, error)
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	ListUsers(ctx context.Context, opts UserListOptions) (*UserList, error)
+	UpdateUser(ctx context.Context, id string, updates map[string]interface{}) error
+	DeleteUser(ctx context.Context, id string) error
 
 	// Session operations
-	CreateSession(id, userID string, expiresAt string) error
-	GetSession(id string) (*Session, error)
-	DeleteSession(id string) error
+	CreateSession(ctx context.Context, id, userID, refreshTokenHash string, expiresAt time.Time) error
+	GetSession(ctx context.Context, id string) (*Session, error)
+	RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error
+	IsRotatedRefreshToken(ctx context.Context, sessionID, tokenHash string) (bool, error)
+	DeleteSession(ctx context.Context, id string) error
+	DeleteUserSessions(ctx context.Context, userID string) error
+
+	// Role operations
+	GetUserRoles(ctx context.Context, userID string) ([]string, error)
+	GetUserPermissions(ctx context.Context, userID string) ([]string, error)
+	AssignRole(ctx context.Context, userID, role string) error
+	RemoveRole(ctx context.Context, userID, role string) error
+	ClaimAdminBootstrap(ctx context.Context, userID string) (bool, error)
+
+	// Two-factor operations
+	GetUserMFA(ctx context.Context, userID string) (*UserMFA, error)
+	SaveMFASecret(ctx context.Context, userID, secret string) error
+	EnableMFA(ctx context.Context, userID string) error
+	UseMFAStep(ctx context.Context, userID string, step int64) error
+	DeleteUserMFA(ctx context.Context, userID string) error
+	CreateRecoveryCode(ctx context.Context, id, userID, codeHash string) error
+	DeleteRecoveryCodes(ctx context.Context, userID string) error
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) error
+	CreateMFAChallenge(ctx context.Context, challenge *MFAChallenge) error
+	GetMFAChallenge(ctx context.Context, tokenHash string) (*MFAChallenge, error)
+	UseMFAChallengeAttempt(ctx context.Context, id string, maxAttempts int) error
+	DeleteMFAChallenge(ctx context.Context, id string) error
+	CleanupExpiredMFAChallenges(ctx context.Context) error
+
+	// Passkey operations
+	CreateWebAuthnCredential(ctx context.Context, cred *WebAuthnCredential) error
+	GetWebAuthnCredential(ctx context.Context, credentialID string) (*WebAuthnCredential, error)
+	ListWebAuthnCredentials(ctx context.Context, userID string) ([]WebAuthnCredential, error)
+	UpdateWebAuthnSignCount(ctx context.Context, id string, oldCount, newCount int64) error
+	DeleteWebAuthnCredential(ctx context.Context, id, userID string) error
+	CreateWebAuthnChallenge(ctx context.Context, id, userID, ceremony, challenge string, expiresAt time.Time) error
+	TakeWebAuthnChallenge(ctx context.Context, id string) (*WebAuthnChallenge, error)
+	CleanupExpiredWebAuthnChallenges(ctx context.Context) error
+
+	// External identity operations
+	CreateUserIdentity(ctx context.Context, identity *UserIdentity) error
+	GetUserIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error)
+	ListUserIdentities(ctx context.Context, userID string) ([]UserIdentity, error)
+	RecordUserIdentityLogin(ctx context.Context, id string) error
+	DeleteUserIdentity(ctx context.Context, id, userID string) error
+	CreateOIDCAuthRequest(ctx context.Context, req *OIDCAuthRequest) error
+	TakeOIDCAuthRequest(ctx context.Context, id string) (*OIDCAuthRequest, error)
+	CleanupExpiredOIDCAuthRequests(ctx context.Context) error
+
+	// Identity provider operations
+	CreateOAuthClient(ctx context.Context, client *OAuthClient) error
+	GetOAuthClient(ctx context.Context, id string) (*OAuthClient, error)
+	ListOAuthClients(ctx context.Context) ([]OAuthClient, error)
+	DeleteOAuthClient(ctx context.Context, id string) error
+	GetOAuthConsent(ctx context.Context, userID, clientID string) (*OAuthConsent, error)
+	ListOAuthConsents(ctx context.Context, userID string) ([]OAuthConsent, error)
+	SaveOAuthConsent(ctx context.Context, userID, clientID, scopes string) error
+	DeleteOAuthConsent(ctx context.Context, userID, clientID string) error
+	CreateOAuthCode(ctx context.Context, code *OAuthCode) error
+	TakeOAuthCode(ctx context.Context, id string) (*OAuthCode, error)
+	CleanupExpiredOAuthCodes(ctx context.Context) error
+
+	// Signing key operations
+	CreateSigningKey(ctx context.Context, key *SigningKey) error
+	ListSigningKeys(ctx context.Context) ([]SigningKey, error)
+	RetireSigningKeys(ctx context.Context, exceptID string, expiresAt time.Time) error
+	DeleteExpiredSigningKeys(ctx context.Context) error
+
+	// API key operations
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKeyByHash(ctx context.Context, tokenHash string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error)
+	TouchAPIKey(ctx context.Context, id, ip string) error
+	DeleteAPIKey(ctx context.Context, id, userID string) error
+	DeleteUserAPIKeys(ctx context.Context, userID string) error
+
+	// Email verification operations
+	CreateEmailVerificationToken(ctx context.Context, token *EmailVerificationToken) error
+	GetEmailVerificationToken(ctx context.Context, tokenHash string) (*EmailVerificationToken, error)
+	LatestEmailVerificationToken(ctx context.Context, userID string) (*EmailVerificationToken, error)
+	MarkEmailVerificationTokenUsed(ctx context.Context, id string) error
+	MarkEmailVerified(ctx context.Context, userID, email string) error
+	CleanupExpiredEmailVerificationTokens(ctx context.Context) error
+
+	// Email change operations
+	CreateEmailChange(ctx context.Context, change *EmailChange) error
+	GetEmailChangeByConfirmHash(ctx context.Context, tokenHash string) (*EmailChange, error)
+	GetEmailChangeByRevertHash(ctx context.Context, tokenHash string) (*EmailChange, error)
+	CancelPendingEmailChanges(ctx context.Context, userID string) error
+	ConfirmEmailChange(ctx context.Context, id string) error
+	RevertEmailChange(ctx context.Context, id string) error
+	ChangeUserEmail(ctx context.Context, userID, email string) error
+	DeleteExpiredEmailChanges(ctx context.Context) error
+
+	// Magic link operations
+	CreateMagicLinkToken(ctx context.Context, token *MagicLinkToken) error
+	GetMagicLinkToken(ctx context.Context, tokenHash string) (*MagicLinkToken, error)
+	MarkMagicLinkTokenUsed(ctx context.Context, id string) error
+	CleanupExpiredMagicLinkTokens(ctx context.Context) error
+
+	// Email outbox operations
+	EnqueueEmail(ctx context.Context, email *OutboxEmail) error
+	ClaimOutboxEmail(ctx context.Context, leaseUntil time.Time) (*OutboxEmail, error)
+	DeleteOutboxEmail(ctx context.Context, id string) error
+	RetryOutboxEmail(ctx context.Context, id string, next time.Time, lastError string) error
+	KillOutboxEmail(ctx context.Context, id, lastError string) error
+	ListOutboxEmails(ctx context.Context, status string, limit, offset int) (*OutboxEmailList, error)
+	CountOutboxEmails(ctx context.Context) (map[string]int, error)
+	RequeueOutboxEmail(ctx context.Context, id string) error
+
+	// Login throttle operations
+	GetLoginThrottle(ctx context.Context, scope, subject string) (*LoginThrottle, error)
+	GetLoginThrottleByUnlockHash(ctx context.Context, tokenHash string) (*LoginThrottle, error)
+	RecordLoginFailure(ctx context.Context, scope, subject string) (*LoginThrottle, error)
+	LockLogin(ctx context.Context, scope, subject string, until time.Time, unlockTokenHash *string) error
+	ClearLoginFailures(ctx context.Context, scope, subject string) error
+	DeleteStaleLoginThrottles(ctx context.Context, before time.Time) error
+
+	// Password history operations
+	AddPasswordHistory(ctx context.Context, userID, passwordHash string) error
+	GetPasswordHistory(ctx context.Context, userID string, limit int) ([]string, error)
+	PrunePasswordHistory(ctx context.Context, userID string, keep int) error
 
 	// Password reset operations
-	CreatePasswordResetToken(id, userID, token string, expiresAt time.Time) error
-	GetPasswordResetToken(token string) (*PasswordResetToken, error)
-	MarkPasswordResetTokenUsed(id string) error
-	CleanupExpiredPasswordResetTokens() error
+	CreatePasswordResetToken(ctx context.Context, id, userID, token string, expiresAt time.Time) error
+	GetPasswordResetToken(ctx context.Context, token string) (*PasswordResetToken, error)
+	MarkPasswordResetTokenUsed(ctx context.Context, id string) error
+	CleanupExpiredPasswordResetTokens(ctx context.Context) error
+	DeletePasswordResetTokens(ctx context.Context, userID string) error
 }
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Scopes failed logins are counted under
+const (
+	LoginScopeAccount = "account" // subject is the username tried
+	LoginScopeIP      = "ip"      // subject is the client IP
+)
+
+// LoginThrottle counts the failed logins for one account or client IP.
+// LockedUntil is set once the failures pass the lockout threshold.
+type LoginThrottle struct {
+	Scope           string     `db:"scope"`
+	Subject         string     `db:"subject"`
+	Failures        int        `db:"failures"`
+	LastFailureAt   time.Time  `db:"last_failure_at"`
+	LockedUntil     *time.Time `db:"locked_until"`
+	UnlockTokenHash *string    `db:"unlock_token_hash"`
+}
+
+const loginThrottleColumns = `scope, subject, failures, last_failure_at, locked_until, unlock_token_hash`
+
+func (s *Store) GetLoginThrottle(ctx context.Context, scope, subject string) (*LoginThrottle, error) {
+	return s.getLoginThrottle(ctx, `scope = ? AND subject = ?`, scope, subject)
+}
+
+// GetLoginThrottleByUnlockHash looks a locked account up by the digest of the
+// unlock link sent to its owner
+func (s *Store) GetLoginThrottleByUnlockHash(ctx context.Context, tokenHash string) (*LoginThrottle, error) {
+	return s.getLoginThrottle(ctx, `unlock_token_hash = ?`, tokenHash)
+}
+
+func (s *Store) getLoginThrottle(ctx context.Context, where string, args ...interface{}) (*LoginThrottle, error) {
+	var throttle LoginThrottle
+	query := `SELECT ` + loginThrottleColumns + ` FROM login_throttle WHERE ` + where
+	if err := s.get(ctx, &throttle, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrLoginThrottleNotFound
+		}
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+// RecordLoginFailure counts one more failed login and returns the updated
+// counter
+func (s *Store) RecordLoginFailure(ctx context.Context, scope, subject string) (*LoginThrottle, error) {
+	query := `INSERT INTO login_throttle (scope, subject, failures, last_failure_at)
+		VALUES (?, ?, 1, ` + s.Dialect.Now() + `)
+		ON CONFLICT (scope, subject) DO UPDATE SET failures = login_throttle.failures + 1, last_failure_at = excluded.last_failure_at`
+	if _, err := s.exec(ctx, query, scope, subject); err != nil {
+		return nil, err
+	}
+	return s.GetLoginThrottle(ctx, scope, subject)
+}
+
+// LockLogin blocks logins until the given time. An unlock token hash is only
+// stored when given, so an earlier unlock link keeps working.
+func (s *Store) LockLogin(ctx context.Context, scope, subject string, until time.Time, unlockTokenHash *string) error {
+	query := `UPDATE login_throttle SET locked_until = ?, unlock_token_hash = COALESCE(?, unlock_token_hash)
+		WHERE scope = ? AND subject = ?`
+	result, err := s.exec(ctx, query, s.Dialect.TimeArg(until), unlockTokenHash, scope, subject)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrLoginThrottleNotFound
+	}
+	return nil
+}
+
+// ClearLoginFailures forgets the failures counted for an account or IP and
+// lifts any lockout
+func (s *Store) ClearLoginFailures(ctx context.Context, scope, subject string) error {
+	_, err := s.exec(ctx, `DELETE FROM login_throttle WHERE scope = ? AND subject = ?`, scope, subject)
+	return err
+}
+
+// DeleteStaleLoginThrottles forgets counters whose last failure and lockout
+// both ended before the given time
+func (s *Store) DeleteStaleLoginThrottles(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM login_throttle WHERE last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)`
+	arg := s.Dialect.TimeArg(before)
+	_, err := s.exec(ctx, query, arg, arg)
+	return err
+}
+
+func (m *MockStore) GetLoginThrottle(ctx context.Context, scope, subject string) (*LoginThrottle, error) {
+	// Mock implementation - no failed logins recorded
+	return nil, ErrLoginThrottleNotFound
+}
+
+func (m *MockStore) GetLoginThrottleByUnlockHash(ctx context.Context, tokenHash string) (*LoginThrottle, error) {
+	// Mock implementation - no accounts are locked
+	return nil, ErrLoginThrottleNotFound
+}
+
+func (m *MockStore) RecordLoginFailure(ctx context.Context, scope, subject string) (*LoginThrottle, error) {
+	// Mock implementation - every failure looks like the first
+	return &LoginThrottle{Scope: scope, Subject: subject, Failures: 1, LastFailureAt: time.Now()}, nil
+}
+
+func (m *MockStore) LockLogin(ctx context.Context, scope, subject string, until time.Time, unlockTokenHash *string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) ClearLoginFailures(ctx context.Context, scope, subject string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) DeleteStaleLoginThrottles(ctx context.Context, before time.Time) error {
+	// Mock implementation - always succeeds
+	return nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStore_LoginThrottle(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if _, err := s.GetLoginThrottle(ctx, LoginScopeAccount, "alice"); !errors.Is(err, ErrLoginThrottleNotFound) {
+		t.Errorf("expected ErrLoginThrottleNotFound, got %v", err)
+	}
+
+	// Failures are counted separately per scope and subject
+	for i := 1; i <= 3; i++ {
+		throttle, err := s.RecordLoginFailure(ctx, LoginScopeAccount, "alice")
+		if err != nil {
+			t.Fatalf("failed to record login failure: %v", err)
+		}
+		if throttle.Failures != i {
+			t.Errorf("expected %d failures, got %d", i, throttle.Failures)
+		}
+	}
+	if throttle, err := s.RecordLoginFailure(ctx, LoginScopeIP, "192.0.2.1"); err != nil || throttle.Failures != 1 {
+		t.Errorf("expected the IP to have its own counter, got %+v (%v)", throttle, err)
+	}
+
+	until := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	unlockHash := "unlock-1"
+	if err := s.LockLogin(ctx, LoginScopeAccount, "alice", until, &unlockHash); err != nil {
+		t.Fatalf("failed to lock login: %v", err)
+	}
+	// A later lockout without a new token keeps the first unlock link
+	until = until.Add(time.Hour)
+	if err := s.LockLogin(ctx, LoginScopeAccount, "alice", until, nil); err != nil {
+		t.Fatalf("failed to extend lockout: %v", err)
+	}
+	throttle, err := s.GetLoginThrottleByUnlockHash(ctx, unlockHash)
+	if err != nil {
+		t.Fatalf("failed to get throttle by unlock token: %v", err)
+	}
+	if throttle.Subject != "alice" || throttle.LockedUntil == nil || !throttle.LockedUntil.Equal(until) {
+		t.Errorf("unexpected throttle: %+v", throttle)
+	}
+	if err := s.LockLogin(ctx, LoginScopeAccount, "bob", until, nil); !errors.Is(err, ErrLoginThrottleNotFound) {
+		t.Errorf("expected ErrLoginThrottleNotFound, got %v", err)
+	}
+
+	if err := s.ClearLoginFailures(ctx, LoginScopeAccount, "alice"); err != nil {
+		t.Fatalf("failed to clear login failures: %v", err)
+	}
+	if _, err := s.GetLoginThrottle(ctx, LoginScopeAccount, "alice"); !errors.Is(err, ErrLoginThrottleNotFound) {
+		t.Errorf("expected the counter to be cleared, got %v", err)
+	}
+
+	// Only counters that have gone quiet are forgotten
+	if err := s.DeleteStaleLoginThrottles(ctx, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("failed to delete stale throttles: %v", err)
+	}
+	if _, err := s.GetLoginThrottle(ctx, LoginScopeIP, "192.0.2.1"); err != nil {
+		t.Errorf("expected a recent counter to be kept, got %v", err)
+	}
+	if err := s.DeleteStaleLoginThrottles(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("failed to delete stale throttles: %v", err)
+	}
+	if _, err := s.GetLoginThrottle(ctx, LoginScopeIP, "192.0.2.1"); !errors.Is(err, ErrLoginThrottleNotFound) {
+		t.Errorf("expected a stale counter to be deleted, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStore_MagicLinks(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "alice@example.com", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	binding := "binding-hash"
+	for _, token := range []*MagicLinkToken{
+		{ID: "link-1", UserID: "user-1", TokenHash: "hash-1", Email: "alice@example.com", BindingHash: &binding, ExpiresAt: now.Add(15 * time.Minute), CreatedAt: now},
+		{ID: "link-2", UserID: "user-1", TokenHash: "hash-2", Email: "alice@example.com", ExpiresAt: now.Add(-time.Minute), CreatedAt: now.Add(-time.Hour)},
+	} {
+		if err := s.CreateMagicLinkToken(ctx, token); err != nil {
+			t.Fatalf("failed to create magic link: %v", err)
+		}
+	}
+
+	got, err := s.GetMagicLinkToken(ctx, "hash-1")
+	if err != nil {
+		t.Fatalf("failed to get magic link: %v", err)
+	}
+	if got.UserID != "user-1" || got.Email != "alice@example.com" || got.Used || !got.ExpiresAt.Equal(now.Add(15*time.Minute)) {
+		t.Errorf("unexpected magic link: %+v", got)
+	}
+	if got.BindingHash == nil || *got.BindingHash != binding {
+		t.Errorf("expected the binding to be kept, got %v", got.BindingHash)
+	}
+	if unbound, _ := s.GetMagicLinkToken(ctx, "hash-2"); unbound == nil || unbound.BindingHash != nil {
+		t.Errorf("expected an unbound link, got %+v", unbound)
+	}
+	if _, err := s.GetMagicLinkToken(ctx, "unknown"); !errors.Is(err, ErrMagicLinkNotFound) {
+		t.Errorf("expected ErrMagicLinkNotFound, got %v", err)
+	}
+
+	// A link can only be used once
+	if err := s.MarkMagicLinkTokenUsed(ctx, "link-1"); err != nil {
+		t.Fatalf("failed to use magic link: %v", err)
+	}
+	if err := s.MarkMagicLinkTokenUsed(ctx, "link-1"); !errors.Is(err, ErrMagicLinkNotFound) {
+		t.Errorf("expected ErrMagicLinkNotFound, got %v", err)
+	}
+
+	if err := s.CleanupExpiredMagicLinkTokens(ctx); err != nil {
+		t.Fatalf("failed to clean up magic links: %v", err)
+	}
+	if _, err := s.GetMagicLinkToken(ctx, "hash-2"); !errors.Is(err, ErrMagicLinkNotFound) {
+		t.Errorf("expected the expired link to be removed, got %v", err)
+	}
+	if _, err := s.GetMagicLinkToken(ctx, "hash-1"); err != nil {
+		t.Errorf("expected the live link to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// UserMFA is a user's TOTP enrolment. EnabledAt is nil while enrolment is
+// pending confirmation. LastUsedStep is the most recent accepted time step,
+// kept so a code cannot be replayed within its validity window.
+type UserMFA struct {
+	UserID       string     `db:"user_id"`
+	Secret       string     `db:"secret"`
+	EnabledAt    *time.Time `db:"enabled_at"`
+	LastUsedStep int64      `db:"last_used_step"`
+	CreatedAt    *time.Time `db:"created_at"`
+}
+
+// MFAChallenge is a login waiting for its second factor. TokenHash is the
+// SHA-256 hex digest of the opaque token handed to the client, and Attempts
+// the number of codes tried against it.
+type MFAChallenge struct {
+	ID        string    `db:"id"`
+	UserID    string    `db:"user_id"`
+	TokenHash string    `db:"token_hash"`
+	Attempts  int       `db:"attempts"`
+	ExpiresAt time.Time `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func (s *Store) GetUserMFA(ctx context.Context, userID string) (*UserMFA, error) {
+	var mfa UserMFA
+	query := `SELECT user_id, secret, enabled_at, last_used_step, created_at FROM user_mfa WHERE user_id = ?`
+	if err := s.get(ctx, &mfa, query, userID); err != nil {
+		// Only a missing row means "not enrolled"; any other failure must not
+		// be mistaken for it, or a database hiccup would skip the second factor
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFANotFound
+		}
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+// SaveMFASecret starts a new, unconfirmed enrolment, replacing any previous one
+func (s *Store) SaveMFASecret(ctx context.Context, userID, secret string) error {
+	query := `INSERT INTO user_mfa (user_id, secret, enabled_at, last_used_step, created_at) VALUES (?, ?, NULL, 0, ` + s.Dialect.Now() + `)` +
+		s.Dialect.Upsert([]string{"user_id"}, "secret", "enabled_at", "last_used_step", "created_at")
+	_, err := s.exec(ctx, query, userID, secret)
+	return err
+}
+
+// EnableMFA confirms a pending enrolment
+func (s *Store) EnableMFA(ctx context.Context, userID string) error {
+	query := `UPDATE user_mfa SET enabled_at = ` + s.Dialect.Now() + ` WHERE user_id = ? AND enabled_at IS NULL`
+	result, err := s.exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrMFANotFound
+	}
+	return nil
+}
+
+// UseMFAStep records that the code for a time step has been accepted. It
+// returns ErrMFAStepUsed when that step or a later one was already used.
+func (s *Store) UseMFAStep(ctx context.Context, userID string, step int64) error {
+	result, err := s.exec(ctx, `UPDATE user_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?`, step, userID, step)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrMFAStepUsed
+	}
+	return nil
+}
+
+// DeleteUserMFA removes the enrolment along with every recovery code
+func (s *Store) DeleteUserMFA(ctx context.Context, userID string) error {
+	if err := s.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return err
+	}
+	_, err := s.exec(ctx, `DELETE FROM user_mfa WHERE user_id = ?`, userID)
+	return err
+}
+
+func (s *Store) CreateRecoveryCode(ctx context.Context, id, userID, codeHash string) error {
+	query := `INSERT INTO mfa_recovery_code (id, user_id, code_hash, created_at) VALUES (?, ?, ?, ` + s.Dialect.Now() + `)`
+	_, err := s.exec(ctx, query, id, userID, codeHash)
+	return err
+}
+
+func (s *Store) DeleteRecoveryCodes(ctx context.Context, userID string) error {
+	_, err := s.exec(ctx, `DELETE FROM mfa_recovery_code WHERE user_id = ?`, userID)
+	return err
+}
+
+// UseRecoveryCode consumes an unused recovery code. It returns
+// ErrRecoveryCodeNotFound when the code does not exist or was already used.
+func (s *Store) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	query := `UPDATE mfa_recovery_code SET used_at = ` + s.Dialect.Now() + ` WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`
+	result, err := s.exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+	return nil
+}
+
+func (s *Store) CreateMFAChallenge(ctx context.Context, challenge *MFAChallenge) error {
+	query := `INSERT INTO mfa_challenge (id, user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, challenge.ID, challenge.UserID, challenge.TokenHash,
+		s.Dialect.TimeArg(challenge.ExpiresAt), s.Dialect.TimeArg(challenge.CreatedAt))
+	return err
+}
+
+// GetMFAChallenge looks a challenge up by its digest. Expiry is left to the
+// caller.
+func (s *Store) GetMFAChallenge(ctx context.Context, tokenHash string) (*MFAChallenge, error) {
+	var challenge MFAChallenge
+	query := `SELECT id, user_id, token_hash, attempts, expires_at, created_at FROM mfa_challenge WHERE token_hash = ?`
+	if err := s.get(ctx, &challenge, query, tokenHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFAChallengeNotFound
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// UseMFAChallengeAttempt counts a code tried against a challenge. It returns
+// ErrMFAChallengeNotFound once maxAttempts codes have been tried, or when the
+// challenge is gone, so concurrent guesses cannot exceed the limit.
+func (s *Store) UseMFAChallengeAttempt(ctx context.Context, id string, maxAttempts int) error {
+	result, err := s.exec(ctx, `UPDATE mfa_challenge SET attempts = attempts + 1 WHERE id = ? AND attempts < ?`, id, maxAttempts)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrMFAChallengeNotFound
+	}
+	return nil
+}
+
+// DeleteMFAChallenge consumes a challenge. It returns ErrMFAChallengeNotFound
+// when it is already gone, so a token completes at most one login.
+func (s *Store) DeleteMFAChallenge(ctx context.Context, id string) error {
+	result, err := s.exec(ctx, `DELETE FROM mfa_challenge WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrMFAChallengeNotFound
+	}
+	return nil
+}
+
+func (s *Store) CleanupExpiredMFAChallenges(ctx context.Context) error {
+	_, err := s.exec(ctx, `DELETE FROM mfa_challenge WHERE expires_at < ?`, s.Dialect.TimeArg(time.Now()))
+	return err
+}
+
+func (m *MockStore) GetUserMFA(ctx context.Context, userID string) (*UserMFA, error) {
+	// Mock implementation - no user has two-factor enabled
+	return nil, ErrMFANotFound
+}
+
+func (m *MockStore) SaveMFASecret(ctx context.Context, userID, secret string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) EnableMFA(ctx context.Context, userID string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) UseMFAStep(ctx context.Context, userID string, step int64) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) DeleteUserMFA(ctx context.Context, userID string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) CreateRecoveryCode(ctx context.Context, id, userID, codeHash string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) DeleteRecoveryCodes(ctx context.Context, userID string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	// Mock implementation - no recovery codes exist
+	return ErrRecoveryCodeNotFound
+}
+
+func (m *MockStore) CreateMFAChallenge(ctx context.Context, challenge *MFAChallenge) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) GetMFAChallenge(ctx context.Context, tokenHash string) (*MFAChallenge, error) {
+	// Mock implementation - no challenges are issued
+	return nil, ErrMFAChallengeNotFound
+}
+
+func (m *MockStore) UseMFAChallengeAttempt(ctx context.Context, id string, maxAttempts int) error {
+	// Mock implementation - no challenges are issued
+	return ErrMFAChallengeNotFound
+}
+
+func (m *MockStore) DeleteMFAChallenge(ctx context.Context, id string) error {
+	// Mock implementation - no challenges are issued
+	return ErrMFAChallengeNotFound
+}
+
+func (m *MockStore) CleanupExpiredMFAChallenges(ctx context.Context) error {
+	// Mock implementation - always succeeds
+	return nil
+}
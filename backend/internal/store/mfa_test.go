@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStore_MFA(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	if _, err := s.GetUserMFA(ctx, "user-1"); !errors.Is(err, ErrMFANotFound) {
+		t.Fatalf("expected ErrMFANotFound, got %v", err)
+	}
+
+	t.Run("enrolment lifecycle", func(t *testing.T) {
+		if err := s.SaveMFASecret(ctx, "user-1", "first"); err != nil {
+			t.Fatalf("failed to save secret: %v", err)
+		}
+		if err := s.UseMFAStep(ctx, "user-1", 100); err != nil {
+			t.Fatalf("failed to use step: %v", err)
+		}
+
+		// Starting over replaces the secret and resets the enrolment
+		if err := s.SaveMFASecret(ctx, "user-1", "second"); err != nil {
+			t.Fatalf("failed to replace secret: %v", err)
+		}
+		mfa, err := s.GetUserMFA(ctx, "user-1")
+		if err != nil {
+			t.Fatalf("failed to get enrolment: %v", err)
+		}
+		if mfa.Secret != "second" || mfa.EnabledAt != nil || mfa.LastUsedStep != 0 {
+			t.Errorf("expected fresh pending enrolment, got %+v", mfa)
+		}
+
+		if err := s.EnableMFA(ctx, "user-1"); err != nil {
+			t.Fatalf("failed to enable: %v", err)
+		}
+		if err := s.EnableMFA(ctx, "user-1"); !errors.Is(err, ErrMFANotFound) {
+			t.Errorf("expected second enable to fail, got %v", err)
+		}
+		mfa, _ = s.GetUserMFA(ctx, "user-1")
+		if mfa.EnabledAt == nil {
+			t.Error("expected enabled_at to be set")
+		}
+	})
+
+	t.Run("time steps cannot be replayed", func(t *testing.T) {
+		if err := s.UseMFAStep(ctx, "user-1", 200); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := s.UseMFAStep(ctx, "user-1", 200); !errors.Is(err, ErrMFAStepUsed) {
+			t.Errorf("expected ErrMFAStepUsed for same step, got %v", err)
+		}
+		if err := s.UseMFAStep(ctx, "user-1", 199); !errors.Is(err, ErrMFAStepUsed) {
+			t.Errorf("expected ErrMFAStepUsed for earlier step, got %v", err)
+		}
+	})
+
+	t.Run("recovery codes are single use", func(t *testing.T) {
+		if err := s.CreateRecoveryCode(ctx, "code-1", "user-1", "hash-1"); err != nil {
+			t.Fatalf("failed to create code: %v", err)
+		}
+		if err := s.UseRecoveryCode(ctx, "user-1", "hash-1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := s.UseRecoveryCode(ctx, "user-1", "hash-1"); !errors.Is(err, ErrRecoveryCodeNotFound) {
+			t.Errorf("expected ErrRecoveryCodeNotFound on reuse, got %v", err)
+		}
+		if err := s.UseRecoveryCode(ctx, "other-user", "hash-1"); !errors.Is(err, ErrRecoveryCodeNotFound) {
+			t.Errorf("expected codes to be scoped to their user, got %v", err)
+		}
+	})
+
+	t.Run("disable removes everything", func(t *testing.T) {
+		if err := s.CreateRecoveryCode(ctx, "code-2", "user-1", "hash-2"); err != nil {
+			t.Fatalf("failed to create code: %v", err)
+		}
+		if err := s.DeleteUserMFA(ctx, "user-1"); err != nil {
+			t.Fatalf("failed to delete: %v", err)
+		}
+		if _, err := s.GetUserMFA(ctx, "user-1"); !errors.Is(err, ErrMFANotFound) {
+			t.Errorf("expected enrolment to be gone, got %v", err)
+		}
+		if err := s.UseRecoveryCode(ctx, "user-1", "hash-2"); !errors.Is(err, ErrRecoveryCodeNotFound) {
+			t.Errorf("expected recovery codes to be gone, got %v", err)
+		}
+	})
+}
+
+func TestStore_MFAChallenge(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	challenge := &MFAChallenge{ID: "challenge-1", UserID: "user-1", TokenHash: "digest", ExpiresAt: time.Now().Add(time.Minute), CreatedAt: time.Now()}
+	if err := s.CreateMFAChallenge(ctx, challenge); err != nil {
+		t.Fatalf("failed to create challenge: %v", err)
+	}
+	expired := &MFAChallenge{ID: "challenge-2", UserID: "user-1", TokenHash: "stale", ExpiresAt: time.Now().Add(-time.Minute), CreatedAt: time.Now()}
+	if err := s.CreateMFAChallenge(ctx, expired); err != nil {
+		t.Fatalf("failed to create challenge: %v", err)
+	}
+
+	if err := s.CleanupExpiredMFAChallenges(ctx); err != nil {
+		t.Fatalf("failed to clean up: %v", err)
+	}
+	if _, err := s.GetMFAChallenge(ctx, "stale"); !errors.Is(err, ErrMFAChallengeNotFound) {
+		t.Errorf("expected the expired challenge to be gone, got %v", err)
+	}
+
+	got, err := s.GetMFAChallenge(ctx, "digest")
+	if err != nil {
+		t.Fatalf("failed to get challenge: %v", err)
+	}
+	if got.ID != "challenge-1" || got.UserID != "user-1" {
+		t.Errorf("unexpected challenge %+v", got)
+	}
+
+	for i := range 2 {
+		if err := s.UseMFAChallengeAttempt(ctx, "challenge-1", 2); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i+1, err)
+		}
+	}
+	if err := s.UseMFAChallengeAttempt(ctx, "challenge-1", 2); !errors.Is(err, ErrMFAChallengeNotFound) {
+		t.Errorf("expected the third attempt to be refused, got %v", err)
+	}
+	if got, _ := s.GetMFAChallenge(ctx, "digest"); got == nil || got.Attempts != 2 {
+		t.Errorf("expected 2 attempts recorded, got %+v", got)
+	}
+
+	if err := s.DeleteMFAChallenge(ctx, "challenge-1"); err != nil {
+		t.Fatalf("failed to delete challenge: %v", err)
+	}
+	if err := s.DeleteMFAChallenge(ctx, "challenge-1"); !errors.Is(err, ErrMFAChallengeNotFound) {
+		t.Errorf("expected a challenge to be consumed once, got %v", err)
+	}
+}
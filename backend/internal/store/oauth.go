@@ -0,0 +1,222 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// OAuthClient is an application that signs users in through the built-in
+// identity provider. SecretHash is nil for public clients, which cannot keep
+// a secret. RedirectURIs is a space separated list of exact redirect URIs.
+type OAuthClient struct {
+	ID           string     `db:"id"`
+	Name         string     `db:"name"`
+	SecretHash   *string    `db:"secret_hash"`
+	RedirectURIs string     `db:"redirect_uris"`
+	CreatedBy    *string    `db:"created_by"`
+	CreatedAt    *time.Time `db:"created_at"`
+}
+
+// OAuthConsent records the scopes a user granted a client, space separated
+type OAuthConsent struct {
+	UserID     string     `db:"user_id"`
+	ClientID   string     `db:"client_id"`
+	ClientName string     `db:"client_name"`
+	Scopes     string     `db:"scopes"`
+	CreatedAt  *time.Time `db:"created_at"`
+	UpdatedAt  *time.Time `db:"updated_at"`
+}
+
+// OAuthCode is an issued authorization code. ID is the hash of the code and
+// CodeChallenge the PKCE S256 challenge it was requested with.
+type OAuthCode struct {
+	ID            string     `db:"id"`
+	ClientID      string     `db:"client_id"`
+	UserID        string     `db:"user_id"`
+	RedirectURI   string     `db:"redirect_uri"`
+	Scopes        string     `db:"scopes"`
+	Nonce         string     `db:"nonce"`
+	CodeChallenge string     `db:"code_challenge"`
+	ExpiresAt     time.Time  `db:"expires_at"`
+	CreatedAt     *time.Time `db:"created_at"`
+}
+
+const oauthClientColumns = `id, name, secret_hash, redirect_uris, created_by, created_at`
+
+func (s *Store) CreateOAuthClient(ctx context.Context, client *OAuthClient) error {
+	query := `INSERT INTO oauth_client (id, name, secret_hash, redirect_uris, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ` + s.Dialect.Now() + `)`
+	_, err := s.exec(ctx, query, client.ID, client.Name, client.SecretHash, client.RedirectURIs, client.CreatedBy)
+	return err
+}
+
+func (s *Store) GetOAuthClient(ctx context.Context, id string) (*OAuthClient, error) {
+	var client OAuthClient
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_client WHERE id = ?`
+	if err := s.get(ctx, &client, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrClientNotFound
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (s *Store) ListOAuthClients(ctx context.Context) ([]OAuthClient, error) {
+	clients := []OAuthClient{}
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_client ORDER BY created_at, id`
+	if err := s.selectInto(ctx, &clients, query); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// DeleteOAuthClient removes a client together with its consents and codes
+func (s *Store) DeleteOAuthClient(ctx context.Context, id string) error {
+	result, err := s.exec(ctx, `DELETE FROM oauth_client WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
+
+func (s *Store) GetOAuthConsent(ctx context.Context, userID, clientID string) (*OAuthConsent, error) {
+	var consent OAuthConsent
+	query := `SELECT oc.user_id, oc.client_id, c.name AS client_name, oc.scopes, oc.created_at, oc.updated_at
+		FROM oauth_consent oc JOIN oauth_client c ON c.id = oc.client_id
+		WHERE oc.user_id = ? AND oc.client_id = ?`
+	if err := s.get(ctx, &consent, query, userID, clientID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrConsentNotFound
+		}
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (s *Store) ListOAuthConsents(ctx context.Context, userID string) ([]OAuthConsent, error) {
+	consents := []OAuthConsent{}
+	query := `SELECT oc.user_id, oc.client_id, c.name AS client_name, oc.scopes, oc.created_at, oc.updated_at
+		FROM oauth_consent oc JOIN oauth_client c ON c.id = oc.client_id
+		WHERE oc.user_id = ? ORDER BY oc.created_at, oc.client_id`
+	if err := s.selectInto(ctx, &consents, query, userID); err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
+
+// SaveOAuthConsent stores the scopes a user granted a client, replacing any
+// earlier grant
+func (s *Store) SaveOAuthConsent(ctx context.Context, userID, clientID, scopes string) error {
+	now := s.Dialect.Now()
+	query := `INSERT INTO oauth_consent (user_id, client_id, scopes, created_at, updated_at) VALUES (?, ?, ?, ` + now + `, ` + now + `)` +
+		s.Dialect.Upsert([]string{"user_id", "client_id"}, "scopes", "updated_at")
+	_, err := s.exec(ctx, query, userID, clientID, scopes)
+	return err
+}
+
+func (s *Store) DeleteOAuthConsent(ctx context.Context, userID, clientID string) error {
+	result, err := s.exec(ctx, `DELETE FROM oauth_consent WHERE user_id = ? AND client_id = ?`, userID, clientID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrConsentNotFound
+	}
+	return nil
+}
+
+func (s *Store) CreateOAuthCode(ctx context.Context, code *OAuthCode) error {
+	query := `INSERT INTO oauth_authorization_code (id, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ` + s.Dialect.Now() + `)`
+	_, err := s.exec(ctx, query, code.ID, code.ClientID, code.UserID, code.RedirectURI, code.Scopes, code.Nonce, code.CodeChallenge, s.Dialect.TimeArg(code.ExpiresAt))
+	return err
+}
+
+// TakeOAuthCode deletes an authorization code and returns it, so each code
+// can be redeemed at most once. Expiry is left to the caller.
+func (s *Store) TakeOAuthCode(ctx context.Context, id string) (*OAuthCode, error) {
+	var code OAuthCode
+	query := `DELETE FROM oauth_authorization_code WHERE id = ?` +
+		s.Dialect.Returning("id", "client_id", "user_id", "redirect_uri", "scopes", "nonce", "code_challenge", "expires_at", "created_at")
+	if err := s.get(ctx, &code, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAuthorizationCodeNotFound
+		}
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (s *Store) CleanupExpiredOAuthCodes(ctx context.Context) error {
+	_, err := s.exec(ctx, `DELETE FROM oauth_authorization_code WHERE expires_at < ?`, s.Dialect.TimeArg(time.Now()))
+	return err
+}
+
+func (m *MockStore) CreateOAuthClient(ctx context.Context, client *OAuthClient) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) GetOAuthClient(ctx context.Context, id string) (*OAuthClient, error) {
+	// Mock implementation - no clients are registered
+	return nil, ErrClientNotFound
+}
+
+func (m *MockStore) ListOAuthClients(ctx context.Context) ([]OAuthClient, error) {
+	// Mock implementation - no clients are registered
+	return []OAuthClient{}, nil
+}
+
+func (m *MockStore) DeleteOAuthClient(ctx context.Context, id string) error {
+	// Mock implementation - no clients are registered
+	return ErrClientNotFound
+}
+
+func (m *MockStore) GetOAuthConsent(ctx context.Context, userID, clientID string) (*OAuthConsent, error) {
+	// Mock implementation - nothing has been granted
+	return nil, ErrConsentNotFound
+}
+
+func (m *MockStore) ListOAuthConsents(ctx context.Context, userID string) ([]OAuthConsent, error) {
+	// Mock implementation - nothing has been granted
+	return []OAuthConsent{}, nil
+}
+
+func (m *MockStore) SaveOAuthConsent(ctx context.Context, userID, clientID, scopes string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) DeleteOAuthConsent(ctx context.Context, userID, clientID string) error {
+	// Mock implementation - nothing has been granted
+	return ErrConsentNotFound
+}
+
+func (m *MockStore) CreateOAuthCode(ctx context.Context, code *OAuthCode) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) TakeOAuthCode(ctx context.Context, id string) (*OAuthCode, error) {
+	// Mock implementation - no codes are outstanding
+	return nil, ErrAuthorizationCodeNotFound
+}
+
+func (m *MockStore) CleanupExpiredOAuthCodes(ctx context.Context) error {
+	// Mock implementation - always succeeds
+	return nil
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStore_OAuthClients(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	secret := "secret-hash"
+	createdBy := "user-1"
+	for _, client := range []*OAuthClient{
+		{ID: "client-1", Name: "Wiki", SecretHash: &secret, RedirectURIs: "https://wiki.example.com/callback", CreatedBy: &createdBy},
+		{ID: "client-2", Name: "CLI", RedirectURIs: "http://127.0.0.1:8765/callback"},
+	} {
+		if err := s.CreateOAuthClient(ctx, client); err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+	}
+
+	got, err := s.GetOAuthClient(ctx, "client-1")
+	if err != nil {
+		t.Fatalf("failed to get client: %v", err)
+	}
+	if got.Name != "Wiki" || got.SecretHash == nil || *got.SecretHash != secret || got.CreatedBy == nil {
+		t.Errorf("unexpected client: %+v", got)
+	}
+	public, _ := s.GetOAuthClient(ctx, "client-2")
+	if public == nil || public.SecretHash != nil {
+		t.Errorf("expected a public client without a secret, got %+v", public)
+	}
+	if _, err := s.GetOAuthClient(ctx, "missing"); !errors.Is(err, ErrClientNotFound) {
+		t.Errorf("expected ErrClientNotFound, got %v", err)
+	}
+
+	clients, err := s.ListOAuthClients(ctx)
+	if err != nil || len(clients) != 2 {
+		t.Fatalf("expected two clients, got %d (%v)", len(clients), err)
+	}
+
+	if err := s.SaveOAuthConsent(ctx, "user-1", "client-1", "openid"); err != nil {
+		t.Fatalf("failed to save consent: %v", err)
+	}
+	if err := s.DeleteOAuthClient(ctx, "client-1"); err != nil {
+		t.Fatalf("failed to delete client: %v", err)
+	}
+	if err := s.DeleteOAuthClient(ctx, "client-1"); !errors.Is(err, ErrClientNotFound) {
+		t.Errorf("expected ErrClientNotFound, got %v", err)
+	}
+	if _, err := s.GetOAuthConsent(ctx, "user-1", "client-1"); !errors.Is(err, ErrConsentNotFound) {
+		t.Errorf("expected consents to be removed with the client, got %v", err)
+	}
+}
+
+func TestStore_OAuthConsents(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := s.CreateOAuthClient(ctx, &OAuthClient{ID: "client-1", Name: "Wiki", RedirectURIs: "https://wiki.example.com/callback"}); err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	if _, err := s.GetOAuthConsent(ctx, "user-1", "client-1"); !errors.Is(err, ErrConsentNotFound) {
+		t.Errorf("expected ErrConsentNotFound, got %v", err)
+	}
+
+	if err := s.SaveOAuthConsent(ctx, "user-1", "client-1", "openid"); err != nil {
+		t.Fatalf("failed to save consent: %v", err)
+	}
+	if err := s.SaveOAuthConsent(ctx, "user-1", "client-1", "openid email"); err != nil {
+		t.Fatalf("failed to update consent: %v", err)
+	}
+
+	consent, err := s.GetOAuthConsent(ctx, "user-1", "client-1")
+	if err != nil {
+		t.Fatalf("failed to get consent: %v", err)
+	}
+	if consent.Scopes != "openid email" || consent.ClientName != "Wiki" {
+		t.Errorf("unexpected consent: %+v", consent)
+	}
+
+	consents, err := s.ListOAuthConsents(ctx, "user-1")
+	if err != nil || len(consents) != 1 {
+		t.Fatalf("expected one consent, got %d (%v)", len(consents), err)
+	}
+
+	if err := s.DeleteOAuthConsent(ctx, "user-1", "client-1"); err != nil {
+		t.Fatalf("failed to delete consent: %v", err)
+	}
+	if err := s.DeleteOAuthConsent(ctx, "user-1", "client-1"); !errors.Is(err, ErrConsentNotFound) {
+		t.Errorf("expected ErrConsentNotFound, got %v", err)
+	}
+}
+
+func TestStore_OAuthCodes(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := s.CreateOAuthClient(ctx, &OAuthClient{ID: "client-1", Name: "Wiki", RedirectURIs: "https://wiki.example.com/callback"}); err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	for _, code := range []*OAuthCode{
+		{ID: "code-1", ClientID: "client-1", UserID: "user-1", RedirectURI: "https://wiki.example.com/callback", Scopes: "openid", Nonce: "n", CodeChallenge: "c", ExpiresAt: time.Now().Add(time.Minute)},
+		{ID: "code-2", ClientID: "client-1", UserID: "user-1", RedirectURI: "https://wiki.example.com/callback", Scopes: "openid", CodeChallenge: "c", ExpiresAt: time.Now().Add(-time.Minute)},
+	} {
+		if err := s.CreateOAuthCode(ctx, code); err != nil {
+			t.Fatalf("failed to create code: %v", err)
+		}
+	}
+
+	code, err := s.TakeOAuthCode(ctx, "code-1")
+	if err != nil {
+		t.Fatalf("failed to take code: %v", err)
+	}
+	if code.UserID != "user-1" || code.Nonce != "n" || code.Scopes != "openid" || code.ExpiresAt.Before(time.Now()) {
+		t.Errorf("unexpected code: %+v", code)
+	}
+	if _, err := s.TakeOAuthCode(ctx, "code-1"); !errors.Is(err, ErrAuthorizationCodeNotFound) {
+		t.Errorf("expected a code to be redeemable once, got %v", err)
+	}
+
+	if err := s.CleanupExpiredOAuthCodes(ctx); err != nil {
+		t.Fatalf("failed to clean up codes: %v", err)
+	}
+	if _, err := s.TakeOAuthCode(ctx, "code-2"); !errors.Is(err, ErrAuthorizationCodeNotFound) {
+		t.Errorf("expected expired codes to be cleaned up, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+)
+
+// AddPasswordHistory remembers a password hash the user has just replaced
+func (s *Store) AddPasswordHistory(ctx context.Context, userID, passwordHash string) error {
+	query := `INSERT INTO password_history (user_id, password_hash, created_at) VALUES (?, ?, ` + s.Dialect.Now() + `)`
+	_, err := s.exec(ctx, query, userID, passwordHash)
+	return err
+}
+
+// GetPasswordHistory returns up to limit of the user's previous password
+// hashes, most recent first
+func (s *Store) GetPasswordHistory(ctx context.Context, userID string, limit int) ([]string, error) {
+	hashes := []string{}
+	query := `SELECT password_hash FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?`
+	if err := s.selectInto(ctx, &hashes, query, userID, limit); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// PrunePasswordHistory forgets all but the user's keep most recent
+// previous password hashes
+func (s *Store) PrunePasswordHistory(ctx context.Context, userID string, keep int) error {
+	query := `DELETE FROM password_history WHERE user_id = ? AND id NOT IN (
+		SELECT id FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?)`
+	_, err := s.exec(ctx, query, userID, userID, keep)
+	return err
+}
+
+func (m *MockStore) AddPasswordHistory(ctx context.Context, userID, passwordHash string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) GetPasswordHistory(ctx context.Context, userID string, limit int) ([]string, error) {
+	// Mock implementation - no previous passwords
+	return []string{}, nil
+}
+
+func (m *MockStore) PrunePasswordHistory(ctx context.Context, userID string, keep int) error {
+	// Mock implementation - always succeeds
+	return nil
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestStore_PasswordHistory(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	for _, user := range []struct{ id, username string }{{"user-1", "alice"}, {"user-2", "bob"}} {
+		if err := s.CreateUser(ctx, user.id, user.username, "", "hash"); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	if hashes, err := s.GetPasswordHistory(ctx, "user-1", 5); err != nil || len(hashes) != 0 {
+		t.Errorf("expected an empty history, got %v (%v)", hashes, err)
+	}
+
+	for _, hash := range []string{"hash-1", "hash-2", "hash-3", "hash-4"} {
+		if err := s.AddPasswordHistory(ctx, "user-1", hash); err != nil {
+			t.Fatalf("failed to add password history: %v", err)
+		}
+	}
+	if err := s.AddPasswordHistory(ctx, "user-2", "other"); err != nil {
+		t.Fatalf("failed to add password history: %v", err)
+	}
+
+	hashes, err := s.GetPasswordHistory(ctx, "user-1", 3)
+	if err != nil {
+		t.Fatalf("failed to get password history: %v", err)
+	}
+	if want := []string{"hash-4", "hash-3", "hash-2"}; !reflect.DeepEqual(hashes, want) {
+		t.Errorf("expected %v, got %v", want, hashes)
+	}
+
+	// Pruning keeps the most recent hashes of that user only
+	if err := s.PrunePasswordHistory(ctx, "user-1", 2); err != nil {
+		t.Fatalf("failed to prune password history: %v", err)
+	}
+	hashes, _ = s.GetPasswordHistory(ctx, "user-1", 10)
+	if want := []string{"hash-4", "hash-3"}; !reflect.DeepEqual(hashes, want) {
+		t.Errorf("expected %v, got %v", want, hashes)
+	}
+	if hashes, _ := s.GetPasswordHistory(ctx, "user-2", 10); len(hashes) != 1 {
+		t.Errorf("expected the other user's history to be kept, got %v", hashes)
+	}
+
+	if err := s.PrunePasswordHistory(ctx, "user-1", 0); err != nil {
+		t.Fatalf("failed to prune password history: %v", err)
+	}
+	if hashes, _ := s.GetPasswordHistory(ctx, "user-1", 10); len(hashes) != 0 {
+		t.Errorf("expected the history to be cleared, got %v", hashes)
+	}
+}
@@ -0,0 +1,92 @@
+package store
+
+import "context"
+
+// Built-in role names seeded by the roles migration
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+func (s *Store) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	var roles []string
+	err := s.selectInto(ctx, &roles, `SELECT role_name FROM user_role WHERE user_id = ? ORDER BY role_name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (s *Store) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	var permissions []string
+	query := `SELECT DISTINCT rp.permission_name FROM user_role ur JOIN role_permission rp ON rp.role_name = ur.role_name WHERE ur.user_id = ? ORDER BY rp.permission_name`
+	err := s.selectInto(ctx, &permissions, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// AssignRole grants a role to a user. Assigning a role the user already has is a no-op.
+func (s *Store) AssignRole(ctx context.Context, userID, role string) error {
+	var count int
+	if err := s.get(ctx, &count, `SELECT COUNT(*) FROM role WHERE name = ?`, role); err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrRoleNotFound
+	}
+
+	query := `INSERT INTO user_role (user_id, role_name, created_at) VALUES (?, ?, ` + s.Dialect.Now() + `)` +
+		s.Dialect.Upsert([]string{"user_id", "role_name"})
+	_, err := s.exec(ctx, query, userID, role)
+	return err
+}
+
+func (s *Store) RemoveRole(ctx context.Context, userID, role string) error {
+	_, err := s.exec(ctx, `DELETE FROM user_role WHERE user_id = ? AND role_name = ?`, userID, role)
+	return err
+}
+
+// ClaimAdminBootstrap records userID as the instance's first admin and
+// reports whether it was the first to do so. The claim is a single-row
+// insert, so it holds between concurrent transactions: a competing claim
+// waits for the first to commit and then finds the row taken.
+func (s *Store) ClaimAdminBootstrap(ctx context.Context, userID string) (bool, error) {
+	query := `INSERT INTO admin_bootstrap (id, user_id, created_at) VALUES (1, ?, ` + s.Dialect.Now() + `)` +
+		s.Dialect.Upsert([]string{"id"})
+	result, err := s.exec(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func (m *MockStore) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	// Mock implementation - every user has the default role
+	return []string{RoleUser}, nil
+}
+
+func (m *MockStore) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	// Mock implementation - the default role carries no permissions
+	return []string{}, nil
+}
+
+func (m *MockStore) AssignRole(ctx context.Context, userID, role string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) RemoveRole(ctx context.Context, userID, role string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) ClaimAdminBootstrap(ctx context.Context, userID string) (bool, error) {
+	// Mock implementation - the instance already has an admin
+	return false, nil
+}
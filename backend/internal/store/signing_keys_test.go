@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStore_SigningKeys(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	now := time.Now()
+	for _, key := range []*SigningKey{
+		{ID: "old", Algorithm: "EdDSA", PrivateKey: "pem-old", CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "new", Algorithm: "EdDSA", PrivateKey: "pem-new", CreatedAt: now.Add(-time.Hour)},
+	} {
+		if err := s.CreateSigningKey(ctx, key); err != nil {
+			t.Fatalf("failed to create signing key: %v", err)
+		}
+	}
+
+	keys, err := s.ListSigningKeys(ctx)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("expected two keys, got %d (%v)", len(keys), err)
+	}
+	if keys[0].ID != "new" || keys[0].PrivateKey != "pem-new" || keys[0].ExpiresAt != nil {
+		t.Errorf("expected the newest key first, got %+v", keys[0])
+	}
+
+	// Retiring keeps the key for verification until it expires
+	if err := s.RetireSigningKeys(ctx, "new", now.Add(time.Hour)); err != nil {
+		t.Fatalf("failed to retire keys: %v", err)
+	}
+	keys, _ = s.ListSigningKeys(ctx)
+	if len(keys) != 2 || keys[1].ExpiresAt == nil || keys[0].ExpiresAt != nil {
+		t.Fatalf("expected only the old key to be retired, got %+v", keys)
+	}
+
+	if err := s.RetireSigningKeys(ctx, "other", now.Add(-time.Minute)); err != nil {
+		t.Fatalf("failed to retire keys: %v", err)
+	}
+	keys, _ = s.ListSigningKeys(ctx)
+	if len(keys) != 1 || keys[0].ID != "old" {
+		t.Fatalf("expected expired keys to be left out, got %+v", keys)
+	}
+
+	if err := s.DeleteExpiredSigningKeys(ctx); err != nil {
+		t.Fatalf("failed to delete expired keys: %v", err)
+	}
+	var count int
+	if err := s.DB.Get(&count, `SELECT COUNT(*) FROM signing_key`); err != nil || count != 1 {
+		t.Errorf("expected one key to remain, got %d (%v)", count, err)
+	}
+}
@@ -1,7 +1,12 @@
 package store
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -12,16 +17,64 @@ var (
 	ErrUserNotFound  = errors.New("user not found")
 	ErrTokenNotFound = errors.New("password reset token not found")
 	ErrTokenExpired  = errors.New("password reset token expired")
+
+	ErrSessionNotFound = errors.New("session not found")
+	ErrRoleNotFound    = errors.New("role not found")
+	ErrInvalidCursor   = errors.New("invalid pagination cursor")
+	ErrInvalidColumn   = errors.New("column cannot be updated")
+
+	ErrMFANotFound          = errors.New("two-factor enrolment not found")
+	ErrMFAStepUsed          = errors.New("two-factor code already used")
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+	ErrMFAChallengeNotFound = errors.New("two-factor challenge not found")
+
+	ErrCredentialNotFound = errors.New("passkey not found")
+	ErrSignCountChanged   = errors.New("passkey sign count changed concurrently")
+	ErrChallengeNotFound  = errors.New("passkey challenge not found")
+
+	ErrIdentityNotFound    = errors.New("linked identity not found")
+	ErrAuthRequestNotFound = errors.New("authorization request not found")
+
+	ErrClientNotFound            = errors.New("oauth client not found")
+	ErrConsentNotFound           = errors.New("oauth consent not found")
+	ErrAuthorizationCodeNotFound = errors.New("authorization code not found")
+
+	ErrAPIKeyNotFound = errors.New("api key not found")
+
+	ErrVerificationTokenNotFound = errors.New("email verification token not found")
+	ErrEmailChangeNotFound       = errors.New("email change not found")
+
+	ErrLoginThrottleNotFound = errors.New("login throttle not found")
+
+	ErrMagicLinkNotFound = errors.New("magic link not found")
+
+	ErrOutboxEmpty         = errors.New("no queued email is due")
+	ErrOutboxEmailNotFound = errors.New("queued email not found")
 )
 
+// userColumns is the column list selected into User
+const userColumns = `id, username, email, email_verified_at, password_hash, age, created_at, updated_at`
+
+// userUpdatableColumns whitelists the columns UpdateUser may set. Column
+// names are interpolated into SQL, so callers' map keys must never reach a
+// query without passing this check.
+var userUpdatableColumns = map[string]bool{
+	"username":          true,
+	"email":             true,
+	"email_verified_at": true,
+	"age":               true,
+	"password_hash":     true,
+}
+
 type User struct {
-	ID           string     `db:"id"`
-	Username     string     `db:"username"`
-	Email        *string    `db:"email"`
-	PasswordHash string     `db:"password_hash"`
-	Age          *int       `db:"age"`
-	CreatedAt    *time.Time `db:"created_at"`
-	UpdatedAt    *time.Time `db:"updated_at"`
+	ID              string     `db:"id"`
+	Username        string     `db:"username"`
+	Email           *string    `db:"email"`
+	EmailVerifiedAt *time.Time `db:"email_verified_at"`
+	PasswordHash    string     `db:"password_hash"`
+	Age             *int       `db:"age"`
+	CreatedAt       *time.Time `db:"created_at"`
+	UpdatedAt       *time.Time `db:"updated_at"`
 }
 
 type PasswordResetToken struct {
@@ -33,221 +86,283 @@ type PasswordResetToken struct {
 	CreatedAt *time.Time `db:"created_at"`
 }
 
+// queryer is the subset of sqlx shared by *sqlx.DB and *sqlx.Tx, so the same
+// query methods run either directly against the pool or inside a transaction.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
 type Store struct {
-	DB       *sqlx.DB
-	IsSQLite bool
+	DB      *sqlx.DB
+	Dialect Dialect
+
+	q  queryer
+	tx *sqlx.Tx
 }
 
 func New(db *sqlx.DB, isSQLite bool) *Store {
-	return &Store{DB: db, IsSQLite: isSQLite}
+	dialect := PostgresDialect
+	if isSQLite {
+		dialect = SQLiteDialect
+	}
+	return &Store{DB: db, Dialect: dialect, q: db}
 }
 
-func (s *Store) CreateUser(id, username, email, passwordHash string) error {
-	var query string
-	if s.IsSQLite {
-		query = `INSERT INTO "user" (id, username, email, password_hash, created_at, updated_at) VALUES (?, ?, ?, ?, datetime('now'), datetime('now'))`
-	} else {
-		query = `INSERT INTO "user" (id, username, email, password_hash, created_at, updated_at) VALUES ($1, $2, $3, $4, NOW(), NOW())`
+// WithTx runs fn inside a database transaction. The StoreInterface passed to
+// fn is bound to that transaction; the transaction is committed when fn
+// returns nil and rolled back otherwise. Calling WithTx on a store that is
+// already bound to a transaction joins the outer transaction.
+func (s *Store) WithTx(ctx context.Context, fn func(StoreInterface) error) (err error) {
+	if s.tx != nil {
+		return fn(s)
 	}
-	_, err := s.DB.Exec(query, id, username, email, passwordHash)
+
+	tx, err := s.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			err = fmt.Errorf("commit transaction: %w", err)
+		}
+	}()
+
+	return fn(&Store{DB: s.DB, Dialect: s.Dialect, q: tx, tx: tx})
+}
+
+func (s *Store) CreateUser(ctx context.Context, id, username, email, passwordHash string) error {
+	now := s.Dialect.Now()
+	query := `INSERT INTO "user" (id, username, email, password_hash, created_at, updated_at) VALUES (?, ?, ?, ?, ` + now + `, ` + now + `)`
+	_, err := s.exec(ctx, query, id, username, nullIfEmpty(email), passwordHash)
 	return err
 }
 
-func (s *Store) GetUserByID(id string) (*User, error) {
+func (s *Store) GetUserByID(ctx context.Context, id string) (*User, error) {
 	var user User
-	var query string
-	if s.IsSQLite {
-		query = `SELECT id, username, email, password_hash, age, created_at, updated_at FROM "user" WHERE id = ?`
-	} else {
-		query = `SELECT id, username, email, password_hash, age, created_at, updated_at FROM "user" WHERE id = $1`
-	}
-	err := s.DB.Get(&user, query, id)
+	query := `SELECT ` + userColumns + ` FROM "user" WHERE id = ?`
+	err := s.get(ctx, &user, query, id)
 	if err != nil {
 		return nil, ErrUserNotFound
 	}
 	return &user, nil
 }
 
-func (s *Store) GetUserByUsername(username string) (*User, error) {
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (*User, error) {
 	var user User
-	var query string
-	if s.IsSQLite {
-		query = `SELECT id, username, email, password_hash, age, created_at, updated_at FROM "user" WHERE username = ?`
-	} else {
-		query = `SELECT id, username, email, password_hash, age, created_at, updated_at FROM "user" WHERE username = $1`
-	}
-	err := s.DB.Get(&user, query, username)
+	query := `SELECT ` + userColumns + ` FROM "user" WHERE username = ?`
+	err := s.get(ctx, &user, query, username)
 	if err != nil {
 		return nil, ErrUserNotFound
 	}
 	return &user, nil
 }
 
-func (s *Store) GetUserByEmail(email string) (*User, error) {
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	var user User
-	var query string
-	if s.IsSQLite {
-		query = `SELECT id, username, email, password_hash, age, created_at, updated_at FROM "user" WHERE email = ?`
-	} else {
-		query = `SELECT id, username, email, password_hash, age, created_at, updated_at FROM "user" WHERE email = $1`
-	}
-	err := s.DB.Get(&user, query, email)
+	query := `SELECT ` + userColumns + ` FROM "user" WHERE email = ?`
+	err := s.get(ctx, &user, query, email)
 	if err != nil {
 		return nil, ErrUserNotFound
 	}
 	return &user, nil
 }
 
-func (s *Store) UpdateUser(id string, updates map[string]interface{}) error {
+// UpdateUser sets the given columns on a user and bumps updated_at. Only
+// columns listed in userUpdatableColumns are accepted; anything else returns
+// ErrInvalidColumn without touching the row.
+func (s *Store) UpdateUser(ctx context.Context, id string, updates map[string]interface{}) error {
 	if len(updates) == 0 {
 		return nil
 	}
 
-	// Add updated_at timestamp
-	updates["updated_at"] = "NOW()"
-
-	var query string
-	var args []interface{}
-	argIndex := 1
-
-	// Build dynamic query
-	setClause := ""
-	for field, value := range updates {
-		if setClause != "" {
-			setClause += ", "
-		}
-		if s.IsSQLite {
-			setClause += field + " = ?"
-		} else {
-			setClause += field + " = $" + string(rune('0'+argIndex))
+	// Sort the columns so the same update always produces the same statement
+	columns := make([]string, 0, len(updates))
+	for column := range updates {
+		if !userUpdatableColumns[column] {
+			return fmt.Errorf("%w: %q", ErrInvalidColumn, column)
 		}
-		args = append(args, value)
-		argIndex++
+		columns = append(columns, column)
 	}
+	sort.Strings(columns)
 
-	if s.IsSQLite {
-		query = `UPDATE "user" SET ` + setClause + ` WHERE id = ?`
-	} else {
-		query = `UPDATE "user" SET ` + setClause + ` WHERE id = $` + string(rune('0'+argIndex))
+	setClause := make([]string, 0, len(columns)+1)
+	args := make([]interface{}, 0, len(columns)+1)
+	for _, column := range columns {
+		setClause = append(setClause, column+" = ?")
+		args = append(args, updates[column])
 	}
+	setClause = append(setClause, "updated_at = "+s.Dialect.Now())
 	args = append(args, id)
 
-	_, err := s.DB.Exec(query, args...)
+	query := `UPDATE "user" SET ` + strings.Join(setClause, ", ") + ` WHERE id = ?`
+	_, err := s.exec(ctx, query, args...)
 	return err
 }
 
-func (s *Store) DeleteUser(id string) error {
-	var query string
-	if s.IsSQLite {
-		query = `DELETE FROM "user" WHERE id = ?`
-	} else {
-		query = `DELETE FROM "user" WHERE id = $1`
-	}
-	_, err := s.DB.Exec(query, id)
+func (s *Store) DeleteUser(ctx context.Context, id string) error {
+	_, err := s.exec(ctx, `DELETE FROM "user" WHERE id = ?`, id)
 	return err
 }
 
-func (s *Store) CreateSession(id, userID string, expiresAt string) error {
-	var query string
-	if s.IsSQLite {
-		query = `INSERT INTO session (id, user_id, expires_at) VALUES (?, ?, ?)`
-	} else {
-		query = `INSERT INTO session (id, user_id, expires_at) VALUES ($1, $2, $3)`
-	}
-	_, err := s.DB.Exec(query, id, userID, expiresAt)
+func (s *Store) CreateSession(ctx context.Context, id, userID, refreshTokenHash string, expiresAt time.Time) error {
+	query := `INSERT INTO session (id, user_id, refresh_token_hash, expires_at, created_at) VALUES (?, ?, ?, ?, ` + s.Dialect.Now() + `)`
+	_, err := s.exec(ctx, query, id, userID, refreshTokenHash, s.Dialect.TimeArg(expiresAt))
 	return err
 }
 
-func (s *Store) GetSession(id string) (*Session, error) {
+func (s *Store) GetSession(ctx context.Context, id string) (*Session, error) {
 	var session Session
-	var query string
-	if s.IsSQLite {
-		query = `SELECT id, user_id, expires_at FROM session WHERE id = ?`
-	} else {
-		query = `SELECT id, user_id, expires_at FROM session WHERE id = $1`
-	}
-	err := s.DB.Get(&session, query, id)
+	query := `SELECT id, user_id, refresh_token_hash, expires_at, created_at, last_used_at FROM session WHERE id = ?`
+	err := s.get(ctx, &session, query, id)
 	if err != nil {
-		return nil, err
+		return nil, ErrSessionNotFound
 	}
 	return &session, nil
 }
 
-func (s *Store) DeleteSession(id string) error {
-	var query string
-	if s.IsSQLite {
-		query = `DELETE FROM session WHERE id = ?`
-	} else {
-		query = `DELETE FROM session WHERE id = $1`
+// RotateSession swaps the refresh token hash of a session, but only if the
+// presented hash is still the current one, and keeps the old hash for the
+// life of the session to detect its reuse. It returns ErrSessionNotFound when
+// no row matched, which callers treat as a reused refresh token.
+func (s *Store) RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error {
+	// The old hash is kept before it is replaced, so a failure in between
+	// leaves it current rather than forgotten
+	query := `INSERT INTO session_refresh_token (session_id, token_hash, created_at) SELECT id, refresh_token_hash, ` + s.Dialect.Now() + ` FROM session WHERE id = ? AND refresh_token_hash = ?` +
+		s.Dialect.Upsert([]string{"session_id", "token_hash"})
+	if _, err := s.exec(ctx, query, id, oldHash); err != nil {
+		return err
+	}
+
+	query = `UPDATE session SET refresh_token_hash = ?, expires_at = ?, last_used_at = ` + s.Dialect.Now() + ` WHERE id = ? AND refresh_token_hash = ?`
+	result, err := s.exec(ctx, query, newHash, s.Dialect.TimeArg(expiresAt), id, oldHash)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
 	}
-	_, err := s.DB.Exec(query, id)
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// IsRotatedRefreshToken reports whether the session has rotated away from the
+// refresh token with the given hash
+func (s *Store) IsRotatedRefreshToken(ctx context.Context, sessionID, tokenHash string) (bool, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM session_refresh_token WHERE session_id = ? AND token_hash = ?`
+	if err := s.get(ctx, &count, query, sessionID, tokenHash); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *Store) DeleteSession(ctx context.Context, id string) error {
+	_, err := s.exec(ctx, `DELETE FROM session WHERE id = ?`, id)
+	return err
+}
+
+func (s *Store) DeleteUserSessions(ctx context.Context, userID string) error {
+	_, err := s.exec(ctx, `DELETE FROM session WHERE user_id = ?`, userID)
 	return err
 }
 
 // Password reset token methods
-func (s *Store) CreatePasswordResetToken(id, userID, token string, expiresAt time.Time) error {
-	var query string
-	if s.IsSQLite {
-		query = `INSERT INTO password_reset_token (id, user_id, token, expires_at, used, created_at) VALUES (?, ?, ?, ?, ?, datetime('now'))`
-	} else {
-		query = `INSERT INTO password_reset_token (id, user_id, token, expires_at, used, created_at) VALUES ($1, $2, $3, $4, $5, NOW())`
-	}
-	_, err := s.DB.Exec(query, id, userID, token, expiresAt, false)
+func (s *Store) CreatePasswordResetToken(ctx context.Context, id, userID, token string, expiresAt time.Time) error {
+	query := `INSERT INTO password_reset_token (id, user_id, token, expires_at, used, created_at) VALUES (?, ?, ?, ?, ?, ` + s.Dialect.Now() + `)`
+	_, err := s.exec(ctx, query, id, userID, token, s.Dialect.TimeArg(expiresAt), false)
 	return err
 }
 
-func (s *Store) GetPasswordResetToken(token string) (*PasswordResetToken, error) {
+func (s *Store) GetPasswordResetToken(ctx context.Context, token string) (*PasswordResetToken, error) {
 	var resetToken PasswordResetToken
-	var query string
-	if s.IsSQLite {
-		query = `SELECT id, user_id, token, expires_at, used, created_at FROM password_reset_token WHERE token = ?`
-	} else {
-		query = `SELECT id, user_id, token, expires_at, used, created_at FROM password_reset_token WHERE token = $1`
-	}
-	err := s.DB.Get(&resetToken, query, token)
+	query := `SELECT id, user_id, token, expires_at, used, created_at FROM password_reset_token WHERE token = ?`
+	err := s.get(ctx, &resetToken, query, token)
 	if err != nil {
 		return nil, ErrTokenNotFound
 	}
 	return &resetToken, nil
 }
 
-func (s *Store) MarkPasswordResetTokenUsed(id string) error {
-	var query string
-	if s.IsSQLite {
-		query = `UPDATE password_reset_token SET used = ? WHERE id = ?`
-	} else {
-		query = `UPDATE password_reset_token SET used = $1 WHERE id = $2`
+func (s *Store) MarkPasswordResetTokenUsed(ctx context.Context, id string) error {
+	// Only an unused token can be consumed, so two concurrent resets with the
+	// same token cannot both succeed.
+	result, err := s.exec(ctx, `UPDATE password_reset_token SET used = ? WHERE id = ? AND used = ?`, true, id, false)
+	if err != nil {
+		return err
 	}
-	_, err := s.DB.Exec(query, true, id)
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// DeletePasswordResetTokens invalidates every reset link issued to the user
+func (s *Store) DeletePasswordResetTokens(ctx context.Context, userID string) error {
+	_, err := s.exec(ctx, `DELETE FROM password_reset_token WHERE user_id = ?`, userID)
 	return err
 }
 
-func (s *Store) CleanupExpiredPasswordResetTokens() error {
-	var query string
-	if s.IsSQLite {
-		query = `DELETE FROM password_reset_token WHERE expires_at < datetime('now') OR used = ?`
-	} else {
-		query = `DELETE FROM password_reset_token WHERE expires_at < NOW() OR used = $1`
-	}
-	_, err := s.DB.Exec(query, true)
+func (s *Store) CleanupExpiredPasswordResetTokens(ctx context.Context) error {
+	query := `DELETE FROM password_reset_token WHERE expires_at < ` + s.Dialect.Now() + ` OR used = ?`
+	_, err := s.exec(ctx, query, true)
 	return err
 }
 
+// exec, get and selectInto rebind a query written with ? placeholders for the
+// active dialect and run it on the pool or the current transaction.
+func (s *Store) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.q.ExecContext(ctx, s.Dialect.Rebind(query), args...)
+}
+
+func (s *Store) get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return s.q.GetContext(ctx, dest, s.Dialect.Rebind(query), args...)
+}
+
+func (s *Store) selectInto(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return s.q.SelectContext(ctx, dest, s.Dialect.Rebind(query), args...)
+}
+
 type Session struct {
-	ID        string `db:"id"`
-	UserID    string `db:"user_id"`
-	ExpiresAt string `db:"expires_at"`
+	ID                       string     `db:"id"`
+	UserID                   string     `db:"user_id"`
+	RefreshTokenHash         string     `db:"refresh_token_hash"`
+	ExpiresAt                time.Time  `db:"expires_at"`
+	CreatedAt                *time.Time `db:"created_at"`
+	LastUsedAt               *time.Time `db:"last_used_at"`
 }
 
 // MockStore is a mock implementation for development when database is not available
 type MockStore struct{}
 
-func (m *MockStore) CreateUser(id, username, email, passwordHash string) error {
+func (m *MockStore) WithTx(ctx context.Context, fn func(StoreInterface) error) error {
+	// Mock implementation - no transaction, just run fn against the mock
+	return fn(m)
+}
+
+func (m *MockStore) CreateUser(ctx context.Context, id, username, email, passwordHash string) error {
 	// Mock implementation - always succeeds
 	return nil
 }
 
-func (m *MockStore) GetUserByID(id string) (*User, error) {
+func (m *MockStore) GetUserByID(ctx context.Context, id string) (*User, error) {
 	// Mock implementation - return a mock user
 	return &User{
 		ID:           id,
@@ -257,7 +372,7 @@ func (m *MockStore) GetUserByID(id string) (*User, error) {
 	}, nil
 }
 
-func (m *MockStore) GetUserByUsername(username string) (*User, error) {
+func (m *MockStore) GetUserByUsername(ctx context.Context, username string) (*User, error) {
 	// Mock implementation - return a mock user for any username
 	return &User{
 		ID:           "mock-id",
@@ -267,7 +382,7 @@ func (m *MockStore) GetUserByUsername(username string) (*User, error) {
 	}, nil
 }
 
-func (m *MockStore) GetUserByEmail(email string) (*User, error) {
+func (m *MockStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	// Mock implementation - return a mock user for any email
 	return &User{
 		ID:           "mock-id",
@@ -277,51 +392,80 @@ func (m *MockStore) GetUserByEmail(email string) (*User, error) {
 	}, nil
 }
 
-func (m *MockStore) UpdateUser(id string, updates map[string]interface{}) error {
+func (m *MockStore) UpdateUser(ctx context.Context, id string, updates map[string]interface{}) error {
 	// Mock implementation - always succeeds
 	return nil
 }
 
-func (m *MockStore) DeleteUser(id string) error {
+func (m *MockStore) DeleteUser(ctx context.Context, id string) error {
 	// Mock implementation - always succeeds
 	return nil
 }
 
-func (m *MockStore) CreateSession(id, userID string, expiresAt string) error {
+func (m *MockStore) CreateSession(ctx context.Context, id, userID, refreshTokenHash string, expiresAt time.Time) error {
 	// Mock implementation - always succeeds
 	return nil
 }
 
-func (m *MockStore) GetSession(id string) (*Session, error) {
+func (m *MockStore) GetSession(ctx context.Context, id string) (*Session, error) {
 	// Mock implementation - return nil (no session found)
-	return nil, errors.New("session not found")
+	return nil, ErrSessionNotFound
 }
 
-func (m *MockStore) DeleteSession(id string) error {
+func (m *MockStore) RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error {
+	// Mock implementation - no session to rotate
+	return ErrSessionNotFound
+}
+
+func (m *MockStore) IsRotatedRefreshToken(ctx context.Context, sessionID, tokenHash string) (bool, error) {
+	// Mock implementation - no refresh token has been rotated
+	return false, nil
+}
+
+func (m *MockStore) DeleteSession(ctx context.Context, id string) error {
 	// Mock implementation - always succeeds
 	return nil
 }
 
-func (m *MockStore) CreatePasswordResetToken(id, userID, token string, expiresAt time.Time) error {
+func (m *MockStore) DeleteUserSessions(ctx context.Context, userID string) error {
 	// Mock implementation - always succeeds
 	return nil
 }
 
-func (m *MockStore) GetPasswordResetToken(token string) (*PasswordResetToken, error) {
+func (m *MockStore) CreatePasswordResetToken(ctx context.Context, id, userID, token string, expiresAt time.Time) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) GetPasswordResetToken(ctx context.Context, token string) (*PasswordResetToken, error) {
 	// Mock implementation - return nil (no token found)
 	return nil, ErrTokenNotFound
 }
 
-func (m *MockStore) MarkPasswordResetTokenUsed(id string) error {
+func (m *MockStore) MarkPasswordResetTokenUsed(ctx context.Context, id string) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) CleanupExpiredPasswordResetTokens(ctx context.Context) error {
 	// Mock implementation - always succeeds
 	return nil
 }
 
-func (m *MockStore) CleanupExpiredPasswordResetTokens() error {
+func (m *MockStore) DeletePasswordResetTokens(ctx context.Context, userID string) error {
 	// Mock implementation - always succeeds
 	return nil
 }
 
+// nullIfEmpty stores optional text columns as NULL rather than an empty string,
+// so unique constraints only apply to values that were actually provided
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 // Helper function to create string pointer
 func stringPtr(s string) *string {
 	return &s
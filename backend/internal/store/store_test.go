@@ -1,8 +1,15 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
@@ -23,16 +30,51 @@ func setupTestDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock, func()) {
 	return sqlxDB, mock, cleanup
 }
 
+// setupSQLiteDB opens an in-memory SQLite database with every SQLite migration applied
+func setupSQLiteDB(t *testing.T) *Store {
+	t.Helper()
+
+	db, err := sqlx.Connect("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open sqlite db: %v", err)
+	}
+	// Each connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+		t.Fatalf("failed to enable foreign keys: %v", err)
+	}
+
+	files, err := filepath.Glob("../../migrations/sqlite/*.up.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("failed to find sqlite migrations: %v", err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file, err)
+		}
+		if _, err := db.Exec(string(migration)); err != nil {
+			t.Fatalf("failed to apply %s: %v", file, err)
+		}
+	}
+
+	return New(db, true)
+}
+
 func TestStore_CreateUser(t *testing.T) {
 	db, mock, cleanup := setupTestDB(t)
 	defer cleanup()
 
-	store := New(db)
+	store := New(db, false)
 
 	tests := []struct {
 		name         string
 		id           string
 		username     string
+		email        string
 		passwordHash string
 		expectError  bool
 		setupMock    func()
@@ -41,11 +83,12 @@ func TestStore_CreateUser(t *testing.T) {
 			name:         "successful user creation",
 			id:           "123",
 			username:     "testuser",
+			email:        "test@example.com",
 			passwordHash: "hashedpassword",
 			expectError:  false,
 			setupMock: func() {
 				mock.ExpectExec("INSERT INTO \"user\"").
-					WithArgs("123", "testuser", "hashedpassword").
+					WithArgs("123", "testuser", "test@example.com", "hashedpassword").
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 		},
@@ -53,11 +96,12 @@ func TestStore_CreateUser(t *testing.T) {
 			name:         "database error",
 			id:           "123",
 			username:     "testuser",
+			email:        "test@example.com",
 			passwordHash: "hashedpassword",
 			expectError:  true,
 			setupMock: func() {
 				mock.ExpectExec("INSERT INTO \"user\"").
-					WithArgs("123", "testuser", "hashedpassword").
+					WithArgs("123", "testuser", "test@example.com", "hashedpassword").
 					WillReturnError(sql.ErrConnDone)
 			},
 		},
@@ -67,7 +111,7 @@ func TestStore_CreateUser(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setupMock()
 
-			err := store.CreateUser(tt.id, tt.username, tt.passwordHash)
+			err := store.CreateUser(context.Background(), tt.id, tt.username, tt.email, tt.passwordHash)
 
 			if tt.expectError && err == nil {
 				t.Errorf("expected error but got none")
@@ -88,7 +132,7 @@ func TestStore_GetUserByID(t *testing.T) {
 	db, mock, cleanup := setupTestDB(t)
 	defer cleanup()
 
-	store := New(db)
+	store := New(db, false)
 
 	tests := []struct {
 		name        string
@@ -101,9 +145,9 @@ func TestStore_GetUserByID(t *testing.T) {
 			id:          "123",
 			expectError: false,
 			setupMock: func() {
-				rows := sqlmock.NewRows([]string{"id", "username", "password_hash", "age"}).
-					AddRow("123", "testuser", "hashedpassword", nil)
-				mock.ExpectQuery("SELECT id, username, password_hash, age FROM \"user\" WHERE id = \\$1").
+				rows := sqlmock.NewRows([]string{"id", "username", "email", "email_verified_at", "password_hash", "age", "created_at", "updated_at"}).
+					AddRow("123", "testuser", nil, nil, "hashedpassword", nil, nil, nil)
+				mock.ExpectQuery("SELECT id, username, email, email_verified_at, password_hash, age, created_at, updated_at FROM \"user\" WHERE id = \\$1").
 					WithArgs("123").
 					WillReturnRows(rows)
 			},
@@ -113,7 +157,7 @@ func TestStore_GetUserByID(t *testing.T) {
 			id:          "456",
 			expectError: true,
 			setupMock: func() {
-				mock.ExpectQuery("SELECT id, username, password_hash, age FROM \"user\" WHERE id = \\$1").
+				mock.ExpectQuery("SELECT id, username, email, email_verified_at, password_hash, age, created_at, updated_at FROM \"user\" WHERE id = \\$1").
 					WithArgs("456").
 					WillReturnError(sql.ErrNoRows)
 			},
@@ -124,7 +168,7 @@ func TestStore_GetUserByID(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setupMock()
 
-			user, err := store.GetUserByID(tt.id)
+			user, err := store.GetUserByID(context.Background(), tt.id)
 
 			if tt.expectError {
 				if err == nil {
@@ -156,7 +200,7 @@ func TestStore_GetUserByUsername(t *testing.T) {
 	db, mock, cleanup := setupTestDB(t)
 	defer cleanup()
 
-	store := New(db)
+	store := New(db, false)
 
 	tests := []struct {
 		name        string
@@ -169,9 +213,9 @@ func TestStore_GetUserByUsername(t *testing.T) {
 			username:    "testuser",
 			expectError: false,
 			setupMock: func() {
-				rows := sqlmock.NewRows([]string{"id", "username", "password_hash", "age"}).
-					AddRow("123", "testuser", "hashedpassword", nil)
-				mock.ExpectQuery("SELECT id, username, password_hash, age FROM \"user\" WHERE username = \\$1").
+				rows := sqlmock.NewRows([]string{"id", "username", "email", "email_verified_at", "password_hash", "age", "created_at", "updated_at"}).
+					AddRow("123", "testuser", nil, nil, "hashedpassword", nil, nil, nil)
+				mock.ExpectQuery("SELECT id, username, email, email_verified_at, password_hash, age, created_at, updated_at FROM \"user\" WHERE username = \\$1").
 					WithArgs("testuser").
 					WillReturnRows(rows)
 			},
@@ -181,7 +225,7 @@ func TestStore_GetUserByUsername(t *testing.T) {
 			username:    "nonexistent",
 			expectError: true,
 			setupMock: func() {
-				mock.ExpectQuery("SELECT id, username, password_hash, age FROM \"user\" WHERE username = \\$1").
+				mock.ExpectQuery("SELECT id, username, email, email_verified_at, password_hash, age, created_at, updated_at FROM \"user\" WHERE username = \\$1").
 					WithArgs("nonexistent").
 					WillReturnError(sql.ErrNoRows)
 			},
@@ -192,7 +236,7 @@ func TestStore_GetUserByUsername(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setupMock()
 
-			user, err := store.GetUserByUsername(tt.username)
+			user, err := store.GetUserByUsername(context.Background(), tt.username)
 
 			if tt.expectError {
 				if err == nil {
@@ -220,17 +264,82 @@ func TestStore_GetUserByUsername(t *testing.T) {
 	}
 }
 
+func TestStore_UpdateUser(t *testing.T) {
+	db, mock, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	store := New(db, false)
+
+	t.Run("builds numbered placeholders in column order", func(t *testing.T) {
+		mock.ExpectExec(`UPDATE "user" SET age = \$1, email = \$2, password_hash = \$3, username = \$4, updated_at = NOW\(\) WHERE id = \$5`).
+			WithArgs(30, "new@example.com", "hash", "renamed", "123").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := store.UpdateUser(context.Background(), "123", map[string]interface{}{
+			"username":      "renamed",
+			"email":         "new@example.com",
+			"age":           30,
+			"password_hash": "hash",
+		})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("rejects unknown columns", func(t *testing.T) {
+		err := store.UpdateUser(context.Background(), "123", map[string]interface{}{
+			"id = 'x'; --": "boom",
+		})
+		if !errors.Is(err, ErrInvalidColumn) {
+			t.Errorf("expected ErrInvalidColumn, got %v", err)
+		}
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestStore_UpdateUserSQLite(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "before", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if _, err := s.DB.Exec(`UPDATE "user" SET updated_at = '2000-01-01 00:00:00' WHERE id = ?`, "user-1"); err != nil {
+		t.Fatalf("failed to backdate user: %v", err)
+	}
+
+	if err := s.UpdateUser(ctx, "user-1", map[string]interface{}{"username": "after", "age": 42}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	user, err := s.GetUserByID(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if user.Username != "after" || user.Age == nil || *user.Age != 42 {
+		t.Errorf("update not applied: %+v", user)
+	}
+	if user.UpdatedAt == nil || user.UpdatedAt.Year() < 2020 {
+		t.Errorf("expected updated_at to be refreshed, got %v", user.UpdatedAt)
+	}
+}
+
 func TestStore_CreateSession(t *testing.T) {
 	db, mock, cleanup := setupTestDB(t)
 	defer cleanup()
 
-	store := New(db)
+	store := New(db, false)
+	expiresAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 
 	tests := []struct {
 		name        string
 		id          string
 		userID      string
-		expiresAt   string
+		hash        string
+		expiresAt   time.Time
 		expectError bool
 		setupMock   func()
 	}{
@@ -238,11 +347,12 @@ func TestStore_CreateSession(t *testing.T) {
 			name:        "successful session creation",
 			id:          "session123",
 			userID:      "user123",
-			expiresAt:   "2024-01-01T00:00:00Z",
+			hash:        "refreshhash",
+			expiresAt:   expiresAt,
 			expectError: false,
 			setupMock: func() {
 				mock.ExpectExec("INSERT INTO session").
-					WithArgs("session123", "user123", "2024-01-01T00:00:00Z").
+					WithArgs("session123", "user123", "refreshhash", expiresAt).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 		},
@@ -250,11 +360,12 @@ func TestStore_CreateSession(t *testing.T) {
 			name:        "database error",
 			id:          "session123",
 			userID:      "user123",
-			expiresAt:   "2024-01-01T00:00:00Z",
+			hash:        "refreshhash",
+			expiresAt:   expiresAt,
 			expectError: true,
 			setupMock: func() {
 				mock.ExpectExec("INSERT INTO session").
-					WithArgs("session123", "user123", "2024-01-01T00:00:00Z").
+					WithArgs("session123", "user123", "refreshhash", expiresAt).
 					WillReturnError(sql.ErrConnDone)
 			},
 		},
@@ -264,7 +375,7 @@ func TestStore_CreateSession(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setupMock()
 
-			err := store.CreateSession(tt.id, tt.userID, tt.expiresAt)
+			err := store.CreateSession(context.Background(), tt.id, tt.userID, tt.hash, tt.expiresAt)
 
 			if tt.expectError && err == nil {
 				t.Errorf("expected error but got none")
@@ -281,18 +392,226 @@ func TestStore_CreateSession(t *testing.T) {
 	}
 }
 
+func TestStore_RotateSession(t *testing.T) {
+	db, mock, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	store := New(db, false)
+	expiresAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		rowsUpdated int64
+		expectedErr error
+	}{
+		{
+			name:        "current token rotated",
+			rowsUpdated: 1,
+			expectedErr: nil,
+		},
+		{
+			name:        "stale token rejected",
+			rowsUpdated: 0,
+			expectedErr: ErrSessionNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock.ExpectExec("INSERT INTO session_refresh_token \\(session_id, token_hash, created_at\\) SELECT id, refresh_token_hash, NOW\\(\\) FROM session WHERE id = \\$1 AND refresh_token_hash = \\$2 ON CONFLICT").
+				WithArgs("session123", "oldhash").
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsUpdated))
+			mock.ExpectExec("UPDATE session SET refresh_token_hash = \\$1, expires_at = \\$2, last_used_at = NOW\\(\\) WHERE id = \\$3 AND refresh_token_hash = \\$4").
+				WithArgs("newhash", expiresAt, "session123", "oldhash").
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsUpdated))
+
+			err := store.RotateSession(context.Background(), "session123", "oldhash", "newhash", expiresAt)
+			if err != tt.expectedErr {
+				t.Errorf("expected error %v, got %v", tt.expectedErr, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestStore_RotateSession_KeepsRotatedHashes(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	expiresAt := time.Now().Add(time.Hour)
+	if err := s.CreateSession(ctx, "session-1", "user-1", "first", expiresAt); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	for _, hashes := range [][2]string{{"first", "second"}, {"second", "third"}, {"third", "fourth"}} {
+		if err := s.RotateSession(ctx, "session-1", hashes[0], hashes[1], expiresAt); err != nil {
+			t.Fatalf("failed to rotate %s: %v", hashes[0], err)
+		}
+	}
+	// A stale hash neither rotates nor counts as issued
+	if err := s.RotateSession(ctx, "session-1", "stale", "fifth", expiresAt); err != ErrSessionNotFound {
+		t.Fatalf("expected ErrSessionNotFound for a stale hash, got %v", err)
+	}
+
+	// Tokens from any earlier rotation are remembered, not only the last one
+	for hash, want := range map[string]bool{"first": true, "second": true, "third": true, "fourth": false, "stale": false} {
+		rotated, err := s.IsRotatedRefreshToken(ctx, "session-1", hash)
+		if err != nil {
+			t.Fatalf("failed to look up %s: %v", hash, err)
+		}
+		if rotated != want {
+			t.Errorf("expected rotated %v for %s, got %v", want, hash, rotated)
+		}
+	}
+
+	// They go with the session
+	if err := s.DeleteSession(ctx, "session-1"); err != nil {
+		t.Fatalf("failed to delete session: %v", err)
+	}
+	if rotated, err := s.IsRotatedRefreshToken(ctx, "session-1", "first"); err != nil || rotated {
+		t.Errorf("expected rotated hashes to be deleted with the session, got %v, %v", rotated, err)
+	}
+}
+
+func TestStore_WithTx(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	t.Run("commits on success", func(t *testing.T) {
+		err := s.WithTx(ctx, func(tx StoreInterface) error {
+			if err := tx.CreateUser(ctx, "tx-1", "committed", "", "hash"); err != nil {
+				return err
+			}
+			return tx.AssignRole(ctx, "tx-1", RoleUser)
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := s.GetUserByID(ctx, "tx-1"); err != nil {
+			t.Errorf("expected committed user, got %v", err)
+		}
+		roles, err := s.GetUserRoles(ctx, "tx-1")
+		if err != nil || len(roles) != 1 {
+			t.Errorf("expected committed role, got %v (%v)", roles, err)
+		}
+	})
+
+	t.Run("rolls back on error", func(t *testing.T) {
+		err := s.WithTx(ctx, func(tx StoreInterface) error {
+			if err := tx.CreateUser(ctx, "tx-2", "rolledback", "", "hash"); err != nil {
+				return err
+			}
+			return tx.AssignRole(ctx, "tx-2", "no-such-role")
+		})
+		if !errors.Is(err, ErrRoleNotFound) {
+			t.Fatalf("expected ErrRoleNotFound, got %v", err)
+		}
+
+		if _, err := s.GetUserByID(ctx, "tx-2"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("expected user to be rolled back, got %v", err)
+		}
+	})
+
+	t.Run("nested call joins outer transaction", func(t *testing.T) {
+		sentinel := errors.New("abort")
+		err := s.WithTx(ctx, func(tx StoreInterface) error {
+			err := tx.WithTx(ctx, func(inner StoreInterface) error {
+				return inner.CreateUser(ctx, "tx-3", "nested", "", "hash")
+			})
+			if err != nil {
+				return err
+			}
+			return sentinel
+		})
+		if !errors.Is(err, sentinel) {
+			t.Fatalf("expected sentinel error, got %v", err)
+		}
+
+		if _, err := s.GetUserByID(ctx, "tx-3"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("expected nested insert to be rolled back, got %v", err)
+		}
+	})
+
+	t.Run("honours cancelled context", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err := s.WithTx(cancelled, func(tx StoreInterface) error {
+			return nil
+		})
+		if err == nil {
+			t.Error("expected error for cancelled context")
+		}
+	})
+}
+
+func TestStore_ClaimAdminBootstrap(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	// A claim rolled back with its registration leaves the bootstrap open
+	sentinel := errors.New("abort")
+	err := s.WithTx(ctx, func(tx StoreInterface) error {
+		if first, err := tx.ClaimAdminBootstrap(ctx, "user-0"); err != nil || !first {
+			t.Fatalf("expected the first claim to win, got %v (%v)", first, err)
+		}
+		return sentinel
+	})
+	if !errors.Is(err, sentinel) {
+		t.Fatalf("expected sentinel error, got %v", err)
+	}
+
+	for i, expected := range []bool{true, false, false} {
+		first, err := s.ClaimAdminBootstrap(ctx, fmt.Sprintf("user-%d", i+1))
+		if err != nil {
+			t.Fatalf("claim %d: unexpected error: %v", i+1, err)
+		}
+		if first != expected {
+			t.Errorf("claim %d: expected %v, got %v", i+1, expected, first)
+		}
+	}
+}
+
+func TestStore_MarkPasswordResetTokenUsed(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "resetter", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := s.CreatePasswordResetToken(ctx, "token-1", "user-1", "secret", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	if err := s.MarkPasswordResetTokenUsed(ctx, "token-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A token can only be consumed once
+	if err := s.MarkPasswordResetTokenUsed(ctx, "token-1"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("expected ErrTokenNotFound on second use, got %v", err)
+	}
+}
+
 func TestMockStore(t *testing.T) {
 	mockStore := &MockStore{}
 
 	t.Run("CreateUser", func(t *testing.T) {
-		err := mockStore.CreateUser("123", "testuser", "hashedpassword")
+		err := mockStore.CreateUser(context.Background(), "123", "testuser", "test@example.com", "hashedpassword")
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
 	})
 
 	t.Run("GetUserByID", func(t *testing.T) {
-		user, err := mockStore.GetUserByID("123")
+		user, err := mockStore.GetUserByID(context.Background(), "123")
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
@@ -305,7 +624,7 @@ func TestMockStore(t *testing.T) {
 	})
 
 	t.Run("GetUserByUsername", func(t *testing.T) {
-		user, err := mockStore.GetUserByUsername("testuser")
+		user, err := mockStore.GetUserByUsername(context.Background(), "testuser")
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
@@ -318,14 +637,14 @@ func TestMockStore(t *testing.T) {
 	})
 
 	t.Run("CreateSession", func(t *testing.T) {
-		err := mockStore.CreateSession("session123", "user123", "2024-01-01T00:00:00Z")
+		err := mockStore.CreateSession(context.Background(), "session123", "user123", "refreshhash", time.Now().Add(time.Hour))
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
 	})
 
 	t.Run("GetSession", func(t *testing.T) {
-		session, err := mockStore.GetSession("session123")
+		session, err := mockStore.GetSession(context.Background(), "session123")
 		if err == nil {
 			t.Errorf("expected error but got none")
 		}
@@ -335,7 +654,7 @@ func TestMockStore(t *testing.T) {
 	})
 
 	t.Run("DeleteSession", func(t *testing.T) {
-		err := mockStore.DeleteSession("session123")
+		err := mockStore.DeleteSession(context.Background(), "session123")
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sort keys accepted by ListUsers, mapped to the expression used in ORDER BY.
+// Nullable columns are coalesced so keyset comparisons stay well defined.
+var userSortColumns = map[string]string{
+	"created_at": "created_at",
+	"username":   "username",
+	"email":      "COALESCE(email, '')",
+	"age":        "COALESCE(age, -1)",
+}
+
+// UserListOptions controls filtering, sorting and pagination of ListUsers.
+// When Cursor is set it takes precedence over Offset.
+type UserListOptions struct {
+	Search        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	MinAge        *int
+	MaxAge        *int
+	SortBy        string
+	SortDesc      bool
+	Limit         int
+	Offset        int
+	Cursor        string
+}
+
+// UserList is one page of users plus the total number of matching rows
+type UserList struct {
+	Users      []User
+	Total      int
+	NextCursor string
+}
+
+// userCursor is the decoded form of an opaque pagination cursor. It records
+// the sort it was issued for so it cannot be replayed against another ordering.
+type userCursor struct {
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d"`
+	Value  string `json:"v"`
+	ID     string `json:"id"`
+}
+
+func (s *Store) ListUsers(ctx context.Context, opts UserListOptions) (*UserList, error) {
+	if opts.SortBy == "" {
+		opts.SortBy = "created_at"
+	}
+	sortExpr, ok := userSortColumns[opts.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort field %q", opts.SortBy)
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "?"
+	}
+
+	var conditions []string
+	if opts.Search != "" {
+		pattern := "%" + escapeLike(strings.ToLower(opts.Search)) + "%"
+		conditions = append(conditions, fmt.Sprintf(
+			`(LOWER(username) LIKE %s ESCAPE '\' OR LOWER(COALESCE(email, '')) LIKE %s ESCAPE '\')`,
+			arg(pattern), arg(pattern)))
+	}
+	if opts.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= "+arg(s.Dialect.TimeArg(*opts.CreatedAfter)))
+	}
+	if opts.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(s.Dialect.TimeArg(*opts.CreatedBefore)))
+	}
+	if opts.MinAge != nil {
+		conditions = append(conditions, "age >= "+arg(*opts.MinAge))
+	}
+	if opts.MaxAge != nil {
+		conditions = append(conditions, "age <= "+arg(*opts.MaxAge))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := s.get(ctx, &total, `SELECT COUNT(*) FROM "user"`+where, args...); err != nil {
+		return nil, err
+	}
+
+	direction, comparison := "ASC", ">"
+	if opts.SortDesc {
+		direction, comparison = "DESC", "<"
+	}
+
+	pageConditions := conditions
+	if opts.Cursor != "" {
+		cursor, err := decodeUserCursor(opts.Cursor)
+		if err != nil || cursor.SortBy != opts.SortBy || cursor.Desc != opts.SortDesc {
+			return nil, ErrInvalidCursor
+		}
+		value, err := s.cursorArg(opts.SortBy, cursor.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		v1, v2, id := arg(value), arg(value), arg(cursor.ID)
+		pageConditions = append(pageConditions, fmt.Sprintf("(%s %s %s OR (%s = %s AND id %s %s))",
+			sortExpr, comparison, v1, sortExpr, v2, comparison, id))
+	}
+
+	pageWhere := ""
+	if len(pageConditions) > 0 {
+		pageWhere = " WHERE " + strings.Join(pageConditions, " AND ")
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	query := `SELECT ` + userColumns + ` FROM "user"` + pageWhere +
+		fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", sortExpr, direction, direction, arg(opts.Limit+1))
+	if opts.Cursor == "" && opts.Offset > 0 {
+		query += " OFFSET " + arg(opts.Offset)
+	}
+
+	users := []User{}
+	if err := s.selectInto(ctx, &users, query, args...); err != nil {
+		return nil, err
+	}
+
+	list := &UserList{Total: total}
+	if len(users) > opts.Limit {
+		users = users[:opts.Limit]
+		list.NextCursor = encodeUserCursor(opts.SortBy, opts.SortDesc, users[len(users)-1])
+	}
+	list.Users = users
+
+	return list, nil
+}
+
+// cursorArg turns the string form of a sort key back into a typed query argument
+func (s *Store) cursorArg(sortBy, value string) (interface{}, error) {
+	switch sortBy {
+	case "created_at":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, err
+		}
+		return s.Dialect.TimeArg(t), nil
+	case "age":
+		return strconv.Atoi(value)
+	default:
+		return value, nil
+	}
+}
+
+func encodeUserCursor(sortBy string, desc bool, last User) string {
+	cursor := userCursor{SortBy: sortBy, Desc: desc, ID: last.ID}
+	switch sortBy {
+	case "created_at":
+		if last.CreatedAt != nil {
+			cursor.Value = last.CreatedAt.UTC().Format(time.RFC3339Nano)
+		}
+	case "username":
+		cursor.Value = last.Username
+	case "email":
+		if last.Email != nil {
+			cursor.Value = *last.Email
+		}
+	case "age":
+		cursor.Value = "-1"
+		if last.Age != nil {
+			cursor.Value = strconv.Itoa(*last.Age)
+		}
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeUserCursor(encoded string) (*userCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var cursor userCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// escapeLike escapes LIKE wildcards so user input only ever matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (m *MockStore) ListUsers(ctx context.Context, opts UserListOptions) (*UserList, error) {
+	// Mock implementation - return a single mock user
+	user, _ := m.GetUserByID(ctx, "mock-id")
+	return &UserList{Users: []User{*user}, Total: 1}, nil
+}
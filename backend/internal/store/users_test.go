@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func seedListUsers(t *testing.T, s *Store) {
+	t.Helper()
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	users := []struct {
+		username string
+		email    string
+		age      interface{}
+	}{
+		{"alice", "alice@example.com", 30},
+		{"bob", "bob@example.com", 25},
+		{"carol", "carol@corp.example", nil},
+		{"dave", "", 41},
+		{"erin_admin", "erin@corp.example", 35},
+		{"frank", "frank@example.com", 25},
+	}
+
+	for i, u := range users {
+		if err := s.CreateUser(context.Background(), fmt.Sprintf("id-%d", i), u.username, u.email, "hash"); err != nil {
+			t.Fatalf("failed to create %s: %v", u.username, err)
+		}
+		createdAt := base.Add(time.Duration(i) * 24 * time.Hour).Format("2006-01-02 15:04:05")
+		if _, err := s.DB.Exec(`UPDATE "user" SET age = ?, created_at = ? WHERE id = ?`, u.age, createdAt, fmt.Sprintf("id-%d", i)); err != nil {
+			t.Fatalf("failed to update %s: %v", u.username, err)
+		}
+	}
+}
+
+func usernames(users []User) []string {
+	names := make([]string, 0, len(users))
+	for _, u := range users {
+		names = append(names, u.Username)
+	}
+	return names
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestStore_ListUsers(t *testing.T) {
+	s := setupSQLiteDB(t)
+	seedListUsers(t, s)
+
+	after := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		opts          UserListOptions
+		expectedNames []string
+		expectedTotal int
+	}{
+		{
+			name:          "default sort is oldest first",
+			opts:          UserListOptions{Limit: 3},
+			expectedNames: []string{"alice", "bob", "carol"},
+			expectedTotal: 6,
+		},
+		{
+			name:          "search matches username or email case-insensitively",
+			opts:          UserListOptions{Search: "CORP", Limit: 10},
+			expectedNames: []string{"carol", "erin_admin"},
+			expectedTotal: 2,
+		},
+		{
+			name:          "search treats wildcards literally",
+			opts:          UserListOptions{Search: "_admin", Limit: 10},
+			expectedNames: []string{"erin_admin"},
+			expectedTotal: 1,
+		},
+		{
+			name:          "created_at range",
+			opts:          UserListOptions{CreatedAfter: &after, CreatedBefore: &before, Limit: 10},
+			expectedNames: []string{"carol", "dave"},
+			expectedTotal: 2,
+		},
+		{
+			name:          "age range excludes unknown ages",
+			opts:          UserListOptions{MinAge: intPtr(25), MaxAge: intPtr(30), Limit: 10},
+			expectedNames: []string{"alice", "bob", "frank"},
+			expectedTotal: 3,
+		},
+		{
+			name:          "sort by age descending breaks ties by id",
+			opts:          UserListOptions{SortBy: "age", SortDesc: true, Limit: 10},
+			expectedNames: []string{"dave", "erin_admin", "alice", "frank", "bob", "carol"},
+			expectedTotal: 6,
+		},
+		{
+			name:          "offset pagination",
+			opts:          UserListOptions{SortBy: "username", Limit: 2, Offset: 2},
+			expectedNames: []string{"carol", "dave"},
+			expectedTotal: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := s.ListUsers(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := usernames(list.Users); fmt.Sprint(got) != fmt.Sprint(tt.expectedNames) {
+				t.Errorf("expected users %v, got %v", tt.expectedNames, got)
+			}
+			if list.Total != tt.expectedTotal {
+				t.Errorf("expected total %d, got %d", tt.expectedTotal, list.Total)
+			}
+		})
+	}
+}
+
+func TestStore_ListUsersCursor(t *testing.T) {
+	s := setupSQLiteDB(t)
+	seedListUsers(t, s)
+
+	for _, sortBy := range []string{"created_at", "username", "email", "age"} {
+		for _, desc := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s desc=%v", sortBy, desc), func(t *testing.T) {
+				full, err := s.ListUsers(context.Background(), UserListOptions{SortBy: sortBy, SortDesc: desc, Limit: 100})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				var walked []User
+				cursor := ""
+				for page := 0; page < 10; page++ {
+					list, err := s.ListUsers(context.Background(), UserListOptions{SortBy: sortBy, SortDesc: desc, Limit: 4, Cursor: cursor})
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					walked = append(walked, list.Users...)
+					if list.NextCursor == "" {
+						break
+					}
+					cursor = list.NextCursor
+				}
+
+				if fmt.Sprint(usernames(walked)) != fmt.Sprint(usernames(full.Users)) {
+					t.Errorf("cursor walk %v does not match full listing %v", usernames(walked), usernames(full.Users))
+				}
+			})
+		}
+	}
+
+	t.Run("cursor from another sort is rejected", func(t *testing.T) {
+		list, err := s.ListUsers(context.Background(), UserListOptions{SortBy: "username", Limit: 2})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, err = s.ListUsers(context.Background(), UserListOptions{SortBy: "age", Limit: 2, Cursor: list.NextCursor})
+		if err != ErrInvalidCursor {
+			t.Errorf("expected ErrInvalidCursor, got %v", err)
+		}
+	})
+
+	t.Run("garbage cursor is rejected", func(t *testing.T) {
+		_, err := s.ListUsers(context.Background(), UserListOptions{Limit: 2, Cursor: "not-a-cursor"})
+		if err != ErrInvalidCursor {
+			t.Errorf("expected ErrInvalidCursor, got %v", err)
+		}
+	})
+}
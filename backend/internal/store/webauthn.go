@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// WebAuthn ceremonies a challenge can be issued for
+const (
+	CeremonyRegistration = "registration"
+	CeremonyLogin        = "login"
+)
+
+// WebAuthnCredential is a registered passkey. CredentialID is the base64url
+// id chosen by the authenticator and PublicKey its COSE encoded key.
+// Transports is a comma separated list of the hints the browser reported.
+type WebAuthnCredential struct {
+	ID           string     `db:"id"`
+	UserID       string     `db:"user_id"`
+	CredentialID string     `db:"credential_id"`
+	PublicKey    []byte     `db:"public_key"`
+	SignCount    int64      `db:"sign_count"`
+	Transports   string     `db:"transports"`
+	Name         string     `db:"name"`
+	CreatedAt    *time.Time `db:"created_at"`
+	LastUsedAt   *time.Time `db:"last_used_at"`
+}
+
+// WebAuthnChallenge is a pending ceremony. UserID is nil for a login that
+// did not name an account.
+type WebAuthnChallenge struct {
+	ID        string     `db:"id"`
+	UserID    *string    `db:"user_id"`
+	Ceremony  string     `db:"ceremony"`
+	Challenge string     `db:"challenge"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	CreatedAt *time.Time `db:"created_at"`
+}
+
+const webAuthnCredentialColumns = `id, user_id, credential_id, public_key, sign_count, transports, name, created_at, last_used_at`
+
+func (s *Store) CreateWebAuthnCredential(ctx context.Context, cred *WebAuthnCredential) error {
+	query := `INSERT INTO webauthn_credential (id, user_id, credential_id, public_key, sign_count, transports, name, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ` + s.Dialect.Now() + `)`
+	_, err := s.exec(ctx, query, cred.ID, cred.UserID, cred.CredentialID, cred.PublicKey, cred.SignCount, cred.Transports, cred.Name)
+	return err
+}
+
+func (s *Store) GetWebAuthnCredential(ctx context.Context, credentialID string) (*WebAuthnCredential, error) {
+	var cred WebAuthnCredential
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM webauthn_credential WHERE credential_id = ?`
+	if err := s.get(ctx, &cred, query, credentialID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCredentialNotFound
+		}
+		return nil, err
+	}
+	return &cred, nil
+}
+
+func (s *Store) ListWebAuthnCredentials(ctx context.Context, userID string) ([]WebAuthnCredential, error) {
+	creds := []WebAuthnCredential{}
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM webauthn_credential WHERE user_id = ? ORDER BY created_at, id`
+	if err := s.selectInto(ctx, &creds, query, userID); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// UpdateWebAuthnSignCount records a successful assertion. It only applies
+// when the stored count is still oldCount, returning ErrSignCountChanged if
+// another login with the same credential got there first.
+func (s *Store) UpdateWebAuthnSignCount(ctx context.Context, id string, oldCount, newCount int64) error {
+	query := `UPDATE webauthn_credential SET sign_count = ?, last_used_at = ` + s.Dialect.Now() + ` WHERE id = ? AND sign_count = ?`
+	result, err := s.exec(ctx, query, newCount, id, oldCount)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrSignCountChanged
+	}
+	return nil
+}
+
+// DeleteWebAuthnCredential removes one of the user's passkeys by its row id
+func (s *Store) DeleteWebAuthnCredential(ctx context.Context, id, userID string) error {
+	result, err := s.exec(ctx, `DELETE FROM webauthn_credential WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+// CreateWebAuthnChallenge stores a pending ceremony. An empty userID is
+// stored as NULL.
+func (s *Store) CreateWebAuthnChallenge(ctx context.Context, id, userID, ceremony, challenge string, expiresAt time.Time) error {
+	var owner interface{}
+	if userID != "" {
+		owner = userID
+	}
+	query := `INSERT INTO webauthn_challenge (id, user_id, ceremony, challenge, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ` + s.Dialect.Now() + `)`
+	_, err := s.exec(ctx, query, id, owner, ceremony, challenge, s.Dialect.TimeArg(expiresAt))
+	return err
+}
+
+// TakeWebAuthnChallenge deletes a pending ceremony and returns it, so each
+// challenge can be answered at most once. Expiry is left to the caller.
+func (s *Store) TakeWebAuthnChallenge(ctx context.Context, id string) (*WebAuthnChallenge, error) {
+	var challenge WebAuthnChallenge
+	query := `DELETE FROM webauthn_challenge WHERE id = ?` +
+		s.Dialect.Returning("id", "user_id", "ceremony", "challenge", "expires_at", "created_at")
+	if err := s.get(ctx, &challenge, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrChallengeNotFound
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (s *Store) CleanupExpiredWebAuthnChallenges(ctx context.Context) error {
+	_, err := s.exec(ctx, `DELETE FROM webauthn_challenge WHERE expires_at < ?`, s.Dialect.TimeArg(time.Now()))
+	return err
+}
+
+func (m *MockStore) CreateWebAuthnCredential(ctx context.Context, cred *WebAuthnCredential) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) GetWebAuthnCredential(ctx context.Context, credentialID string) (*WebAuthnCredential, error) {
+	// Mock implementation - no passkeys are registered
+	return nil, ErrCredentialNotFound
+}
+
+func (m *MockStore) ListWebAuthnCredentials(ctx context.Context, userID string) ([]WebAuthnCredential, error) {
+	// Mock implementation - no passkeys are registered
+	return []WebAuthnCredential{}, nil
+}
+
+func (m *MockStore) UpdateWebAuthnSignCount(ctx context.Context, id string, oldCount, newCount int64) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) DeleteWebAuthnCredential(ctx context.Context, id, userID string) error {
+	// Mock implementation - no passkeys are registered
+	return ErrCredentialNotFound
+}
+
+func (m *MockStore) CreateWebAuthnChallenge(ctx context.Context, id, userID, ceremony, challenge string, expiresAt time.Time) error {
+	// Mock implementation - always succeeds
+	return nil
+}
+
+func (m *MockStore) TakeWebAuthnChallenge(ctx context.Context, id string) (*WebAuthnChallenge, error) {
+	// Mock implementation - no ceremonies are pending
+	return nil, ErrChallengeNotFound
+}
+
+func (m *MockStore) CleanupExpiredWebAuthnChallenges(ctx context.Context) error {
+	// Mock implementation - always succeeds
+	return nil
+}
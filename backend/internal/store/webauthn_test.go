@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStore_WebAuthnCredentials(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := s.CreateUser(ctx, "user-2", "bob", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	cred := &WebAuthnCredential{
+		ID:           "pk-1",
+		UserID:       "user-1",
+		CredentialID: "Y3JlZC0x",
+		PublicKey:    []byte{0xa5, 0x01, 0x02},
+		SignCount:    3,
+		Transports:   "internal,hybrid",
+		Name:         "Laptop",
+	}
+	if err := s.CreateWebAuthnCredential(ctx, cred); err != nil {
+		t.Fatalf("failed to create credential: %v", err)
+	}
+
+	got, err := s.GetWebAuthnCredential(ctx, "Y3JlZC0x")
+	if err != nil {
+		t.Fatalf("failed to get credential: %v", err)
+	}
+	if got.UserID != "user-1" || string(got.PublicKey) != string(cred.PublicKey) || got.SignCount != 3 || got.LastUsedAt != nil {
+		t.Errorf("unexpected credential: %+v", got)
+	}
+
+	t.Run("sign count update is conditional", func(t *testing.T) {
+		if err := s.UpdateWebAuthnSignCount(ctx, "pk-1", 3, 4); err != nil {
+			t.Fatalf("failed to update sign count: %v", err)
+		}
+		if err := s.UpdateWebAuthnSignCount(ctx, "pk-1", 3, 4); !errors.Is(err, ErrSignCountChanged) {
+			t.Errorf("expected ErrSignCountChanged, got %v", err)
+		}
+		got, _ := s.GetWebAuthnCredential(ctx, "Y3JlZC0x")
+		if got.SignCount != 4 || got.LastUsedAt == nil {
+			t.Errorf("expected count 4 and last use recorded, got %+v", got)
+		}
+	})
+
+	t.Run("only the owner can delete", func(t *testing.T) {
+		if err := s.DeleteWebAuthnCredential(ctx, "pk-1", "user-2"); !errors.Is(err, ErrCredentialNotFound) {
+			t.Errorf("expected ErrCredentialNotFound, got %v", err)
+		}
+		creds, err := s.ListWebAuthnCredentials(ctx, "user-1")
+		if err != nil || len(creds) != 1 {
+			t.Fatalf("expected one credential, got %d (%v)", len(creds), err)
+		}
+		if err := s.DeleteWebAuthnCredential(ctx, "pk-1", "user-1"); err != nil {
+			t.Fatalf("failed to delete credential: %v", err)
+		}
+		if _, err := s.GetWebAuthnCredential(ctx, "Y3JlZC0x"); !errors.Is(err, ErrCredentialNotFound) {
+			t.Errorf("expected ErrCredentialNotFound, got %v", err)
+		}
+	})
+}
+
+func TestStore_WebAuthnChallenges(t *testing.T) {
+	ctx := context.Background()
+	s := setupSQLiteDB(t)
+
+	if err := s.CreateUser(ctx, "user-1", "alice", "", "hash"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	expiresAt := time.Now().Add(5 * time.Minute)
+	if err := s.CreateWebAuthnChallenge(ctx, "c-1", "user-1", CeremonyRegistration, "abc", expiresAt); err != nil {
+		t.Fatalf("failed to create challenge: %v", err)
+	}
+	if err := s.CreateWebAuthnChallenge(ctx, "c-2", "", CeremonyLogin, "def", expiresAt); err != nil {
+		t.Fatalf("failed to create challenge: %v", err)
+	}
+	if err := s.CreateWebAuthnChallenge(ctx, "c-3", "", CeremonyLogin, "ghi", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("failed to create challenge: %v", err)
+	}
+
+	challenge, err := s.TakeWebAuthnChallenge(ctx, "c-1")
+	if err != nil {
+		t.Fatalf("failed to take challenge: %v", err)
+	}
+	if challenge.UserID == nil || *challenge.UserID != "user-1" || challenge.Ceremony != CeremonyRegistration || challenge.Challenge != "abc" {
+		t.Errorf("unexpected challenge: %+v", challenge)
+	}
+	if challenge.ExpiresAt.Sub(expiresAt).Abs() > time.Second {
+		t.Errorf("expires_at = %v, want %v", challenge.ExpiresAt, expiresAt)
+	}
+	if _, err := s.TakeWebAuthnChallenge(ctx, "c-1"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("expected a challenge to be taken only once, got %v", err)
+	}
+
+	if err := s.CleanupExpiredWebAuthnChallenges(ctx); err != nil {
+		t.Fatalf("failed to clean up: %v", err)
+	}
+	if _, err := s.TakeWebAuthnChallenge(ctx, "c-3"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("expected expired challenge to be removed, got %v", err)
+	}
+	challenge, err = s.TakeWebAuthnChallenge(ctx, "c-2")
+	if err != nil {
+		t.Fatalf("expected live challenge to survive cleanup: %v", err)
+	}
+	if challenge.UserID != nil {
+		t.Errorf("expected anonymous login challenge, got user %q", *challenge.UserID)
+	}
+}
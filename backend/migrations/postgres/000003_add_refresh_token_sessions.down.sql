@@ -0,0 +1,12 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_session_expires_at;
+DROP INDEX IF EXISTS idx_session_user_id;
+
+-- Restore original session table
+DROP TABLE IF EXISTS session;
+
+CREATE TABLE IF NOT EXISTS session (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES "user"(id),
+    expires_at TIMESTAMPTZ NOT NULL
+);
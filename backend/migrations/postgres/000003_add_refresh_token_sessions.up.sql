@@ -0,0 +1,15 @@
+-- Recreate session table to back rotating refresh tokens
+DROP TABLE IF EXISTS session;
+
+CREATE TABLE IF NOT EXISTS session (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+    refresh_token_hash TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_session_user_id ON session (user_id);
+CREATE INDEX IF NOT EXISTS idx_session_expires_at ON session (expires_at);
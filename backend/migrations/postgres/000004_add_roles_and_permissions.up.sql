@@ -0,0 +1,52 @@
+-- Create roles and permissions tables
+CREATE TABLE IF NOT EXISTS role (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS permission (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permission (
+    role_name TEXT NOT NULL REFERENCES role(name) ON DELETE CASCADE,
+    permission_name TEXT NOT NULL REFERENCES permission(name) ON DELETE CASCADE,
+    PRIMARY KEY (role_name, permission_name)
+);
+
+CREATE TABLE IF NOT EXISTS user_role (
+    user_id TEXT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+    role_name TEXT NOT NULL REFERENCES role(name) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_name)
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_user_role_role_name ON user_role (role_name);
+
+-- Seed built-in roles and permissions
+INSERT INTO role (name, description) VALUES
+    ('admin', 'Full access to user management'),
+    ('user', 'Regular account with access to its own profile')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO permission (name, description) VALUES
+    ('users:read', 'View any user'),
+    ('users:write', 'Update any user'),
+    ('users:delete', 'Delete any user'),
+    ('roles:write', 'Assign and revoke roles')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permission (role_name, permission_name) VALUES
+    ('admin', 'users:read'),
+    ('admin', 'users:write'),
+    ('admin', 'users:delete'),
+    ('admin', 'roles:write')
+ON CONFLICT DO NOTHING;
+
+-- Every existing account gets the default role
+INSERT INTO user_role (user_id, role_name)
+SELECT id, 'user' FROM "user"
+ON CONFLICT DO NOTHING;
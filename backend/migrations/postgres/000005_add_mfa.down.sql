@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_mfa_recovery_code_user_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS mfa_recovery_code;
+DROP TABLE IF EXISTS user_mfa;
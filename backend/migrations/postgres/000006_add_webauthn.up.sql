@@ -0,0 +1,26 @@
+-- Create passkey credentials; credential_id is the base64url id chosen by the authenticator
+CREATE TABLE IF NOT EXISTS webauthn_credential (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+    credential_id TEXT NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    transports TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ
+);
+
+-- Create pending registration and login ceremonies; each challenge is consumed once
+CREATE TABLE IF NOT EXISTS webauthn_challenge (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES "user"(id) ON DELETE CASCADE,
+    ceremony TEXT NOT NULL,
+    challenge TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_webauthn_credential_user_id ON webauthn_credential (user_id);
+CREATE INDEX IF NOT EXISTS idx_webauthn_challenge_expires_at ON webauthn_challenge (expires_at);
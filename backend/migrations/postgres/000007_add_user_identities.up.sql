@@ -0,0 +1,26 @@
+-- Create external identities; a user may sign in through several providers
+CREATE TABLE IF NOT EXISTS user_identity (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ,
+    UNIQUE (provider, subject)
+);
+
+-- Create pending authorization requests keyed by the hashed state; each is consumed once
+CREATE TABLE IF NOT EXISTS oidc_auth_request (
+    id TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    user_id TEXT REFERENCES "user"(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_user_identity_user_id ON user_identity (user_id);
+CREATE INDEX IF NOT EXISTS idx_oidc_auth_request_expires_at ON oidc_auth_request (expires_at);
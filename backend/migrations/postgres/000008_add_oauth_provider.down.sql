@@ -0,0 +1,12 @@
+-- Drop permissions
+DELETE FROM role_permission WHERE permission_name = 'clients:write';
+DELETE FROM permission WHERE name = 'clients:write';
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_oauth_authorization_code_expires_at;
+DROP INDEX IF EXISTS idx_oauth_consent_client_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS oauth_authorization_code;
+DROP TABLE IF EXISTS oauth_consent;
+DROP TABLE IF EXISTS oauth_client;
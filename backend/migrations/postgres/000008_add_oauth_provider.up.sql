@@ -0,0 +1,45 @@
+-- Create OAuth clients of the built-in identity provider; public clients have no secret
+CREATE TABLE IF NOT EXISTS oauth_client (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    secret_hash TEXT,
+    redirect_uris TEXT NOT NULL,
+    created_by TEXT REFERENCES "user"(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Create the scopes each user has granted each client
+CREATE TABLE IF NOT EXISTS oauth_consent (
+    user_id TEXT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+    client_id TEXT NOT NULL REFERENCES oauth_client(id) ON DELETE CASCADE,
+    scopes TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (user_id, client_id)
+);
+
+-- Create authorization codes keyed by the hashed code; each is redeemed once
+CREATE TABLE IF NOT EXISTS oauth_authorization_code (
+    id TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL REFERENCES oauth_client(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    nonce TEXT NOT NULL DEFAULT '',
+    code_challenge TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_oauth_consent_client_id ON oauth_consent (client_id);
+CREATE INDEX IF NOT EXISTS idx_oauth_authorization_code_expires_at ON oauth_authorization_code (expires_at);
+
+-- Let admins register clients
+INSERT INTO permission (name, description) VALUES
+    ('clients:write', 'Register and delete OAuth clients')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permission (role_name, permission_name) VALUES
+    ('admin', 'clients:write')
+ON CONFLICT DO NOTHING;
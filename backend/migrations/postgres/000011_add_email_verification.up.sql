@@ -0,0 +1,19 @@
+-- Track whether a user has proven they own their email address. Existing
+-- users start unverified. Verification links store only the SHA-256 of the
+-- token together with the address it was sent to, so a link stops working
+-- once the email changes.
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS email_verification_token (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_email_verification_token_user_id ON email_verification_token (user_id);
+CREATE INDEX IF NOT EXISTS idx_email_verification_token_expires_at ON email_verification_token (expires_at);
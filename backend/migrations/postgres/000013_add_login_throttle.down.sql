@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_login_throttle_last_failure_at;
+
+-- Drop tables
+DROP TABLE IF EXISTS login_throttle;
@@ -0,0 +1,16 @@
+-- Track failed logins per account (keyed by the username tried) and per
+-- client IP. Rows are locked for an exponentially growing time once the
+-- failures pass a threshold, and are forgotten after a quiet period. Only
+-- the SHA-256 of the unlock link sent to the account owner is stored.
+CREATE TABLE IF NOT EXISTS login_throttle (
+    scope TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ,
+    unlock_token_hash TEXT UNIQUE,
+    PRIMARY KEY (scope, subject)
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_login_throttle_last_failure_at ON login_throttle (last_failure_at);
@@ -0,0 +1,12 @@
+-- Keep the hashes of passwords a user has replaced so a reset cannot bring
+-- one of them back. Rows are numbered in insertion order and trimmed to the
+-- configured history length whenever a password changes.
+CREATE TABLE IF NOT EXISTS password_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history (user_id);
@@ -0,0 +1,18 @@
+-- Track single-use sign-in links. Like verification links only the SHA-256
+-- of the token is stored, together with the address it was sent to so a
+-- link stops working once the email changes. binding_hash is the SHA-256 of
+-- the secret handed to the client that asked for a browser-bound link.
+CREATE TABLE IF NOT EXISTS magic_link_token (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL,
+    binding_hash TEXT,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_magic_link_token_user_id ON magic_link_token (user_id);
+CREATE INDEX IF NOT EXISTS idx_magic_link_token_expires_at ON magic_link_token (expires_at);
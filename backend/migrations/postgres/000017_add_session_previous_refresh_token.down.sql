@@ -0,0 +1,2 @@
+-- Drop columns
+ALTER TABLE session DROP COLUMN IF EXISTS previous_refresh_token_hash;
@@ -0,0 +1,3 @@
+-- Remember the refresh token a session last rotated away from, so that
+-- replaying it can be told apart from a guessed or garbled token
+ALTER TABLE session ADD COLUMN IF NOT EXISTS previous_refresh_token_hash TEXT;
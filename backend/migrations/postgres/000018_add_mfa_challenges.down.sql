@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_mfa_challenge_expires_at;
+DROP INDEX IF EXISTS idx_mfa_challenge_user_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS mfa_challenge;
@@ -0,0 +1,14 @@
+-- Track the second step of logins whose first factor was accepted. The
+-- client holds an opaque token; only its SHA-256 is stored, so a challenge
+-- cannot be forged and is gone once used.
+CREATE TABLE IF NOT EXISTS mfa_challenge (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_mfa_challenge_user_id ON mfa_challenge (user_id);
+CREATE INDEX IF NOT EXISTS idx_mfa_challenge_expires_at ON mfa_challenge (expires_at);
@@ -0,0 +1,2 @@
+-- Drop columns
+ALTER TABLE mfa_challenge DROP COLUMN IF EXISTS attempts;
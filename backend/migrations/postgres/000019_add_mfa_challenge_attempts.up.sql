@@ -0,0 +1,3 @@
+-- Count the codes tried against a two-factor challenge, which stops
+-- working after MFA_MAX_ATTEMPTS
+ALTER TABLE mfa_challenge ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- Add columns
+ALTER TABLE session ADD COLUMN IF NOT EXISTS previous_refresh_token_hash TEXT;
+
+-- Drop tables
+DROP TABLE IF EXISTS session_refresh_token;
@@ -0,0 +1,15 @@
+-- Keep every refresh token a session has rotated away from, so replaying
+-- any of them, not only the last one, revokes the session. Rows go with
+-- their session.
+CREATE TABLE IF NOT EXISTS session_refresh_token (
+    session_id TEXT NOT NULL REFERENCES session(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (session_id, token_hash)
+);
+
+-- Carry over the one rotated hash sessions kept so far
+INSERT INTO session_refresh_token (session_id, token_hash)
+SELECT id, previous_refresh_token_hash FROM session WHERE previous_refresh_token_hash IS NOT NULL;
+
+ALTER TABLE session DROP COLUMN IF EXISTS previous_refresh_token_hash;
@@ -1,7 +1,9 @@
 -- Add email column to users table
-ALTER TABLE "user" ADD COLUMN email TEXT UNIQUE;
-ALTER TABLE "user" ADD COLUMN created_at DATETIME DEFAULT CURRENT_TIMESTAMP;
-ALTER TABLE "user" ADD COLUMN updated_at DATETIME DEFAULT CURRENT_TIMESTAMP;
+-- SQLite cannot add a UNIQUE column, so uniqueness is enforced by idx_user_email below.
+-- created_at and updated_at already exist from the initial SQLite migration.
+-- The first version of this file did both and failed on every SQLite database;
+-- databases left dirty by it are retried on startup.
+ALTER TABLE "user" ADD COLUMN email TEXT;
 
 -- Create password reset tokens table
 CREATE TABLE IF NOT EXISTS password_reset_token (
@@ -15,7 +17,7 @@ CREATE TABLE IF NOT EXISTS password_reset_token (
 );
 
 -- Create indexes for better performance
-CREATE INDEX IF NOT EXISTS idx_user_email ON "user" (email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_email ON "user" (email);
 CREATE INDEX IF NOT EXISTS idx_password_reset_token_user_id ON password_reset_token (user_id);
 CREATE INDEX IF NOT EXISTS idx_password_reset_token_token ON password_reset_token (token);
 CREATE INDEX IF NOT EXISTS idx_password_reset_token_expires_at ON password_reset_token (expires_at);
@@ -0,0 +1,17 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_session_expires_at;
+DROP INDEX IF EXISTS idx_session_user_id;
+
+-- Restore original session table
+DROP TABLE IF EXISTS session;
+
+CREATE TABLE IF NOT EXISTS session (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_user_id ON session (user_id);
+CREATE INDEX IF NOT EXISTS idx_session_expires_at ON session (expires_at);
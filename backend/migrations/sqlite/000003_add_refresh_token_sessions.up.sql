@@ -0,0 +1,18 @@
+-- Recreate session table to back rotating refresh tokens
+DROP INDEX IF EXISTS idx_session_expires_at;
+DROP INDEX IF EXISTS idx_session_user_id;
+DROP TABLE IF EXISTS session;
+
+CREATE TABLE IF NOT EXISTS session (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    refresh_token_hash TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_session_user_id ON session (user_id);
+CREATE INDEX IF NOT EXISTS idx_session_expires_at ON session (expires_at);
@@ -0,0 +1,52 @@
+-- Create roles and permissions tables for SQLite
+CREATE TABLE IF NOT EXISTS role (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS permission (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permission (
+    role_name TEXT NOT NULL,
+    permission_name TEXT NOT NULL,
+    PRIMARY KEY (role_name, permission_name),
+    FOREIGN KEY (role_name) REFERENCES role (name) ON DELETE CASCADE,
+    FOREIGN KEY (permission_name) REFERENCES permission (name) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_role (
+    user_id TEXT NOT NULL,
+    role_name TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_name),
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE,
+    FOREIGN KEY (role_name) REFERENCES role (name) ON DELETE CASCADE
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_user_role_role_name ON user_role (role_name);
+
+-- Seed built-in roles and permissions
+INSERT OR IGNORE INTO role (name, description) VALUES
+    ('admin', 'Full access to user management'),
+    ('user', 'Regular account with access to its own profile');
+
+INSERT OR IGNORE INTO permission (name, description) VALUES
+    ('users:read', 'View any user'),
+    ('users:write', 'Update any user'),
+    ('users:delete', 'Delete any user'),
+    ('roles:write', 'Assign and revoke roles');
+
+INSERT OR IGNORE INTO role_permission (role_name, permission_name) VALUES
+    ('admin', 'users:read'),
+    ('admin', 'users:write'),
+    ('admin', 'users:delete'),
+    ('admin', 'roles:write');
+
+-- Every existing account gets the default role
+INSERT OR IGNORE INTO user_role (user_id, role_name)
+SELECT id, 'user' FROM "user";
@@ -0,0 +1,7 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_webauthn_challenge_expires_at;
+DROP INDEX IF EXISTS idx_webauthn_credential_user_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS webauthn_challenge;
+DROP TABLE IF EXISTS webauthn_credential;
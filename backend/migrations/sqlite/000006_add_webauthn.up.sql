@@ -0,0 +1,28 @@
+-- Create passkey credentials for SQLite; credential_id is the base64url id chosen by the authenticator
+CREATE TABLE IF NOT EXISTS webauthn_credential (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    credential_id TEXT NOT NULL UNIQUE,
+    public_key BLOB NOT NULL,
+    sign_count INTEGER NOT NULL DEFAULT 0,
+    transports TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE
+);
+
+-- Create pending registration and login ceremonies; each challenge is consumed once
+CREATE TABLE IF NOT EXISTS webauthn_challenge (
+    id TEXT PRIMARY KEY,
+    user_id TEXT,
+    ceremony TEXT NOT NULL,
+    challenge TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_webauthn_credential_user_id ON webauthn_credential (user_id);
+CREATE INDEX IF NOT EXISTS idx_webauthn_challenge_expires_at ON webauthn_challenge (expires_at);
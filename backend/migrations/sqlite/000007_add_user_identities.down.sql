@@ -0,0 +1,7 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_oidc_auth_request_expires_at;
+DROP INDEX IF EXISTS idx_user_identity_user_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS oidc_auth_request;
+DROP TABLE IF EXISTS user_identity;
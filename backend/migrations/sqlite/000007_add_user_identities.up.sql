@@ -0,0 +1,28 @@
+-- Create external identities for SQLite; a user may sign in through several providers
+CREATE TABLE IF NOT EXISTS user_identity (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_login_at DATETIME,
+    UNIQUE (provider, subject),
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE
+);
+
+-- Create pending authorization requests keyed by the hashed state; each is consumed once
+CREATE TABLE IF NOT EXISTS oidc_auth_request (
+    id TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    user_id TEXT,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_user_identity_user_id ON user_identity (user_id);
+CREATE INDEX IF NOT EXISTS idx_oidc_auth_request_expires_at ON oidc_auth_request (expires_at);
@@ -0,0 +1,48 @@
+-- Create OAuth clients of the built-in identity provider for SQLite; public clients have no secret
+CREATE TABLE IF NOT EXISTS oauth_client (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    secret_hash TEXT,
+    redirect_uris TEXT NOT NULL,
+    created_by TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (created_by) REFERENCES "user" (id) ON DELETE SET NULL
+);
+
+-- Create the scopes each user has granted each client
+CREATE TABLE IF NOT EXISTS oauth_consent (
+    user_id TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, client_id),
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE,
+    FOREIGN KEY (client_id) REFERENCES oauth_client (id) ON DELETE CASCADE
+);
+
+-- Create authorization codes keyed by the hashed code; each is redeemed once
+CREATE TABLE IF NOT EXISTS oauth_authorization_code (
+    id TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    nonce TEXT NOT NULL DEFAULT '',
+    code_challenge TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (client_id) REFERENCES oauth_client (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_oauth_consent_client_id ON oauth_consent (client_id);
+CREATE INDEX IF NOT EXISTS idx_oauth_authorization_code_expires_at ON oauth_authorization_code (expires_at);
+
+-- Let admins register clients
+INSERT OR IGNORE INTO permission (name, description) VALUES
+    ('clients:write', 'Register and delete OAuth clients');
+
+INSERT OR IGNORE INTO role_permission (role_name, permission_name) VALUES
+    ('admin', 'clients:write');
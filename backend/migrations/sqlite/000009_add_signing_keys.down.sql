@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_signing_key_expires_at;
+
+-- Drop tables
+DROP TABLE IF EXISTS signing_key;
@@ -0,0 +1,13 @@
+-- Create the keys access and ID tokens are signed with for SQLite. The id is
+-- the published kid; expires_at is set once a key is rotated out and only
+-- verifies tokens it signed earlier.
+CREATE TABLE IF NOT EXISTS signing_key (
+    id TEXT PRIMARY KEY,
+    algorithm TEXT NOT NULL,
+    private_key TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_signing_key_expires_at ON signing_key (expires_at);
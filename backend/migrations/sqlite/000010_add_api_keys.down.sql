@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_api_key_user_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS api_key;
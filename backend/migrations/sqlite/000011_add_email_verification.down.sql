@@ -0,0 +1,9 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_email_verification_token_expires_at;
+DROP INDEX IF EXISTS idx_email_verification_token_user_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS email_verification_token;
+
+-- Drop columns
+ALTER TABLE "user" DROP COLUMN email_verified_at;
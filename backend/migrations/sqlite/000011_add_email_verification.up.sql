@@ -0,0 +1,20 @@
+-- Track whether a user has proven they own their email address for SQLite.
+-- Existing users start unverified. Verification links store only the
+-- SHA-256 of the token together with the address it was sent to, so a link
+-- stops working once the email changes.
+ALTER TABLE "user" ADD COLUMN email_verified_at DATETIME;
+
+CREATE TABLE IF NOT EXISTS email_verification_token (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used BOOLEAN DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_email_verification_token_user_id ON email_verification_token (user_id);
+CREATE INDEX IF NOT EXISTS idx_email_verification_token_expires_at ON email_verification_token (expires_at);
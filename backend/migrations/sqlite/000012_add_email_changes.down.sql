@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_email_change_revert_expires_at;
+DROP INDEX IF EXISTS idx_email_change_user_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS email_change;
@@ -0,0 +1,22 @@
+-- Track email changes waiting for confirmation for SQLite. The new address
+-- gets a confirmation link and the old one a link to revert the change; only
+-- the SHA-256 of each token is stored. old_email is NULL when the user had
+-- no address to notify.
+CREATE TABLE IF NOT EXISTS email_change (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    old_email TEXT,
+    new_email TEXT NOT NULL,
+    confirm_token_hash TEXT NOT NULL UNIQUE,
+    revert_token_hash TEXT UNIQUE,
+    expires_at DATETIME NOT NULL,
+    revert_expires_at DATETIME NOT NULL,
+    confirmed_at DATETIME,
+    reverted_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_email_change_user_id ON email_change (user_id);
+CREATE INDEX IF NOT EXISTS idx_email_change_revert_expires_at ON email_change (revert_expires_at);
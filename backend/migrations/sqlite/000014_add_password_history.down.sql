@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_password_history_user_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS password_history;
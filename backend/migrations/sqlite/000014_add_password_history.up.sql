@@ -0,0 +1,13 @@
+-- Keep the hashes of passwords a user has replaced so a reset cannot bring
+-- one of them back, for SQLite. Rows are numbered in insertion order and
+-- trimmed to the configured history length whenever a password changes.
+CREATE TABLE IF NOT EXISTS password_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history (user_id);
@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_magic_link_token_expires_at;
+DROP INDEX IF EXISTS idx_magic_link_token_user_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS magic_link_token;
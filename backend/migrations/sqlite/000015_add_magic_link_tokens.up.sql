@@ -0,0 +1,20 @@
+-- Track single-use sign-in links for SQLite. Like verification links only
+-- the SHA-256 of the token is stored, together with the address it was sent
+-- to so a link stops working once the email changes. binding_hash is the
+-- SHA-256 of the secret handed to the client that asked for a browser-bound
+-- link.
+CREATE TABLE IF NOT EXISTS magic_link_token (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL,
+    binding_hash TEXT,
+    expires_at DATETIME NOT NULL,
+    used BOOLEAN DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_magic_link_token_user_id ON magic_link_token (user_id);
+CREATE INDEX IF NOT EXISTS idx_magic_link_token_expires_at ON magic_link_token (expires_at);
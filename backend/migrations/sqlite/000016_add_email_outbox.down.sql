@@ -0,0 +1,9 @@
+-- Drop permissions
+DELETE FROM role_permission WHERE permission_name IN ('emails:read', 'emails:write');
+DELETE FROM permission WHERE name IN ('emails:read', 'emails:write');
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_email_outbox_status_next_attempt_at;
+
+-- Drop tables
+DROP TABLE IF EXISTS email_outbox;
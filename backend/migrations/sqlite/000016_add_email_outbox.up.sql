@@ -0,0 +1,29 @@
+-- Queue outgoing email for SQLite. message is the JSON encoded message,
+-- rendered once when it is queued. A pending email is sent once
+-- next_attempt_at passes; workers push it forward while they send, so an
+-- email claimed by a worker that died is picked up again. Emails that
+-- cannot be delivered are kept as dead until an admin requeues them.
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id TEXT PRIMARY KEY,
+    recipient TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    message TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_email_outbox_status_next_attempt_at ON email_outbox (status, next_attempt_at);
+
+-- Let admins inspect and requeue undelivered email
+INSERT OR IGNORE INTO permission (name, description) VALUES
+    ('emails:read', 'List queued and undelivered email'),
+    ('emails:write', 'Requeue undelivered email');
+
+INSERT OR IGNORE INTO role_permission (role_name, permission_name) VALUES
+    ('admin', 'emails:read'),
+    ('admin', 'emails:write');
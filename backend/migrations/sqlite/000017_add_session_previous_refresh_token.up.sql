@@ -0,0 +1,3 @@
+-- Remember the refresh token a session last rotated away from, so that
+-- replaying it can be told apart from a guessed or garbled token, for SQLite
+ALTER TABLE session ADD COLUMN previous_refresh_token_hash TEXT;
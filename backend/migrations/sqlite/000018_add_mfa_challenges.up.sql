@@ -0,0 +1,15 @@
+-- Track the second step of logins whose first factor was accepted, for
+-- SQLite. The client holds an opaque token; only its SHA-256 is stored, so
+-- a challenge cannot be forged and is gone once used.
+CREATE TABLE IF NOT EXISTS mfa_challenge (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_mfa_challenge_user_id ON mfa_challenge (user_id);
+CREATE INDEX IF NOT EXISTS idx_mfa_challenge_expires_at ON mfa_challenge (expires_at);
@@ -0,0 +1,3 @@
+-- Count the codes tried against a two-factor challenge, which stops
+-- working after MFA_MAX_ATTEMPTS, for SQLite
+ALTER TABLE mfa_challenge ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
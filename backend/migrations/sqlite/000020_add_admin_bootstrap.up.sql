@@ -0,0 +1,11 @@
+-- Record that the instance has made its first admin, for SQLite. The table
+-- holds at most one row, so of several accounts registering at once on a
+-- fresh instance only the one whose insert wins becomes admin.
+CREATE TABLE IF NOT EXISTS admin_bootstrap (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    user_id TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Instances that already have accounts made their first admin long ago
+INSERT INTO admin_bootstrap (id) SELECT 1 WHERE EXISTS (SELECT 1 FROM "user");
@@ -0,0 +1,174 @@
+// Package clientip finds the address of the client behind reverse proxies.
+// Proxies add the address they received a request from to the
+// X-Forwarded-For or RFC 7239 Forwarded header, so the header is read from
+// right to left: every address is a hop closer to the client, and the first
+// one that is not a trusted proxy is the client. Anything further left was
+// sent by the client itself and cannot be believed.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Headers proxies report the client address in
+const (
+	XForwardedFor = "X-Forwarded-For"
+	Forwarded     = "Forwarded"
+)
+
+// ParsePrefixes parses trusted proxies given as CIDR prefixes or single
+// addresses
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy prefix %q: %w", value, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy address %q: %w", value, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Resolver finds the client address of requests that reach the server
+// through the Trusted proxies, which report it in Header
+type Resolver struct {
+	Trusted []netip.Prefix
+	Header  string // XForwardedFor or Forwarded
+}
+
+// Resolve returns the client address of r. It is the peer address unless
+// the peer is a trusted proxy, and invalid when the peer address is not an
+// IP address, such as for a Unix socket.
+func (res *Resolver) Resolve(r *http.Request) netip.Addr {
+	client, ok := parseNode(r.RemoteAddr)
+	if !ok || !res.trusted(client) {
+		return client
+	}
+
+	hops := res.hops(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseNode(hops[i])
+		if !ok {
+			// An unknown or obfuscated hop ends the chain; the proxy that
+			// reported it is as close to the client as can be told
+			break
+		}
+		client = addr
+		if !res.trusted(addr) {
+			break
+		}
+	}
+	return client
+}
+
+func (res *Resolver) trusted(addr netip.Addr) bool {
+	for _, prefix := range res.Trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// hops lists the addresses in the configured header, the client first
+func (res *Resolver) hops(header http.Header) []string {
+	var hops []string
+	for _, value := range header.Values(res.Header) {
+		if res.Header == Forwarded {
+			hops = append(hops, forwardedFor(value)...)
+			continue
+		}
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// forwardedFor returns the for parameter of every element of a Forwarded
+// header value, such as `for=192.0.2.60;proto=http, for="[2001:db8::1]"`.
+// An element without one yields an empty hop.
+func forwardedFor(value string) []string {
+	var hops []string
+	for _, element := range splitQuoted(value, ',') {
+		hop := ""
+		for _, pair := range splitQuoted(element, ';') {
+			name, param, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(name), "for") {
+				hop = unquote(strings.TrimSpace(param))
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// splitQuoted splits s at every sep outside a quoted string
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped, start := false, false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// parseNode parses an address with or without a port, IPv6 addresses in
+// brackets or bare
+func parseNode(node string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(node); err == nil {
+		return addr.Unmap(), true
+	}
+	host, _, err := net.SplitHostPort(node)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || addr.Zone() != "" {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,72 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolver(t *testing.T) {
+	trusted, err := ParsePrefixes([]string{"10.0.0.0/8", " 2001:db8:1::/48", "192.0.2.10"})
+	if err != nil {
+		t.Fatalf("failed to parse prefixes: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		values     []string
+		expected   string
+	}{
+		{name: "direct client", header: XForwardedFor, remoteAddr: "203.0.113.7:5000", expected: "203.0.113.7"},
+		{name: "untrusted peer cannot forward", header: XForwardedFor, remoteAddr: "203.0.113.7:5000", values: []string{"198.51.100.1"}, expected: "203.0.113.7"},
+		{name: "trusted proxy", header: XForwardedFor, remoteAddr: "10.0.0.1:5000", values: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "spoofed entries are skipped", header: XForwardedFor, remoteAddr: "10.0.0.1:5000", values: []string{"1.1.1.1, 198.51.100.1, 10.0.0.2"}, expected: "198.51.100.1"},
+		{name: "several header lines", header: XForwardedFor, remoteAddr: "10.0.0.1:5000", values: []string{"1.1.1.1", "198.51.100.1,10.0.0.2"}, expected: "198.51.100.1"},
+		{name: "single trusted address", header: XForwardedFor, remoteAddr: "192.0.2.10:5000", values: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "only proxies", header: XForwardedFor, remoteAddr: "10.0.0.1:5000", values: []string{"10.0.0.3, 10.0.0.2"}, expected: "10.0.0.3"},
+		{name: "garbage stops the walk", header: XForwardedFor, remoteAddr: "10.0.0.1:5000", values: []string{"198.51.100.1, nonsense, 10.0.0.2"}, expected: "10.0.0.2"},
+		{name: "no header from a proxy", header: XForwardedFor, remoteAddr: "10.0.0.1:5000", expected: "10.0.0.1"},
+		{name: "ipv6 with port", header: XForwardedFor, remoteAddr: "[2001:db8:1::5]:443", values: []string{"[2001:db8:2::1]:1234"}, expected: "2001:db8:2::1"},
+		{name: "ipv4 mapped peer", header: XForwardedFor, remoteAddr: "[::ffff:10.0.0.1]:5000", values: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "forwarded", header: Forwarded, remoteAddr: "10.0.0.1:5000", values: []string{`for=1.1.1.1, For="198.51.100.1:4711";proto=https;by=10.0.0.1`}, expected: "198.51.100.1"},
+		{name: "forwarded ipv6", header: Forwarded, remoteAddr: "10.0.0.1:5000", values: []string{`for="[2001:db8:cafe::17]:4711"`}, expected: "2001:db8:cafe::17"},
+		{name: "forwarded quoted separators", header: Forwarded, remoteAddr: "10.0.0.1:5000", values: []string{`for=198.51.100.1;host="a,b;c", for=10.0.0.2`}, expected: "198.51.100.1"},
+		{name: "forwarded obfuscated", header: Forwarded, remoteAddr: "10.0.0.1:5000", values: []string{"for=_hidden, for=10.0.0.2"}, expected: "10.0.0.2"},
+		{name: "forwarded unknown", header: Forwarded, remoteAddr: "10.0.0.1:5000", values: []string{"for=unknown"}, expected: "10.0.0.1"},
+		{name: "other header ignored", header: Forwarded, remoteAddr: "10.0.0.1:5000", values: nil, expected: "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &Resolver{Trusted: trusted, Header: tt.header}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "192.0.2.99")
+			req.Header.Del(tt.header)
+			for _, value := range tt.values {
+				req.Header.Add(tt.header, value)
+			}
+
+			if got := res.Resolve(req); got.String() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{"10.1.2.3/8", "::1", ""})
+	if err != nil {
+		t.Fatalf("failed to parse prefixes: %v", err)
+	}
+	if len(prefixes) != 2 || prefixes[0].String() != "10.0.0.0/8" || prefixes[1].String() != "::1/128" {
+		t.Errorf("unexpected prefixes %v", prefixes)
+	}
+
+	for _, value := range []string{"10.0.0.0/33", "proxy.example.com"} {
+		if _, err := ParsePrefixes([]string{value}); err == nil {
+			t.Errorf("expected %q to be refused", value)
+		}
+	}
+}
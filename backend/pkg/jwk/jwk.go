@@ -0,0 +1,218 @@
+// Package jwk converts public keys to and from JSON Web Keys (RFC 7517) for
+// the RSA, P-256/P-384 and Ed25519 keys used to sign tokens.
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var ErrUnsupportedKey = errors.New("unsupported json web key")
+
+// Key is a public JSON Web Key
+type Key struct {
+	KeyID     string
+	Algorithm string
+	Use       string
+	Key       crypto.PublicKey
+}
+
+// Set is a JWK Set document as served from a jwks_uri
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// rawKey is the wire form of a key. Only public members are read or written.
+type rawKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+var encoding = base64.RawURLEncoding
+
+func (k Key) MarshalJSON() ([]byte, error) {
+	raw, err := k.raw()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(raw)
+}
+
+func (k Key) raw() (rawKey, error) {
+	raw := rawKey{Kid: k.KeyID, Alg: k.Algorithm, Use: k.Use}
+	switch pub := k.Key.(type) {
+	case *rsa.PublicKey:
+		raw.Kty = "RSA"
+		raw.N = encoding.EncodeToString(pub.N.Bytes())
+		raw.E = encoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		raw.Kty = "EC"
+		raw.Crv = pub.Curve.Params().Name
+		raw.X = encoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		raw.Y = encoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		raw.Kty = "OKP"
+		raw.Crv = "Ed25519"
+		raw.X = encoding.EncodeToString(pub)
+	default:
+		return rawKey{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, k.Key)
+	}
+	return raw, nil
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the key, which makes
+// a stable key id
+func (k Key) Thumbprint() (string, error) {
+	raw, err := k.raw()
+	if err != nil {
+		return "", err
+	}
+
+	// Only the required members, in lexicographic order
+	var members []byte
+	switch raw.Kty {
+	case "RSA":
+		members, err = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{raw.E, raw.Kty, raw.N})
+	case "EC":
+		members, err = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{raw.Crv, raw.Kty, raw.X, raw.Y})
+	default:
+		members, err = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{raw.Crv, raw.Kty, raw.X})
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(members)
+	return encoding.EncodeToString(sum[:]), nil
+}
+
+func (k *Key) UnmarshalJSON(data []byte) error {
+	var raw rawKey
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	pub, err := raw.publicKey()
+	if err != nil {
+		return err
+	}
+	*k = Key{KeyID: raw.Kid, Algorithm: raw.Alg, Use: raw.Use, Key: pub}
+	return nil
+}
+
+func (raw rawKey) publicKey() (crypto.PublicKey, error) {
+	switch raw.Kty {
+	case "RSA":
+		n, err := encoding.DecodeString(raw.N)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid modulus", ErrUnsupportedKey)
+		}
+		e, err := encoding.DecodeString(raw.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: invalid exponent", ErrUnsupportedKey)
+		}
+		if len(n) < 256 {
+			return nil, fmt.Errorf("%w: rsa keys must be at least 2048 bits", ErrUnsupportedKey)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch raw.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("%w: curve %q", ErrUnsupportedKey, raw.Crv)
+		}
+		x, errX := encoding.DecodeString(raw.X)
+		y, errY := encoding.DecodeString(raw.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, fmt.Errorf("%w: invalid %s point", ErrUnsupportedKey, raw.Crv)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("%w: point is not on %s", ErrUnsupportedKey, raw.Crv)
+		}
+		return pub, nil
+	case "OKP":
+		x, err := encoding.DecodeString(raw.X)
+		if raw.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid %s key", ErrUnsupportedKey, raw.Crv)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("%w: key type %q", ErrUnsupportedKey, raw.Kty)
+	}
+}
+
+// UnmarshalJSON skips keys of unsupported types instead of failing, since
+// providers publish keys for algorithms a client never uses
+func (s *Set) UnmarshalJSON(data []byte) error {
+	var doc struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	s.Keys = s.Keys[:0]
+	for _, raw := range doc.Keys {
+		var key Key
+		if err := json.Unmarshal(raw, &key); err != nil {
+			if errors.Is(err, ErrUnsupportedKey) {
+				continue
+			}
+			return err
+		}
+		s.Keys = append(s.Keys, key)
+	}
+	return nil
+}
+
+// Lookup returns the key with the given id. An empty id matches only when
+// the set holds exactly one key.
+func (s *Set) Lookup(kid string) (Key, bool) {
+	if kid == "" {
+		if len(s.Keys) == 1 {
+			return s.Keys[0], true
+		}
+		return Key{}, false
+	}
+	for _, key := range s.Keys {
+		if key.KeyID == kid {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
@@ -0,0 +1,107 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+)
+
+func TestKey_RoundTrip(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	set := Set{Keys: []Key{
+		{KeyID: "rsa", Algorithm: "RS256", Use: "sig", Key: &rsaKey.PublicKey},
+		{KeyID: "ec", Algorithm: "ES256", Use: "sig", Key: &ecKey.PublicKey},
+		{KeyID: "ed", Algorithm: "EdDSA", Use: "sig", Key: edPub},
+	}}
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	var decoded Set
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if len(decoded.Keys) != 3 {
+		t.Fatalf("expected 3 keys, got %d", len(decoded.Keys))
+	}
+
+	if key, ok := decoded.Lookup("rsa"); !ok || !rsaKey.PublicKey.Equal(key.Key) {
+		t.Error("rsa key did not survive the round trip")
+	}
+	if key, ok := decoded.Lookup("ec"); !ok || !ecKey.PublicKey.Equal(key.Key) || key.Algorithm != "ES256" {
+		t.Error("ec key did not survive the round trip")
+	}
+	if key, ok := decoded.Lookup("ed"); !ok || !edPub.Equal(key.Key) {
+		t.Error("ed25519 key did not survive the round trip")
+	}
+	if _, ok := decoded.Lookup(""); ok {
+		t.Error("empty kid must not match when the set has several keys")
+	}
+}
+
+func TestSet_SkipsUnsupportedKeys(t *testing.T) {
+	data := []byte(`{"keys":[
+		{"kty":"oct","kid":"hmac","k":"c2VjcmV0"},
+		{"kty":"EC","kid":"p521","crv":"P-521","x":"AA","y":"AA"},
+		{"kty":"OKP","kid":"ed","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	]}`)
+
+	var set Set
+	if err := json.Unmarshal(data, &set); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].KeyID != "ed" {
+		t.Errorf("expected only the Ed25519 key, got %+v", set.Keys)
+	}
+	if _, ok := set.Lookup(""); !ok {
+		t.Error("empty kid should match the only key")
+	}
+}
+
+func TestKey_RejectsInvalidPoints(t *testing.T) {
+	// x and y are well formed but not on P-256
+	data := []byte(`{"kty":"EC","crv":"P-256","x":"AQAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA","y":"AQAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}`)
+	var key Key
+	if err := json.Unmarshal(data, &key); err == nil {
+		t.Error("expected an error for a point off the curve")
+	}
+}
+
+func TestKey_Thumbprint(t *testing.T) {
+	// Example key from RFC 7638, section 3.1
+	data := `{"kty":"RSA","kid":"2011-04-29","alg":"RS256","e":"AQAB",` +
+		`"n":"0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"}`
+
+	var key Key
+	if err := json.Unmarshal([]byte(data), &key); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	thumbprint, err := key.Thumbprint()
+	if err != nil {
+		t.Fatalf("failed to compute thumbprint: %v", err)
+	}
+	if thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("unexpected thumbprint %q", thumbprint)
+	}
+
+	// Metadata such as the key id does not change the thumbprint
+	key.KeyID = "other"
+	if again, _ := key.Thumbprint(); again != thumbprint {
+		t.Errorf("expected the thumbprint to ignore the key id, got %q", again)
+	}
+
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := (Key{Key: edPub}).Thumbprint(); err != nil {
+		t.Errorf("failed to compute an Ed25519 thumbprint: %v", err)
+	}
+}
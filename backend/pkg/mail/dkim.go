@@ -0,0 +1,459 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDKIMHeaders are the header fields DKIM signs when none are
+// configured. Fields a message lacks are left out of the signature.
+var DefaultDKIMHeaders = []string{
+	"From", "Reply-To", "To", "Cc", "Subject", "Date", "Message-ID",
+	"MIME-Version", "Content-Type", "Content-Transfer-Encoding", "Content-Language",
+}
+
+var (
+	ErrNoDKIMSignature      = errors.New("mail: message has no DKIM signature")
+	ErrDKIMBodyHashMismatch = errors.New("mail: DKIM body hash does not match")
+	ErrDKIMBadSignature     = errors.New("mail: DKIM signature does not verify")
+)
+
+// minDKIMRSABits is the smallest RSA key verifiers still accept, see RFC
+// 8301
+const minDKIMRSABits = 1024
+
+// DKIM signs messages with DomainKeys Identified Mail, RFC 6376, using
+// relaxed canonicalization for header and body. RSA keys sign with
+// rsa-sha256 and Ed25519 keys with ed25519-sha256 (RFC 8463); receivers find
+// the public key in the TXT record at <Selector>._domainkey.<Domain>, see
+// TXTRecord.
+type DKIM struct {
+	Domain   string
+	Selector string
+	Key      crypto.Signer // *rsa.PrivateKey or ed25519.PrivateKey
+	Headers  []string      // header fields to sign; nil signs DefaultDKIMHeaders
+}
+
+// ParseDKIMKey reads a PEM encoded RSA or Ed25519 private key, in PKCS #8
+// or, for RSA, PKCS #1 form
+func ParseDKIMKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("mail: no PEM block found")
+	}
+
+	var private any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("mail: unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := private.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < minDKIMRSABits {
+			return nil, fmt.Errorf("mail: RSA key has %d bits, DKIM needs at least %d", key.N.BitLen(), minDKIMRSABits)
+		}
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("mail: unsupported DKIM key type %T", private)
+}
+
+// algorithm returns the a= tag and k= key type for the key
+func (d *DKIM) algorithm() (algorithm, keyType string, err error) {
+	switch d.Key.(type) {
+	case *rsa.PrivateKey:
+		return "rsa-sha256", "rsa", nil
+	case ed25519.PrivateKey:
+		return "ed25519-sha256", "ed25519", nil
+	}
+	return "", "", fmt.Errorf("mail: unsupported DKIM key type %T", d.Key)
+}
+
+// TXTRecord returns the DNS name and value of the record publishing the
+// public key
+func (d *DKIM) TXTRecord() (name, value string, err error) {
+	_, keyType, err := d.algorithm()
+	if err != nil {
+		return "", "", err
+	}
+
+	var public []byte
+	switch key := d.Key.Public().(type) {
+	case *rsa.PublicKey:
+		if public, err = x509.MarshalPKIXPublicKey(key); err != nil {
+			return "", "", err
+		}
+	case ed25519.PublicKey:
+		public = key
+	}
+	name = d.Selector + "._domainkey." + d.Domain
+	return name, fmt.Sprintf("v=DKIM1; k=%s; p=%s", keyType, base64.StdEncoding.EncodeToString(public)), nil
+}
+
+// Sign adds a DKIM signature to msg, replacing any earlier one. The message
+// must not change afterwards, apart from being sent.
+func (d *DKIM) Sign(msg *Message) error {
+	algorithm, _, err := d.algorithm()
+	if err != nil {
+		return err
+	}
+
+	msg.DKIMSignature = ""
+	raw, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	fields, body := splitMessage(raw)
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	headers := d.Headers
+	if headers == nil {
+		headers = DefaultDKIMHeaders
+	}
+
+	// Sign the fields the message has, always including From
+	var signed []string
+	hash := sha256.New()
+	for _, name := range headers {
+		if slices.Contains(signed, strings.ToLower(name)) {
+			continue
+		}
+		if field, ok := lastField(fields, name, nil); ok {
+			signed = append(signed, strings.ToLower(name))
+			hash.Write([]byte(relaxedHeader(field)))
+		}
+	}
+	if !slices.Contains(signed, "from") {
+		return errors.New("mail: DKIM headers must include From")
+	}
+
+	// The signature covers its own field with b= empty. Tags are folded at
+	// their separators, which relaxed canonicalization undoes.
+	value := strings.Join([]string{
+		"v=1",
+		"a=" + algorithm,
+		"c=relaxed/relaxed",
+		"d=" + d.Domain,
+		"s=" + d.Selector,
+		"t=" + strconv.FormatInt(time.Now().Unix(), 10),
+		"h=" + strings.Join(signed, ":"),
+		"bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]),
+		"b=",
+	}, ";\r\n\t")
+	hash.Write([]byte(strings.TrimSuffix(relaxedHeader("DKIM-Signature: "+value), "\r\n")))
+
+	var signature []byte
+	if _, ok := d.Key.(ed25519.PrivateKey); ok {
+		// RFC 8463 signs the SHA-256 hash with pure Ed25519
+		signature, err = d.Key.Sign(rand.Reader, hash.Sum(nil), crypto.Hash(0))
+	} else {
+		signature, err = d.Key.Sign(rand.Reader, hash.Sum(nil), crypto.SHA256)
+	}
+	if err != nil {
+		return fmt.Errorf("mail: failed to sign message: %w", err)
+	}
+
+	msg.DKIMSignature = value + foldBase64(base64.StdEncoding.EncodeToString(signature))
+	return nil
+}
+
+// foldBase64 breaks a long base64 value over continuation lines
+func foldBase64(value string) string {
+	var b strings.Builder
+	for len(value) > 64 {
+		b.WriteString(value[:64])
+		b.WriteString("\r\n\t")
+		value = value[64:]
+	}
+	b.WriteString(value)
+	return b.String()
+}
+
+// Signed signs every message with DKIM before handing it to Mailer
+type Signed struct {
+	Mailer Mailer
+	DKIM   *DKIM
+}
+
+func (s *Signed) Send(ctx context.Context, msg *Message) error {
+	if err := s.DKIM.Sign(msg); err != nil {
+		return err
+	}
+	return s.Mailer.Send(ctx, msg)
+}
+
+// TXTResolver looks up DNS TXT records; *net.Resolver is one
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// VerifyDKIM checks the topmost DKIM signature of a rendered message
+// against the key the signing domain publishes, and returns that domain.
+// Signatures with a body length limit are refused.
+func VerifyDKIM(ctx context.Context, resolver TXTResolver, message []byte) (string, error) {
+	fields, body := splitMessage(message)
+	// The topmost signature is the last one added
+	i := slices.IndexFunc(fields, func(field string) bool { return fieldName(field) == "dkim-signature" })
+	if i < 0 {
+		return "", ErrNoDKIMSignature
+	}
+	field := fields[i]
+
+	_, value, _ := strings.Cut(field, ":")
+	tags, err := parseTags(value)
+	if err != nil {
+		return "", err
+	}
+	for _, tag := range []string{"v", "a", "d", "s", "h", "bh", "b"} {
+		if tags[tag] == "" {
+			return "", fmt.Errorf("mail: DKIM signature has no %s= tag", tag)
+		}
+	}
+	if tags["v"] != "1" {
+		return "", fmt.Errorf("mail: unsupported DKIM version %q", tags["v"])
+	}
+	if _, ok := tags["l"]; ok {
+		return "", errors.New("mail: DKIM body length limits are not supported")
+	}
+	if expires, ok := tags["x"]; ok {
+		if unix, err := strconv.ParseInt(expires, 10, 64); err != nil || time.Now().Unix() > unix {
+			return "", errors.New("mail: DKIM signature has expired")
+		}
+	}
+
+	headerCanon, bodyCanon, _ := strings.Cut(tags["c"], "/")
+	canonicalBody := relaxedBody
+	switch bodyCanon {
+	case "relaxed":
+	case "", "simple":
+		canonicalBody = simpleBody
+	default:
+		return "", fmt.Errorf("mail: unsupported DKIM body canonicalization %q", bodyCanon)
+	}
+	canonicalHeader := relaxedHeader
+	switch headerCanon {
+	case "relaxed":
+	case "", "simple":
+		canonicalHeader = func(field string) string { return field + "\r\n" }
+	default:
+		return "", fmt.Errorf("mail: unsupported DKIM header canonicalization %q", headerCanon)
+	}
+
+	bodyHash := sha256.Sum256(canonicalBody(body))
+	if base64.StdEncoding.EncodeToString(bodyHash[:]) != tags["bh"] {
+		return "", ErrDKIMBodyHashMismatch
+	}
+
+	names := strings.Split(tags["h"], ":")
+	if !slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, "from") }) {
+		return "", errors.New("mail: DKIM signature does not cover From")
+	}
+	hash := sha256.New()
+	used := make(map[int]bool)
+	for _, name := range names {
+		// A field named more than once takes the next one up; a missing one
+		// is signed as empty
+		if field, ok := lastField(fields, name, used); ok {
+			hash.Write([]byte(canonicalHeader(field)))
+		}
+	}
+	hash.Write([]byte(strings.TrimSuffix(canonicalHeader(withoutSignature(field)), "\r\n")))
+
+	public, err := lookupDKIMKey(ctx, resolver, tags["s"]+"._domainkey."+tags["d"])
+	if err != nil {
+		return "", err
+	}
+	signature, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return "", fmt.Errorf("mail: invalid DKIM signature: %w", err)
+	}
+
+	switch tags["a"] {
+	case "rsa-sha256":
+		key, ok := public.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(key, crypto.SHA256, hash.Sum(nil), signature) != nil {
+			return "", ErrDKIMBadSignature
+		}
+	case "ed25519-sha256":
+		key, ok := public.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(key, hash.Sum(nil), signature) {
+			return "", ErrDKIMBadSignature
+		}
+	default:
+		return "", fmt.Errorf("mail: unsupported DKIM algorithm %q", tags["a"])
+	}
+	return tags["d"], nil
+}
+
+// lookupDKIMKey fetches the public key published at name
+func lookupDKIMKey(ctx context.Context, resolver TXTResolver, name string) (crypto.PublicKey, error) {
+	records, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("mail: failed to look up DKIM key %s: %w", name, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("mail: no DKIM key published at %s", name)
+	}
+
+	tags, err := parseTags(records[0])
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, fmt.Errorf("mail: unsupported DKIM key record version %q", v)
+	}
+	if tags["p"] == "" {
+		return nil, fmt.Errorf("mail: DKIM key at %s has been revoked", name)
+	}
+	data, err := base64.StdEncoding.DecodeString(tags["p"])
+	if err != nil {
+		return nil, fmt.Errorf("mail: invalid DKIM key at %s: %w", name, err)
+	}
+
+	switch tags["k"] {
+	case "", "rsa":
+		if key, err := x509.ParsePKIXPublicKey(data); err == nil {
+			return key, nil
+		}
+		return x509.ParsePKCS1PublicKey(data)
+	case "ed25519":
+		if len(data) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("mail: invalid Ed25519 DKIM key at %s", name)
+		}
+		return ed25519.PublicKey(data), nil
+	}
+	return nil, fmt.Errorf("mail: unsupported DKIM key type %q", tags["k"])
+}
+
+// parseTags parses a tag=value list as used by signatures and key records.
+// Whitespace inside values is dropped, which only the base64 values and
+// the header list contain.
+func parseTags(list string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(list, ";") {
+		if strings.TrimSpace(tag) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(tag, "=")
+		if !ok {
+			return nil, fmt.Errorf("mail: malformed DKIM tag %q", strings.TrimSpace(tag))
+		}
+		tags[strings.TrimSpace(name)] = strings.Join(strings.Fields(value), "")
+	}
+	return tags, nil
+}
+
+// withoutSignature empties the b= tag of a signature field
+func withoutSignature(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	tags := strings.Split(value, ";")
+	for i, tag := range tags {
+		if tagName, _, ok := strings.Cut(tag, "="); ok && strings.TrimSpace(tagName) == "b" {
+			tags[i] = tagName + "="
+		}
+	}
+	return name + ":" + strings.Join(tags, ";")
+}
+
+// splitMessage returns the header fields of a message, each with its
+// continuation lines but without the final CRLF, and the body
+func splitMessage(message []byte) (fields []string, body []byte) {
+	header, body, _ := bytes.Cut(message, []byte("\r\n\r\n"))
+	for _, line := range strings.Split(string(header), "\r\n") {
+		if len(fields) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			fields[len(fields)-1] += "\r\n" + line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields, body
+}
+
+func fieldName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// lastField returns the bottommost field called name not yet in used, and
+// marks it used
+func lastField(fields []string, name string, used map[int]bool) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i := len(fields) - 1; i >= 0; i-- {
+		if !used[i] && fieldName(fields[i]) == name {
+			if used != nil {
+				used[i] = true
+			}
+			return fields[i], true
+		}
+	}
+	return "", false
+}
+
+// relaxedHeader canonicalizes a header field: the name lowercased, the value
+// unfolded with runs of whitespace reduced to a single space and trimmed
+func relaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.Join(strings.Fields(value), " ") + "\r\n"
+}
+
+// relaxedBody canonicalizes a body: whitespace runs reduced to a single
+// space, trailing whitespace and empty lines at the end removed
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		var b strings.Builder
+		space := false
+		for _, r := range line {
+			if r == ' ' || r == '\t' {
+				space = true
+				continue
+			}
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteRune(r)
+		}
+		lines[i] = b.String()
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// simpleBody canonicalizes a body by removing empty lines at the end
+func simpleBody(body []byte) []byte {
+	for bytes.HasSuffix(body, []byte("\r\n")) {
+		body = body[:len(body)-2]
+	}
+	return append(body, "\r\n"...)
+}
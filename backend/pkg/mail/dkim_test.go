@@ -0,0 +1,212 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeResolver serves TXT records from a map instead of DNS
+type fakeResolver map[string]string
+
+func (r fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	record, ok := r[name]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return []string{record}, nil
+}
+
+func testDKIMKeys(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	return map[string]crypto.Signer{"rsa-sha256": rsaKey, "ed25519-sha256": edKey}
+}
+
+// publish returns a resolver serving the public key of d
+func publish(t *testing.T, d *DKIM) fakeResolver {
+	t.Helper()
+	name, value, err := d.TXTRecord()
+	if err != nil {
+		t.Fatalf("failed to build TXT record: %v", err)
+	}
+	return fakeResolver{name: value}
+}
+
+func TestDKIM(t *testing.T) {
+	for algorithm, key := range testDKIMKeys(t) {
+		t.Run(algorithm, func(t *testing.T) {
+			d := &DKIM{Domain: "example.com", Selector: "mail2026", Key: key}
+			resolver := publish(t, d)
+
+			msg := testMessage()
+			msg.HTML = "<p>Hello   Alice,</p>\n\n"
+			msg.Headers = map[string]string{"Content-Language": "en"}
+			memory := &Memory{}
+			if err := (&Signed{Mailer: memory, DKIM: d}).Send(context.Background(), msg); err != nil {
+				t.Fatalf("failed to send: %v", err)
+			}
+
+			sent := memory.Messages()[0]
+			data, err := sent.Bytes()
+			if err != nil {
+				t.Fatalf("failed to render message: %v", err)
+			}
+			if !bytes.HasPrefix(data, []byte("DKIM-Signature: v=1;\r\n\ta="+algorithm+";")) {
+				t.Errorf("expected the signature first, got %q", data[:80])
+			}
+			for _, line := range strings.Split(string(data), "\r\n") {
+				if len(line) > 78 {
+					t.Errorf("line longer than 78 characters: %q", line)
+				}
+			}
+
+			domain, err := VerifyDKIM(context.Background(), resolver, data)
+			if err != nil {
+				t.Fatalf("failed to verify signature: %v", err)
+			}
+			if domain != "example.com" {
+				t.Errorf("unexpected domain %q", domain)
+			}
+			if !strings.Contains(sent.DKIMSignature, "h=from:to:subject:date:message-id:mime-version:content-type:content-language;") {
+				t.Errorf("unexpected signed headers in %q", sent.DKIMSignature)
+			}
+
+			// Signing again replaces the signature
+			if err := d.Sign(&sent); err != nil {
+				t.Fatalf("failed to sign again: %v", err)
+			}
+			data, _ = sent.Bytes()
+			if n := strings.Count(string(data), "DKIM-Signature:"); n != 1 {
+				t.Errorf("expected one signature, got %d", n)
+			}
+			if _, err := VerifyDKIM(context.Background(), resolver, data); err != nil {
+				t.Errorf("failed to verify the new signature: %v", err)
+			}
+		})
+	}
+}
+
+func TestDKIM_Tampered(t *testing.T) {
+	keys := testDKIMKeys(t)
+	d := &DKIM{Domain: "example.com", Selector: "mail2026", Key: keys["ed25519-sha256"]}
+	msg := testMessage()
+	if err := d.Sign(msg); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("failed to render message: %v", err)
+	}
+
+	other := &DKIM{Domain: "example.com", Selector: "mail2026", Key: keys["rsa-sha256"]}
+	_, otherRecord, _ := other.TXTRecord()
+
+	tests := []struct {
+		name     string
+		message  []byte
+		resolver fakeResolver
+		err      error
+	}{
+		{name: "body changed", message: bytes.Replace(data, []byte("Click"), []byte("Klick"), 1), resolver: publish(t, d), err: ErrDKIMBodyHashMismatch},
+		{name: "signed header changed", message: bytes.Replace(data, []byte("To: <alice@example.com>"), []byte("To: <mallory@example.com>"), 1), resolver: publish(t, d), err: ErrDKIMBadSignature},
+		{name: "wrong key published", message: data, resolver: fakeResolver{"mail2026._domainkey.example.com": otherRecord}, err: ErrDKIMBadSignature},
+		{name: "unsigned message", message: []byte("From: a@example.com\r\n\r\nHello\r\n"), resolver: publish(t, d), err: ErrNoDKIMSignature},
+		{name: "no key published", message: data, resolver: fakeResolver{}},
+		{name: "revoked key", message: data, resolver: fakeResolver{"mail2026._domainkey.example.com": "v=DKIM1; k=ed25519; p="}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyDKIM(context.Background(), tt.resolver, tt.message)
+			if err == nil {
+				t.Fatal("expected verification to fail")
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	// Whitespace changes in transit survive relaxed canonicalization
+	relayed := bytes.Replace(data, []byte("Subject: "), []byte("Subject:    "), 1)
+	relayed = bytes.Replace(relayed, []byte("Hello Alice,"), []byte("Hello  Alice,  "), 1)
+	if _, err := VerifyDKIM(context.Background(), publish(t, d), relayed); err != nil {
+		t.Errorf("expected whitespace changes to verify, got %v", err)
+	}
+}
+
+func TestDKIM_Headers(t *testing.T) {
+	d := &DKIM{Domain: "example.com", Selector: "s1", Key: testDKIMKeys(t)["ed25519-sha256"], Headers: []string{"subject", "Date"}}
+	if err := d.Sign(testMessage()); err == nil {
+		t.Error("expected a signature without From to be refused")
+	}
+
+	d.Headers = []string{"From", "Subject", "X-Missing"}
+	msg := testMessage()
+	if err := d.Sign(msg); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if !strings.Contains(msg.DKIMSignature, "h=from:subject;") {
+		t.Errorf("expected only present headers to be signed, got %q", msg.DKIMSignature)
+	}
+	data, _ := msg.Bytes()
+	if _, err := VerifyDKIM(context.Background(), publish(t, d), data); err != nil {
+		t.Errorf("failed to verify: %v", err)
+	}
+}
+
+func TestParseDKIMKey(t *testing.T) {
+	keys := testDKIMKeys(t)
+	encode := func(blockType string, der []byte) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	}
+	rsaPKCS8, _ := x509.MarshalPKCS8PrivateKey(keys["rsa-sha256"])
+	edPKCS8, _ := x509.MarshalPKCS8PrivateKey(keys["ed25519-sha256"])
+	// Go refuses short keys itself unless told otherwise
+	t.Setenv("GODEBUG", "rsa1024min=0")
+	smallKey, err := rsa.GenerateKey(rand.Reader, 768)
+	if err != nil {
+		t.Fatalf("failed to generate short RSA key: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{name: "rsa pkcs1", data: encode("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(keys["rsa-sha256"].(*rsa.PrivateKey))), valid: true},
+		{name: "rsa pkcs8", data: encode("PRIVATE KEY", rsaPKCS8), valid: true},
+		{name: "ed25519 pkcs8", data: encode("PRIVATE KEY", edPKCS8), valid: true},
+		{name: "short rsa key", data: encode("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(smallKey))},
+		{name: "public key", data: encode("PUBLIC KEY", []byte{1, 2, 3})},
+		{name: "not pem", data: []byte("not a key")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseDKIMKey(tt.data)
+			if tt.valid && (err != nil || key == nil) {
+				t.Errorf("expected the key to parse, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected the key to be refused")
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// File writes messages to a directory instead of sending them, for
+// development. Each message is a .eml file that mail clients open directly,
+// or with Maildir a message in the new folder of a maildir, which clients
+// like mutt can read as a mailbox.
+type File struct {
+	Dir     string
+	Maildir bool
+}
+
+// deliveries numbers the messages written by this process, keeping maildir
+// names unique
+var deliveries atomic.Uint64
+
+func (f *File) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	if !f.Maildir {
+		name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000Z"), randomHex(4))
+		return writeAtomic(f.Dir, name, data)
+	}
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(f.Dir, sub), 0o700); err != nil {
+			return err
+		}
+	}
+
+	// Maildir names are <seconds>.M<microseconds>P<pid>Q<delivery>.<host>;
+	// messages are written to tmp and moved to new once complete
+	now := time.Now()
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "localhost"
+	}
+	name := fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), deliveries.Add(1), host)
+	tmp := filepath.Join(f.Dir, "tmp", name)
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(f.Dir, "new", name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeAtomic writes data to dir/name through a temporary file so readers
+// never see a partial message
+func writeAtomic(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
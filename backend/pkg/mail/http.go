@@ -0,0 +1,96 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody limits how much of a failed response ends up in the error
+const maxErrorBody = 1024
+
+// HTTP sends messages through an email provider's HTTP API. Each message is
+// posted as JSON with the fields from, to, subject, text, html and headers,
+// and the API key as a bearer token, which Resend and compatible providers
+// accept.
+type HTTP struct {
+	URL    string
+	APIKey string
+	Client *http.Client // nil uses http.DefaultClient
+}
+
+type httpMessage struct {
+	From    string            `json:"from"`
+	To      []string          `json:"to"`
+	Subject string            `json:"subject"`
+	Text    string            `json:"text"`
+	HTML    string            `json:"html,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// ProviderError is returned when the provider refuses a message
+type ProviderError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("mail: provider returned status %d: %s", e.StatusCode, e.Body)
+}
+
+func (h *HTTP) Send(ctx context.Context, msg *Message) error {
+	// Render once to validate the message and fill in its id
+	if _, err := msg.Bytes(); err != nil {
+		return err
+	}
+
+	headers := maps.Clone(msg.Headers)
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers["Message-ID"] = "<" + msg.MessageID + ">"
+
+	body, err := json.Marshal(httpMessage{
+		From:    msg.From,
+		To:      msg.To,
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.HTML,
+		Headers: headers,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if h.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.APIKey)
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach email provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return &ProviderError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(detail))}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,66 @@
+package mail
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type localesKey struct{}
+
+// WithLocales returns a context carrying the locales emails sent on its
+// behalf should be rendered in, most preferred first
+func WithLocales(ctx context.Context, locales ...string) context.Context {
+	return context.WithValue(ctx, localesKey{}, locales)
+}
+
+// LocalesFromContext returns the locales set by WithLocales
+func LocalesFromContext(ctx context.Context) []string {
+	locales, _ := ctx.Value(localesKey{}).([]string)
+	return locales
+}
+
+// ParseAcceptLanguage returns the language tags of an Accept-Language
+// header, most preferred first. Wildcards and tags with q=0 are left out.
+func ParseAcceptLanguage(header string) []string {
+	type preference struct {
+		tag     string
+		quality float64
+	}
+
+	var preferences []preference
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key == "q" {
+				q, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					q = 0
+				}
+				quality = q
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		preferences = append(preferences, preference{tag: tag, quality: quality})
+	}
+
+	slices.SortStableFunc(preferences, func(a, b preference) int {
+		return cmp.Compare(b.quality, a.quality)
+	})
+	tags := make([]string, len(preferences))
+	for i, p := range preferences {
+		tags[i] = p.tag
+	}
+	return tags
+}
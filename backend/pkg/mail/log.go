@@ -0,0 +1,30 @@
+package mail
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// Log writes messages to a logger instead of sending them, for development
+type Log struct {
+	Logger *slog.Logger // nil uses slog.Default
+}
+
+func (l *Log) Send(ctx context.Context, msg *Message) error {
+	if _, _, err := msg.envelope(); err != nil {
+		return err
+	}
+
+	logger := l.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.InfoContext(ctx, "Email not sent, logging it instead",
+		"from", msg.From,
+		"to", strings.Join(msg.To, ", "),
+		"subject", msg.Subject,
+		"body", msg.Text,
+	)
+	return nil
+}
@@ -0,0 +1,242 @@
+// Package mail sends email through interchangeable transports: SMTP, an
+// email provider's HTTP API, files on disk, the log, or memory for tests.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoSender     = errors.New("mail: message has no sender")
+	ErrNoRecipients = errors.New("mail: message has no recipients")
+)
+
+// Mailer delivers messages. Implementations are safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// IsPermanent reports whether err means sending the message again will
+// fail the same way: the SMTP server rejected it with a 5xx reply, or the
+// provider refused it with a 4xx status other than a timeout or rate limit.
+// Anything else, such as a connection failure, is worth retrying.
+func IsPermanent(err error) bool {
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 500
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		code := providerErr.StatusCode
+		return code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+	}
+	return false
+}
+
+// Message is an email with a plain text body and optionally an HTML
+// alternative. Date and MessageID are filled in when the message is first
+// rendered, so every transport sees the same values.
+type Message struct {
+	From    string   // address, optionally with a display name
+	To      []string // addresses, optionally with display names
+	Subject string
+	Text    string
+	HTML    string // sent as a multipart/alternative with Text when set
+
+	// Headers are added to the standard ones, which they cannot replace
+	Headers map[string]string
+
+	Date      time.Time
+	MessageID string // without angle brackets
+
+	// DKIMSignature is the value of the DKIM-Signature header, set by
+	// DKIM.Sign
+	DKIMSignature string
+}
+
+// reservedHeaders are written by Bytes and cannot be set through Headers
+var reservedHeaders = map[string]bool{
+	"Date": true, "Message-Id": true, "From": true, "To": true, "Cc": true, "Bcc": true,
+	"Subject": true, "Mime-Version": true, "Content-Type": true, "Content-Transfer-Encoding": true,
+	"Dkim-Signature": true,
+}
+
+// envelope validates the sender and recipients and returns their bare
+// addresses for the SMTP envelope
+func (m *Message) envelope() (from string, to []string, err error) {
+	if m.From == "" {
+		return "", nil, ErrNoSender
+	}
+	if len(m.To) == 0 {
+		return "", nil, ErrNoRecipients
+	}
+
+	sender, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return "", nil, fmt.Errorf("mail: invalid sender %q: %w", m.From, err)
+	}
+	for _, recipient := range m.To {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return "", nil, fmt.Errorf("mail: invalid recipient %q: %w", recipient, err)
+		}
+		to = append(to, address.Address)
+	}
+	return sender.Address, to, nil
+}
+
+// Bytes renders the message in RFC 5322 format. Bodies are quoted-printable
+// UTF-8 with CRLF line endings and non-ASCII headers are encoded.
+func (m *Message) Bytes() ([]byte, error) {
+	from, _, err := m.envelope()
+	if err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return nil, errors.New("mail: subject contains a line break")
+	}
+	if err := m.validateHeaders(); err != nil {
+		return nil, err
+	}
+
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	if m.MessageID == "" {
+		m.MessageID = newMessageID(from)
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	// The signature is folded over several lines by DKIM.Sign
+	if m.DKIMSignature != "" {
+		if strings.ContainsAny(strings.ReplaceAll(m.DKIMSignature, "\r\n\t", ""), "\r\n") {
+			return nil, errors.New("mail: DKIM signature contains a line break")
+		}
+		header("DKIM-Signature", m.DKIMSignature)
+	}
+	header("Date", m.Date.Format(time.RFC1123Z))
+	header("Message-ID", "<"+m.MessageID+">")
+	header("From", formatAddress(m.From))
+	to := make([]string, len(m.To))
+	for i, recipient := range m.To {
+		to[i] = formatAddress(recipient)
+	}
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	for _, name := range slices.Sorted(maps.Keys(m.Headers)) {
+		header(textproto.CanonicalMIMEHeaderKey(name), mime.QEncoding.Encode("utf-8", m.Headers[name]))
+	}
+	header("MIME-Version", "1.0")
+
+	if m.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	// The boundary is derived from the message id so the message renders
+	// the same every time
+	parts := multipart.NewWriter(&buf)
+	sum := sha256.Sum256([]byte(m.MessageID))
+	if err := parts.SetBoundary(hex.EncodeToString(sum[:16])); err != nil {
+		return nil, err
+	}
+	header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": parts.Boundary()}))
+	buf.WriteString("\r\n")
+
+	// Clients show the last alternative they support, so HTML goes last
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (m *Message) validateHeaders() error {
+	for name, value := range m.Headers {
+		if name == "" || strings.IndexFunc(name, func(r rune) bool { return r <= ' ' || r > '~' || r == ':' }) >= 0 {
+			return fmt.Errorf("mail: invalid header name %q", name)
+		}
+		if reservedHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+			return fmt.Errorf("mail: header %s cannot be set", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("mail: header %s contains a line break", name)
+		}
+	}
+	return nil
+}
+
+// formatAddress encodes the display name of an address validated by
+// envelope
+func formatAddress(address string) string {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return address
+	}
+	return parsed.String()
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(crlf(body))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// crlf normalizes line endings to CRLF
+func crlf(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+// newMessageID returns a unique message id in the sender's domain
+func newMessageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndexByte(from, '@'); at >= 0 {
+		domain = from[at+1:]
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b) + "@" + domain
+}
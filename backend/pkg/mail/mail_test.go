@@ -0,0 +1,297 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testMessage() *Message {
+	return &Message{
+		From:    "Votex <noreply@example.com>",
+		To:      []string{"alice@example.com"},
+		Subject: "Grüße",
+		Text:    "Hello Alice,\n\nClick the following link:\nhttps://example.com/auth/magic-link?token=abc\n",
+	}
+}
+
+// parse reads a rendered message back and returns its decoded body
+func parse(t *testing.T, data []byte) (*mail.Message, string) {
+	t.Helper()
+	parsed, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	return parsed, string(body)
+}
+
+func TestMessage_Bytes(t *testing.T) {
+	msg := testMessage()
+	data, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+
+	parsed, body := parse(t, data)
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); subject != "Grüße" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	if got := parsed.Header.Get("Message-ID"); got != "<"+msg.MessageID+">" || !strings.HasSuffix(msg.MessageID, "@example.com") {
+		t.Errorf("unexpected message id %q", got)
+	}
+	if _, err := parsed.Header.Date(); err != nil {
+		t.Errorf("unexpected date: %v", err)
+	}
+	if body != strings.ReplaceAll(msg.Text, "\n", "\r\n") {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	// Rendering again keeps the date and id
+	again, _ := msg.Bytes()
+	if string(again) != string(data) {
+		t.Error("expected the same message when rendered twice")
+	}
+}
+
+func TestMessage_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Message)
+	}{
+		{name: "no sender", modify: func(m *Message) { m.From = "" }},
+		{name: "no recipients", modify: func(m *Message) { m.To = nil }},
+		{name: "header injection in recipient", modify: func(m *Message) { m.To = []string{"alice@example.com\r\nBcc: eve@example.com"} }},
+		{name: "header injection in subject", modify: func(m *Message) { m.Subject = "Hi\r\nBcc: eve@example.com" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := testMessage()
+			tt.modify(msg)
+			if _, err := msg.Bytes(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestMessage_Multipart(t *testing.T) {
+	msg := testMessage()
+	msg.From = "Zoë <noreply@example.com>"
+	msg.HTML = `<p>Hello Alice,</p><p><a href="https://example.com/auth/magic-link?token=abc">Sign in</a></p>`
+	msg.Headers = map[string]string{"auto-submitted": "auto-generated", "Content-Language": "de"}
+
+	data, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	if from, err := parsed.Header.AddressList("From"); err != nil || from[0].Name != "Zoë" {
+		t.Errorf("unexpected sender %v (%v)", from, err)
+	}
+	if parsed.Header.Get("Auto-Submitted") != "auto-generated" || parsed.Header.Get("Content-Language") != "de" {
+		t.Errorf("expected the custom headers, got %v", parsed.Header)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected content type %q (%v)", parsed.Header.Get("Content-Type"), err)
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		body, _ := io.ReadAll(quotedprintable.NewReader(part))
+		types = append(types, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+	if strings.Join(types, ",") != "text/plain; charset=utf-8,text/html; charset=utf-8" {
+		t.Fatalf("unexpected parts %v", types)
+	}
+	if bodies[1] != msg.HTML {
+		t.Errorf("unexpected HTML %q", bodies[1])
+	}
+
+	again, _ := msg.Bytes()
+	if string(again) != string(data) {
+		t.Error("expected the same message when rendered twice")
+	}
+}
+
+func TestMessage_InvalidHeaders(t *testing.T) {
+	for _, headers := range []map[string]string{
+		{"Bcc": "eve@example.com"},
+		{"content-type": "text/html"},
+		{"X-Note": "hi\r\nBcc: eve@example.com"},
+		{"X Note": "hi"},
+	} {
+		msg := testMessage()
+		msg.Headers = headers
+		if _, err := msg.Bytes(); err == nil {
+			t.Errorf("expected %v to be refused", headers)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	t.Run("eml", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "mail")
+		mailer := &File{Dir: dir}
+		for range 2 {
+			if err := mailer.Send(context.Background(), testMessage()); err != nil {
+				t.Fatalf("failed to send: %v", err)
+			}
+		}
+
+		files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if len(files) != 2 {
+			t.Fatalf("expected 2 .eml files, got %v", files)
+		}
+		data, _ := os.ReadFile(files[0])
+		if _, body := parse(t, data); !strings.Contains(body, "token=abc") {
+			t.Errorf("unexpected body %q", body)
+		}
+		if leftovers, _ := filepath.Glob(filepath.Join(dir, ".tmp-*")); len(leftovers) != 0 {
+			t.Errorf("expected no temporary files, got %v", leftovers)
+		}
+	})
+
+	t.Run("maildir", func(t *testing.T) {
+		dir := t.TempDir()
+		mailer := &File{Dir: dir, Maildir: true}
+		for range 2 {
+			if err := mailer.Send(context.Background(), testMessage()); err != nil {
+				t.Fatalf("failed to send: %v", err)
+			}
+		}
+
+		for sub, expected := range map[string]int{"new": 2, "tmp": 0, "cur": 0} {
+			entries, err := os.ReadDir(filepath.Join(dir, sub))
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", sub, err)
+			}
+			if len(entries) != expected {
+				t.Errorf("expected %d messages in %s, got %d", expected, sub, len(entries))
+			}
+		}
+	})
+}
+
+func TestMemory(t *testing.T) {
+	var mailer Memory
+	msg := testMessage()
+	if err := mailer.Send(context.Background(), msg); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	msg.To[0] = "mallory@example.com"
+
+	messages := mailer.Messages()
+	if len(messages) != 1 || messages[0].To[0] != "alice@example.com" {
+		t.Fatalf("expected the message as sent, got %+v", messages)
+	}
+
+	if err := mailer.Send(context.Background(), &Message{From: "noreply@example.com"}); !errors.Is(err, ErrNoRecipients) {
+		t.Errorf("expected ErrNoRecipients, got %v", err)
+	}
+
+	mailer.Reset()
+	if len(mailer.Messages()) != 0 {
+		t.Error("expected no messages after a reset")
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	var received httpMessage
+	var authorization string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+		if received.To[0] == "bounce@example.com" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"message":"recipient is suppressed"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"provider-id"}`))
+	}))
+	defer provider.Close()
+
+	mailer := &HTTP{URL: provider.URL, APIKey: "re_test"}
+	msg := testMessage()
+	if err := mailer.Send(context.Background(), msg); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	if authorization != "Bearer re_test" {
+		t.Errorf("unexpected authorization %q", authorization)
+	}
+	if received.From != msg.From || received.Subject != "Grüße" || received.Text != msg.Text {
+		t.Errorf("unexpected message %+v", received)
+	}
+	if received.Headers["Message-ID"] != "<"+msg.MessageID+">" {
+		t.Errorf("unexpected headers %v", received.Headers)
+	}
+
+	bounced := testMessage()
+	bounced.To = []string{"bounce@example.com"}
+	err := mailer.Send(context.Background(), bounced)
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) {
+		t.Fatalf("expected a ProviderError, got %v", err)
+	}
+	if providerErr.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(providerErr.Body, "suppressed") {
+		t.Errorf("unexpected error %+v", providerErr)
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		permanent bool
+	}{
+		{name: "mailbox unavailable", err: fmt.Errorf("failed to set recipient: %w", &textproto.Error{Code: 550, Msg: "no such user"}), permanent: true},
+		{name: "greylisted", err: fmt.Errorf("failed to set recipient: %w", &textproto.Error{Code: 451, Msg: "try again later"})},
+		{name: "provider refused", err: &ProviderError{StatusCode: http.StatusUnprocessableEntity}, permanent: true},
+		{name: "provider rate limit", err: &ProviderError{StatusCode: http.StatusTooManyRequests}},
+		{name: "provider outage", err: &ProviderError{StatusCode: http.StatusBadGateway}},
+		{name: "connection refused", err: errors.New("failed to connect to SMTP server: connection refused")},
+		{name: "timeout", err: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanent(tt.err); got != tt.permanent {
+				t.Errorf("expected IsPermanent %v, got %v", tt.permanent, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package mail
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Memory keeps messages in memory instead of sending them, for tests. The
+// zero value is ready to use.
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *Memory) Send(ctx context.Context, msg *Message) error {
+	if _, _, err := msg.envelope(); err != nil {
+		return err
+	}
+
+	sent := *msg
+	sent.To = slices.Clone(msg.To)
+	sent.Headers = maps.Clone(msg.Headers)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, sent)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.messages)
+}
+
+// Reset forgets the messages sent so far
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
@@ -0,0 +1,140 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// Security is how an SMTP connection is encrypted
+type Security string
+
+const (
+	// StartTLS upgrades a plain connection, usually on port 587. Servers
+	// that do not offer the upgrade are refused.
+	StartTLS Security = "starttls"
+	// ImplicitTLS connects over TLS from the start, usually on port 465
+	ImplicitTLS Security = "tls"
+	// NoTLS sends in the clear, for local relays only. Credentials are
+	// still only sent to localhost.
+	NoTLS Security = "none"
+)
+
+// ErrStartTLSUnsupported is returned when a StartTLS server does not offer
+// the upgrade
+var ErrStartTLSUnsupported = errors.New("mail: SMTP server does not support STARTTLS")
+
+// SMTP sends messages through an SMTP server, opening a connection for
+// every message
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string // empty skips authentication
+	Password string
+	Security Security // empty uses StartTLS
+
+	// TLSConfig verifies the server; nil verifies Host against the system
+	// roots
+	TLSConfig *tls.Config
+	// LocalName is sent in EHLO; empty sends localhost
+	LocalName string
+}
+
+func (s *SMTP) Send(ctx context.Context, msg *Message) error {
+	from, to, err := msg.envelope()
+	if err != nil {
+		return err
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	// net/smtp has no context support; expire the connection instead
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to create SMTP client: %w", err)
+	}
+	defer client.Close()
+
+	if s.LocalName != "" {
+		if err := client.Hello(s.LocalName); err != nil {
+			return fmt.Errorf("failed to greet SMTP server: %w", err)
+		}
+	}
+
+	if s.Security == StartTLS || s.Security == "" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return ErrStartTLSUnsupported
+		}
+		if err := client.StartTLS(s.tlsConfig()); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	if s.Username != "" {
+		auth := smtp.PlainAuth("", s.Username, s.Password, s.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("failed to set recipient: %w", err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to get data writer: %w", err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	// The server only accepts the message once the data is closed
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return client.Quit()
+}
+
+func (s *SMTP) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	if s.Security == ImplicitTLS {
+		dialer := &tls.Dialer{Config: s.tlsConfig()}
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+func (s *SMTP) tlsConfig() *tls.Config {
+	if s.TLSConfig == nil {
+		return &tls.Config{ServerName: s.Host}
+	}
+	config := s.TLSConfig.Clone()
+	if config.ServerName == "" {
+		config.ServerName = s.Host
+	}
+	return config
+}
@@ -0,0 +1,257 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed certificate for 127.0.0.1 and a
+// client config trusting it
+func testCertificate(t *testing.T) (tls.Certificate, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, &tls.Config{RootCAs: roots}
+}
+
+// smtpServer is a minimal SMTP server that accepts every message
+type smtpServer struct {
+	tls         *tls.Config
+	implicitTLS bool // serve TLS from the start
+	startTLS    bool // offer STARTTLS
+
+	mu       sync.Mutex
+	auth     string   // decoded AUTH PLAIN response
+	from     string   // MAIL FROM address
+	to       []string // RCPT TO addresses
+	data     string
+	tlsInUse bool // whether the message arrived over TLS
+}
+
+func (s *smtpServer) start(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	secure := false
+	if s.implicitTLS {
+		conn = tls.Server(conn, s.tls)
+		secure = true
+	}
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 127.0.0.1 ESMTP test")
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			lines := []string{"127.0.0.1", "AUTH PLAIN"}
+			if s.startTLS && !secure {
+				lines = append(lines, "STARTTLS")
+			}
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				text.PrintfLine("250%s%s", sep, l)
+			}
+		case "STARTTLS":
+			text.PrintfLine("220 Ready to start TLS")
+			conn = tls.Server(conn, s.tls)
+			text = textproto.NewConn(conn)
+			secure = true
+		case "AUTH":
+			_, response, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(response)
+			s.mu.Lock()
+			s.auth = string(decoded)
+			s.mu.Unlock()
+			text.PrintfLine("235 Authenticated")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			s.mu.Lock()
+			s.to = append(s.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 Go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = string(data)
+			s.tlsInUse = secure
+			s.mu.Unlock()
+			text.PrintfLine("250 Queued")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	cert, clientTLS := testCertificate(t)
+	serverTLS := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	tests := []struct {
+		name     string
+		server   *smtpServer
+		security Security
+		username string
+		secure   bool
+	}{
+		{name: "starttls", server: &smtpServer{tls: serverTLS, startTLS: true}, security: StartTLS, username: "mailer", secure: true},
+		{name: "implicit tls", server: &smtpServer{tls: serverTLS, implicitTLS: true}, security: ImplicitTLS, username: "mailer", secure: true},
+		{name: "plain local relay", server: &smtpServer{}, security: NoTLS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := tt.server.start(t)
+			mailer := &SMTP{
+				Host:      "127.0.0.1",
+				Port:      port,
+				Username:  tt.username,
+				Password:  "secret",
+				Security:  tt.security,
+				TLSConfig: clientTLS,
+			}
+
+			msg := testMessage()
+			msg.To = append(msg.To, "Bob <bob@example.com>")
+			if err := mailer.Send(context.Background(), msg); err != nil {
+				t.Fatalf("failed to send: %v", err)
+			}
+
+			s := tt.server
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.from != "noreply@example.com" {
+				t.Errorf("unexpected sender %q", s.from)
+			}
+			if strings.Join(s.to, ",") != "alice@example.com,bob@example.com" {
+				t.Errorf("unexpected recipients %v", s.to)
+			}
+			if tt.username != "" && s.auth != "\x00mailer\x00secret" {
+				t.Errorf("unexpected authentication %q", s.auth)
+			}
+			if s.tlsInUse != tt.secure {
+				t.Errorf("expected TLS %v, got %v", tt.secure, s.tlsInUse)
+			}
+			if _, body := parse(t, []byte(s.data)); !strings.Contains(body, "token=abc") {
+				t.Errorf("unexpected body %q", body)
+			}
+		})
+	}
+}
+
+func TestSMTP_StartTLSRequired(t *testing.T) {
+	_, clientTLS := testCertificate(t)
+	port := (&smtpServer{}).start(t)
+
+	mailer := &SMTP{Host: "127.0.0.1", Port: port, Security: StartTLS, TLSConfig: clientTLS}
+	if err := mailer.Send(context.Background(), testMessage()); !errors.Is(err, ErrStartTLSUnsupported) {
+		t.Errorf("expected ErrStartTLSUnsupported, got %v", err)
+	}
+}
+
+func TestSMTP_UntrustedCertificate(t *testing.T) {
+	cert, _ := testCertificate(t)
+	server := &smtpServer{tls: &tls.Config{Certificates: []tls.Certificate{cert}}, startTLS: true}
+	port := server.start(t)
+
+	mailer := &SMTP{Host: "127.0.0.1", Port: port, Security: StartTLS}
+	if err := mailer.Send(context.Background(), testMessage()); err == nil {
+		t.Error("expected a self-signed certificate to be refused")
+	}
+}
+
+func TestSMTP_Timeout(t *testing.T) {
+	// A server that accepts connections but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			bufio.NewReader(conn).ReadByte()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	mailer := &SMTP{Host: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port}
+	if err := mailer.Send(ctx, testMessage()); err == nil {
+		t.Error("expected the send to time out")
+	}
+}
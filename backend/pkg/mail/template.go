@@ -0,0 +1,222 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	templateExt    = ".tmpl"
+	layoutTemplate = "layout" + templateExt
+)
+
+var ErrUnknownTemplate = errors.New("mail: unknown template")
+
+// Templates renders messages from a directory of templates.
+//
+// Each email is a file <name>.tmpl defining the templates "subject",
+// "text_body" and optionally "html_body". layout.tmpl defines "text" and
+// "html", which wrap the bodies in what every email shares. The same files
+// are parsed with text/template for the subject and text and with
+// html/template for the HTML, so values are escaped only where needed.
+//
+// Subdirectories named after a locale, like de or pt-BR, hold translations.
+// An email found there is rendered with the layout of that directory, or
+// the default one if it has none; other emails fall back to the default
+// locale.
+type Templates struct {
+	defaultLocale string
+	// locales maps lowercased locale names, "" for the default, to emails
+	locales map[string]*localeTemplates
+}
+
+type localeTemplates struct {
+	name   string // as spelled in the directory name
+	emails map[string]*emailTemplate
+}
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template // nil without html_body
+}
+
+// ParseTemplates parses the templates in fsys. defaultLocale names the
+// language of the top level templates.
+func ParseTemplates(fsys fs.FS, defaultLocale string) (*Templates, error) {
+	t := &Templates{defaultLocale: defaultLocale, locales: make(map[string]*localeTemplates)}
+
+	defaults, err := parseLocale(fsys, ".", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(defaults.emails) == 0 {
+		return nil, errors.New("mail: no email templates found")
+	}
+	defaults.name = defaultLocale
+	t.locales[""] = defaults
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	defaultLayout, _ := fs.ReadFile(fsys, layoutTemplate)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		locale, err := parseLocale(fsys, entry.Name(), defaultLayout)
+		if err != nil {
+			return nil, err
+		}
+		for name := range locale.emails {
+			if _, ok := defaults.emails[name]; !ok {
+				return nil, fmt.Errorf("mail: %s/%s has no default template", entry.Name(), name+templateExt)
+			}
+		}
+		locale.name = entry.Name()
+		t.locales[strings.ToLower(entry.Name())] = locale
+	}
+	return t, nil
+}
+
+// parseLocale parses the emails in dir, using fallbackLayout when dir has
+// no layout of its own
+func parseLocale(fsys fs.FS, dir string, fallbackLayout []byte) (*localeTemplates, error) {
+	layout, err := fs.ReadFile(fsys, path.Join(dir, layoutTemplate))
+	if errors.Is(err, fs.ErrNotExist) {
+		layout, err = fallbackLayout, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := fs.Glob(fsys, path.Join(dir, "*"+templateExt))
+	if err != nil {
+		return nil, err
+	}
+
+	locale := &localeTemplates{emails: make(map[string]*emailTemplate)}
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), templateExt)
+		if name+templateExt == layoutTemplate {
+			continue
+		}
+		source, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		email, err := parseEmail(name, string(layout), string(source))
+		if err != nil {
+			return nil, fmt.Errorf("mail: %s: %w", file, err)
+		}
+		locale.emails[name] = email
+	}
+	return locale, nil
+}
+
+func parseEmail(name, layout, source string) (*emailTemplate, error) {
+	text, err := texttemplate.New(name).Option("missingkey=error").Parse(layout)
+	if err == nil {
+		_, err = text.Parse(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, required := range []string{"subject", "text", "text_body"} {
+		if text.Lookup(required) == nil {
+			return nil, fmt.Errorf("template %q is not defined", required)
+		}
+	}
+
+	email := &emailTemplate{text: text}
+	if text.Lookup("html_body") == nil {
+		return email, nil
+	}
+	if text.Lookup("html") == nil {
+		return nil, errors.New(`template "html" is not defined`)
+	}
+	html, err := htmltemplate.New(name).Option("missingkey=error").Parse(layout)
+	if err == nil {
+		_, err = html.Parse(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	email.html = html
+	return email, nil
+}
+
+// Render renders the email called name in the first of locales there is a
+// translation for, or in the default locale. The message has its Subject,
+// Text, HTML and Content-Language header set.
+func (t *Templates) Render(name string, locales []string, data any) (*Message, error) {
+	locale, email := t.match(name, locales)
+	if email == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := email.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := email.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return nil, err
+	}
+	if email.html != nil {
+		if err := email.html.ExecuteTemplate(&html, "html", data); err != nil {
+			return nil, err
+		}
+	}
+
+	msg := &Message{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    strings.TrimSpace(html.String()),
+		Headers: make(map[string]string),
+	}
+	if locale != "" {
+		msg.Headers["Content-Language"] = locale
+	}
+	return msg, nil
+}
+
+func (t *Templates) match(name string, locales []string) (string, *emailTemplate) {
+	for _, locale := range locales {
+		language, _, _ := strings.Cut(locale, "-")
+		for _, candidate := range []string{locale, language} {
+			candidate = strings.ToLower(candidate)
+			if candidate == strings.ToLower(t.defaultLocale) {
+				return t.defaultLocale, t.locales[""].emails[name]
+			}
+			if translated, ok := t.locales[candidate]; ok && translated.emails[name] != nil {
+				return translated.name, translated.emails[name]
+			}
+		}
+	}
+	return t.defaultLocale, t.locales[""].emails[name]
+}
+
+// Names returns the names of the emails, sorted
+func (t *Templates) Names() []string {
+	return slices.Sorted(maps.Keys(t.locales[""].emails))
+}
+
+// Locales returns the default locale followed by the translated ones, sorted
+func (t *Templates) Locales() []string {
+	var translated []string
+	for key, locale := range t.locales {
+		if key != "" {
+			translated = append(translated, locale.name)
+		}
+	}
+	slices.Sort(translated)
+	return append([]string{t.defaultLocale}, translated...)
+}
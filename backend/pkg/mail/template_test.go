@@ -0,0 +1,170 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const testLayout = `
+{{define "text"}}{{template "text_body" .}}
+
+-- {{.AppName}}{{end}}
+{{define "html"}}<html><body>{{template "html_body" .}}</body></html>{{end}}
+`
+
+func testTemplates() fstest.MapFS {
+	return fstest.MapFS{
+		"layout.tmpl": {Data: []byte(testLayout)},
+		"welcome.tmpl": {Data: []byte(`
+{{define "subject"}}
+  Welcome to {{.AppName}}
+{{end}}
+{{define "text_body"}}Hello {{.Username}},{{end}}
+{{define "html_body"}}<p>Hello {{.Username}},</p>{{end}}
+`)},
+		"notice.tmpl": {Data: []byte(`
+{{define "subject"}}Notice{{end}}
+{{define "text_body"}}Text only{{end}}
+`)},
+		"de/welcome.tmpl": {Data: []byte(`
+{{define "subject"}}Willkommen bei {{.AppName}}{{end}}
+{{define "text_body"}}Hallo {{.Username}},{{end}}
+{{define "html_body"}}<p>Hallo {{.Username}},</p>{{end}}
+`)},
+		"pt-BR/layout.tmpl": {Data: []byte(`
+{{define "text"}}{{template "text_body" .}}
+
+-- Equipe {{.AppName}}{{end}}
+{{define "html"}}<html lang="pt-BR"><body>{{template "html_body" .}}</body></html>{{end}}
+`)},
+		"pt-BR/welcome.tmpl": {Data: []byte(`
+{{define "subject"}}Bem-vindo ao {{.AppName}}{{end}}
+{{define "text_body"}}Olá {{.Username}},{{end}}
+{{define "html_body"}}<p>Olá {{.Username}},</p>{{end}}
+`)},
+	}
+}
+
+func TestTemplates_Render(t *testing.T) {
+	templates, err := ParseTemplates(testTemplates(), "en")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if names := templates.Names(); !slices.Equal(names, []string{"notice", "welcome"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+	if locales := templates.Locales(); !slices.Equal(locales, []string{"en", "de", "pt-BR"}) {
+		t.Errorf("unexpected locales %v", locales)
+	}
+
+	data := map[string]any{"AppName": "Votex", "Username": "<alice>"}
+	tests := []struct {
+		name     string
+		template string
+		locales  []string
+		language string
+		subject  string
+		text     string
+		html     string
+	}{
+		{
+			name: "default", template: "welcome", language: "en",
+			subject: "Welcome to Votex", text: "Hello <alice>,\n\n-- Votex\n",
+			html: "<html><body><p>Hello &lt;alice&gt;,</p></body></html>",
+		},
+		{
+			name: "translation with the default layout", template: "welcome", locales: []string{"de-CH"}, language: "de",
+			subject: "Willkommen bei Votex", text: "Hallo <alice>,\n\n-- Votex\n",
+			html: "<html><body><p>Hallo &lt;alice&gt;,</p></body></html>",
+		},
+		{
+			name: "translation with its own layout", template: "welcome", locales: []string{"PT-br"}, language: "pt-BR",
+			subject: "Bem-vindo ao Votex", text: "Olá <alice>,\n\n-- Equipe Votex\n",
+			html: `<html lang="pt-BR"><body><p>Olá &lt;alice&gt;,</p></body></html>`,
+		},
+		{
+			name: "untranslated email", template: "notice", locales: []string{"de"}, language: "en",
+			subject: "Notice", text: "Text only\n\n-- Votex\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := templates.Render(tt.template, tt.locales, data)
+			if err != nil {
+				t.Fatalf("failed to render: %v", err)
+			}
+			if msg.Subject != tt.subject || msg.Text != tt.text || msg.HTML != tt.html {
+				t.Errorf("unexpected message\nsubject %q\ntext %q\nhtml %q", msg.Subject, msg.Text, msg.HTML)
+			}
+			if msg.Headers["Content-Language"] != tt.language {
+				t.Errorf("expected language %s, got %v", tt.language, msg.Headers)
+			}
+		})
+	}
+
+	if _, err := templates.Render("missing", nil, data); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("expected ErrUnknownTemplate, got %v", err)
+	}
+	if _, err := templates.Render("welcome", nil, map[string]any{"AppName": "Votex"}); err == nil {
+		t.Error("expected an error for missing data")
+	}
+}
+
+func TestParseTemplates_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{name: "no templates", files: fstest.MapFS{"layout.tmpl": {Data: []byte(testLayout)}}},
+		{name: "no subject", files: fstest.MapFS{
+			"layout.tmpl":  {Data: []byte(testLayout)},
+			"welcome.tmpl": {Data: []byte(`{{define "text_body"}}Hello{{end}}`)},
+		}},
+		{name: "syntax error", files: fstest.MapFS{
+			"layout.tmpl":  {Data: []byte(testLayout)},
+			"welcome.tmpl": {Data: []byte(`{{define "subject"}}{{.Broken{{end}}`)},
+		}},
+		{name: "translation without a default", files: func() fstest.MapFS {
+			files := testTemplates()
+			files["de/goodbye.tmpl"] = files["de/welcome.tmpl"]
+			return files
+		}()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseTemplates(tt.files, "en"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected []string
+	}{
+		{header: "", expected: []string{}},
+		{header: "de", expected: []string{"de"}},
+		{header: "fr;q=0.5, de-AT, de;q=0.9, *;q=0.1", expected: []string{"de-AT", "de", "fr"}},
+		{header: "en;q=0, pt-BR", expected: []string{"pt-BR"}},
+		{header: "en;q=bogus, de", expected: []string{"de"}},
+	}
+
+	for _, tt := range tests {
+		if got := ParseAcceptLanguage(tt.header); !slices.Equal(got, tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.header, tt.expected, got)
+		}
+	}
+
+	ctx := WithLocales(context.Background(), ParseAcceptLanguage("de, en;q=0.8")...)
+	if locales := LocalesFromContext(ctx); strings.Join(locales, ",") != "de,en" {
+		t.Errorf("unexpected locales %v", locales)
+	}
+}
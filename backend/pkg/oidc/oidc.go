@@ -0,0 +1,372 @@
+// Package oidc is an OpenID Connect relying party for the authorization code
+// flow with PKCE. Provider metadata comes from discovery and ID tokens are
+// verified against the provider's published JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/user/votex-template/backend/pkg/jwk"
+)
+
+const (
+	// maxResponseSize bounds what is read from a provider
+	maxResponseSize = 1 << 20
+	// keyRefreshInterval limits how often an unknown kid triggers a JWKS fetch
+	keyRefreshInterval = 10 * time.Second
+	// clockSkew is tolerated when checking token timestamps
+	clockSkew = time.Minute
+)
+
+var (
+	ErrDiscovery      = errors.New("oidc discovery failed")
+	ErrTokenExchange  = errors.New("oidc token exchange failed")
+	ErrInvalidIDToken = errors.New("invalid oidc id token")
+)
+
+// signingMethods are the ID token algorithms accepted from providers
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "EdDSA"}
+
+// Config describes one provider registration
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Metadata is a provider discovery document. The client only relies on the
+// endpoints; the remaining fields are published by the built-in provider.
+type Metadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported            []string `json:"response_types_supported,omitempty"`
+	GrantTypesSupported               []string `json:"grant_types_supported,omitempty"`
+	SubjectTypesSupported             []string `json:"subject_types_supported,omitempty"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty"`
+	ClaimsSupported                   []string `json:"claims_supported,omitempty"`
+}
+
+// TokenResponse is a successful token endpoint response
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// IDToken holds the verified claims of an ID token
+type IDToken struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	Expiry            time.Time
+}
+
+// Client talks to a single provider. Discovery runs on first use, so a
+// provider being down does not stop the server from starting.
+type Client struct {
+	cfg        Config
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	metadata    *Metadata
+	keys        *jwk.Set
+	keysFetched time.Time
+}
+
+func NewClient(cfg Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Client{cfg: cfg, httpClient: httpClient}
+}
+
+// AuthCodeURL returns the provider URL to send the user to. state and nonce
+// must be unguessable and kept to check the callback; codeVerifier is the
+// PKCE secret later passed to Exchange.
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	metadata, err := c.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid authorization endpoint", ErrDiscovery)
+	}
+	params := endpoint.Query()
+	params.Set("response_type", "code")
+	params.Set("client_id", c.cfg.ClientID)
+	params.Set("redirect_uri", c.cfg.RedirectURL)
+	params.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallenge(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = params.Encode()
+	return endpoint.String(), nil
+}
+
+// Exchange redeems an authorization code at the token endpoint
+func (c *Client) Exchange(ctx context.Context, code, codeVerifier string) (*TokenResponse, error) {
+	metadata, err := c.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	// client_secret_basic is the default; use client_secret_post only when
+	// the provider says it is all it supports
+	usePost := c.cfg.ClientSecret != "" && len(metadata.TokenEndpointAuthMethodsSupported) > 0 &&
+		!slices.Contains(metadata.TokenEndpointAuthMethodsSupported, "client_secret_basic") &&
+		slices.Contains(metadata.TokenEndpointAuthMethodsSupported, "client_secret_post")
+	if c.cfg.ClientSecret == "" || usePost {
+		form.Set("client_id", c.cfg.ClientID)
+	}
+	if usePost {
+		form.Set("client_secret", c.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.cfg.ClientSecret != "" && !usePost {
+		req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenExchange, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenExchange, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		_ = json.Unmarshal(body, &oauthErr)
+		return nil, fmt.Errorf("%w: status %d: %s %s", ErrTokenExchange, resp.StatusCode, oauthErr.Error, oauthErr.Description)
+	}
+
+	var tokens TokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenExchange, err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: response has no id_token", ErrTokenExchange)
+	}
+	return &tokens, nil
+}
+
+// idTokenClaims is the wire form of the claims read from an ID token
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string      `json:"nonce"`
+	AuthorizedParty   string      `json:"azp"`
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"`
+	Name              string      `json:"name"`
+	PreferredUsername string      `json:"preferred_username"`
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token (OpenID Connect Core section 3.1.3.7)
+func (c *Client) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDToken, error) {
+	metadata, err := c.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := c.signingKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.Algorithm != "" && key.Algorithm != token.Method.Alg() {
+			return nil, fmt.Errorf("key %q is for %s, not %s", kid, key.Algorithm, token.Method.Alg())
+		}
+		return key.Key, nil
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(c.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != c.cfg.ClientID {
+		return nil, fmt.Errorf("%w: token was issued to another party", ErrInvalidIDToken)
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return &IDToken{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     isTrue(claims.EmailVerified),
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+		Expiry:            claims.ExpiresAt.Time,
+	}, nil
+}
+
+// Metadata returns the provider's discovery document, fetching it once
+func (c *Client) Metadata(ctx context.Context) (*Metadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.metadata != nil {
+		return c.metadata, nil
+	}
+
+	var metadata Metadata
+	wellKnown := strings.TrimSuffix(c.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := c.getJSON(ctx, wellKnown, &metadata); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	if metadata.Issuer != c.cfg.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrDiscovery, metadata.Issuer, c.cfg.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete provider metadata", ErrDiscovery)
+	}
+
+	c.metadata = &metadata
+	return c.metadata, nil
+}
+
+// signingKey finds a verification key, refetching the JWKS when the kid is
+// unknown so provider key rotation is picked up
+func (c *Client) signingKey(ctx context.Context, kid string) (jwk.Key, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.keys != nil {
+		if key, ok := c.keys.Lookup(kid); ok {
+			return key, nil
+		}
+		if time.Since(c.keysFetched) < keyRefreshInterval {
+			return jwk.Key{}, fmt.Errorf("no key with id %q", kid)
+		}
+	}
+
+	var keys jwk.Set
+	if err := c.getJSON(ctx, c.metadata.JWKSURI, &keys); err != nil {
+		return jwk.Key{}, fmt.Errorf("fetching jwks: %w", err)
+	}
+	c.keys = &keys
+	c.keysFetched = time.Now()
+
+	key, ok := keys.Lookup(kid)
+	if !ok {
+		return jwk.Key{}, fmt.Errorf("no key with id %q", kid)
+	}
+	return key, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, endpoint string, dest interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(dest)
+}
+
+// NewCodeVerifier returns a random PKCE code verifier (RFC 7636 section 4.1)
+func NewCodeVerifier() (string, error) {
+	return randomString(32)
+}
+
+// CodeChallenge derives the S256 code challenge for a verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// NewState returns a random value suitable for the state or nonce parameter
+func NewState() (string, error) {
+	return randomString(32)
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// isTrue reads email_verified, which some providers send as a string
+func isTrue(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,163 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/user/votex-template/backend/pkg/oidc"
+	"github.com/user/votex-template/backend/pkg/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:5173/auth/callback/fake"
+
+func newClient(provider *oidctest.Provider) *oidc.Client {
+	return oidc.NewClient(oidc.Config{
+		Issuer:       provider.Issuer(),
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  redirectURL,
+	}, nil)
+}
+
+// authorize runs the browser half of the flow and returns the code with the
+// verifier and nonce the client must present
+func authorize(t *testing.T, client *oidc.Client, provider *oidctest.Provider, claims oidctest.Claims) (code, verifier, nonce string) {
+	t.Helper()
+	ctx := context.Background()
+	state, _ := oidc.NewState()
+	nonce, _ = oidc.NewState()
+	verifier, _ = oidc.NewCodeVerifier()
+
+	authURL, err := client.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("failed to build auth url: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	if u.Query().Get("redirect_uri") != redirectURL || u.Query().Get("scope") != "openid email profile" {
+		t.Errorf("unexpected auth url %s", authURL)
+	}
+
+	code, returnedState, err := provider.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("provider refused the request: %v", err)
+	}
+	if returnedState != state {
+		t.Errorf("state = %q, want %q", returnedState, state)
+	}
+	return code, verifier, nonce
+}
+
+func TestClient_CodeFlow(t *testing.T) {
+	provider := oidctest.NewProvider("votex", "secret")
+	defer provider.Close()
+	client := newClient(provider)
+	ctx := context.Background()
+
+	code, verifier, nonce := authorize(t, client, provider, oidctest.Claims{Subject: "alice-1", Email: "alice@example.com", EmailVerified: true})
+
+	tokens, err := client.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	idToken, err := client.VerifyIDToken(ctx, tokens.IDToken, nonce)
+	if err != nil {
+		t.Fatalf("verification failed: %v", err)
+	}
+	if idToken.Subject != "alice-1" || idToken.Email != "alice@example.com" || !idToken.EmailVerified {
+		t.Errorf("unexpected claims: %+v", idToken)
+	}
+
+	if _, err := client.Exchange(ctx, code, verifier); !errors.Is(err, oidc.ErrTokenExchange) {
+		t.Errorf("expected a code to be redeemable once, got %v", err)
+	}
+}
+
+func TestClient_ExchangeRequiresVerifier(t *testing.T) {
+	provider := oidctest.NewProvider("votex", "secret")
+	defer provider.Close()
+	client := newClient(provider)
+
+	code, _, _ := authorize(t, client, provider, oidctest.Claims{Subject: "alice-1"})
+	otherVerifier, _ := oidc.NewCodeVerifier()
+
+	if _, err := client.Exchange(context.Background(), code, otherVerifier); !errors.Is(err, oidc.ErrTokenExchange) {
+		t.Errorf("expected exchange with the wrong verifier to fail, got %v", err)
+	}
+}
+
+func TestClient_VerifyIDTokenRejects(t *testing.T) {
+	provider := oidctest.NewProvider("votex", "secret")
+	defer provider.Close()
+	client := newClient(provider)
+
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss": provider.Issuer(), "sub": "alice-1", "aud": "votex", "nonce": "n",
+			"iat": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(jwt.MapClaims)
+		nonce  string
+	}{
+		{name: "wrong nonce", nonce: "other"},
+		{name: "wrong audience", mutate: func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{name: "wrong issuer", mutate: func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }},
+		{name: "expired", mutate: func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() }},
+		{name: "no subject", mutate: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "other authorized party", mutate: func(c jwt.MapClaims) { c["aud"] = []string{"votex", "other"}; c["azp"] = "other" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			if tt.mutate != nil {
+				tt.mutate(claims)
+			}
+			nonce := "n"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			_, err := client.VerifyIDToken(context.Background(), provider.SignIDToken(claims), nonce)
+			if !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Errorf("expected ErrInvalidIDToken, got %v", err)
+			}
+		})
+	}
+
+	t.Run("unsigned token", func(t *testing.T) {
+		unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if _, err := client.VerifyIDToken(context.Background(), unsigned, "n"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+			t.Errorf("expected ErrInvalidIDToken, got %v", err)
+		}
+	})
+
+	t.Run("picks up rotated keys", func(t *testing.T) {
+		if _, err := client.VerifyIDToken(context.Background(), provider.SignIDToken(valid()), "n"); err != nil {
+			t.Fatalf("verification failed: %v", err)
+		}
+		provider.RotateKey()
+		// A fresh client has no rate-limited cache, like a restarted server
+		if _, err := newClient(provider).VerifyIDToken(context.Background(), provider.SignIDToken(valid()), "n"); err != nil {
+			t.Errorf("verification after rotation failed: %v", err)
+		}
+	})
+}
+
+func TestClient_DiscoveryIssuerMismatch(t *testing.T) {
+	provider := oidctest.NewProvider("votex", "secret")
+	defer provider.Close()
+
+	client := oidc.NewClient(oidc.Config{Issuer: provider.Issuer() + "/", ClientID: "votex"}, nil)
+	if _, err := client.Metadata(context.Background()); !errors.Is(err, oidc.ErrDiscovery) {
+		t.Errorf("expected ErrDiscovery, got %v", err)
+	}
+}
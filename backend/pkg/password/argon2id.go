@@ -0,0 +1,85 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2idID     = "argon2id"
+	argon2SaltSize = 16
+	argon2KeySize  = 32
+)
+
+var b64 = base64.RawStdEncoding
+
+// Argon2id hashes with Argon2id (RFC 9106), encoded as
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+type Argon2id struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+}
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, argon2KeySize)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2idID, argon2.Version,
+		a.Memory, a.Iterations, a.Parallelism, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (a Argon2id) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (a Argon2id) NeedsRehash(encoded string) bool {
+	params, _, key, err := parseArgon2id(encoded)
+	return err != nil || params != a || len(key) != argon2KeySize
+}
+
+func (a Argon2id) Recognizes(encoded string) bool {
+	fields := phcFields(encoded)
+	return len(fields) > 0 && fields[0] == argon2idID
+}
+
+// parseArgon2id reads the parameters, salt and key out of an encoded hash
+func parseArgon2id(encoded string) (Argon2id, []byte, []byte, error) {
+	var params Argon2id
+	fields := phcFields(encoded)
+	if len(fields) != 5 || fields[0] != argon2idID {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(fields[1], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if _, err := fmt.Sscanf(fields[2], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := b64.DecodeString(fields[3])
+	if err != nil || len(salt) == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	key, err := b64.DecodeString(fields[4])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,57 @@
+package password
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptMaxLength is the number of bytes bcrypt looks at; anything past it
+// would be silently ignored, so longer passwords are refused instead
+const bcryptMaxLength = 72
+
+// Bcrypt hashes with bcrypt, encoded as $2a$<cost>$<salt and hash>. It
+// cannot take passwords longer than 72 bytes.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	if len(password) > bcryptMaxLength {
+		return "", ErrTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b Bcrypt) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword), errors.Is(err, bcrypt.ErrPasswordTooLong):
+		return false, nil
+	default:
+		return false, ErrMalformedHash
+	}
+}
+
+func (b Bcrypt) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != b.Cost
+}
+
+func (b Bcrypt) Recognizes(encoded string) bool {
+	fields := phcFields(encoded)
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "2a", "2b", "2y":
+		return true
+	}
+	return false
+}
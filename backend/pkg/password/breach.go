@@ -0,0 +1,96 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// breachPrefixLength is the number of hex characters of a SHA-1 hash that
+// select a range, as in the Pwned Passwords k-anonymity API
+const breachPrefixLength = 5
+
+// BreachCorpus is a set of SHA-1 hashes of breached passwords, kept in
+// ranges by the first five hex characters of the hash like the Pwned
+// Passwords range API, so a lookup only ever looks at one range.
+type BreachCorpus struct {
+	ranges map[string][]string // prefix to sorted suffixes
+	size   int
+}
+
+// LoadBreachCorpus reads a breach corpus from a file, see ReadBreachCorpus
+func LoadBreachCorpus(path string) (*BreachCorpus, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	corpus, err := ReadBreachCorpus(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return corpus, nil
+}
+
+// ReadBreachCorpus reads one uppercase or lowercase hex SHA-1 hash per line,
+// optionally followed by :<count> as in the files published by Pwned
+// Passwords. Blank lines and lines starting with # are skipped.
+func ReadBreachCorpus(r io.Reader) (*BreachCorpus, error) {
+	corpus := &BreachCorpus{ranges: make(map[string][]string)}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(text, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("line %d: expected a SHA-1 hash", line)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("line %d: expected a SHA-1 hash", line)
+		}
+
+		prefix := hash[:breachPrefixLength]
+		corpus.ranges[prefix] = append(corpus.ranges[prefix], hash[breachPrefixLength:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for prefix, suffixes := range corpus.ranges {
+		slices.Sort(suffixes)
+		suffixes = slices.Compact(suffixes)
+		corpus.ranges[prefix] = slices.Clip(suffixes)
+		corpus.size += len(suffixes)
+	}
+	return corpus, nil
+}
+
+// Len returns the number of hashes in the corpus
+func (c *BreachCorpus) Len() int {
+	return c.size
+}
+
+// Range returns the sorted hash suffixes sharing a five character prefix
+func (c *BreachCorpus) Range(prefix string) []string {
+	return c.ranges[strings.ToUpper(prefix)]
+}
+
+// Contains reports whether password is in the corpus
+func (c *BreachCorpus) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	_, found := slices.BinarySearch(c.Range(hash[:breachPrefixLength]), hash[breachPrefixLength:])
+	return found
+}
@@ -0,0 +1,91 @@
+// Package password hashes and verifies passwords. Hashes are stored as
+// self-describing strings in the PHC string format ($argon2id$v=19$...) or,
+// for bcrypt, the modular crypt format it has always used ($2a$10$...), so
+// the algorithm and parameters a hash was made with can be read back from it
+// and hashes can be upgraded as the configuration changes.
+package password
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrTooLong is returned when hashing a password longer than the
+	// algorithm can take
+	ErrTooLong = errors.New("password too long")
+	// ErrUnknownHash is returned when verifying against a hash no configured
+	// algorithm produced
+	ErrUnknownHash = errors.New("unrecognized password hash")
+	// ErrMalformedHash is returned when a hash of a known algorithm cannot be
+	// parsed
+	ErrMalformedHash = errors.New("malformed password hash")
+)
+
+// Hasher hashes passwords with one algorithm
+type Hasher interface {
+	// Hash returns the encoded hash of password with a fresh salt
+	Hash(password string) (string, error)
+
+	// Verify reports whether password matches an encoded hash
+	Verify(password, encoded string) (bool, error)
+
+	// NeedsRehash reports whether an encoded hash was made with another
+	// algorithm or other parameters than the hasher's
+	NeedsRehash(encoded string) bool
+
+	// Recognizes reports whether encoded was made by this hasher's algorithm
+	Recognizes(encoded string) bool
+}
+
+// Multi hashes new passwords with Current and verifies hashes made by Current
+// or any Legacy algorithm, so existing hashes keep working after a switch
+// and can be rehashed once the password is known.
+type Multi struct {
+	Current Hasher
+	Legacy  []Hasher
+}
+
+// New returns a Multi hashing with current and accepting legacy hashes
+func New(current Hasher, legacy ...Hasher) *Multi {
+	return &Multi{Current: current, Legacy: legacy}
+}
+
+func (m *Multi) Hash(password string) (string, error) {
+	return m.Current.Hash(password)
+}
+
+func (m *Multi) Verify(password, encoded string) (bool, error) {
+	for _, hasher := range m.hashers() {
+		if hasher.Recognizes(encoded) {
+			return hasher.Verify(password, encoded)
+		}
+	}
+	return false, ErrUnknownHash
+}
+
+func (m *Multi) NeedsRehash(encoded string) bool {
+	return !m.Current.Recognizes(encoded) || m.Current.NeedsRehash(encoded)
+}
+
+func (m *Multi) Recognizes(encoded string) bool {
+	for _, hasher := range m.hashers() {
+		if hasher.Recognizes(encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Multi) hashers() []Hasher {
+	return append([]Hasher{m.Current}, m.Legacy...)
+}
+
+// phcFields splits an encoded hash into its $-separated fields, dropping the
+// empty field before the leading $
+func phcFields(encoded string) []string {
+	if !strings.HasPrefix(encoded, "$") {
+		return nil
+	}
+	return strings.Split(encoded[1:], "$")
+}
@@ -0,0 +1,130 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testArgon2id keeps the memory cost low so the tests run quickly
+var testArgon2id = Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+func TestArgon2id(t *testing.T) {
+	hash, err := testArgon2id.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("unexpected encoding: %s", hash)
+	}
+	if other, _ := testArgon2id.Hash("correct horse battery staple"); other == hash {
+		t.Error("expected a fresh salt for every hash")
+	}
+
+	if ok, err := testArgon2id.Verify("correct horse battery staple", hash); err != nil || !ok {
+		t.Errorf("expected the password to match, got %v (%v)", ok, err)
+	}
+	if ok, err := testArgon2id.Verify("wrong", hash); err != nil || ok {
+		t.Errorf("expected a mismatch, got %v (%v)", ok, err)
+	}
+
+	// Passwords past bcrypt's limit are hashed in full
+	long := strings.Repeat("a", 100)
+	longHash, err := testArgon2id.Hash(long)
+	if err != nil {
+		t.Fatalf("failed to hash a long password: %v", err)
+	}
+	if ok, _ := testArgon2id.Verify(long[:72], longHash); ok {
+		t.Error("expected every byte of a long password to count")
+	}
+
+	if testArgon2id.NeedsRehash(hash) {
+		t.Error("expected a hash with the current parameters to be kept")
+	}
+	stronger := Argon2id{Memory: 2048, Iterations: 1, Parallelism: 1}
+	if !stronger.NeedsRehash(hash) {
+		t.Error("expected a hash with other parameters to need rehashing")
+	}
+	// Hashes verify with the parameters they were made with
+	if ok, err := stronger.Verify("correct horse battery staple", hash); err != nil || !ok {
+		t.Errorf("expected the password to match, got %v (%v)", ok, err)
+	}
+}
+
+func TestArgon2id_Malformed(t *testing.T) {
+	for _, encoded := range []string{
+		"",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$aGFzaA",
+		"$argon2i$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ$aGFzaA",
+	} {
+		if _, err := testArgon2id.Verify("password", encoded); !errors.Is(err, ErrMalformedHash) {
+			t.Errorf("%q: expected ErrMalformedHash, got %v", encoded, err)
+		}
+	}
+}
+
+func TestBcrypt(t *testing.T) {
+	hasher := Bcrypt{Cost: 4}
+	hash, err := hasher.Hash("password123")
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+	if !hasher.Recognizes(hash) || testArgon2id.Recognizes(hash) {
+		t.Errorf("expected only bcrypt to recognize %s", hash)
+	}
+
+	if ok, err := hasher.Verify("password123", hash); err != nil || !ok {
+		t.Errorf("expected the password to match, got %v (%v)", ok, err)
+	}
+	if ok, err := hasher.Verify("wrong", hash); err != nil || ok {
+		t.Errorf("expected a mismatch, got %v (%v)", ok, err)
+	}
+	if ok, err := hasher.Verify(strings.Repeat("a", 100), hash); err != nil || ok {
+		t.Errorf("expected a long password to mismatch, got %v (%v)", ok, err)
+	}
+
+	if _, err := hasher.Hash(strings.Repeat("a", 73)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("expected ErrTooLong, got %v", err)
+	}
+
+	if hasher.NeedsRehash(hash) {
+		t.Error("expected a hash with the current cost to be kept")
+	}
+	if !(Bcrypt{Cost: 5}).NeedsRehash(hash) {
+		t.Error("expected a hash with another cost to need rehashing")
+	}
+}
+
+func TestMulti(t *testing.T) {
+	legacy := Bcrypt{Cost: 4}
+	hasher := New(testArgon2id, legacy)
+
+	bcryptHash, err := legacy.Hash("password123")
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+	if ok, err := hasher.Verify("password123", bcryptHash); err != nil || !ok {
+		t.Errorf("expected a legacy hash to verify, got %v (%v)", ok, err)
+	}
+	if !hasher.NeedsRehash(bcryptHash) {
+		t.Error("expected a legacy hash to need rehashing")
+	}
+
+	hash, err := hasher.Hash("password123")
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+	if !testArgon2id.Recognizes(hash) || hasher.NeedsRehash(hash) {
+		t.Errorf("expected new hashes to use the current algorithm, got %s", hash)
+	}
+
+	if _, err := hasher.Verify("password123", ""); !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("expected ErrUnknownHash for an account without a password, got %v", err)
+	}
+	if _, err := hasher.Verify("password123", "$scrypt$ln=15,r=8,p=1$c2FsdA$aGFzaA"); !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("expected ErrUnknownHash, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rules a password can break, reported in Violation.Rule
+const (
+	RuleMinLength = "min_length"
+	RuleClasses   = "character_classes"
+	RuleStrength  = "strength"
+	RuleUserInfo  = "user_info"
+	RuleBreached  = "breached"
+	// RuleReused is not checked by Policy; callers holding the password
+	// history report it themselves
+	RuleReused = "reused"
+)
+
+// minFragmentLength is the shortest username or email fragment a password
+// may not contain; shorter ones would rule out too many passwords
+const minFragmentLength = 3
+
+// Policy is the set of rules a new password has to satisfy. Zero values
+// turn a rule off.
+type Policy struct {
+	MinLength      int           // in characters
+	MinClasses     int           // of lowercase, uppercase, digits and symbols
+	MinStrength    int           // 0-4, see Strength
+	RejectUserInfo bool          // reject passwords containing the username or email
+	Breaches       *BreachCorpus // reject passwords found in a breach
+}
+
+// Violation is one rule a password breaks
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+// Check returns every rule password breaks, or nil when it satisfies the
+// policy. userInputs are the username, email address and anything else an
+// attacker would know about the account.
+func (p Policy) Check(password string, userInputs ...string) []Violation {
+	var violations []Violation
+
+	if p.MinLength > 0 && utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+
+	if p.MinClasses > 1 && CharacterClasses(password) < p.MinClasses {
+		violations = append(violations, Violation{
+			Rule:    RuleClasses,
+			Message: fmt.Sprintf("Password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinClasses),
+		})
+	}
+
+	if p.RejectUserInfo {
+		if containsUserInfo(password, userInputs) {
+			violations = append(violations, Violation{
+				Rule:    RuleUserInfo,
+				Message: "Password must not contain your username or email address",
+			})
+		}
+	}
+
+	if p.MinStrength > 0 && Strength(password, userInputs...) < p.MinStrength {
+		violations = append(violations, Violation{
+			Rule:    RuleStrength,
+			Message: "Password is too easy to guess",
+		})
+	}
+
+	if p.Breaches != nil && p.Breaches.Contains(password) {
+		violations = append(violations, Violation{
+			Rule:    RuleBreached,
+			Message: "Password has appeared in a data breach and cannot be used",
+		})
+	}
+
+	return violations
+}
+
+// CharacterClasses counts how many of lowercase letters, uppercase letters,
+// digits and symbols password uses
+func CharacterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// containsUserInfo reports whether password contains a fragment of
+// userInputs, ignoring case and common character substitutions
+func containsUserInfo(password string, userInputs []string) bool {
+	lowered := strings.ToLower(password)
+	unleeted := unleet(lowered)
+	for _, fragment := range userFragments(userInputs) {
+		if strings.Contains(lowered, fragment) || strings.Contains(unleeted, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// userFragments splits user inputs into the pieces a password may not
+// contain: each input, or the local part of an email address, whole and
+// split into words
+func userFragments(userInputs []string) []string {
+	var fragments []string
+	add := func(fragment string) {
+		if utf8.RuneCountInString(fragment) >= minFragmentLength {
+			fragments = append(fragments, fragment)
+		}
+	}
+
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		local, _, _ := strings.Cut(input, "@")
+		add(local)
+		words := strings.FieldsFunc(local, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(words) > 1 {
+			for _, word := range words {
+				add(word)
+			}
+		}
+	}
+	return fragments
+}
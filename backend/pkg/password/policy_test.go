@@ -0,0 +1,126 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		maxScore int
+		minScore int
+	}{
+		{"password", 0, 0},
+		{"password123", 0, 0},
+		{"P@ssw0rd!", 1, 0},
+		{"qwerty123", 0, 0},
+		{"zaq12wsx", 0, 0},
+		{"aaaaaaaaaaaa", 0, 0},
+		{"abcabcabcabc", 0, 0},
+		{"12345678", 0, 0},
+		{"Summer2024", 1, 0},
+		{"kX9#mq2!vLp7", 4, 4},
+		{"correct horse battery staple", 4, 4},
+	}
+
+	for _, tt := range tests {
+		score := Strength(tt.password)
+		if score < tt.minScore || score > tt.maxScore {
+			t.Errorf("%q: expected a score from %d to %d, got %d", tt.password, tt.minScore, tt.maxScore, score)
+		}
+	}
+
+	// Words the attacker knows about the account are cheap to guess
+	if without, with := Strength("zorblax42!"), Strength("zorblax42!", "zorblax"); with >= without {
+		t.Errorf("expected the username to lower the score, got %d with it and %d without", with, without)
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	policy := Policy{MinLength: 10, MinClasses: 3, MinStrength: 3, RejectUserInfo: true}
+
+	rules := func(violations []Violation) []string {
+		var names []string
+		for _, v := range violations {
+			names = append(names, v.Rule)
+		}
+		return names
+	}
+
+	if violations := policy.Check("kX9#mq2!vLp7", "alice", "alice@example.com"); violations != nil {
+		t.Errorf("expected a strong password to pass, got %v", rules(violations))
+	}
+
+	violations := policy.Check("password", "alice")
+	if got := strings.Join(rules(violations), ","); got != "min_length,character_classes,strength" {
+		t.Errorf("unexpected violations: %s", got)
+	}
+	for _, v := range violations {
+		if v.Message == "" {
+			t.Errorf("expected a message for %s", v.Rule)
+		}
+	}
+
+	for _, password := range []string{"xAlice-9471!", "J0hn.Sm1th#42", "zz-SMITH-73!q"} {
+		violations := policy.Check(password, "alice", "john.smith@example.com")
+		if got := rules(violations); len(got) == 0 || got[0] != RuleUserInfo {
+			t.Errorf("%q: expected a user_info violation, got %v", password, got)
+		}
+	}
+
+	// Fragments too short to matter are allowed
+	if violations := policy.Check("kX9#al2!vLp7", "al"); violations != nil {
+		t.Errorf("expected a short username to be ignored, got %v", rules(violations))
+	}
+
+	if violations := (Policy{}).Check(""); violations != nil {
+		t.Errorf("expected the zero policy to accept anything, got %v", rules(violations))
+	}
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestBreachCorpus(t *testing.T) {
+	corpus, err := ReadBreachCorpus(strings.NewReader(
+		"# trimmed corpus\n" +
+			sha1Hex("password123") + ":2413945\n" +
+			"\n" +
+			strings.ToLower(sha1Hex("hunter2")) + "\n" +
+			sha1Hex("password123") + ":1\n",
+	))
+	if err != nil {
+		t.Fatalf("failed to read corpus: %v", err)
+	}
+	if corpus.Len() != 2 {
+		t.Errorf("expected 2 hashes, got %d", corpus.Len())
+	}
+
+	if !corpus.Contains("password123") || !corpus.Contains("hunter2") {
+		t.Error("expected both passwords to be found")
+	}
+	if corpus.Contains("kX9#mq2!vLp7") {
+		t.Error("expected an unlisted password not to be found")
+	}
+
+	hash := sha1Hex("hunter2")
+	if got := corpus.Range(strings.ToLower(hash[:5])); len(got) != 1 || got[0] != hash[5:] {
+		t.Errorf("unexpected range: %v", got)
+	}
+
+	policy := Policy{Breaches: corpus}
+	if violations := policy.Check("hunter2"); len(violations) != 1 || violations[0].Rule != RuleBreached {
+		t.Errorf("expected a breached violation, got %v", violations)
+	}
+
+	for _, bad := range []string{"not a hash\n", sha1Hex("x")[:39] + "\n", strings.Repeat("Z", 40) + ":1\n"} {
+		if _, err := ReadBreachCorpus(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
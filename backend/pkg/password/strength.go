@@ -0,0 +1,417 @@
+package password
+
+import (
+	_ "embed"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// common.txt lists the most used passwords and words found in passwords,
+// most common first
+//
+//go:embed common.txt
+var commonList string
+
+var (
+	commonPasswords = rankWords(strings.Fields(commonList))
+	maxWordLength   = longestWord(strings.Fields(commonList))
+)
+
+// scoreThresholds are the log10 guess counts separating the scores 0-4,
+// the same boundaries zxcvbn uses
+var scoreThresholds = [...]float64{3, 6, 8, 10}
+
+const (
+	// minWordGuesses keeps the most common words from counting as almost
+	// free, since the attacker still has to pick them among others
+	minWordGuesses = 10
+	// minYearSpace is the fewest years an attacker tries around now
+	minYearSpace = 20
+	// maxRepeatBlock is the longest block looked for in repeats like abcabc
+	maxRepeatBlock = 16
+	// keyboardStarts and keyboardDegree approximate the number of keys a
+	// keyboard walk can start on and go to next
+	keyboardStarts = 47
+	keyboardDegree = 4
+)
+
+// leet undoes common character substitutions before dictionary lookups
+var leet = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'i', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+// keyboardRows lay out a US QWERTY keyboard, unshifted and shifted, with the
+// horizontal offset of each row so diagonal neighbours can be found
+var keyboardRows = []struct {
+	keys, shifted string
+	offset        float64
+}{
+	{"`1234567890-=", "~!@#$%^&*()_+", 0},
+	{"qwertyuiop[]\\", "QWERTYUIOP{}|", 1.5},
+	{"asdfghjkl;'", "ASDFGHJKL:\"", 1.75},
+	{"zxcvbnm,./", "ZXCVBNM<>?", 2.25},
+}
+
+type keyPosition struct {
+	row int
+	x   float64
+}
+
+var keyboard = keyPositions()
+
+// Strength estimates how hard password is to guess, as a score from 0 (too
+// guessable) to 4 (very unguessable) on the zxcvbn scale. Like zxcvbn it
+// looks for the cheapest way to build the password out of common passwords,
+// userInputs, sequences, repeats, keyboard walks, years and brute force.
+func Strength(password string, userInputs ...string) int {
+	userWords := make(map[string]int)
+	for _, fragment := range userFragments(userInputs) {
+		userWords[fragment] = 1
+	}
+
+	guesses := estimator{userWords: userWords}.log10Guesses([]rune(password))
+	for score, threshold := range scoreThresholds {
+		if guesses < threshold {
+			return score
+		}
+	}
+	return len(scoreThresholds)
+}
+
+// match is a part of the password an attacker could guess as a unit
+type match struct {
+	start, end int     // rune offsets, end exclusive
+	guesses    float64 // log10 of the guesses needed
+}
+
+type estimator struct {
+	userWords map[string]int
+}
+
+// log10Guesses returns the log10 of the fewest guesses needed to build the
+// password out of matches and brute-forced characters
+func (e estimator) log10Guesses(runes []rune) float64 {
+	n := len(runes)
+	if n == 0 {
+		return 0
+	}
+
+	byEnd := make([][]match, n+1)
+	for _, m := range e.matches(runes) {
+		byEnd[m.end] = append(byEnd[m.end], m)
+	}
+
+	perCharacter := math.Log10(cardinality(runes))
+	best := make([]float64, n+1)
+	for end := 1; end <= n; end++ {
+		best[end] = best[end-1] + perCharacter
+		for _, m := range byEnd[end] {
+			best[end] = min(best[end], best[m.start]+m.guesses)
+		}
+	}
+	return best[n]
+}
+
+func (e estimator) matches(runes []rune) []match {
+	var matches []match
+	matches = append(matches, e.dictionaryMatches(runes)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, e.repeatMatches(runes)...)
+	matches = append(matches, keyboardMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+	return matches
+}
+
+func (e estimator) rank(word string) (int, bool) {
+	if rank, ok := e.userWords[word]; ok {
+		return rank, true
+	}
+	rank, ok := commonPasswords[word]
+	return rank, ok
+}
+
+// dictionaryMatches finds common passwords and user inputs, also when
+// capitalized or written with substitutions like p@ssw0rd
+func (e estimator) dictionaryMatches(runes []rune) []match {
+	lowered := make([]rune, len(runes))
+	unleeted := make([]rune, len(runes))
+	for i, r := range runes {
+		lowered[i] = unicode.ToLower(r)
+		unleeted[i] = lowered[i]
+		if plain, ok := leet[lowered[i]]; ok {
+			unleeted[i] = plain
+		}
+	}
+
+	longest := maxWordLength
+	for word := range e.userWords {
+		longest = max(longest, len([]rune(word)))
+	}
+
+	var matches []match
+	for start := range runes {
+		for end := start + minFragmentLength; end <= min(len(runes), start+longest); end++ {
+			guesses := 0.0
+			rank, ok := e.rank(string(lowered[start:end]))
+			if !ok {
+				rank, ok = e.rank(string(unleeted[start:end]))
+				guesses = substitutionVariations(lowered[start:end])
+			}
+			if !ok {
+				continue
+			}
+			guesses += math.Log10(float64(max(rank, minWordGuesses))) + uppercaseVariations(runes[start:end])
+			matches = append(matches, match{start: start, end: end, guesses: guesses})
+		}
+	}
+	return matches
+}
+
+// sequenceMatches finds runs like abc, 9876 or XYZ
+func sequenceMatches(runes []rune) []match {
+	var matches []match
+	for start := 0; start+2 < len(runes); {
+		delta := runes[start+1] - runes[start]
+		if delta != 1 && delta != -1 {
+			start++
+			continue
+		}
+
+		end := start + 2
+		for end < len(runes) && runes[end]-runes[end-1] == delta {
+			end++
+		}
+		if end-start >= 3 && characterClass(runes[start]) == characterClass(runes[end-1]) {
+			base := 26.0
+			switch {
+			case strings.ContainsRune("aAzZ01", runes[start]):
+				base = 4
+			case unicode.IsDigit(runes[start]):
+				base = 10
+			}
+			if delta < 0 {
+				base *= 2
+			}
+			matches = append(matches, match{start: start, end: end, guesses: math.Log10(base * float64(end-start))})
+		}
+		start = end - 1
+	}
+	return matches
+}
+
+// repeatMatches finds a character or block repeated back to back, like aaa
+// or abcabc, guessed as the block plus the number of repeats
+func (e estimator) repeatMatches(runes []rune) []match {
+	var matches []match
+	for start := range runes {
+		for size := 1; size <= maxRepeatBlock && start+2*size <= len(runes); size++ {
+			block := runes[start : start+size]
+			count := 1
+			for start+(count+1)*size <= len(runes) && slices.Equal(runes[start+count*size:start+(count+1)*size], block) {
+				count++
+			}
+			if count < 2 || (size == 1 && count < 3) {
+				continue
+			}
+			matches = append(matches, match{
+				start:   start,
+				end:     start + count*size,
+				guesses: e.log10Guesses(block) + math.Log10(float64(count)),
+			})
+		}
+	}
+	return matches
+}
+
+// keyboardMatches finds walks across neighbouring keys, like qwerty or zaq1
+func keyboardMatches(runes []rune) []match {
+	var matches []match
+	for start := 0; start+2 < len(runes); {
+		end, turns := start+1, 0
+		var direction [2]float64
+		for end < len(runes) {
+			from, ok1 := keyboard[runes[end-1]]
+			to, ok2 := keyboard[runes[end]]
+			if !ok1 || !ok2 || !adjacentKeys(from, to) {
+				break
+			}
+			step := [2]float64{float64(to.row - from.row), math.Copysign(1, to.x-from.x)}
+			if end == start+1 || step != direction {
+				turns++
+				direction = step
+			}
+			end++
+		}
+		if end-start >= 3 {
+			guesses := math.Log10(keyboardStarts*float64(end-start)) + float64(turns)*math.Log10(keyboardDegree)
+			matches = append(matches, match{start: start, end: end, guesses: guesses})
+			start = end - 1
+			continue
+		}
+		start++
+	}
+	return matches
+}
+
+// yearMatches finds years from 1900 to 2099, guessed by their distance from
+// the current year
+func yearMatches(runes []rune) []match {
+	now := time.Now().Year()
+	var matches []match
+	for start := 0; start+4 <= len(runes); start++ {
+		year := 0
+		for _, r := range runes[start : start+4] {
+			if r < '0' || r > '9' {
+				year = -1
+				break
+			}
+			year = year*10 + int(r-'0')
+		}
+		if year < 1900 || year > 2099 {
+			continue
+		}
+		space := max(abs(year-now), minYearSpace)
+		matches = append(matches, match{start: start, end: start + 4, guesses: math.Log10(float64(space))})
+	}
+	return matches
+}
+
+// uppercaseVariations is the log10 of the ways word could have been
+// capitalized: cheap for Word or WORD, more when capitals are mixed in
+func uppercaseVariations(word []rune) float64 {
+	upper := 0
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 0
+	case upper == len(word), upper == 1 && unicode.IsUpper(word[0]):
+		return math.Log10(2)
+	}
+	return math.Log10(binomialSum(len(word), min(upper, len(word)-upper)))
+}
+
+// substitutionVariations is the log10 of the ways the substitutions in word
+// could have been chosen
+func substitutionVariations(word []rune) float64 {
+	substituted := 0
+	for _, r := range word {
+		if _, ok := leet[r]; ok {
+			substituted++
+		}
+	}
+	return math.Log10(binomialSum(len(word), substituted))
+}
+
+// binomialSum returns the sum of n choose i for i from 1 to k
+func binomialSum(n, k int) float64 {
+	sum, term := 0.0, 1.0
+	for i := 1; i <= k; i++ {
+		term = term * float64(n-i+1) / float64(i)
+		sum += term
+	}
+	return max(sum, 1)
+}
+
+// cardinality is the size of the character set brute-forcing the password
+// would have to cover
+func cardinality(runes []rune) float64 {
+	classes := make(map[int]bool)
+	for _, r := range runes {
+		classes[characterClass(r)] = true
+	}
+
+	sizes := map[int]float64{classLower: 26, classUpper: 26, classDigit: 10, classSymbol: 33, classOther: 100}
+	total := 0.0
+	for class := range classes {
+		total += sizes[class]
+	}
+	return total
+}
+
+const (
+	classLower = iota
+	classUpper
+	classDigit
+	classSymbol
+	classOther
+)
+
+func characterClass(r rune) int {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return classLower
+	case r >= 'A' && r <= 'Z':
+		return classUpper
+	case r >= '0' && r <= '9':
+		return classDigit
+	case r <= unicode.MaxASCII:
+		return classSymbol
+	}
+	return classOther
+}
+
+func adjacentKeys(from, to keyPosition) bool {
+	switch math.Abs(float64(to.row - from.row)) {
+	case 0:
+		return math.Abs(to.x-from.x) == 1
+	case 1:
+		return math.Abs(to.x-from.x) <= 0.75
+	}
+	return false
+}
+
+func keyPositions() map[rune]keyPosition {
+	positions := make(map[rune]keyPosition)
+	for row, layout := range keyboardRows {
+		for _, keys := range []string{layout.keys, layout.shifted} {
+			for col, key := range []rune(keys) {
+				positions[key] = keyPosition{row: row, x: layout.offset + float64(col)}
+			}
+		}
+	}
+	return positions
+}
+
+// unleet lowercases s and undoes common character substitutions
+func unleet(s string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if plain, ok := leet[r]; ok {
+			return plain
+		}
+		return r
+	}, s)
+}
+
+func rankWords(words []string) map[string]int {
+	ranks := make(map[string]int, len(words))
+	for i, word := range words {
+		if _, ok := ranks[word]; !ok {
+			ranks[word] = i + 1
+		}
+	}
+	return ranks
+}
+
+func longestWord(words []string) int {
+	longest := 0
+	for _, word := range words {
+		longest = max(longest, len([]rune(word)))
+	}
+	return longest
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Fallback uses Primary, switching to Secondary when Primary fails. It
+// stays on Secondary for RetryAfter before trying Primary again, so an
+// unreachable store costs one failed request per interval rather than
+// one per request.
+type Fallback struct {
+	Primary    Limiter
+	Secondary  Limiter
+	RetryAfter time.Duration
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+func (f *Fallback) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	f.mu.Lock()
+	down := time.Now().Before(f.downUntil)
+	f.mu.Unlock()
+	if down {
+		return f.Secondary.Allow(ctx, key, limit)
+	}
+
+	result, err := f.Primary.Allow(ctx, key, limit)
+	if err == nil {
+		f.mu.Lock()
+		if !f.downUntil.IsZero() {
+			f.downUntil = time.Time{}
+			slog.Info("Rate limit store is back")
+		}
+		f.mu.Unlock()
+		return result, nil
+	}
+	if ctx.Err() != nil {
+		return result, err
+	}
+
+	f.mu.Lock()
+	f.downUntil = time.Now().Add(f.RetryAfter)
+	f.mu.Unlock()
+	slog.Warn("Rate limit store failed, limiting in memory", "retry_after", f.RetryAfter, "error", err)
+	return f.Secondary.Allow(ctx, key, limit)
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+// shards spreads keys over independently locked maps
+const shards = 64
+
+// Memory keeps buckets in process memory, holding at most about maxKeys of
+// them. A bucket that has filled up again is the same as no bucket, so
+// those are dropped first when a shard is full; after that the fullest
+// bucket is forgotten, which only ever lets its key through sooner.
+type Memory struct {
+	seed        maphash.Seed
+	maxPerShard int
+	shards      [shards]memoryShard
+	now         func() time.Time
+}
+
+type memoryShard struct {
+	mu   sync.Mutex
+	tats map[string]time.Time
+}
+
+// NewMemory creates an in-memory limiter holding up to maxKeys buckets
+func NewMemory(maxKeys int) *Memory {
+	m := &Memory{
+		seed:        maphash.MakeSeed(),
+		maxPerShard: max(maxKeys/shards, 1),
+		now:         time.Now,
+	}
+	for i := range m.shards {
+		m.shards[i].tats = make(map[string]time.Time)
+	}
+	return m
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	shard := &m.shards[maphash.String(m.seed, key)%shards]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	now := m.now()
+	tat, exists := shard.tats[key]
+	next, result := gcra(now, tat, limit)
+	if result.Allowed {
+		if !exists && len(shard.tats) >= m.maxPerShard {
+			shard.evict(now, m.maxPerShard)
+		}
+		shard.tats[key] = next
+	}
+	return result, nil
+}
+
+// Len returns the number of buckets held
+func (m *Memory) Len() int {
+	n := 0
+	for i := range m.shards {
+		m.shards[i].mu.Lock()
+		n += len(m.shards[i].tats)
+		m.shards[i].mu.Unlock()
+	}
+	return n
+}
+
+// evict makes room for one bucket in a shard holding limit of them
+func (s *memoryShard) evict(now time.Time, limit int) {
+	var fullest string
+	var earliest time.Time
+	for key, tat := range s.tats {
+		if !tat.After(now) {
+			delete(s.tats, key)
+			continue
+		}
+		if earliest.IsZero() || tat.Before(earliest) {
+			fullest, earliest = key, tat
+		}
+	}
+	if len(s.tats) >= limit {
+		delete(s.tats, fullest)
+	}
+}
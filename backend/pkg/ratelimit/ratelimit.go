@@ -0,0 +1,80 @@
+// Package ratelimit limits how often a key may act using the generic cell
+// rate algorithm (GCRA), a token bucket that stores a single timestamp per
+// key: the theoretical arrival time at which the bucket is full again.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit allows Rate events per Period on average, with up to Burst of them
+// at once
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+// PerMinute is a limit of rate events a minute with bursts up to burst
+func PerMinute(rate, burst int) Limit {
+	return Limit{Rate: rate, Period: time.Minute, Burst: burst}
+}
+
+// interval is the time it takes to earn back one event
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(max(l.Rate, 1))
+}
+
+func (l Limit) burst() int {
+	return max(l.Burst, 1)
+}
+
+// Window is the time it takes an empty bucket to fill up again, over which
+// Burst events are allowed
+func (l Limit) Window() time.Duration {
+	return l.interval() * time.Duration(l.burst())
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Allowed bool
+	// Limit is the bucket size, the number of events allowed at once
+	Limit int
+	// Remaining is the number of events still allowed right now
+	Remaining int
+	// RetryAfter is how long to wait before the next event is allowed. It is
+	// zero when the event was allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// Limiter decides whether an event for key fits within limit, counting it
+// if it does. Implementations are safe for concurrent use.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// gcra checks an event at now against the key's theoretical arrival time
+// tat, the zero time for an unknown key, and returns the new one
+func gcra(now, tat time.Time, limit Limit) (time.Time, Result) {
+	interval := limit.interval()
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(interval)
+	allowAt := next.Add(-limit.Window())
+
+	result := Result{Limit: limit.burst()}
+	if now.Before(allowAt) {
+		result.RetryAfter = allowAt.Sub(now)
+		result.ResetAfter = tat.Sub(now)
+		return tat, result
+	}
+
+	result.Allowed = true
+	result.Remaining = int(now.Sub(allowAt) / interval)
+	result.ResetAfter = next.Sub(now)
+	return next, result
+}
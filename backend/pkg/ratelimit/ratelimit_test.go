@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func testMemory(maxKeys int) (*Memory, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	m := NewMemory(maxKeys)
+	m.now = clock.Now
+	return m, clock
+}
+
+func TestMemory_Allow(t *testing.T) {
+	ctx := context.Background()
+	m, clock := testMemory(100)
+	// One event every 10 seconds, three at once
+	limit := Limit{Rate: 6, Period: time.Minute, Burst: 3}
+
+	for i := range 3 {
+		result, err := m.Allow(ctx, "alice", limit)
+		if err != nil {
+			t.Fatalf("failed to check limit: %v", err)
+		}
+		if !result.Allowed || result.Limit != 3 || result.Remaining != 2-i {
+			t.Errorf("request %d: unexpected result %+v", i+1, result)
+		}
+		if result.ResetAfter != time.Duration(i+1)*10*time.Second {
+			t.Errorf("request %d: expected the bucket to refill in %ds, got %v", i+1, (i+1)*10, result.ResetAfter)
+		}
+	}
+
+	result, _ := m.Allow(ctx, "alice", limit)
+	if result.Allowed || result.Remaining != 0 || result.RetryAfter != 10*time.Second || result.ResetAfter != 30*time.Second {
+		t.Errorf("expected the fourth request to wait 10s, got %+v", result)
+	}
+
+	// Other keys have their own bucket
+	if result, _ := m.Allow(ctx, "bob", limit); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("expected bob to have a full bucket, got %+v", result)
+	}
+
+	// A refused request does not cost anything, and one event is earned back
+	// every interval
+	clock.now = clock.now.Add(4 * time.Second)
+	if result, _ := m.Allow(ctx, "alice", limit); result.Allowed || result.RetryAfter != 6*time.Second {
+		t.Errorf("expected to wait another 6s, got %+v", result)
+	}
+	clock.now = clock.now.Add(6 * time.Second)
+	if result, _ := m.Allow(ctx, "alice", limit); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("expected one request to be allowed, got %+v", result)
+	}
+
+	// Idle long enough, the bucket is full again but never more than full
+	clock.now = clock.now.Add(time.Hour)
+	for i := range 4 {
+		result, _ := m.Allow(ctx, "alice", limit)
+		if result.Allowed != (i < 3) {
+			t.Errorf("request %d after idling: unexpected result %+v", i+1, result)
+		}
+	}
+}
+
+func TestMemory_Bounded(t *testing.T) {
+	ctx := context.Background()
+	m, clock := testMemory(shards * 2)
+	limit := Limit{Rate: 1, Period: time.Minute, Burst: 2}
+
+	for i := range 1000 {
+		if _, err := m.Allow(ctx, fmt.Sprintf("client-%d", i), limit); err != nil {
+			t.Fatalf("failed to check limit: %v", err)
+		}
+	}
+	if n := m.Len(); n > shards*2 {
+		t.Errorf("expected at most %d buckets, got %d", shards*2, n)
+	}
+
+	// A key that was forgotten to make room starts with a full bucket, while
+	// the latest ones are still limited
+	m.Allow(ctx, "client-999", limit)
+	if result, _ := m.Allow(ctx, "client-999", limit); result.Allowed {
+		t.Errorf("expected a recent key to keep its bucket, got %+v", result)
+	}
+
+	// Buckets that have filled up again are dropped before any other
+	clock.now = clock.now.Add(time.Hour)
+	m.Allow(ctx, "newcomer", limit)
+	if n := m.Len(); n > shards*2 {
+		t.Errorf("expected at most %d buckets, got %d", shards*2, n)
+	}
+}
+
+func TestLimit_Window(t *testing.T) {
+	if w := PerMinute(100, 20).Window(); w != 12*time.Second {
+		t.Errorf("expected a 12s window, got %v", w)
+	}
+	if w := (Limit{Rate: 10, Period: time.Second}).Window(); w != 100*time.Millisecond {
+		t.Errorf("expected a burst of one to take one interval, got %v", w)
+	}
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraScript runs gcra atomically in Redis, on the Redis clock so that
+// every replica agrees on the time. Times are in microseconds. It returns
+// whether the event is allowed, the remaining events, and the retry and
+// reset delays.
+var gcraScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local interval = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1])) or now
+if tat < now then
+  tat = now
+end
+local next = tat + interval
+local allow_at = next - window
+
+if now < allow_at then
+  return {0, 0, allow_at - now, tat - now}
+end
+redis.call('SET', KEYS[1], next, 'PX', math.ceil((next - now) / 1000))
+return {1, math.floor((now - allow_at) / interval), 0, next - now}
+`)
+
+// Redis keeps buckets in Redis so that every replica shares them. Each
+// bucket expires once it has filled up again.
+type Redis struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedis creates a limiter storing buckets under keys starting with prefix
+func NewRedis(client redis.Scripter, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+func (r *Redis) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	values, err := gcraScript.Run(ctx, r.client, []string{r.prefix + key},
+		limit.interval().Microseconds(), limit.Window().Microseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit.burst(),
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+		ResetAfter: time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
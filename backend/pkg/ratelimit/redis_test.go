@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedis_Allow(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	server.SetTime(now)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	r := NewRedis(client, "test:")
+
+	// One event every 10 seconds, three at once
+	limit := Limit{Rate: 6, Period: time.Minute, Burst: 3}
+	for i := range 3 {
+		result, err := r.Allow(ctx, "alice", limit)
+		if err != nil {
+			t.Fatalf("failed to check limit: %v", err)
+		}
+		if !result.Allowed || result.Limit != 3 || result.Remaining != 2-i || result.ResetAfter != time.Duration(i+1)*10*time.Second {
+			t.Errorf("request %d: unexpected result %+v", i+1, result)
+		}
+	}
+
+	result, err := r.Allow(ctx, "alice", limit)
+	if err != nil {
+		t.Fatalf("failed to check limit: %v", err)
+	}
+	if result.Allowed || result.RetryAfter != 10*time.Second || result.ResetAfter != 30*time.Second {
+		t.Errorf("expected the fourth request to wait 10s, got %+v", result)
+	}
+
+	// The bucket expires once it would be full again
+	if ttl := server.TTL("test:alice"); ttl != 30*time.Second {
+		t.Errorf("expected the bucket to expire in 30s, got %v", ttl)
+	}
+
+	server.SetTime(now.Add(10 * time.Second))
+	if result, _ := r.Allow(ctx, "alice", limit); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("expected one request to be allowed, got %+v", result)
+	}
+	if result, _ := r.Allow(ctx, "bob", limit); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("expected bob to have a full bucket, got %+v", result)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	defer client.Close()
+	memory := NewMemory(100)
+	f := &Fallback{Primary: NewRedis(client, "test:"), Secondary: memory, RetryAfter: time.Hour}
+	limit := PerMinute(60, 5)
+
+	if _, err := f.Allow(ctx, "alice", limit); err != nil {
+		t.Fatalf("failed to check limit: %v", err)
+	}
+	if memory.Len() != 0 {
+		t.Error("expected Redis to be used while it is up")
+	}
+
+	server.Close()
+	result, err := f.Allow(ctx, "alice", limit)
+	if err != nil || !result.Allowed {
+		t.Fatalf("expected memory to take over, got %+v, %v", result, err)
+	}
+	if memory.Len() != 1 {
+		t.Error("expected the bucket in memory")
+	}
+
+	// Redis is not tried again until RetryAfter has passed
+	server.Restart()
+	f.Allow(ctx, "bob", limit)
+	if server.Exists("test:bob") {
+		t.Error("expected memory to be used until the retry")
+	}
+
+	f.mu.Lock()
+	f.downUntil = time.Now().Add(-time.Second)
+	f.mu.Unlock()
+	f.Allow(ctx, "bob", limit)
+	if !server.Exists("test:bob") {
+		t.Error("expected Redis to be used again after the retry")
+	}
+}
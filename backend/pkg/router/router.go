@@ -1,19 +1,24 @@
 package router
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func New() *chi.Mux {
+// New creates a router. The given middlewares run first, so that the
+// request log sees their changes to the request.
+func New(middlewares ...func(http.Handler) http.Handler) *chi.Mux {
 	r := chi.NewRouter()
+	r.Use(middlewares...)
 
 	// Add Chi middleware
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Timeout(60))
+	r.Use(middleware.Timeout(60 * time.Second))
 
 	return r
 }
@@ -0,0 +1,93 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed from RFC 6238 Appendix B
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode_RFC6238Vectors(t *testing.T) {
+	// The RFC lists eight digit codes; six digit codes are their last six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current, _ := Code(rfcSecret, now)
+	previous, _ := Code(rfcSecret, now.Add(-Period*time.Second))
+	stale, _ := Code(rfcSecret, now.Add(-3*Period*time.Second))
+
+	if step, ok := Validate(rfcSecret, current, now, 1); !ok || step != Step(now) {
+		t.Errorf("expected current code to validate at step %d, got %d %v", Step(now), step, ok)
+	}
+	if step, ok := Validate(rfcSecret, previous, now, 1); !ok || step != Step(now)-1 {
+		t.Errorf("expected previous code within skew, got %d %v", step, ok)
+	}
+	if _, ok := Validate(rfcSecret, stale, now, 1); ok {
+		t.Error("expected code outside skew to be rejected")
+	}
+	if _, ok := Validate(rfcSecret, "12345", now, 1); ok {
+		t.Error("expected short code to be rejected")
+	}
+	if _, ok := Validate("not base32!", current, now, 1); ok {
+		t.Error("expected invalid secret to be rejected")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := GenerateSecret()
+	if a == b {
+		t.Error("expected distinct secrets")
+	}
+	if _, err := Code(a, time.Now()); err != nil {
+		t.Errorf("generated secret does not decode: %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Votex", "alice@example.com", "JBSWY3DPEHPK3PXP")
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("invalid uri: %v", err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Errorf("unexpected uri prefix: %s", uri)
+	}
+	if !strings.HasPrefix(parsed.Path, "/Votex:alice@example.com") {
+		t.Errorf("unexpected label: %s", parsed.Path)
+	}
+	q := parsed.Query()
+	if q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Votex" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("unexpected parameters: %v", q)
+	}
+}
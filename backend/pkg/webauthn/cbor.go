@@ -0,0 +1,157 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxCBORDepth bounds nesting so a hostile attestation object cannot exhaust the stack
+const maxCBORDepth = 16
+
+var errCBOR = errors.New("malformed cbor")
+
+// decodeCBOR reads one data item from the front of data and returns it along
+// with the remaining bytes. It supports the subset of RFC 8949 authenticators
+// emit: integers, byte and text strings, arrays, maps, tags (which are
+// dropped), booleans, null and floats. Integers decode as int64, maps as
+// map[interface{}]interface{} keyed by int64 or string.
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, fmt.Errorf("%w: nesting too deep", errCBOR)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end of input", errCBOR)
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	// Simple values and floats carry their payload in the argument bytes
+	if major == 7 {
+		return decodeSimple(data, info)
+	}
+
+	arg, rest, err := readArgument(data[1:], info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return int64(arg), rest, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return -1 - int64(arg), rest, nil
+	case 2, 3:
+		if arg > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w: string exceeds input", errCBOR)
+		}
+		if major == 3 {
+			return string(rest[:arg]), rest[arg:], nil
+		}
+		return append([]byte(nil), rest[:arg]...), rest[arg:], nil
+	case 4:
+		// Every item takes at least one byte, which caps the allocation
+		if arg > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w: array exceeds input", errCBOR)
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			if item, rest, err = decodeItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, rest, nil
+	case 5:
+		if arg > uint64(len(rest))/2 {
+			return nil, nil, fmt.Errorf("%w: map exceeds input", errCBOR)
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value interface{}
+			if key, rest, err = decodeItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key type %T", errCBOR, key)
+			}
+			if _, dup := m[key]; dup {
+				return nil, nil, fmt.Errorf("%w: duplicate map key %v", errCBOR, key)
+			}
+			if value, rest, err = decodeItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			m[key] = value
+		}
+		return m, rest, nil
+	default:
+		// Tags wrap a single item; none of them change how WebAuthn reads it
+		return decodeItem(rest, depth+1)
+	}
+}
+
+// readArgument decodes the length or value that follows an initial byte
+func readArgument(data []byte, info byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(data) < size {
+			return 0, nil, fmt.Errorf("%w: unexpected end of input", errCBOR)
+		}
+		var value uint64
+		switch size {
+		case 1:
+			value = uint64(data[0])
+		case 2:
+			value = uint64(binary.BigEndian.Uint16(data))
+		case 4:
+			value = uint64(binary.BigEndian.Uint32(data))
+		case 8:
+			value = binary.BigEndian.Uint64(data)
+		}
+		return value, data[size:], nil
+	default:
+		return 0, nil, fmt.Errorf("%w: indefinite or reserved length", errCBOR)
+	}
+}
+
+func decodeSimple(data []byte, info byte) (interface{}, []byte, error) {
+	rest := data[1:]
+	switch info {
+	case 20:
+		return false, rest, nil
+	case 21:
+		return true, rest, nil
+	case 22, 23:
+		return nil, rest, nil
+	case 26:
+		if len(rest) < 4 {
+			return nil, nil, fmt.Errorf("%w: unexpected end of input", errCBOR)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(rest))), rest[4:], nil
+	case 27:
+		if len(rest) < 8 {
+			return nil, nil, fmt.Errorf("%w: unexpected end of input", errCBOR)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(rest)), rest[8:], nil
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported simple value %d", errCBOR, info)
+	}
+}
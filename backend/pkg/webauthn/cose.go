@@ -0,0 +1,110 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053) offered to authenticators, in order
+// of preference
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key parameters (RFC 9052 section 7.1 and RFC 9053 section 7)
+const (
+	coseKeyType = 1
+	coseKeyAlg  = 3
+	coseCurve   = -1 // also RSA modulus n
+	coseX       = -2 // also RSA exponent e
+	coseY       = -3
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// parsePublicKey decodes a COSE_Key into a public key for one of the
+// supported algorithms
+func parsePublicKey(coseKey []byte) (crypto.PublicKey, int64, error) {
+	value, rest, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(rest) != 0 {
+		return nil, 0, fmt.Errorf("%w: trailing bytes after public key", ErrUnsupportedKey)
+	}
+	key, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: public key is not a map", ErrUnsupportedKey)
+	}
+
+	kty, _ := key[int64(coseKeyType)].(int64)
+	alg, _ := key[int64(coseKeyAlg)].(int64)
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		crv, _ := key[int64(coseCurve)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		y, _ := key[int64(coseY)].([]byte)
+		if crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, fmt.Errorf("%w: invalid P-256 key", ErrUnsupportedKey)
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, fmt.Errorf("%w: point is not on P-256", ErrUnsupportedKey)
+		}
+		return pub, alg, nil
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		crv, _ := key[int64(coseCurve)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, fmt.Errorf("%w: invalid Ed25519 key", ErrUnsupportedKey)
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		n, _ := key[int64(coseCurve)].([]byte)
+		e, _ := key[int64(coseX)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, fmt.Errorf("%w: invalid RSA key", ErrUnsupportedKey)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, alg, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: key type %d with algorithm %d", ErrUnsupportedKey, kty, alg)
+	}
+}
+
+// verifySignature checks sig over message with a COSE_Key
+func verifySignature(coseKey, message, sig []byte) error {
+	pub, _, err := parsePublicKey(coseKey)
+	if err != nil {
+		return err
+	}
+
+	var ok bool
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		ok = ecdsa.VerifyASN1(pub, digest[:], sig)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, message, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(message)
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	}
+	if !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
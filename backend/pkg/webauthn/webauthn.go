@@ -0,0 +1,383 @@
+// Package webauthn implements the relying party side of the W3C Web
+// Authentication ceremonies used for passkeys: building the options handed to
+// navigator.credentials.create/get and verifying what the authenticator sends
+// back. Attestation is not requested, so registrations are trusted on the
+// strength of the origin and challenge checks alone. Supported algorithms are
+// ES256, EdDSA and RS256.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ChallengeSize is the length of a generated challenge in bytes
+const ChallengeSize = 32
+
+// maxCredentialIDLength is the limit set by the specification
+const maxCredentialIDLength = 1023
+
+// Authenticator data flags (WebAuthn section 6.1)
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagBackupEligible         = 0x08
+	flagBackedUp               = 0x10
+	flagAttestedCredentialData = 0x40
+)
+
+var (
+	ErrMalformed           = errors.New("malformed webauthn response")
+	ErrChallengeMismatch   = errors.New("webauthn challenge mismatch")
+	ErrOriginMismatch      = errors.New("webauthn origin not allowed")
+	ErrRPIDMismatch        = errors.New("webauthn relying party id mismatch")
+	ErrUserNotPresent      = errors.New("webauthn user presence not asserted")
+	ErrUserNotVerified     = errors.New("webauthn user verification not performed")
+	ErrUnsupportedKey      = errors.New("unsupported webauthn public key")
+	ErrInvalidSignature    = errors.New("invalid webauthn signature")
+	ErrSignCountRegression = errors.New("webauthn sign count did not increase")
+)
+
+// URLEncodedBytes is binary data carried in JSON as unpadded base64url, the
+// encoding browsers use for PublicKeyCredential.toJSON()
+type URLEncodedBytes []byte
+
+func (b URLEncodedBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *URLEncodedBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingParty holds the identity the ceremonies are bound to. ID is the
+// domain credentials are scoped to and Origins lists every origin, scheme
+// and port included, that may run the ceremonies.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+	Timeout time.Duration
+}
+
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity identifies the account a credential is created for. ID is the
+// opaque user handle authenticators return during discoverable logins.
+type UserEntity struct {
+	ID          URLEncodedBytes `json:"id"`
+	Name        string          `json:"name"`
+	DisplayName string          `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string          `json:"type"`
+	ID         URLEncodedBytes `json:"id"`
+	Transports []string        `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions is the publicKey argument for navigator.credentials.create
+type CreationOptions struct {
+	Challenge              URLEncodedBytes        `json:"challenge"`
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is the publicKey argument for navigator.credentials.get
+type RequestOptions struct {
+	Challenge        URLEncodedBytes        `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type AuthenticatorAttestationResponse struct {
+	ClientDataJSON    URLEncodedBytes `json:"clientDataJSON"`
+	AttestationObject URLEncodedBytes `json:"attestationObject"`
+	Transports        []string        `json:"transports,omitempty"`
+}
+
+// RegistrationResponse is the JSON form of the credential returned by
+// navigator.credentials.create
+type RegistrationResponse struct {
+	ID       string                           `json:"id"`
+	RawID    URLEncodedBytes                  `json:"rawId"`
+	Type     string                           `json:"type"`
+	Response AuthenticatorAttestationResponse `json:"response"`
+}
+
+type AuthenticatorAssertionResponse struct {
+	ClientDataJSON    URLEncodedBytes `json:"clientDataJSON"`
+	AuthenticatorData URLEncodedBytes `json:"authenticatorData"`
+	Signature         URLEncodedBytes `json:"signature"`
+	UserHandle        URLEncodedBytes `json:"userHandle,omitempty"`
+}
+
+// AssertionResponse is the JSON form of the credential returned by
+// navigator.credentials.get
+type AssertionResponse struct {
+	ID       string                         `json:"id"`
+	RawID    URLEncodedBytes                `json:"rawId"`
+	Type     string                         `json:"type"`
+	Response AuthenticatorAssertionResponse `json:"response"`
+}
+
+// Credential is a verified registration. PublicKey is the COSE_Key as sent
+// by the authenticator and is what VerifyAssertion expects back.
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte
+	SignCount      uint32
+	Transports     []string
+	BackupEligible bool
+	BackedUp       bool
+}
+
+// NewChallenge returns a random challenge for a single ceremony
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, ChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// CreationOptions builds the options for registering a new credential.
+// Credentials in exclude are already registered to the user, which stops an
+// authenticator from enrolling twice.
+func (rp *RelyingParty) CreationOptions(challenge []byte, user UserEntity, exclude []CredentialDescriptor) CreationOptions {
+	return CreationOptions{
+		Challenge: challenge,
+		RP:        RPEntity{ID: rp.ID, Name: rp.Name},
+		User:      user,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            rp.Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions builds the options for an assertion. An empty allow list
+// lets the authenticator offer any discoverable credential for the RP.
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow []CredentialDescriptor) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: "required",
+	}
+}
+
+// VerifyRegistration checks a registration response against the challenge
+// issued for it (WebAuthn section 7.1) and returns the new credential
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, resp *RegistrationResponse) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type %q", ErrMalformed, resp.Type)
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	value, rest, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: attestation object", ErrMalformed)
+	}
+	attestation, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object", ErrMalformed)
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing authenticator data", ErrMalformed)
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedCredentialData == 0 {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrMalformed)
+	}
+	if !bytes.Equal(authData.credentialID, resp.RawID) {
+		return nil, fmt.Errorf("%w: credential id does not match authenticator data", ErrMalformed)
+	}
+	if _, _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:             authData.credentialID,
+		PublicKey:      authData.publicKey,
+		SignCount:      authData.signCount,
+		Transports:     resp.Response.Transports,
+		BackupEligible: authData.flags&flagBackupEligible != 0,
+		BackedUp:       authData.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// VerifyAssertion checks an assertion (WebAuthn section 7.2) made with the
+// stored publicKey and returns the authenticator's new sign count. A count
+// that fails to increase past signCount suggests a cloned authenticator;
+// authenticators that do not implement counters always report zero.
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, resp *AssertionResponse, publicKey []byte, signCount uint32) (uint32, error) {
+	if resp.Type != "public-key" {
+		return 0, fmt.Errorf("%w: unexpected credential type %q", ErrMalformed, resp.Type)
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...)
+	if err := verifySignature(publicKey, signed, resp.Response.Signature); err != nil {
+		return 0, err
+	}
+
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return 0, ErrSignCountRegression
+	}
+	return authData.signCount, nil
+}
+
+type collectedClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var clientData collectedClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return fmt.Errorf("%w: client data", ErrMalformed)
+	}
+	if clientData.Type != ceremony {
+		return fmt.Errorf("%w: unexpected client data type %q", ErrMalformed, clientData.Type)
+	}
+
+	expected := base64.RawURLEncoding.EncodeToString(challenge)
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(clientData.Challenge, "=")), []byte(expected)) != 1 {
+		return ErrChallengeMismatch
+	}
+	if !slices.Contains(rp.Origins, clientData.Origin) {
+		return ErrOriginMismatch
+	}
+	return nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(authData *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.rpIDHash, rpIDHash[:]) != 1 {
+		return ErrRPIDMismatch
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if authData.flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData splits the binary structure described in WebAuthn
+// section 6.1. Extension outputs are not used and are left unparsed.
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrMalformed)
+	}
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.flags&flagAttestedCredentialData == 0 {
+		return authData, nil
+	}
+
+	// AAGUID (16 bytes), then a two byte length and the credential id
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrMalformed)
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength == 0 || idLength > maxCredentialIDLength || idLength > len(rest) {
+		return nil, fmt.Errorf("%w: invalid credential id length", ErrMalformed)
+	}
+	authData.credentialID = append([]byte(nil), rest[:idLength]...)
+	rest = rest[idLength:]
+
+	// The COSE key is the next CBOR item; its encoded length is whatever the
+	// decoder consumed
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: credential public key", ErrMalformed)
+	}
+	authData.publicKey = append([]byte(nil), rest[:len(rest)-len(after)]...)
+	return authData, nil
+}
@@ -0,0 +1,194 @@
+package webauthn_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/user/votex-template/backend/pkg/webauthn"
+	"github.com/user/votex-template/backend/pkg/webauthn/webauthntest"
+)
+
+const origin = "https://votex.example"
+
+func testRP() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{ID: "votex.example", Name: "Votex", Origins: []string{origin}, Timeout: time.Minute}
+}
+
+func mustChallenge(t *testing.T) []byte {
+	t.Helper()
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatalf("failed to generate challenge: %v", err)
+	}
+	return challenge
+}
+
+// register runs a registration ceremony and returns the verified credential
+func register(t *testing.T, rp *webauthn.RelyingParty, authenticator *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+	challenge := mustChallenge(t)
+	options := rp.CreationOptions(challenge, webauthn.UserEntity{ID: []byte("user-1"), Name: "testuser", DisplayName: "testuser"}, nil)
+
+	credential, err := rp.VerifyRegistration(challenge, authenticator.Register(origin, options))
+	if err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+	return credential
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	rp := testRP()
+	authenticator := webauthntest.New()
+	credential := register(t, rp, authenticator)
+
+	if string(credential.ID) != string(authenticator.CredentialID) {
+		t.Errorf("credential id = %x, want %x", credential.ID, authenticator.CredentialID)
+	}
+
+	signCount := credential.SignCount
+	for i := 0; i < 2; i++ {
+		challenge := mustChallenge(t)
+		resp := authenticator.Login(origin, rp.RequestOptions(challenge, nil))
+
+		count, err := rp.VerifyAssertion(challenge, resp, credential.PublicKey, signCount)
+		if err != nil {
+			t.Fatalf("assertion %d failed: %v", i, err)
+		}
+		if count <= signCount {
+			t.Errorf("sign count did not advance: %d -> %d", signCount, count)
+		}
+		signCount = count
+	}
+}
+
+func TestVerifyRegistration_Rejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		rpID    string
+		uv      bool
+		tamper  func(challenge []byte) []byte
+		wantErr error
+	}{
+		{name: "foreign origin", origin: "https://evil.example", rpID: "votex.example", uv: true, wantErr: webauthn.ErrOriginMismatch},
+		{name: "foreign rp id", origin: origin, rpID: "evil.example", uv: true, wantErr: webauthn.ErrRPIDMismatch},
+		{name: "no user verification", origin: origin, rpID: "votex.example", wantErr: webauthn.ErrUserNotVerified},
+		{
+			name:    "different challenge",
+			origin:  origin,
+			rpID:    "votex.example",
+			uv:      true,
+			tamper:  func([]byte) []byte { return []byte("another challenge") },
+			wantErr: webauthn.ErrChallengeMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := testRP()
+			authenticator := webauthntest.New()
+			authenticator.UserVerified = tt.uv
+
+			challenge := mustChallenge(t)
+			options := rp.CreationOptions(challenge, webauthn.UserEntity{ID: []byte("user-1"), Name: "testuser"}, nil)
+			options.RP.ID = tt.rpID
+			if tt.tamper != nil {
+				options.Challenge = tt.tamper(challenge)
+			}
+
+			_, err := rp.VerifyRegistration(challenge, authenticator.Register(tt.origin, options))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRegistration_MalformedAttestation(t *testing.T) {
+	rp := testRP()
+	challenge := mustChallenge(t)
+	resp := webauthntest.New().Register(origin, rp.CreationOptions(challenge, webauthn.UserEntity{ID: []byte("user-1")}, nil))
+
+	for name, attestation := range map[string][]byte{
+		"truncated":         resp.Response.AttestationObject[:len(resp.Response.AttestationObject)-10],
+		"indefinite length": {0xbf, 0xff},
+		"deep nesting":      {0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x00},
+		"huge array":        {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	} {
+		t.Run(name, func(t *testing.T) {
+			bad := *resp
+			bad.Response.AttestationObject = attestation
+			if _, err := rp.VerifyRegistration(challenge, &bad); !errors.Is(err, webauthn.ErrMalformed) {
+				t.Errorf("got %v, want ErrMalformed", err)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion_Rejects(t *testing.T) {
+	rp := testRP()
+
+	t.Run("tampered signature", func(t *testing.T) {
+		authenticator := webauthntest.New()
+		credential := register(t, rp, authenticator)
+
+		challenge := mustChallenge(t)
+		resp := authenticator.Login(origin, rp.RequestOptions(challenge, nil))
+		resp.Response.Signature[len(resp.Response.Signature)-1] ^= 0xff
+
+		if _, err := rp.VerifyAssertion(challenge, resp, credential.PublicKey, 0); !errors.Is(err, webauthn.ErrInvalidSignature) {
+			t.Errorf("got %v, want ErrInvalidSignature", err)
+		}
+	})
+
+	t.Run("key from another authenticator", func(t *testing.T) {
+		credential := register(t, rp, webauthntest.New())
+
+		challenge := mustChallenge(t)
+		resp := webauthntest.New().Login(origin, rp.RequestOptions(challenge, nil))
+
+		if _, err := rp.VerifyAssertion(challenge, resp, credential.PublicKey, 0); !errors.Is(err, webauthn.ErrInvalidSignature) {
+			t.Errorf("got %v, want ErrInvalidSignature", err)
+		}
+	})
+
+	t.Run("sign count regression", func(t *testing.T) {
+		authenticator := webauthntest.New()
+		credential := register(t, rp, authenticator)
+
+		challenge := mustChallenge(t)
+		resp := authenticator.Login(origin, rp.RequestOptions(challenge, nil))
+
+		if _, err := rp.VerifyAssertion(challenge, resp, credential.PublicKey, 5); !errors.Is(err, webauthn.ErrSignCountRegression) {
+			t.Errorf("got %v, want ErrSignCountRegression", err)
+		}
+	})
+
+	t.Run("counterless authenticator", func(t *testing.T) {
+		authenticator := webauthntest.New()
+		authenticator.Counterless = true
+		credential := register(t, rp, authenticator)
+
+		challenge := mustChallenge(t)
+		resp := authenticator.Login(origin, rp.RequestOptions(challenge, nil))
+
+		if count, err := rp.VerifyAssertion(challenge, resp, credential.PublicKey, 0); err != nil || count != 0 {
+			t.Errorf("got (%d, %v), want (0, nil)", count, err)
+		}
+	})
+
+	t.Run("registration response replayed as assertion", func(t *testing.T) {
+		authenticator := webauthntest.New()
+		credential := register(t, rp, authenticator)
+
+		challenge := mustChallenge(t)
+		reg := authenticator.Register(origin, rp.CreationOptions(challenge, webauthn.UserEntity{ID: []byte("user-1")}, nil))
+		resp := authenticator.Login(origin, rp.RequestOptions(challenge, nil))
+		resp.Response.ClientDataJSON = reg.Response.ClientDataJSON
+
+		if _, err := rp.VerifyAssertion(challenge, resp, credential.PublicKey, 0); !errors.Is(err, webauthn.ErrMalformed) {
+			t.Errorf("got %v, want ErrMalformed", err)
+		}
+	})
+}
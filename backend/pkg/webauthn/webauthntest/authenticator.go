@@ -0,0 +1,196 @@
+// Package webauthntest provides a software authenticator for exercising the
+// WebAuthn ceremonies in tests without a browser or security key.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+
+	"github.com/user/votex-template/backend/pkg/webauthn"
+)
+
+// Authenticator holds a single ES256 credential, like a platform passkey.
+// It signs whatever it is asked to, so tests choose the origin and RP ID
+// independently of the options they received.
+type Authenticator struct {
+	CredentialID []byte
+	UserHandle   []byte
+	// SignCount is incremented before every assertion; leave Counterless
+	// set to report zero throughout, as synced passkeys do
+	SignCount   uint32
+	Counterless bool
+	// UserVerified controls the UV flag in the authenticator data
+	UserVerified bool
+
+	key *ecdsa.PrivateKey
+}
+
+// New returns an authenticator with a fresh key pair and credential id
+func New() *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return &Authenticator{CredentialID: id, UserVerified: true, key: key}
+}
+
+// Register answers navigator.credentials.create for options as a browser on origin would
+func (a *Authenticator) Register(origin string, options webauthn.CreationOptions) *webauthn.RegistrationResponse {
+	a.UserHandle = options.User.ID
+	clientData := a.clientData("webauthn.create", options.Challenge, origin)
+
+	authData := a.authData(options.RP.ID, true)
+	attestation := encodeMap(map[string][]byte{
+		"fmt":      encodeText("none"),
+		"attStmt":  {0xa0},
+		"authData": encodeBytes(authData),
+	})
+
+	return &webauthn.RegistrationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		RawID: a.CredentialID,
+		Type:  "public-key",
+		Response: webauthn.AuthenticatorAttestationResponse{
+			ClientDataJSON:    clientData,
+			AttestationObject: attestation,
+			Transports:        []string{"internal"},
+		},
+	}
+}
+
+// Login answers navigator.credentials.get for options as a browser on origin would
+func (a *Authenticator) Login(origin string, options webauthn.RequestOptions) *webauthn.AssertionResponse {
+	if !a.Counterless {
+		a.SignCount++
+	}
+	clientData := a.clientData("webauthn.get", options.Challenge, origin)
+	authData := a.authData(options.RPID, false)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return &webauthn.AssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		RawID: a.CredentialID,
+		Type:  "public-key",
+		Response: webauthn.AuthenticatorAssertionResponse{
+			ClientDataJSON:    clientData,
+			AuthenticatorData: authData,
+			Signature:         sig,
+			UserHandle:        a.UserHandle,
+		},
+	}
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte, origin string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+func (a *Authenticator) authData(rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags := byte(0x01) // user present
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	if attested {
+		flags |= 0x40
+	}
+
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.SignCount)
+	if !attested {
+		return data
+	}
+
+	data = append(data, make([]byte, 16)...) // zero AAGUID, as with "none" attestation
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.CredentialID)))
+	data = append(data, a.CredentialID...)
+	return append(data, a.coseKey()...)
+}
+
+// coseKey encodes the public key as an EC2 COSE_Key with canonical key order
+func (a *Authenticator) coseKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.PublicKey.X.FillBytes(x)
+	a.key.PublicKey.Y.FillBytes(y)
+
+	key := []byte{0xa5}
+	key = append(key, encodeInt(1)...)
+	key = append(key, encodeInt(2)...) // kty: EC2
+	key = append(key, encodeInt(3)...)
+	key = append(key, encodeInt(webauthn.AlgES256)...)
+	key = append(key, encodeInt(-1)...)
+	key = append(key, encodeInt(1)...) // crv: P-256
+	key = append(key, encodeInt(-2)...)
+	key = append(key, encodeBytes(x)...)
+	key = append(key, encodeInt(-3)...)
+	return append(key, encodeBytes(y)...)
+}
+
+// The helpers below write just enough CBOR for attestation objects
+
+func encodeHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+}
+
+func encodeInt(n int64) []byte {
+	if n < 0 {
+		return encodeHead(1, uint64(-1-n))
+	}
+	return encodeHead(0, uint64(n))
+}
+
+func encodeBytes(b []byte) []byte {
+	return append(encodeHead(2, uint64(len(b))), b...)
+}
+
+func encodeText(s string) []byte {
+	return append(encodeHead(3, uint64(len(s))), s...)
+}
+
+// encodeMap writes a map of text keys to already encoded values
+func encodeMap(m map[string][]byte) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := encodeHead(5, uint64(len(m)))
+	for _, k := range keys {
+		out = append(out, encodeText(k)...)
+		out = append(out, m[k]...)
+	}
+	return out
+}